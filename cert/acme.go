@@ -0,0 +1,75 @@
+package cert
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// ACMEConfig describes the ACME account and the domains of the certificate
+type ACMEConfig struct {
+	DirectoryURL string
+	Email        string
+	Domains      []string
+	CacheDir     string
+	// CACert is a PEM file trusted for the ACME server itself, for a private or test server
+	CACert string
+}
+
+// NewACMEManager returns a certificate manager that gets and renews certificates for
+// the configured domains, autocert renews 30 days before expiry
+func NewACMEManager(conf ACMEConfig) (*autocert.Manager, error) {
+	if len(conf.Domains) == 0 {
+		return nil, errors.New("No ACME domain")
+	}
+	if conf.CacheDir == "" {
+		return nil, errors.New("No ACME cache directory")
+	}
+	if err := os.MkdirAll(conf.CacheDir, 0700); err != nil {
+		return nil, err
+	}
+	client := &acme.Client{DirectoryURL: conf.DirectoryURL}
+	if conf.CACert != "" {
+		pem, err := os.ReadFile(conf.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read ACME CA certificate: %s", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificate found in %s", conf.CACert)
+		}
+		client.HTTPClient = &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		}
+	}
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(conf.CacheDir),
+		HostPolicy: autocert.HostWhitelist(conf.Domains...),
+		Email:      conf.Email,
+		Client:     client,
+	}, nil
+}
+
+// SplitDomains splits a comma separated domain list
+func SplitDomains(list string) []string {
+	var domains []string
+	for _, d := range strings.Split(list, ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			domains = append(domains, d)
+		}
+	}
+	return domains
+}
@@ -0,0 +1,56 @@
+package cert
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSplitDomains(t *testing.T) {
+	d := SplitDomains(" repman.example.com, ,api.example.com")
+	if len(d) != 2 || d[0] != "repman.example.com" || d[1] != "api.example.com" {
+		t.Errorf("Unexpected domains %v", d)
+	}
+	if _, err := NewACMEManager(ACMEConfig{CacheDir: t.TempDir()}); err == nil {
+		t.Errorf("Expected error without domain")
+	}
+}
+
+// TestACMEIssue gets a certificate from a local ACME server like pebble started with
+// PEBBLE_VA_ALWAYS_VALID=1, for example:
+// REPMAN_ACME_DIRECTORY=https://localhost:14000/dir REPMAN_ACME_CA=pebble.minica.pem go test ./cert -run ACME
+func TestACMEIssue(t *testing.T) {
+	directory := os.Getenv("REPMAN_ACME_DIRECTORY")
+	if directory == "" {
+		t.Skip("REPMAN_ACME_DIRECTORY is not set")
+	}
+	m, err := NewACMEManager(ACMEConfig{
+		DirectoryURL: directory,
+		Email:        "test@example.com",
+		Domains:      []string{"repman.example.com"},
+		CacheDir:     t.TempDir(),
+		CACert:       os.Getenv("REPMAN_ACME_CA"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// answer http-01 challenges when the ACME server validates them
+	ln, err := net.Listen("tcp", "127.0.0.1:5002")
+	if err == nil {
+		go http.Serve(ln, m.HTTPHandler(nil))
+		defer ln.Close()
+	}
+	notAfter, err := CertificateNotAfter(m.GetCertificate, "repman.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if notAfter.Before(time.Now()) {
+		t.Errorf("Expected a valid certificate got %s", notAfter)
+	}
+	if _, err = m.GetCertificate(&tls.ClientHelloInfo{ServerName: "other.example.com"}); err == nil {
+		t.Errorf("Expected error for a domain outside the whitelist")
+	}
+}
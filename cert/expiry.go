@@ -0,0 +1,55 @@
+package cert
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// StatusTimeLayout is the OpenSSL time format of the Ssl_server_not_after status
+const StatusTimeLayout = "Jan _2 15:04:05 2006 MST"
+
+// ReadCertificateFile returns the first certificate of a PEM file
+func ReadCertificateFile(path string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseCertificatePEM(data)
+}
+
+// ParseCertificatePEM returns the first certificate of PEM data
+func ParseCertificatePEM(data []byte) (*x509.Certificate, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("No certificate found in PEM data")
+		}
+		if block.Type == "CERTIFICATE" {
+			return x509.ParseCertificate(block.Bytes)
+		}
+	}
+}
+
+// ParseStatusTime parses a certificate date of the Ssl_server_not_after status like Apr 12 10:00:00 2026 GMT
+func ParseStatusTime(value string) (time.Time, error) {
+	t, err := time.Parse(StatusTimeLayout, strings.Join(strings.Fields(value), " "))
+	if err != nil {
+		return t, fmt.Errorf("Invalid certificate date %q", value)
+	}
+	return t, nil
+}
+
+// DaysLeft returns the number of whole days before notAfter, negative once expired
+func DaysLeft(notAfter time.Time, now time.Time) int {
+	d := notAfter.Sub(now)
+	if d < 0 {
+		return int(d/(24*time.Hour)) - 1
+	}
+	return int(d / (24 * time.Hour))
+}
@@ -0,0 +1,90 @@
+package cert
+
+import (
+	"crypto/tls"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeKeyPair(t *testing.T, dir string, validFor time.Duration) (string, string) {
+	ValidFor = validFor
+	defer func() { ValidFor = 365 * 24 * time.Hour }()
+	key, crt, err := GenerateKeyAndCert()
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPath := filepath.Join(dir, "server-cert.pem")
+	keyPath := filepath.Join(dir, "server-key.pem")
+	if err = os.WriteFile(certPath, crt, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(keyPath, key, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certPath, keyPath
+}
+
+func TestReadCertificateFile(t *testing.T) {
+	certPath, _ := writeKeyPair(t, t.TempDir(), 10*24*time.Hour)
+	c, err := ReadCertificateFile(certPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := DaysLeft(c.NotAfter, time.Now()); d != 9 && d != 10 {
+		t.Errorf("Expected 10 days left got %d", d)
+	}
+	if _, err = ParseCertificatePEM([]byte("no pem")); err == nil {
+		t.Errorf("Expected error for invalid PEM")
+	}
+}
+
+func TestParseStatusTime(t *testing.T) {
+	for _, value := range []string{"Apr 12 10:00:00 2026 GMT", "Apr  2 10:00:00 2026 GMT"} {
+		if _, err := ParseStatusTime(value); err != nil {
+			t.Errorf("Expected valid date for %q got %s", value, err)
+		}
+	}
+	if _, err := ParseStatusTime("2026-04-12"); err == nil {
+		t.Errorf("Expected error for invalid date")
+	}
+	now := time.Date(2026, 4, 12, 10, 0, 0, 0, time.UTC)
+	if d := DaysLeft(now.Add(36*time.Hour), now); d != 1 {
+		t.Errorf("Expected 1 day left got %d", d)
+	}
+	if d := DaysLeft(now.Add(-time.Hour), now); d != -1 {
+		t.Errorf("Expected expired got %d", d)
+	}
+}
+
+func TestKeyPairReloader(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeKeyPair(t, dir, 24*time.Hour)
+	r, err := NewKeyPairReloader(certPath, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := CertificateNotAfter(r.GetCertificate, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// renew the files with a later mtime
+	writeKeyPair(t, dir, 90*24*time.Hour)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certPath, later, later)
+	after, err := CertificateNotAfter(r.GetCertificate, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !after.After(before.Add(80 * 24 * time.Hour)) {
+		t.Errorf("Expected renewed certificate got %s", after)
+	}
+	// broken files keep the last good pair
+	os.WriteFile(certPath, []byte("broken"), 0600)
+	os.Chtimes(certPath, later.Add(time.Minute), later.Add(time.Minute))
+	c, err := r.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil || c == nil {
+		t.Errorf("Expected previous certificate got %v", err)
+	}
+}
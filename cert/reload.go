@@ -0,0 +1,82 @@
+package cert
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"sync"
+	"time"
+)
+
+// KeyPairReloader serves a certificate and key pair and loads them again when the
+// certificate file changes, so that a renewed certificate is used without restart
+type KeyPairReloader struct {
+	certPath string
+	keyPath  string
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	modTime  time.Time
+}
+
+// NewKeyPairReloader loads a certificate and key pair
+func NewKeyPairReloader(certPath string, keyPath string) (*KeyPairReloader, error) {
+	r := &KeyPairReloader{certPath: certPath, keyPath: keyPath}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *KeyPairReloader) reload() error {
+	st, err := os.Stat(r.certPath)
+	if err != nil {
+		return err
+	}
+	if r.cert != nil && st.ModTime().Equal(r.modTime) {
+		return nil
+	}
+	c, err := tls.LoadX509KeyPair(r.certPath, r.keyPath)
+	if err != nil {
+		return err
+	}
+	if c.Leaf == nil {
+		c.Leaf, err = x509.ParseCertificate(c.Certificate[0])
+		if err != nil {
+			return err
+		}
+	}
+	r.cert = &c
+	r.modTime = st.ModTime()
+	return nil
+}
+
+// GetCertificate is a tls.Config GetCertificate callback, the previous pair is kept
+// when the new files can not be loaded
+func (r *KeyPairReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reload()
+	return r.cert, nil
+}
+
+// CertificateNotAfter returns the expiry of the certificate served by a GetCertificate callback
+func CertificateNotAfter(getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error), serverName string) (time.Time, error) {
+	// announce ECDSA support like modern clients so that ACME does not issue an extra RSA certificate
+	c, err := getCertificate(&tls.ClientHelloInfo{
+		ServerName:       serverName,
+		SignatureSchemes: []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256},
+		SupportedCurves:  []tls.CurveID{tls.CurveP256},
+		CipherSuites:     []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	if c.Leaf != nil {
+		return c.Leaf.NotAfter, nil
+	}
+	leaf, err := x509.ParseCertificate(c.Certificate[0])
+	if err != nil {
+		return time.Time{}, err
+	}
+	return leaf.NotAfter, nil
+}
@@ -10,6 +10,7 @@
 package clients
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
@@ -64,3 +65,30 @@ func cliAPICmd(urlpost string, params []RequetParam) (string, error) {
 
 	return string(body), nil
 }
+
+func cliAPIPostCmd(urlpost string, body []byte) (string, error) {
+	var bearer = "Bearer " + cliToken
+	req, err := http.NewRequest("POST", urlpost, bytes.NewBuffer(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", bearer)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := cliConn.Do(req)
+	if err != nil {
+		log.Println("ERROR", err)
+		return "", err
+	}
+
+	defer resp.Body.Close()
+	res, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Println("ERROR", err)
+		return "", err
+	}
+	if resp.StatusCode != 200 {
+		return "", errors.New(string(res))
+	}
+
+	return string(res), nil
+}
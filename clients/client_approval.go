@@ -0,0 +1,46 @@
+//go:build clients
+// +build clients
+
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Author: Stephane Varoqui  <svaroqui@gmail.com>
+// License: GNU General Public License, version 3. Redistribution/Reuse of this code is permitted under the GNU v3 license, as an additional term ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package clients
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var approvalCmd = &cobra.Command{
+	Use:   "approval",
+	Short: "Approve or reject pending operations",
+	Long:  `The approval command lists the operations of a cluster waiting for a second user, approves them so that they run, or rejects them`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cliInit(true)
+		urlpost := "https://" + cliHost + ":" + cliPort + "/api/clusters/" + cliClusters[cliClusterIndex] + "/approvals"
+		var res string
+		var err error
+		switch {
+		case cliApprovalApprove != "":
+			res, err = cliAPIPostCmd(urlpost+"/"+cliApprovalApprove+"/actions/approve", nil)
+		case cliApprovalReject != "":
+			res, err = cliAPIPostCmd(urlpost+"/"+cliApprovalReject+"/actions/reject?reason="+url.QueryEscape(cliApprovalReason), nil)
+		case cliApprovalShow != "":
+			res, err = cliAPICmd(urlpost+"/"+cliApprovalShow, nil)
+		default:
+			res, err = cliAPICmd(urlpost, nil)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "API call error: %s", err)
+			os.Exit(1)
+		}
+		fmt.Println(res)
+		os.Exit(0)
+	},
+}
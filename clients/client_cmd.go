@@ -46,6 +46,17 @@ var (
 	cliCert                      string
 	cliNoCheckCert               bool
 	cliToken                     string
+	cliAPIToken                  string
+	cliTokenCreate               string
+	cliTokenGrants               string
+	cliTokenClusters             string
+	cliTokenCIDRs                string
+	cliTokenTTL                  string
+	cliTokenRevoke               string
+	cliApprovalApprove           string
+	cliApprovalReject            string
+	cliApprovalReason            string
+	cliApprovalShow              string
 	cliClusters                  []string
 	cliClusterIndex              int
 	cliTlog                      s18log.TermLog
@@ -152,14 +163,19 @@ func cliGetpasswd() string {
 func cliInit(needcluster bool) {
 	var err error
 
-	cliToken, err = cliLogin()
-	if err != nil {
-		cliPassword = cliGetpasswd()
-
+	if cliAPIToken != "" {
+		// service account token used as bearer without login
+		cliToken = cliAPIToken
+	} else {
 		cliToken, err = cliLogin()
 		if err != nil {
-			fmt.Printf("\n'%s'\n", err)
-			os.Exit(14)
+			cliPassword = cliGetpasswd()
+
+			cliToken, err = cliLogin()
+			if err != nil {
+				fmt.Printf("\n'%s'\n", err)
+				os.Exit(14)
+			}
 		}
 	}
 	cliClusters, err = cliGetClusters()
@@ -219,6 +235,7 @@ func initServerApiFlags(cmd *cobra.Command) {
 	cmd.Flags().StringVar(&cliHost, "host", "127.0.0.1", "Host of replication-manager")
 	cmd.Flags().StringVar(&cliCert, "cert", "", "Public certificate")
 	cmd.Flags().BoolVar(&cliNoCheckCert, "insecure", true, "Don't check certificate")
+	cmd.Flags().StringVar(&cliAPIToken, "token", "", "Service account API token used instead of user and password")
 	viper.BindPFlags(cmd.Flags())
 }
 
@@ -282,6 +299,26 @@ func initApiFlags(cmd *cobra.Command) {
 	viper.BindPFlags(cmd.Flags())
 }
 
+func initTokenFlags(cmd *cobra.Command) {
+	initServerApiFlags(tokenCmd)
+	tokenCmd.Flags().StringVar(&cliTokenCreate, "create", "", "Create a token for the service account")
+	tokenCmd.Flags().StringVar(&cliTokenGrants, "grants", "", "Token grants in acl format separated by space, a subset of the caller grants")
+	tokenCmd.Flags().StringVar(&cliTokenClusters, "clusters", "", "Token clusters separated by comma, default all")
+	tokenCmd.Flags().StringVar(&cliTokenCIDRs, "cidrs", "", "Token source CIDR allowlist separated by comma, default any")
+	tokenCmd.Flags().StringVar(&cliTokenTTL, "ttl", "", "Token time to live as 720h, default never expire")
+	tokenCmd.Flags().StringVar(&cliTokenRevoke, "revoke", "", "Revoke the token id")
+	viper.BindPFlags(cmd.Flags())
+}
+
+func initApprovalFlags(cmd *cobra.Command) {
+	initServerApiFlags(approvalCmd)
+	approvalCmd.Flags().StringVar(&cliApprovalApprove, "approve", "", "Approve the operation id, it runs with the credentials of its requester")
+	approvalCmd.Flags().StringVar(&cliApprovalReject, "reject", "", "Reject the operation id")
+	approvalCmd.Flags().StringVar(&cliApprovalReason, "reason", "", "Reason of the rejection")
+	approvalCmd.Flags().StringVar(&cliApprovalShow, "show", "", "Show the operation id and its result")
+	viper.BindPFlags(cmd.Flags())
+}
+
 func initServerFlags(cmd *cobra.Command) {
 	initServerApiFlags(serverCmd)
 	serverCmd.Flags().StringVar(&cliServerID, "id", "", "server id")
@@ -334,6 +371,13 @@ func init() {
 	initServerFlags(serverCmd)
 	initClusterFlags(serverCmd)
 
+	rootClientCmd.AddCommand(tokenCmd)
+	initTokenFlags(tokenCmd)
+
+	rootClientCmd.AddCommand(approvalCmd)
+	initApprovalFlags(approvalCmd)
+	initClusterFlags(approvalCmd)
+
 	rootClientCmd.AddCommand(showCmd)
 	initShowFlags(showCmd)
 	initClusterFlags(showCmd)
@@ -0,0 +1,64 @@
+//go:build clients
+// +build clients
+
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Author: Stephane Varoqui  <svaroqui@gmail.com>
+// License: GNU General Public License, version 3. Redistribution/Reuse of this code is permitted under the GNU v3 license, as an additional term ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package clients
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/signal18/replication-manager/utils/apitoken"
+	"github.com/spf13/cobra"
+)
+
+func cliSplitList(list string, sep string) []string {
+	var res []string
+	for _, v := range strings.Split(list, sep) {
+		if v = strings.TrimSpace(v); v != "" {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+var tokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Manage service account API tokens",
+	Long:  `The token command lists, creates and revokes the API tokens of service accounts, the clear token is only printed at creation`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cliInit(false)
+		urlpost := "https://" + cliHost + ":" + cliPort + "/api/tokens"
+		var res string
+		var err error
+		switch {
+		case cliTokenCreate != "":
+			req := apitoken.Request{
+				Account:  cliTokenCreate,
+				Grants:   cliSplitList(cliTokenGrants, " "),
+				Clusters: cliSplitList(cliTokenClusters, ","),
+				CIDRs:    cliSplitList(cliTokenCIDRs, ","),
+				TTL:      cliTokenTTL,
+			}
+			body, _ := json.Marshal(req)
+			res, err = cliAPIPostCmd(urlpost, body)
+		case cliTokenRevoke != "":
+			res, err = cliAPIPostCmd(urlpost+"/"+cliTokenRevoke+"/actions/revoke", nil)
+		default:
+			res, err = cliAPICmd(urlpost, nil)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "API call error: %s", err)
+			os.Exit(1)
+		}
+		fmt.Println(res)
+		os.Exit(0)
+	},
+}
@@ -39,7 +39,9 @@ import (
 	"github.com/signal18/replication-manager/utils/logrus/hooks/pushover"
 	"github.com/signal18/replication-manager/utils/mailer"
 	"github.com/signal18/replication-manager/utils/misc"
+	"github.com/signal18/replication-manager/utils/rbac"
 	"github.com/signal18/replication-manager/utils/s18log"
+	"github.com/signal18/replication-manager/utils/secaudit"
 	"github.com/signal18/replication-manager/utils/state"
 	clog "github.com/sirupsen/logrus"
 	log "github.com/sirupsen/logrus"
@@ -206,6 +208,7 @@ type Cluster struct {
 	idSchedulerDbsjobsSsh     cron.EntryID                `json:"-"`
 	idSchedulerRollingReprov  cron.EntryID                `json:"-"`
 	idSchedulerAlertDisable   cron.EntryID                `json:"-"`
+	idSchedulerStagingRefresh cron.EntryID                `json:"-"`
 	debugLineMap              map[string]int              `json:"-"`
 	WaitingRejoin             int                         `json:"waitingRejoin"`
 	WaitingSwitchover         int                         `json:"waitingSwitchover"`
@@ -228,6 +231,53 @@ type Cluster struct {
 	InBinlogBackup            bool                        `json:"inBinlogBackup"`
 	InResticBackup            bool                        `json:"inResticBackup"`
 	InRollingRestart          bool                        `json:"inRollingRestart"`
+	switchoverDrain           DrainStatus                 `json:"-"`
+	switchoverDrainMutex      sync.Mutex                  `json:"-"`
+	proxyDrifts               map[string]ProxyDrift       `json:"-"`
+	proxyDriftMutex           sync.Mutex                  `json:"-"`
+	inProxyDriftCheck         bool                        `json:"-"`
+	vaultSecrets              map[string]*VaultSecret     `json:"-"`
+	vaultPaths                map[string]string           `json:"-"`
+	vaultMutex                sync.Mutex                  `json:"-"`
+	certExpiries              []CertificateExpiry         `json:"-"`
+	certMutex                 sync.Mutex                  `json:"-"`
+	apiCertNotAfter           time.Time                   `json:"-"`
+	inCertRenew               bool                        `json:"-"`
+	dbUsersMutex              sync.Mutex                  `json:"-"`
+	dbUsersDriftMutex         sync.Mutex                  `json:"-"`
+	inDBUsersDriftCheck       bool                        `json:"-"`
+	secAuditFindings          []secaudit.Finding          `json:"-"`
+	secAuditMutex             sync.Mutex                  `json:"-"`
+	inSecurityAudit           bool                        `json:"-"`
+	stagingJobs               []StagingJob                `json:"-"`
+	stagingMutex              sync.Mutex                  `json:"-"`
+	upgrade                   *UpgradeStatus              `json:"-"`
+	upgradePaused             bool                        `json:"-"`
+	upgradeAborted            bool                        `json:"-"`
+	upgradeMutex              sync.Mutex                  `json:"-"`
+	errantJobs                []ErrantRepairJob           `json:"-"`
+	errantMutex               sync.Mutex                  `json:"-"`
+	consistency               ConsistencyStatus           `json:"-"`
+	consistencyStop           bool                        `json:"-"`
+	consistencyMutex          sync.Mutex                  `json:"-"`
+	wsrepJobs                 []WsrepJob                  `json:"-"`
+	wsrepDesyncServer         *ServerMonitor              `json:"-"`
+	wsrepNonPrimarySince      time.Time                   `json:"-"`
+	wsrepMutex                sync.Mutex                  `json:"-"`
+	delayedPaused             []string                    `json:"-"`
+	delayedMutex              sync.Mutex                  `json:"-"`
+	playbookRuns              []PlaybookRun               `json:"-"`
+	playbookCounters          map[string]*playbookCounter `json:"-"`
+	playbookApprovals         map[string]*ServerMonitor   `json:"-"`
+	playbookMutex             sync.Mutex                  `json:"-"`
+	rbacRoles                 map[string]rbac.Role        `json:"-"`
+	rbacBindings              map[string][]string         `json:"-"`
+	rbacMutex                 sync.RWMutex                `json:"-"`
+	ldapUsers                 map[string][]string         `json:"-"`
+	ldapMutex                 sync.RWMutex                `json:"-"`
+	apiUsersMutex             sync.Mutex                  `json:"-"`
+	tokenUsers                map[string][]string         `json:"-"`
+	tokenMutex                sync.RWMutex                `json:"-"`
 	Mailer                    *mailer.Mailer              `json:"-"`
 	LastDelayStatPrint        time.Time
 	sync.Mutex
@@ -310,6 +360,13 @@ const (
 	ConstMonitorStandby string = "S"
 )
 
+// Status of the background jobs of the cluster: staging, errant repair, wsrep recovery and replication playbooks
+const (
+	JobStatusRunning string = "running"
+	JobStatusSuccess string = "success"
+	JobStatusFailed  string = "failed"
+)
+
 const (
 	VaultConfigStoreV2 string = "config_store_v2"
 	VaultDbEngine      string = "database_engine"
@@ -421,6 +478,7 @@ func (cluster *Cluster) InitFromConf() {
 	cluster.LoadAPIUsers()
 	cluster.SaveAcls()
 	cluster.GetPersitentState()
+	cluster.loadConsistency()
 
 	cluster.LogPushover = log.New()
 	cluster.LogPushover.SetFormatter(&log.TextFormatter{FullTimestamp: true})
@@ -563,6 +621,7 @@ func (cluster *Cluster) initScheduler() {
 		cluster.SetSchedulerRollingRestart()
 		cluster.SetSchedulerDbJobsSsh()
 		cluster.SetSchedulerAlertDisable()
+		cluster.SetSchedulerStagingRefresh()
 		cluster.scheduler.Start()
 	}
 
@@ -682,6 +741,20 @@ func (cluster *Cluster) Run() {
 						cluster.PrintDelayStat()
 					}
 					wg.Wait()
+					if cluster.StateMachine.GetHeartbeats()%30 == 0 && !cluster.IsInFailover() {
+						// Runs after proxies refresh to compare with fresh runtime states
+						go cluster.CheckProxiesDrift()
+						cluster.CheckCertificatesExpiry()
+						go cluster.CheckDBUsersDrift()
+						go cluster.CheckSecurityAudit()
+						cluster.CheckConsistency()
+					} else {
+						cluster.StateMachine.PreserveState("WARN0134")
+						cluster.StateMachine.PreserveState("WARN0135", "WARN0136")
+						cluster.StateMachine.PreserveState("WARN0138", "WARN0139")
+						cluster.StateMachine.PreserveState("WARN0140", "WARN0141", "WARN0142", "WARN0143", "WARN0144", "WARN0145", "WARN0146", "WARN0147")
+						cluster.StateMachine.PreserveState("WARN0148")
+					}
 				}
 				// AddChildServers can't be done before TopologyDiscover but need a refresh aquiring more fresh gtid vs current cluster so elelection win but server is ignored see electFailoverCandidate
 				err := cluster.AddChildServers()
@@ -692,6 +765,9 @@ func (cluster *Cluster) Run() {
 
 				cluster.IsFailable = cluster.GetStatus()
 				cluster.IsMasterDown = cluster.GetMaster() == nil || cluster.GetMaster().IsFailed()
+				cluster.CheckWsrep()
+				cluster.CheckGroupReplication()
+				cluster.CheckReplicationPlaybooks()
 				// CheckFailed trigger failover code if passing all false positiv and constraints
 				cluster.CheckFailed()
 
@@ -884,11 +960,12 @@ func (cluster *Cluster) Save() error {
 		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModConfigLoad, config.LvlDbg, "Saved called from %s#%d\n", file, no)
 	}
 	type Save struct {
-		Servers    string      `json:"servers"`
-		Crashes    crashList   `json:"crashes"`
-		SLA        state.Sla   `json:"sla"`
-		SLAHistory []state.Sla `json:"slaHistory"`
-		IsAllDbUp  bool        `json:"provisioned"`
+		Servers       string      `json:"servers"`
+		Crashes       crashList   `json:"crashes"`
+		SLA           state.Sla   `json:"sla"`
+		SLAHistory    []state.Sla `json:"slaHistory"`
+		IsAllDbUp     bool        `json:"provisioned"`
+		DelayedPaused []string    `json:"delayedPaused"`
 	}
 
 	var clsave Save
@@ -897,6 +974,7 @@ func (cluster *Cluster) Save() error {
 	clsave.SLA = cluster.StateMachine.GetSla()
 	clsave.IsAllDbUp = cluster.IsAllDbUp
 	clsave.SLAHistory = cluster.SLAHistory
+	clsave.DelayedPaused = cluster.GetDelayedPausedHosts()
 
 	saveJson, _ := json.MarshalIndent(clsave, "", "\t")
 	err := os.WriteFile(cluster.Conf.WorkingDir+"/"+cluster.Name+"/clusterstate.json", saveJson, 0644)
@@ -1790,13 +1868,13 @@ func (cluster *Cluster) DecryptSecretsFromVault() {
 			vault_config.Address = cluster.Conf.VaultServerAddr
 			client, err := cluster.Conf.GetVaultConnection()
 			if err == nil {
-				if cluster.Conf.VaultMode == VaultConfigStoreV2 {
-					vault_value, err := cluster.Conf.GetVaultCredentials(client, secret.Value, k)
-					if err != nil {
-						cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModVault, config.LvlWarn, "Unable to get %s Vault secret: %v", k, err)
-					} else if vault_value != "" {
-						secret.Value = vault_value
-					}
+				// keep the path to read the secret again on rotation or lease expiry
+				cluster.setVaultPath(k, secret.Value)
+				vault_value, err := cluster.getVaultSecretValue(client, k, secret.Value)
+				if err != nil {
+					cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModVault, config.LvlWarn, "Unable to get %s Vault secret: %v", k, err)
+				} else if vault_value != "" {
+					secret.Value = vault_value
 				}
 			} else {
 				cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModVault, config.LvlErr, "Unable to initialize AppRole auth method: %v", err)
@@ -23,6 +23,8 @@ type APIUser struct {
 	GitToken   string          `json:"-"`
 	GitUser    string          `json:"-"`
 	IsExternal bool            `json:"-"`
+	IsLDAP     bool            `json:"-"`
+	IsToken    bool            `json:"-"`
 	Roles      map[string]bool `json:"roles"`
 	Grants     map[string]bool `json:"grants"`
 }
@@ -76,6 +78,13 @@ func (u *APIUser) Granted(grant string) error {
 
 func (cluster *Cluster) IsValidACL(strUser string, strPassword string, URL string, AuthMethod string) bool {
 	if user, ok := cluster.APIUsers[strUser]; ok {
+		// Directory and token users have no password and only pass with their own method
+		if user.IsLDAP || user.IsToken {
+			if (AuthMethod == "ldap" && user.IsLDAP) || (AuthMethod == "token" && user.IsToken) {
+				return cluster.IsURLPassACL(strUser, URL, true)
+			}
+			return false
+		}
 		//		fmt.Printf("password :" + user.Password)
 		if user.Password == cluster.Conf.GetDecryptedPassword("api-credentials", strPassword) || AuthMethod == "oidc" {
 			return cluster.IsURLPassACL(strUser, URL, true)
@@ -89,7 +98,7 @@ func (cluster *Cluster) IsValidACL(strUser string, strPassword string, URL strin
 
 func (cluster *Cluster) GetAPIUser(strUser string, strPassword string) (APIUser, error) {
 	if user, ok := cluster.APIUsers[strUser]; ok {
-		if user.Password == strPassword {
+		if user.Password == strPassword && !user.IsLDAP && !user.IsToken {
 			return user, nil
 		}
 		return APIUser{}, fmt.Errorf("incorrect password")
@@ -210,6 +219,8 @@ func (cluster *Cluster) GetClusterUserDiscardACLs(acls string) map[string]ListUs
 }
 
 func (cluster *Cluster) LoadAPIUsers() error {
+	cluster.apiUsersMutex.Lock()
+	defer cluster.apiUsersMutex.Unlock()
 	meUsers := make(map[string]APIUser)
 	credentials := strings.Split(cluster.Conf.Secrets["api-credentials"].Value+","+cluster.Conf.Secrets["api-credentials-external"].Value, ",")
 	listACLs := cluster.GetClusterUserAllowACLs(cluster.Conf.APIUsersACLAllow)
@@ -260,36 +271,70 @@ func (cluster *Cluster) LoadAPIUsers() error {
 			}
 		}
 
-		// No Roles
-		visitor := true
-		for role, v := range newapiuser.Roles {
-			if role == config.RoleVisitor {
-				continue
-			}
-			if v {
-				visitor = false
-				break
-			}
-		}
-
-		if visitor {
-			newapiuser.Roles[config.RoleVisitor] = true
-		}
+		setVisitorRole(&newapiuser)
 
 		meUsers[newapiuser.User] = newapiuser
 	}
 
+	cluster.loadLDAPUsers(meUsers)
+	cluster.loadTokenUsers(meUsers)
 	cluster.APIUsers = meUsers
+	cluster.LoadRBAC()
 	return nil
 }
 
+// setAPIUser replaces one user, or removes it when u is nil, without reloading the
+// others. The map is copied so that readers keep a consistent view.
+func (cluster *Cluster) setAPIUser(user string, u *APIUser) {
+	cluster.apiUsersMutex.Lock()
+	defer cluster.apiUsersMutex.Unlock()
+	users := make(map[string]APIUser, len(cluster.APIUsers)+1)
+	for k, v := range cluster.APIUsers {
+		users[k] = v
+	}
+	if u == nil {
+		delete(users, user)
+	} else {
+		users[user] = *u
+	}
+	cluster.APIUsers = users
+}
+
+// setVisitorRole gives the visitor role to users without any other role
+func setVisitorRole(u *APIUser) {
+	for role, v := range u.Roles {
+		if role == config.RoleVisitor {
+			continue
+		}
+		if v {
+			return
+		}
+	}
+	u.Roles[config.RoleVisitor] = true
+}
+
+// isServerChannelsURL matches /api/clusters/<name>/servers/<server>/channels and its actions
+func (cluster *Cluster) isServerChannelsURL(URL string) bool {
+	prefix := "/api/clusters/" + cluster.Name + "/servers/"
+	if !strings.HasPrefix(URL, prefix) {
+		return false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(URL, prefix), "/", 3)
+	return len(parts) >= 2 && parts[1] == "channels"
+}
+
 func (cluster *Cluster) IsURLPassDatabasesACL(strUser string, URL string) bool {
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterProcess] {
+	grants := cluster.GetUserGrantsOnURL(strUser, URL)
+	// electing a group replication primary moves the writes like a switchover
+	if strings.Contains(URL, "actions/group-replication-primary") {
+		return grants[config.GrantClusterSwitchover]
+	}
+	if grants[config.GrantClusterProcess] {
 		if strings.Contains(URL, "/actions/run-jobs") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantProvDBProvision] {
+	if grants[config.GrantProvDBProvision] {
 		if strings.Contains(URL, "/actions/provision") {
 			return true
 		}
@@ -297,27 +342,27 @@ func (cluster *Cluster) IsURLPassDatabasesACL(strUser string, URL string) bool {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantProvDBUnprovision] {
+	if grants[config.GrantProvDBUnprovision] {
 		if strings.Contains(URL, "/actions/unprovision") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantDBStart] {
+	if grants[config.GrantDBStart] {
 		if strings.Contains(URL, "/actions/start") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantDBStop] {
+	if grants[config.GrantDBStop] {
 		if strings.Contains(URL, "/actions/stop") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterSwitchover] {
+	if grants[config.GrantClusterSwitchover] {
 		if strings.Contains(URL, "/actions/switchover") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterFailover] {
+	if grants[config.GrantClusterFailover] {
 		if strings.Contains(URL, "/actions/set-prefered") {
 			return true
 		}
@@ -328,17 +373,17 @@ func (cluster *Cluster) IsURLPassDatabasesACL(strUser string, URL string) bool {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantDBKill] {
+	if grants[config.GrantDBKill] {
 		if strings.Contains(URL, "/actions/kill") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantDBOptimize] {
+	if grants[config.GrantDBOptimize] {
 		if strings.Contains(URL, "/actions/analyze-pfs") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantDBAnalyse] {
+	if grants[config.GrantDBAnalyse] {
 		if strings.Contains(URL, "/actions/analyze-pfs") {
 			return true
 		}
@@ -349,7 +394,7 @@ func (cluster *Cluster) IsURLPassDatabasesACL(strUser string, URL string) bool {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantDBReplication] {
+	if grants[config.GrantDBReplication] {
 		if strings.Contains(URL, "/all-slaves-status") {
 			return true
 		}
@@ -362,6 +407,30 @@ func (cluster *Cluster) IsURLPassDatabasesACL(strUser string, URL string) bool {
 		if strings.Contains(URL, "actions/stop-slave") {
 			return true
 		}
+		if strings.Contains(URL, "actions/delayed-") {
+			return true
+		}
+		if strings.Contains(URL, "/errant-transactions/events") {
+			return true
+		}
+		if strings.Contains(URL, "actions/errant-repair") {
+			return true
+		}
+		if strings.Contains(URL, "actions/wsrep-") {
+			return true
+		}
+		if strings.Contains(URL, "actions/group-replication-") {
+			return true
+		}
+		if cluster.isServerChannelsURL(URL) {
+			return true
+		}
+		if strings.Contains(URL, "/replication-error") {
+			return true
+		}
+		if strings.Contains(URL, "actions/replication-playbook") {
+			return true
+		}
 		if strings.Contains(URL, "actions/skip-replication-event") {
 			return true
 		}
@@ -372,7 +441,7 @@ func (cluster *Cluster) IsURLPassDatabasesACL(strUser string, URL string) bool {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantDBBackup] {
+	if grants[config.GrantDBBackup] {
 		if strings.Contains(URL, "/actions/backup-logical") {
 			return true
 		}
@@ -389,7 +458,7 @@ func (cluster *Cluster) IsURLPassDatabasesACL(strUser string, URL string) bool {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantDBRestore] {
+	if grants[config.GrantDBRestore] {
 		if strings.Contains(URL, "/actions/reseed/") {
 			return true
 		}
@@ -400,7 +469,7 @@ func (cluster *Cluster) IsURLPassDatabasesACL(strUser string, URL string) bool {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterProcess] {
+	if grants[config.GrantClusterProcess] {
 		if strings.Contains(URL, "/actions/job-cancel/") {
 			return true
 		}
@@ -408,17 +477,17 @@ func (cluster *Cluster) IsURLPassDatabasesACL(strUser string, URL string) bool {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantDBReadOnly] {
+	if grants[config.GrantDBReadOnly] {
 		if strings.Contains(URL, "actions/toogle-read-only") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantProxyConfigFlag] {
+	if grants[config.GrantProxyConfigFlag] {
 		if strings.Contains(URL, "/config") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantDBLogs] {
+	if grants[config.GrantDBLogs] {
 		if strings.Contains(URL, "/processlist") {
 			return true
 		}
@@ -483,12 +552,12 @@ func (cluster *Cluster) IsURLPassDatabasesACL(strUser string, URL string) bool {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantDBCapture] {
+	if grants[config.GrantDBCapture] {
 		if strings.Contains(URL, "/actions/toogle-slow-query-capture") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantDBMaintenance] {
+	if grants[config.GrantDBMaintenance] {
 		if strings.Contains(URL, "/actions/optimize") {
 			return true
 		}
@@ -505,27 +574,27 @@ func (cluster *Cluster) IsURLPassDatabasesACL(strUser string, URL string) bool {
 			return true
 		}
 	}
-	/*	if cluster.APIUsers[strUser].Grants[config.GrantDBConfigCreate] {
+	/*	if grants[config.GrantDBConfigCreate] {
 			if strings.Contains(URL, "/kill") {
 				return true
 			}
 		}
-		if cluster.APIUsers[strUser].Grants[config.GrantDBConfigGet] {
+		if grants[config.GrantDBConfigGet] {
 			if strings.Contains(URL, "/kill") {
 				return true
 			}
 		}
-		if cluster.APIUsers[strUser].Grants[config.GrantDBConfigFlag] {
+		if grants[config.GrantDBConfigFlag] {
 			if strings.Contains(URL, "/kill") {
 				return true
 			}
 		}*/
-	if cluster.APIUsers[strUser].Grants[config.GrantDBShowVariables] {
+	if grants[config.GrantDBShowVariables] {
 		if strings.Contains(URL, "/variables") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantDBShowSchema] {
+	if grants[config.GrantDBShowSchema] {
 		if strings.Contains(URL, "/tables") {
 			return true
 		}
@@ -539,7 +608,7 @@ func (cluster *Cluster) IsURLPassDatabasesACL(strUser string, URL string) bool {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantDBShowStatus] {
+	if grants[config.GrantDBShowStatus] {
 		if strings.Contains(URL, "/status") {
 			return true
 		}
@@ -552,33 +621,45 @@ func (cluster *Cluster) IsURLPassDatabasesACL(strUser string, URL string) bool {
 }
 
 func (cluster *Cluster) IsURLPassProxiesACL(strUser string, URL string) bool {
+	grants := cluster.GetUserGrantsOnURL(strUser, URL)
 
-	if cluster.APIUsers[strUser].Grants[config.GrantProvProxyProvision] {
+	if grants[config.GrantProvProxyProvision] {
 		if strings.Contains(URL, "/actions/provision") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantProvProxyUnprovision] {
+	if grants[config.GrantProvProxyUnprovision] {
 		if strings.Contains(URL, "/actions/unprovision") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantProxyStart] {
+	if grants[config.GrantProxyStart] {
 		if strings.Contains(URL, "/actions/start") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantProxyStop] {
+	if grants[config.GrantProxyStop] {
 		if strings.Contains(URL, "/actions/stop") {
 			return true
 		}
 	}
+	if grants[config.GrantProxyConfigCreate] {
+		if strings.Contains(URL, "/actions/remediate-drift") {
+			return true
+		}
+	}
+	if grants[config.GrantProxyConfigGet] {
+		if strings.HasSuffix(URL, "/drift") {
+			return true
+		}
+	}
 	cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "ACL proxy check failed for user %s : %s ", strUser, URL)
 
 	return false
 }
 
 func (cluster *Cluster) IsURLPassACL(strUser string, URL string, errorPrint bool) bool {
+	grants := cluster.GetUserGrantsOnURL(strUser, URL)
 	switch URL {
 	case "/api/login":
 		return true
@@ -597,25 +678,34 @@ func (cluster *Cluster) IsURLPassACL(strUser string, URL string, errorPrint bool
 	}
 
 	if strings.Contains(URL, "/api/clusters/settings/actions/switch") {
-		return cluster.APIUsers[strUser].Grants[config.GrantGlobalSettings]
+		return grants[config.GrantGlobalSettings]
 	}
 	if strings.Contains(URL, "/api/clusters/settings/actions/set") {
-		return cluster.APIUsers[strUser].Grants[config.GrantGlobalSettings]
+		return grants[config.GrantGlobalSettings]
 	}
 	if strings.Contains(URL, "/api/clusters/settings/actions/clear") {
-		return cluster.APIUsers[strUser].Grants[config.GrantGlobalSettings]
+		return grants[config.GrantGlobalSettings]
 	}
 	if strings.Contains(URL, "/api/clusters/settings/actions/reload-clusters-plans") {
-		return cluster.APIUsers[strUser].Grants[config.GrantGlobalSettings]
+		return grants[config.GrantGlobalSettings]
+	}
+	if strings.Contains(URL, "/api/audit") {
+		return grants[config.GrantGlobalSettings]
+	}
+	if strings.Contains(URL, "/api/tokens") {
+		return grants[config.GrantGlobalSettings]
 	}
 
+	if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/group-replication/actions/") {
+		return grants[config.GrantClusterSwitchover]
+	}
 	if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/servers") {
 		return cluster.IsURLPassDatabasesACL(strUser, URL)
 	}
 	if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/proxies") {
 		return cluster.IsURLPassProxiesACL(strUser, URL)
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterSharding] {
+	if grants[config.GrantClusterSharding] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/schema") {
 			return true
 		}
@@ -623,63 +713,77 @@ func (cluster *Cluster) IsURLPassACL(strUser string, URL string, errorPrint bool
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterProcess] {
+	if grants[config.GrantClusterProcess] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/jobs") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterProcess] {
+	if grants[config.GrantClusterProcess] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/top") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterShowBackups] {
+	if grants[config.GrantClusterShowBackups] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/backups") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterShowRoutes] {
+	if grants[config.GrantClusterShowRoutes] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/queryrules") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterShowCertificates] {
+	if grants[config.GrantClusterShowCertificates] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/certificates") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterCertificatesReload] {
+	if grants[config.GrantClusterSettings] {
+		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/audit") {
+			return true
+		}
+		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/vault-secrets") {
+			return true
+		}
+	}
+	if grants[config.GrantClusterCertificatesReload] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/actions/certificates-reload") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterCertificatesRotate] {
+	if grants[config.GrantClusterCertificatesRotate] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/actions/certificates-rotate") {
 			return true
 		}
+		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/actions/certificates-renew") {
+			return true
+		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterResetSLA] {
+	if grants[config.GrantClusterResetSLA] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/actions/reset-sla") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterCreateMonitor] {
+	if grants[config.GrantClusterCreateMonitor] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/actions/addserver") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterDropMonitor] {
+	if grants[config.GrantClusterDropMonitor] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/actions/dropserver") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterSwitchover] {
+	if grants[config.GrantClusterSwitchover] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/actions/switchover") {
 			return true
 		}
+		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/switchover-drain") {
+			return true
+		}
 	}
 
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterTraffic] {
+	if grants[config.GrantClusterTraffic] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/actions/stop-traffic") {
 			return true
 
@@ -688,7 +792,7 @@ func (cluster *Cluster) IsURLPassACL(strUser string, URL string, errorPrint bool
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantDBBackup] {
+	if grants[config.GrantDBBackup] {
 		if strings.Contains(URL, "/actions/master-logical-backup") {
 			return true
 		}
@@ -696,12 +800,12 @@ func (cluster *Cluster) IsURLPassACL(strUser string, URL string, errorPrint bool
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterBench] {
+	if grants[config.GrantClusterBench] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/actions/sysbench") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterTest] {
+	if grants[config.GrantClusterTest] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/actions/sysbench") {
 			return true
 		}
@@ -710,12 +814,12 @@ func (cluster *Cluster) IsURLPassACL(strUser string, URL string, errorPrint bool
 		}
 
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterFailover] {
+	if grants[config.GrantClusterFailover] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/actions/failover") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterReplication] {
+	if grants[config.GrantClusterReplication] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/actions/replication/bootstrap") {
 			return true
 		}
@@ -723,8 +827,26 @@ func (cluster *Cluster) IsURLPassACL(strUser string, URL string, errorPrint bool
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/actions/replication/cleanup") {
 			return true
 		}
+		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/staging") {
+			return true
+		}
+		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/delayed-replicas") {
+			return true
+		}
+		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/errant-transactions") {
+			return true
+		}
+		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/wsrep") {
+			return true
+		}
+		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/group-replication") {
+			return true
+		}
+		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/replication-playbooks") {
+			return true
+		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterRolling] {
+	if grants[config.GrantClusterRolling] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/actions/optimize") {
 			return true
 		}
@@ -737,13 +859,21 @@ func (cluster *Cluster) IsURLPassACL(strUser string, URL string, errorPrint bool
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/actions/cancel-rolling-reprov") {
 			return true
 		}
+		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/upgrade") {
+			return true
+		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterRotatePasswords] {
+	if grants[config.GrantClusterRotatePasswords] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/actions/rotate-passwords") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantDBConfigFlag] {
+	if grants[config.GrantClusterApprove] {
+		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/approvals") {
+			return true
+		}
+	}
+	if grants[config.GrantDBConfigFlag] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/settings/actions/drop-db-tag") {
 			return true
 		}
@@ -755,7 +885,7 @@ func (cluster *Cluster) IsURLPassACL(strUser string, URL string, errorPrint bool
 		}
 
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantProxyConfigFlag] {
+	if grants[config.GrantProxyConfigFlag] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/settings/actions/drop-proxy-tag") {
 			return true
 		}
@@ -763,7 +893,7 @@ func (cluster *Cluster) IsURLPassACL(strUser string, URL string, errorPrint bool
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterSettings] {
+	if grants[config.GrantClusterSettings] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/settings/actions/reload") {
 			return true
 		}
@@ -783,13 +913,16 @@ func (cluster *Cluster) IsURLPassACL(strUser string, URL string, errorPrint bool
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterChecksum] {
+	if grants[config.GrantClusterChecksum] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/actions/checksum-all-tables") {
 			return true
 		}
+		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/consistency") {
+			return true
+		}
 	}
 
-	if cluster.APIUsers[strUser].Grants[config.GrantProvCluster] {
+	if grants[config.GrantProvCluster] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/services/actions/provision") {
 			return true
 		}
@@ -797,22 +930,22 @@ func (cluster *Cluster) IsURLPassACL(strUser string, URL string, errorPrint bool
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantProvClusterUnprovision] {
+	if grants[config.GrantProvClusterUnprovision] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/services/actions/unprovision") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterCreate] {
+	if grants[config.GrantClusterCreate] {
 		if strings.Contains(URL, "/api/clusters/actions/add") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterDelete] {
+	if grants[config.GrantClusterDelete] {
 		if strings.Contains(URL, "/api/clusters/actions/delete") {
 			return true
 		}
 	}
-	if cluster.APIUsers[strUser].Grants[config.GrantClusterConfigGraphs] {
+	if grants[config.GrantClusterConfigGraphs] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/settings/actions/set-graphite-filterlist") {
 			return true
 		}
@@ -824,13 +957,13 @@ func (cluster *Cluster) IsURLPassACL(strUser string, URL string, errorPrint bool
 		}
 	}
 
-	if cluster.APIUsers[strUser].Grants[config.GrantGrantShow] {
+	if grants[config.GrantGrantShow] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/users/send-credentials") {
 			return true
 		}
 	}
 
-	if cluster.APIUsers[strUser].Grants[config.GrantGrantAdd] {
+	if grants[config.GrantGrantAdd] {
 		if strings.Contains(URL, "/api/monitor/actions/adduser/") {
 			return true
 		}
@@ -839,25 +972,44 @@ func (cluster *Cluster) IsURLPassACL(strUser string, URL string, errorPrint bool
 		}
 	}
 
-	if cluster.APIUsers[strUser].Grants[config.GrantGrantModify] {
+	if grants[config.GrantGrantModify] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/users/update") {
 			return true
 		}
 	}
 
-	if cluster.APIUsers[strUser].Grants[config.GrantGrantDrop] {
+	if grants[config.GrantGrantDrop] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/users/drop") {
 			return true
 		}
 	}
 
-	if cluster.APIUsers[strUser].Grants[config.GrantSalesValidate] {
+	if grants[config.GrantClusterSettings] {
+		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/db-users") {
+			return true
+		}
+		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/security-audit") {
+			return true
+		}
+	}
+
+	if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/rbac") {
+		switch {
+		case strings.Contains(URL, "/actions/drop"):
+			return grants[config.GrantGrantDrop]
+		case strings.Contains(URL, "/actions/"), strings.HasSuffix(URL, "/rbac/roles"):
+			return grants[config.GrantGrantModify]
+		}
+		return grants[config.GrantGrantShow]
+	}
+
+	if grants[config.GrantSalesValidate] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/sales/accept-subscription") {
 			return true
 		}
 	}
 
-	if cluster.APIUsers[strUser].Grants[config.GrantSalesRefuse] {
+	if grants[config.GrantSalesRefuse] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/sales/refuse-subscription") {
 			return true
 		}
@@ -867,7 +1019,7 @@ func (cluster *Cluster) IsURLPassACL(strUser string, URL string, errorPrint bool
 		}
 	}
 
-	if cluster.APIUsers[strUser].Grants[config.GrantSalesUnsubscribe] {
+	if grants[config.GrantSalesUnsubscribe] {
 		if strings.Contains(URL, "/api/clusters/"+cluster.Name+"/sales/end-subscription") {
 			return true
 		}
@@ -0,0 +1,250 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/signal18/replication-manager/cert"
+	"github.com/signal18/replication-manager/config"
+	"github.com/signal18/replication-manager/utils/state"
+)
+
+// CertificateExpiry is the expiry of a certificate used by the cluster
+type CertificateExpiry struct {
+	Name     string    `json:"name"`
+	Kind     string    `json:"kind"`
+	Source   string    `json:"source"`
+	Subject  string    `json:"subject"`
+	NotAfter time.Time `json:"notAfter"`
+	DaysLeft int       `json:"daysLeft"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// certificateFiles returns the cluster CA, server and client certificates, the configured
+// ones or the ones generated by replication-manager
+func (cluster *Cluster) certificateFiles() map[string]string {
+	files := make(map[string]string)
+	if cluster.Conf.HostsTLSCA != "" {
+		files["ca"] = cluster.Conf.HostsTLSCA
+	}
+	if cluster.Conf.HostsTlsSrvCert != "" {
+		files["server"] = cluster.Conf.HostsTlsSrvCert
+	}
+	if cluster.Conf.HostsTlsCliCert != "" {
+		files["client"] = cluster.Conf.HostsTlsCliCert
+	}
+	for _, name := range []string{"ca", "server", "client"} {
+		if _, ok := files[name]; ok {
+			continue
+		}
+		path := cluster.Conf.WorkingDir + "/" + cluster.Name + "/" + name + "-cert.pem"
+		if _, err := os.Stat(path); err == nil {
+			files[name] = path
+		}
+	}
+	return files
+}
+
+// IsUsingGeneratedCertificates tells whether the cluster certificates are the ones generated by
+// replication-manager, the only ones it can renew. Any certificate file set by configuration,
+// even partially, leaves the certificates to the operator.
+func (cluster *Cluster) IsUsingGeneratedCertificates() bool {
+	return cluster.Conf.HostsTLSCA == "" && cluster.Conf.HostsTlsCliCert == "" && cluster.Conf.HostsTlsCliKey == ""
+}
+
+// SetAPICertificateExpiry records the expiry of the API HTTPS certificate, it is pushed by the server
+func (cluster *Cluster) SetAPICertificateExpiry(notAfter time.Time) {
+	cluster.certMutex.Lock()
+	defer cluster.certMutex.Unlock()
+	cluster.apiCertNotAfter = notAfter
+}
+
+// GetCertificatesExpiry returns the result of the last certificates expiry check
+func (cluster *Cluster) GetCertificatesExpiry() []CertificateExpiry {
+	cluster.certMutex.Lock()
+	defer cluster.certMutex.Unlock()
+	return append([]CertificateExpiry{}, cluster.certExpiries...)
+}
+
+// ListCertificatesExpiry reads the expiry of the cluster certificate files, of the certificates
+// served by the databases, of the proxy certificates and of the API certificate
+func (cluster *Cluster) ListCertificatesExpiry() []CertificateExpiry {
+	now := time.Now()
+	var list []CertificateExpiry
+	files := cluster.certificateFiles()
+	for _, name := range []string{"ca", "server", "client"} {
+		path, ok := files[name]
+		if !ok {
+			continue
+		}
+		list = append(list, readCertificateExpiry(name, "cluster", path, now))
+	}
+	for _, server := range cluster.Servers {
+		if server == nil || server.IsFailed() {
+			continue
+		}
+		value := server.Status.Get("SSL_SERVER_NOT_AFTER")
+		if value == "" {
+			continue
+		}
+		exp := CertificateExpiry{Name: server.URL, Kind: "database", Source: "Ssl_server_not_after"}
+		notAfter, err := cert.ParseStatusTime(value)
+		if err != nil {
+			exp.Error = err.Error()
+		} else {
+			exp.NotAfter = notAfter
+			exp.DaysLeft = cert.DaysLeft(notAfter, now)
+		}
+		list = append(list, exp)
+	}
+	for _, pr := range cluster.Proxies {
+		if pr == nil || pr.GetDatadir() == "" {
+			continue
+		}
+		paths, _ := filepath.Glob(pr.GetDatadir() + "/init/etc/*/ssl/server-cert.pem")
+		for _, path := range paths {
+			list = append(list, readCertificateExpiry(pr.GetName(), "proxy", path, now))
+		}
+	}
+	cluster.certMutex.Lock()
+	apiNotAfter := cluster.apiCertNotAfter
+	cluster.certMutex.Unlock()
+	if !apiNotAfter.IsZero() {
+		list = append(list, CertificateExpiry{Name: "api", Kind: "api", Source: "https", NotAfter: apiNotAfter, DaysLeft: cert.DaysLeft(apiNotAfter, now)})
+	}
+	return list
+}
+
+func readCertificateExpiry(name string, kind string, path string, now time.Time) CertificateExpiry {
+	exp := CertificateExpiry{Name: name, Kind: kind, Source: path}
+	c, err := cert.ReadCertificateFile(path)
+	if err != nil {
+		exp.Error = err.Error()
+		return exp
+	}
+	exp.Subject = c.Subject.CommonName
+	exp.NotAfter = c.NotAfter
+	exp.DaysLeft = cert.DaysLeft(c.NotAfter, now)
+	return exp
+}
+
+// CheckCertificatesExpiry raises a warning per certificate expiring within cert-expiry-warn-days
+// and renews the generated certificates when cert-auto-renew is set
+func (cluster *Cluster) CheckCertificatesExpiry() {
+	list := cluster.ListCertificatesExpiry()
+	renew := false
+	for _, exp := range list {
+		if exp.Error != "" || exp.NotAfter.IsZero() {
+			continue
+		}
+		if exp.DaysLeft < 0 {
+			cluster.SetState("WARN0136", state.State{ErrType: "WARNING", ErrDesc: fmt.Sprintf(clusterError["WARN0136"], exp.Kind, exp.Name, exp.NotAfter.Format(time.RFC3339)), ErrFrom: "TOPO", ServerUrl: exp.Name})
+		} else if exp.DaysLeft < cluster.Conf.CertExpiryWarnDays {
+			cluster.SetState("WARN0135", state.State{ErrType: "WARNING", ErrDesc: fmt.Sprintf(clusterError["WARN0135"], exp.Kind, exp.Name, exp.DaysLeft), ErrFrom: "TOPO", ServerUrl: exp.Name})
+		}
+		if exp.Kind == "cluster" && exp.DaysLeft < cluster.Conf.CertAutoRenewDays {
+			renew = true
+		}
+	}
+	cluster.certMutex.Lock()
+	cluster.certExpiries = list
+	cluster.certMutex.Unlock()
+
+	if renew && cluster.Conf.CertAutoRenew && cluster.IsUsingGeneratedCertificates() {
+		go cluster.RenewCertificates()
+	}
+}
+
+// RenewCertificates rotates the generated certificates, regenerates the database and proxy
+// configurations embedding them and reloads them one server at a time
+func (cluster *Cluster) RenewCertificates() error {
+	cluster.certMutex.Lock()
+	if cluster.inCertRenew {
+		cluster.certMutex.Unlock()
+		return errors.New("Certificates renewal already in progress")
+	}
+	cluster.inCertRenew = true
+	cluster.certMutex.Unlock()
+	defer func() {
+		cluster.certMutex.Lock()
+		cluster.inCertRenew = false
+		cluster.certMutex.Unlock()
+	}()
+
+	if !cluster.IsUsingGeneratedCertificates() {
+		return errors.New("Certificates are provided by configuration and can not be renewed")
+	}
+	cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Renewing cluster certificates")
+	cluster.KeyRotation()
+	for _, server := range cluster.Servers {
+		server.GetDatabaseConfig()
+	}
+	for _, pr := range cluster.Proxies {
+		pr.GetProxyConfig()
+	}
+	return cluster.RollingReloadCertificates()
+}
+
+// RollingReloadCertificates reloads the certificates on the slaves, then the master, then the
+// proxies, checking that each database accepts new connections before moving to the next one
+func (cluster *Cluster) RollingReloadCertificates() error {
+	wait := time.Duration(cluster.Conf.CertRollingReloadWait) * time.Second
+	master := cluster.GetMaster()
+	var servers []*ServerMonitor
+	for _, server := range cluster.Servers {
+		if server != nil && server != master && !server.IsDown() {
+			servers = append(servers, server)
+		}
+	}
+	if master != nil && !master.IsDown() {
+		servers = append(servers, master)
+	}
+	for _, server := range servers {
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Rolling certificates reload on %s", server.URL)
+		if err := server.CertificatesReload(); err != nil {
+			cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlErr, "Rolling certificates reload stopped on %s: %s", server.URL, err)
+			return err
+		}
+		time.Sleep(wait)
+		if err := cluster.checkCertificatesReload(server); err != nil {
+			cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlErr, "Rolling certificates reload stopped, %s refuses new connections: %s", server.URL, err)
+			return err
+		}
+	}
+	for _, pr := range cluster.Proxies {
+		if pr == nil || pr.IsDown() {
+			continue
+		}
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Rolling certificates reload on proxy %s", pr.GetName())
+		if err := pr.CertificatesReload(); err != nil {
+			cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlErr, "Rolling certificates reload stopped on proxy %s: %s", pr.GetName(), err)
+			return err
+		}
+		time.Sleep(wait)
+	}
+	cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Rolling certificates reload done")
+	return nil
+}
+
+// checkCertificatesReload opens a new connection to make sure the reloaded server still accepts
+// TLS clients with the new certificates
+func (cluster *Cluster) checkCertificatesReload(server *ServerMonitor) error {
+	conn, err := server.GetNewDBConn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Ping()
+}
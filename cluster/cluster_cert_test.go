@@ -0,0 +1,28 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import "testing"
+
+func TestIsUsingGeneratedCertificates(t *testing.T) {
+	cluster := &Cluster{}
+	if !cluster.IsUsingGeneratedCertificates() {
+		t.Error("Expected generated certificates without configured files")
+	}
+	cluster.Conf.HostsTlsCliCert = "/etc/ssl/client-cert.pem"
+	if cluster.IsUsingGeneratedCertificates() {
+		t.Error("A partially configured certificate should not be renewed")
+	}
+	cluster.Conf.HostsTLSCA = "/etc/ssl/ca.pem"
+	cluster.Conf.HostsTlsCliKey = "/etc/ssl/client-key.pem"
+	if cluster.IsUsingGeneratedCertificates() {
+		t.Error("Configured certificates should not be renewed")
+	}
+}
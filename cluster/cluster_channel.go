@@ -0,0 +1,342 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/signal18/replication-manager/config"
+	"github.com/signal18/replication-manager/utils/dbhelper"
+)
+
+var (
+	ErrChannelName          = errors.New("Invalid replication channel name")
+	ErrChannelDefault       = errors.New("The default replication channel is managed by the cluster topology")
+	ErrChannelNotFound      = errors.New("Replication channel not found")
+	ErrChannelExists        = errors.New("Replication channel already exists")
+	ErrChannelSameCluster   = errors.New("A replication channel must point to another cluster")
+	ErrChannelNoMaster      = errors.New("Source cluster has no master")
+	ErrChannelNoConnection  = errors.New("No database connection")
+	ErrChannelNoGtidPointer = errors.New("Replication channel does not use GTID and can't be re-pointed")
+
+	channelNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+)
+
+// ReplicationChannel is a named replication connection of a server, the default
+// channel is the one of the cluster topology
+type ReplicationChannel struct {
+	Name             string `json:"name"`
+	IsDefault        bool   `json:"isDefault"`
+	SourceCluster    string `json:"sourceCluster"`
+	MasterHost       string `json:"masterHost"`
+	MasterPort       string `json:"masterPort"`
+	IORunning        string `json:"ioRunning"`
+	SQLRunning       string `json:"sqlRunning"`
+	Delay            int64  `json:"delay"`
+	UsingGtid        string `json:"usingGtid"`
+	GtidIOPos        string `json:"gtidIoPos"`
+	GtidSlavePos     string `json:"gtidSlavePos"`
+	RetrievedGtidSet string `json:"retrievedGtidSet"`
+	ExecutedGtidSet  string `json:"executedGtidSet"`
+	MasterLogFile    string `json:"masterLogFile"`
+	ExecMasterLogPos string `json:"execMasterLogPos"`
+	LastIOErrno      string `json:"lastIoErrno"`
+	LastIOError      string `json:"lastIoError"`
+	LastSQLErrno     string `json:"lastSqlErrno"`
+	LastSQLError     string `json:"lastSqlError"`
+}
+
+func (server *ServerMonitor) GetReplicationChannels() []ReplicationChannel {
+	cluster := server.ClusterGroup
+	channels := []ReplicationChannel{}
+	for _, rep := range server.Replications {
+		ch := ReplicationChannel{
+			Name:             rep.ConnectionName.String,
+			IsDefault:        rep.ConnectionName.String == cluster.Conf.MasterConn,
+			MasterHost:       rep.MasterHost.String,
+			MasterPort:       rep.MasterPort.String,
+			IORunning:        rep.SlaveIORunning.String,
+			SQLRunning:       rep.SlaveSQLRunning.String,
+			Delay:            -1,
+			UsingGtid:        rep.UsingGtid.String,
+			GtidIOPos:        rep.GtidIOPos.String,
+			GtidSlavePos:     rep.GtidSlavePos.String,
+			RetrievedGtidSet: rep.RetrievedGtidSet.String,
+			ExecutedGtidSet:  rep.ExecutedGtidSet.String,
+			MasterLogFile:    rep.MasterLogFile.String,
+			ExecMasterLogPos: rep.ExecMasterLogPos.String,
+			LastIOErrno:      rep.LastIOErrno.String,
+			LastIOError:      rep.LastIOError.String,
+			LastSQLErrno:     rep.LastSQLErrno.String,
+			LastSQLError:     rep.LastSQLError.String,
+		}
+		if rep.SecondsBehindMaster.Valid {
+			ch.Delay = rep.SecondsBehindMaster.Int64
+		}
+		if parent := cluster.GetParentClusterFromReplicationSource(rep); parent != nil {
+			ch.SourceCluster = parent.Name
+		}
+		channels = append(channels, ch)
+	}
+	return channels
+}
+
+// getReplicationChannel returns the status of a named channel, the default channel is refused
+func (server *ServerMonitor) getReplicationChannel(name string) (*dbhelper.SlaveStatus, error) {
+	if !channelNameRegexp.MatchString(name) {
+		return nil, ErrChannelName
+	}
+	if name == server.ClusterGroup.Conf.MasterConn {
+		return nil, ErrChannelDefault
+	}
+	if server.Conn == nil {
+		return nil, ErrChannelNoConnection
+	}
+	rep, err := server.GetSlaveStatus(name)
+	if err != nil || rep == nil {
+		return nil, ErrChannelNotFound
+	}
+	return rep, nil
+}
+
+// getChannelMode picks GTID replication when the server and the source master use it
+func (server *ServerMonitor) getChannelMode(master *ServerMonitor) string {
+	if server.DBVersion.IsMariaDB() {
+		return "SLAVE_POS"
+	}
+	if server.HasMySQLGTID() && master.HasMySQLGTID() {
+		return "MASTER_AUTO_POSITION"
+	}
+	return "POSITIONAL"
+}
+
+// AddReplicationChannel creates a named channel replicating from the master of another
+// cluster and starts it
+func (server *ServerMonitor) AddReplicationChannel(name string, sourceClusterName string) error {
+	cluster := server.ClusterGroup
+	if !channelNameRegexp.MatchString(name) {
+		return ErrChannelName
+	}
+	if name == cluster.Conf.MasterConn {
+		return ErrChannelDefault
+	}
+	if server.Conn == nil {
+		return ErrChannelNoConnection
+	}
+	if rep, _ := server.GetSlaveStatus(name); rep != nil {
+		return ErrChannelExists
+	}
+	if sourceClusterName == cluster.Name {
+		return ErrChannelSameCluster
+	}
+	source, err := cluster.GetClusterFromName(sourceClusterName)
+	if err != nil {
+		return err
+	}
+	master := source.GetMaster()
+	if master == nil || master.IsDown() {
+		return ErrChannelNoMaster
+	}
+	opt := dbhelper.ChangeMasterOpt{
+		Host:      master.Host,
+		Port:      master.Port,
+		User:      source.GetRplUser(),
+		Password:  source.GetRplPass(),
+		Retry:     strconv.Itoa(cluster.Conf.ForceSlaveHeartbeatRetry),
+		Heartbeat: strconv.Itoa(cluster.Conf.ForceSlaveHeartbeatTime),
+		Mode:      server.getChannelMode(master),
+		Logfile:   master.BinaryLogFile,
+		Logpos:    master.BinaryLogPos,
+		SSL:       cluster.Conf.ReplicationSSL,
+		Channel:   name,
+		Delay:     "0",
+	}
+	logs, err := dbhelper.ChangeMaster(server.Conn, opt, server.DBVersion)
+	cluster.LogSQL(logs, err, server.URL, "Channel", config.LvlErr, "Could not add replication channel %s on %s: %s", name, server.URL, err)
+	if err != nil {
+		return err
+	}
+	logs, err = dbhelper.StartSlave(server.Conn, name, server.DBVersion)
+	cluster.LogSQL(logs, err, server.URL, "Channel", config.LvlErr, "Could not start replication channel %s on %s: %s", name, server.URL, err)
+	if err != nil {
+		return err
+	}
+	cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModTopology, config.LvlInfo, "Replication channel %s added on %s from cluster %s master %s", name, server.URL, source.Name, master.URL)
+	return nil
+}
+
+func (server *ServerMonitor) RemoveReplicationChannel(name string) error {
+	cluster := server.ClusterGroup
+	if _, err := server.getReplicationChannel(name); err != nil {
+		return err
+	}
+	logs, err := dbhelper.StopSlave(server.Conn, name, server.DBVersion)
+	cluster.LogSQL(logs, err, server.URL, "Channel", config.LvlErr, "Could not stop replication channel %s on %s: %s", name, server.URL, err)
+	if err != nil {
+		return err
+	}
+	logs, err = dbhelper.ResetSlave(server.Conn, true, name, server.DBVersion)
+	cluster.LogSQL(logs, err, server.URL, "Channel", config.LvlErr, "Could not remove replication channel %s on %s: %s", name, server.URL, err)
+	if err != nil {
+		return err
+	}
+	cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModTopology, config.LvlInfo, "Replication channel %s removed on %s", name, server.URL)
+	return nil
+}
+
+func (server *ServerMonitor) StopReplicationChannel(name string) error {
+	cluster := server.ClusterGroup
+	if _, err := server.getReplicationChannel(name); err != nil {
+		return err
+	}
+	logs, err := dbhelper.StopSlave(server.Conn, name, server.DBVersion)
+	cluster.LogSQL(logs, err, server.URL, "Channel", config.LvlErr, "Could not stop replication channel %s on %s: %s", name, server.URL, err)
+	return err
+}
+
+func (server *ServerMonitor) StartReplicationChannel(name string) error {
+	cluster := server.ClusterGroup
+	if _, err := server.getReplicationChannel(name); err != nil {
+		return err
+	}
+	logs, err := dbhelper.StartSlave(server.Conn, name, server.DBVersion)
+	cluster.LogSQL(logs, err, server.URL, "Channel", config.LvlErr, "Could not start replication channel %s on %s: %s", name, server.URL, err)
+	return err
+}
+
+// SkipReplicationChannelEvent skips the next event of a channel, MySQL channels with
+// GTID auto positioning refuse sql_slave_skip_counter
+func (server *ServerMonitor) SkipReplicationChannelEvent(name string) error {
+	cluster := server.ClusterGroup
+	if _, err := server.getReplicationChannel(name); err != nil {
+		return err
+	}
+	logs, err := dbhelper.StopSlave(server.Conn, name, server.DBVersion)
+	cluster.LogSQL(logs, err, server.URL, "Channel", config.LvlErr, "Could not stop replication channel %s on %s: %s", name, server.URL, err)
+	if err != nil {
+		return err
+	}
+	logs, err = dbhelper.SkipBinlogEvent(server.Conn, name, server.DBVersion)
+	cluster.LogSQL(logs, err, server.URL, "Channel", config.LvlErr, "Could not skip event on replication channel %s on %s: %s", name, server.URL, err)
+	if err != nil {
+		return err
+	}
+	logs, err = dbhelper.StartSlave(server.Conn, name, server.DBVersion)
+	cluster.LogSQL(logs, err, server.URL, "Channel", config.LvlErr, "Could not start replication channel %s on %s: %s", name, server.URL, err)
+	return err
+}
+
+// FailoverReplicationChannels re-points the named channels of the other clusters replicating
+// from the old master to the new master, only GTID channels can be moved safely
+func (cluster *Cluster) FailoverReplicationChannels(oldMaster *ServerMonitor, newMaster *ServerMonitor) {
+	if !cluster.Conf.ReplicationMultisourceChannelRepoint || oldMaster == nil || newMaster == nil || oldMaster.URL == newMaster.URL {
+		return
+	}
+	cluster.Lock()
+	clusters := make([]*Cluster, 0, len(cluster.clusterList))
+	for _, c := range cluster.clusterList {
+		if c.Name != cluster.Name {
+			clusters = append(clusters, c)
+		}
+	}
+	cluster.Unlock()
+	for _, c := range clusters {
+		for _, ch := range c.getReplicationChannelsFrom(oldMaster.Host, oldMaster.Port) {
+			if err := ch.server.repointReplicationChannel(ch.rep, newMaster); err != nil {
+				cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModTopology, config.LvlErr, "Could not re-point replication channel %s of %s to %s: %s", ch.rep.ConnectionName.String, ch.server.URL, newMaster.URL, err)
+			} else {
+				cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModTopology, config.LvlInfo, "Replication channel %s of %s re-pointed to %s", ch.rep.ConnectionName.String, ch.server.URL, newMaster.URL)
+			}
+		}
+	}
+}
+
+type replicationChannelSource struct {
+	server *ServerMonitor
+	rep    dbhelper.SlaveStatus
+}
+
+// getReplicationChannelsFrom returns the named channels of the cluster servers replicating from a host,
+// the servers and their replication status are copied under the cluster lock
+func (cluster *Cluster) getReplicationChannelsFrom(host string, port string) []replicationChannelSource {
+	cluster.Lock()
+	defer cluster.Unlock()
+	channels := make([]replicationChannelSource, 0)
+	for _, server := range cluster.Servers {
+		if server == nil || server.Conn == nil || server.IsDown() {
+			continue
+		}
+		for _, rep := range server.Replications {
+			if rep.ConnectionName.String == cluster.Conf.MasterConn || rep.MasterHost.String != host || rep.MasterPort.String != port {
+				continue
+			}
+			channels = append(channels, replicationChannelSource{server: server, rep: rep})
+		}
+	}
+	return channels
+}
+
+// getRepointChannelOpt keeps the GTID mode, the heartbeat and the filters of the channel,
+// the credentials are the replication credentials of the cluster of the new master
+func (server *ServerMonitor) getRepointChannelOpt(rep dbhelper.SlaveStatus, newMaster *ServerMonitor) (dbhelper.ChangeMasterOpt, error) {
+	mode := ""
+	switch strings.ToUpper(rep.UsingGtid.String) {
+	case "SLAVE_POS":
+		mode = "SLAVE_POS"
+	case "CURRENT_POS":
+		mode = "CURRENT_POS"
+	case "", "NO":
+		if server.DBVersion.IsMySQLOrPercona() && rep.AutoPosition.String == "1" {
+			mode = "MASTER_AUTO_POSITION"
+		}
+	}
+	if mode == "" {
+		return dbhelper.ChangeMasterOpt{}, ErrChannelNoGtidPointer
+	}
+	return dbhelper.ChangeMasterOpt{
+		Host:            newMaster.Host,
+		Port:            newMaster.Port,
+		User:            newMaster.ClusterGroup.GetRplUser(),
+		Password:        newMaster.ClusterGroup.GetRplPass(),
+		Retry:           strconv.Itoa(server.ClusterGroup.Conf.ForceSlaveHeartbeatRetry),
+		Heartbeat:       strconv.FormatFloat(rep.SlaveHeartbeatPeriod, 'f', -1, 64),
+		Mode:            mode,
+		SSL:             server.ClusterGroup.Conf.ReplicationSSL,
+		Channel:         rep.ConnectionName.String,
+		Delay:           "0",
+		DoDomainIds:     rep.DoDomainIds.String,
+		IgnoreDomainIds: rep.IgnoreDomainIds.String,
+		IgnoreServerIds: rep.IgnoreServerIds.String,
+	}, nil
+}
+
+func (server *ServerMonitor) repointReplicationChannel(rep dbhelper.SlaveStatus, newMaster *ServerMonitor) error {
+	opt, err := server.getRepointChannelOpt(rep, newMaster)
+	if err != nil {
+		return err
+	}
+	name := opt.Channel
+	logs, err := dbhelper.StopSlave(server.Conn, name, server.DBVersion)
+	server.ClusterGroup.LogSQL(logs, err, server.URL, "Channel", config.LvlErr, "Could not stop replication channel %s on %s: %s", name, server.URL, err)
+	if err != nil {
+		return err
+	}
+	logs, err = dbhelper.ChangeMaster(server.Conn, opt, server.DBVersion)
+	server.ClusterGroup.LogSQL(logs, err, server.URL, "Channel", config.LvlErr, "Could not re-point replication channel %s on %s: %s", name, server.URL, err)
+	if err != nil {
+		return err
+	}
+	logs, err = dbhelper.StartSlave(server.Conn, name, server.DBVersion)
+	server.ClusterGroup.LogSQL(logs, err, server.URL, "Channel", config.LvlErr, "Could not start replication channel %s on %s: %s", name, server.URL, err)
+	return err
+}
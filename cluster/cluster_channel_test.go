@@ -0,0 +1,121 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/signal18/replication-manager/config"
+	"github.com/signal18/replication-manager/utils/dbhelper"
+	"github.com/signal18/replication-manager/utils/version"
+)
+
+func newChannelTestServers(flavor string) (*ServerMonitor, *ServerMonitor) {
+	source := &Cluster{Name: "c2"}
+	source.Conf.Secrets = map[string]config.Secret{"replication-credential": {Value: "repl:secret"}}
+	target := &Cluster{Name: "c1"}
+	newMaster := &ServerMonitor{URL: "db9:3306", Host: "db9", Port: "3306", ClusterGroup: source}
+	server := &ServerMonitor{URL: "db1:3306", Host: "db1", Port: "3306", ClusterGroup: target}
+	server.DBVersion, _ = version.NewVersion(flavor, 10, 11, 6)
+	if flavor == "MySQL" {
+		server.DBVersion, _ = version.NewVersion(flavor, 8, 0, 36)
+	}
+	return server, newMaster
+}
+
+func TestRepointChannelOpt(t *testing.T) {
+	server, newMaster := newChannelTestServers("MariaDB")
+	rep := dbhelper.SlaveStatus{
+		ConnectionName:       sql.NullString{String: "c2", Valid: true},
+		MasterUser:           sql.NullString{String: "olduser", Valid: true},
+		UsingGtid:            sql.NullString{String: "Current_Pos", Valid: true},
+		SlaveHeartbeatPeriod: 0.5,
+	}
+	opt, err := server.getRepointChannelOpt(rep, newMaster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opt.Mode != "CURRENT_POS" {
+		t.Errorf("Expected Current_Pos channel to be kept, got %s", opt.Mode)
+	}
+	if opt.Heartbeat != "0.5" {
+		t.Errorf("Expected heartbeat 0.5, got %s", opt.Heartbeat)
+	}
+	if opt.Host != "db9" || opt.Channel != "c2" || opt.User != "repl" || opt.Password != "secret" {
+		t.Errorf("Unexpected change master options %+v", opt)
+	}
+	rep.UsingGtid.String = "Slave_Pos"
+	rep.SlaveHeartbeatPeriod = 30
+	opt, _ = server.getRepointChannelOpt(rep, newMaster)
+	if opt.Mode != "SLAVE_POS" || opt.Heartbeat != "30" {
+		t.Errorf("Expected Slave_Pos with heartbeat 30, got %s %s", opt.Mode, opt.Heartbeat)
+	}
+	rep.UsingGtid.String = "No"
+	if _, err := server.getRepointChannelOpt(rep, newMaster); err != ErrChannelNoGtidPointer {
+		t.Errorf("Expected positional MariaDB channel to be refused, got %v", err)
+	}
+}
+
+func TestRepointChannelOptMySQL(t *testing.T) {
+	server, newMaster := newChannelTestServers("MySQL")
+	rep := dbhelper.SlaveStatus{
+		ConnectionName:   sql.NullString{String: "c2", Valid: true},
+		AutoPosition:     sql.NullString{String: "1", Valid: true},
+		RetrievedGtidSet: sql.NullString{String: "", Valid: true},
+		ExecutedGtidSet:  sql.NullString{String: "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5", Valid: true},
+	}
+	opt, err := server.getRepointChannelOpt(rep, newMaster)
+	if err != nil || opt.Mode != "MASTER_AUTO_POSITION" {
+		t.Errorf("Expected auto position, got %s %v", opt.Mode, err)
+	}
+	// a GTID executed set does not tell the channel uses master_auto_position
+	rep.AutoPosition.String = "0"
+	if _, err := server.getRepointChannelOpt(rep, newMaster); err != ErrChannelNoGtidPointer {
+		t.Errorf("Expected positional MySQL channel to be refused, got %v", err)
+	}
+}
+
+func TestReplicationChannelsFrom(t *testing.T) {
+	c := &Cluster{Name: "c2"}
+	server := &ServerMonitor{URL: "db5:3306", Host: "db5", Port: "3306", ClusterGroup: c, State: stateSlave, Conn: &sqlx.DB{}}
+	server.Replications = []dbhelper.SlaveStatus{
+		{ConnectionName: sql.NullString{Valid: true}, MasterHost: sql.NullString{String: "db1", Valid: true}, MasterPort: sql.NullString{String: "3306", Valid: true}},
+		{ConnectionName: sql.NullString{String: "c1", Valid: true}, MasterHost: sql.NullString{String: "db1", Valid: true}, MasterPort: sql.NullString{String: "3306", Valid: true}},
+		{ConnectionName: sql.NullString{String: "c3", Valid: true}, MasterHost: sql.NullString{String: "db7", Valid: true}, MasterPort: sql.NullString{String: "3306", Valid: true}},
+	}
+	c.Servers = []*ServerMonitor{server, nil}
+	channels := c.getReplicationChannelsFrom("db1", "3306")
+	if len(channels) != 1 || channels[0].server != server || channels[0].rep.ConnectionName.String != "c1" {
+		t.Errorf("Expected only the named channel c1 replicating from db1, got %v", channels)
+	}
+}
+
+func TestChannelsACL(t *testing.T) {
+	cluster := &Cluster{Name: "c1"}
+	cluster.APIUsers = map[string]APIUser{
+		"repl": {User: "repl", Grants: map[string]bool{config.GrantDBReplication: true}},
+	}
+	for url, want := range map[string]bool{
+		"/api/clusters/c1/servers/db1/channels":                            true,
+		"/api/clusters/c1/servers/db1/channels/actions/add/c2/c2":          true,
+		"/api/clusters/c1/servers/db1/channels/c2/actions/stop":            true,
+		"/api/clusters/c1/servers/db1/actions/channels":                    false,
+		"/api/clusters/c1/servers/db1/actions/start/channels":              false,
+		"/api/clusters/c2/servers/db1/channels":                            false,
+		"/api/clusters/c1/servers/db1/actions/set-prefered?x=/channels":    false,
+		"/api/clusters/c1/servers/channels/actions/add-server-from-backup": false,
+	} {
+		if got := cluster.IsURLPassACL("repl", url, false); got != want {
+			t.Errorf("ACL on %s: got %t, want %t", url, got, want)
+		}
+	}
+}
@@ -33,7 +33,6 @@ func (cluster *Cluster) CheckFailed() {
 	if cluster.master == nil {
 		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlDbg, "Master not discovered, skipping failover check")
 	}
-
 	if cluster.isFoundCandidateMaster() &&
 		cluster.isBetweenFailoverTimeValid() &&
 		cluster.IsNotHavingMySQLErrantTransaction() &&
@@ -44,13 +43,15 @@ func (cluster *Cluster) CheckFailed() {
 		cluster.isAutomaticFailover() &&
 		cluster.isMasterFailed() &&
 		cluster.isNotFirstSlave() &&
-		cluster.isArbitratorAlive() {
+		cluster.isArbitratorAlive() &&
+		cluster.isSiteQuorum() {
 
 		// False Positive
 		if cluster.isExternalOk() == false {
 			if cluster.isOneSlaveHeartbeatIncreasing() == false {
 				if cluster.isMaxscaleSupectRunning() == false {
-					cluster.MasterFailover(true)
+					// Site policies restrict automatic elections
+					cluster.masterFailover(true, true)
 					cluster.failoverCond.Send <- true
 				}
 			}
@@ -288,7 +289,7 @@ func (cluster *Cluster) isFoundCandidateMaster() bool {
 	if cluster.Conf.MultiMasterGrouprep {
 		key = cluster.electSwitchoverGroupReplicationCandidate(cluster.slaves, true)
 	} else {
-		key = cluster.electFailoverCandidate(cluster.slaves, false)
+		key = cluster.electFailoverCandidate(cluster.slaves, false, true)
 	}
 	if key == -1 {
 		// No candidates found in slaves list
@@ -547,14 +548,17 @@ func (cluster *Cluster) CheckAllTableChecksum() {
 	}
 }
 
-func (cluster *Cluster) CheckTableChecksum(schema string, table string) {
+// CheckTableChecksum writes the chunk checksums of a table in replication_manager_schema.table_checksum
+// of the master and the replicas and compares them, an error means the results are not the ones of
+// this table
+func (cluster *Cluster) CheckTableChecksum(schema string, table string) error {
 
 	cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Checksum master table %s.%s %s", schema, table, cluster.master.URL)
 
 	Conn, err := cluster.master.GetNewDBConn()
 	if err != nil {
 		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlErr, "Error connection in exec query no log %s", err)
-		return
+		return err
 	}
 	defer Conn.Close()
 	Conn.SetConnMaxLifetime(3595 * time.Second)
@@ -564,7 +568,7 @@ func (cluster *Cluster) CheckTableChecksum(schema string, table string) {
 		t := cluster.master.DictTables.Get(schema + "." + table)
 		t.TableSync = "NA"
 		cluster.master.DictTables.Set(schema+"."+table, t)
-		return
+		return nil
 	}
 	if strings.Contains(pk, ",") {
 		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Checksum, composit primary key for table %s.%s", schema, table)
@@ -574,19 +578,23 @@ func (cluster *Cluster) CheckTableChecksum(schema string, table string) {
 	Conn.Exec("SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ")
 	Conn.Exec("SET SESSION group_concat_max_len = 1000000")
 
-	Conn.Exec("CREATE OR REPLACE TABLE replication_manager_schema.table_checksum(chunkId BIGINT,chunkMinKey VARCHAR(254),chunkMaxKey VARCHAR(254),chunkCheckSum BIGINT UNSIGNED ) ENGINE=MYISAM")
+	_, err = Conn.Exec("CREATE OR REPLACE TABLE replication_manager_schema.table_checksum(chunkId BIGINT,chunkMinKey VARCHAR(254),chunkMaxKey VARCHAR(254),chunkCheckSum BIGINT UNSIGNED ) ENGINE=MYISAM")
+	if err != nil {
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlErr, "ERROR: Could not reset checksum table %s", err)
+		return err
+	}
 	query := "CREATE TEMPORARY TABLE replication_manager_schema.table_chunk ENGINE=MYISAM SELECT FLOOR((@rows:=@rows+1/2000)) as chunkId, MIN(CONCAT_WS('/*;*/'," + pk + ")) as chunkMinKey, MAX(CONCAT_WS('/*;*/'," + pk + ")) as chunkMaxKey from " + schema + "." + table + " , (SELECT @rows:=0 FROM DUAL) A group by chunkId"
 	_, err = Conn.Exec(query)
 	Conn.Exec("SET SESSION binlog_format = 'STATEMENT'")
 	if err != nil {
 		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlErr, "ERROR: Could not process chunck %s %s", query, err)
-		return
+		return err
 	}
 	var md5Sum string
 	err = Conn.QueryRowx("SELECT CONCAT( \"SUM(CRC32(CONCAT(\" , GROUP_CONCAT( CONCAT( \"IFNULL(\" , COLUMN_NAME, \",'N')\")),\")))\") as fields FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA ='" + schema + "' AND TABLE_NAME='" + table + "'").Scan(&md5Sum)
 	if err != nil {
 		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlErr, "ERROR: Could not get SQL md5Sum", err)
-		return
+		return err
 	}
 
 	// build predicate iterating over each pk columns
@@ -612,20 +620,20 @@ func (cluster *Cluster) CheckTableChecksum(schema string, table string) {
 		_, err := Conn.Exec(query)
 		if err != nil {
 			cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlErr, "ERROR: Could not process chunck %s %s", query, err)
-			return
+			return err
 		}
 
 		_, err2 := Conn.Exec("DELETE FROM replication_manager_schema.table_chunk limit 1")
 		if err2 != nil {
 			cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlErr, "Checksum error deleting chunck %s", err)
-			return
+			return err2
 		}
 
 		var count int
 		err3 := Conn.QueryRowx("SELECT count(*) FROM replication_manager_schema.table_chunk").Scan(&count)
 		if err3 != nil {
 			cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlErr, "Checksum can't fetch rows remaining", err)
-			return
+			return err3
 		}
 		if count == 0 {
 			cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Finished checksum table %s.%s", schema, table)
@@ -682,6 +690,7 @@ func (cluster *Cluster) CheckTableChecksum(schema string, table string) {
 			cluster.master.DictTables.Set(schema+"."+table, t)
 		}
 	}
+	return nil
 }
 
 // CheckSameServerID Check against the servers that all server id are differents
@@ -754,16 +763,19 @@ func (cluster *Cluster) CheckCredentialRotation() {
 	}
 	cluster.inConnectVault = true
 	defer func() { cluster.inConnectVault = false }()
+	if cluster.Conf.IsVaultUsed() {
+		client, err := cluster.GetVaultConnection()
+		if err == nil {
+			if cluster.Conf.VaultMode == VaultDbEngine {
+				cluster.RenewVaultLeases(client)
+			}
+			cluster.CheckVaultSecretsRotation(client)
+		}
+	}
 	if cluster.HasReplicationCredentialsRotation() {
 		//cluster.LogModulePrintf(cluster.Conf.Verbose,config.ConstLogModGeneral,LvlInfo, "TEST checkReplicationCredentialsRotation")
 		cluster.SetClusterReplicationCredentialsFromConfig()
-		for _, slave := range cluster.slaves {
-			ss, err := slave.GetSlaveStatus(slave.ReplicationSourceName)
-			if err != nil {
-				cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlErr, "No replication channel %s on slave %s : %s", slave.ReplicationSourceName, slave.URL, err)
-			}
-			slave.SetReplicationCredentialsRotation(ss)
-		}
+		cluster.RotateReplicationCredentials()
 	}
 	if cluster.HasMonitoringCredentialsRotation() {
 		//cluster.LogModulePrintf(cluster.Conf.Verbose,config.ConstLogModGeneral,LvlInfo, "TEST checkCredentialsRotation")
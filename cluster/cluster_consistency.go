@@ -0,0 +1,733 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/signal18/replication-manager/config"
+	"github.com/signal18/replication-manager/utils/dbhelper"
+	"github.com/signal18/replication-manager/utils/state"
+)
+
+const (
+	ConsistencyActionStart  = "start"
+	ConsistencyActionStop   = "stop"
+	ConsistencyActionResync = "resync"
+
+	consistencyWaitTimeout = 5 * time.Minute
+)
+
+var (
+	ErrConsistencyRunning  = errors.New("A consistency check is already running")
+	ErrConsistencyNoMaster = errors.New("No master found for consistency check")
+)
+
+// ConsistencyChunk is a range of rows with a different checksum on a replica.
+// A missing chunk never reached the replica, the table or replication_manager_schema
+// is filtered by the replica.
+type ConsistencyChunk struct {
+	Server     string    `json:"server"`
+	Schema     string    `json:"schema"`
+	Table      string    `json:"table"`
+	Chunk      int       `json:"chunk"`
+	Lower      []string  `json:"lower"`
+	Upper      []string  `json:"upper"`
+	MasterCrc  string    `json:"masterCrc"`
+	MasterCnt  int64     `json:"masterCnt"`
+	ReplicaCrc string    `json:"replicaCrc"`
+	ReplicaCnt int64     `json:"replicaCnt"`
+	Missing    bool      `json:"missing"`
+	Detected   time.Time `json:"detected"`
+	Resynced   time.Time `json:"resynced,omitempty"`
+}
+
+// ConsistencyStatus is the progress of the current pass and the divergent chunks of the last one
+type ConsistencyStatus struct {
+	Enabled   bool               `json:"enabled"`
+	Running   bool               `json:"running"`
+	Table     string             `json:"table,omitempty"`
+	PassStart time.Time          `json:"passStart"`
+	PassEnd   time.Time          `json:"passEnd"`
+	Tables    int                `json:"tables"`
+	Chunks    int                `json:"chunks"`
+	Skipped   []string           `json:"skipped"`
+	Error     string             `json:"error,omitempty"`
+	Divergent []ConsistencyChunk `json:"divergent"`
+}
+
+type consistencyRow struct {
+	Schema    string         `db:"db"`
+	Table     string         `db:"tbl"`
+	Chunk     int            `db:"chunk"`
+	Lower     sql.NullString `db:"lower_boundary"`
+	Upper     sql.NullString `db:"upper_boundary"`
+	ThisCrc   string         `db:"this_crc"`
+	ThisCnt   int64          `db:"this_cnt"`
+	MasterCrc sql.NullString `db:"master_crc"`
+	MasterCnt sql.NullInt64  `db:"master_cnt"`
+}
+
+func (cluster *Cluster) GetConsistency() ConsistencyStatus {
+	cluster.consistencyMutex.Lock()
+	defer cluster.consistencyMutex.Unlock()
+	st := cluster.consistency
+	st.Enabled = cluster.Conf.ConsistencyCheck
+	st.Skipped = append([]string{}, cluster.consistency.Skipped...)
+	st.Divergent = append([]ConsistencyChunk{}, cluster.consistency.Divergent...)
+	return st
+}
+
+// CheckConsistency raises a warning per replica with divergent chunks and starts
+// a new pass once consistency-check-interval is elapsed since the last one
+func (cluster *Cluster) CheckConsistency() {
+	st := cluster.GetConsistency()
+	divergent := make(map[string]int)
+	for _, chunk := range st.Divergent {
+		if chunk.Resynced.IsZero() {
+			divergent[chunk.Server]++
+		}
+	}
+	for url, count := range divergent {
+		cluster.SetState("WARN0148", state.State{ErrType: config.LvlWarn, ErrDesc: fmt.Sprintf(clusterError["WARN0148"], count, url), ErrFrom: "CHECK", ServerUrl: url})
+	}
+	if !cluster.Conf.ConsistencyCheck || st.Running {
+		return
+	}
+	if time.Since(st.PassEnd) < time.Duration(cluster.Conf.ConsistencyCheckInterval)*time.Second {
+		return
+	}
+	if err := cluster.StartConsistencyCheck(); err != nil {
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlDbg, "Consistency check not started: %s", err)
+	}
+}
+
+// StartConsistencyCheck runs a checksum pass over every table of the master in background
+func (cluster *Cluster) StartConsistencyCheck() error {
+	master := cluster.GetMaster()
+	if master == nil || master.IsDown() {
+		return ErrConsistencyNoMaster
+	}
+	cluster.consistencyMutex.Lock()
+	if cluster.consistency.Running {
+		cluster.consistencyMutex.Unlock()
+		return ErrConsistencyRunning
+	}
+	cluster.consistency.Running = true
+	cluster.consistency.PassStart = time.Now()
+	cluster.consistency.Tables = 0
+	cluster.consistency.Chunks = 0
+	cluster.consistency.Skipped = []string{}
+	cluster.consistency.Error = ""
+	cluster.consistencyStop = false
+	cluster.consistencyMutex.Unlock()
+
+	go cluster.runConsistencyCheck(master)
+	return nil
+}
+
+// StopConsistencyCheck interrupts the running pass after the current chunk
+func (cluster *Cluster) StopConsistencyCheck() {
+	cluster.consistencyMutex.Lock()
+	defer cluster.consistencyMutex.Unlock()
+	cluster.consistencyStop = true
+}
+
+// StartConsistencyResync resyncs the divergent chunks of the last pass in background
+func (cluster *Cluster) StartConsistencyResync() error {
+	master := cluster.GetMaster()
+	if master == nil || master.IsDown() {
+		return ErrConsistencyNoMaster
+	}
+	cluster.consistencyMutex.Lock()
+	if cluster.consistency.Running {
+		cluster.consistencyMutex.Unlock()
+		return ErrConsistencyRunning
+	}
+	cluster.consistency.Running = true
+	cluster.consistencyStop = false
+	cluster.consistencyMutex.Unlock()
+
+	go func() {
+		err := cluster.resyncConsistencyChunks(master)
+		cluster.consistencyMutex.Lock()
+		cluster.consistency.Running = false
+		if err != nil {
+			cluster.consistency.Error = err.Error()
+		}
+		cluster.consistencyMutex.Unlock()
+		cluster.saveConsistency()
+	}()
+	return nil
+}
+
+func (cluster *Cluster) isConsistencyStopped() bool {
+	cluster.consistencyMutex.Lock()
+	defer cluster.consistencyMutex.Unlock()
+	return cluster.consistencyStop
+}
+
+func (cluster *Cluster) runConsistencyCheck(master *ServerMonitor) {
+	err := cluster.checksumConsistency(master)
+	var divergent []ConsistencyChunk
+	if err == nil && !cluster.isConsistencyStopped() {
+		cluster.waitConsistencyReplicas(master)
+		divergent, err = cluster.compareConsistency(master)
+	}
+	cluster.consistencyMutex.Lock()
+	cluster.consistency.Table = ""
+	cluster.consistency.PassEnd = time.Now()
+	if err != nil {
+		cluster.consistency.Error = err.Error()
+	} else if divergent != nil {
+		cluster.consistency.Divergent = divergent
+	}
+	cluster.consistencyMutex.Unlock()
+	if err != nil {
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlErr, "Consistency check failed: %s", err)
+	} else {
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Consistency check done, %d divergent chunks", len(divergent))
+		if len(divergent) > 0 && cluster.Conf.ConsistencyCheckResync {
+			if err := cluster.resyncConsistencyChunks(master); err != nil {
+				cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlErr, "Consistency resync failed: %s", err)
+			}
+		}
+	}
+	cluster.consistencyMutex.Lock()
+	cluster.consistency.Running = false
+	cluster.consistencyMutex.Unlock()
+	cluster.saveConsistency()
+}
+
+// consistencyConn is a single session pinned out of the pool, the session variables
+// set on it are lost if the pool hands out or reopens another connection
+type consistencyConn struct {
+	db   *sqlx.DB
+	conn *sqlx.Conn
+}
+
+func (c *consistencyConn) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.conn.ExecContext(context.Background(), query, args...)
+}
+
+func (c *consistencyConn) Queryx(query string, args ...interface{}) (*sqlx.Rows, error) {
+	return c.conn.QueryxContext(context.Background(), query, args...)
+}
+
+func (c *consistencyConn) QueryRowx(query string, args ...interface{}) *sqlx.Row {
+	return c.conn.QueryRowxContext(context.Background(), query, args...)
+}
+
+func (c *consistencyConn) Select(dest interface{}, query string, args ...interface{}) error {
+	return c.conn.SelectContext(context.Background(), dest, query, args...)
+}
+
+func (c *consistencyConn) Beginx() (*sqlx.Tx, error) {
+	return c.conn.BeginTxx(context.Background(), nil)
+}
+
+func (c *consistencyConn) Close() error {
+	c.conn.Close()
+	return c.db.Close()
+}
+
+// getConsistencyConn opens a single session on the master logging in statement format,
+// the replicas compute their own checksum when they replay the statements
+func (cluster *Cluster) getConsistencyConn(master *ServerMonitor) (*consistencyConn, error) {
+	db, err := master.GetNewDBConn()
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	conn, err := db.Connx(context.Background())
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	c := &consistencyConn{db: db, conn: conn}
+	for _, query := range []string{
+		"SET SESSION binlog_format='STATEMENT'",
+		"SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ",
+		"SET SESSION innodb_lock_wait_timeout=1",
+	} {
+		if _, err := c.Exec(query); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("%s: %s", query, err)
+		}
+	}
+	return c, nil
+}
+
+func (cluster *Cluster) checksumConsistency(master *ServerMonitor) error {
+	conn, err := cluster.getConsistencyConn(master)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.Exec("CREATE DATABASE IF NOT EXISTS replication_manager_schema")
+	_, err = conn.Exec("CREATE TABLE IF NOT EXISTS replication_manager_schema.checksums(db CHAR(64) NOT NULL, tbl CHAR(64) NOT NULL, chunk INT NOT NULL, lower_boundary TEXT, upper_boundary TEXT, this_crc CHAR(40) NOT NULL, this_cnt INT NOT NULL, master_crc CHAR(40), master_cnt INT, ts TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP, PRIMARY KEY(db, tbl, chunk)) ENGINE=InnoDB")
+	if err != nil {
+		return err
+	}
+	type table struct {
+		Schema string `db:"TABLE_SCHEMA"`
+		Name   string `db:"TABLE_NAME"`
+	}
+	tables := []table{}
+	err = conn.Select(&tables, "SELECT TABLE_SCHEMA, TABLE_NAME FROM information_schema.TABLES WHERE TABLE_TYPE='BASE TABLE' AND TABLE_SCHEMA NOT IN ('mysql','information_schema','performance_schema','sys','replication_manager_schema') ORDER BY TABLE_SCHEMA, TABLE_NAME")
+	if err != nil {
+		return err
+	}
+	for _, t := range tables {
+		if cluster.isConsistencyStopped() {
+			return errors.New("Consistency check stopped")
+		}
+		cluster.consistencyMutex.Lock()
+		cluster.consistency.Table = t.Schema + "." + t.Name
+		cluster.consistencyMutex.Unlock()
+		chunks, err := cluster.checksumConsistencyTable(conn, master, t.Schema, t.Name)
+		cluster.consistencyMutex.Lock()
+		if err != nil {
+			cluster.consistency.Skipped = append(cluster.consistency.Skipped, t.Schema+"."+t.Name+": "+err.Error())
+		} else {
+			cluster.consistency.Tables++
+			cluster.consistency.Chunks += chunks
+		}
+		cluster.consistencyMutex.Unlock()
+		if err != nil {
+			cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Consistency check skip table %s.%s: %s", t.Schema, t.Name, err)
+		}
+	}
+	return nil
+}
+
+// checksumConsistencyTable walks the table by primary key ranges of consistency-check-chunk-size rows
+func (cluster *Cluster) checksumConsistencyTable(conn *consistencyConn, master *ServerMonitor, schema string, table string) (int, error) {
+	columns, _, err := dbhelper.GetTableColumnNames(master.Conn, schema, table)
+	if err != nil {
+		return 0, err
+	}
+	pks, _, err := dbhelper.GetTablePKColumns(master.Conn, schema, table)
+	if err != nil {
+		return 0, err
+	}
+	if len(pks) == 0 {
+		return 0, errors.New("no primary key")
+	}
+	name := "`" + schema + "`.`" + table + "`"
+	pk := consistencyColumnList(pks)
+	isnull := make([]string, len(columns))
+	for i, col := range columns {
+		isnull[i] = "ISNULL(`" + col + "`)"
+	}
+	crc := "COALESCE(LOWER(CONV(BIT_XOR(CAST(CRC32(CONCAT_WS('#'," + consistencyColumnList(columns) + ",CONCAT(" + strings.Join(isnull, ",") + "))) AS UNSIGNED)), 10, 16)), 0)"
+	size := cluster.Conf.ConsistencyCheckChunkSize
+	if size <= 0 {
+		size = 1000
+	}
+
+	var lower []string
+	chunk := 0
+	for {
+		if cluster.isConsistencyStopped() {
+			return chunk, errors.New("stopped")
+		}
+		cluster.throttleConsistency()
+		chunk++
+		where, args := consistencyRange(pk, len(pks), lower, nil)
+		upper := []string{}
+		rows, err := conn.Queryx("SELECT "+pk+" FROM "+name+" WHERE "+where+" ORDER BY "+pk+" LIMIT 1 OFFSET "+strconv.Itoa(size-1), args...)
+		if err != nil {
+			return chunk, err
+		}
+		if rows.Next() {
+			values, err := rows.SliceScan()
+			if err != nil {
+				rows.Close()
+				return chunk, err
+			}
+			for _, v := range values {
+				upper = append(upper, consistencyValue(v))
+			}
+		} else {
+			upper = nil
+		}
+		rows.Close()
+
+		where, args = consistencyRange(pk, len(pks), lower, upper)
+		args = append([]interface{}{schema, table, chunk, consistencyBoundary(lower), consistencyBoundary(upper)}, args...)
+		_, err = conn.Exec("REPLACE INTO replication_manager_schema.checksums(db, tbl, chunk, lower_boundary, upper_boundary, this_crc, this_cnt, master_crc, master_cnt, ts) SELECT ?, ?, ?, ?, ?, "+crc+", COUNT(*), NULL, NULL, NOW() FROM "+name+" WHERE "+where, args...)
+		if err != nil {
+			return chunk, err
+		}
+		var thisCrc string
+		var thisCnt int64
+		err = conn.QueryRowx("SELECT this_crc, this_cnt FROM replication_manager_schema.checksums WHERE db=? AND tbl=? AND chunk=?", schema, table, chunk).Scan(&thisCrc, &thisCnt)
+		if err != nil {
+			return chunk, err
+		}
+		_, err = conn.Exec("UPDATE replication_manager_schema.checksums SET master_crc=?, master_cnt=? WHERE db=? AND tbl=? AND chunk=?", thisCrc, thisCnt, schema, table, chunk)
+		if err != nil {
+			return chunk, err
+		}
+		if upper == nil {
+			break
+		}
+		lower = upper
+	}
+	_, err = conn.Exec("DELETE FROM replication_manager_schema.checksums WHERE db=? AND tbl=? AND chunk>?", schema, table, chunk)
+	return chunk, err
+}
+
+// throttleConsistency applies consistency-check-chunk-rate and waits while a replica delay
+// is above consistency-check-max-lag
+func (cluster *Cluster) throttleConsistency() {
+	if cluster.Conf.ConsistencyCheckChunkRate > 0 {
+		time.Sleep(time.Second / time.Duration(cluster.Conf.ConsistencyCheckChunkRate))
+	}
+	for !cluster.isConsistencyStopped() {
+		lagging := false
+		for _, s := range cluster.slaves {
+			if !s.IsFailed() && !s.IsIgnored() && s.GetReplicationDelay() > int64(cluster.Conf.ConsistencyCheckMaxLag) {
+				lagging = true
+			}
+		}
+		if !lagging {
+			return
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// waitConsistencyReplicas waits for the replicas to replay the last checksums
+func (cluster *Cluster) waitConsistencyReplicas(master *ServerMonitor) {
+	deadline := time.Now().Add(consistencyWaitTimeout)
+	for _, s := range cluster.slaves {
+		for !s.IsFailed() && s.IsSQLThreadRunning() && s.GetReplicationDelay() > 0 && time.Now().Before(deadline) {
+			time.Sleep(time.Second)
+		}
+	}
+	time.Sleep(time.Duration(cluster.Conf.MonitoringTicker) * time.Second)
+}
+
+// compareConsistency reads the checksums replayed by each replica, a replica holds its own
+// checksum in this_crc and the master one in master_crc
+func (cluster *Cluster) compareConsistency(master *ServerMonitor) ([]ConsistencyChunk, error) {
+	query := "SELECT db, tbl, chunk, lower_boundary, upper_boundary, this_crc, this_cnt, master_crc, master_cnt FROM replication_manager_schema.checksums"
+	masterRows := []consistencyRow{}
+	if err := master.Conn.Select(&masterRows, query); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	divergent := []ConsistencyChunk{}
+	for _, s := range cluster.slaves {
+		if s.IsFailed() || s.IsIgnored() || s.Conn == nil {
+			continue
+		}
+		slaveRows := []consistencyRow{}
+		if err := s.Conn.Select(&slaveRows, query); err != nil {
+			cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlWarn, "Consistency check can't read checksums on %s: %s", s.URL, err)
+		}
+		replica := make(map[string]consistencyRow, len(slaveRows))
+		for _, row := range slaveRows {
+			replica[row.Schema+"."+row.Table+"."+strconv.Itoa(row.Chunk)] = row
+		}
+		for _, m := range masterRows {
+			chunk := ConsistencyChunk{
+				Server:    s.URL,
+				Schema:    m.Schema,
+				Table:     m.Table,
+				Chunk:     m.Chunk,
+				Lower:     consistencyParseBoundary(m.Lower),
+				Upper:     consistencyParseBoundary(m.Upper),
+				MasterCrc: m.ThisCrc,
+				MasterCnt: m.ThisCnt,
+				Detected:  now,
+			}
+			r, ok := replica[m.Schema+"."+m.Table+"."+strconv.Itoa(m.Chunk)]
+			if !ok {
+				chunk.Missing = true
+				divergent = append(divergent, chunk)
+				continue
+			}
+			if !r.MasterCrc.Valid {
+				// master checksum not yet replayed
+				continue
+			}
+			if r.ThisCrc != r.MasterCrc.String || r.ThisCnt != r.MasterCnt.Int64 {
+				chunk.MasterCrc = r.MasterCrc.String
+				chunk.MasterCnt = r.MasterCnt.Int64
+				chunk.ReplicaCrc = r.ThisCrc
+				chunk.ReplicaCnt = r.ThisCnt
+				divergent = append(divergent, chunk)
+			}
+		}
+	}
+	return divergent, nil
+}
+
+// resyncConsistencyChunks replays the master rows of each divergent chunk in statement format
+// and deletes the rows only found on the replica, the statements are no-op on consistent servers
+func (cluster *Cluster) resyncConsistencyChunks(master *ServerMonitor) error {
+	conn, err := cluster.getConsistencyConn(master)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	chunks := cluster.GetConsistency().Divergent
+	for _, chunk := range chunks {
+		if cluster.isConsistencyStopped() {
+			return errors.New("Consistency resync stopped")
+		}
+		if !chunk.Resynced.IsZero() || chunk.Missing {
+			continue
+		}
+		slave := cluster.GetServerFromURL(chunk.Server)
+		if slave == nil || slave.Conn == nil {
+			continue
+		}
+		cluster.throttleConsistency()
+		if err := cluster.resyncConsistencyChunk(conn, master, slave, chunk); err != nil {
+			return fmt.Errorf("Resync chunk %d of %s.%s on %s: %s", chunk.Chunk, chunk.Schema, chunk.Table, chunk.Server, err)
+		}
+		cluster.consistencyMutex.Lock()
+		for i := range cluster.consistency.Divergent {
+			d := &cluster.consistency.Divergent[i]
+			if d.Server == chunk.Server && d.Schema == chunk.Schema && d.Table == chunk.Table && d.Chunk == chunk.Chunk {
+				d.Resynced = time.Now()
+			}
+		}
+		cluster.consistencyMutex.Unlock()
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Consistency resync chunk %d of %s.%s for %s", chunk.Chunk, chunk.Schema, chunk.Table, chunk.Server)
+	}
+	return nil
+}
+
+func (cluster *Cluster) resyncConsistencyChunk(conn *consistencyConn, master *ServerMonitor, slave *ServerMonitor, chunk ConsistencyChunk) error {
+	columns, _, err := dbhelper.GetTableColumnNames(master.Conn, chunk.Schema, chunk.Table)
+	if err != nil {
+		return err
+	}
+	pks, _, err := dbhelper.GetTablePKColumns(master.Conn, chunk.Schema, chunk.Table)
+	if err != nil {
+		return err
+	}
+	if len(pks) == 0 {
+		return errors.New("no primary key")
+	}
+	name := "`" + chunk.Schema + "`.`" + chunk.Table + "`"
+	pk := consistencyColumnList(pks)
+	pkIndex := make([]int, len(pks))
+	for i, p := range pks {
+		for j, col := range columns {
+			if col == p {
+				pkIndex[i] = j
+			}
+		}
+	}
+	where, args := consistencyRange(pk, len(pks), chunk.Lower, chunk.Upper)
+
+	// the master rows stay locked until the fix is written so that a concurrent
+	// write can not be overwritten with the values read before it
+	tx, err := conn.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	masterRows := [][]interface{}{}
+	masterKeys := make(map[string]bool)
+	rows, err := tx.Queryx("SELECT "+consistencyColumnList(columns)+" FROM "+name+" WHERE "+where+" FOR UPDATE", args...)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		values, err := rows.SliceScan()
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		key := make([]interface{}, len(pkIndex))
+		for i, idx := range pkIndex {
+			key[i] = values[idx]
+		}
+		masterKeys[consistencyKey(key)] = true
+		masterRows = append(masterRows, values)
+	}
+	rows.Close()
+
+	extraKeys := [][]interface{}{}
+	rows, err = slave.Conn.Queryx("SELECT "+pk+" FROM "+name+" WHERE "+where, args...)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		values, err := rows.SliceScan()
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		if !masterKeys[consistencyKey(values)] {
+			extraKeys = append(extraKeys, values)
+		}
+	}
+	rows.Close()
+
+	upsert := consistencyUpsert(name, columns, pks)
+	for _, values := range masterRows {
+		if _, err := tx.Exec(upsert, values...); err != nil {
+			return err
+		}
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(pks)), ",")
+	for _, values := range extraKeys {
+		if _, err := tx.Exec("DELETE FROM "+name+" WHERE ("+pk+") = ("+placeholders+")", values...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (cluster *Cluster) saveConsistency() {
+	st := cluster.GetConsistency()
+	st.Running = false
+	st.Table = ""
+	content, _ := json.MarshalIndent(st, "", "\t")
+	if err := os.WriteFile(cluster.WorkingDir+"/consistency.json", content, 0644); err != nil {
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlErr, "Can't save consistency check results: %s", err)
+	}
+}
+
+// loadConsistency restores the results of the last pass
+func (cluster *Cluster) loadConsistency() {
+	content, err := os.ReadFile(cluster.WorkingDir + "/consistency.json")
+	if err != nil {
+		return
+	}
+	var st ConsistencyStatus
+	if err := json.Unmarshal(content, &st); err != nil {
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModConfigLoad, config.LvlErr, "File error: %v\n", err)
+		return
+	}
+	st.Running = false
+	cluster.consistencyMutex.Lock()
+	cluster.consistency = st
+	cluster.consistencyMutex.Unlock()
+}
+
+// consistencyRange returns the predicate of a chunk, lower is exclusive and upper inclusive
+func consistencyRange(pk string, n int, lower []string, upper []string) (string, []interface{}) {
+	conds := []string{}
+	args := []interface{}{}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", n), ",")
+	if lower != nil {
+		conds = append(conds, "("+pk+") > ("+placeholders+")")
+		for _, v := range lower {
+			args = append(args, v)
+		}
+	}
+	if upper != nil {
+		conds = append(conds, "("+pk+") <= ("+placeholders+")")
+		for _, v := range upper {
+			args = append(args, v)
+		}
+	}
+	if len(conds) == 0 {
+		return "1=1", args
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+func consistencyBoundary(values []string) interface{} {
+	if values == nil {
+		return nil
+	}
+	b, _ := json.Marshal(values)
+	return string(b)
+}
+
+func consistencyParseBoundary(s sql.NullString) []string {
+	if !s.Valid {
+		return nil
+	}
+	var values []string
+	json.Unmarshal([]byte(s.String), &values)
+	return values
+}
+
+// consistencyValue formats a scanned column value, the driver returns []byte in text
+// protocol and native types such as int64 when the query is prepared with arguments
+func consistencyValue(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(t)
+	case string:
+		return t
+	case int64:
+		return strconv.FormatInt(t, 10)
+	case uint64:
+		return strconv.FormatUint(t, 10)
+	case float32:
+		return strconv.FormatFloat(float64(t), 'f', -1, 32)
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case time.Time:
+		return t.Format("2006-01-02 15:04:05.999999")
+	default:
+		return fmt.Sprint(t)
+	}
+}
+
+func consistencyKey(values []interface{}) string {
+	key := make([]string, len(values))
+	for i, v := range values {
+		key[i] = consistencyValue(v)
+	}
+	return strings.Join(key, "\x00")
+}
+
+// consistencyUpsert rewrites a row with its own values, unlike REPLACE it does not delete
+// the row first so it does not fire delete triggers or cascade on foreign keys
+func consistencyUpsert(name string, columns []string, pks []string) string {
+	isPK := make(map[string]bool)
+	for _, p := range pks {
+		isPK[p] = true
+	}
+	set := []string{}
+	for _, col := range columns {
+		if !isPK[col] {
+			set = append(set, "`"+col+"`=VALUES(`"+col+"`)")
+		}
+	}
+	if len(set) == 0 {
+		set = append(set, "`"+pks[0]+"`=`"+pks[0]+"`")
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(columns)), ",")
+	return "INSERT INTO " + name + "(" + consistencyColumnList(columns) + ") VALUES (" + placeholders + ") ON DUPLICATE KEY UPDATE " + strings.Join(set, ",")
+}
+
+func consistencyColumnList(columns []string) string {
+	list := make([]string, len(columns))
+	for i, col := range columns {
+		list[i] = "`" + col + "`"
+	}
+	return strings.Join(list, ",")
+}
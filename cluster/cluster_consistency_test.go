@@ -0,0 +1,118 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+)
+
+func TestConsistencyNumericKey(t *testing.T) {
+	for _, tc := range []struct {
+		value interface{}
+		want  string
+	}{
+		{int64(42), "42"},
+		{int64(-7), "-7"},
+		{uint64(18446744073709551615), "18446744073709551615"},
+		{[]byte("abc"), "abc"},
+		{"abc", "abc"},
+		{float64(1.5), "1.5"},
+		{nil, ""},
+	} {
+		if got := consistencyValue(tc.value); got != tc.want {
+			t.Errorf("consistencyValue(%#v) = %q, want %q", tc.value, got, tc.want)
+		}
+	}
+	// the master rows are scanned as int64 and the replica keys as []byte
+	if consistencyKey([]interface{}{int64(12), int64(3)}) != consistencyKey([]interface{}{[]byte("12"), []byte("3")}) {
+		t.Error("Expected int64 and []byte keys to match")
+	}
+	if consistencyKey([]interface{}{int64(1), int64(23)}) == consistencyKey([]interface{}{int64(12), int64(3)}) {
+		t.Error("Expected composite keys to be separated")
+	}
+}
+
+func TestConsistencyUpsert(t *testing.T) {
+	got := consistencyUpsert("`db`.`t`", []string{"id", "a", "b"}, []string{"id"})
+	want := "INSERT INTO `db`.`t`(`id`,`a`,`b`) VALUES (?,?,?) ON DUPLICATE KEY UPDATE `a`=VALUES(`a`),`b`=VALUES(`b`)"
+	if got != want {
+		t.Errorf("Unexpected upsert\n%s\nwant\n%s", got, want)
+	}
+	got = consistencyUpsert("`db`.`t`", []string{"k1", "k2"}, []string{"k1", "k2"})
+	want = "INSERT INTO `db`.`t`(`k1`,`k2`) VALUES (?,?) ON DUPLICATE KEY UPDATE `k1`=`k1`"
+	if got != want {
+		t.Errorf("Unexpected upsert\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestConsistencyRange(t *testing.T) {
+	where, args := consistencyRange("`id`", 1, nil, nil)
+	if where != "1=1" || len(args) != 0 {
+		t.Errorf("Unexpected full range %s %v", where, args)
+	}
+	where, args = consistencyRange("`id`", 1, []string{"10"}, []string{"20"})
+	if where != "(`id`) > (?) AND (`id`) <= (?)" || len(args) != 2 || args[0] != "10" || args[1] != "20" {
+		t.Errorf("Unexpected chunk range %s %v", where, args)
+	}
+}
+
+func newConsistencyMock(t *testing.T) (*sqlx.DB, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sqlx.NewDb(db, "mysql"), mock
+}
+
+func TestResyncConsistencyChunkLocksRows(t *testing.T) {
+	cluster := &Cluster{Name: "c1"}
+	metaDB, meta := newConsistencyMock(t)
+	defer metaDB.Close()
+	slaveDB, slaveMock := newConsistencyMock(t)
+	defer slaveDB.Close()
+	db, mock := newConsistencyMock(t)
+	pinned, err := db.Connx(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := &consistencyConn{db: db, conn: pinned}
+	defer conn.Close()
+	master := &ServerMonitor{URL: "db1:3306", ClusterGroup: cluster, Conn: metaDB}
+	slave := &ServerMonitor{URL: "db2:3306", ClusterGroup: cluster, Conn: slaveDB}
+
+	meta.ExpectQuery("information_schema.COLUMNS").WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME"}).AddRow("id").AddRow("v"))
+	meta.ExpectQuery("information_schema.KEY_COLUMN_USAGE").WillReturnRows(sqlmock.NewRows([]string{"COLUMN_NAME"}).AddRow("id"))
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT `id`,`v` FROM `db`.`t` WHERE (`id`) > (?) AND (`id`) <= (?) FOR UPDATE")).
+		WithArgs("0", "10").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "v"}).AddRow(int64(1), []byte("a")).AddRow(int64(2), []byte("b")))
+	slaveMock.ExpectQuery(regexp.QuoteMeta("SELECT `id` FROM `db`.`t`")).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(int64(1)).AddRow(int64(3)))
+	upsert := regexp.QuoteMeta("INSERT INTO `db`.`t`(`id`,`v`) VALUES (?,?) ON DUPLICATE KEY UPDATE `v`=VALUES(`v`)")
+	mock.ExpectExec(upsert).WithArgs(int64(1), []byte("a")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(upsert).WithArgs(int64(2), []byte("b")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM `db`.`t` WHERE (`id`) = (?)")).WithArgs(int64(3)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	chunk := ConsistencyChunk{Server: "db2:3306", Schema: "db", Table: "t", Chunk: 1, Lower: []string{"0"}, Upper: []string{"10"}}
+	if err := cluster.resyncConsistencyChunk(conn, master, slave, chunk); err != nil {
+		t.Fatalf("Unexpected resync error %s", err)
+	}
+	for _, m := range []sqlmock.Sqlmock{meta, slaveMock, mock} {
+		if err := m.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	}
+}
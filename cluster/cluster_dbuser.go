@@ -0,0 +1,458 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/signal18/replication-manager/config"
+	"github.com/signal18/replication-manager/utils/dbhelper"
+	"github.com/signal18/replication-manager/utils/dbuser"
+	"github.com/signal18/replication-manager/utils/misc"
+	"github.com/signal18/replication-manager/utils/state"
+)
+
+const (
+	dbUserDriftDatabase = "database"
+	dbUserDriftProxySQL = "proxysql"
+)
+
+// DBUser is a managed application user, the password is never returned
+type DBUser struct {
+	dbuser.User
+	HasPassword bool `json:"hasPassword"`
+}
+
+// DBUserDrift is a managed user that does not match on a database server or a ProxySQL
+type DBUserDrift struct {
+	User     string              `json:"user"`
+	Host     string              `json:"host"`
+	Server   string              `json:"server"`
+	Kind     string              `json:"kind"`
+	Missing  bool                `json:"missing"`
+	Password bool                `json:"password"`
+	Diff     []dbuser.Difference `json:"diff"`
+	Error    string              `json:"error,omitempty"`
+	Checked  int64               `json:"checked"`
+}
+
+func (d DBUserDrift) String() string {
+	var msgs []string
+	if d.Missing {
+		msgs = append(msgs, "missing")
+	}
+	if d.Password {
+		msgs = append(msgs, "password differs")
+	}
+	for _, diff := range d.Diff {
+		msgs = append(msgs, diff.String())
+	}
+	if d.Error != "" {
+		msgs = append(msgs, d.Error)
+	}
+	return strings.Join(msgs, ", ")
+}
+
+func (cluster *Cluster) GetDBUsersPolicy() dbuser.Policy {
+	return dbuser.Policy{
+		MinLength:  cluster.Conf.DBUsersPasswordMinLength,
+		Lifetime:   cluster.Conf.DBUsersPasswordLifetime,
+		RequireSSL: cluster.Conf.DBUsersRequireSSL,
+	}
+}
+
+func (cluster *Cluster) getDBUsers() map[string]dbuser.User {
+	users, err := dbuser.ParseUsers(cluster.Conf.DBUsers)
+	if err != nil {
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlErr, "Invalid db-users: %s", err)
+	}
+	return users
+}
+
+func (cluster *Cluster) getDBUsersPasswords() map[string]string {
+	passwords := make(map[string]string)
+	for _, cred := range strings.Split(cluster.Conf.GetDecryptedValue("db-users-credential"), ",") {
+		if !strings.Contains(cred, ":") {
+			continue
+		}
+		user, pass := misc.SplitPair(cred)
+		passwords[user] = pass
+	}
+	return passwords
+}
+
+// saveDBUsers writes the users and their passwords back to the configuration
+func (cluster *Cluster) saveDBUsers(users map[string]dbuser.User, passwords map[string]string) {
+	cluster.Conf.DBUsers = dbuser.FormatUsers(users)
+	names := make([]string, 0, len(passwords))
+	for name := range passwords {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var creds []string
+	for _, name := range names {
+		creds = append(creds, name+":"+passwords[name])
+	}
+	cluster.Conf.DBUsersCredential = strings.Join(creds, ",")
+	var new_secret config.Secret
+	new_secret.Value = cluster.Conf.DBUsersCredential
+	new_secret.OldValue = cluster.Conf.GetDecryptedValue("db-users-credential")
+	cluster.Conf.Secrets["db-users-credential"] = new_secret
+	cluster.Save()
+}
+
+// generateDBUserPassword returns a random password passing the policy
+func (cluster *Cluster) generateDBUserPassword() (string, error) {
+	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	length := cluster.Conf.DBUsersPasswordMinLength
+	if length < 20 {
+		length = 20
+	}
+	policy := cluster.GetDBUsersPolicy()
+	for {
+		b := make([]byte, length)
+		for i := range b {
+			n, err := rand.Int(rand.Reader, big.NewInt(int64(len(charset))))
+			if err != nil {
+				return "", err
+			}
+			b[i] = charset[n.Int64()]
+		}
+		if policy.Check(string(b)) == nil {
+			return string(b), nil
+		}
+	}
+}
+
+func (cluster *Cluster) GetDBUsers() []DBUser {
+	passwords := cluster.getDBUsersPasswords()
+	list := []DBUser{}
+	for _, u := range cluster.getDBUsers() {
+		list = append(list, DBUser{User: u, HasPassword: passwords[u.Name] != ""})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// SetDBUser creates or replaces a managed user and applies it on the master, a password is
+// generated for a new user when none is given
+func (cluster *Cluster) SetDBUser(u dbuser.User, password string) error {
+	if err := u.Validate(); err != nil {
+		return err
+	}
+	cluster.dbUsersMutex.Lock()
+	users := cluster.getDBUsers()
+	passwords := cluster.getDBUsersPasswords()
+	if password != "" {
+		if err := cluster.GetDBUsersPolicy().Check(password); err != nil {
+			cluster.dbUsersMutex.Unlock()
+			return err
+		}
+		passwords[u.Name] = password
+	} else if passwords[u.Name] == "" {
+		pass, err := cluster.generateDBUserPassword()
+		if err != nil {
+			cluster.dbUsersMutex.Unlock()
+			return err
+		}
+		passwords[u.Name] = pass
+	}
+	users[u.Name] = u
+	cluster.saveDBUsers(users, passwords)
+	cluster.dbUsersMutex.Unlock()
+	cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Set database user %s", u.String())
+	return cluster.ApplyDBUser(u.Name)
+}
+
+// DropDBUser removes a managed user, with drop the user is also dropped from the master
+// and ProxySQL
+func (cluster *Cluster) DropDBUser(name string, drop bool) error {
+	cluster.dbUsersMutex.Lock()
+	users := cluster.getDBUsers()
+	u, ok := users[name]
+	if !ok {
+		cluster.dbUsersMutex.Unlock()
+		return fmt.Errorf("Database user %s not found", name)
+	}
+	passwords := cluster.getDBUsersPasswords()
+	delete(users, name)
+	delete(passwords, name)
+	cluster.saveDBUsers(users, passwords)
+	cluster.dbUsersMutex.Unlock()
+	cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Drop database user %s", name)
+	if !drop {
+		return nil
+	}
+	master := cluster.GetMaster()
+	if master == nil || master.IsDown() {
+		return errors.New("No master to drop the user")
+	}
+	existing, _, err := dbhelper.GetUsers(master.Conn, master.DBVersion)
+	if err != nil {
+		return err
+	}
+	for _, host := range u.Hosts {
+		if _, ok := existing["'"+u.Name+"'@'"+host+"'"]; !ok {
+			continue
+		}
+		logs, err := dbhelper.DropUser(master.Conn, master.DBVersion, host, u.Name)
+		cluster.LogSQL(logs, err, master.URL, "Security", config.LvlErr, "Drop user : %s", err)
+		if err != nil {
+			return err
+		}
+	}
+	for _, pr := range cluster.Proxies {
+		if prx, ok := pr.(*ProxySQLProxy); ok && !prx.IsDown() {
+			psql, err := prx.Connect()
+			if err != nil {
+				return err
+			}
+			err = psql.DeleteUser(u.Name)
+			if err == nil {
+				err = psql.SaveMySQLUsersToDisk()
+			}
+			psql.Connection.Close()
+			if err != nil {
+				return fmt.Errorf("ProxySQL %s: %s", prx.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ApplyDBUsers applies every managed user on the master and ProxySQL
+func (cluster *Cluster) ApplyDBUsers() error {
+	var errs []string
+	for name := range cluster.getDBUsers() {
+		if err := cluster.ApplyDBUser(name); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// ApplyDBUser creates a managed user on the master with the policy options, grants the
+// missing privileges, revokes the extra ones and adds the user to ProxySQL, replicas get
+// the changes through replication
+func (cluster *Cluster) ApplyDBUser(name string) error {
+	u, ok := cluster.getDBUsers()[name]
+	if !ok {
+		return fmt.Errorf("Database user %s not found", name)
+	}
+	password := cluster.getDBUsersPasswords()[name]
+	if password != "" {
+		// passwords from the configuration are quoted in the statements as well
+		if err := dbuser.CheckPasswordChars(password); err != nil {
+			return fmt.Errorf("Database user %s: %s", u.Name, err)
+		}
+	}
+	master := cluster.GetMaster()
+	if master == nil || master.IsDown() {
+		return errors.New("No master to apply the user")
+	}
+	existing, _, err := dbhelper.GetUsers(master.Conn, master.DBVersion)
+	if err != nil {
+		return err
+	}
+	options := cluster.GetDBUsersPolicy().Options()
+	for _, host := range u.Hosts {
+		g, ok := existing["'"+u.Name+"'@'"+host+"'"]
+		if !ok {
+			if password == "" {
+				return fmt.Errorf("Database user %s has no password", u.Name)
+			}
+			logs, err := dbhelper.CreateUser(master.Conn, master.DBVersion, host, u.Name, password)
+			cluster.LogSQL(logs, err, master.URL, "Security", config.LvlErr, "Create user : %s", err)
+			if err != nil {
+				return err
+			}
+		} else if password != "" && strings.HasPrefix(g.Password, "*") && !dbuser.SamePassword(g.Password, password) {
+			// only native password hashes can be compared
+			logs, err := dbhelper.SetUserPassword(master.Conn, master.DBVersion, host, u.Name, password)
+			cluster.LogSQL(logs, err, master.URL, "Security", config.LvlErr, "Alter user : %s", err)
+			if err != nil {
+				return err
+			}
+		}
+		if options != "" {
+			logs, err := dbhelper.SetUserOptions(master.Conn, master.DBVersion, host, u.Name, options)
+			cluster.LogSQL(logs, err, master.URL, "Security", config.LvlErr, "Alter user : %s", err)
+		}
+		lines, logs, err := dbhelper.GetUserGrants(master.Conn, master.DBVersion, host, u.Name)
+		cluster.LogSQL(logs, err, master.URL, "Security", config.LvlErr, "Show grants : %s", err)
+		if err != nil {
+			return err
+		}
+		for _, d := range dbuser.Diff(u.Grants, dbuser.ParseShowGrants(lines)) {
+			if len(d.Missing) > 0 {
+				logs, err := dbhelper.SetUserGrants(master.Conn, master.DBVersion, host, u.Name, dbuser.Grant{Privileges: d.Missing, On: d.On}.SQL())
+				cluster.LogSQL(logs, err, master.URL, "Security", config.LvlErr, "Grant : %s", err)
+				if err != nil {
+					return err
+				}
+			}
+			if len(d.Extra) > 0 {
+				logs, err := dbhelper.RevokeUserGrant(master.Conn, master.DBVersion, host, u.Name, dbuser.Grant{Privileges: d.Extra, On: d.On}.SQL())
+				cluster.LogSQL(logs, err, master.URL, "Security", config.LvlErr, "Revoke : %s", err)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if password == "" {
+		return nil
+	}
+	for _, pr := range cluster.Proxies {
+		prx, ok := pr.(*ProxySQLProxy)
+		if !ok || prx.IsDown() {
+			continue
+		}
+		psql, err := prx.Connect()
+		if err != nil {
+			return fmt.Errorf("ProxySQL %s: %s", prx.Name, err)
+		}
+		err = psql.AddUser(u.Name, password)
+		if err == nil {
+			err = psql.SaveMySQLUsersToDisk()
+		}
+		psql.Connection.Close()
+		if err != nil {
+			return fmt.Errorf("ProxySQL %s: %s", prx.Name, err)
+		}
+	}
+	cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Applied database user %s", u.Name)
+	return nil
+}
+
+// GetDBUsersDiff compares the managed users with every database server and ProxySQL
+func (cluster *Cluster) GetDBUsersDiff() []DBUserDrift {
+	users := cluster.getDBUsers()
+	passwords := cluster.getDBUsersPasswords()
+	now := time.Now().Unix()
+	drifts := []DBUserDrift{}
+	for _, server := range cluster.Servers {
+		if server == nil || server.IsDown() || server.Conn == nil || server.DBVersion == nil || server.DBVersion.IsPostgreSQL() {
+			continue
+		}
+		existing, _, err := dbhelper.GetUsers(server.Conn, server.DBVersion)
+		if err != nil {
+			drifts = append(drifts, DBUserDrift{Server: server.URL, Kind: dbUserDriftDatabase, Error: err.Error(), Checked: now})
+			continue
+		}
+		for _, u := range users {
+			for _, host := range u.Hosts {
+				d := DBUserDrift{User: u.Name, Host: host, Server: server.URL, Kind: dbUserDriftDatabase, Checked: now}
+				if _, ok := existing["'"+u.Name+"'@'"+host+"'"]; !ok {
+					d.Missing = true
+					drifts = append(drifts, d)
+					continue
+				}
+				lines, _, err := dbhelper.GetUserGrants(server.Conn, server.DBVersion, host, u.Name)
+				if err != nil {
+					d.Error = err.Error()
+				} else {
+					d.Diff = dbuser.Diff(u.Grants, dbuser.ParseShowGrants(lines))
+				}
+				if d.Error != "" || len(d.Diff) > 0 {
+					drifts = append(drifts, d)
+				}
+			}
+		}
+	}
+	for _, pr := range cluster.Proxies {
+		prx, ok := pr.(*ProxySQLProxy)
+		if !ok || prx.IsDown() {
+			continue
+		}
+		psql, err := prx.Connect()
+		if err != nil {
+			drifts = append(drifts, DBUserDrift{Server: prx.Name, Kind: dbUserDriftProxySQL, Error: err.Error(), Checked: now})
+			continue
+		}
+		prxusers, _, err := dbhelper.GetProxySQLUsers(psql.Connection)
+		psql.Connection.Close()
+		if err != nil {
+			drifts = append(drifts, DBUserDrift{Server: prx.Name, Kind: dbUserDriftProxySQL, Error: err.Error(), Checked: now})
+			continue
+		}
+		stored := make(map[string]string)
+		for _, g := range prxusers {
+			stored[g.User] = g.Password
+		}
+		for _, u := range users {
+			d := DBUserDrift{User: u.Name, Server: prx.Name, Kind: dbUserDriftProxySQL, Checked: now}
+			pass, ok := stored[u.Name]
+			if !ok {
+				d.Missing = true
+			} else if passwords[u.Name] != "" && !dbuser.SamePassword(pass, passwords[u.Name]) {
+				d.Password = true
+			}
+			if d.Missing || d.Password {
+				drifts = append(drifts, d)
+			}
+		}
+	}
+	sort.SliceStable(drifts, func(i, j int) bool {
+		if drifts[i].User != drifts[j].User {
+			return drifts[i].User < drifts[j].User
+		}
+		return drifts[i].Server < drifts[j].Server
+	})
+	return drifts
+}
+
+// CheckDBUsersDrift reports the managed users drifts as states and re-applies the users
+// when remediation is enabled and the master or a ProxySQL drifted
+func (cluster *Cluster) CheckDBUsersDrift() {
+	if !cluster.Conf.DBUsersDriftCheck || cluster.Conf.DBUsers == "" || cluster.GetMaster() == nil {
+		return
+	}
+	cluster.dbUsersDriftMutex.Lock()
+	if cluster.inDBUsersDriftCheck {
+		cluster.dbUsersDriftMutex.Unlock()
+		return
+	}
+	cluster.inDBUsersDriftCheck = true
+	cluster.dbUsersDriftMutex.Unlock()
+	defer func() {
+		cluster.dbUsersDriftMutex.Lock()
+		cluster.inDBUsersDriftCheck = false
+		cluster.dbUsersDriftMutex.Unlock()
+	}()
+	drifts := cluster.GetDBUsersDiff()
+	master := cluster.GetMaster()
+	remediate := false
+	for _, d := range drifts {
+		switch d.Kind {
+		case dbUserDriftProxySQL:
+			cluster.SetState("WARN0139", state.State{ErrType: "WARNING", ErrDesc: fmt.Sprintf(clusterError["WARN0139"], d.User, d.Server, d.String()), ErrFrom: "PRX", ServerUrl: d.Server})
+			remediate = remediate || d.Error == ""
+		default:
+			cluster.SetState("WARN0138", state.State{ErrType: "WARNING", ErrDesc: fmt.Sprintf(clusterError["WARN0138"], d.User, d.Server, d.String()), ErrFrom: "TOPO", ServerUrl: d.Server})
+			remediate = remediate || (d.Server == master.URL && d.Error == "")
+		}
+	}
+	if remediate && cluster.Conf.DBUsersDriftRemediate {
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Remediate database users drift")
+		if err := cluster.ApplyDBUsers(); err != nil {
+			cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlErr, "Could not remediate database users drift: %s", err)
+		}
+	}
+}
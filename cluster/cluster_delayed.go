@@ -0,0 +1,278 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/signal18/replication-manager/config"
+	"github.com/signal18/replication-manager/utils/dbhelper"
+)
+
+var (
+	ErrNotDelayedReplica     = errors.New("Server is not a delayed replica")
+	ErrDelayedNoConnection   = errors.New("No database connection")
+	ErrDelayedTimestampReach = errors.New("Timestamp is out of the delayed replica recovery window")
+	ErrDelayedInvalidGtid    = errors.New("Invalid GTID position")
+)
+
+// DelayedReplica is the recovery window of a delayed replica.
+// RecoverableFrom is the point in time already applied, RecoverableTo the newest event
+// received in the relay logs, any point in between can be reached with a fast-forward.
+type DelayedReplica struct {
+	URL                 string    `json:"url"`
+	Name                string    `json:"name"`
+	State               string    `json:"state"`
+	Delay               int       `json:"delay"`
+	Electable           bool      `json:"electable"`
+	Paused              bool      `json:"paused"`
+	IoThreadRunning     bool      `json:"ioThreadRunning"`
+	SqlThreadRunning    bool      `json:"sqlThreadRunning"`
+	SecondsBehindMaster int64     `json:"secondsBehindMaster"`
+	AppliedGtid         string    `json:"appliedGtid"`
+	RetrievedGtid       string    `json:"retrievedGtid"`
+	MasterLogFile       string    `json:"masterLogFile"`
+	ExecMasterLogPos    string    `json:"execMasterLogPos"`
+	RecoverableFrom     time.Time `json:"recoverableFrom"`
+	RecoverableTo       time.Time `json:"recoverableTo"`
+	RecoveryWindow      int64     `json:"recoveryWindow"`
+}
+
+// GetDelayedReplicas returns the recovery window of every delayed replica of the cluster
+func (cluster *Cluster) GetDelayedReplicas() []DelayedReplica {
+	delayed := make([]DelayedReplica, 0)
+	for _, server := range cluster.Servers {
+		if server.IsDelayed {
+			delayed = append(delayed, server.GetDelayedReplica())
+		}
+	}
+	return delayed
+}
+
+func (server *ServerMonitor) GetDelayedReplica() DelayedReplica {
+	cluster := server.ClusterGroup
+	now := time.Now()
+	dr := DelayedReplica{
+		URL:       server.URL,
+		Name:      server.Name,
+		State:     server.State,
+		Delay:     cluster.Conf.HostsDelayedTime,
+		Electable: cluster.Conf.HostsDelayedElectable,
+		Paused:    server.IsDelayedPaused,
+	}
+	ss, err := server.GetSlaveStatus(server.ReplicationSourceName)
+	if err != nil {
+		return dr
+	}
+	dr.IoThreadRunning = ss.SlaveIORunning.String == "Yes"
+	dr.SqlThreadRunning = ss.SlaveSQLRunning.String == "Yes"
+	dr.MasterLogFile = ss.RelayMasterLogFile.String
+	dr.ExecMasterLogPos = ss.ExecMasterLogPos.String
+	if server.IsMariaDB() {
+		dr.AppliedGtid = ss.GtidSlavePos.String
+		dr.RetrievedGtid = ss.GtidIOPos.String
+	} else {
+		dr.AppliedGtid = ss.ExecutedGtidSet.String
+		dr.RetrievedGtid = ss.RetrievedGtidSet.String
+	}
+	// Seconds_Behind_Master is null when the SQL thread is paused, keep the last applied point
+	if ss.SecondsBehindMaster.Valid {
+		dr.SecondsBehindMaster = ss.SecondsBehindMaster.Int64
+		server.DelayedAppliedTime = now.Add(-time.Duration(ss.SecondsBehindMaster.Int64) * time.Second)
+	}
+	dr.RecoverableFrom = server.DelayedAppliedTime
+	dr.RecoverableTo = dr.RecoverableFrom
+	if dr.IoThreadRunning {
+		dr.RecoverableTo = now
+	}
+	if !dr.RecoverableFrom.IsZero() {
+		dr.RecoveryWindow = int64(dr.RecoverableTo.Sub(dr.RecoverableFrom).Seconds())
+	}
+	return dr
+}
+
+// SetReplicationDelay changes the replication delay and restarts the replication
+func (server *ServerMonitor) SetReplicationDelay(delay int) (string, error) {
+	if server.Conn == nil {
+		return "", ErrDelayedNoConnection
+	}
+	cluster := server.ClusterGroup
+	logs, err := server.StopSlave()
+	if err != nil {
+		return logs, err
+	}
+	log, err := dbhelper.ChangeMasterDelay(server.Conn, delay, cluster.Conf.MasterConn, server.DBVersion)
+	logs += log
+	if err != nil {
+		return logs, err
+	}
+	log, err = server.StartSlave()
+	logs += log
+	return logs, err
+}
+
+// GetDelayedPausedHosts returns the delayed replicas paused by an operator, saved in the cluster state
+// to survive a restart
+func (cluster *Cluster) GetDelayedPausedHosts() []string {
+	cluster.delayedMutex.Lock()
+	defer cluster.delayedMutex.Unlock()
+	return append([]string{}, cluster.delayedPaused...)
+}
+
+// isInDelayedPausedHosts tells if the server was paused before a restart
+func (server *ServerMonitor) isInDelayedPausedHosts() bool {
+	for _, url := range server.ClusterGroup.GetDelayedPausedHosts() {
+		if server.URL == url {
+			return true
+		}
+	}
+	return false
+}
+
+// setDelayedPaused marks the delayed replica as paused or resumed and saves the cluster state
+func (server *ServerMonitor) setDelayedPaused(paused bool) {
+	cluster := server.ClusterGroup
+	server.IsDelayedPaused = paused
+	cluster.delayedMutex.Lock()
+	hosts := make([]string, 0, len(cluster.delayedPaused)+1)
+	for _, url := range cluster.delayedPaused {
+		if url != server.URL {
+			hosts = append(hosts, url)
+		}
+	}
+	if paused {
+		hosts = append(hosts, server.URL)
+	}
+	cluster.delayedPaused = hosts
+	cluster.delayedMutex.Unlock()
+	cluster.Save()
+}
+
+// PauseDelayedReplica stops the SQL thread of a delayed replica during an incident,
+// the IO thread keeps receiving events to preserve the recovery window
+func (server *ServerMonitor) PauseDelayedReplica() error {
+	cluster := server.ClusterGroup
+	if !server.IsDelayed {
+		return ErrNotDelayedReplica
+	}
+	server.GetDelayedReplica()
+	logs, err := server.StopSlaveSQLThread()
+	cluster.LogSQL(logs, err, server.URL, "DelayedReplica", config.LvlErr, "Could not pause delayed replica %s: %s", server.URL, err)
+	if err != nil {
+		return err
+	}
+	server.setDelayedPaused(true)
+	cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Delayed replica %s paused at %s", server.URL, server.DelayedAppliedTime.Format(time.RFC3339))
+	return nil
+}
+
+// ResumeDelayedReplica restores the configured delay and restarts the replication
+func (server *ServerMonitor) ResumeDelayedReplica() error {
+	cluster := server.ClusterGroup
+	if !server.IsDelayed {
+		return ErrNotDelayedReplica
+	}
+	logs, err := server.SetReplicationDelay(cluster.Conf.HostsDelayedTime)
+	cluster.LogSQL(logs, err, server.URL, "DelayedReplica", config.LvlErr, "Could not resume delayed replica %s: %s", server.URL, err)
+	if err != nil {
+		return err
+	}
+	server.setDelayedPaused(false)
+	cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Delayed replica %s resumed with delay %d", server.URL, cluster.Conf.HostsDelayedTime)
+	return nil
+}
+
+// FastForwardDelayedReplicaToGtid applies the relay logs up to and including the given GTID position,
+// the SQL thread stays stopped once reached until the delayed replica is resumed
+func (server *ServerMonitor) FastForwardDelayedReplicaToGtid(gtid string) error {
+	cluster := server.ClusterGroup
+	if !server.IsDelayed {
+		return ErrNotDelayedReplica
+	}
+	if server.DBVersion == nil || !dbhelper.IsValidGtidSet(gtid, server.DBVersion) {
+		return ErrDelayedInvalidGtid
+	}
+	if _, err := server.stopDelayedReplica(); err != nil {
+		return err
+	}
+	logs, err := dbhelper.StartSlaveUntilGtid(server.Conn, gtid, cluster.Conf.MasterConn, server.DBVersion)
+	cluster.LogSQL(logs, err, server.URL, "DelayedReplica", config.LvlErr, "Could not fast-forward delayed replica %s: %s", server.URL, err)
+	if err != nil {
+		return err
+	}
+	server.setDelayedPaused(true)
+	server.DelayedAppliedTime = time.Time{}
+	cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Delayed replica %s fast-forward until GTID %s", server.URL, gtid)
+	return nil
+}
+
+// FastForwardDelayedReplicaToTimestamp applies the relay logs up to the last master event before
+// the given time. The master binary logs are used to translate the time into coordinates.
+func (server *ServerMonitor) FastForwardDelayedReplicaToTimestamp(ts time.Time) error {
+	cluster := server.ClusterGroup
+	if !server.IsDelayed {
+		return ErrNotDelayedReplica
+	}
+	dr := server.GetDelayedReplica()
+	if ts.Before(dr.RecoverableFrom) || ts.After(time.Now()) {
+		return ErrDelayedTimestampReach
+	}
+	master := cluster.GetMaster()
+	if master == nil || master.IsDown() {
+		return errors.New("No master found to resolve timestamp, use a GTID instead")
+	}
+
+	end := config.ReadBinaryLogsBoundary{UseTimestamp: true, Timestamp: ts}
+	for _, key := range master.BinaryLogFiles.GetKeys() {
+		binlog := master.BinaryLogFiles.Get(key)
+		if binlog.Start <= ts.Unix() {
+			end.Filename = binlog.Filename
+		}
+	}
+	if end.Filename == "" {
+		return fmt.Errorf("No binary log found on master %s for %s", master.URL, ts.Format(time.RFC3339))
+	}
+	err := master.GetBinlogPositionFromTimestamp(4, &end)
+	if err != nil {
+		return err
+	}
+
+	if _, err := server.stopDelayedReplica(); err != nil {
+		return err
+	}
+	logs, err := dbhelper.StartSlaveUntilPos(server.Conn, end.Filename, strconv.FormatInt(end.Position, 10), cluster.Conf.MasterConn, server.DBVersion)
+	cluster.LogSQL(logs, err, server.URL, "DelayedReplica", config.LvlErr, "Could not fast-forward delayed replica %s: %s", server.URL, err)
+	if err != nil {
+		return err
+	}
+	server.setDelayedPaused(true)
+	server.DelayedAppliedTime = ts
+	cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Delayed replica %s fast-forward until %s (%s:%d)", server.URL, ts.Format(time.RFC3339), end.Filename, end.Position)
+	return nil
+}
+
+// stopDelayedReplica stops the replication and removes the delay before a START SLAVE UNTIL
+func (server *ServerMonitor) stopDelayedReplica() (string, error) {
+	cluster := server.ClusterGroup
+	if server.Conn == nil {
+		return "", ErrDelayedNoConnection
+	}
+	logs, err := server.StopSlave()
+	cluster.LogSQL(logs, err, server.URL, "DelayedReplica", config.LvlErr, "Could not stop replication on delayed replica %s: %s", server.URL, err)
+	if err != nil {
+		return logs, err
+	}
+	logs, err = dbhelper.ChangeMasterDelay(server.Conn, 0, cluster.Conf.MasterConn, server.DBVersion)
+	cluster.LogSQL(logs, err, server.URL, "DelayedReplica", config.LvlErr, "Could not remove delay on delayed replica %s: %s", server.URL, err)
+	return logs, err
+}
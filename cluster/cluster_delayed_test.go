@@ -0,0 +1,92 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/signal18/replication-manager/utils/dbhelper"
+	"github.com/signal18/replication-manager/utils/state"
+	"github.com/signal18/replication-manager/utils/version"
+)
+
+func TestFastForwardDelayedReplicaInvalidGtid(t *testing.T) {
+	cluster := &Cluster{Name: "c1"}
+	mariadb, _ := version.NewVersion("MariaDB", 10, 11, 6)
+	mysql, _ := version.NewVersion("MySQL", 8, 0, 36)
+	cases := []struct {
+		v    *version.Version
+		gtid string
+	}{
+		{mariadb, "0-1-100' UNTIL master_gtid_pos='0-1-1"},
+		{mariadb, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-3"},
+		{mysql, "3e11fa47-71ca-11e1-9e33-c80aa9429562:1' FOR CHANNEL 'x"},
+		{mysql, "0-1-100"},
+		{nil, "0-1-100"},
+	}
+	for _, c := range cases {
+		// no connection, an accepted position would fail later on stopping the replica
+		server := &ServerMonitor{URL: "db2:3306", ClusterGroup: cluster, IsDelayed: true, DBVersion: c.v}
+		if err := server.FastForwardDelayedReplicaToGtid(c.gtid); err != ErrDelayedInvalidGtid {
+			t.Errorf("Expected GTID %q to be refused, got %v", c.gtid, err)
+		}
+	}
+	server := &ServerMonitor{URL: "db2:3306", ClusterGroup: cluster, DBVersion: mariadb}
+	if err := server.FastForwardDelayedReplicaToGtid("0-1-100"); err != ErrNotDelayedReplica {
+		t.Errorf("Expected not delayed replica error, got %v", err)
+	}
+}
+
+func TestCheckReplicationDelayedPaused(t *testing.T) {
+	cluster := &Cluster{Name: "c1", StateMachine: new(state.StateMachine)}
+	cluster.StateMachine.Init()
+	server := &ServerMonitor{URL: "db2:3306", ClusterGroup: cluster, IsDelayed: true, IsDelayedPaused: true}
+	server.Replications = []dbhelper.SlaveStatus{{
+		SlaveSQLRunning: sql.NullString{String: "No", Valid: true},
+		SlaveIORunning:  sql.NullString{String: "Yes", Valid: true},
+	}}
+	server.CheckReplication()
+	if server.State != stateSlave {
+		t.Errorf("Expected paused delayed replica to be healthy, got %s", server.State)
+	}
+	server.Replications[0].LastSQLErrno = sql.NullString{String: "1062", Valid: true}
+	server.CheckReplication()
+	if server.State != stateSlaveErr {
+		t.Errorf("Expected SQL error on a paused delayed replica to be reported, got %s", server.State)
+	}
+}
+
+func TestDelayedPausedPersistence(t *testing.T) {
+	dir := t.TempDir()
+	cluster := &Cluster{Name: "c1", WorkingDir: dir + "/c1", StateMachine: new(state.StateMachine)}
+	cluster.StateMachine.Init()
+	cluster.Conf.WorkingDir = dir
+	if err := os.MkdirAll(cluster.WorkingDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	server := &ServerMonitor{URL: "db2:3306", ClusterGroup: cluster, IsDelayed: true}
+	server.setDelayedPaused(true)
+
+	restarted := &Cluster{Name: "c1", WorkingDir: dir + "/c1", StateMachine: new(state.StateMachine)}
+	restarted.StateMachine.Init()
+	if err := restarted.GetPersitentState(); err != nil {
+		t.Fatal(err)
+	}
+	server = &ServerMonitor{URL: "db2:3306", ClusterGroup: restarted, IsDelayed: true}
+	if !server.isInDelayedPausedHosts() {
+		t.Fatalf("Expected paused state to survive a restart, got %v", restarted.GetDelayedPausedHosts())
+	}
+	server.setDelayedPaused(false)
+	if server.IsDelayedPaused || len(restarted.GetDelayedPausedHosts()) != 0 {
+		t.Errorf("Expected resumed replica to leave the paused hosts, got %v", restarted.GetDelayedPausedHosts())
+	}
+}
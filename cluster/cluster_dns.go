@@ -0,0 +1,57 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"strconv"
+
+	"github.com/signal18/replication-manager/router/dnsserver"
+)
+
+func (cluster *Cluster) getDNSBackend(server *ServerMonitor) dnsserver.Backend {
+	port, _ := strconv.Atoi(server.Port)
+	return dnsserver.Backend{Id: cluster.Name + "-" + server.Id, Host: server.Host, Port: port}
+}
+
+// GetDNSReadWriteBackends returns the leader published as <cluster>-rw, the master is read
+// on each query so the record flips as soon as a failover elects a new one
+func (cluster *Cluster) GetDNSReadWriteBackends() []dnsserver.Backend {
+	backends := []dnsserver.Backend{}
+	master := cluster.GetMaster()
+	if master == nil || master.IsDown() || master.IsMaintenance {
+		return backends
+	}
+	return append(backends, cluster.getDNSBackend(master))
+}
+
+// GetDNSReadBackends returns the replicas published as <cluster>-ro, lagging, broken, ignored
+// and maintenance replicas are excluded
+func (cluster *Cluster) GetDNSReadBackends() []dnsserver.Backend {
+	backends := []dnsserver.Backend{}
+	for _, server := range cluster.Servers {
+		if server.IsDown() || server.IsMaintenance || server.IsIgnored() {
+			continue
+		}
+		if server.IsMaster() {
+			if cluster.Conf.PRXServersReadOnMaster {
+				backends = append(backends, cluster.getDNSBackend(server))
+			}
+			continue
+		}
+		if server.State != stateSlave && server.State != stateRelay && server.State != stateWsrep {
+			continue
+		}
+		if cluster.Conf.DNSServerReadMaxDelay > 0 && server.GetReplicationDelay() > cluster.Conf.DNSServerReadMaxDelay {
+			continue
+		}
+		backends = append(backends, cluster.getDNSBackend(server))
+	}
+	return backends
+}
@@ -0,0 +1,254 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/signal18/replication-manager/config"
+	"github.com/signal18/replication-manager/utils/dbhelper"
+)
+
+const (
+	drainClientIdle     = "idle"
+	drainClientActive   = "active"
+	drainClientFinished = "finished"
+	drainClientKilled   = "killed"
+)
+
+// DrainClient is a client session found on the old leader during a switchover drain
+type DrainClient struct {
+	Id      uint64  `json:"id"`
+	User    string  `json:"user"`
+	Host    string  `json:"host"`
+	Db      string  `json:"db"`
+	Command string  `json:"command"`
+	Time    float64 `json:"time"`
+	State   string  `json:"state"`
+	Info    string  `json:"info"`
+	InTrx   bool    `json:"inTrx"`
+	Status  string  `json:"status"`
+}
+
+// DrainStatus reports the progress of the last switchover drain
+type DrainStatus struct {
+	Server   string        `json:"server"`
+	Running  bool          `json:"running"`
+	Drained  bool          `json:"drained"`
+	Start    int64         `json:"start"`
+	Deadline int64         `json:"deadline"`
+	End      int64         `json:"end"`
+	Active   int           `json:"active"`
+	Finished int           `json:"finished"`
+	Killed   int           `json:"killed"`
+	Clients  []DrainClient `json:"clients"`
+	server   *ServerMonitor
+}
+
+// GetSwitchoverDrain returns a copy of the last switchover drain progress
+func (cluster *Cluster) GetSwitchoverDrain() DrainStatus {
+	cluster.switchoverDrainMutex.Lock()
+	defer cluster.switchoverDrainMutex.Unlock()
+	drain := cluster.switchoverDrain
+	drain.Clients = append([]DrainClient{}, cluster.switchoverDrain.Clients...)
+	drain.server = nil
+	return drain
+}
+
+// isDrainClient filters out replication, system and monitoring sessions
+func (cluster *Cluster) isDrainClient(p dbhelper.Processlist) bool {
+	if p.User == "system user" || p.User == "event_scheduler" || p.User == cluster.GetDbUser() {
+		return false
+	}
+	if strings.HasPrefix(p.Command, "Binlog Dump") || p.Command == "Daemon" || p.Command == "Killed" {
+		return false
+	}
+	return true
+}
+
+// getDrainClients returns the client sessions of the server and the number still in-flight
+func (cluster *Cluster) getDrainClients(server *ServerMonitor) (map[uint64]DrainClient, int, error) {
+	pl, logs, err := dbhelper.GetProcesslist(server.Conn, server.DBVersion)
+	cluster.LogSQL(logs, err, server.URL, "Drain", config.LvlErr, "Could not get processlist on %s: %s", server.URL, err)
+	if err != nil {
+		return nil, 0, err
+	}
+	trx, logs, err := dbhelper.GetOpenTrxThreads(server.Conn)
+	cluster.LogSQL(logs, err, server.URL, "Drain", config.LvlErr, "Could not get open transactions on %s: %s", server.URL, err)
+	if err != nil {
+		return nil, 0, err
+	}
+	inTrx := make(map[uint64]bool)
+	for _, id := range trx {
+		inTrx[id] = true
+	}
+	clients := make(map[uint64]DrainClient)
+	active := 0
+	for _, p := range pl {
+		if !cluster.isDrainClient(p) {
+			continue
+		}
+		c := DrainClient{
+			Id:      p.Id,
+			User:    p.User,
+			Host:    p.Host,
+			Db:      p.Db.String,
+			Command: p.Command,
+			Time:    p.Time.Float64,
+			State:   p.State.String,
+			Info:    p.Info.String,
+			InTrx:   inTrx[p.Id],
+			Status:  drainClientIdle,
+		}
+		if c.InTrx || c.Command != "Sleep" {
+			c.Status = drainClientActive
+			active++
+		}
+		clients[c.Id] = c
+	}
+	return clients, active, nil
+}
+
+// updateDrainProgress merges a fresh processlist snapshot into the drain status, sessions
+// that were active and are gone or idle are reported finished
+func (cluster *Cluster) updateDrainProgress(clients map[uint64]DrainClient) {
+	cluster.switchoverDrainMutex.Lock()
+	defer cluster.switchoverDrainMutex.Unlock()
+	active, finished := 0, 0
+	for i, c := range cluster.switchoverDrain.Clients {
+		if c.Status != drainClientActive {
+			if c.Status == drainClientFinished {
+				finished++
+			}
+			continue
+		}
+		n, ok := clients[c.Id]
+		if !ok || n.Status == drainClientIdle {
+			cluster.switchoverDrain.Clients[i].Status = drainClientFinished
+			finished++
+			continue
+		}
+		cluster.switchoverDrain.Clients[i] = n
+		active++
+	}
+	for id, n := range clients {
+		known := false
+		for _, c := range cluster.switchoverDrain.Clients {
+			if c.Id == id {
+				known = true
+				break
+			}
+		}
+		if !known && n.Status == drainClientActive {
+			cluster.switchoverDrain.Clients = append(cluster.switchoverDrain.Clients, n)
+			active++
+		}
+	}
+	cluster.switchoverDrain.Active = active
+	cluster.switchoverDrain.Finished = finished
+}
+
+// DrainServer soft offlines the leader in proxies and waits for in-flight client transactions
+// until switchover-drain-timeout, remaining sessions are killed when switchover-drain-kill is set
+func (cluster *Cluster) DrainServer(server *ServerMonitor) bool {
+	if server == nil || server.Conn == nil {
+		return false
+	}
+	now := time.Now()
+	cluster.switchoverDrainMutex.Lock()
+	cluster.switchoverDrain.Server = server.URL
+	cluster.switchoverDrain.server = server
+	cluster.switchoverDrain.Running = true
+	cluster.switchoverDrain.Drained = true
+	cluster.switchoverDrain.Start = now.Unix()
+	cluster.switchoverDrain.Deadline = now.Add(time.Duration(cluster.Conf.SwitchDrainTimeout) * time.Second).Unix()
+	cluster.switchoverDrain.End = 0
+	cluster.switchoverDrain.Active = 0
+	cluster.switchoverDrain.Finished = 0
+	cluster.switchoverDrain.Killed = 0
+	cluster.switchoverDrain.Clients = nil
+	cluster.switchoverDrainMutex.Unlock()
+	defer func() {
+		cluster.switchoverDrainMutex.Lock()
+		cluster.switchoverDrain.Running = false
+		cluster.switchoverDrain.End = time.Now().Unix()
+		cluster.switchoverDrainMutex.Unlock()
+	}()
+
+	cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Draining connections on %s for %ds", server.URL, cluster.Conf.SwitchDrainTimeout)
+	cluster.drainProxies(server, true)
+
+	deadline := time.Now().Add(time.Duration(cluster.Conf.SwitchDrainTimeout) * time.Second)
+	for {
+		clients, active, err := cluster.getDrainClients(server)
+		if err != nil {
+			return false
+		}
+		cluster.updateDrainProgress(clients)
+		if active == 0 {
+			cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Drain completed on %s, no more in-flight transactions", server.URL)
+			return true
+		}
+		if time.Now().After(deadline) {
+			break
+		}
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Draining %d in-flight client sessions on %s", active, server.URL)
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	if !cluster.Conf.SwitchDrainKill {
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlErr, "Drain timeout reached on %s with in-flight transactions, cancel switchover", server.URL)
+		return false
+	}
+	cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlWarn, "Drain timeout reached on %s, killing remaining client sessions", server.URL)
+	cluster.switchoverDrainMutex.Lock()
+	defer cluster.switchoverDrainMutex.Unlock()
+	for i, c := range cluster.switchoverDrain.Clients {
+		if c.Status != drainClientActive {
+			continue
+		}
+		logs, err := dbhelper.KillThread(server.Conn, strconv.FormatUint(c.Id, 10), server.DBVersion)
+		cluster.LogSQL(logs, err, server.URL, "Drain", config.LvlErr, "Could not kill session %d of %s@%s: %s", c.Id, c.User, c.Host, err)
+		if err == nil {
+			cluster.switchoverDrain.Clients[i].Status = drainClientKilled
+			cluster.switchoverDrain.Killed++
+			cluster.switchoverDrain.Active--
+		}
+	}
+	return true
+}
+
+// UndrainServer restores proxies routing for the last drained server, it does nothing
+// when no drain is in place
+func (cluster *Cluster) UndrainServer() {
+	cluster.switchoverDrainMutex.Lock()
+	server := cluster.switchoverDrain.server
+	drained := cluster.switchoverDrain.Drained
+	cluster.switchoverDrain.Drained = false
+	cluster.switchoverDrainMutex.Unlock()
+	if !drained || server == nil {
+		return
+	}
+	cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Restoring proxies routing for drained server %s", server.URL)
+	cluster.drainProxies(server, false)
+}
+
+func (cluster *Cluster) drainProxies(server *ServerMonitor, drain bool) {
+	for _, pri := range cluster.Proxies {
+		if prx, ok := pri.(*ProxySQLProxy); ok {
+			prx.SetDrain(server, drain)
+		}
+		if prx, ok := pri.(*HaproxyProxy); ok {
+			prx.SetDrain(server, drain)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"testing"
+
+	"github.com/signal18/replication-manager/config"
+	"github.com/signal18/replication-manager/utils/dbhelper"
+)
+
+func TestIsDrainClient(t *testing.T) {
+	cluster := &Cluster{}
+	cluster.Conf.Secrets = map[string]config.Secret{"db-servers-credential": {Value: "repman:secret"}}
+	cases := []struct {
+		p      dbhelper.Processlist
+		client bool
+	}{
+		{dbhelper.Processlist{User: "app", Command: "Query"}, true},
+		{dbhelper.Processlist{User: "app", Command: "Sleep"}, true},
+		{dbhelper.Processlist{User: "repman", Command: "Query"}, false},
+		{dbhelper.Processlist{User: "system user", Command: "Connect"}, false},
+		{dbhelper.Processlist{User: "event_scheduler", Command: "Daemon"}, false},
+		{dbhelper.Processlist{User: "repl", Command: "Binlog Dump GTID"}, false},
+		{dbhelper.Processlist{User: "app", Command: "Killed"}, false},
+	}
+	for _, c := range cases {
+		if cluster.isDrainClient(c.p) != c.client {
+			t.Errorf("isDrainClient(%s, %s) expected %v", c.p.User, c.p.Command, c.client)
+		}
+	}
+}
+
+func TestUpdateDrainProgress(t *testing.T) {
+	cluster := &Cluster{}
+	cluster.switchoverDrain.Clients = []DrainClient{
+		{Id: 1, Status: drainClientActive},
+		{Id: 2, Status: drainClientActive},
+		{Id: 3, Status: drainClientActive},
+		{Id: 4, Status: drainClientIdle},
+	}
+	// 1 is gone, 2 went idle, 3 is still running and 5 is a new transaction
+	cluster.updateDrainProgress(map[uint64]DrainClient{
+		2: {Id: 2, Status: drainClientIdle},
+		3: {Id: 3, Status: drainClientActive, Command: "Query"},
+		4: {Id: 4, Status: drainClientIdle},
+		5: {Id: 5, Status: drainClientActive},
+	})
+	drain := cluster.GetSwitchoverDrain()
+	if drain.Active != 2 || drain.Finished != 2 {
+		t.Fatalf("Expected 2 active and 2 finished, got %d active and %d finished", drain.Active, drain.Finished)
+	}
+	status := make(map[uint64]string)
+	for _, c := range drain.Clients {
+		status[c.Id] = c.Status
+	}
+	expected := map[uint64]string{1: drainClientFinished, 2: drainClientFinished, 3: drainClientActive, 4: drainClientIdle, 5: drainClientActive}
+	for id, s := range expected {
+		if status[id] != s {
+			t.Errorf("Client %d is %s, expected %s", id, status[id], s)
+		}
+	}
+	// finished clients are counted again on the next snapshot
+	cluster.updateDrainProgress(map[uint64]DrainClient{})
+	drain = cluster.GetSwitchoverDrain()
+	if drain.Active != 0 || drain.Finished != 4 {
+		t.Errorf("Expected 0 active and 4 finished, got %d active and %d finished", drain.Active, drain.Finished)
+	}
+}
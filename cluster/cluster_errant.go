@@ -0,0 +1,666 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/google/uuid"
+	"github.com/signal18/replication-manager/config"
+	"github.com/signal18/replication-manager/utils/dbhelper"
+	"github.com/signal18/replication-manager/utils/gtid"
+)
+
+const (
+	ErrantRepairInjectEmpty = "inject-empty"
+	ErrantRepairReclone     = "reclone"
+	ErrantRepairFlashback   = "flashback"
+
+	ErrantEventInsert = "insert"
+	ErrantEventUpdate = "update"
+	ErrantEventDelete = "delete"
+	ErrantEventQuery  = "query"
+
+	errantJobHistory    = 20
+	errantRepairTimeout = 2 * time.Hour
+)
+
+var (
+	ErrErrantNoGtid       = errors.New("Errant transaction repair requires MySQL GTID replication")
+	ErrErrantNoMaster     = errors.New("No master found to compare GTID executed")
+	ErrErrantNone         = errors.New("Server has no errant transaction")
+	ErrErrantJobRunning   = errors.New("An errant transaction repair job is already running")
+	ErrErrantNoConnection = errors.New("No database connection")
+)
+
+// ErrantReplica is a replica having GTIDs that were never executed on the master
+type ErrantReplica struct {
+	URL        string `json:"url"`
+	Name       string `json:"name"`
+	State      string `json:"state"`
+	ErrantGtid string `json:"errantGtid"`
+	Count      int    `json:"count"`
+	Error      string `json:"error,omitempty"`
+}
+
+// ErrantEvent is an event of an errant transaction read from the replica binary logs.
+// Row images are kept to build the flashback of the transaction.
+type ErrantEvent struct {
+	Gtid      string    `json:"gtid"`
+	File      string    `json:"file"`
+	Pos       uint32    `json:"pos"`
+	Timestamp time.Time `json:"timestamp"`
+	Type      string    `json:"type"`
+	Schema    string    `json:"schema,omitempty"`
+	Table     string    `json:"table,omitempty"`
+	Query     string    `json:"query,omitempty"`
+	Rows      int       `json:"rows"`
+
+	rows     [][]interface{}
+	unsigned map[int]bool
+}
+
+// ErrantRepairJob tracks the repair of the errant transactions of a replica
+type ErrantRepairJob struct {
+	ID         string    `json:"id"`
+	Method     string    `json:"method"`
+	Server     string    `json:"server"`
+	ErrantGtid string    `json:"errantGtid"`
+	Status     string    `json:"status"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end,omitempty"`
+	Steps      []string  `json:"steps"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// ErrantStatus is the list of replicas with errant transactions and the last repair jobs, newest first
+type ErrantStatus struct {
+	Enabled  bool              `json:"enabled"`
+	Master   string            `json:"master"`
+	Replicas []ErrantReplica   `json:"replicas"`
+	Jobs     []ErrantRepairJob `json:"jobs"`
+}
+
+func (cluster *Cluster) GetErrantRecloneMethod() string {
+	switch cluster.Conf.RplErrantRepairRecloneMethod {
+	case StagingRefreshLogicalBackup, StagingRefreshClone:
+		return cluster.Conf.RplErrantRepairRecloneMethod
+	}
+	return StagingRefreshPhysicalBackup
+}
+
+func (cluster *Cluster) GetErrantTransactions() ErrantStatus {
+	st := ErrantStatus{
+		Enabled:  cluster.Conf.RplCheckErrantTrx,
+		Replicas: []ErrantReplica{},
+		Jobs:     []ErrantRepairJob{},
+	}
+	master := cluster.GetMaster()
+	if master != nil {
+		st.Master = master.URL
+		for _, server := range cluster.Servers {
+			if server == nil || server.URL == master.URL || server.IsFailed() || server.IsIgnored() || !server.HasMySQLGTID() {
+				continue
+			}
+			er := ErrantReplica{URL: server.URL, Name: server.Name, State: server.State}
+			errant, err := server.GetErrantGtidSet()
+			if err != nil {
+				er.Error = err.Error()
+				st.Replicas = append(st.Replicas, er)
+				continue
+			}
+			if errant == "" {
+				continue
+			}
+			er.ErrantGtid = errant
+			if gtids, err := gtid.ExpandMySQLGtidSet(errant, cluster.Conf.RplErrantRepairMaxTrx); err == nil {
+				er.Count = len(gtids)
+			} else {
+				er.Error = err.Error()
+			}
+			st.Replicas = append(st.Replicas, er)
+		}
+	}
+	cluster.errantMutex.Lock()
+	defer cluster.errantMutex.Unlock()
+	for i := len(cluster.errantJobs) - 1; i >= 0; i-- {
+		job := cluster.errantJobs[i]
+		job.Steps = append([]string{}, job.Steps...)
+		st.Jobs = append(st.Jobs, job)
+	}
+	return st
+}
+
+// GetErrantGtidSet returns the GTIDs executed on the server but not on the master
+func (server *ServerMonitor) GetErrantGtidSet() (string, error) {
+	cluster := server.ClusterGroup
+	master := cluster.GetMaster()
+	if master == nil || master.IsDown() || master.Conn == nil {
+		return "", ErrErrantNoMaster
+	}
+	if !master.HasMySQLGTID() || !server.HasMySQLGTID() {
+		return "", ErrErrantNoGtid
+	}
+	if server.Conn == nil {
+		return "", ErrErrantNoConnection
+	}
+	gtidMaster, logs, err := dbhelper.GetGtidExecuted(master.Conn)
+	cluster.LogSQL(logs, err, master.URL, "ErrantTrx", config.LvlErr, "Could not get GTID executed on %s: %s", master.URL, err)
+	if err != nil {
+		return "", err
+	}
+	gtidSlave, logs, err := dbhelper.GetGtidExecuted(server.Conn)
+	cluster.LogSQL(logs, err, server.URL, "ErrantTrx", config.LvlErr, "Could not get GTID executed on %s: %s", server.URL, err)
+	if err != nil {
+		return "", err
+	}
+	errant, logs, err := dbhelper.GtidSubtract(server.Conn, gtidSlave, gtidMaster)
+	cluster.LogSQL(logs, err, server.URL, "ErrantTrx", config.LvlErr, "Could not compare GTID executed of %s: %s", server.URL, err)
+	if err != nil {
+		return "", err
+	}
+	return strings.NewReplacer("\n", "", " ", "").Replace(errant), nil
+}
+
+// GetErrantEvents reads the events of the errant transactions from the server binary logs
+func (server *ServerMonitor) GetErrantEvents() ([]ErrantEvent, error) {
+	errant, err := server.GetErrantGtidSet()
+	if err != nil {
+		return nil, err
+	}
+	if errant == "" {
+		return nil, ErrErrantNone
+	}
+	return server.readErrantEvents(errant)
+}
+
+// readErrantEvents connects as a replica of the server with all its GTIDs but the errant ones,
+// the server then only streams the errant transactions
+func (server *ServerMonitor) readErrantEvents(errant string) ([]ErrantEvent, error) {
+	cluster := server.ClusterGroup
+	gtids, err := gtid.ExpandMySQLGtidSet(errant, cluster.Conf.RplErrantRepairMaxTrx)
+	if err != nil {
+		return nil, err
+	}
+	wanted := make(map[string]bool, len(gtids))
+	for _, g := range gtids {
+		wanted[strings.ToLower(g)] = true
+	}
+	executed, _, err := dbhelper.GetGtidExecuted(server.Conn)
+	if err != nil {
+		return nil, err
+	}
+	start, _, err := dbhelper.GtidSubtract(server.Conn, executed, errant)
+	if err != nil {
+		return nil, err
+	}
+	gset, err := mysql.ParseMysqlGTIDSet(strings.NewReplacer("\n", "", " ", "").Replace(start))
+	if err != nil {
+		return nil, err
+	}
+
+	port, _ := strconv.Atoi(server.Port)
+	cfg := replication.BinlogSyncerConfig{
+		ServerID: uint32(cluster.Conf.CheckBinServerId),
+		Flavor:   server.DBVersion.Flavor,
+		Host:     server.Host,
+		Port:     uint16(port),
+		User:     server.User,
+		Password: server.Pass,
+	}
+	if cluster.HaveDBTLSCert {
+		cfg.TLSConfig = cluster.tlsconf
+	}
+	syncer := replication.NewBinlogSyncer(cfg)
+	defer syncer.Close()
+
+	streamer, err := syncer.StartSyncGTID(gset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start binlog sync: %v", err)
+	}
+
+	events := make([]ErrantEvent, 0)
+	found := make(map[string]bool, len(gtids))
+	file := ""
+	current := ""
+	for len(found) < len(wanted) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		ev, err := streamer.GetEvent(ctx)
+		cancel()
+		if err == context.DeadlineExceeded {
+			break
+		} else if err != nil {
+			return events, fmt.Errorf("failed to get binlog event: %v", err)
+		}
+		ee := ErrantEvent{Gtid: current, File: file, Pos: ev.Header.LogPos, Timestamp: time.Unix(int64(ev.Header.Timestamp), 0)}
+		switch e := ev.Event.(type) {
+		case *replication.RotateEvent:
+			file = string(e.NextLogName)
+		case *replication.GTIDEvent:
+			current = ""
+			u, err := uuid.FromBytes(e.SID)
+			if err == nil && wanted[fmt.Sprintf("%s:%d", u.String(), e.GNO)] {
+				current = fmt.Sprintf("%s:%d", u.String(), e.GNO)
+			}
+		case *replication.XIDEvent:
+			if current != "" {
+				found[current] = true
+			}
+			current = ""
+		case *replication.QueryEvent:
+			if current == "" {
+				continue
+			}
+			query := string(e.Query)
+			switch strings.ToUpper(query) {
+			case "BEGIN":
+			case "COMMIT":
+				found[current] = true
+				current = ""
+			default:
+				// DDL are committed by the query event itself
+				ee.Type = ErrantEventQuery
+				ee.Schema = string(e.Schema)
+				ee.Query = query
+				events = append(events, ee)
+				found[current] = true
+				current = ""
+			}
+		case *replication.RowsEvent:
+			if current == "" {
+				continue
+			}
+			switch ev.Header.EventType {
+			case replication.WRITE_ROWS_EVENTv1, replication.WRITE_ROWS_EVENTv2:
+				ee.Type = ErrantEventInsert
+			case replication.UPDATE_ROWS_EVENTv1, replication.UPDATE_ROWS_EVENTv2:
+				ee.Type = ErrantEventUpdate
+			case replication.DELETE_ROWS_EVENTv1, replication.DELETE_ROWS_EVENTv2:
+				ee.Type = ErrantEventDelete
+			default:
+				continue
+			}
+			ee.Schema = string(e.Table.Schema)
+			ee.Table = string(e.Table.Table)
+			ee.rows = e.Rows
+			ee.unsigned = e.Table.UnsignedMap()
+			ee.Rows = len(e.Rows)
+			if ee.Type == ErrantEventUpdate {
+				ee.Rows = len(e.Rows) / 2
+			}
+			events = append(events, ee)
+		}
+	}
+	if len(found) < len(wanted) {
+		return events, fmt.Errorf("Found %d of %d errant transactions in the binary logs of %s", len(found), len(wanted), server.URL)
+	}
+	return events, nil
+}
+
+// StartErrantRepairJob repairs the errant transactions of a replica in background and returns the job to follow
+func (cluster *Cluster) StartErrantRepairJob(server *ServerMonitor, method string) (ErrantRepairJob, error) {
+	switch method {
+	case ErrantRepairInjectEmpty, ErrantRepairReclone, ErrantRepairFlashback:
+	default:
+		return ErrantRepairJob{}, fmt.Errorf("Unknown errant transaction repair method %s", method)
+	}
+	errant, err := server.GetErrantGtidSet()
+	if err != nil {
+		return ErrantRepairJob{}, err
+	}
+	if errant == "" {
+		return ErrantRepairJob{}, ErrErrantNone
+	}
+	cluster.errantMutex.Lock()
+	for _, job := range cluster.errantJobs {
+		if job.Status == JobStatusRunning {
+			cluster.errantMutex.Unlock()
+			return ErrantRepairJob{}, ErrErrantJobRunning
+		}
+	}
+	now := time.Now()
+	job := ErrantRepairJob{
+		ID:         strconv.FormatInt(now.UnixNano(), 36),
+		Method:     method,
+		Server:     server.URL,
+		ErrantGtid: errant,
+		Status:     JobStatusRunning,
+		Start:      now,
+		Steps:      []string{},
+	}
+	cluster.errantJobs = append(cluster.errantJobs, job)
+	if len(cluster.errantJobs) > errantJobHistory {
+		cluster.errantJobs = cluster.errantJobs[len(cluster.errantJobs)-errantJobHistory:]
+	}
+	cluster.errantMutex.Unlock()
+
+	go cluster.runErrantRepairJob(job.ID, method, server, errant)
+	return job, nil
+}
+
+func (cluster *Cluster) runErrantRepairJob(id string, method string, server *ServerMonitor, errant string) {
+	var err error
+	switch method {
+	case ErrantRepairInjectEmpty:
+		err = cluster.errantInjectEmpty(id, server, errant)
+	case ErrantRepairReclone:
+		err = cluster.errantReclone(id, server)
+	case ErrantRepairFlashback:
+		err = cluster.errantFlashback(id, server, errant)
+	}
+	cluster.errantMutex.Lock()
+	defer cluster.errantMutex.Unlock()
+	for i := range cluster.errantJobs {
+		if cluster.errantJobs[i].ID == id {
+			cluster.errantJobs[i].End = time.Now()
+			cluster.errantJobs[i].Status = JobStatusSuccess
+			if err != nil {
+				cluster.errantJobs[i].Status = JobStatusFailed
+				cluster.errantJobs[i].Error = err.Error()
+			}
+		}
+	}
+	if err != nil {
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModTopology, config.LvlErr, "Errant transaction repair %s of %s failed: %s", method, server.URL, err)
+	} else {
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModTopology, config.LvlInfo, "Errant transaction repair %s of %s done", method, server.URL)
+	}
+}
+
+func (cluster *Cluster) errantStep(id string, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModTopology, config.LvlInfo, "Errant transaction repair: %s", msg)
+	cluster.errantMutex.Lock()
+	defer cluster.errantMutex.Unlock()
+	for i := range cluster.errantJobs {
+		if cluster.errantJobs[i].ID == id {
+			cluster.errantJobs[i].Steps = append(cluster.errantJobs[i].Steps, time.Now().Format("15:04:05")+" "+msg)
+		}
+	}
+}
+
+// errantInjectEmpty commits an empty transaction for each errant GTID on the master,
+// the errant changes are kept and the GTIDs are replicated to all the replicas
+func (cluster *Cluster) errantInjectEmpty(id string, server *ServerMonitor, errant string) error {
+	master := cluster.GetMaster()
+	if master == nil || master.Conn == nil {
+		return ErrErrantNoMaster
+	}
+	gtids, err := gtid.ExpandMySQLGtidSet(errant, cluster.Conf.RplErrantRepairMaxTrx)
+	if err != nil {
+		return err
+	}
+	cluster.errantStep(id, "Inject %d empty transactions on master %s for %s", len(gtids), master.URL, errant)
+	logs, err := dbhelper.InjectEmptyTransactions(master.Conn, gtids)
+	cluster.LogSQL(logs, err, master.URL, "ErrantTrx", config.LvlErr, "Could not inject empty transactions on %s: %s", master.URL, err)
+	if err != nil {
+		return fmt.Errorf("Inject empty transactions failed: %s", err)
+	}
+	return cluster.errantCheckRepaired(id, server)
+}
+
+// errantReclone restores the replica from the master data with the reclone method
+func (cluster *Cluster) errantReclone(id string, server *ServerMonitor) error {
+	master := cluster.GetMaster()
+	if master == nil {
+		return ErrErrantNoMaster
+	}
+	method := cluster.GetErrantRecloneMethod()
+	cluster.errantStep(id, "Re-clone %s from %s with %s", server.URL, master.URL, method)
+	var err error
+	switch method {
+	case StagingRefreshLogicalBackup:
+		err = server.JobReseedLogicalBackup("default")
+	case StagingRefreshPhysicalBackup:
+		err = server.JobReseedPhysicalBackup("default")
+	case StagingRefreshClone:
+		err = cluster.RejoinClone(master, server)
+	}
+	if err != nil {
+		return err
+	}
+	if err := cluster.errantWaitSync(id, server); err != nil {
+		return err
+	}
+	return cluster.errantCheckRepaired(id, server)
+}
+
+// errantWaitSync waits for the end of the restore, then for replication to restart and catch up with the master,
+// the clone rejoin returns without reseeding state while the replica is still restarting
+func (cluster *Cluster) errantWaitSync(id string, server *ServerMonitor) error {
+	cluster.errantStep(id, "Waiting for %s to be restored and to catch up with the master", server.URL)
+	deadline := time.Now().Add(errantRepairTimeout)
+	for {
+		if !server.HasAnyReseedingState() && server.IsSlave && server.IsSQLThreadRunning() && server.GetReplicationDelay() <= cluster.Conf.FailMaxDelay {
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Timeout waiting for %s to catch up with the master", server.URL)
+		}
+		time.Sleep(5 * time.Second)
+	}
+	cluster.errantStep(id, "Server %s in sync with a delay of %d", server.URL, server.GetReplicationDelay())
+	return nil
+}
+
+// errantFlashback reverts the row events of the errant transactions on the replica without
+// binary logging, then removes the errant GTIDs from the replica GTID executed
+func (cluster *Cluster) errantFlashback(id string, server *ServerMonitor, errant string) error {
+	if !server.HasBinlogRow() {
+		return errors.New("Flashback requires binlog_format ROW")
+	}
+	cluster.errantStep(id, "Read errant transactions %s from the binary logs of %s", errant, server.URL)
+	events, err := server.readErrantEvents(errant)
+	if err != nil {
+		return err
+	}
+	queries := make([]string, 0)
+	args := make([][]interface{}, 0)
+	columns := make(map[string][]string)
+	// Revert newest events first
+	for i := len(events) - 1; i >= 0; i-- {
+		ev := events[i]
+		if ev.Type == ErrantEventQuery {
+			return fmt.Errorf("Flashback is not possible for statement %s at %s:%d, re-clone the replica", ev.Query, ev.File, ev.Pos)
+		}
+		key := ev.Schema + "." + ev.Table
+		if _, ok := columns[key]; !ok {
+			cols, logs, err := dbhelper.GetTableColumnNames(server.Conn, ev.Schema, ev.Table)
+			cluster.LogSQL(logs, err, server.URL, "ErrantTrx", config.LvlErr, "Could not get columns of %s on %s: %s", key, server.URL, err)
+			if err != nil {
+				return err
+			}
+			columns[key] = cols
+		}
+		q, a, err := ev.flashbackQueries(columns[key])
+		if err != nil {
+			return err
+		}
+		queries = append(queries, q...)
+		args = append(args, a...)
+	}
+	cluster.errantStep(id, "Flashback %d row events with %d statements", len(events), len(queries))
+
+	cluster.errantStep(id, "Stop replication on %s", server.URL)
+	if _, err := server.StopSlave(); err != nil {
+		return fmt.Errorf("Stop replication failed: %s", err)
+	}
+	// Replication is restarted whatever step fails, the replica must not stay stopped
+	restarted := false
+	defer func() {
+		if !restarted {
+			cluster.errantStep(id, "Restart replication on %s after failure", server.URL)
+			logs, err := server.StartSlave()
+			cluster.LogSQL(logs, err, server.URL, "ErrantTrx", config.LvlErr, "Could not restart replication on %s: %s", server.URL, err)
+		}
+	}()
+	if server.IsReadOnly() {
+		cluster.errantStep(id, "Set read write on %s", server.URL)
+		if err := server.SetReadWrite(); err != nil {
+			return fmt.Errorf("Set read write failed: %s", err)
+		}
+		defer func() {
+			cluster.errantStep(id, "Set read only on %s", server.URL)
+			server.SetReadOnly()
+		}()
+	}
+	if err := server.errantApplyNoBinlog(queries, args); err != nil {
+		return fmt.Errorf("Flashback failed: %s", err)
+	}
+
+	executed, _, err := dbhelper.GetGtidExecuted(server.Conn)
+	if err != nil {
+		return err
+	}
+	purged, _, err := dbhelper.GtidSubtract(server.Conn, executed, errant)
+	if err != nil {
+		return err
+	}
+	cluster.errantStep(id, "Reset master on %s to remove errant GTIDs", server.URL)
+	logs, err := server.ResetMaster()
+	cluster.LogSQL(logs, err, server.URL, "ErrantTrx", config.LvlErr, "Could not reset master on %s: %s", server.URL, err)
+	if err != nil {
+		return fmt.Errorf("Reset master failed: %s", err)
+	}
+	cluster.errantStep(id, "Set gtid_purged to %s on %s", purged, server.URL)
+	logs, err = dbhelper.SetGtidPurged(server.Conn, strings.NewReplacer("\n", "", " ", "").Replace(purged))
+	cluster.LogSQL(logs, err, server.URL, "ErrantTrx", config.LvlErr, "Could not set gtid_purged on %s: %s", server.URL, err)
+	if err != nil {
+		return fmt.Errorf("Set gtid_purged failed: %s", err)
+	}
+	cluster.errantStep(id, "Start replication on %s", server.URL)
+	restarted = true
+	if _, err := server.StartSlave(); err != nil {
+		return fmt.Errorf("Start replication failed: %s", err)
+	}
+	return cluster.errantCheckRepaired(id, server)
+}
+
+// errantApplyNoBinlog runs the flashback statements in a single transaction with sql_log_bin disabled
+func (server *ServerMonitor) errantApplyNoBinlog(queries []string, args [][]interface{}) error {
+	if server.Conn == nil {
+		return ErrErrantNoConnection
+	}
+	ctx := context.Background()
+	conn, err := server.Conn.Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "SET sql_log_bin=0"); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, "SET sql_log_bin=1")
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for i, query := range queries {
+		res, err := tx.Exec(query, args[i]...)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if n != 1 {
+			tx.Rollback()
+			return fmt.Errorf("Row not found for %s, the replica data changed since the errant transaction", query)
+		}
+	}
+	return tx.Commit()
+}
+
+func (cluster *Cluster) errantCheckRepaired(id string, server *ServerMonitor) error {
+	errant, err := server.GetErrantGtidSet()
+	if err != nil {
+		return err
+	}
+	if errant != "" {
+		return fmt.Errorf("Server %s still has errant transactions %s", server.URL, errant)
+	}
+	cluster.errantStep(id, "No more errant transaction on %s", server.URL)
+	return nil
+}
+
+// flashbackQueries returns the statements reverting the rows of the event, last row first
+func (ev ErrantEvent) flashbackQueries(columns []string) ([]string, [][]interface{}, error) {
+	queries := make([]string, 0)
+	args := make([][]interface{}, 0)
+	table := "`" + ev.Schema + "`.`" + ev.Table + "`"
+	step := 1
+	if ev.Type == ErrantEventUpdate {
+		step = 2
+	}
+	for i := len(ev.rows) - step; i >= 0; i -= step {
+		row := ev.rowValues(ev.rows[i])
+		if len(row) != len(columns) {
+			return nil, nil, fmt.Errorf("Table %s has %d columns but the binary log row has %d, full row image is required", table, len(columns), len(row))
+		}
+		switch ev.Type {
+		case ErrantEventInsert:
+			queries = append(queries, "DELETE FROM "+table+" WHERE "+errantColumnList(columns, " <=> ?", " AND ")+" LIMIT 1")
+			args = append(args, row)
+		case ErrantEventDelete:
+			queries = append(queries, "INSERT INTO "+table+" ("+errantColumnList(columns, "", ",")+") VALUES ("+strings.TrimSuffix(strings.Repeat("?,", len(columns)), ",")+")")
+			args = append(args, row)
+		case ErrantEventUpdate:
+			after := ev.rowValues(ev.rows[i+1])
+			// An update with equal images changes no row, reverting it would affect 0 rows
+			if reflect.DeepEqual(row, after) {
+				continue
+			}
+			queries = append(queries, "UPDATE "+table+" SET "+errantColumnList(columns, "=?", ",")+" WHERE "+errantColumnList(columns, " <=> ?", " AND ")+" LIMIT 1")
+			args = append(args, append(row, after...))
+		}
+	}
+	return queries, args, nil
+}
+
+// rowValues restores unsigned integers decoded as signed by the binlog parser
+func (ev ErrantEvent) rowValues(row []interface{}) []interface{} {
+	values := make([]interface{}, len(row))
+	for i, v := range row {
+		values[i] = v
+		if !ev.unsigned[i] {
+			continue
+		}
+		switch n := v.(type) {
+		case int8:
+			values[i] = uint8(n)
+		case int16:
+			values[i] = uint16(n)
+		case int32:
+			values[i] = uint32(n)
+		case int64:
+			values[i] = uint64(n)
+		}
+	}
+	return values
+}
+
+func errantColumnList(columns []string, suffix string, sep string) string {
+	list := make([]string, len(columns))
+	for i, col := range columns {
+		list[i] = "`" + col + "`" + suffix
+	}
+	return strings.Join(list, sep)
+}
@@ -0,0 +1,90 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestErrantFlashbackQueries(t *testing.T) {
+	columns := []string{"id", "k", "v"}
+	const (
+		del = "DELETE FROM `db`.`t` WHERE `id` <=> ? AND `k` <=> ? AND `v` <=> ? LIMIT 1"
+		ins = "INSERT INTO `db`.`t` (`id`,`k`,`v`) VALUES (?,?,?)"
+		upd = "UPDATE `db`.`t` SET `id`=?,`k`=?,`v`=? WHERE `id` <=> ? AND `k` <=> ? AND `v` <=> ? LIMIT 1"
+	)
+	tests := []struct {
+		name    string
+		ev      ErrantEvent
+		queries []string
+		args    [][]interface{}
+	}{
+		{
+			name:    "insert reverted by delete, last row first",
+			ev:      ErrantEvent{Type: ErrantEventInsert, Schema: "db", Table: "t", rows: [][]interface{}{{int32(1), "a", nil}, {int32(1), "b", "x"}}},
+			queries: []string{del, del},
+			args:    [][]interface{}{{int32(1), "b", "x"}, {int32(1), "a", nil}},
+		},
+		{
+			name:    "delete reverted by insert",
+			ev:      ErrantEvent{Type: ErrantEventDelete, Schema: "db", Table: "t", rows: [][]interface{}{{int32(2), "a", nil}}},
+			queries: []string{ins},
+			args:    [][]interface{}{{int32(2), "a", nil}},
+		},
+		{
+			name: "update reverted to the before image",
+			ev: ErrantEvent{Type: ErrantEventUpdate, Schema: "db", Table: "t", rows: [][]interface{}{
+				{int32(1), "a", nil}, {int32(1), "a", "x"},
+				{int32(2), "b", "y"}, {int32(2), "c", nil},
+			}},
+			queries: []string{upd, upd},
+			args: [][]interface{}{
+				{int32(2), "b", "y", int32(2), "c", nil},
+				{int32(1), "a", nil, int32(1), "a", "x"},
+			},
+		},
+		{
+			name: "update with equal images skipped",
+			ev: ErrantEvent{Type: ErrantEventUpdate, Schema: "db", Table: "t", rows: [][]interface{}{
+				{int32(1), "a", nil}, {int32(1), "a", nil},
+			}},
+			queries: []string{},
+			args:    [][]interface{}{},
+		},
+		{
+			name:    "unsigned columns restored",
+			ev:      ErrantEvent{Type: ErrantEventInsert, Schema: "db", Table: "t", rows: [][]interface{}{{int32(-1), int8(-1), "a"}}, unsigned: map[int]bool{0: true, 1: true}},
+			queries: []string{del},
+			args:    [][]interface{}{{uint32(4294967295), uint8(255), "a"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queries, args, err := tt.ev.flashbackQueries(columns)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(queries, tt.queries) {
+				t.Errorf("Unexpected queries %v", queries)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("Unexpected args %v", args)
+			}
+		})
+	}
+}
+
+func TestErrantFlashbackQueriesMinimalImage(t *testing.T) {
+	ev := ErrantEvent{Type: ErrantEventDelete, Schema: "db", Table: "t", rows: [][]interface{}{{int32(1)}}}
+	if _, _, err := ev.flashbackQueries([]string{"id", "v"}); err == nil {
+		t.Error("Expected row image missing columns to be refused")
+	}
+}
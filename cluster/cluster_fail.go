@@ -24,10 +24,17 @@ import (
 	"github.com/signal18/replication-manager/utils/state"
 )
 
-// MasterFailover triggers a leader change and returns the new master URL when single possible leader
+// MasterFailover triggers a leader change requested by a user or the API, the site policy
+// applies to a manual election
 func (cluster *Cluster) MasterFailover(fail bool) bool {
+	return cluster.masterFailover(fail, false)
+}
+
+// masterFailover triggers a leader change and returns the new master URL when single possible leader,
+// automatic is set when the failover is decided by the monitoring
+func (cluster *Cluster) masterFailover(fail bool, automatic bool) bool {
 	if cluster.GetTopology() == config.TopoMultiMasterRing || cluster.GetTopology() == config.TopoMultiMasterWsrep || cluster.GetTopology() == config.TopoMultiMasterGrouprep {
-		res := cluster.VMasterFailover(fail)
+		res := cluster.VMasterFailover(fail, automatic)
 		return res
 	}
 	if cluster.IsInFailover() {
@@ -59,6 +66,12 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 
 			return false
 		}
+		if cluster.Conf.SwitchDrain {
+			defer cluster.UndrainServer()
+			if !cluster.DrainServer(cluster.master) {
+				return false
+			}
+		}
 
 		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Flushing tables on master %s", cluster.master.URL)
 		workerFlushTable := make(chan error, 1)
@@ -105,7 +118,7 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 	}
 	key := -1
 	if fail {
-		key = cluster.electFailoverCandidate(cluster.slaves, true)
+		key = cluster.electFailoverCandidate(cluster.slaves, true, automatic)
 	} else {
 		key = cluster.electSwitchoverCandidate(cluster.slaves, true)
 	}
@@ -145,6 +158,11 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 	// If it's a failover, wait for the SQL thread to read all relay logs.
 	// If maxsclale we should wait for relay catch via old style
 
+	if cluster.master.IsDelayed {
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Removing replication delay on candidate master %s", cluster.master.URL)
+		logs, err := cluster.master.SetReplicationDelay(0)
+		cluster.LogSQL(logs, err, cluster.master.URL, "MasterFailover", config.LvlErr, "Could not remove replication delay on candidate master %s: %s", cluster.master.URL, err)
+	}
 	cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Waiting for candidate master %s to apply relay log", cluster.master.URL)
 	err = cluster.master.ReadAllRelayLogs()
 	if err != nil {
@@ -261,6 +279,7 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 	}
 	cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Failover proxies")
 	cluster.failoverProxies()
+	cluster.UndrainServer()
 	cluster.failoverProxiesWaitMonitor()
 	cluster.failoverPostScript(fail)
 	cluster.failoverEnableEventScheduler()
@@ -386,6 +405,8 @@ func (cluster *Cluster) MasterFailover(fail bool) bool {
 	// Phase 5: Switch slaves to new master
 	// ********
 	cluster.SwitchSlavesToMaster(fail)
+	// Named channels of other clusters replicating from the old leader, in background not to delay the switch
+	go cluster.FailoverReplicationChannels(cluster.oldMaster, cluster.master)
 	// if consul or internal proxy need to adapt read only route to new slaves
 	cluster.backendStateChangeProxies()
 	cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Master switch on %s complete", cluster.master.URL)
@@ -662,7 +683,8 @@ func (cluster *Cluster) electSwitchoverGroupReplicationCandidate(l []*ServerMoni
 			return i
 		}
 	}
-	//	Return one not ignored not full , not prefered
+	//	Return the highest member weight not ignored not full , not prefered
+	key := -1
 	for i, sl := range l {
 		// Skip if child cluster
 		if sl.SourceClusterName != cluster.Name {
@@ -678,13 +700,25 @@ func (cluster *Cluster) electSwitchoverGroupReplicationCandidate(l []*ServerMoni
 		if sl.IsFull {
 			continue
 		}
-		return i
+		if key == -1 || sl.getGroupReplicationWeight() > l[key].getGroupReplicationWeight() {
+			key = i
+		}
 	}
-	return -1
+	return key
 }
 
 // Returns a candidate from a list of slaves. If there's only one slave it will be the de facto candidate.
 func (cluster *Cluster) electSwitchoverCandidate(l []*ServerMonitor, forcingLog bool) int {
+	if cluster.GetSitePolicy() == SitePolicyPreferLocal {
+		if key := cluster.electSwitchoverSiteCandidate(l, forcingLog, true); key != -1 {
+			return key
+		}
+	}
+	return cluster.electSwitchoverSiteCandidate(l, forcingLog, false)
+}
+
+// electSwitchoverSiteCandidate elects in the failover site only when localOnly is set
+func (cluster *Cluster) electSwitchoverSiteCandidate(l []*ServerMonitor, forcingLog bool, localOnly bool) int {
 	ll := len(l)
 	seqList := make([]uint64, ll)
 	posList := make([]uint64, ll)
@@ -719,6 +753,9 @@ func (cluster *Cluster) electSwitchoverCandidate(l []*ServerMonitor, forcingLog
 			cluster.SetState("ERR00035", state.State{ErrType: config.LvlWarn, ErrDesc: fmt.Sprintf(clusterError["ERR00035"], sl.URL), ServerUrl: sl.URL, ErrFrom: "CHECK"})
 			continue
 		}
+		if !cluster.isSiteElectable(sl, localOnly, false) {
+			continue
+		}
 
 		// The tests below should run only in case of a switchover as they require the master to be up.
 		if cluster.isSlaveElectableForSwitchover(sl, forcingLog) == false {
@@ -804,8 +841,19 @@ func (cluster *Cluster) electSwitchoverCandidate(l []*ServerMonitor, forcingLog
 	return -1
 }
 
-// electFailoverCandidate found the most up to date and look after a possibility to failover on it
-func (cluster *Cluster) electFailoverCandidate(l []*ServerMonitor, forcingLog bool) int {
+// electFailoverCandidate found the most up to date and look after a possibility to failover on it,
+// automatic restricts the election to the sites allowed by the policy without a user
+func (cluster *Cluster) electFailoverCandidate(l []*ServerMonitor, forcingLog bool, automatic bool) int {
+	if cluster.GetSitePolicy() == SitePolicyPreferLocal {
+		if key := cluster.electFailoverSiteCandidate(l, forcingLog, true, automatic); key != -1 {
+			return key
+		}
+	}
+	return cluster.electFailoverSiteCandidate(l, forcingLog, false, automatic)
+}
+
+// electFailoverSiteCandidate elects in the failover site only when localOnly is set
+func (cluster *Cluster) electFailoverSiteCandidate(l []*ServerMonitor, forcingLog bool, localOnly bool, automatic bool) int {
 
 	ll := len(l)
 	seqList := make([]uint64, ll)
@@ -826,6 +874,8 @@ func (cluster *Cluster) electFailoverCandidate(l []*ServerMonitor, forcingLog bo
 		IgnoredMinorVersion bool
 		IgnoredErrantTrx    bool
 		IgnoredBlocker      bool
+		IgnoredDelayed      bool
+		IgnoredSite         bool
 		Weight              uint
 		DelayStat           DelayStat
 	}
@@ -854,6 +904,16 @@ func (cluster *Cluster) electFailoverCandidate(l []*ServerMonitor, forcingLog bo
 		if sl.IsFull {
 			continue
 		}
+		// Delayed replica IO thread is up to date, skip it before tracking positions
+		if sl.IsDelayed && !cluster.Conf.HostsDelayedElectable {
+			cluster.SetState("ERR00097", state.State{ErrType: config.LvlWarn, ErrDesc: fmt.Sprintf(clusterError["ERR00097"], sl.URL), ErrFrom: "CHECK", ServerUrl: sl.URL})
+			trackposList[i].IgnoredDelayed = true
+			continue
+		}
+		if !cluster.isSiteElectable(sl, localOnly, automatic) {
+			trackposList[i].IgnoredSite = true
+			continue
+		}
 		if cluster.Conf.MultiMaster == true && sl.State == stateMaster {
 			cluster.SetState("ERR00035", state.State{ErrType: config.LvlWarn, ErrDesc: fmt.Sprintf(clusterError["ERR00035"], sl.URL), ErrFrom: "CHECK", ServerUrl: sl.URL})
 			trackposList[i].Ignoredmultimaster = true
@@ -1087,6 +1147,11 @@ func (cluster *Cluster) isSlaveElectable(sl *ServerMonitor, forcingLog bool) boo
 		// }
 		return false
 	}
+	if sl.IsDelayed && !cluster.Conf.HostsDelayedElectable {
+		cluster.SetState("ERR00097", state.State{ErrType: "WARNING", ErrDesc: fmt.Sprintf(clusterError["ERR00097"], sl.URL), ErrFrom: "CHECK", ServerUrl: sl.URL})
+		cluster.LogModulePrintf(forcingLog, config.ConstLogModWriterElection, config.LvlWarn, "Slave %s is a delayed replica. Skipping", sl.URL)
+		return false
+	}
 
 	if ss.SecondsBehindMaster.Int64 > cluster.Conf.FailMaxDelay && cluster.Conf.FailMaxDelay != -1 && cluster.Conf.RplChecks == true {
 		cluster.SetState("ERR00041", state.State{ErrType: "WARNING", ErrDesc: fmt.Sprintf(clusterError["ERR00041"]+" Sql: "+sl.GetProcessListReplicationLongQuery(), sl.URL, cluster.Conf.FailMaxDelay, ss.SecondsBehindMaster.Int64), ErrFrom: "CHECK", ServerUrl: sl.URL})
@@ -1195,7 +1260,7 @@ func (cluster *Cluster) foundPreferedMaster(l []*ServerMonitor) *ServerMonitor {
 }
 
 // VMasterFailover triggers a leader change and returns the new master URL when all possible leader multimaster ring or galera
-func (cluster *Cluster) VMasterFailover(fail bool) bool {
+func (cluster *Cluster) VMasterFailover(fail bool, automatic bool) bool {
 	if cluster.IsInFailover() {
 		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Cancel already in failover")
 		return false
@@ -1226,6 +1291,12 @@ func (cluster *Cluster) VMasterFailover(fail bool) bool {
 
 			return false
 		}
+		if cluster.Conf.SwitchDrain {
+			defer cluster.UndrainServer()
+			if !cluster.DrainServer(cluster.vmaster) {
+				return false
+			}
+		}
 
 		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Flushing tables on virtual master %s", cluster.vmaster.URL)
 		workerFlushTable := make(chan error, 1)
@@ -1264,7 +1335,7 @@ func (cluster *Cluster) VMasterFailover(fail bool) bool {
 		if cluster.Conf.MultiMasterGrouprep {
 			key = cluster.electSwitchoverGroupReplicationCandidate(cluster.slaves, true)
 		} else {
-			key = cluster.electFailoverCandidate(cluster.slaves, true)
+			key = cluster.electFailoverCandidate(cluster.slaves, true, automatic)
 		}
 
 	}
@@ -1309,6 +1380,11 @@ func (cluster *Cluster) VMasterFailover(fail bool) bool {
 		// If it's a failover, wait for the SQL thread to read all relay logs.
 		// If maxsclale we should wait for relay catch via old style
 
+		if cluster.master.IsDelayed {
+			cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Removing replication delay on candidate master %s", cluster.master.URL)
+			logs, err := cluster.master.SetReplicationDelay(0)
+			cluster.LogSQL(logs, err, cluster.master.URL, "VMasterFailover", config.LvlErr, "Could not remove replication delay on candidate master %s: %s", cluster.master.URL, err)
+		}
 		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Waiting for candidate master to apply relay log")
 		err = cluster.master.ReadAllRelayLogs()
 		if err != nil {
@@ -1365,6 +1441,7 @@ func (cluster *Cluster) VMasterFailover(fail bool) bool {
 	}
 	// Call post-failover script before unlocking the old master.
 	cluster.failoverProxies()
+	cluster.UndrainServer()
 	cluster.failoverProxiesWaitMonitor()
 	cluster.failoverEnableEventScheduler()
 	cluster.failoverPostScript(fail)
@@ -14,6 +14,7 @@ import (
 	"hash/crc64"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
 	"sort"
 	"strconv"
@@ -170,6 +171,19 @@ func (cluster *Cluster) GetMysqlclientPath() string {
 	return cluster.Conf.BackupMysqlclientPath
 }
 
+func (cluster *Cluster) GetMysqlUpgradePath() string {
+	if cluster.Conf.UpgradeClientPath == "" {
+		if out, err := exec.Command("which", "mariadb-upgrade").Output(); err == nil {
+			return strings.Trim(string(out), "\r\n")
+		}
+		if out, err := exec.Command("which", "mysql_upgrade").Output(); err == nil {
+			return strings.Trim(string(out), "\r\n")
+		}
+		return filepath.Dir(cluster.GetMysqlclientPath()) + "/mysql_upgrade"
+	}
+	return cluster.Conf.UpgradeClientPath
+}
+
 func (cluster *Cluster) GetDomain() string {
 	if cluster.Conf.ProvNetCNI {
 		return "." + cluster.Name + ".svc." + cluster.Conf.ProvOrchestratorCluster
@@ -191,10 +205,11 @@ func (cluster *Cluster) GetDomainHeadCluster() string {
 func (cluster *Cluster) GetPersitentState() error {
 
 	type Save struct {
-		Servers    string      `json:"servers"`
-		Crashes    crashList   `json:"crashes"`
-		SLA        state.Sla   `json:"sla"`
-		SLAHistory []state.Sla `json:"slaHistory"`
+		Servers       string      `json:"servers"`
+		Crashes       crashList   `json:"crashes"`
+		SLA           state.Sla   `json:"sla"`
+		SLAHistory    []state.Sla `json:"slaHistory"`
+		DelayedPaused []string    `json:"delayedPaused"`
 	}
 
 	var clsave Save
@@ -213,6 +228,7 @@ func (cluster *Cluster) GetPersitentState() error {
 	}
 	cluster.SLAHistory = clsave.SLAHistory
 	cluster.Crashes = clsave.Crashes
+	cluster.delayedPaused = clsave.DelayedPaused
 	cluster.StateMachine.SetSla(clsave.SLA)
 	cluster.StateMachine.SetMasterUpAndSyncRestart()
 
@@ -722,6 +738,11 @@ func (cluster *Cluster) GetBackupServer() *ServerMonitor {
 			return server
 		}
 	}
+	if cluster.IsWsrep() && cluster.Conf.WsrepBackupDesync {
+		if donor := cluster.getWsrepDonor(); donor != nil {
+			return donor
+		}
+	}
 	if cluster.master != nil {
 		return cluster.master
 	}
@@ -1172,11 +1193,11 @@ func (cluster *Cluster) GetVaultMonitorCredentials(client *vault.Client) (string
 		user, pass := misc.SplitPair(secret.Data["db-servers-credential"].(string))
 		return user, pass, nil
 	} else {
-		secret, err := client.KVv1("").Get(context.Background(), cluster.GetConf().User)
+		data, err := cluster.readVaultDatabaseSecret(client, "db-servers-credential", cluster.GetConf().User)
 		if err != nil {
 			return "", "", err
 		}
-		return secret.Data["username"].(string), secret.Data["password"].(string), nil
+		return vaultUserPass(data)
 	}
 }
 func (cluster *Cluster) GetVaultShardProxyCredentials(client *vault.Client) (string, string, error) {
@@ -1194,11 +1215,11 @@ func (cluster *Cluster) GetVaultShardProxyCredentials(client *vault.Client) (str
 
 		return user, pass, nil
 	} else {
-		secret, err := client.KVv1("").Get(context.Background(), cluster.GetConf().MdbsProxyCredential)
+		data, err := cluster.readVaultDatabaseSecret(client, "shardproxy-credential", cluster.GetConf().MdbsProxyCredential)
 		if err != nil {
 			return "", "", err
 		}
-		return secret.Data["username"].(string), secret.Data["password"].(string), nil
+		return vaultUserPass(data)
 	}
 }
 
@@ -1225,11 +1246,11 @@ func (cluster *Cluster) GetVaultProxySQLCredentials(client *vault.Client) (strin
 
 		return user, pass, nil
 	} else {
-		secret, err := client.KVv1("").Get(context.Background(), cluster.GetConf().ProxysqlPassword)
+		data, err := cluster.readVaultDatabaseSecret(client, "proxysql-password", cluster.GetConf().ProxysqlPassword)
 		if err != nil {
 			return "", "", err
 		}
-		return secret.Data["username"].(string), secret.Data["password"].(string), nil
+		return vaultUserPass(data)
 	}
 }
 
@@ -1243,11 +1264,11 @@ func (cluster *Cluster) GetVaultReplicationCredentials(client *vault.Client) (st
 		user, pass := misc.SplitPair(secret.Data["replication-credential"].(string))
 		return user, pass, nil
 	} else {
-		secret, err := client.KVv1("").Get(context.Background(), cluster.GetConf().RplUser)
+		data, err := cluster.readVaultDatabaseSecret(client, "replication-credential", cluster.GetConf().RplUser)
 		if err != nil {
 			return "", "", err
 		}
-		return secret.Data["username"].(string), secret.Data["password"].(string), nil
+		return vaultUserPass(data)
 	}
 }
 
@@ -1267,6 +1288,20 @@ func (cluster *Cluster) GetVaultConnection() (*vault.Client, error) {
 			return nil, err
 		}
 
+		if cluster.Conf.VaultAuth == "token" {
+			token := cluster.Conf.GetDecryptedPassword("vault-token", cluster.Conf.VaultToken)
+			if token == "" {
+				err = errors.New("Vault token auth without vault-token")
+				cluster.SetState("ERR00089", state.State{ErrType: "WARNING", ErrDesc: fmt.Sprintf(clusterError["ERR00089"], err), ErrFrom: "TOPO"})
+				cluster.CanConnectVault = false
+				cluster.errorConnectVault = err
+				return nil, err
+			}
+			client.SetToken(token)
+			cluster.CanConnectVault = true
+			return client, nil
+		}
+
 		roleID := cluster.Conf.VaultRoleId
 		secretid := cluster.Conf.GetDecryptedPassword("vault-secret-id", cluster.Conf.VaultSecretId)
 		secretID := &auth.SecretID{FromString: secretid}
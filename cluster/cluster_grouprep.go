@@ -0,0 +1,354 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/signal18/replication-manager/config"
+	"github.com/signal18/replication-manager/utils/dbhelper"
+	"github.com/signal18/replication-manager/utils/state"
+)
+
+const (
+	GroupReplicationSinglePrimary = "single-primary"
+	GroupReplicationMultiPrimary  = "multi-primary"
+
+	grMemberOnline      = "ONLINE"
+	grMemberUnreachable = "UNREACHABLE"
+	grMemberError       = "ERROR"
+	grMemberOffline     = "OFFLINE"
+	grRolePrimary       = "PRIMARY"
+	grRoleSecondary     = "SECONDARY"
+
+	grDiscoverTicks = 10
+)
+
+var (
+	ErrGroupReplicationTopology = errors.New("Cluster topology is not multi-master-grouprep")
+	ErrGroupReplicationNoMember = errors.New("No online group replication member")
+	ErrGroupReplicationMode     = errors.New("Unknown group replication mode")
+	ErrGroupReplicationNotSlave = errors.New("Server is not an online secondary of a single-primary group")
+	ErrGroupReplicationSwitch   = errors.New("Group replication switchover failed")
+)
+
+// GroupReplicationMember is a member of the group as seen by a server, with the
+// monitored server it matches and its election weight
+type GroupReplicationMember struct {
+	dbhelper.GroupReplicationMember
+	URL    string `json:"url"`
+	Weight int    `json:"weight"`
+}
+
+type GroupReplicationStatus struct {
+	Enabled     bool                     `json:"enabled"`
+	Mode        string                   `json:"mode"`
+	Primary     string                   `json:"primary"`
+	ViewFrom    string                   `json:"viewFrom"`
+	Online      int                      `json:"online"`
+	HasMajority bool                     `json:"hasMajority"`
+	Members     []GroupReplicationMember `json:"members"`
+}
+
+func (cluster *Cluster) IsGroupReplication() bool {
+	return cluster.GetTopology() == config.TopoMultiMasterGrouprep
+}
+
+// GetGroupReplicationWeights parses host:port=weight,host:port=weight
+func (cluster *Cluster) GetGroupReplicationWeights() map[string]int {
+	weights := make(map[string]int)
+	for _, def := range strings.Split(cluster.Conf.MultiMasterGrouprepMemberWeights, ",") {
+		pair := strings.SplitN(strings.TrimSpace(def), "=", 2)
+		if len(pair) != 2 || pair[0] == "" {
+			continue
+		}
+		weight, err := strconv.Atoi(strings.TrimSpace(pair[1]))
+		if err != nil || weight < 0 || weight > 100 {
+			continue
+		}
+		weights[strings.TrimSpace(pair[0])] = weight
+	}
+	return weights
+}
+
+// GetGroupReplicationWeight returns the configured weight of the server, -1 when it is not set
+func (server *ServerMonitor) GetGroupReplicationWeight() int {
+	weights := server.ClusterGroup.GetGroupReplicationWeights()
+	if weight, ok := weights[server.URL]; ok {
+		return weight
+	}
+	if weight, ok := weights[server.Name]; ok {
+		return weight
+	}
+	return -1
+}
+
+// getGroupReplicationWeight returns the weight used by the group for the election,
+// the default of group_replication_member_weight is 50
+func (server *ServerMonitor) getGroupReplicationWeight() int {
+	if weight, err := strconv.Atoi(server.Variables.Get("GROUP_REPLICATION_MEMBER_WEIGHT")); err == nil {
+		return weight
+	}
+	return 50
+}
+
+func (cluster *Cluster) getServerFromGroupMember(member dbhelper.GroupReplicationMember) *ServerMonitor {
+	for _, server := range cluster.Servers {
+		if server == nil {
+			continue
+		}
+		if strings.EqualFold(server.Variables.Get("SERVER_UUID"), member.MemberId) {
+			return server
+		}
+		if server.Host == member.MemberHost && server.Port == strconv.Itoa(member.MemberPort) {
+			return server
+		}
+	}
+	return nil
+}
+
+// refreshGroupReplication reads the members of the group and the role of the server in it
+func (server *ServerMonitor) refreshGroupReplication() {
+	cluster := server.ClusterGroup
+	members, logs, err := dbhelper.GetGroupReplicationMembers(server.Conn, server.DBVersion)
+	cluster.LogSQL(logs, err, server.URL, "Monitor", config.LvlDbg, "Could not get group replication members %s %s", server.URL, err)
+	if err != nil {
+		// an unknown state must not keep the server elected as primary or used as the group view
+		server.GroupReplicationMembers = nil
+		server.GroupReplicationMemberState = ""
+		server.IsGroupReplicationMaster = false
+		server.IsGroupReplicationSlave = false
+		return
+	}
+	uuid := server.Variables.Get("SERVER_UUID")
+	server.GroupReplicationMembers = make([]GroupReplicationMember, 0, len(members))
+	server.GroupReplicationMemberState = grMemberOffline
+	server.IsGroupReplicationMaster = false
+	server.IsGroupReplicationSlave = false
+	for _, m := range members {
+		member := GroupReplicationMember{GroupReplicationMember: m, Weight: -1}
+		if sv := cluster.getServerFromGroupMember(m); sv != nil {
+			member.URL = sv.URL
+			member.Weight = sv.getGroupReplicationWeight()
+		}
+		if strings.EqualFold(m.MemberId, uuid) {
+			server.GroupReplicationMemberState = m.MemberState
+			role := m.MemberRole
+			if role == "" {
+				// MySQL 5.7 does not report the role, the primary is a status
+				role = grRoleSecondary
+				if server.Variables.Get("GROUP_REPLICATION_SINGLE_PRIMARY_MODE") != "ON" || strings.EqualFold(server.Status.Get("GROUP_REPLICATION_PRIMARY_MEMBER"), uuid) {
+					role = grRolePrimary
+				}
+			}
+			server.IsGroupReplicationMaster = m.MemberState == grMemberOnline && role == grRolePrimary
+			server.IsGroupReplicationSlave = m.MemberState == grMemberOnline && role == grRoleSecondary
+		}
+		server.GroupReplicationMembers = append(server.GroupReplicationMembers, member)
+	}
+}
+
+// getGroupReplicationView returns an online member to read the group from
+func (cluster *Cluster) getGroupReplicationView() *ServerMonitor {
+	var view *ServerMonitor
+	for _, server := range cluster.Servers {
+		if server == nil || server.IsDown() || server.Conn == nil || server.GroupReplicationMemberState != grMemberOnline {
+			continue
+		}
+		if server.IsGroupReplicationMaster {
+			return server
+		}
+		if view == nil {
+			view = server
+		}
+	}
+	return view
+}
+
+func (cluster *Cluster) GetGroupReplication() GroupReplicationStatus {
+	st := GroupReplicationStatus{
+		Enabled: cluster.IsGroupReplication(),
+		Members: []GroupReplicationMember{},
+	}
+	view := cluster.getGroupReplicationView()
+	if view == nil {
+		return st
+	}
+	st.ViewFrom = view.URL
+	st.Mode = GroupReplicationMultiPrimary
+	if view.Variables.Get("GROUP_REPLICATION_SINGLE_PRIMARY_MODE") == "ON" {
+		st.Mode = GroupReplicationSinglePrimary
+	}
+	for _, member := range view.GroupReplicationMembers {
+		if member.MemberState == grMemberOnline {
+			st.Online++
+			if member.MemberRole == grRolePrimary && st.Mode == GroupReplicationSinglePrimary {
+				st.Primary = member.URL
+			}
+		}
+		st.Members = append(st.Members, member)
+	}
+	if st.Mode == GroupReplicationSinglePrimary && st.Primary == "" && view.IsGroupReplicationMaster {
+		st.Primary = view.URL
+	}
+	st.HasMajority = st.Online*2 > len(st.Members)
+	return st
+}
+
+// CheckGroupReplication raises expelled members and partitions, applies the configured
+// election weights and rejoins the members in error. An offline member was stopped on
+// purpose and is left to the operator.
+func (cluster *Cluster) CheckGroupReplication() {
+	if !cluster.IsGroupReplication() {
+		return
+	}
+	for _, server := range cluster.Servers {
+		if server == nil || server.IsDown() || server.Conn == nil || server.GroupReplicationMembers == nil {
+			continue
+		}
+		if weight := server.GetGroupReplicationWeight(); weight >= 0 && weight != server.getGroupReplicationWeight() {
+			logs, err := dbhelper.SetGroupReplicationMemberWeight(server.Conn, weight)
+			cluster.LogSQL(logs, err, server.URL, "GroupReplication", config.LvlErr, "Could not set group replication member weight on %s: %s", server.URL, err)
+		}
+		switch server.GroupReplicationMemberState {
+		case grMemberError, grMemberOffline:
+			cluster.SetState("ERR00101", state.State{ErrType: config.LvlErr, ErrDesc: fmt.Sprintf(clusterError["ERR00101"], server.URL, server.GroupReplicationMemberState), ErrFrom: "MON", ServerUrl: server.URL})
+			if cluster.IsActive() && cluster.isGroupReplicationRejoinable(server) {
+				server.GroupReplicationRejoinTime = time.Now()
+				go server.RejoinGroupReplication()
+			}
+			continue
+		case grMemberOnline:
+		default:
+			continue
+		}
+		online := 0
+		for _, member := range server.GroupReplicationMembers {
+			switch member.MemberState {
+			case grMemberOnline:
+				online++
+			case grMemberUnreachable:
+				name := member.URL
+				if name == "" {
+					name = member.MemberHost + ":" + strconv.Itoa(member.MemberPort)
+				}
+				cluster.SetState("WARN0150", state.State{ErrType: config.LvlWarn, ErrDesc: fmt.Sprintf(clusterError["WARN0150"], server.URL, name), ErrFrom: "MON", ServerUrl: server.URL})
+			}
+		}
+		if online*2 <= len(server.GroupReplicationMembers) {
+			cluster.SetState("ERR00102", state.State{ErrType: config.LvlErr, ErrDesc: fmt.Sprintf(clusterError["ERR00102"], server.URL, online, len(server.GroupReplicationMembers)), ErrFrom: "MON", ServerUrl: server.URL})
+		}
+	}
+}
+
+// isGroupReplicationRejoinable returns true when the member is in error and was not
+// rejoined during the rejoin interval
+func (cluster *Cluster) isGroupReplicationRejoinable(server *ServerMonitor) bool {
+	return cluster.Conf.MultiMasterGrouprepRejoin && server.GroupReplicationMemberState == grMemberError && !server.IsMaintenance && time.Since(server.GroupReplicationRejoinTime) > time.Duration(cluster.Conf.MultiMasterGrouprepRejoinInterval)*time.Second
+}
+
+// RejoinGroupReplication restarts group replication on a member expelled from the group
+func (server *ServerMonitor) RejoinGroupReplication() error {
+	cluster := server.ClusterGroup
+	if server.Conn == nil {
+		return ErrGroupReplicationNoMember
+	}
+	cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModTopology, config.LvlInfo, "Rejoining group replication member %s in state %s", server.URL, server.GroupReplicationMemberState)
+	logs, err := dbhelper.StopGroupReplication(server.Conn)
+	cluster.LogSQL(logs, err, server.URL, "GroupReplication", config.LvlErr, "Could not stop group replication on %s: %s", server.URL, err)
+	if err != nil {
+		return err
+	}
+	return server.StartGroupReplication()
+}
+
+// SetGroupReplicationPrimary elects the server as the primary of a single-primary group
+// with a switchover, so that the proxies and the cluster master follow the new primary
+func (cluster *Cluster) SetGroupReplicationPrimary(server *ServerMonitor) error {
+	if !cluster.IsGroupReplication() {
+		return ErrGroupReplicationTopology
+	}
+	if cluster.GetGroupReplication().Mode != GroupReplicationSinglePrimary || !server.IsGroupReplicationSlave {
+		return ErrGroupReplicationNotSlave
+	}
+	return cluster.switchoverGroupReplication(server)
+}
+
+func (cluster *Cluster) switchoverGroupReplication(server *ServerMonitor) error {
+	savedPrefMaster := cluster.GetPreferedMasterList()
+	cluster.SetPrefMaster(server.URL)
+	done := cluster.MasterFailover(false)
+	cluster.SetPrefMaster(savedPrefMaster)
+	if !done {
+		return ErrGroupReplicationSwitch
+	}
+	cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModTopology, config.LvlInfo, "Server %s elected as group replication primary", server.URL)
+	return nil
+}
+
+// waitGroupReplicationSlave waits for the monitor to discover the server as a secondary
+// of the group, the switchover elects its candidate among the discovered slaves
+func (cluster *Cluster) waitGroupReplicationSlave(server *ServerMonitor) error {
+	timeout := time.Now().Add(time.Duration(cluster.Conf.MonitoringTicker*grDiscoverTicks) * time.Second)
+	for {
+		for _, sl := range cluster.slaves {
+			if sl == server && server.IsGroupReplicationSlave {
+				return nil
+			}
+		}
+		if !time.Now().Before(timeout) {
+			return ErrGroupReplicationNotSlave
+		}
+		time.Sleep(time.Second * time.Duration(cluster.Conf.MonitoringTicker))
+	}
+}
+
+// SetGroupReplicationMode switches the group between single-primary and multi-primary.
+// The switch to single-primary keeps the cluster master writable, a different primary
+// is then elected with a switchover.
+func (cluster *Cluster) SetGroupReplicationMode(mode string, primary *ServerMonitor) error {
+	if !cluster.IsGroupReplication() {
+		return ErrGroupReplicationTopology
+	}
+	view := cluster.getGroupReplicationView()
+	if view == nil {
+		return ErrGroupReplicationNoMember
+	}
+	var logs string
+	var err error
+	switch mode {
+	case GroupReplicationSinglePrimary:
+		uuid := ""
+		if cluster.vmaster != nil {
+			uuid = cluster.vmaster.Variables.Get("SERVER_UUID")
+		}
+		logs, err = dbhelper.SwitchGroupReplicationSinglePrimary(view.Conn, uuid)
+	case GroupReplicationMultiPrimary:
+		logs, err = dbhelper.SwitchGroupReplicationMultiPrimary(view.Conn)
+	default:
+		return ErrGroupReplicationMode
+	}
+	cluster.LogSQL(logs, err, view.URL, "GroupReplication", config.LvlErr, "Could not switch group replication to %s: %s", mode, err)
+	if err != nil {
+		return err
+	}
+	cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModTopology, config.LvlInfo, "Group replication switched to %s", mode)
+	if mode != GroupReplicationSinglePrimary || primary == nil || (cluster.vmaster != nil && primary.URL == cluster.vmaster.URL) {
+		return nil
+	}
+	if err := cluster.waitGroupReplicationSlave(primary); err != nil {
+		return err
+	}
+	return cluster.switchoverGroupReplication(primary)
+}
@@ -0,0 +1,121 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/signal18/replication-manager/config"
+	"github.com/signal18/replication-manager/utils/state"
+	"github.com/signal18/replication-manager/utils/version"
+	"github.com/sirupsen/logrus"
+)
+
+func newGroupReplicationTestCluster() *Cluster {
+	cluster := &Cluster{Name: "c1", StateMachine: new(state.StateMachine)}
+	cluster.StateMachine.Init()
+	cluster.Topology = config.TopoMultiMasterGrouprep
+	for i, url := range []string{"db1:3306", "db2:3306"} {
+		server := &ServerMonitor{URL: url, ClusterGroup: cluster, SourceClusterName: "c1", State: stateSlave, Conn: &sqlx.DB{}, Variables: config.NewStringsMap(), Status: config.NewStringsMap()}
+		server.Variables.Set("GROUP_REPLICATION_SINGLE_PRIMARY_MODE", "ON")
+		server.GroupReplicationMemberState = grMemberOnline
+		server.GroupReplicationMembers = []GroupReplicationMember{}
+		server.IsGroupReplicationMaster = i == 0
+		server.IsGroupReplicationSlave = i != 0
+		cluster.Servers = append(cluster.Servers, server)
+	}
+	return cluster
+}
+
+func TestGroupReplicationACL(t *testing.T) {
+	cluster := newGroupReplicationTestCluster()
+	cluster.APIUsers = map[string]APIUser{
+		"repl":   {User: "repl", Grants: map[string]bool{config.GrantDBReplication: true, config.GrantClusterReplication: true}},
+		"switch": {User: "switch", Grants: map[string]bool{config.GrantClusterSwitchover: true}},
+	}
+	for _, url := range []string{
+		"/api/clusters/c1/servers/db2/actions/group-replication-primary",
+		"/api/clusters/c1/group-replication/actions/single-primary",
+	} {
+		if cluster.IsURLPassACL("repl", url, false) {
+			t.Errorf("Expected replication grant to be refused on %s", url)
+		}
+		if !cluster.IsURLPassACL("switch", url, false) {
+			t.Errorf("Expected switchover grant to pass on %s", url)
+		}
+	}
+	if !cluster.IsURLPassACL("repl", "/api/clusters/c1/servers/db2/actions/group-replication-rejoin", false) {
+		t.Error("Expected replication grant to pass on rejoin")
+	}
+	if !cluster.IsURLPassACL("repl", "/api/clusters/c1/group-replication", false) {
+		t.Error("Expected replication grant to pass on group replication status")
+	}
+}
+
+func TestGroupReplicationRejoinable(t *testing.T) {
+	cluster := newGroupReplicationTestCluster()
+	cluster.Conf.MultiMasterGrouprepRejoin = true
+	cluster.Conf.MultiMasterGrouprepRejoinInterval = 60
+	server := cluster.Servers[1]
+	server.GroupReplicationMemberState = grMemberOffline
+	if cluster.isGroupReplicationRejoinable(server) {
+		t.Error("Expected an offline member not to be rejoined")
+	}
+	server.GroupReplicationMemberState = grMemberError
+	if !cluster.isGroupReplicationRejoinable(server) {
+		t.Error("Expected a member in error to be rejoined")
+	}
+	server.GroupReplicationRejoinTime = time.Now()
+	if cluster.isGroupReplicationRejoinable(server) {
+		t.Error("Expected no rejoin during the rejoin interval")
+	}
+}
+
+func TestRefreshGroupReplicationError(t *testing.T) {
+	cluster := newGroupReplicationTestCluster()
+	cluster.SqlErrorLog = logrus.New()
+	cluster.SqlErrorLog.SetOutput(io.Discard)
+	server := cluster.Servers[0]
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	server.Conn = sqlx.NewDb(db, "mysql")
+	server.DBVersion, _ = version.NewVersion("MySQL", 8, 0, 36)
+	mock.ExpectQuery("replication_group_members").WillReturnError(errors.New("lost connection"))
+	server.refreshGroupReplication()
+	if server.IsGroupReplicationMaster || server.IsGroupReplicationSlave || server.GroupReplicationMemberState != "" || server.GroupReplicationMembers != nil {
+		t.Errorf("Expected group replication state to be cleared, got master %t slave %t state %q", server.IsGroupReplicationMaster, server.IsGroupReplicationSlave, server.GroupReplicationMemberState)
+	}
+	if view := cluster.getGroupReplicationView(); view == server {
+		t.Error("Expected the server not to be used as group view")
+	}
+}
+
+func TestSetGroupReplicationPrimaryRefused(t *testing.T) {
+	cluster := newGroupReplicationTestCluster()
+	if err := cluster.SetGroupReplicationPrimary(cluster.Servers[0]); err != ErrGroupReplicationNotSlave {
+		t.Errorf("Expected the primary to be refused, got %v", err)
+	}
+	cluster.Servers[0].Variables.Set("GROUP_REPLICATION_SINGLE_PRIMARY_MODE", "OFF")
+	if err := cluster.SetGroupReplicationPrimary(cluster.Servers[1]); err != ErrGroupReplicationNotSlave {
+		t.Errorf("Expected multi-primary group to be refused, got %v", err)
+	}
+	cluster.Topology = config.TopoMasterSlave
+	if err := cluster.SetGroupReplicationPrimary(cluster.Servers[1]); err != ErrGroupReplicationTopology {
+		t.Errorf("Expected topology error, got %v", err)
+	}
+}
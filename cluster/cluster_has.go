@@ -156,6 +156,14 @@ func (cluster *Cluster) IsInPreferedBackupHosts(server *ServerMonitor) bool {
 	return false
 }
 
+// IsStagingServer is true for the staging server of a staging topology
+func (cluster *Cluster) IsStagingServer(server *ServerMonitor) bool {
+	if !cluster.Conf.TopologyStaging || cluster.Conf.TopologyStagingServer == "" {
+		return false
+	}
+	return server.URL == cluster.Conf.TopologyStagingServer || server.Name == cluster.Conf.TopologyStagingServer
+}
+
 func (cluster *Cluster) IsInIgnoredReadonly(server *ServerMonitor) bool {
 	// Ignore if child cluster
 	if server.SourceClusterName != cluster.Name {
@@ -546,3 +554,13 @@ func (cluster *Cluster) HasWaitSponsorCredCookie() bool {
 	}
 	return false
 }
+
+// IsApprovalRequired is true when the operation is listed in approval-operations
+func (cluster *Cluster) IsApprovalRequired(operation string) bool {
+	for _, op := range strings.Split(cluster.Conf.ApprovalOperations, ",") {
+		if strings.TrimSpace(op) == operation {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"github.com/signal18/replication-manager/config"
+)
+
+// loadLDAPUsers adds the directory users that logged in to users, with the grants and
+// roles of their groups in api-ldap-group-acl-allow. Local users take precedence and
+// directory users without a mapped group are left out.
+func (cluster *Cluster) loadLDAPUsers(users map[string]APIUser) {
+	listACLs := cluster.GetClusterUserAllowACLs(cluster.Conf.APILDAPGroupACL)
+	cluster.ldapMutex.RLock()
+	defer cluster.ldapMutex.RUnlock()
+	for user, groups := range cluster.ldapUsers {
+		if _, ok := users[user]; ok {
+			continue
+		}
+		if newapiuser, ok := cluster.newLDAPUser(user, groups, listACLs); ok {
+			users[user] = newapiuser
+		}
+	}
+}
+
+// newLDAPUser builds a directory user from the acls of its groups, it returns false when
+// no group is mapped
+func (cluster *Cluster) newLDAPUser(user string, groups []string, listACLs map[string]ListUserACL) (APIUser, bool) {
+	newapiuser := APIUser{User: user, IsLDAP: true, Grants: make(map[string]bool), Roles: make(map[string]bool)}
+	mapped := false
+	for _, group := range groups {
+		if groupACL, ok := listACLs[group]; ok {
+			cluster.SetUserGrants(&newapiuser, groupACL.ACLs)
+			cluster.SetUserRoles(&newapiuser, groupACL.Roles)
+			mapped = true
+		}
+	}
+	if !mapped {
+		return newapiuser, false
+	}
+	setVisitorRole(&newapiuser)
+	return newapiuser, true
+}
+
+// SetLDAPUser records the groups of a directory user after a successful LDAP login and
+// returns true when one of the groups gives access to the cluster. Only that user is
+// updated, a local user of the same name is never replaced.
+func (cluster *Cluster) SetLDAPUser(user string, groups []string) bool {
+	if u, ok := cluster.APIUsers[user]; ok && !u.IsLDAP {
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlWarn, "LDAP user %s is also a local user, the local user is kept", user)
+		return false
+	}
+	cluster.ldapMutex.Lock()
+	if cluster.ldapUsers == nil {
+		cluster.ldapUsers = make(map[string][]string)
+	}
+	cluster.ldapUsers[user] = groups
+	cluster.ldapMutex.Unlock()
+	newapiuser, ok := cluster.newLDAPUser(user, groups, cluster.GetClusterUserAllowACLs(cluster.Conf.APILDAPGroupACL))
+	if !ok {
+		cluster.setAPIUser(user, nil)
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlWarn, "LDAP user %s has no group mapped in api-ldap-group-acl-allow, groups %v", user, groups)
+		return false
+	}
+	cluster.setAPIUser(user, &newapiuser)
+	cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "LDAP user %s logged in with groups %v", user, groups)
+	return true
+}
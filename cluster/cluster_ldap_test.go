@@ -0,0 +1,50 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import "testing"
+
+func TestSetLDAPUser(t *testing.T) {
+	cluster := &Cluster{Name: "c1"}
+	cluster.Grants = map[string]string{"db-show-logs": "db-show-logs", "cluster-switchover": "cluster-switchover"}
+	cluster.Conf.APILDAPGroupACL = "dba:db-show"
+	cluster.APIUsers = map[string]APIUser{
+		"admin":   {User: "admin", Password: "secret", Grants: map[string]bool{"cluster-switchover": true}},
+		"svc-ci":  {User: "svc-ci", IsToken: true, Grants: map[string]bool{}},
+		"old-dba": {User: "old-dba", IsLDAP: true, Grants: map[string]bool{}},
+	}
+	before := cluster.APIUsers
+
+	if cluster.SetLDAPUser("admin", []string{"dba"}) {
+		t.Error("A directory account should not replace the local admin")
+	}
+	if u := cluster.APIUsers["admin"]; u.IsLDAP || u.Password != "secret" {
+		t.Errorf("Local admin was modified %+v", u)
+	}
+	if !cluster.SetLDAPUser("alice", []string{"users", "dba"}) {
+		t.Fatal("Expected alice to log in through the dba group")
+	}
+	alice := cluster.APIUsers["alice"]
+	if !alice.IsLDAP || !alice.Grants["db-show-logs"] || alice.Grants["cluster-switchover"] {
+		t.Errorf("Unexpected directory user %+v", alice)
+	}
+	if _, ok := cluster.APIUsers["svc-ci"]; !ok {
+		t.Error("Other users should be kept")
+	}
+	if _, ok := before["alice"]; ok {
+		t.Error("The previous users map should not be modified in place")
+	}
+	if cluster.SetLDAPUser("old-dba", []string{"users"}) {
+		t.Error("Expected old-dba to be refused without mapped group")
+	}
+	if _, ok := cluster.APIUsers["old-dba"]; ok {
+		t.Error("Expected old-dba to be removed")
+	}
+}
@@ -0,0 +1,849 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+	"github.com/go-mysql-org/go-mysql/replication"
+	"github.com/google/uuid"
+	"github.com/signal18/replication-manager/config"
+	"github.com/signal18/replication-manager/utils/dbhelper"
+	"github.com/signal18/replication-manager/utils/rplerror"
+	"github.com/signal18/replication-manager/utils/state"
+)
+
+const (
+	playbookRunHistory    = 20
+	playbookReseedTimeout = 2 * time.Hour
+	playbookResolveWait   = 30 * time.Second
+	playbookMaxEvents     = 10000
+)
+
+var (
+	ErrPlaybookNoError  = errors.New("Replication of the server has no error")
+	ErrPlaybookNoAction = errors.New("No playbook for the replication error class")
+	ErrPlaybookRunning  = errors.New("A replication playbook is already running on the server")
+	ErrPlaybookNoMaster = errors.New("No replication source found")
+)
+
+// ReplicationError is the classified error of the replication threads of a replica and its playbook
+type ReplicationError struct {
+	URL           string `json:"url"`
+	Name          string `json:"name"`
+	Class         string `json:"class"`
+	Action        string `json:"action"`
+	SQLErrno      string `json:"sqlErrno"`
+	SQLError      string `json:"sqlError"`
+	IOErrno       string `json:"ioErrno"`
+	IOError       string `json:"ioError"`
+	Schema        string `json:"schema,omitempty"`
+	Table         string `json:"table,omitempty"`
+	MasterLogFile string `json:"masterLogFile"`
+	MasterLogPos  string `json:"masterLogPos"`
+}
+
+// PlaybookRun tracks a playbook run on a replica
+type PlaybookRun struct {
+	ID               string    `json:"id"`
+	Server           string    `json:"server"`
+	Class            string    `json:"class"`
+	Action           string    `json:"action"`
+	Errno            string    `json:"errno"`
+	ReplicationError string    `json:"replicationError"`
+	Automatic        bool      `json:"automatic"`
+	Status           string    `json:"status"`
+	Start            time.Time `json:"start"`
+	End              time.Time `json:"end,omitempty"`
+	Steps            []string  `json:"steps"`
+	Error            string    `json:"error,omitempty"`
+}
+
+// PlaybookStatus is the playbook of each error class, the replicas in error and the last runs, newest first
+type PlaybookStatus struct {
+	Enabled   bool               `json:"enabled"`
+	Playbooks map[string]string  `json:"playbooks"`
+	Errors    []ReplicationError `json:"errors"`
+	Runs      []PlaybookRun      `json:"runs"`
+}
+
+// GetPlaybooks returns the action of each replication error class
+func (cluster *Cluster) GetPlaybooks() map[string]string {
+	return rplerror.ParsePlaybooks(cluster.Conf.ReplicationPlaybooks)
+}
+
+func (cluster *Cluster) GetPlaybookReseedMethod() string {
+	switch cluster.Conf.ReplicationPlaybookReseedMethod {
+	case StagingRefreshLogicalBackup, StagingRefreshClone:
+		return cluster.Conf.ReplicationPlaybookReseedMethod
+	}
+	return StagingRefreshPhysicalBackup
+}
+
+// GetReplicationError classifies the last error of the replication threads of the server
+func (server *ServerMonitor) GetReplicationError() (ReplicationError, error) {
+	cluster := server.ClusterGroup
+	re := ReplicationError{URL: server.URL, Name: server.Name, Class: rplerror.ClassNone, Action: rplerror.ActionNone}
+	ss, err := server.GetSlaveStatus(server.ReplicationSourceName)
+	if err != nil {
+		return re, err
+	}
+	re.SQLErrno = ss.LastSQLErrno.String
+	re.SQLError = ss.LastSQLError.String
+	re.IOErrno = ss.LastIOErrno.String
+	re.IOError = ss.LastIOError.String
+	re.MasterLogFile = ss.RelayMasterLogFile.String
+	re.MasterLogPos = ss.ExecMasterLogPos.String
+	re.Class = rplerror.Classify(re.SQLErrno, re.IOErrno)
+	if re.Class == rplerror.ClassNone {
+		return re, nil
+	}
+	re.Schema, re.Table, _ = rplerror.ParseTable(re.SQLError)
+	if action, ok := cluster.GetPlaybooks()[re.Class]; ok {
+		re.Action = action
+	}
+	return re, nil
+}
+
+func (cluster *Cluster) GetReplicationPlaybooks() PlaybookStatus {
+	st := PlaybookStatus{
+		Enabled:   cluster.Conf.ReplicationPlaybook,
+		Playbooks: cluster.GetPlaybooks(),
+		Errors:    []ReplicationError{},
+		Runs:      []PlaybookRun{},
+	}
+	for _, server := range cluster.slaves {
+		if server == nil || server.IsFailed() || server.IsIgnored() {
+			continue
+		}
+		re, err := server.GetReplicationError()
+		if err != nil || re.Class == rplerror.ClassNone {
+			continue
+		}
+		st.Errors = append(st.Errors, re)
+	}
+	cluster.playbookMutex.Lock()
+	defer cluster.playbookMutex.Unlock()
+	for i := len(cluster.playbookRuns) - 1; i >= 0; i-- {
+		st.Runs = append(st.Runs, cluster.playbookRuns[i])
+	}
+	return st
+}
+
+// playbookCounter tracks the runs of a replica, automatic runs are kept for
+// replication-playbook-window whatever the size of the run history
+type playbookCounter struct {
+	running   bool
+	last      time.Time
+	automatic []time.Time
+	approval  time.Time
+}
+
+// getPlaybookCounter returns the counter of a replica, playbookMutex must be held
+func (cluster *Cluster) getPlaybookCounter(server *ServerMonitor) *playbookCounter {
+	if cluster.playbookCounters == nil {
+		cluster.playbookCounters = make(map[string]*playbookCounter)
+	}
+	st, ok := cluster.playbookCounters[server.URL]
+	if !ok {
+		st = &playbookCounter{}
+		cluster.playbookCounters[server.URL] = st
+	}
+	return st
+}
+
+// CheckReplicationPlaybooks runs the playbook of the replicas in error, a replica is not handled twice
+// within replication-playbook-min-interval and its run is held for approval once the approval threshold is reached
+func (cluster *Cluster) CheckReplicationPlaybooks() {
+	if !cluster.Conf.ReplicationPlaybook || !cluster.IsActive() || cluster.IsInFailover() {
+		return
+	}
+	for _, server := range cluster.slaves {
+		if server == nil || server.IsFailed() || server.IsIgnored() || server.IsMaintenance {
+			continue
+		}
+		re, err := server.GetReplicationError()
+		if err != nil || re.Class == rplerror.ClassNone || re.Action == rplerror.ActionNone {
+			continue
+		}
+		running, last, count := cluster.getPlaybookRunStats(server)
+		if running || time.Since(last) < time.Duration(cluster.Conf.ReplicationPlaybookMinInterval)*time.Second {
+			continue
+		}
+		if cluster.Conf.ReplicationPlaybookApprovalThreshold > 0 && count >= cluster.Conf.ReplicationPlaybookApprovalThreshold {
+			cluster.SetState("WARN0151", state.State{ErrType: config.LvlWarn, ErrDesc: fmt.Sprintf(clusterError["WARN0151"], re.Action, re.Class, server.URL, count, cluster.Conf.ReplicationPlaybookWindow), ErrFrom: "CHECK", ServerUrl: server.URL})
+			cluster.requestPlaybookApproval(server)
+			continue
+		}
+		cluster.StartReplicationPlaybook(server, true)
+	}
+}
+
+// getPlaybookRunStats returns if a run is in progress, the start of the last run and the number of automatic
+// runs within the window, a manual run resets the count
+func (cluster *Cluster) getPlaybookRunStats(server *ServerMonitor) (bool, time.Time, int) {
+	cluster.playbookMutex.Lock()
+	defer cluster.playbookMutex.Unlock()
+	st := cluster.getPlaybookCounter(server)
+	window := time.Now().Add(-time.Duration(cluster.Conf.ReplicationPlaybookWindow) * time.Second)
+	automatic := st.automatic[:0]
+	for _, start := range st.automatic {
+		if start.After(window) {
+			automatic = append(automatic, start)
+		}
+	}
+	st.automatic = automatic
+	return st.running, st.last, len(st.automatic)
+}
+
+// requestPlaybookApproval holds the run of the replica until an approval operation is registered by the
+// server, a replica is not requested twice within approval-ttl
+func (cluster *Cluster) requestPlaybookApproval(server *ServerMonitor) {
+	cluster.playbookMutex.Lock()
+	defer cluster.playbookMutex.Unlock()
+	st := cluster.getPlaybookCounter(server)
+	if time.Since(st.approval) < time.Duration(cluster.Conf.ApprovalTTL)*time.Second {
+		return
+	}
+	st.approval = time.Now()
+	if cluster.playbookApprovals == nil {
+		cluster.playbookApprovals = make(map[string]*ServerMonitor)
+	}
+	cluster.playbookApprovals[server.URL] = server
+	cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModTopology, config.LvlInfo, "Replication playbook of %s requests approval", server.URL)
+}
+
+// PopPlaybookApprovals returns the replicas whose playbook run waits for an approval operation,
+// an approved operation runs the playbook as a manual run
+func (cluster *Cluster) PopPlaybookApprovals() []*ServerMonitor {
+	cluster.playbookMutex.Lock()
+	defer cluster.playbookMutex.Unlock()
+	servers := make([]*ServerMonitor, 0, len(cluster.playbookApprovals))
+	for _, server := range cluster.playbookApprovals {
+		servers = append(servers, server)
+	}
+	cluster.playbookApprovals = nil
+	return servers
+}
+
+// StartReplicationPlaybook runs the playbook of the replication error of the server in background and returns the run to follow
+func (cluster *Cluster) StartReplicationPlaybook(server *ServerMonitor, automatic bool) (PlaybookRun, error) {
+	re, err := server.GetReplicationError()
+	if err != nil {
+		return PlaybookRun{}, err
+	}
+	if re.Class == rplerror.ClassNone {
+		return PlaybookRun{}, ErrPlaybookNoError
+	}
+	if re.Action == rplerror.ActionNone {
+		return PlaybookRun{}, ErrPlaybookNoAction
+	}
+	cluster.playbookMutex.Lock()
+	st := cluster.getPlaybookCounter(server)
+	if st.running {
+		cluster.playbookMutex.Unlock()
+		return PlaybookRun{}, ErrPlaybookRunning
+	}
+	now := time.Now()
+	st.running = true
+	st.last = now
+	st.approval = time.Time{}
+	if automatic {
+		st.automatic = append(st.automatic, now)
+	} else {
+		st.automatic = nil
+	}
+	run := PlaybookRun{
+		ID:               strconv.FormatInt(now.UnixNano(), 36),
+		Server:           server.URL,
+		Class:            re.Class,
+		Action:           re.Action,
+		Errno:            re.SQLErrno,
+		ReplicationError: re.SQLError,
+		Automatic:        automatic,
+		Status:           JobStatusRunning,
+		Start:            now,
+		Steps:            []string{},
+	}
+	if re.Class == rplerror.ClassRelayLog || re.Class == rplerror.ClassMissingBinlog {
+		if re.SQLErrno == "" || re.SQLErrno == "0" {
+			run.Errno = re.IOErrno
+			run.ReplicationError = re.IOError
+		}
+	}
+	cluster.playbookRuns = append(cluster.playbookRuns, run)
+	if len(cluster.playbookRuns) > playbookRunHistory {
+		cluster.playbookRuns = cluster.playbookRuns[len(cluster.playbookRuns)-playbookRunHistory:]
+	}
+	cluster.playbookMutex.Unlock()
+
+	cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModTopology, config.LvlInfo, "Replication playbook %s for %s error %s on %s: %s", re.Action, re.Class, run.Errno, server.URL, run.ReplicationError)
+	go cluster.runReplicationPlaybook(run.ID, server, re)
+	return run, nil
+}
+
+func (cluster *Cluster) runReplicationPlaybook(id string, server *ServerMonitor, re ReplicationError) {
+	var err error
+	switch re.Action {
+	case rplerror.ActionSkipVerified:
+		err = cluster.playbookSkipVerified(id, server, re)
+	case rplerror.ActionFetchRow:
+		err = cluster.playbookFetchRow(id, server, re)
+	case rplerror.ActionFixRelay:
+		err = cluster.playbookFixRelay(id, server, re)
+	case rplerror.ActionReseed:
+		err = cluster.playbookReseed(id, server)
+	}
+	cluster.playbookMutex.Lock()
+	defer cluster.playbookMutex.Unlock()
+	cluster.getPlaybookCounter(server).running = false
+	for i := range cluster.playbookRuns {
+		if cluster.playbookRuns[i].ID == id {
+			cluster.playbookRuns[i].End = time.Now()
+			cluster.playbookRuns[i].Status = JobStatusSuccess
+			if err != nil {
+				cluster.playbookRuns[i].Status = JobStatusFailed
+				cluster.playbookRuns[i].Error = err.Error()
+			}
+		}
+	}
+	if err != nil {
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModTopology, config.LvlErr, "Replication playbook %s of %s failed: %s", re.Action, server.URL, err)
+	} else {
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModTopology, config.LvlInfo, "Replication playbook %s of %s done", re.Action, server.URL)
+	}
+}
+
+func (cluster *Cluster) playbookStep(id string, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModTopology, config.LvlInfo, "Replication playbook: %s", msg)
+	cluster.playbookMutex.Lock()
+	defer cluster.playbookMutex.Unlock()
+	for i := range cluster.playbookRuns {
+		if cluster.playbookRuns[i].ID == id {
+			cluster.playbookRuns[i].Steps = append(cluster.playbookRuns[i].Steps, time.Now().Format("15:04:05")+" "+msg)
+		}
+	}
+}
+
+// playbookSource returns the server the replica replicates from
+func (cluster *Cluster) playbookSource(server *ServerMonitor) (*ServerMonitor, error) {
+	source, err := cluster.GetMasterFromReplication(server)
+	if err == nil && source != nil {
+		return source, nil
+	}
+	if master := cluster.GetMaster(); master != nil && master.URL != server.URL {
+		return master, nil
+	}
+	return nil, ErrPlaybookNoMaster
+}
+
+// playbookTransactionEvents reads the failing transaction from the binary logs of the source and returns
+// its GTID and its events
+func (cluster *Cluster) playbookTransactionEvents(id string, server *ServerMonitor, re ReplicationError) (string, []ErrantEvent, error) {
+	if re.Schema == "" || re.Table == "" {
+		return "", nil, fmt.Errorf("No table found in replication error %s", re.SQLError)
+	}
+	source, err := cluster.playbookSource(server)
+	if err != nil {
+		return "", nil, err
+	}
+	pos, err := strconv.ParseUint(re.MasterLogPos, 10, 32)
+	if err != nil {
+		return "", nil, fmt.Errorf("Invalid executed position %s: %s", re.MasterLogPos, err)
+	}
+	cluster.playbookStep(id, "Read failing transaction at %s:%d from the binary logs of %s", re.MasterLogFile, pos, source.URL)
+	return source.readTransactionEvents(re.MasterLogFile, uint32(pos))
+}
+
+// playbookTableEvents returns the GTID of the failing transaction and its row events on the table of the error
+func (cluster *Cluster) playbookTableEvents(id string, server *ServerMonitor, re ReplicationError) (string, []ErrantEvent, error) {
+	trxGtid, events, err := cluster.playbookTransactionEvents(id, server, re)
+	if err != nil {
+		return "", nil, err
+	}
+	tableEvents := make([]ErrantEvent, 0)
+	for _, ev := range events {
+		if ev.Schema == re.Schema && ev.Table == re.Table {
+			tableEvents = append(tableEvents, ev)
+		}
+	}
+	if len(tableEvents) == 0 {
+		return "", nil, fmt.Errorf("No row event on %s.%s in the transaction at %s:%s", re.Schema, re.Table, re.MasterLogFile, re.MasterLogPos)
+	}
+	cluster.playbookStep(id, "Found %d row events on %s.%s in transaction %s", len(tableEvents), re.Schema, re.Table, trxGtid)
+	return trxGtid, tableEvents, nil
+}
+
+// playbookCheckSkippable refuses to skip a transaction holding a statement or writing another table than
+// the table of the error, only the rows of that table are verified on the replica
+func playbookCheckSkippable(events []ErrantEvent, re ReplicationError) error {
+	if len(events) == 0 {
+		return fmt.Errorf("No row event on %s.%s in the transaction at %s:%s", re.Schema, re.Table, re.MasterLogFile, re.MasterLogPos)
+	}
+	for _, ev := range events {
+		if ev.Type == ErrantEventQuery {
+			return fmt.Errorf("Transaction at %s:%s holds statement %s, the event is not skipped", re.MasterLogFile, re.MasterLogPos, ev.Query)
+		}
+		if ev.Schema != re.Schema || ev.Table != re.Table {
+			return fmt.Errorf("Transaction at %s:%s also writes %s.%s, the event is not skipped", re.MasterLogFile, re.MasterLogPos, ev.Schema, ev.Table)
+		}
+	}
+	return nil
+}
+
+// playbookKeyIndex returns the position of the primary key columns in the columns of the table,
+// nil when the table has no primary key
+func playbookKeyIndex(columns []string, pk []string) []int {
+	pkIndex := make([]int, 0, len(pk))
+	for _, col := range pk {
+		for i, c := range columns {
+			if c == col {
+				pkIndex = append(pkIndex, i)
+			}
+		}
+	}
+	if len(pkIndex) == 0 || len(pkIndex) != len(pk) {
+		return nil
+	}
+	return pkIndex
+}
+
+// readTransactionEvents reads the transaction starting at the binary log position of the server,
+// the returned GTID is only set for MySQL
+func (server *ServerMonitor) readTransactionEvents(file string, pos uint32) (string, []ErrantEvent, error) {
+	cluster := server.ClusterGroup
+	port, _ := strconv.Atoi(server.Port)
+	cfg := replication.BinlogSyncerConfig{
+		ServerID: uint32(cluster.Conf.CheckBinServerId),
+		Flavor:   server.DBVersion.Flavor,
+		Host:     server.Host,
+		Port:     uint16(port),
+		User:     server.User,
+		Password: server.Pass,
+	}
+	if cluster.HaveDBTLSCert {
+		cfg.TLSConfig = cluster.tlsconf
+	}
+	syncer := replication.NewBinlogSyncer(cfg)
+	defer syncer.Close()
+
+	streamer, err := syncer.StartSync(mysql.Position{Name: file, Pos: pos})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to start binlog sync: %v", err)
+	}
+
+	events := make([]ErrantEvent, 0)
+	trxGtid := ""
+	started := false
+	for i := 0; i < playbookMaxEvents; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		ev, err := streamer.GetEvent(ctx)
+		cancel()
+		if err == context.DeadlineExceeded {
+			break
+		} else if err != nil {
+			return trxGtid, events, fmt.Errorf("failed to get binlog event: %v", err)
+		}
+		ee := ErrantEvent{Gtid: trxGtid, File: file, Pos: ev.Header.LogPos, Timestamp: time.Unix(int64(ev.Header.Timestamp), 0)}
+		switch e := ev.Event.(type) {
+		case *replication.GTIDEvent:
+			started = true
+			if u, err := uuid.FromBytes(e.SID); err == nil {
+				trxGtid = fmt.Sprintf("%s:%d", u.String(), e.GNO)
+			}
+		case *replication.MariadbGTIDEvent:
+			started = true
+		case *replication.XIDEvent:
+			if started {
+				return trxGtid, events, nil
+			}
+		case *replication.QueryEvent:
+			query := string(e.Query)
+			switch strings.ToUpper(query) {
+			case "BEGIN":
+				started = true
+			case "COMMIT":
+				return trxGtid, events, nil
+			default:
+				ee.Type = ErrantEventQuery
+				ee.Schema = string(e.Schema)
+				ee.Query = query
+				events = append(events, ee)
+				return trxGtid, events, nil
+			}
+		case *replication.RowsEvent:
+			switch ev.Header.EventType {
+			case replication.WRITE_ROWS_EVENTv1, replication.WRITE_ROWS_EVENTv2:
+				ee.Type = ErrantEventInsert
+			case replication.UPDATE_ROWS_EVENTv1, replication.UPDATE_ROWS_EVENTv2:
+				ee.Type = ErrantEventUpdate
+			case replication.DELETE_ROWS_EVENTv1, replication.DELETE_ROWS_EVENTv2:
+				ee.Type = ErrantEventDelete
+			default:
+				continue
+			}
+			ee.Schema = string(e.Table.Schema)
+			ee.Table = string(e.Table.Table)
+			ee.rows = e.Rows
+			ee.unsigned = e.Table.UnsignedMap()
+			ee.Rows = len(e.Rows)
+			if ee.Type == ErrantEventUpdate {
+				ee.Rows = len(e.Rows) / 2
+			}
+			events = append(events, ee)
+		}
+	}
+	return trxGtid, events, fmt.Errorf("End of transaction at %s:%d not found in the binary logs of %s", file, pos, server.URL)
+}
+
+// playbookRowImages returns the after images of the row events, or the before images
+func playbookRowImages(events []ErrantEvent, before bool) [][]interface{} {
+	rows := make([][]interface{}, 0)
+	for _, ev := range events {
+		switch ev.Type {
+		case ErrantEventInsert:
+			if !before {
+				for _, row := range ev.rows {
+					rows = append(rows, ev.rowValues(row))
+				}
+			}
+		case ErrantEventDelete:
+			if before {
+				for _, row := range ev.rows {
+					rows = append(rows, ev.rowValues(row))
+				}
+			}
+		case ErrantEventUpdate:
+			start := 1
+			if before {
+				start = 0
+			}
+			for i := start; i < len(ev.rows); i += 2 {
+				rows = append(rows, ev.rowValues(ev.rows[i]))
+			}
+		}
+	}
+	return rows
+}
+
+// playbookSkipVerified skips the failing transaction of a duplicate key error when it only writes the table
+// of the error and the replica already holds every row it writes and none of the rows it deletes
+func (cluster *Cluster) playbookSkipVerified(id string, server *ServerMonitor, re ReplicationError) error {
+	trxGtid, events, err := cluster.playbookTransactionEvents(id, server, re)
+	if err != nil {
+		return err
+	}
+	if err := playbookCheckSkippable(events, re); err != nil {
+		return err
+	}
+	columns, logs, err := dbhelper.GetTableColumnNames(server.Conn, re.Schema, re.Table)
+	cluster.LogSQL(logs, err, server.URL, "Playbook", config.LvlErr, "Could not get columns of %s.%s on %s: %s", re.Schema, re.Table, server.URL, err)
+	if err != nil {
+		return err
+	}
+	pk, logs, err := dbhelper.GetTablePKColumns(server.Conn, re.Schema, re.Table)
+	cluster.LogSQL(logs, err, server.URL, "Playbook", config.LvlErr, "Could not get primary key of %s.%s on %s: %s", re.Schema, re.Table, server.URL, err)
+	if err != nil {
+		return err
+	}
+	pkIndex := playbookKeyIndex(columns, pk)
+	table := "`" + re.Schema + "`.`" + re.Table + "`"
+	rows := playbookRowImages(events, false)
+	cluster.playbookStep(id, "Verify %d rows of %s on %s", len(rows), table, server.URL)
+	for _, row := range rows {
+		if len(row) != len(columns) {
+			return fmt.Errorf("Table %s has %d columns but the binary log row has %d, full row image is required", table, len(columns), len(row))
+		}
+		var count int
+		err := server.Conn.QueryRowx("SELECT COUNT(*) FROM "+table+" WHERE "+errantColumnList(columns, " <=> ?", " AND "), row...).Scan(&count)
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return fmt.Errorf("Row %v of %s differs on %s, the event is not skipped", row, table, server.URL)
+		}
+	}
+	for _, ev := range events {
+		if ev.Type != ErrantEventDelete {
+			continue
+		}
+		for _, r := range ev.rows {
+			row := ev.rowValues(r)
+			if len(row) != len(columns) {
+				return fmt.Errorf("Table %s has %d columns but the binary log row has %d, full row image is required", table, len(columns), len(row))
+			}
+			where := errantColumnList(columns, " <=> ?", " AND ")
+			key := row
+			if pkIndex != nil {
+				where = errantColumnList(pk, " <=> ?", " AND ")
+				key = make([]interface{}, len(pkIndex))
+				for i, idx := range pkIndex {
+					key[i] = row[idx]
+				}
+			}
+			var count int
+			if err := server.Conn.QueryRowx("SELECT COUNT(*) FROM "+table+" WHERE "+where, key...).Scan(&count); err != nil {
+				return err
+			}
+			if count > 0 {
+				return fmt.Errorf("Row %v of %s deleted by the transaction still exists on %s, the event is not skipped", row, table, server.URL)
+			}
+		}
+	}
+	cluster.playbookStep(id, "All rows of %s already match on %s", table, server.URL)
+	if err := cluster.playbookSkip(id, server, trxGtid); err != nil {
+		return err
+	}
+	return cluster.playbookCheckResolved(id, server, re)
+}
+
+// playbookFetchRow restores the rows a failing update or delete expects, the before images are read
+// from the binary logs of the source and inserted on the replica without binary logging
+func (cluster *Cluster) playbookFetchRow(id string, server *ServerMonitor, re ReplicationError) error {
+	_, events, err := cluster.playbookTableEvents(id, server, re)
+	if err != nil {
+		return err
+	}
+	columns, logs, err := dbhelper.GetTableColumnNames(server.Conn, re.Schema, re.Table)
+	cluster.LogSQL(logs, err, server.URL, "Playbook", config.LvlErr, "Could not get columns of %s.%s on %s: %s", re.Schema, re.Table, server.URL, err)
+	if err != nil {
+		return err
+	}
+	pk, logs, err := dbhelper.GetTablePKColumns(server.Conn, re.Schema, re.Table)
+	cluster.LogSQL(logs, err, server.URL, "Playbook", config.LvlErr, "Could not get primary key of %s.%s on %s: %s", re.Schema, re.Table, server.URL, err)
+	if err != nil {
+		return err
+	}
+	pkIndex := playbookKeyIndex(columns, pk)
+	table := "`" + re.Schema + "`.`" + re.Table + "`"
+	queries := make([]string, 0)
+	args := make([][]interface{}, 0)
+	for _, row := range playbookRowImages(events, true) {
+		if len(row) != len(columns) {
+			return fmt.Errorf("Table %s has %d columns but the binary log row has %d, full row image is required", table, len(columns), len(row))
+		}
+		if pkIndex != nil {
+			key := make([]interface{}, len(pkIndex))
+			for i, idx := range pkIndex {
+				key[i] = row[idx]
+			}
+			var count int
+			if err := server.Conn.QueryRowx("SELECT COUNT(*) FROM "+table+" WHERE "+errantColumnList(pk, " <=> ?", " AND "), key...).Scan(&count); err != nil {
+				return err
+			}
+			if count > 0 {
+				continue
+			}
+		}
+		queries = append(queries, "INSERT INTO "+table+" ("+errantColumnList(columns, "", ",")+") VALUES ("+strings.TrimSuffix(strings.Repeat("?,", len(columns)), ",")+")")
+		args = append(args, row)
+	}
+	if len(queries) == 0 {
+		return fmt.Errorf("No missing row of %s found on %s", table, server.URL)
+	}
+	cluster.playbookStep(id, "Stop replication on %s", server.URL)
+	if _, err := server.StopSlave(); err != nil {
+		return fmt.Errorf("Stop replication failed: %s", err)
+	}
+	restarted := false
+	defer cluster.playbookRestartOnFailure(id, server, &restarted)
+	if server.IsReadOnly() {
+		cluster.playbookStep(id, "Set read write on %s", server.URL)
+		if err := server.SetReadWrite(); err != nil {
+			return fmt.Errorf("Set read write failed: %s", err)
+		}
+		defer func() {
+			cluster.playbookStep(id, "Set read only on %s", server.URL)
+			server.SetReadOnly()
+		}()
+	}
+	cluster.playbookStep(id, "Insert %d missing rows of %s on %s", len(queries), table, server.URL)
+	if err := server.errantApplyNoBinlog(queries, args); err != nil {
+		return fmt.Errorf("Insert missing rows failed: %s", err)
+	}
+	cluster.playbookStep(id, "Start replication on %s", server.URL)
+	restarted = true
+	if _, err := server.StartSlave(); err != nil {
+		return fmt.Errorf("Start replication failed: %s", err)
+	}
+	return cluster.playbookCheckResolved(id, server, re)
+}
+
+// playbookUsesGtid tells if the replication of the server restarts from its GTID position, MariaDB
+// with master_use_gtid and MySQL with master_auto_position
+func playbookUsesGtid(server *ServerMonitor, ss *dbhelper.SlaveStatus) bool {
+	if server.DBVersion.IsMariaDB() {
+		usingGtid := strings.ToLower(ss.UsingGtid.String)
+		return usingGtid != "" && usingGtid != "no"
+	}
+	return ss.AutoPosition.String == "1"
+}
+
+// playbookFixRelay drops the relay logs and fetches again from the last executed position of the source,
+// GTID replicas restart from their GTID position
+func (cluster *Cluster) playbookFixRelay(id string, server *ServerMonitor, re ReplicationError) error {
+	source, err := cluster.playbookSource(server)
+	if err != nil {
+		return err
+	}
+	ss, err := server.GetSlaveStatus(server.ReplicationSourceName)
+	if err != nil {
+		return err
+	}
+	cluster.playbookStep(id, "Stop replication on %s", server.URL)
+	if _, err := server.StopSlave(); err != nil {
+		return fmt.Errorf("Stop replication failed: %s", err)
+	}
+	restarted := false
+	defer cluster.playbookRestartOnFailure(id, server, &restarted)
+	if playbookUsesGtid(server, ss) {
+		cluster.playbookStep(id, "Reset relay logs of %s, replication restarts from its GTID position", server.URL)
+		logs, err := dbhelper.ResetSlave(server.Conn, false, server.ReplicationSourceName, server.DBVersion)
+		cluster.LogSQL(logs, err, server.URL, "Playbook", config.LvlErr, "Could not reset slave on %s: %s", server.URL, err)
+		if err != nil {
+			return fmt.Errorf("Reset slave failed: %s", err)
+		}
+	} else {
+		cluster.playbookStep(id, "Change master of %s to %s at %s:%s", server.URL, source.URL, re.MasterLogFile, re.MasterLogPos)
+		logs, err := dbhelper.ChangeMaster(server.Conn, dbhelper.ChangeMasterOpt{
+			Host:      source.Host,
+			Port:      source.Port,
+			User:      cluster.GetRplUser(),
+			Password:  cluster.GetRplPass(),
+			Retry:     strconv.Itoa(cluster.Conf.ForceSlaveHeartbeatRetry),
+			Heartbeat: strconv.Itoa(cluster.Conf.ForceSlaveHeartbeatTime),
+			Mode:      "POSITIONAL",
+			Logfile:   re.MasterLogFile,
+			Logpos:    re.MasterLogPos,
+			SSL:       cluster.Conf.ReplicationSSL,
+			Channel:   server.ReplicationSourceName,
+			IsDelayed: server.IsDelayed,
+			Delay:     strconv.Itoa(cluster.Conf.HostsDelayedTime),
+		}, server.DBVersion)
+		cluster.LogSQL(logs, err, server.URL, "Playbook", config.LvlErr, "Could not change master on %s: %s", server.URL, err)
+		if err != nil {
+			return fmt.Errorf("Change master failed: %s", err)
+		}
+	}
+	cluster.playbookStep(id, "Start replication on %s", server.URL)
+	restarted = true
+	if _, err := server.StartSlave(); err != nil {
+		return fmt.Errorf("Start replication failed: %s", err)
+	}
+	return cluster.playbookCheckResolved(id, server, re)
+}
+
+// playbookReseed restores the replica from the master with replication-playbook-reseed-method
+func (cluster *Cluster) playbookReseed(id string, server *ServerMonitor) error {
+	master := cluster.GetMaster()
+	if master == nil || master.URL == server.URL {
+		return ErrPlaybookNoMaster
+	}
+	method := cluster.GetPlaybookReseedMethod()
+	cluster.playbookStep(id, "Reseed %s from %s with %s", server.URL, master.URL, method)
+	var err error
+	switch method {
+	case StagingRefreshLogicalBackup:
+		err = server.JobReseedLogicalBackup("default")
+	case StagingRefreshPhysicalBackup:
+		err = server.JobReseedPhysicalBackup("default")
+	case StagingRefreshClone:
+		err = cluster.RejoinClone(master, server)
+	}
+	if err != nil {
+		return err
+	}
+	// the clone rejoin returns without reseeding state while the replica is still restarting
+	cluster.playbookStep(id, "Waiting for %s to be restored and to catch up with the master", server.URL)
+	deadline := time.Now().Add(playbookReseedTimeout)
+	for {
+		if !server.HasAnyReseedingState() && server.IsSlave && server.IsSQLThreadRunning() && server.GetReplicationDelay() <= cluster.Conf.FailMaxDelay {
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Timeout waiting for %s to catch up with the master", server.URL)
+		}
+		time.Sleep(5 * time.Second)
+	}
+	cluster.playbookStep(id, "Server %s in sync with a delay of %d", server.URL, server.GetReplicationDelay())
+	return nil
+}
+
+// playbookRestartOnFailure restarts replication stopped by a playbook step that failed,
+// the replica must not stay stopped
+func (cluster *Cluster) playbookRestartOnFailure(id string, server *ServerMonitor, restarted *bool) {
+	if *restarted {
+		return
+	}
+	cluster.playbookStep(id, "Restart replication on %s after failure", server.URL)
+	logs, err := server.StartSlave()
+	cluster.LogSQL(logs, err, server.URL, "Playbook", config.LvlErr, "Could not restart replication on %s: %s", server.URL, err)
+}
+
+// playbookSkip skips the failing transaction, MySQL GTID replicas commit an empty transaction with its GTID
+func (cluster *Cluster) playbookSkip(id string, server *ServerMonitor, trxGtid string) error {
+	cluster.playbookStep(id, "Stop replication on %s", server.URL)
+	if _, err := server.StopSlave(); err != nil {
+		return fmt.Errorf("Stop replication failed: %s", err)
+	}
+	restarted := false
+	defer cluster.playbookRestartOnFailure(id, server, &restarted)
+	if server.HasMySQLGTID() && trxGtid != "" {
+		cluster.playbookStep(id, "Inject empty transaction %s on %s", trxGtid, server.URL)
+		logs, err := dbhelper.InjectEmptyTransactions(server.Conn, []string{trxGtid})
+		cluster.LogSQL(logs, err, server.URL, "Playbook", config.LvlErr, "Could not inject empty transaction on %s: %s", server.URL, err)
+		if err != nil {
+			return fmt.Errorf("Inject empty transaction failed: %s", err)
+		}
+	} else {
+		cluster.playbookStep(id, "Skip replication event on %s", server.URL)
+		logs, err := dbhelper.SkipBinlogEvent(server.Conn, server.ReplicationSourceName, server.DBVersion)
+		cluster.LogSQL(logs, err, server.URL, "Playbook", config.LvlErr, "Could not skip replication event on %s: %s", server.URL, err)
+		if err != nil {
+			return fmt.Errorf("Skip replication event failed: %s", err)
+		}
+	}
+	cluster.playbookStep(id, "Start replication on %s", server.URL)
+	restarted = true
+	if _, err := server.StartSlave(); err != nil {
+		return fmt.Errorf("Start replication failed: %s", err)
+	}
+	return nil
+}
+
+// playbookCheckResolved waits for the replication threads to move past the failing position
+func (cluster *Cluster) playbookCheckResolved(id string, server *ServerMonitor, re ReplicationError) error {
+	deadline := time.Now().Add(playbookResolveWait)
+	for {
+		time.Sleep(3 * time.Second)
+		ss, err := server.GetSlaveStatus(server.ReplicationSourceName)
+		if err != nil {
+			return err
+		}
+		failing := ss.LastSQLErrno.String == re.SQLErrno && ss.RelayMasterLogFile.String == re.MasterLogFile && ss.ExecMasterLogPos.String == re.MasterLogPos
+		if rplerror.Classify(ss.LastSQLErrno.String, ss.LastIOErrno.String) == rplerror.ClassNone || (!failing && strings.EqualFold(ss.SlaveSQLRunning.String, "yes")) {
+			cluster.playbookStep(id, "Replication of %s resumed at %s:%s", server.URL, ss.RelayMasterLogFile.String, ss.ExecMasterLogPos.String)
+			return nil
+		}
+		if time.Now().After(deadline) {
+			if failing {
+				return fmt.Errorf("Replication of %s still fails at %s:%s: %s", server.URL, re.MasterLogFile, re.MasterLogPos, ss.LastSQLError.String)
+			}
+			return fmt.Errorf("Replication of %s fails with %s %s", server.URL, ss.LastSQLErrno.String, ss.LastSQLError.String)
+		}
+	}
+}
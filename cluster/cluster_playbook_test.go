@@ -0,0 +1,267 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/signal18/replication-manager/utils/dbhelper"
+	"github.com/signal18/replication-manager/utils/s18log"
+	"github.com/signal18/replication-manager/utils/state"
+	"github.com/signal18/replication-manager/utils/version"
+	"github.com/sirupsen/logrus"
+)
+
+func newPlaybookTestCluster() (*Cluster, *ServerMonitor) {
+	cluster := &Cluster{Name: "c1", Status: ConstMonitorActif, StateMachine: new(state.StateMachine)}
+	cluster.StateMachine.Init()
+	cluster.Conf.ReplicationPlaybook = true
+	// reseed stops on the missing master and keeps the runs short
+	cluster.Conf.ReplicationPlaybooks = "duplicate-key=reseed"
+	cluster.Conf.ReplicationPlaybookWindow = 3600
+	cluster.Conf.ReplicationPlaybookApprovalThreshold = 3
+	cluster.Conf.ApprovalTTL = 900
+	server := &ServerMonitor{URL: "db2:3306", Id: "db2", ClusterGroup: cluster, State: stateSlave}
+	server.Replications = []dbhelper.SlaveStatus{{
+		LastSQLErrno: sql.NullString{String: "1062", Valid: true},
+		LastSQLError: sql.NullString{String: "Could not execute Write_rows_v1 event on table db.t; Duplicate entry '1' for key 'PRIMARY'", Valid: true},
+	}}
+	cluster.slaves = append(cluster.slaves, server)
+	return cluster, server
+}
+
+func waitPlaybookRun(t *testing.T, cluster *Cluster, server *ServerMonitor) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if running, _, _ := cluster.getPlaybookRunStats(server); !running {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timeout waiting for the playbook run")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPlaybookRunStats(t *testing.T) {
+	cluster, server := newPlaybookTestCluster()
+	now := time.Now()
+	cluster.getPlaybookCounter(server).automatic = []time.Time{now.Add(-2 * time.Hour), now.Add(-10 * time.Minute), now.Add(-5 * time.Minute)}
+	// the run history is shared by every replica and truncated
+	for i := 0; i < playbookRunHistory; i++ {
+		cluster.playbookRuns = append(cluster.playbookRuns, PlaybookRun{Server: "db3:3306", Automatic: true, Start: now})
+	}
+	if running, _, count := cluster.getPlaybookRunStats(server); running || count != 2 {
+		t.Fatalf("Expected 2 automatic runs in the window, got %d running %t", count, running)
+	}
+	if _, err := cluster.StartReplicationPlaybook(server, true); err != nil {
+		t.Fatal(err)
+	}
+	waitPlaybookRun(t, cluster, server)
+	if _, last, count := cluster.getPlaybookRunStats(server); count != 3 || last.Before(now) {
+		t.Errorf("Expected 3 automatic runs after a run, got %d last %s", count, last)
+	}
+	if len(cluster.playbookRuns) != playbookRunHistory {
+		t.Errorf("Expected run history of %d, got %d", playbookRunHistory, len(cluster.playbookRuns))
+	}
+	if _, err := cluster.StartReplicationPlaybook(server, false); err != nil {
+		t.Fatal(err)
+	}
+	waitPlaybookRun(t, cluster, server)
+	if _, _, count := cluster.getPlaybookRunStats(server); count != 0 {
+		t.Errorf("Expected a manual run to reset the count, got %d", count)
+	}
+}
+
+func TestPlaybookRunning(t *testing.T) {
+	cluster, server := newPlaybookTestCluster()
+	cluster.getPlaybookCounter(server).running = true
+	if _, err := cluster.StartReplicationPlaybook(server, false); err != ErrPlaybookRunning {
+		t.Errorf("Expected running error, got %v", err)
+	}
+}
+
+func TestCheckReplicationPlaybooksApproval(t *testing.T) {
+	cluster, server := newPlaybookTestCluster()
+	now := time.Now()
+	cluster.getPlaybookCounter(server).automatic = []time.Time{now.Add(-30 * time.Minute), now.Add(-20 * time.Minute), now.Add(-10 * time.Minute)}
+	cluster.CheckReplicationPlaybooks()
+	if len(cluster.playbookRuns) != 0 {
+		t.Fatalf("Expected no automatic run above the threshold, got %d", len(cluster.playbookRuns))
+	}
+	servers := cluster.PopPlaybookApprovals()
+	if len(servers) != 1 || servers[0] != server {
+		t.Fatalf("Expected an approval request for %s, got %v", server.URL, servers)
+	}
+	cluster.CheckReplicationPlaybooks()
+	if servers := cluster.PopPlaybookApprovals(); len(servers) != 0 {
+		t.Errorf("Expected no new approval request within the approval ttl, got %d", len(servers))
+	}
+}
+
+func TestCheckReplicationPlaybooksSelection(t *testing.T) {
+	cluster, server := newPlaybookTestCluster()
+	cluster.StateMachine.SetFailoverState()
+	cluster.CheckReplicationPlaybooks()
+	if len(cluster.playbookRuns) != 0 {
+		t.Fatal("Expected no run during failover")
+	}
+	cluster.StateMachine.RemoveFailoverState()
+	server.IsMaintenance = true
+	cluster.CheckReplicationPlaybooks()
+	if len(cluster.playbookRuns) != 0 {
+		t.Fatal("Expected no run on a replica in maintenance")
+	}
+	server.IsMaintenance = false
+	cluster.Conf.ReplicationPlaybooks = "duplicate-key=none"
+	cluster.CheckReplicationPlaybooks()
+	if len(cluster.playbookRuns) != 0 {
+		t.Fatal("Expected no run without playbook")
+	}
+	cluster.Conf.ReplicationPlaybooks = "duplicate-key=reseed"
+	cluster.CheckReplicationPlaybooks()
+	waitPlaybookRun(t, cluster, server)
+	if len(cluster.playbookRuns) != 1 || !cluster.playbookRuns[0].Automatic || cluster.playbookRuns[0].Action != "reseed" {
+		t.Fatalf("Expected an automatic reseed run, got %v", cluster.playbookRuns)
+	}
+	cluster.Conf.ReplicationPlaybookMinInterval = 60
+	cluster.CheckReplicationPlaybooks()
+	if len(cluster.playbookRuns) != 1 {
+		t.Error("Expected no run within the min interval")
+	}
+}
+
+func TestPlaybookCheckSkippable(t *testing.T) {
+	re := ReplicationError{Schema: "db", Table: "t", MasterLogFile: "bin.000001", MasterLogPos: "120"}
+	insert := ErrantEvent{Type: ErrantEventInsert, Schema: "db", Table: "t"}
+	tests := []struct {
+		name      string
+		events    []ErrantEvent
+		skippable bool
+	}{
+		{"insert and delete on the table of the error", []ErrantEvent{insert, {Type: ErrantEventDelete, Schema: "db", Table: "t"}}, true},
+		{"update on the table of the error", []ErrantEvent{{Type: ErrantEventUpdate, Schema: "db", Table: "t"}}, true},
+		{"write on another table", []ErrantEvent{insert, {Type: ErrantEventUpdate, Schema: "db", Table: "audit"}}, false},
+		{"write on the same table of another schema", []ErrantEvent{insert, {Type: ErrantEventInsert, Schema: "db2", Table: "t"}}, false},
+		{"statement in the transaction", []ErrantEvent{insert, {Type: ErrantEventQuery, Schema: "db", Query: "DELETE FROM t"}}, false},
+		{"no row event on the table of the error", []ErrantEvent{{Type: ErrantEventInsert, Schema: "db", Table: "audit"}}, false},
+		{"empty transaction", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := playbookCheckSkippable(tt.events, re)
+			if tt.skippable && err != nil {
+				t.Errorf("Expected transaction to be skippable, got %s", err)
+			}
+			if !tt.skippable && err == nil {
+				t.Error("Expected transaction to be refused")
+			}
+		})
+	}
+}
+
+func TestPlaybookKeyIndex(t *testing.T) {
+	tests := []struct {
+		name    string
+		columns []string
+		pk      []string
+		want    []int
+	}{
+		{"single key", []string{"id", "a"}, []string{"id"}, []int{0}},
+		{"composite key in column order", []string{"a", "id", "b", "k"}, []string{"id", "k"}, []int{1, 3}},
+		{"composite key in key order", []string{"k", "a", "id"}, []string{"id", "k"}, []int{2, 0}},
+		{"missing key column", []string{"a", "b"}, []string{"id"}, nil},
+		{"no primary key", []string{"a", "b"}, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if idx := playbookKeyIndex(tt.columns, tt.pk); !reflect.DeepEqual(idx, tt.want) {
+				t.Errorf("Expected key index %v, got %v", tt.want, idx)
+			}
+		})
+	}
+}
+
+func TestPlaybookRowImages(t *testing.T) {
+	events := []ErrantEvent{
+		{Type: ErrantEventInsert, rows: [][]interface{}{{int32(1), "a"}, {int32(2), nil}}},
+		{Type: ErrantEventUpdate, rows: [][]interface{}{{int32(3), "b"}, {int32(3), "c"}}},
+		{Type: ErrantEventDelete, rows: [][]interface{}{{int32(-1), "d"}}, unsigned: map[int]bool{0: true}},
+		{Type: ErrantEventQuery},
+	}
+	tests := []struct {
+		name   string
+		before bool
+		want   [][]interface{}
+	}{
+		{"after images of inserts and updates", false, [][]interface{}{{int32(1), "a"}, {int32(2), nil}, {int32(3), "c"}}},
+		{"before images of updates and deletes", true, [][]interface{}{{int32(3), "b"}, {uint32(4294967295), "d"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rows := playbookRowImages(events, tt.before); !reflect.DeepEqual(rows, tt.want) {
+				t.Errorf("Expected rows %v, got %v", tt.want, rows)
+			}
+		})
+	}
+}
+
+func TestPlaybookSkipRestartsReplication(t *testing.T) {
+	cluster, server := newPlaybookTestCluster()
+	cluster.SQLGeneralLog = s18log.NewHttpLog(20)
+	cluster.SQLErrorLog = s18log.NewHttpLog(20)
+	cluster.SqlErrorLog = logrus.New()
+	cluster.SqlErrorLog.SetOutput(io.Discard)
+	cluster.SqlGeneralLog = logrus.New()
+	cluster.SqlGeneralLog.SetOutput(io.Discard)
+	server.DBVersion, _ = version.NewVersion("MariaDB", 10, 11, 6)
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	server.Conn = sqlx.NewDb(db, "mysql")
+	mock.ExpectExec("STOP SLAVE").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SET @@default_master_connection").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SET GLOBAL sql_slave_skip_counter").WillReturnError(errors.New("skip refused"))
+	mock.ExpectExec("START SLAVE").WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := cluster.playbookSkip("a", server, ""); err == nil {
+		t.Fatal("Expected skip failure")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Expected replication to be restarted after the failure: %s", err)
+	}
+}
+
+func TestPlaybookUsesGtid(t *testing.T) {
+	server := &ServerMonitor{}
+	server.DBVersion, _ = version.NewVersion("MariaDB", 10, 11, 6)
+	if playbookUsesGtid(server, &dbhelper.SlaveStatus{UsingGtid: sql.NullString{String: "No", Valid: true}}) {
+		t.Error("Expected positional MariaDB replication")
+	}
+	if !playbookUsesGtid(server, &dbhelper.SlaveStatus{UsingGtid: sql.NullString{String: "Slave_Pos", Valid: true}}) {
+		t.Error("Expected MariaDB GTID replication")
+	}
+	server.DBVersion, _ = version.NewVersion("MySQL", 8, 0, 36)
+	// gtid_mode=ON does not tell the channel uses master_auto_position
+	if playbookUsesGtid(server, &dbhelper.SlaveStatus{AutoPosition: sql.NullString{String: "0", Valid: true}}) {
+		t.Error("Expected positional MySQL replication without auto position")
+	}
+	if !playbookUsesGtid(server, &dbhelper.SlaveStatus{AutoPosition: sql.NullString{String: "1", Valid: true}}) {
+		t.Error("Expected MySQL auto position replication")
+	}
+}
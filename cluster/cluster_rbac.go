@@ -0,0 +1,435 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/signal18/replication-manager/config"
+	"github.com/signal18/replication-manager/utils/rbac"
+)
+
+// ErrRBACRefused wraps the changes a caller is not allowed to make on the custom roles
+var ErrRBACRefused = errors.New("Change refused")
+
+// RBACConfig is the custom roles of a cluster and the users bound to them
+type RBACConfig struct {
+	Roles    []rbac.Role         `json:"roles"`
+	Bindings map[string][]string `json:"bindings"`
+}
+
+// LoadRBAC parses the custom roles and bindings of api-rbac-roles and api-rbac-bindings,
+// invalid roles are skipped
+func (cluster *Cluster) LoadRBAC() {
+	roles, err := rbac.ParseRoles(cluster.Conf.APIRBACRoles)
+	if err != nil {
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlErr, "Invalid api-rbac-roles: %s", err)
+	}
+	bindings := rbac.ParseBindings(cluster.Conf.APIRBACBindings)
+	for user, list := range bindings {
+		for _, role := range list {
+			if _, ok := roles[role]; !ok {
+				cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlWarn, "User %s is bound to unknown role %s", user, role)
+			}
+		}
+	}
+	cluster.rbacMutex.Lock()
+	cluster.rbacRoles = roles
+	cluster.rbacBindings = bindings
+	cluster.rbacMutex.Unlock()
+}
+
+func (cluster *Cluster) GetRBAC() RBACConfig {
+	cluster.rbacMutex.RLock()
+	defer cluster.rbacMutex.RUnlock()
+	res := RBACConfig{Roles: []rbac.Role{}, Bindings: make(map[string][]string)}
+	for _, role := range cluster.rbacRoles {
+		res.Roles = append(res.Roles, role)
+	}
+	sort.Slice(res.Roles, func(i, j int) bool { return res.Roles[i].Name < res.Roles[j].Name })
+	for user, roles := range cluster.rbacBindings {
+		res.Bindings[user] = append([]string{}, roles...)
+	}
+	return res
+}
+
+// GetUserRBACRoles returns the custom roles bound to a user
+func (cluster *Cluster) GetUserRBACRoles(user string) []rbac.Role {
+	cluster.rbacMutex.RLock()
+	defer cluster.rbacMutex.RUnlock()
+	var roles []rbac.Role
+	for _, name := range cluster.rbacBindings[user] {
+		if role, ok := cluster.rbacRoles[name]; ok {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// saveRBAC writes the roles and bindings back to the configuration, the caller holds rbacMutex
+func (cluster *Cluster) saveRBAC() {
+	cluster.Conf.APIRBACRoles = rbac.FormatRoles(cluster.rbacRoles)
+	cluster.Conf.APIRBACBindings = rbac.FormatBindings(cluster.rbacBindings)
+}
+
+// CheckRBACDelegation returns an error when role allows a grant that caller does not hold
+// on the whole cluster, a user can not give more than their own effective grants
+func (cluster *Cluster) CheckRBACDelegation(caller string, role rbac.Role) error {
+	roles := cluster.GetUserRBACRoles(caller)
+	res := cluster.getRBACClusterResource()
+	for _, g := range role.AllowedGrants(cluster.getGrantList()) {
+		if !rbac.Evaluate(cluster.APIUsers[caller].Grants, roles, g, res).Allowed {
+			return fmt.Errorf("%w: user %s can not grant %s through role %s", ErrRBACRefused, caller, g, role.Name)
+		}
+	}
+	return nil
+}
+
+// holdsRBACGrant tells if caller holds grant through their acl with no deny rule of their
+// custom roles on it, whatever the scope of the rule
+func (cluster *Cluster) holdsRBACGrant(caller string, roles []rbac.Role, grant string) bool {
+	if !cluster.APIUsers[caller].Grants[grant] {
+		return false
+	}
+	for _, role := range roles {
+		for _, rule := range role.Rules {
+			if rule.Effect == rbac.EffectDeny && rule.MatchGrant(grant) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isRBACRoleBound tells if the role is bound to user
+func (cluster *Cluster) isRBACRoleBound(user string, name string) bool {
+	cluster.rbacMutex.RLock()
+	defer cluster.rbacMutex.RUnlock()
+	for _, role := range cluster.rbacBindings[user] {
+		if role == name {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckRBACDenyRemoval returns an error when replacing role old by role, or removing it with an
+// empty role, drops or changes a deny rule on a grant caller does not hold, a user can not lift
+// a restriction they are under themselves. A deny rule is kept when the new role has the same rule
+// or denies the grant without scope.
+func (cluster *Cluster) CheckRBACDenyRemoval(caller string, old rbac.Role, role rbac.Role) error {
+	roles := cluster.GetUserRBACRoles(caller)
+	kept := make(map[string]bool)
+	for _, rule := range role.Rules {
+		if rule.Effect == rbac.EffectDeny {
+			kept[rule.String()] = true
+		}
+	}
+	for _, rule := range old.Rules {
+		if rule.Effect != rbac.EffectDeny || kept[rule.String()] {
+			continue
+		}
+		for _, g := range cluster.getGrantList() {
+			if !rule.MatchGrant(g) || cluster.holdsRBACGrant(caller, roles, g) || isRBACDenied(role, g) {
+				continue
+			}
+			return fmt.Errorf("%w: user %s can not remove deny %s from role %s", ErrRBACRefused, caller, g, old.Name)
+		}
+	}
+	return nil
+}
+
+// isRBACDenied tells if role denies grant on every resource
+func isRBACDenied(role rbac.Role, grant string) bool {
+	for _, rule := range role.Rules {
+		if rule.Effect == rbac.EffectDeny && len(rule.Scopes) == 0 && rule.MatchGrant(grant) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRBACRoleChange returns an error when caller changes or drops a role bound to
+// themselves or lifts one of its deny rules
+func (cluster *Cluster) checkRBACRoleChange(caller string, name string, role rbac.Role) error {
+	cluster.rbacMutex.RLock()
+	old, ok := cluster.rbacRoles[name]
+	cluster.rbacMutex.RUnlock()
+	if !ok {
+		return nil
+	}
+	if cluster.isRBACRoleBound(caller, name) {
+		return fmt.Errorf("%w: role %s is bound to user %s", ErrRBACRefused, name, caller)
+	}
+	return cluster.CheckRBACDenyRemoval(caller, old, role)
+}
+
+// SetRBACRole creates or replaces a custom role on behalf of caller
+func (cluster *Cluster) SetRBACRole(caller string, role rbac.Role) error {
+	if err := role.Validate(); err != nil {
+		return err
+	}
+	if err := cluster.CheckRBACDelegation(caller, role); err != nil {
+		return err
+	}
+	if err := cluster.checkRBACRoleChange(caller, role.Name, role); err != nil {
+		return err
+	}
+	cluster.rbacMutex.Lock()
+	if cluster.rbacRoles == nil {
+		cluster.rbacRoles = make(map[string]rbac.Role)
+	}
+	cluster.rbacRoles[role.Name] = role
+	cluster.saveRBAC()
+	cluster.rbacMutex.Unlock()
+	cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Set custom role %s", role.String())
+	cluster.Save()
+	return nil
+}
+
+// DropRBACRole removes a custom role and its bindings on behalf of caller
+func (cluster *Cluster) DropRBACRole(caller string, name string) error {
+	if err := cluster.checkRBACRoleChange(caller, name, rbac.Role{Name: name}); err != nil {
+		return err
+	}
+	cluster.rbacMutex.Lock()
+	if _, ok := cluster.rbacRoles[name]; !ok {
+		cluster.rbacMutex.Unlock()
+		return fmt.Errorf("Role %s not found", name)
+	}
+	delete(cluster.rbacRoles, name)
+	for user, roles := range cluster.rbacBindings {
+		cluster.rbacBindings[user] = removeRBACRole(roles, name)
+	}
+	cluster.saveRBAC()
+	cluster.rbacMutex.Unlock()
+	cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Drop custom role %s", name)
+	cluster.Save()
+	return nil
+}
+
+func removeRBACRole(roles []string, name string) []string {
+	res := make([]string, 0, len(roles))
+	for _, role := range roles {
+		if role != name {
+			res = append(res, role)
+		}
+	}
+	return res
+}
+
+// BindRBACRole grants a custom role to a user of the cluster on behalf of caller
+func (cluster *Cluster) BindRBACRole(caller string, user string, name string) error {
+	if _, ok := cluster.APIUsers[user]; !ok {
+		return fmt.Errorf("User %s is not exist in cluster", user)
+	}
+	cluster.rbacMutex.RLock()
+	role, ok := cluster.rbacRoles[name]
+	cluster.rbacMutex.RUnlock()
+	if !ok {
+		return fmt.Errorf("Role %s not found", name)
+	}
+	if err := cluster.CheckRBACDelegation(caller, role); err != nil {
+		return err
+	}
+	cluster.rbacMutex.Lock()
+	if _, ok := cluster.rbacRoles[name]; !ok {
+		cluster.rbacMutex.Unlock()
+		return fmt.Errorf("Role %s not found", name)
+	}
+	if cluster.rbacBindings == nil {
+		cluster.rbacBindings = make(map[string][]string)
+	}
+	cluster.rbacBindings[user] = append(removeRBACRole(cluster.rbacBindings[user], name), name)
+	cluster.saveRBAC()
+	cluster.rbacMutex.Unlock()
+	cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Bind custom role %s to user %s", name, user)
+	cluster.Save()
+	return nil
+}
+
+// UnbindRBACRole removes a custom role from a user on behalf of caller, a user can not unbind
+// their own roles nor lift from another user a deny rule they are under
+func (cluster *Cluster) UnbindRBACRole(caller string, user string, name string) error {
+	if user == caller {
+		return fmt.Errorf("%w: user %s can not unbind their own role %s", ErrRBACRefused, caller, name)
+	}
+	cluster.rbacMutex.RLock()
+	role, ok := cluster.rbacRoles[name]
+	cluster.rbacMutex.RUnlock()
+	if ok {
+		if err := cluster.CheckRBACDenyRemoval(caller, role, rbac.Role{Name: name}); err != nil {
+			return err
+		}
+	}
+	cluster.rbacMutex.Lock()
+	roles := removeRBACRole(cluster.rbacBindings[user], name)
+	if len(roles) == len(cluster.rbacBindings[user]) {
+		cluster.rbacMutex.Unlock()
+		return fmt.Errorf("Role %s is not bound to user %s", name, user)
+	}
+	cluster.rbacBindings[user] = roles
+	cluster.saveRBAC()
+	cluster.rbacMutex.Unlock()
+	cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Unbind custom role %s from user %s", name, user)
+	cluster.Save()
+	return nil
+}
+
+func (cluster *Cluster) getRBACServerResource(server *ServerMonitor) rbac.Resource {
+	res := rbac.Resource{
+		Kind:    rbac.KindServer,
+		Name:    server.Id,
+		Aliases: []string{server.Name, server.URL, server.Host, server.Host + ":" + server.Port, server.IP + ":" + server.Port},
+		Tags:    strings.Fields(server.ReplicationTags),
+	}
+	if server.IsMaster() {
+		res.Role = "master"
+	} else if server.IsSlaveOrSync() {
+		res.Role = "slave"
+	}
+	return res
+}
+
+// getRBACProxyResource tags a proxy with its type
+func (cluster *Cluster) getRBACProxyResource(pr DatabaseProxy) rbac.Resource {
+	return rbac.Resource{
+		Kind:    rbac.KindProxy,
+		Name:    pr.GetId(),
+		Aliases: []string{pr.GetName(), pr.GetHost(), pr.GetHost() + ":" + pr.GetPort()},
+		Tags:    []string{pr.GetType()},
+	}
+}
+
+func (cluster *Cluster) getRBACClusterResource() rbac.Resource {
+	return rbac.Resource{
+		Kind: rbac.KindCluster,
+		Name: cluster.Name,
+	}
+}
+
+// rbacMasterActions are the cluster actions acting on the master, they are scoped
+// on the master server so role:master rules apply to them
+var rbacMasterActions = map[string]bool{
+	"switchover":             true,
+	"failover":               true,
+	"master-physical-backup": true,
+}
+
+// GetRBACResource returns the server, proxy or cluster targeted by an API URL
+func (cluster *Cluster) GetRBACResource(URL string) rbac.Resource {
+	prefix := "/api/clusters/" + cluster.Name + "/"
+	if !strings.HasPrefix(URL, prefix) {
+		return cluster.getRBACClusterResource()
+	}
+	parts := strings.Split(strings.TrimPrefix(URL, prefix), "/")
+	if len(parts) >= 2 && parts[0] == "actions" && rbacMasterActions[parts[1]] {
+		if master := cluster.GetMaster(); master != nil {
+			return cluster.getRBACServerResource(master)
+		}
+	}
+	if len(parts) < 2 || parts[1] == "" || parts[1] == "actions" {
+		return cluster.getRBACClusterResource()
+	}
+	switch parts[0] {
+	case "servers":
+		server := cluster.GetServerFromName(parts[1])
+		if server == nil && len(parts) > 2 {
+			// servers/{serverName}/{serverPort}/...
+			if _, err := strconv.Atoi(parts[2]); err == nil {
+				server = cluster.GetServerFromURL(parts[1] + ":" + parts[2])
+			}
+		}
+		if server == nil {
+			server = cluster.GetServerFromURL(parts[1])
+		}
+		if server != nil {
+			return cluster.getRBACServerResource(server)
+		}
+		return rbac.Resource{Kind: rbac.KindServer, Name: parts[1]}
+	case "proxies":
+		pr := cluster.GetProxyFromName(parts[1])
+		if pr == nil {
+			pr = cluster.GetProxyFromURL(parts[1])
+		}
+		if pr != nil {
+			return cluster.getRBACProxyResource(pr)
+		}
+		return rbac.Resource{Kind: rbac.KindProxy, Name: parts[1]}
+	}
+	return cluster.getRBACClusterResource()
+}
+
+// GetRBACResourceFromString resolves cluster, server:<name> or proxy:<name>
+func (cluster *Cluster) GetRBACResourceFromString(resource string) (rbac.Resource, error) {
+	kind, name, _ := strings.Cut(resource, ":")
+	switch kind {
+	case "", rbac.KindCluster:
+		return cluster.getRBACClusterResource(), nil
+	case rbac.KindServer:
+		server := cluster.GetServerFromName(name)
+		if server == nil {
+			server = cluster.GetServerFromURL(name)
+		}
+		if server == nil {
+			return rbac.Resource{}, fmt.Errorf("Server %s not found", name)
+		}
+		return cluster.getRBACServerResource(server), nil
+	case rbac.KindProxy:
+		pr := cluster.GetProxyFromName(name)
+		if pr == nil {
+			pr = cluster.GetProxyFromURL(name)
+		}
+		if pr == nil {
+			return rbac.Resource{}, fmt.Errorf("Proxy %s not found", name)
+		}
+		return cluster.getRBACProxyResource(pr), nil
+	}
+	return rbac.Resource{}, fmt.Errorf("Invalid resource %s expecting cluster, server:<name> or proxy:<name>", resource)
+}
+
+// GetUserGrantsOnURL returns the grants of a user on the resource of an API URL, users
+// without custom roles keep their acl grants
+func (cluster *Cluster) GetUserGrantsOnURL(user string, URL string) map[string]bool {
+	roles := cluster.GetUserRBACRoles(user)
+	if len(roles) == 0 {
+		return cluster.APIUsers[user].Grants
+	}
+	return rbac.EffectiveGrants(cluster.APIUsers[user].Grants, roles, cluster.getGrantList(), cluster.GetRBACResource(URL))
+}
+
+func (cluster *Cluster) getGrantList() []string {
+	grants := make([]string, 0, len(cluster.Grants))
+	for _, grant := range cluster.Grants {
+		grants = append(grants, grant)
+	}
+	return grants
+}
+
+// EvaluateRBAC answers whether user can use grant on resource
+func (cluster *Cluster) EvaluateRBAC(user string, grant string, resource string) (rbac.Decision, error) {
+	if _, ok := cluster.APIUsers[user]; !ok {
+		return rbac.Decision{}, fmt.Errorf("User %s is not exist in cluster", user)
+	}
+	if _, ok := config.GetGrantType()[grant]; !ok {
+		return rbac.Decision{}, fmt.Errorf("Unknown grant %s", grant)
+	}
+	res, err := cluster.GetRBACResourceFromString(resource)
+	if err != nil {
+		return rbac.Decision{}, err
+	}
+	d := rbac.Evaluate(cluster.APIUsers[user].Grants, cluster.GetUserRBACRoles(user), grant, res)
+	d.User = user
+	return d, nil
+}
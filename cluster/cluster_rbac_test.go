@@ -0,0 +1,125 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/signal18/replication-manager/utils/rbac"
+)
+
+func newRBACTestCluster() *Cluster {
+	master := &ServerMonitor{Id: "db1", Name: "db1", Host: "db1", Port: "3306", ReplicationTags: " ROW GTID_STRICT_MODE"}
+	slave := &ServerMonitor{Id: "db2", Name: "db2", Host: "db2", Port: "3306", ReplicationTags: " READ_ONLY ROW"}
+	cluster := &Cluster{Name: "c1", Servers: serverList{master, slave}, master: master}
+	master.ClusterGroup = cluster
+	slave.ClusterGroup = cluster
+	cluster.Grants = map[string]string{"cluster-switchover": "cluster-switchover", "db-backup": "db-backup", "db-stop": "db-stop", "grant-modify": "grant-modify"}
+	cluster.APIUsers = map[string]APIUser{
+		"admin": {User: "admin", Grants: map[string]bool{"cluster-switchover": true, "db-backup": true, "db-stop": true, "grant-modify": true}},
+		"lead":  {User: "lead", Grants: map[string]bool{"db-backup": true, "grant-modify": true}},
+		"dev":   {User: "dev", Grants: map[string]bool{}},
+	}
+	return cluster
+}
+
+func TestRBACResource(t *testing.T) {
+	cluster := newRBACTestCluster()
+	res := cluster.GetRBACResource("/api/clusters/c1/actions/switchover")
+	if res.Kind != rbac.KindServer || res.Name != "db1" || res.Role != "master" {
+		t.Errorf("Expected switchover to target the master, got %+v", res)
+	}
+	res = cluster.GetRBACResource("/api/clusters/c1/servers/db2/actions/stop")
+	if res.Name != "db2" || len(res.Tags) != 2 || res.Tags[0] != "READ_ONLY" {
+		t.Errorf("Expected the tags of db2, got %+v", res)
+	}
+	res = cluster.GetRBACResource("/api/clusters/c1/settings/actions/switch/failover-mode")
+	if res.Kind != rbac.KindCluster || len(res.Tags) != 0 {
+		t.Errorf("Expected the cluster without tags, got %+v", res)
+	}
+
+	role, _ := rbac.ParseRole("no-master=deny cluster-switchover on role:master;allow db-stop on tag:READ_ONLY")
+	cluster.rbacRoles = map[string]rbac.Role{role.Name: role}
+	cluster.rbacBindings = map[string][]string{"admin": {role.Name}}
+	if cluster.GetUserGrantsOnURL("admin", "/api/clusters/c1/actions/switchover")["cluster-switchover"] {
+		t.Error("Expected role:master deny rule to apply to switchover")
+	}
+	cluster.APIUsers["admin"].Grants["db-stop"] = false
+	if !cluster.GetUserGrantsOnURL("admin", "/api/clusters/c1/servers/db2/actions/stop")["db-stop"] {
+		t.Error("Expected tag rule to allow stopping the read only replica")
+	}
+	if cluster.GetUserGrantsOnURL("admin", "/api/clusters/c1/servers/db1/actions/stop")["db-stop"] {
+		t.Error("Expected tag rule not to match the master")
+	}
+}
+
+func TestRBACDelegation(t *testing.T) {
+	cluster := newRBACTestCluster()
+	all, _ := rbac.ParseRole("all=allow *")
+	backup, _ := rbac.ParseRole("backup=allow db-backup on role:slave")
+	if err := cluster.CheckRBACDelegation("admin", all); err != nil {
+		t.Errorf("Admin holds every grant: %s", err)
+	}
+	if err := cluster.CheckRBACDelegation("lead", all); err == nil {
+		t.Error("Expected lead not to grant allow *")
+	}
+	if err := cluster.CheckRBACDelegation("lead", backup); err != nil {
+		t.Errorf("Lead holds db-backup: %s", err)
+	}
+	if err := cluster.CheckRBACDelegation("dev", backup); err == nil {
+		t.Error("Expected dev not to grant db-backup")
+	}
+	cluster.rbacRoles = map[string]rbac.Role{all.Name: all}
+	if err := cluster.BindRBACRole("lead", "lead", all.Name); err == nil {
+		t.Error("Expected lead not to bind allow * to themselves")
+	}
+}
+
+func TestRBACDenyRemoval(t *testing.T) {
+	cluster := newRBACTestCluster()
+	restrict, _ := rbac.ParseRole("restrict=deny db-stop;deny cluster-switchover on role:master")
+	other, _ := rbac.ParseRole("other=deny db-stop on role:master")
+	cluster.rbacRoles = map[string]rbac.Role{restrict.Name: restrict, other.Name: other}
+	cluster.rbacBindings = map[string][]string{"lead": {restrict.Name}, "dev": {other.Name}}
+
+	// lead is denied db-stop and can not lift the restriction, even through a look alike role
+	weak, _ := rbac.ParseRole("restrict=deny cluster-switchover on role:master")
+	for name, err := range map[string]error{
+		"set":         cluster.SetRBACRole("lead", weak),
+		"drop":        cluster.DropRBACRole("lead", restrict.Name),
+		"unbind self": cluster.UnbindRBACRole("lead", "lead", restrict.Name),
+		"unbind dev":  cluster.UnbindRBACRole("lead", "dev", other.Name),
+		"drop other":  cluster.DropRBACRole("lead", other.Name),
+	} {
+		if !errors.Is(err, ErrRBACRefused) {
+			t.Errorf("Expected %s to be refused to lead, got %v", name, err)
+		}
+	}
+	if len(cluster.rbacRoles) != 2 || len(cluster.rbacBindings["lead"]) != 1 || len(cluster.rbacBindings["dev"]) != 1 {
+		t.Fatalf("Expected roles and bindings unchanged, got %v %v", cluster.rbacRoles, cluster.rbacBindings)
+	}
+	// narrowing the scope of the deny is a weaker deny
+	narrow, _ := rbac.ParseRole("other=deny db-stop on server:db9")
+	if err := cluster.CheckRBACDenyRemoval("lead", other, narrow); !errors.Is(err, ErrRBACRefused) {
+		t.Errorf("Expected narrowed deny to be refused, got %v", err)
+	}
+	wide, _ := rbac.ParseRole("other=deny db-stop;allow db-backup")
+	if err := cluster.CheckRBACDenyRemoval("lead", other, wide); err != nil {
+		t.Errorf("Expected a wider deny to be accepted, got %s", err)
+	}
+	// admin holds every grant without restriction
+	if err := cluster.CheckRBACDenyRemoval("admin", restrict, rbac.Role{Name: restrict.Name}); err != nil {
+		t.Errorf("Expected admin to drop the restriction, got %s", err)
+	}
+	if err := cluster.checkRBACRoleChange("admin", restrict.Name, weak); err != nil {
+		t.Errorf("Expected admin to change the role of lead, got %s", err)
+	}
+}
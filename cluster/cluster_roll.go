@@ -85,6 +85,9 @@ func (cluster *Cluster) RollingReprov() error {
 }
 
 func (cluster *Cluster) RollingRestart() error {
+	if cluster.IsWsrep() {
+		return cluster.wsrepRollingRestart("")
+	}
 	cluster.SetInRollingRestart(true)
 	defer cluster.SetInRollingRestart(false)
 
@@ -50,6 +50,8 @@ func (cluster *Cluster) RotatePasswords() error {
 				if err != nil {
 					cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModVault, config.LvlInfo, "unable to rotate passwords for %s static role: %v", cluster.GetDbUser(), err)
 				}
+				cluster.expireVaultDatabaseSecret(cluster.Conf.User, 0)
+				cluster.expireVaultDatabaseSecret(cluster.Conf.RplUser, 0)
 			} else {
 
 				err := client.KVv1("").Put(context.Background(), "database/rotate-role/"+cluster.GetDbUser(), nil)
@@ -61,6 +63,8 @@ func (cluster *Cluster) RotatePasswords() error {
 				if err != nil {
 					cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModVault, config.LvlInfo, "unable to rotate passwords for %s static role: %v", cluster.GetRplUser(), err)
 				}
+				cluster.expireVaultDatabaseSecret(cluster.Conf.User, 0)
+				cluster.expireVaultDatabaseSecret(cluster.Conf.RplUser, 0)
 			}
 		} else {
 			cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModVault, config.LvlInfo, "Vault config store v2 mode activated")
@@ -151,14 +155,12 @@ func (cluster *Cluster) RotatePasswords() error {
 				}
 			}
 			for _, s := range cluster.slaves {
-
-				for _, ss := range s.Replications {
-					err = s.rejoinSlaveChangePassword(&ss)
+				for i := range s.Replications {
+					err = s.changeChannelCredentials(&s.Replications[i])
 					if err != nil {
-						cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModVault, config.LvlErr, "Fail of rejoinSlaveChangePassword during rotation password ", err)
+						cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModVault, config.LvlErr, "Fail of rejoinSlaveChangePassword during rotation password %s", err)
 					}
 				}
-
 			}
 
 			if cluster.GetConf().ProxysqlOn && cluster.HasAllProxyUp() && cluster.Conf.IsPath(cluster.Conf.ProxysqlPassword) {
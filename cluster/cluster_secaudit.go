@@ -0,0 +1,216 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/signal18/replication-manager/config"
+	"github.com/signal18/replication-manager/utils/dbhelper"
+	"github.com/signal18/replication-manager/utils/misc"
+	"github.com/signal18/replication-manager/utils/secaudit"
+	"github.com/signal18/replication-manager/utils/state"
+)
+
+// securityAuditStates maps every check to the state raised on the server
+var securityAuditStates = map[string]string{
+	secaudit.CheckAnonymousUser:   "WARN0140",
+	secaudit.CheckEmptyPassword:   "WARN0141",
+	secaudit.CheckRemoteSuper:     "WARN0142",
+	secaudit.CheckSecureTransport: "WARN0143",
+	secaudit.CheckReplicationTLS:  "WARN0144",
+	secaudit.CheckLocalInfile:     "WARN0145",
+	secaudit.CheckAdvisory:        "WARN0146",
+	secaudit.CheckDatadirReadable: "WARN0147",
+}
+
+// GetSecurityAudit returns the findings of the last audit
+func (cluster *Cluster) GetSecurityAudit() []secaudit.Finding {
+	cluster.secAuditMutex.Lock()
+	defer cluster.secAuditMutex.Unlock()
+	return append([]secaudit.Finding{}, cluster.secAuditFindings...)
+}
+
+// AuditSecurity audits every database server that is up and keeps the findings for the report
+func (cluster *Cluster) AuditSecurity() []secaudit.Finding {
+	advs, err := secaudit.LoadAdvisories(cluster.Conf.SecurityAuditAdvisoriesFile)
+	if err != nil {
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlErr, "Security audit could not load advisories: %s", err)
+	}
+	var findings []secaudit.Finding
+	for _, server := range cluster.Servers {
+		if server.IsDown() || server.Conn == nil || server.DBVersion == nil || server.DBVersion.IsPostgreSQL() {
+			continue
+		}
+		findings = append(findings, server.AuditSecurity(advs)...)
+	}
+	secaudit.Sort(findings)
+	cluster.secAuditMutex.Lock()
+	cluster.secAuditFindings = findings
+	cluster.secAuditMutex.Unlock()
+	return findings
+}
+
+// AuditSecurity returns the findings of the server, checks that can not run are logged and skipped
+func (server *ServerMonitor) AuditSecurity(advs []secaudit.Advisory) []secaudit.Finding {
+	cluster := server.ClusterGroup
+	var findings []secaudit.Finding
+	accounts, logs, err := dbhelper.GetUserAccounts(server.Conn, server.DBVersion)
+	cluster.LogSQL(logs, err, server.URL, "Security", config.LvlErr, "Security audit could not read users: %s", err)
+	if err == nil {
+		list := make([]secaudit.Account, 0, len(accounts))
+		for _, a := range accounts {
+			list = append(list, secaudit.Account(a))
+		}
+		findings = append(findings, secaudit.CheckAccounts(server.URL, list)...)
+	}
+	findings = append(findings, secaudit.CheckVariables(server.URL, server.Variables.ToNewMap())...)
+	for _, rep := range server.Replications {
+		if rep.MasterHost.String == "" {
+			continue
+		}
+		findings = append(findings, secaudit.CheckReplicationChannel(server.URL, rep.ConnectionName.String, rep.MasterSSLAllowed.String)...)
+	}
+	findings = append(findings, secaudit.CheckAdvisories(server.URL, server.DBVersion, advs)...)
+	datadir := server.Variables.Get("DATADIR")
+	if datadir != "" {
+		mode, err := server.getDatadirMode(datadir)
+		if err != nil {
+			cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlDbg, "Security audit skip datadir of %s: %s", server.URL, err)
+		} else {
+			findings = append(findings, secaudit.CheckDatadirMode(server.URL, datadir, mode)...)
+		}
+	}
+	return findings
+}
+
+// getDatadirMode stats the datadir on the local host or through onpremise ssh
+func (server *ServerMonitor) getDatadirMode(datadir string) (os.FileMode, error) {
+	cluster := server.ClusterGroup
+	switch misc.Unbracket(server.Host) {
+	case "127.0.0.1", "localhost", "::1":
+		fi, err := os.Stat(datadir)
+		if err != nil {
+			return 0, err
+		}
+		return fi.Mode(), nil
+	}
+	if !cluster.Conf.OnPremiseSSH {
+		return 0, errors.New("datadir is not local and onpremise-ssh is disabled")
+	}
+	if strings.ContainsAny(datadir, "'\n") {
+		return 0, errors.New("unexpected datadir " + datadir)
+	}
+	client, err := cluster.OnPremiseConnect(server)
+	if err != nil {
+		return 0, err
+	}
+	defer client.Close()
+	out, err := client.Cmd("stat -c %a '" + datadir + "'").SmartOutput()
+	if err != nil {
+		return 0, err
+	}
+	perm, err := strconv.ParseUint(strings.TrimSpace(string(out)), 8, 32)
+	if err != nil {
+		return 0, err
+	}
+	return os.ModeDir | os.FileMode(perm), nil
+}
+
+// FixSecurityFindings runs the fix of every finding that has one on its server
+func (cluster *Cluster) FixSecurityFindings(findings []secaudit.Finding) []secaudit.Finding {
+	for i := range findings {
+		f := &findings[i]
+		if f.Fix == "" || f.Fixed {
+			continue
+		}
+		server := cluster.GetServerFromURL(f.Server)
+		if server == nil {
+			f.Error = "server not found"
+			continue
+		}
+		// grants and users are local to every server, do not replicate the fix
+		err := server.ExecQueryNoBinLog(f.Fix, time.Duration(cluster.Conf.Timeout)*time.Second)
+		if err != nil {
+			f.Error = err.Error()
+			continue
+		}
+		f.Fixed = true
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Security audit fixed %s %s on %s: %s", f.Check, f.Object, f.Server, f.Fix)
+	}
+	return findings
+}
+
+// FixSecurityAudit audits the servers and fixes what can be fixed
+func (cluster *Cluster) FixSecurityAudit() []secaudit.Finding {
+	findings := cluster.FixSecurityFindings(cluster.AuditSecurity())
+	cluster.secAuditMutex.Lock()
+	cluster.secAuditFindings = findings
+	cluster.secAuditMutex.Unlock()
+	return findings
+}
+
+// CheckSecurityAudit raises a state per server and check, findings are fixed when
+// security-audit-autofix is set
+func (cluster *Cluster) CheckSecurityAudit() {
+	if !cluster.Conf.SecurityAuditCheck {
+		return
+	}
+	// remote datadir checks go through ssh and may wait for its timeout
+	cluster.secAuditMutex.Lock()
+	if cluster.inSecurityAudit {
+		cluster.secAuditMutex.Unlock()
+		return
+	}
+	cluster.inSecurityAudit = true
+	cluster.secAuditMutex.Unlock()
+	defer func() {
+		cluster.secAuditMutex.Lock()
+		cluster.inSecurityAudit = false
+		cluster.secAuditMutex.Unlock()
+	}()
+	var findings []secaudit.Finding
+	if cluster.Conf.SecurityAuditAutofix {
+		findings = cluster.FixSecurityAudit()
+	} else {
+		findings = cluster.AuditSecurity()
+	}
+	type group struct {
+		severity secaudit.Severity
+		objects  []string
+	}
+	groups := make(map[string]*group)
+	var keys []string
+	for _, f := range findings {
+		if f.Fixed {
+			continue
+		}
+		key := f.Check + "@" + f.Server
+		g, ok := groups[key]
+		if !ok {
+			// findings are sorted, the first one of a group has the highest severity
+			g = &group{severity: f.Severity}
+			groups[key] = g
+			keys = append(keys, key)
+		}
+		g.objects = append(g.objects, f.Object)
+	}
+	for _, key := range keys {
+		check, server, _ := strings.Cut(key, "@")
+		code := securityAuditStates[check]
+		g := groups[key]
+		cluster.SetState(code, state.State{ErrType: "WARNING", ErrDesc: fmt.Sprintf(clusterError[code], g.severity, server, strings.Join(g.objects, ", ")), ErrFrom: "TOPO", ServerUrl: server})
+	}
+}
@@ -347,6 +347,28 @@ func (cluster *Cluster) SetSchedulerAlertDisable() {
 	}
 }
 
+func (cluster *Cluster) SetSchedulerStagingRefresh() {
+	if cluster.scheduler == nil {
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Scheduler is disable cancel")
+		return
+	}
+	if cluster.HasSchedulerEntry("stagingrefresh") {
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Stopping scheduler to refresh staging")
+		cluster.scheduler.Remove(cluster.idSchedulerStagingRefresh)
+		delete(cluster.Schedule, "stagingrefresh")
+	}
+	if cluster.Conf.SchedulerStagingRefresh && cluster.Conf.TopologyStaging {
+		var err error
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Schedule staging refresh at: %s", cluster.Conf.SchedulerStagingRefreshCron)
+		cluster.idSchedulerStagingRefresh, err = cluster.scheduler.AddFunc(cluster.Conf.SchedulerStagingRefreshCron, func() {
+			cluster.StagingCycle()
+		})
+		if err == nil {
+			cluster.Schedule["stagingrefresh"] = cluster.scheduler.Entry(cluster.idSchedulerStagingRefresh)
+		}
+	}
+}
+
 func (cluster *Cluster) CompressBackups() {
 	//cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral,LvlInfo, "COUCOU compress backups")
 }
@@ -1561,6 +1583,15 @@ func (cluster *Cluster) SetSwitchoverWaitRouteChange(value string) error {
 	return nil
 }
 
+func (cluster *Cluster) SetSwitchoverDrainTimeout(value string) error {
+	numvalue, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return err
+	}
+	cluster.Conf.SwitchDrainTimeout = numvalue
+	return nil
+}
+
 func (cluster *Cluster) SetBackupBinlogsKeep(value string) error {
 	numvalue, err := strconv.Atoi(value)
 	if err != nil {
@@ -1615,6 +1646,12 @@ func (cluster *Cluster) SetSchedulerAlertDisableCron(value string) error {
 	return nil
 }
 
+func (cluster *Cluster) SetSchedulerStagingRefreshCron(value string) error {
+	cluster.Conf.SchedulerStagingRefreshCron = value
+	cluster.SetSchedulerStagingRefresh()
+	return nil
+}
+
 func (cluster *Cluster) SetDbServerHosts(value string) error {
 	cluster.Conf.Hosts = value
 	cluster.hostList = make([]string, 0)
@@ -1995,10 +2032,12 @@ func (cluster *Cluster) SetLogBinlogPurgeLevel(value int) {
 
 func (cluster *Cluster) SetInPhysicalBackupState(value bool) {
 	cluster.InPhysicalBackup = value
+	cluster.setWsrepBackupDesync(value)
 }
 
 func (cluster *Cluster) SetInLogicalBackupState(value bool) {
 	cluster.InLogicalBackup = value
+	cluster.setWsrepBackupDesync(value)
 }
 
 func (cluster *Cluster) SetInBinlogBackupState(value bool) {
@@ -2228,3 +2267,134 @@ func (cluster *Cluster) SetResticVersion() error {
 func (cluster *Cluster) SetInRollingRestart(value bool) {
 	cluster.InRollingRestart = value
 }
+
+func (cluster *Cluster) SetDBServersSites(value string) {
+	cluster.Conf.DBServersSites = value
+	for _, server := range cluster.Servers {
+		server.Site = server.GetSite()
+	}
+}
+
+func (cluster *Cluster) SetMonitoringSite(value string) {
+	cluster.Conf.MonitoringSite = value
+}
+
+func (cluster *Cluster) SetFailoverSitePolicy(value string) error {
+	switch value {
+	case SitePolicyAny, SitePolicyPreferLocal, SitePolicyLocalOnly, SitePolicyManualCrossSite:
+		cluster.Conf.FailoverSitePolicy = value
+		return nil
+	}
+	return fmt.Errorf("Unknown failover site policy %s", value)
+}
+
+func (cluster *Cluster) SetConsistencyCheckChunkSize(value string) error {
+	numvalue, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	cluster.Conf.ConsistencyCheckChunkSize = numvalue
+	return nil
+}
+
+func (cluster *Cluster) SetConsistencyCheckChunkRate(value string) error {
+	numvalue, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	cluster.Conf.ConsistencyCheckChunkRate = numvalue
+	return nil
+}
+
+func (cluster *Cluster) SetConsistencyCheckMaxLag(value string) error {
+	numvalue, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	cluster.Conf.ConsistencyCheckMaxLag = numvalue
+	return nil
+}
+
+func (cluster *Cluster) SetConsistencyCheckInterval(value string) error {
+	numvalue, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	cluster.Conf.ConsistencyCheckInterval = numvalue
+	return nil
+}
+
+func (cluster *Cluster) SetWsrepNonPrimaryTimeout(value string) error {
+	numvalue, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	cluster.Conf.WsrepNonPrimaryTimeout = numvalue
+	return nil
+}
+
+func (cluster *Cluster) SetWsrepFlowControlMaxPaused(value string) error {
+	numvalue, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	cluster.Conf.WsrepFlowControlMaxPaused = numvalue
+	return nil
+}
+
+func (cluster *Cluster) SetWsrepSyncTimeout(value string) error {
+	numvalue, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	cluster.Conf.WsrepSyncTimeout = numvalue
+	return nil
+}
+
+func (cluster *Cluster) SetMultiMasterGrouprepMemberWeights(value string) {
+	cluster.Conf.MultiMasterGrouprepMemberWeights = value
+}
+
+func (cluster *Cluster) SetMultiMasterGrouprepRejoinInterval(value string) error {
+	numvalue, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	cluster.Conf.MultiMasterGrouprepRejoinInterval = numvalue
+	return nil
+}
+
+func (cluster *Cluster) SetReplicationPlaybooks(value string) {
+	cluster.Conf.ReplicationPlaybooks = value
+}
+
+func (cluster *Cluster) SetReplicationPlaybookMinInterval(value string) error {
+	numvalue, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	cluster.Conf.ReplicationPlaybookMinInterval = numvalue
+	return nil
+}
+
+func (cluster *Cluster) SetReplicationPlaybookWindow(value string) error {
+	numvalue, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	cluster.Conf.ReplicationPlaybookWindow = numvalue
+	return nil
+}
+
+func (cluster *Cluster) SetReplicationPlaybookApprovalThreshold(value string) error {
+	numvalue, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	cluster.Conf.ReplicationPlaybookApprovalThreshold = numvalue
+	return nil
+}
+
+func (cluster *Cluster) SetReplicationPlaybookReseedMethod(value string) {
+	cluster.Conf.ReplicationPlaybookReseedMethod = value
+}
@@ -0,0 +1,209 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/signal18/replication-manager/config"
+	"github.com/signal18/replication-manager/utils/state"
+)
+
+const (
+	SitePolicyAny             = "any"
+	SitePolicyPreferLocal     = "prefer-local"
+	SitePolicyLocalOnly       = "local-only"
+	SitePolicyManualCrossSite = "manual-cross-site"
+)
+
+// SiteHealth is the view of one site from this monitor.
+// A site is reachable when at least one of its servers is up, it has quorum
+// when a majority of its servers is up.
+type SiteHealth struct {
+	Name           string   `json:"name"`
+	IsMonitorSite  bool     `json:"isMonitorSite"`
+	IsFailoverSite bool     `json:"isFailoverSite"`
+	HasMaster      bool     `json:"hasMaster"`
+	Servers        []string `json:"servers"`
+	Up             int      `json:"up"`
+	Failed         int      `json:"failed"`
+	Reachable      bool     `json:"reachable"`
+	HasQuorum      bool     `json:"hasQuorum"`
+}
+
+type SiteStatus struct {
+	Policy          string       `json:"policy"`
+	Quorum          bool         `json:"quorum"`
+	MonitoringSite  string       `json:"monitoringSite"`
+	FailoverSite    string       `json:"failoverSite"`
+	QuorumConfirmed bool         `json:"quorumConfirmed"`
+	Sites           []SiteHealth `json:"sites"`
+}
+
+func (cluster *Cluster) HasSites() bool {
+	return cluster.Conf.DBServersSites != ""
+}
+
+// GetSitesHosts parses db-servers-sites site=host:port|host:port,site=...
+func (cluster *Cluster) GetSitesHosts() map[string][]string {
+	sites := make(map[string][]string)
+	for _, def := range strings.Split(cluster.Conf.DBServersSites, ",") {
+		pair := strings.SplitN(strings.TrimSpace(def), "=", 2)
+		if len(pair) != 2 || pair[0] == "" {
+			continue
+		}
+		for _, host := range strings.Split(pair[1], "|") {
+			if host = strings.TrimSpace(host); host != "" {
+				sites[pair[0]] = append(sites[pair[0]], host)
+			}
+		}
+	}
+	return sites
+}
+
+func (cluster *Cluster) GetSitePolicy() string {
+	switch cluster.Conf.FailoverSitePolicy {
+	case SitePolicyPreferLocal, SitePolicyLocalOnly, SitePolicyManualCrossSite:
+		return cluster.Conf.FailoverSitePolicy
+	}
+	return SitePolicyAny
+}
+
+func (server *ServerMonitor) GetSite() string {
+	for site, hosts := range server.ClusterGroup.GetSitesHosts() {
+		for _, host := range hosts {
+			if server.URL == host || server.Name == host {
+				return site
+			}
+		}
+	}
+	return ""
+}
+
+// GetFailoverSite returns the local site of an election, the site of the master
+// or the site of the monitor when the master has no site
+func (cluster *Cluster) GetFailoverSite() string {
+	if cluster.master != nil {
+		if site := cluster.master.GetSite(); site != "" {
+			return site
+		}
+	}
+	return cluster.Conf.MonitoringSite
+}
+
+func (cluster *Cluster) GetSites() SiteStatus {
+	st := SiteStatus{
+		Policy:          cluster.GetSitePolicy(),
+		Quorum:          cluster.Conf.FailoverSiteQuorum,
+		MonitoringSite:  cluster.Conf.MonitoringSite,
+		FailoverSite:    cluster.GetFailoverSite(),
+		QuorumConfirmed: cluster.isSiteQuorumConfirmed(),
+		Sites:           make([]SiteHealth, 0),
+	}
+	sites := cluster.GetSitesHosts()
+	names := make([]string, 0, len(sites))
+	for name := range sites {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		sh := SiteHealth{
+			Name:           name,
+			IsMonitorSite:  name == cluster.Conf.MonitoringSite,
+			IsFailoverSite: name == st.FailoverSite,
+			Servers:        make([]string, 0),
+		}
+		for _, server := range cluster.Servers {
+			if server.GetSite() != name {
+				continue
+			}
+			sh.Servers = append(sh.Servers, server.URL)
+			if server.IsDown() {
+				sh.Failed++
+			} else {
+				sh.Up++
+			}
+			if cluster.master != nil && cluster.master.URL == server.URL {
+				sh.HasMaster = true
+			}
+		}
+		sh.Reachable = sh.Up > 0
+		sh.HasQuorum = sh.Up > len(sh.Servers)/2
+		st.Sites = append(st.Sites, sh)
+	}
+	return st
+}
+
+// isSiteQuorumConfirmed is true when the arbitrator elected this monitor or a peer
+// replication-manager is still reachable, a lost site is then a real failure
+func (cluster *Cluster) isSiteQuorumConfirmed() bool {
+	if !cluster.Conf.Arbitration {
+		return false
+	}
+	if !cluster.IsSplitBrain {
+		return true
+	}
+	return !cluster.IsFailedArbitrator && cluster.IsActive()
+}
+
+// isSiteQuorum cancels an automatic failover when a remote site is out of sight,
+// the monitor may be the one partitioned
+func (cluster *Cluster) isSiteQuorum() bool {
+	if !cluster.HasSites() || !cluster.Conf.FailoverSiteQuorum {
+		return true
+	}
+	for _, site := range cluster.GetSites().Sites {
+		if site.IsMonitorSite || site.Reachable || len(site.Servers) == 0 {
+			continue
+		}
+		if cluster.isSiteQuorumConfirmed() {
+			cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Site %s is unreachable, failover confirmed by arbitration", site.Name)
+			continue
+		}
+		cluster.SetState("ERR00099", state.State{ErrType: config.LvlErr, ErrDesc: fmt.Sprintf(clusterError["ERR00099"], site.Name, cluster.Conf.MonitoringSite), ErrFrom: "CHECK"})
+		return false
+	}
+	return true
+}
+
+// isSiteElectable applies the failover site policy to a candidate, localOnly restricts
+// the election to the failover site for the first pass of prefer-local. Automatic elections
+// never leave the failover site with local-only and manual-cross-site, manual ones can leave
+// it with local-only and only for a prefered host with manual-cross-site.
+func (cluster *Cluster) isSiteElectable(sl *ServerMonitor, localOnly bool, automatic bool) bool {
+	if !cluster.HasSites() {
+		return true
+	}
+	policy := cluster.GetSitePolicy()
+	if policy == SitePolicyAny && !localOnly {
+		return true
+	}
+	local := cluster.GetFailoverSite()
+	site := sl.GetSite()
+	if local == "" || site == local {
+		return true
+	}
+	if localOnly {
+		return false
+	}
+	allowed := true
+	switch policy {
+	case SitePolicyLocalOnly:
+		allowed = !automatic
+	case SitePolicyManualCrossSite:
+		allowed = !automatic && cluster.IsInPreferedHosts(sl)
+	}
+	if !allowed {
+		cluster.SetState("ERR00098", state.State{ErrType: config.LvlWarn, ErrDesc: fmt.Sprintf(clusterError["ERR00098"], sl.URL, site, policy), ErrFrom: "CHECK", ServerUrl: sl.URL})
+	}
+	return allowed
+}
@@ -0,0 +1,71 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"testing"
+
+	"github.com/signal18/replication-manager/utils/state"
+)
+
+func newSiteTestCluster(policy string) (*Cluster, *ServerMonitor, *ServerMonitor, *ServerMonitor) {
+	cluster := &Cluster{Name: "c1", StateMachine: new(state.StateMachine)}
+	cluster.StateMachine.Init()
+	cluster.Conf.DBServersSites = "paris=db1:3306|db2:3306,london=db3:3306|db4:3306"
+	cluster.Conf.FailoverSitePolicy = policy
+	cluster.Conf.PrefMaster = "db4:3306"
+	newServer := func(url string) *ServerMonitor {
+		return &ServerMonitor{URL: url, ClusterGroup: cluster, SourceClusterName: "c1"}
+	}
+	cluster.master = newServer("db1:3306")
+	return cluster, newServer("db2:3306"), newServer("db3:3306"), newServer("db4:3306")
+}
+
+func TestIsSiteElectable(t *testing.T) {
+	cases := []struct {
+		policy    string
+		automatic bool
+		local     bool
+		remote    bool
+		prefered  bool
+	}{
+		{SitePolicyAny, true, true, true, true},
+		{SitePolicyAny, false, true, true, true},
+		{SitePolicyPreferLocal, true, true, true, true},
+		{SitePolicyLocalOnly, true, true, false, false},
+		{SitePolicyLocalOnly, false, true, true, true},
+		{SitePolicyManualCrossSite, true, true, false, false},
+		// manual cross site promotions are limited to the prefered hosts
+		{SitePolicyManualCrossSite, false, true, false, true},
+	}
+	for _, c := range cases {
+		cluster, local, remote, prefered := newSiteTestCluster(c.policy)
+		for _, e := range []struct {
+			server   *ServerMonitor
+			expected bool
+		}{{local, c.local}, {remote, c.remote}, {prefered, c.prefered}} {
+			if cluster.isSiteElectable(e.server, false, c.automatic) != e.expected {
+				t.Errorf("Policy %s automatic %v: expected %s electable %v", c.policy, c.automatic, e.server.URL, e.expected)
+			}
+		}
+		// first pass of prefer-local
+		if cluster.isSiteElectable(remote, true, c.automatic) {
+			t.Errorf("Policy %s: expected remote site refused in the local pass", c.policy)
+		}
+	}
+}
+
+func TestIsSiteElectableWithoutSites(t *testing.T) {
+	cluster, _, remote, _ := newSiteTestCluster(SitePolicyLocalOnly)
+	cluster.Conf.DBServersSites = ""
+	if !cluster.isSiteElectable(remote, true, true) {
+		t.Error("Expected every server electable without sites")
+	}
+}
@@ -0,0 +1,356 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/signal18/replication-manager/config"
+)
+
+const (
+	StagingActionDetach  = "detach"
+	StagingActionRefresh = "refresh"
+	StagingActionAttach  = "attach"
+	StagingActionCycle   = "cycle"
+
+	StagingRefreshLogicalBackup  = "logicalbackup"
+	StagingRefreshPhysicalBackup = "physicalbackup"
+	StagingRefreshClone          = "clone"
+	StagingRefreshScript         = "script"
+
+	stagingJobHistory = 20
+)
+
+var (
+	ErrStagingDisabled   = errors.New("Staging topology is disabled")
+	ErrStagingNoServer   = errors.New("Staging server not found")
+	ErrStagingJobRunning = errors.New("A staging job is already running")
+)
+
+// StagingJob tracks a detach, refresh, attach or the scheduled cycle of the staging server
+type StagingJob struct {
+	ID     string    `json:"id"`
+	Action string    `json:"action"`
+	Server string    `json:"server"`
+	Method string    `json:"method,omitempty"`
+	Status string    `json:"status"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end,omitempty"`
+	Steps  []string  `json:"steps"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// StagingStatus is the staging server with its last jobs, newest first
+type StagingStatus struct {
+	Enabled  bool         `json:"enabled"`
+	Server   string       `json:"server"`
+	State    string       `json:"state"`
+	Attached bool         `json:"attached"`
+	ReadOnly bool         `json:"readOnly"`
+	Method   string       `json:"method"`
+	Schedule string       `json:"schedule,omitempty"`
+	Jobs     []StagingJob `json:"jobs"`
+}
+
+func (cluster *Cluster) GetStagingServer() *ServerMonitor {
+	for _, server := range cluster.Servers {
+		if server != nil && cluster.IsStagingServer(server) {
+			return server
+		}
+	}
+	return nil
+}
+
+func (cluster *Cluster) GetStagingRefreshMethod() string {
+	if cluster.Conf.TopologyStagingRefreshMethod == "" {
+		return StagingRefreshLogicalBackup
+	}
+	return cluster.Conf.TopologyStagingRefreshMethod
+}
+
+func (cluster *Cluster) GetStaging() StagingStatus {
+	st := StagingStatus{
+		Enabled: cluster.Conf.TopologyStaging,
+		Server:  cluster.Conf.TopologyStagingServer,
+		Method:  cluster.GetStagingRefreshMethod(),
+		Jobs:    []StagingJob{},
+	}
+	if cluster.Conf.SchedulerStagingRefresh {
+		st.Schedule = cluster.Conf.SchedulerStagingRefreshCron
+	}
+	if server := cluster.GetStagingServer(); server != nil {
+		st.State = server.State
+		st.Attached = server.IsSlave
+		st.ReadOnly = server.IsReadOnly()
+	}
+	cluster.stagingMutex.Lock()
+	defer cluster.stagingMutex.Unlock()
+	for i := len(cluster.stagingJobs) - 1; i >= 0; i-- {
+		job := cluster.stagingJobs[i]
+		job.Steps = append([]string{}, job.Steps...)
+		st.Jobs = append(st.Jobs, job)
+	}
+	return st
+}
+
+// StartStagingJob runs a staging action in background and returns the job to follow
+func (cluster *Cluster) StartStagingJob(action string) (StagingJob, error) {
+	if !cluster.Conf.TopologyStaging {
+		return StagingJob{}, ErrStagingDisabled
+	}
+	switch action {
+	case StagingActionDetach, StagingActionRefresh, StagingActionAttach, StagingActionCycle:
+	default:
+		return StagingJob{}, fmt.Errorf("Unknown staging action %s", action)
+	}
+	server := cluster.GetStagingServer()
+	if server == nil {
+		return StagingJob{}, ErrStagingNoServer
+	}
+	cluster.stagingMutex.Lock()
+	for _, job := range cluster.stagingJobs {
+		if job.Status == JobStatusRunning {
+			cluster.stagingMutex.Unlock()
+			return StagingJob{}, ErrStagingJobRunning
+		}
+	}
+	now := time.Now()
+	job := StagingJob{
+		ID:     strconv.FormatInt(now.UnixNano(), 36),
+		Action: action,
+		Server: server.URL,
+		Status: JobStatusRunning,
+		Start:  now,
+		Steps:  []string{},
+	}
+	if action == StagingActionRefresh || action == StagingActionCycle {
+		job.Method = cluster.GetStagingRefreshMethod()
+	}
+	cluster.stagingJobs = append(cluster.stagingJobs, job)
+	if len(cluster.stagingJobs) > stagingJobHistory {
+		cluster.stagingJobs = cluster.stagingJobs[len(cluster.stagingJobs)-stagingJobHistory:]
+	}
+	cluster.stagingMutex.Unlock()
+
+	go cluster.runStagingJob(job.ID, action, server)
+	return job, nil
+}
+
+// StagingCycle refreshes the staging server and detaches it again, it is run by the scheduler
+func (cluster *Cluster) StagingCycle() {
+	if _, err := cluster.StartStagingJob(StagingActionCycle); err != nil {
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModTopology, config.LvlErr, "Scheduled staging refresh canceled: %s", err)
+	}
+}
+
+func (cluster *Cluster) runStagingJob(id string, action string, server *ServerMonitor) {
+	var err error
+	switch action {
+	case StagingActionDetach:
+		err = cluster.stagingDetach(id, server)
+	case StagingActionRefresh:
+		err = cluster.stagingRefresh(id, server)
+	case StagingActionAttach:
+		err = cluster.stagingAttach(id, server)
+	case StagingActionCycle:
+		err = cluster.stagingRefresh(id, server)
+		if err == nil {
+			err = cluster.stagingDetach(id, server)
+		}
+	}
+	cluster.stagingMutex.Lock()
+	defer cluster.stagingMutex.Unlock()
+	for i := range cluster.stagingJobs {
+		if cluster.stagingJobs[i].ID == id {
+			cluster.stagingJobs[i].End = time.Now()
+			cluster.stagingJobs[i].Status = JobStatusSuccess
+			if err != nil {
+				cluster.stagingJobs[i].Status = JobStatusFailed
+				cluster.stagingJobs[i].Error = err.Error()
+			}
+		}
+	}
+	if err != nil {
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModTopology, config.LvlErr, "Staging %s of %s failed: %s", action, server.URL, err)
+	} else {
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModTopology, config.LvlInfo, "Staging %s of %s done", action, server.URL)
+	}
+}
+
+func (cluster *Cluster) stagingStep(id string, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModTopology, config.LvlInfo, "Staging: %s", msg)
+	cluster.stagingMutex.Lock()
+	defer cluster.stagingMutex.Unlock()
+	for i := range cluster.stagingJobs {
+		if cluster.stagingJobs[i].ID == id {
+			cluster.stagingJobs[i].Steps = append(cluster.stagingJobs[i].Steps, time.Now().Format("15:04:05")+" "+msg)
+		}
+	}
+}
+
+// stagingDetach breaks the replication of the staging server, makes it writable and calls the masking script
+func (cluster *Cluster) stagingDetach(id string, server *ServerMonitor) error {
+	if server.IsDown() {
+		return fmt.Errorf("Staging server %s is down", server.URL)
+	}
+	if cluster.GetMaster() != nil && cluster.GetMaster().URL == server.URL {
+		return fmt.Errorf("Staging server %s is the master", server.URL)
+	}
+	if server.IsSlave {
+		cluster.stagingStep(id, "Stop replication on %s", server.URL)
+		if _, err := server.StopSlave(); err != nil {
+			return fmt.Errorf("Stop replication failed: %s", err)
+		}
+		cluster.stagingStep(id, "Reset replication on %s", server.URL)
+		if _, err := server.ResetSlave(); err != nil {
+			return fmt.Errorf("Reset replication failed: %s", err)
+		}
+	} else {
+		cluster.stagingStep(id, "Replication already stopped on %s", server.URL)
+	}
+	cluster.stagingStep(id, "Set read write on %s", server.URL)
+	if err := server.SetReadWrite(); err != nil {
+		return fmt.Errorf("Set read write failed: %s", err)
+	}
+	if cluster.Conf.TopologyStagingPostDetachScript != "" {
+		cluster.stagingStep(id, "Calling post detach script %s", cluster.Conf.TopologyStagingPostDetachScript)
+		out, err := exec.Command(cluster.Conf.TopologyStagingPostDetachScript, server.Host, server.Port).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("Post detach script failed: %s %s", err, strings.TrimSpace(string(out)))
+		}
+		cluster.stagingStep(id, "Post detach script complete: %s", strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// stagingRefresh restores the staging server from the master data and waits for it to catch up
+func (cluster *Cluster) stagingRefresh(id string, server *ServerMonitor) error {
+	master := cluster.GetMaster()
+	if master == nil {
+		return errors.New("No master found")
+	}
+	if master.URL == server.URL {
+		return fmt.Errorf("Staging server %s is the master", server.URL)
+	}
+	method := cluster.GetStagingRefreshMethod()
+	cluster.stagingStep(id, "Refresh %s from %s with %s", server.URL, master.URL, method)
+	switch method {
+	case StagingRefreshLogicalBackup:
+		if err := server.JobReseedLogicalBackup("default"); err != nil {
+			return err
+		}
+		if err := cluster.waitStagingReseed(id, server); err != nil {
+			return err
+		}
+	case StagingRefreshPhysicalBackup:
+		if err := server.JobReseedPhysicalBackup("default"); err != nil {
+			return err
+		}
+		if err := cluster.waitStagingReseed(id, server); err != nil {
+			return err
+		}
+	case StagingRefreshClone:
+		if err := cluster.RejoinClone(master, server); err != nil {
+			return err
+		}
+	case StagingRefreshScript:
+		if cluster.Conf.TopologyStagingRefreshScript == "" {
+			return errors.New("No staging refresh script")
+		}
+		server.StopSlave()
+		cluster.stagingStep(id, "Calling refresh script %s", cluster.Conf.TopologyStagingRefreshScript)
+		out, err := exec.Command(cluster.Conf.TopologyStagingRefreshScript, server.Host, server.Port, master.Host, master.Port).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("Refresh script failed: %s %s", err, strings.TrimSpace(string(out)))
+		}
+		cluster.stagingStep(id, "Refresh script complete: %s", strings.TrimSpace(string(out)))
+		if err := cluster.stagingAttach(id, server); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("Unknown staging refresh method %s", method)
+	}
+	cluster.stagingStep(id, "Set read only on %s", server.URL)
+	if _, err := server.SetReadOnly(); err != nil {
+		return fmt.Errorf("Set read only failed: %s", err)
+	}
+	return cluster.waitStagingSync(id, server)
+}
+
+// stagingAttach points the staging server to the master, local changes since the detach are kept
+func (cluster *Cluster) stagingAttach(id string, server *ServerMonitor) error {
+	master := cluster.GetMaster()
+	if master == nil {
+		return errors.New("No master found")
+	}
+	if master.URL == server.URL {
+		return fmt.Errorf("Staging server %s is the master", server.URL)
+	}
+	cluster.stagingStep(id, "Set read only on %s", server.URL)
+	if _, err := server.SetReadOnly(); err != nil {
+		return fmt.Errorf("Set read only failed: %s", err)
+	}
+	cluster.stagingStep(id, "Change master of %s to %s", server.URL, master.URL)
+	logs, err := server.SetReplicationGTIDSlavePosFromServer(master)
+	cluster.LogSQL(logs, err, server.URL, "Staging", config.LvlErr, "Could not change master of staging server %s: %s", server.URL, err)
+	if err != nil {
+		return fmt.Errorf("Change master failed: %s", err)
+	}
+	cluster.stagingStep(id, "Start replication on %s", server.URL)
+	if _, err := server.StartSlave(); err != nil {
+		return fmt.Errorf("Start replication failed: %s", err)
+	}
+	return nil
+}
+
+func (cluster *Cluster) stagingTimeout() time.Duration {
+	if cluster.Conf.TopologyStagingRefreshTimeout <= 0 {
+		return 2 * time.Hour
+	}
+	return time.Duration(cluster.Conf.TopologyStagingRefreshTimeout) * time.Second
+}
+
+// waitStagingReseed waits for the restore job of the staging server to finish
+func (cluster *Cluster) waitStagingReseed(id string, server *ServerMonitor) error {
+	cluster.stagingStep(id, "Waiting for restore of %s", server.URL)
+	deadline := time.Now().Add(cluster.stagingTimeout())
+	for server.HasAnyReseedingState() {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Timeout waiting for restore of %s", server.URL)
+		}
+		time.Sleep(5 * time.Second)
+	}
+	cluster.stagingStep(id, "Restore of %s complete", server.URL)
+	return nil
+}
+
+// waitStagingSync waits for the staging server to replicate with a delay under failover-max-slave-delay
+func (cluster *Cluster) waitStagingSync(id string, server *ServerMonitor) error {
+	cluster.stagingStep(id, "Waiting for %s to catch up with the master", server.URL)
+	deadline := time.Now().Add(cluster.stagingTimeout())
+	for {
+		if server.IsSlave && server.IsSQLThreadRunning() && server.GetReplicationDelay() <= cluster.Conf.FailMaxDelay {
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Timeout waiting for %s to catch up with the master", server.URL)
+		}
+		time.Sleep(5 * time.Second)
+	}
+	cluster.stagingStep(id, "Staging server %s in sync with a delay of %d", server.URL, server.GetReplicationDelay())
+	return nil
+}
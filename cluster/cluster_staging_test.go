@@ -0,0 +1,102 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func newStagingTestCluster() *Cluster {
+	cluster := &Cluster{Name: "c1"}
+	cluster.Conf.TopologyStaging = true
+	cluster.Conf.TopologyStagingServer = "db3:3306"
+	for _, url := range []string{"db1:3306", "db2:3306", "db3:3306"} {
+		cluster.Servers = append(cluster.Servers, &ServerMonitor{URL: url, Name: strings.Split(url, ":")[0], ClusterGroup: cluster})
+	}
+	return cluster
+}
+
+func TestGetStagingServer(t *testing.T) {
+	cluster := newStagingTestCluster()
+	if s := cluster.GetStagingServer(); s == nil || s.URL != "db3:3306" {
+		t.Fatalf("Expected db3:3306 as staging server, got %v", s)
+	}
+	cluster.Conf.TopologyStagingServer = "db2"
+	if s := cluster.GetStagingServer(); s == nil || s.URL != "db2:3306" {
+		t.Errorf("Expected staging server by name, got %v", s)
+	}
+	cluster.Conf.TopologyStaging = false
+	if s := cluster.GetStagingServer(); s != nil {
+		t.Errorf("Expected no staging server when disabled, got %s", s.URL)
+	}
+}
+
+func TestStagingDefaults(t *testing.T) {
+	cluster := newStagingTestCluster()
+	if m := cluster.GetStagingRefreshMethod(); m != StagingRefreshLogicalBackup {
+		t.Errorf("Expected logical backup refresh by default, got %s", m)
+	}
+	if d := cluster.stagingTimeout(); d != 2*time.Hour {
+		t.Errorf("Expected 2h timeout by default, got %s", d)
+	}
+	cluster.Conf.TopologyStagingRefreshMethod = StagingRefreshClone
+	cluster.Conf.TopologyStagingRefreshTimeout = 600
+	if m := cluster.GetStagingRefreshMethod(); m != StagingRefreshClone {
+		t.Errorf("Expected clone refresh, got %s", m)
+	}
+	if d := cluster.stagingTimeout(); d != 10*time.Minute {
+		t.Errorf("Expected 10m timeout, got %s", d)
+	}
+}
+
+func TestStartStagingJobRefused(t *testing.T) {
+	cluster := newStagingTestCluster()
+	if _, err := cluster.StartStagingJob("promote"); err == nil {
+		t.Error("Expected unknown action to be refused")
+	}
+	cluster.stagingJobs = []StagingJob{{ID: "a", Action: StagingActionDetach, Status: JobStatusRunning}}
+	if _, err := cluster.StartStagingJob(StagingActionAttach); err != ErrStagingJobRunning {
+		t.Errorf("Expected running job error, got %v", err)
+	}
+	cluster.Conf.TopologyStagingServer = "db9"
+	if _, err := cluster.StartStagingJob(StagingActionAttach); err != ErrStagingNoServer {
+		t.Errorf("Expected no server error, got %v", err)
+	}
+	cluster.Conf.TopologyStaging = false
+	if _, err := cluster.StartStagingJob(StagingActionAttach); err != ErrStagingDisabled {
+		t.Errorf("Expected disabled error, got %v", err)
+	}
+}
+
+func TestStagingJobsHistory(t *testing.T) {
+	cluster := newStagingTestCluster()
+	cluster.stagingJobs = []StagingJob{
+		{ID: "a", Action: StagingActionDetach, Status: JobStatusSuccess, Steps: []string{}},
+		{ID: "b", Action: StagingActionRefresh, Status: JobStatusRunning, Steps: []string{}},
+	}
+	cluster.stagingStep("b", "Refresh %s", "db3:3306")
+	st := cluster.GetStaging()
+	if len(st.Jobs) != 2 || st.Jobs[0].ID != "b" || st.Jobs[1].ID != "a" {
+		t.Fatalf("Expected newest job first, got %v", st.Jobs)
+	}
+	if len(st.Jobs[0].Steps) != 1 || !strings.HasSuffix(st.Jobs[0].Steps[0], "Refresh db3:3306") {
+		t.Errorf("Unexpected steps %v", st.Jobs[0].Steps)
+	}
+	// the status returns copies of the steps
+	st.Jobs[0].Steps[0] = "changed"
+	if cluster.stagingJobs[1].Steps[0] == "changed" {
+		t.Error("Expected job steps to be copied")
+	}
+	if st.Server != "db3:3306" || !st.Enabled {
+		t.Errorf("Unexpected staging status %v", st)
+	}
+}
@@ -302,6 +302,22 @@ func (cluster *Cluster) SwitchSwitchLowerRelease() {
 	cluster.Conf.SwitchLowerRelease = !cluster.Conf.SwitchLowerRelease
 }
 
+func (cluster *Cluster) SwitchSwitchoverDrain() {
+	cluster.Conf.SwitchDrain = !cluster.Conf.SwitchDrain
+}
+
+func (cluster *Cluster) SwitchSwitchoverDrainKill() {
+	cluster.Conf.SwitchDrainKill = !cluster.Conf.SwitchDrainKill
+}
+
+func (cluster *Cluster) SwitchProxyDriftCheck() {
+	cluster.Conf.PRXDriftCheck = !cluster.Conf.PRXDriftCheck
+}
+
+func (cluster *Cluster) SwitchProxyDriftRemediate() {
+	cluster.Conf.PRXDriftRemediate = !cluster.Conf.PRXDriftRemediate
+}
+
 func (cluster *Cluster) SwitchSchedulerRollingRestart() {
 	cluster.Conf.SchedulerRollingRestart = !cluster.Conf.SchedulerRollingRestart
 	cluster.SetSchedulerRollingRestart()
@@ -316,6 +332,11 @@ func (cluster *Cluster) SwitchSchedulerAlertDisable() {
 	cluster.Conf.SchedulerAlertDisable = !cluster.Conf.SchedulerAlertDisable
 }
 
+func (cluster *Cluster) SwitchSchedulerStagingRefresh() {
+	cluster.Conf.SchedulerStagingRefresh = !cluster.Conf.SchedulerStagingRefresh
+	cluster.SetSchedulerStagingRefresh()
+}
+
 func (cluster *Cluster) SwitchGraphiteEmbedded() {
 	cluster.Conf.GraphiteEmbedded = !cluster.Conf.GraphiteEmbedded
 }
@@ -336,6 +357,42 @@ func (cluster *Cluster) SwitchFailoverLowerRelease() {
 	cluster.Conf.SwitchLowerRelease = !cluster.Conf.SwitchLowerRelease
 }
 
+func (cluster *Cluster) SwitchReplicationDelayedElectable() {
+	cluster.Conf.HostsDelayedElectable = !cluster.Conf.HostsDelayedElectable
+}
+
+func (cluster *Cluster) SwitchFailoverSiteQuorum() {
+	cluster.Conf.FailoverSiteQuorum = !cluster.Conf.FailoverSiteQuorum
+}
+
+func (cluster *Cluster) SwitchConsistencyCheck() {
+	cluster.Conf.ConsistencyCheck = !cluster.Conf.ConsistencyCheck
+}
+
+func (cluster *Cluster) SwitchConsistencyCheckResync() {
+	cluster.Conf.ConsistencyCheckResync = !cluster.Conf.ConsistencyCheckResync
+}
+
+func (cluster *Cluster) SwitchWsrepRecoverNonPrimary() {
+	cluster.Conf.WsrepRecoverNonPrimary = !cluster.Conf.WsrepRecoverNonPrimary
+}
+
+func (cluster *Cluster) SwitchWsrepBackupDesync() {
+	cluster.Conf.WsrepBackupDesync = !cluster.Conf.WsrepBackupDesync
+}
+
+func (cluster *Cluster) SwitchMultiMasterGrouprepRejoin() {
+	cluster.Conf.MultiMasterGrouprepRejoin = !cluster.Conf.MultiMasterGrouprepRejoin
+}
+
+func (cluster *Cluster) SwitchReplicationMultisourceChannelRepoint() {
+	cluster.Conf.ReplicationMultisourceChannelRepoint = !cluster.Conf.ReplicationMultisourceChannelRepoint
+}
+
+func (cluster *Cluster) SwitchReplicationPlaybook() {
+	cluster.Conf.ReplicationPlaybook = !cluster.Conf.ReplicationPlaybook
+}
+
 func (cluster *Cluster) SwitchFailoverEventStatus() {
 	cluster.Conf.FailEventStatus = !cluster.Conf.FailEventStatus
 }
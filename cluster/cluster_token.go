@@ -0,0 +1,85 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"fmt"
+	"strings"
+)
+
+// loadTokenUsers adds the service account tokens used on the cluster to users, a token
+// only gets its own grants and the visitor role
+func (cluster *Cluster) loadTokenUsers(users map[string]APIUser) {
+	cluster.tokenMutex.RLock()
+	defer cluster.tokenMutex.RUnlock()
+	for user, grants := range cluster.tokenUsers {
+		if _, ok := users[user]; ok {
+			continue
+		}
+		users[user] = cluster.newTokenUser(user, grants)
+	}
+}
+
+func (cluster *Cluster) newTokenUser(user string, grants []string) APIUser {
+	newapiuser := APIUser{User: user, IsToken: true, Grants: make(map[string]bool), Roles: make(map[string]bool)}
+	cluster.SetUserGrants(&newapiuser, strings.Join(grants, " "))
+	setVisitorRole(&newapiuser)
+	return newapiuser
+}
+
+// SetAPITokenUser registers the user of a service account token the first time it is
+// used on the cluster, local users of the same name take precedence
+func (cluster *Cluster) SetAPITokenUser(user string, grants []string) {
+	if _, ok := cluster.APIUsers[user]; ok {
+		return
+	}
+	cluster.tokenMutex.Lock()
+	if cluster.tokenUsers == nil {
+		cluster.tokenUsers = make(map[string][]string)
+	}
+	cluster.tokenUsers[user] = grants
+	cluster.tokenMutex.Unlock()
+	newapiuser := cluster.newTokenUser(user, grants)
+	cluster.setAPIUser(user, &newapiuser)
+}
+
+// DropAPITokenUser removes the user of a revoked token
+func (cluster *Cluster) DropAPITokenUser(user string) {
+	cluster.tokenMutex.Lock()
+	_, ok := cluster.tokenUsers[user]
+	delete(cluster.tokenUsers, user)
+	cluster.tokenMutex.Unlock()
+	if u, found := cluster.APIUsers[user]; ok && found && u.IsToken {
+		cluster.setAPIUser(user, nil)
+	}
+}
+
+// CheckTokenGrants verifies that grants, in acl format, are known and held by creator
+// so that a token never gives more than its creator has
+func (cluster *Cluster) CheckTokenGrants(creator string, grants []string) error {
+	var u APIUser
+	for _, grant := range grants {
+		cluster.SetUserGrants(&u, grant)
+		found := false
+		for value, granted := range u.Grants {
+			if !granted || !strings.HasPrefix(value, grant) {
+				continue
+			}
+			found = true
+			if !cluster.APIUsers[creator].Grants[value] {
+				return fmt.Errorf("User %s can not delegate grant %s", creator, value)
+			}
+		}
+		if !found {
+			return fmt.Errorf("Unknown grant %s", grant)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import "testing"
+
+func newTokenTestCluster(name string, grants map[string]bool) *Cluster {
+	cluster := &Cluster{Name: name}
+	cluster.Grants = map[string]string{"db-backup": "db-backup", "db-stop": "db-stop", "cluster-switchover": "cluster-switchover"}
+	cluster.APIUsers = map[string]APIUser{"alice": {User: "alice", Password: "secret", Grants: grants}}
+	return cluster
+}
+
+func TestCheckTokenGrants(t *testing.T) {
+	c1 := newTokenTestCluster("c1", map[string]bool{"db-backup": true, "db-stop": true})
+	c2 := newTokenTestCluster("c2", map[string]bool{"db-backup": true})
+	if err := c1.CheckTokenGrants("alice", []string{"db-"}); err != nil {
+		t.Errorf("Alice holds db grants on c1: %s", err)
+	}
+	if err := c2.CheckTokenGrants("alice", []string{"db-"}); err == nil {
+		t.Error("Alice can not delegate db-stop on c2")
+	}
+	if err := c2.CheckTokenGrants("alice", []string{"db-backup"}); err != nil {
+		t.Errorf("Alice holds db-backup on c2: %s", err)
+	}
+	if err := c1.CheckTokenGrants("alice", []string{"bogus"}); err == nil {
+		t.Error("Expected unknown grant error")
+	}
+}
+
+func TestSetAPITokenUser(t *testing.T) {
+	cluster := newTokenTestCluster("c1", map[string]bool{"db-backup": true})
+	before := cluster.APIUsers
+	cluster.SetAPITokenUser("backup-bot", []string{"db-backup"})
+	bot, ok := cluster.APIUsers["backup-bot"]
+	if !ok || !bot.IsToken || !bot.Grants["db-backup"] || bot.Grants["db-stop"] {
+		t.Fatalf("Unexpected token user %+v", bot)
+	}
+	if _, ok := before["backup-bot"]; ok {
+		t.Error("The previous users map should not be modified in place")
+	}
+	if cluster.APIUsers["alice"].Password != "secret" {
+		t.Error("Other users should be kept")
+	}
+	cluster.SetAPITokenUser("alice", []string{"db-stop"})
+	if u := cluster.APIUsers["alice"]; u.IsToken || u.Grants["db-stop"] {
+		t.Errorf("A token should not replace the local alice %+v", u)
+	}
+	cluster.DropAPITokenUser("alice")
+	if _, ok := cluster.APIUsers["alice"]; !ok {
+		t.Error("Dropping a token should not remove the local alice")
+	}
+	cluster.DropAPITokenUser("backup-bot")
+	if _, ok := cluster.APIUsers["backup-bot"]; ok {
+		t.Error("Expected the token user to be removed")
+	}
+}
@@ -0,0 +1,482 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/signal18/replication-manager/config"
+	"github.com/signal18/replication-manager/utils/dbhelper"
+	"github.com/signal18/replication-manager/utils/misc"
+)
+
+const (
+	UpgradeRunning   = "running"
+	UpgradePaused    = "paused"
+	UpgradeAborted   = "aborted"
+	UpgradeFailed    = "failed"
+	UpgradeCompleted = "completed"
+
+	UpgradeStepPending = "pending"
+	UpgradeStepRunning = "running"
+	UpgradeStepDone    = "done"
+	UpgradeStepFailed  = "failed"
+	UpgradeStepSkipped = "skipped"
+
+	UpgradeStepUpgrade     = "upgrade"
+	UpgradeStepDBUpgrade   = "db-upgrade"
+	UpgradeStepReplication = "replication"
+	UpgradeStepChecksum    = "checksum"
+	UpgradeStepSwitchover  = "switchover"
+
+	UpgradeMethodSSH       = "ssh"
+	UpgradeMethodProvision = "provision"
+)
+
+var (
+	ErrUpgradeRunning    = errors.New("A rolling upgrade is already running")
+	ErrUpgradeNotRunning = errors.New("No rolling upgrade is running")
+	ErrUpgradeAborted    = errors.New("Rolling upgrade aborted")
+	ErrUpgradeVersion    = errors.New("Invalid upgrade version, only letters, digits, dots and dashes are allowed")
+)
+
+// upgradeVersionRegexp restricts the target version passed to the upgrade script over ssh
+var upgradeVersionRegexp = regexp.MustCompile(`^[0-9A-Za-z.\-]+$`)
+
+// UpgradeStep is one step of the rolling upgrade on a server
+type UpgradeStep struct {
+	Server  string    `json:"server"`
+	Name    string    `json:"name"`
+	Status  string    `json:"status"`
+	Start   time.Time `json:"start,omitempty"`
+	End     time.Time `json:"end,omitempty"`
+	Message string    `json:"message,omitempty"`
+}
+
+// UpgradeStatus is the plan of the last rolling upgrade with the status of every step
+type UpgradeStatus struct {
+	ID            string        `json:"id"`
+	State         string        `json:"state"`
+	Method        string        `json:"method"`
+	TargetVersion string        `json:"targetVersion,omitempty"`
+	Start         time.Time     `json:"start"`
+	End           time.Time     `json:"end,omitempty"`
+	Error         string        `json:"error,omitempty"`
+	Steps         []UpgradeStep `json:"steps"`
+}
+
+func (cluster *Cluster) GetUpgrade() UpgradeStatus {
+	cluster.upgradeMutex.Lock()
+	defer cluster.upgradeMutex.Unlock()
+	if cluster.upgrade == nil {
+		return UpgradeStatus{Steps: []UpgradeStep{}}
+	}
+	st := *cluster.upgrade
+	st.Steps = append([]UpgradeStep{}, cluster.upgrade.Steps...)
+	return st
+}
+
+func (cluster *Cluster) IsInRollingUpgrade() bool {
+	cluster.upgradeMutex.Lock()
+	defer cluster.upgradeMutex.Unlock()
+	return cluster.upgrade != nil && (cluster.upgrade.State == UpgradeRunning || cluster.upgrade.State == UpgradePaused)
+}
+
+// StartRollingUpgrade plans the upgrade of the replicas one at a time, a switchover to an
+// upgraded replica and the upgrade of the old master, then runs it in background
+func (cluster *Cluster) StartRollingUpgrade(version string) (UpgradeStatus, error) {
+	if version == "" {
+		version = cluster.Conf.UpgradeTargetVersion
+	}
+	if version != "" && !upgradeVersionRegexp.MatchString(version) {
+		return UpgradeStatus{}, ErrUpgradeVersion
+	}
+	method := cluster.Conf.UpgradeMethod
+	if method == "" {
+		method = UpgradeMethodSSH
+	}
+	if method != UpgradeMethodSSH && method != UpgradeMethodProvision {
+		return UpgradeStatus{}, fmt.Errorf("Unknown upgrade method %s", method)
+	}
+	if method == UpgradeMethodSSH && cluster.Conf.UpgradeSSHScript == "" {
+		return UpgradeStatus{}, errors.New("No upgrade-ssh-script")
+	}
+	if cluster.IsInFailover() {
+		return UpgradeStatus{}, errors.New("In failover")
+	}
+	master := cluster.GetMaster()
+	if master == nil || master.IsDown() {
+		return UpgradeStatus{}, errors.New("No master found")
+	}
+	var steps []UpgradeStep
+	addServer := func(url string) {
+		for _, name := range []string{UpgradeStepUpgrade, UpgradeStepDBUpgrade, UpgradeStepReplication, UpgradeStepChecksum} {
+			steps = append(steps, UpgradeStep{Server: url, Name: name, Status: UpgradeStepPending})
+		}
+	}
+	for _, slave := range cluster.slaves {
+		if slave.GetSourceClusterName() != cluster.Name {
+			continue
+		}
+		if slave.IsDown() {
+			return UpgradeStatus{}, fmt.Errorf("Replica %s is down", slave.URL)
+		}
+		addServer(slave.URL)
+	}
+	if len(steps) == 0 {
+		return UpgradeStatus{}, errors.New("No replica to switch over")
+	}
+	steps = append(steps, UpgradeStep{Server: master.URL, Name: UpgradeStepSwitchover, Status: UpgradeStepPending})
+	addServer(master.URL)
+
+	cluster.upgradeMutex.Lock()
+	if cluster.upgrade != nil && (cluster.upgrade.State == UpgradeRunning || cluster.upgrade.State == UpgradePaused) {
+		cluster.upgradeMutex.Unlock()
+		return UpgradeStatus{}, ErrUpgradeRunning
+	}
+	now := time.Now()
+	cluster.upgrade = &UpgradeStatus{
+		ID:            strconv.FormatInt(now.UnixNano(), 36),
+		State:         UpgradeRunning,
+		Method:        method,
+		TargetVersion: version,
+		Start:         now,
+		Steps:         steps,
+	}
+	cluster.upgradePaused = false
+	cluster.upgradeAborted = false
+	cluster.upgradeMutex.Unlock()
+
+	go cluster.RollingUpgrade()
+	return cluster.GetUpgrade(), nil
+}
+
+func (cluster *Cluster) PauseRollingUpgrade() error {
+	cluster.upgradeMutex.Lock()
+	defer cluster.upgradeMutex.Unlock()
+	if cluster.upgrade == nil || cluster.upgrade.State != UpgradeRunning {
+		return ErrUpgradeNotRunning
+	}
+	cluster.upgradePaused = true
+	cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Rolling upgrade will pause after the current step")
+	return nil
+}
+
+func (cluster *Cluster) ResumeRollingUpgrade() error {
+	cluster.upgradeMutex.Lock()
+	defer cluster.upgradeMutex.Unlock()
+	if cluster.upgrade == nil || (cluster.upgrade.State != UpgradeRunning && cluster.upgrade.State != UpgradePaused) {
+		return ErrUpgradeNotRunning
+	}
+	cluster.upgradePaused = false
+	cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Rolling upgrade resumed")
+	return nil
+}
+
+func (cluster *Cluster) AbortRollingUpgrade() error {
+	cluster.upgradeMutex.Lock()
+	defer cluster.upgradeMutex.Unlock()
+	if cluster.upgrade == nil || (cluster.upgrade.State != UpgradeRunning && cluster.upgrade.State != UpgradePaused) {
+		return ErrUpgradeNotRunning
+	}
+	cluster.upgradeAborted = true
+	cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Rolling upgrade will abort after the current step")
+	return nil
+}
+
+// upgradeCheckpoint waits while the upgrade is paused and stops it when aborted
+func (cluster *Cluster) upgradeCheckpoint() error {
+	for {
+		cluster.upgradeMutex.Lock()
+		if cluster.upgradeAborted {
+			cluster.upgradeMutex.Unlock()
+			return ErrUpgradeAborted
+		}
+		if !cluster.upgradePaused {
+			cluster.upgrade.State = UpgradeRunning
+			cluster.upgradeMutex.Unlock()
+			return nil
+		}
+		cluster.upgrade.State = UpgradePaused
+		cluster.upgradeMutex.Unlock()
+		time.Sleep(time.Second)
+	}
+}
+
+func (cluster *Cluster) setUpgradeStep(i int, status string, msg string) {
+	cluster.upgradeMutex.Lock()
+	defer cluster.upgradeMutex.Unlock()
+	step := &cluster.upgrade.Steps[i]
+	step.Status = status
+	step.Message = msg
+	if status == UpgradeStepRunning {
+		step.Start = time.Now()
+	} else {
+		step.End = time.Now()
+	}
+}
+
+// RollingUpgrade runs the steps of the planned upgrade, it stops at the first failed step
+func (cluster *Cluster) RollingUpgrade() error {
+	cluster.SetInRollingRestart(true)
+	defer cluster.SetInRollingRestart(false)
+
+	upg := cluster.GetUpgrade()
+	cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Rolling upgrade %s via %s to version %s", upg.ID, upg.Method, upg.TargetVersion)
+	var err error
+	for i, step := range upg.Steps {
+		if err = cluster.upgradeCheckpoint(); err != nil {
+			break
+		}
+		cluster.setUpgradeStep(i, UpgradeStepRunning, "")
+		var msg string
+		var skipped bool
+		msg, skipped, err = cluster.runUpgradeStep(upg, step)
+		if err != nil {
+			cluster.setUpgradeStep(i, UpgradeStepFailed, err.Error())
+			cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlErr, "Cancel rolling upgrade step %s on %s failed: %s", step.Name, step.Server, err)
+			break
+		}
+		if skipped {
+			cluster.setUpgradeStep(i, UpgradeStepSkipped, msg)
+		} else {
+			cluster.setUpgradeStep(i, UpgradeStepDone, msg)
+		}
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Rolling upgrade step %s on %s: %s", step.Name, step.Server, msg)
+	}
+
+	cluster.upgradeMutex.Lock()
+	defer cluster.upgradeMutex.Unlock()
+	cluster.upgrade.End = time.Now()
+	switch err {
+	case nil:
+		cluster.upgrade.State = UpgradeCompleted
+	case ErrUpgradeAborted:
+		cluster.upgrade.State = UpgradeAborted
+		cluster.upgrade.Error = err.Error()
+	default:
+		cluster.upgrade.State = UpgradeFailed
+		cluster.upgrade.Error = err.Error()
+	}
+	cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Rolling upgrade %s %s", upg.ID, cluster.upgrade.State)
+	return err
+}
+
+func (cluster *Cluster) runUpgradeStep(upg UpgradeStatus, step UpgradeStep) (string, bool, error) {
+	if step.Name == UpgradeStepSwitchover {
+		return cluster.upgradeSwitchover(step.Server)
+	}
+	server := cluster.GetServerFromURL(step.Server)
+	if server == nil {
+		return "", false, fmt.Errorf("Server %s not found", step.Server)
+	}
+	switch step.Name {
+	case UpgradeStepUpgrade:
+		return cluster.UpgradeDatabaseService(server, upg.Method, upg.TargetVersion)
+	case UpgradeStepDBUpgrade:
+		return server.RunDatabaseUpgrade()
+	case UpgradeStepReplication:
+		return cluster.upgradeCheckReplication(server)
+	case UpgradeStepChecksum:
+		return cluster.upgradeChecksum(server)
+	}
+	return "", false, fmt.Errorf("Unknown upgrade step %s", step.Name)
+}
+
+// UpgradeDatabaseService stops a server in maintenance, upgrades it with the method and restarts it
+func (cluster *Cluster) UpgradeDatabaseService(server *ServerMonitor, method string, version string) (string, bool, error) {
+	if version != "" && server.DBVersion != nil && server.DBVersion.GreaterEqual(version) {
+		return "Already at version " + server.DBVersion.ToFullString(), true, nil
+	}
+	if !server.IsMaintenance {
+		server.SwitchMaintenance()
+	}
+	writeOnce := true
+	for server.IsBackingUpBinaryLog {
+		if writeOnce {
+			cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Waiting server %s to finish binlog backup", server.URL)
+			writeOnce = false
+		}
+		time.Sleep(time.Second)
+	}
+	var err error
+	switch method {
+	case UpgradeMethodProvision:
+		err = cluster.UnprovisionDatabaseService(server)
+		if err != nil {
+			return "", false, err
+		}
+		err = cluster.WaitDatabaseFailed(server)
+		if err != nil {
+			return "", false, err
+		}
+		err = cluster.InitDatabaseService(server)
+		if err != nil {
+			return "", false, err
+		}
+	default:
+		err = cluster.StopDatabaseService(server)
+		if err != nil {
+			return "", false, err
+		}
+		err = cluster.WaitDatabaseFailed(server)
+		if err != nil {
+			return "", false, err
+		}
+		err = cluster.OnPremiseUpgradeDatabaseService(server, version)
+		if err != nil {
+			return "", false, err
+		}
+	}
+	err = cluster.StartDatabaseWaitRejoin(server)
+	if err != nil {
+		return "", false, err
+	}
+	server.Refresh()
+	if server.DBVersion == nil {
+		return "", false, fmt.Errorf("Unknown version after upgrade of %s", server.URL)
+	}
+	if version != "" && !server.DBVersion.GreaterEqual(version) {
+		return "", false, fmt.Errorf("Server %s is at version %s after upgrade", server.URL, server.DBVersion.ToFullString())
+	}
+	return "Upgraded to version " + server.DBVersion.ToFullString(), false, nil
+}
+
+// RunDatabaseUpgrade runs mariadb-upgrade or mysql_upgrade without binary logging, MySQL
+// from 8.0.16 upgrades its system tables at startup
+func (server *ServerMonitor) RunDatabaseUpgrade() (string, bool, error) {
+	cluster := server.ClusterGroup
+	if server.DBVersion == nil {
+		return "", false, errors.New("Unknown server version")
+	}
+	if server.DBVersion.IsMySQLOrPercona() && server.DBVersion.GreaterEqual("8.0.16") {
+		return "System tables upgraded by the server at startup", true, nil
+	}
+	upgradeCmd := exec.Command(cluster.GetMysqlUpgradePath(), "--host="+misc.Unbracket(server.Host), "--port="+server.Port, "--user="+cluster.GetDbUser(), "--password="+cluster.GetDbPass(), "--skip-write-binlog")
+	cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "%s", strings.Replace(upgradeCmd.String(), cluster.GetDbPass(), "XXXX", 1))
+	out, err := upgradeCmd.CombinedOutput()
+	if err != nil {
+		return "", false, fmt.Errorf("%s %s", err, strings.TrimSpace(string(out)))
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	return lines[len(lines)-1], false, nil
+}
+
+func (cluster *Cluster) upgradeCheckReplication(server *ServerMonitor) (string, bool, error) {
+	master := cluster.GetMaster()
+	if master == nil {
+		return "", false, errors.New("No master found")
+	}
+	if master.URL != server.URL {
+		server.WaitSyncToMaster(master)
+		if server.IsReplicationBroken() || !server.IsSQLThreadRunning() {
+			return "", false, fmt.Errorf("Replication of %s is not running", server.URL)
+		}
+	}
+	if server.IsMaintenance {
+		server.SwitchMaintenance()
+	}
+	return fmt.Sprintf("Replication delay %d", server.GetReplicationDelay()), false, nil
+}
+
+// getUpgradeChecksumTables returns upgrade-checksum-tables or a sample of the master tables
+func (cluster *Cluster) getUpgradeChecksumTables() []string {
+	var tables []string
+	if cluster.Conf.UpgradeChecksumTables != "" {
+		for _, t := range strings.Split(cluster.Conf.UpgradeChecksumTables, ",") {
+			if t = strings.TrimSpace(t); strings.Contains(t, ".") {
+				tables = append(tables, t)
+			}
+		}
+		return tables
+	}
+	master := cluster.GetMaster()
+	if master == nil {
+		return tables
+	}
+	for i := range master.Tables {
+		if len(tables) >= cluster.Conf.UpgradeChecksumSample {
+			break
+		}
+		t := &master.Tables[i]
+		if master.DictTables.Get(t.TableSchema+"."+t.TableName) != nil {
+			tables = append(tables, t.TableSchema+"."+t.TableName)
+		}
+	}
+	return tables
+}
+
+// upgradeChecksum compares the checksum of the sample tables on the master and the upgraded server
+func (cluster *Cluster) upgradeChecksum(server *ServerMonitor) (string, bool, error) {
+	master := cluster.GetMaster()
+	if master == nil {
+		return "", false, errors.New("No master found")
+	}
+	if master.URL == server.URL {
+		return "Server is the master", true, nil
+	}
+	tables := cluster.getUpgradeChecksumTables()
+	if len(tables) == 0 {
+		return "No table to checksum", true, nil
+	}
+	var checked []string
+	for _, t := range tables {
+		st := strings.SplitN(t, ".", 2)
+		if err := cluster.CheckTableChecksum(st[0], st[1]); err != nil {
+			return "", false, fmt.Errorf("Checksum of %s failed: %s", t, err)
+		}
+		dt := master.DictTables.Get(t)
+		if dt != nil && dt.TableSync == "NA" {
+			continue
+		}
+		masterChecksums, logs, err := dbhelper.GetTableChecksumResult(master.Conn)
+		cluster.LogSQL(logs, err, master.URL, "RollingUpgrade", config.LvlDbg, "GetTableChecksumResult")
+		if err != nil {
+			return "", false, err
+		}
+		slaveChecksums, logs, err := dbhelper.GetTableChecksumResult(server.Conn)
+		cluster.LogSQL(logs, err, server.URL, "RollingUpgrade", config.LvlDbg, "GetTableChecksumResult")
+		if err != nil {
+			return "", false, err
+		}
+		for id, chunk := range masterChecksums {
+			if chunk.ChunkCheckSum != slaveChecksums[id].ChunkCheckSum {
+				return "", false, fmt.Errorf("Checksum of %s differs on %s chunk(%s,%s)", t, server.URL, chunk.ChunkMinKey, chunk.ChunkMaxKey)
+			}
+		}
+		checked = append(checked, t)
+	}
+	if len(checked) == 0 {
+		return "No table with primary key to checksum", true, nil
+	}
+	return "Checksum ok " + strings.Join(checked, ","), false, nil
+}
+
+func (cluster *Cluster) upgradeSwitchover(oldMaster string) (string, bool, error) {
+	master := cluster.GetMaster()
+	if master == nil {
+		return "", false, errors.New("No master found")
+	}
+	if master.URL != oldMaster {
+		return "Master already switched to " + master.URL, true, nil
+	}
+	cluster.SwitchoverWaitTest()
+	master = cluster.GetMaster()
+	if master == nil || master.URL == oldMaster {
+		return "", false, errors.New("Switchover did not elect an upgraded replica")
+	}
+	return "New master " + master.URL, false, nil
+}
@@ -0,0 +1,61 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"testing"
+
+	"github.com/signal18/replication-manager/utils/state"
+)
+
+func newUpgradeTestCluster() *Cluster {
+	cluster := &Cluster{Name: "c1", StateMachine: new(state.StateMachine)}
+	cluster.StateMachine.Init()
+	return cluster
+}
+
+func TestStartRollingUpgradeVersion(t *testing.T) {
+	cluster := newUpgradeTestCluster()
+	cluster.Conf.UpgradeSSHScript = "/bin/true"
+	for _, version := range []string{"10.11", "10.11.6-MariaDB", "8.0.36", "11.4.2-1-ubu2204"} {
+		if _, err := cluster.StartRollingUpgrade(version); err == ErrUpgradeVersion {
+			t.Errorf("Expected version %s to be accepted", version)
+		}
+	}
+	for _, version := range []string{"10.11\"; rm -rf /; \"", "$(id)", "`id`", "10.11 11.4", "10.11\n", "../11"} {
+		if _, err := cluster.StartRollingUpgrade(version); err != ErrUpgradeVersion {
+			t.Errorf("Expected version %q to be refused, got %v", version, err)
+		}
+	}
+	// the configured version is checked too
+	cluster.Conf.UpgradeTargetVersion = "11.4;reboot"
+	if _, err := cluster.StartRollingUpgrade(""); err != ErrUpgradeVersion {
+		t.Errorf("Expected configured version to be refused, got %v", err)
+	}
+	if err := cluster.OnPremiseUpgradeDatabaseService(&ServerMonitor{URL: "db1:3306"}, "$(id)"); err != ErrUpgradeVersion {
+		t.Errorf("Expected ssh upgrade to refuse the version, got %v", err)
+	}
+}
+
+func TestUpgradeChecksumFailure(t *testing.T) {
+	cluster := newUpgradeTestCluster()
+	cluster.Conf.UpgradeChecksumTables = "app.t1"
+	master := &ServerMonitor{URL: "127.0.0.1:1", DSN: "repman:secret@tcp(127.0.0.1:1)/?timeout=1s", ClusterGroup: cluster}
+	cluster.master = master
+	cluster.Servers = serverList{master}
+	slave := &ServerMonitor{URL: "127.0.0.1:2", ClusterGroup: cluster}
+	// a checksum that can not run must fail the step instead of comparing the last results
+	if msg, skipped, err := cluster.upgradeChecksum(slave); err == nil || skipped {
+		t.Errorf("Expected checksum step to fail, got %q %v", msg, skipped)
+	}
+	if msg, skipped, err := cluster.upgradeChecksum(master); err != nil || !skipped {
+		t.Errorf("Expected checksum of the master to be skipped, got %q %v %v", msg, skipped, err)
+	}
+}
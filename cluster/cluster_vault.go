@@ -0,0 +1,294 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	vault "github.com/hashicorp/vault/api"
+	"github.com/signal18/replication-manager/config"
+	"github.com/signal18/replication-manager/utils/dbhelper"
+	"github.com/signal18/replication-manager/utils/state"
+	"github.com/signal18/replication-manager/utils/vaultlease"
+)
+
+// vaultRereadMinAge avoids asking Vault for new dynamic credentials in a loop when
+// authentication errors keep coming
+var vaultRereadMinAge = 30 * time.Second
+
+// VaultSecret is a credential read from Vault with its lease
+type VaultSecret struct {
+	Key   string                 `json:"key"`
+	Path  string                 `json:"path"`
+	Lease vaultlease.Lease       `json:"lease"`
+	Error string                 `json:"error,omitempty"`
+	data  map[string]interface{} `json:"-"`
+}
+
+// vaultProxyPasswords are the proxy admin passwords and the proxy type they belong to
+var vaultProxyPasswords = map[string]string{
+	"maxscale-pass":         config.ConstProxyMaxscale,
+	"haproxy-password":      config.ConstProxyHaproxy,
+	"proxyjanitor-password": config.ConstProxyJanitor,
+	"myproxy-password":      config.ConstProxyMyProxy,
+}
+
+func (cluster *Cluster) vaultLeaseThreshold() float64 {
+	if cluster.Conf.VaultLeaseRenewThreshold <= 0 || cluster.Conf.VaultLeaseRenewThreshold >= 100 {
+		return 0.33
+	}
+	return float64(cluster.Conf.VaultLeaseRenewThreshold) / 100
+}
+
+// readVaultDatabaseSecret returns the data of a database engine secret, it is only read again
+// once its lease can not be renewed anymore as every read of a dynamic role creates a new user
+func (cluster *Cluster) readVaultDatabaseSecret(client *vault.Client, key string, path string) (map[string]interface{}, error) {
+	cluster.vaultMutex.Lock()
+	defer cluster.vaultMutex.Unlock()
+	if cluster.vaultSecrets == nil {
+		cluster.vaultSecrets = make(map[string]*VaultSecret)
+	}
+	vs, ok := cluster.vaultSecrets[path]
+	if ok && vs.data != nil && vs.Lease.Next(time.Now(), cluster.vaultLeaseThreshold()) != vaultlease.Reread {
+		return vs.data, nil
+	}
+	if !ok {
+		vs = &VaultSecret{Key: key, Path: path}
+		cluster.vaultSecrets[path] = vs
+	}
+	s, lease, err := vaultlease.Read(client, path)
+	if err != nil {
+		vs.Error = err.Error()
+		return nil, err
+	}
+	vs.Lease = lease
+	vs.Error = ""
+	vs.data = s.Data
+	if lease.Expires.IsZero() {
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModVault, config.LvlInfo, "Vault secret %s read for %s", path, key)
+	} else {
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModVault, config.LvlInfo, "Vault secret %s read for %s, lease expires %s", path, key, lease.Expires.Format(time.RFC3339))
+	}
+	return s.Data, nil
+}
+
+// expireVaultDatabaseSecret forces the next read of a secret, after an authentication error or
+// a rotation requested to Vault
+func (cluster *Cluster) expireVaultDatabaseSecret(path string, minAge time.Duration) {
+	cluster.vaultMutex.Lock()
+	defer cluster.vaultMutex.Unlock()
+	if vs, ok := cluster.vaultSecrets[path]; ok && time.Since(vs.Lease.Obtained) >= minAge {
+		vs.data = nil
+	}
+}
+
+// RenewVaultLeases renews the leases of database engine credentials before they expire and
+// drops the ones that can not be renewed, the credential rotation check then reads new ones
+// while the old ones are still valid
+func (cluster *Cluster) RenewVaultLeases(client *vault.Client) {
+	cluster.vaultMutex.Lock()
+	defer cluster.vaultMutex.Unlock()
+	now := time.Now()
+	for path, vs := range cluster.vaultSecrets {
+		if vs.data == nil {
+			continue
+		}
+		switch vs.Lease.Next(now, cluster.vaultLeaseThreshold()) {
+		case vaultlease.Renew:
+			lease, err := vaultlease.RenewLease(client, vs.Lease)
+			if err != nil {
+				vs.Error = err.Error()
+				vs.data = nil
+				cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModVault, config.LvlWarn, "Could not renew Vault lease of %s, new credentials will be read: %s", path, err)
+				continue
+			}
+			vs.Lease = lease
+			vs.Error = ""
+			cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModVault, config.LvlInfo, "Vault lease of %s renewed until %s", path, lease.Expires.Format(time.RFC3339))
+		case vaultlease.Reread:
+			vs.data = nil
+			cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModVault, config.LvlInfo, "Vault lease of %s ends, new credentials will be read", path)
+		}
+	}
+}
+
+// GetVaultSecrets returns the Vault secrets used by the cluster and their leases
+func (cluster *Cluster) GetVaultSecrets() []VaultSecret {
+	cluster.vaultMutex.Lock()
+	defer cluster.vaultMutex.Unlock()
+	list := make([]VaultSecret, 0, len(cluster.vaultSecrets)+len(cluster.vaultPaths))
+	seen := make(map[string]bool)
+	for _, vs := range cluster.vaultSecrets {
+		list = append(list, *vs)
+		seen[vs.Path] = true
+	}
+	for key, path := range cluster.vaultPaths {
+		if !seen[path] {
+			list = append(list, VaultSecret{Key: key, Path: path})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list
+}
+
+// vaultUserPass returns the username and password of a database engine secret
+func vaultUserPass(data map[string]interface{}) (string, string, error) {
+	user, _ := data["username"].(string)
+	pass, _ := data["password"].(string)
+	if user == "" || pass == "" {
+		return "", "", errors.New("No username or password in Vault secret")
+	}
+	return user, pass, nil
+}
+
+// vaultSecretValue returns the value of a configuration secret from Vault data, a field named
+// like the key, or the username and password of a database role
+func vaultSecretValue(key string, data map[string]interface{}) (string, error) {
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		data = nested
+	}
+	if v, ok := data[key].(string); ok {
+		return v, nil
+	}
+	user, pass, err := vaultUserPass(data)
+	if err != nil {
+		return "", fmt.Errorf("No %s field in Vault secret", key)
+	}
+	if strings.HasSuffix(key, "-password") || strings.HasSuffix(key, "-pass") {
+		return pass, nil
+	}
+	return user + ":" + pass, nil
+}
+
+// getVaultSecretValue reads a configuration secret from Vault in the configured mode
+func (cluster *Cluster) getVaultSecretValue(client *vault.Client, key string, path string) (string, error) {
+	if cluster.Conf.VaultMode == VaultConfigStoreV2 {
+		return cluster.Conf.GetVaultCredentials(client, path, key)
+	}
+	data, err := cluster.readVaultDatabaseSecret(client, key, path)
+	if err != nil {
+		return "", err
+	}
+	return vaultSecretValue(key, data)
+}
+
+func (cluster *Cluster) setVaultPath(key string, path string) {
+	cluster.vaultMutex.Lock()
+	defer cluster.vaultMutex.Unlock()
+	if cluster.vaultPaths == nil {
+		cluster.vaultPaths = make(map[string]string)
+	}
+	cluster.vaultPaths[key] = path
+}
+
+// CheckVaultSecretsRotation reads again the secrets that have no dedicated rotation and applies
+// the changed ones: API users, heartbeat writer and proxy admin passwords
+func (cluster *Cluster) CheckVaultSecretsRotation(client *vault.Client) {
+	cluster.vaultMutex.Lock()
+	paths := make(map[string]string, len(cluster.vaultPaths))
+	for k, p := range cluster.vaultPaths {
+		paths[k] = p
+	}
+	cluster.vaultMutex.Unlock()
+
+	for key, path := range paths {
+		switch key {
+		case "db-servers-credential", "replication-credential", "proxysql-password", "shardproxy-credential":
+			// rotated by CheckCredentialRotation
+			continue
+		}
+		value, err := cluster.getVaultSecretValue(client, key, path)
+		if err != nil || value == "" || value == cluster.Conf.Secrets[key].Value {
+			continue
+		}
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModVault, config.LvlInfo, "Vault secret %s changed, applying it", key)
+		cluster.Conf.Secrets[key] = config.Secret{OldValue: cluster.Conf.Secrets[key].Value, Value: value}
+		switch key {
+		case "api-credentials", "api-credentials-external":
+			cluster.LoadAPIUsers()
+		default:
+			if prxType, ok := vaultProxyPasswords[key]; ok {
+				cluster.setVaultProxyPassword(prxType, value)
+			}
+		}
+	}
+}
+
+func (cluster *Cluster) setVaultProxyPassword(prxType string, pass string) {
+	for _, pri := range cluster.Proxies {
+		if pri.GetType() != prxType {
+			continue
+		}
+		pri.SetCredential(pri.GetUser() + ":" + pass)
+	}
+}
+
+// RotateReplicationCredentials moves every replica to the current replication credentials,
+// with the config store the master password is changed first so that replicas can reconnect
+func (cluster *Cluster) RotateReplicationCredentials() {
+	master := cluster.GetMaster()
+	if cluster.Conf.VaultMode == VaultConfigStoreV2 && master != nil && !master.IsDown() {
+		for _, u := range master.Users.ToNewMap() {
+			if u.User == cluster.GetRplUser() {
+				logs, err := dbhelper.SetUserPassword(master.Conn, master.DBVersion, u.Host, u.User, cluster.GetRplPass())
+				cluster.LogSQL(logs, err, master.URL, "Security", config.LvlErr, "Alter user : %s", err)
+			}
+		}
+	}
+	for _, slave := range cluster.slaves {
+		slave.changeReplicationCredentials()
+	}
+}
+
+// changeReplicationCredentials points every replication channel of a replica to the current
+// replication credentials, multi-source channels would otherwise break on the next reconnect
+func (server *ServerMonitor) changeReplicationCredentials() error {
+	if len(server.Replications) == 0 {
+		return server.changeChannelCredentials(nil)
+	}
+	var err error
+	for i := range server.Replications {
+		if cerr := server.changeChannelCredentials(&server.Replications[i]); cerr != nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// changeChannelCredentials points a replication channel to the current replication credentials and
+// checks that its IO thread authenticates, retrying before raising a warning so that a
+// replica is never silently left with stale credentials
+func (server *ServerMonitor) changeChannelCredentials(rs *dbhelper.SlaveStatus) error {
+	cluster := server.ClusterGroup
+	channel := server.getStatusChannel(rs)
+	var err error
+	for attempt := 1; attempt <= 3; attempt++ {
+		err = server.rejoinSlaveChangePassword(rs)
+		if err == nil {
+			time.Sleep(2 * time.Second)
+			ss, _, serr := dbhelper.GetSlaveStatus(server.Conn, channel, server.DBVersion)
+			if serr != nil {
+				err = serr
+			} else if ss.LastIOErrno.String == "1045" {
+				err = errors.New(ss.LastIOError.String)
+			} else {
+				cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModVault, config.LvlInfo, "Replica %s channel '%s' uses the rotated replication credentials", server.URL, channel)
+				return nil
+			}
+		}
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModVault, config.LvlWarn, "Replica %s channel '%s' could not use the rotated replication credentials, attempt %d: %s", server.URL, channel, attempt, err)
+	}
+	cluster.SetState("WARN0137", state.State{ErrType: "WARNING", ErrDesc: fmt.Sprintf(clusterError["WARN0137"], server.URL, err), ErrFrom: "TOPO", ServerUrl: server.URL})
+	return err
+}
@@ -0,0 +1,35 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/signal18/replication-manager/config"
+	"github.com/signal18/replication-manager/utils/dbhelper"
+)
+
+func TestGetStatusChannel(t *testing.T) {
+	cluster := &Cluster{Name: "c1", Conf: config.Config{MasterConn: "main"}}
+	server := &ServerMonitor{ClusterGroup: cluster}
+
+	if c := server.getStatusChannel(nil); c != "main" {
+		t.Errorf("Expected cluster channel without status, got '%s'", c)
+	}
+	ss := &dbhelper.SlaveStatus{ConnectionName: sql.NullString{String: "src2", Valid: true}}
+	if c := server.getStatusChannel(ss); c != "src2" {
+		t.Errorf("Expected multi-source channel to be kept, got '%s'", c)
+	}
+	ss = &dbhelper.SlaveStatus{ConnectionName: sql.NullString{String: "", Valid: true}}
+	if c := server.getStatusChannel(ss); c != "" {
+		t.Errorf("Expected default channel to be kept, got '%s'", c)
+	}
+}
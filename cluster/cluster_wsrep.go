@@ -0,0 +1,656 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/signal18/replication-manager/config"
+	"github.com/signal18/replication-manager/utils/dbhelper"
+	"github.com/signal18/replication-manager/utils/state"
+)
+
+const (
+	WsrepActionBootstrap      = "bootstrap"
+	WsrepActionRecoverPrimary = "recover-primary"
+	WsrepActionForcePrimary   = "recover-primary-force"
+	WsrepActionRecoverSeqno   = "recover-position"
+	WsrepActionRollingRestart = "rolling-restart"
+
+	wsrepJobHistory = 20
+)
+
+var (
+	ErrWsrepTopology   = errors.New("Cluster topology is not multi-master-wsrep")
+	ErrWsrepJobRunning = errors.New("A wsrep job is already running")
+	ErrWsrepNoNode     = errors.New("No wsrep node available")
+	ErrWsrepNotDown    = errors.New("Bootstrap requires all wsrep nodes to be stopped")
+	ErrWsrepHasPrimary = errors.New("A wsrep node is already in a primary component")
+	ErrWsrepNodeDown   = errors.New("All wsrep nodes must be reachable to recover the primary component, use recover-primary-force")
+
+	wsrepRecoveredPosition = regexp.MustCompile(`Recovered position:?\s+([0-9a-fA-F-]+):(-?[0-9]+)`)
+)
+
+// WsrepGrastate is the saved state of a node read from grastate.dat,
+// the seqno is recovered from InnoDB when the node was not shut down cleanly
+type WsrepGrastate struct {
+	URL             string `json:"url"`
+	UUID            string `json:"uuid"`
+	Seqno           int64  `json:"seqno"`
+	SafeToBootstrap bool   `json:"safeToBootstrap"`
+	Recovered       bool   `json:"recovered"`
+	Error           string `json:"error,omitempty"`
+}
+
+// WsrepNode is the wsrep state of a node as seen by the monitor
+type WsrepNode struct {
+	URL               string `json:"url"`
+	Name              string `json:"name"`
+	State             string `json:"state"`
+	IsLeader          bool   `json:"isLeader"`
+	ClusterStatus     string `json:"clusterStatus"`
+	ClusterSize       string `json:"clusterSize"`
+	ClusterStateUUID  string `json:"clusterStateUuid"`
+	LocalState        string `json:"localState"`
+	LocalStateComment string `json:"localStateComment"`
+	LastCommitted     string `json:"lastCommitted"`
+	Desync            bool   `json:"desync"`
+	FlowControlPaused int    `json:"flowControlPaused"`
+	RecvQueue         string `json:"recvQueue"`
+	SendQueue         string `json:"sendQueue"`
+}
+
+// WsrepJob tracks a bootstrap, a primary component recovery or a rolling restart
+type WsrepJob struct {
+	ID     string    `json:"id"`
+	Action string    `json:"action"`
+	Status string    `json:"status"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end,omitempty"`
+	Steps  []string  `json:"steps"`
+	Error  string    `json:"error,omitempty"`
+}
+
+type WsrepStatus struct {
+	Enabled      bool        `json:"enabled"`
+	Leader       string      `json:"leader"`
+	HasPrimary   bool        `json:"hasPrimary"`
+	DesyncBackup string      `json:"desyncBackup"`
+	Nodes        []WsrepNode `json:"nodes"`
+	Jobs         []WsrepJob  `json:"jobs"`
+}
+
+func (cluster *Cluster) IsWsrep() bool {
+	return cluster.GetTopology() == config.TopoMultiMasterWsrep
+}
+
+func (server *ServerMonitor) GetWsrepNode() WsrepNode {
+	return WsrepNode{
+		URL:               server.URL,
+		Name:              server.Name,
+		State:             server.State,
+		IsLeader:          server.IsLeader(),
+		ClusterStatus:     server.Status.Get("WSREP_CLUSTER_STATUS"),
+		ClusterSize:       server.Status.Get("WSREP_CLUSTER_SIZE"),
+		ClusterStateUUID:  server.Status.Get("WSREP_CLUSTER_STATE_UUID"),
+		LocalState:        server.Status.Get("WSREP_LOCAL_STATE"),
+		LocalStateComment: server.Status.Get("WSREP_LOCAL_STATE_COMMENT"),
+		LastCommitted:     server.Status.Get("WSREP_LAST_COMMITTED"),
+		Desync:            server.Variables.Get("WSREP_DESYNC") == "ON",
+		FlowControlPaused: server.WsrepFlowControl,
+		RecvQueue:         server.Status.Get("WSREP_LOCAL_RECV_QUEUE"),
+		SendQueue:         server.Status.Get("WSREP_LOCAL_SEND_QUEUE"),
+	}
+}
+
+func (cluster *Cluster) GetWsrep() WsrepStatus {
+	st := WsrepStatus{
+		Enabled: cluster.IsWsrep(),
+		Nodes:   []WsrepNode{},
+		Jobs:    []WsrepJob{},
+	}
+	if cluster.vmaster != nil {
+		st.Leader = cluster.vmaster.URL
+	}
+	for _, server := range cluster.Servers {
+		if server == nil {
+			continue
+		}
+		node := server.GetWsrepNode()
+		if !server.IsDown() && server.IsWsrepPrimary {
+			st.HasPrimary = true
+		}
+		st.Nodes = append(st.Nodes, node)
+	}
+	cluster.wsrepMutex.Lock()
+	defer cluster.wsrepMutex.Unlock()
+	if cluster.wsrepDesyncServer != nil {
+		st.DesyncBackup = cluster.wsrepDesyncServer.URL
+	}
+	for i := len(cluster.wsrepJobs) - 1; i >= 0; i-- {
+		st.Jobs = append(st.Jobs, cluster.wsrepJobs[i])
+	}
+	return st
+}
+
+// ReadWsrepGrastate reads grastate.dat over ssh, when the node crashed the saved seqno
+// is -1 and the position is recovered with mysqld --wsrep-recover if recover is set
+func (server *ServerMonitor) ReadWsrepGrastate(recover bool) WsrepGrastate {
+	cluster := server.ClusterGroup
+	gs := WsrepGrastate{URL: server.URL, Seqno: -1}
+	datadir := server.GetDatabaseDatadir()
+	if strings.ContainsAny(datadir, "'\n") {
+		gs.Error = "unexpected datadir " + datadir
+		return gs
+	}
+	client, err := cluster.OnPremiseConnect(server)
+	if err != nil {
+		gs.Error = err.Error()
+		return gs
+	}
+	defer client.Close()
+	out, err := client.Cmd("cat '" + datadir + "/grastate.dat'").SmartOutput()
+	if err != nil {
+		gs.Error = err.Error()
+		return gs
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		pair := strings.SplitN(line, ":", 2)
+		if len(pair) != 2 || strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		value := strings.TrimSpace(pair[1])
+		switch strings.TrimSpace(pair[0]) {
+		case "uuid":
+			gs.UUID = value
+		case "seqno":
+			gs.Seqno, _ = strconv.ParseInt(value, 10, 64)
+		case "safe_to_bootstrap":
+			gs.SafeToBootstrap = value == "1"
+		}
+	}
+	if gs.Seqno >= 0 || !recover || !server.IsDown() {
+		return gs
+	}
+	logfile := "/tmp/wsrep-recover-" + server.Port + ".log"
+	cmd := "mysqld --user=mysql --datadir='" + datadir + "' --wsrep-recover --log-error=" + logfile + " >/dev/null 2>&1; grep 'Recovered position' " + logfile + " | tail -1; rm -f " + logfile
+	out, err = client.Cmd(cmd).SmartOutput()
+	if err != nil {
+		gs.Error = fmt.Sprintf("wsrep recover %s", err)
+		return gs
+	}
+	if m := wsrepRecoveredPosition.FindStringSubmatch(string(out)); m != nil {
+		gs.UUID = m[1]
+		gs.Seqno, _ = strconv.ParseInt(m[2], 10, 64)
+		gs.Recovered = true
+	} else {
+		gs.Error = "wsrep recover found no position"
+	}
+	return gs
+}
+
+func (cluster *Cluster) GetWsrepGrastates(recover bool) []WsrepGrastate {
+	states := []WsrepGrastate{}
+	for _, server := range cluster.Servers {
+		if server != nil {
+			states = append(states, server.ReadWsrepGrastate(recover))
+		}
+	}
+	return states
+}
+
+// getWsrepBootstrapNode returns the node with the most advanced seqno, safe_to_bootstrap
+// breaks a tie. All nodes must report their position to bootstrap safely.
+func (cluster *Cluster) getWsrepBootstrapNode(states []WsrepGrastate) (*ServerMonitor, WsrepGrastate, error) {
+	var best *WsrepGrastate
+	for i := range states {
+		gs := &states[i]
+		if gs.Error != "" {
+			return nil, WsrepGrastate{}, fmt.Errorf("Can't read position of %s: %s", gs.URL, gs.Error)
+		}
+		if best == nil || gs.Seqno > best.Seqno || (gs.Seqno == best.Seqno && gs.SafeToBootstrap && !best.SafeToBootstrap) {
+			best = gs
+		}
+	}
+	if best == nil {
+		return nil, WsrepGrastate{}, ErrWsrepNoNode
+	}
+	if best.Seqno < 0 {
+		return nil, *best, fmt.Errorf("No valid position on %s", best.URL)
+	}
+	server := cluster.GetServerFromURL(best.URL)
+	if server == nil {
+		return nil, *best, ErrWsrepNoNode
+	}
+	return server, *best, nil
+}
+
+func (cluster *Cluster) StartWsrepJob(action string) (WsrepJob, error) {
+	if !cluster.IsWsrep() {
+		return WsrepJob{}, ErrWsrepTopology
+	}
+	switch action {
+	case WsrepActionBootstrap, WsrepActionRecoverPrimary, WsrepActionForcePrimary, WsrepActionRecoverSeqno, WsrepActionRollingRestart:
+	default:
+		return WsrepJob{}, fmt.Errorf("Unknown wsrep action %s", action)
+	}
+	cluster.wsrepMutex.Lock()
+	for _, job := range cluster.wsrepJobs {
+		if job.Status == JobStatusRunning {
+			cluster.wsrepMutex.Unlock()
+			return WsrepJob{}, ErrWsrepJobRunning
+		}
+	}
+	now := time.Now()
+	job := WsrepJob{
+		ID:     strconv.FormatInt(now.UnixNano(), 36),
+		Action: action,
+		Status: JobStatusRunning,
+		Start:  now,
+		Steps:  []string{},
+	}
+	cluster.wsrepJobs = append(cluster.wsrepJobs, job)
+	if len(cluster.wsrepJobs) > wsrepJobHistory {
+		cluster.wsrepJobs = cluster.wsrepJobs[len(cluster.wsrepJobs)-wsrepJobHistory:]
+	}
+	cluster.wsrepMutex.Unlock()
+
+	go cluster.runWsrepJob(job.ID, action)
+	return job, nil
+}
+
+func (cluster *Cluster) runWsrepJob(id string, action string) {
+	var err error
+	switch action {
+	case WsrepActionBootstrap:
+		err = cluster.wsrepBootstrap(id)
+	case WsrepActionRecoverPrimary:
+		err = cluster.wsrepRecoverPrimary(id, false)
+	case WsrepActionForcePrimary:
+		err = cluster.wsrepRecoverPrimary(id, true)
+	case WsrepActionRecoverSeqno:
+		err = cluster.wsrepRecoverSeqno(id)
+	case WsrepActionRollingRestart:
+		err = cluster.wsrepRollingRestart(id)
+	}
+	cluster.wsrepMutex.Lock()
+	defer cluster.wsrepMutex.Unlock()
+	for i := range cluster.wsrepJobs {
+		if cluster.wsrepJobs[i].ID == id {
+			cluster.wsrepJobs[i].End = time.Now()
+			cluster.wsrepJobs[i].Status = JobStatusSuccess
+			if err != nil {
+				cluster.wsrepJobs[i].Status = JobStatusFailed
+				cluster.wsrepJobs[i].Error = err.Error()
+			}
+		}
+	}
+	if err != nil {
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModTopology, config.LvlErr, "Wsrep %s failed: %s", action, err)
+	} else {
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModTopology, config.LvlInfo, "Wsrep %s done", action)
+	}
+}
+
+func (cluster *Cluster) wsrepStep(id string, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModTopology, config.LvlInfo, "Wsrep: %s", msg)
+	if id == "" {
+		return
+	}
+	cluster.wsrepMutex.Lock()
+	defer cluster.wsrepMutex.Unlock()
+	for i := range cluster.wsrepJobs {
+		if cluster.wsrepJobs[i].ID == id {
+			cluster.wsrepJobs[i].Steps = append(cluster.wsrepJobs[i].Steps, time.Now().Format("15:04:05")+" "+msg)
+		}
+	}
+}
+
+// waitWsrep polls the node until the condition is true or wsrep-sync-timeout expires
+func (cluster *Cluster) waitWsrep(server *ServerMonitor, what string, cond func(*ServerMonitor) bool) error {
+	timeout := time.Now().Add(time.Duration(cluster.Conf.WsrepSyncTimeout) * time.Second)
+	for time.Now().Before(timeout) {
+		if !server.IsDown() && cond(server) {
+			return nil
+		}
+		time.Sleep(time.Second * time.Duration(cluster.Conf.MonitoringTicker))
+	}
+	return fmt.Errorf("Timeout waiting %s to be %s", server.URL, what)
+}
+
+func wsrepIsPrimary(server *ServerMonitor) bool {
+	return server.IsWsrepPrimary
+}
+
+func wsrepIsSynced(server *ServerMonitor) bool {
+	return server.IsWsrepPrimary && server.IsWsrepSync
+}
+
+// wsrepBootstrap starts a stopped cluster from the most advanced node, the other nodes
+// join one by one through SST or IST
+func (cluster *Cluster) wsrepBootstrap(id string) error {
+	if !cluster.AllServersFailed() {
+		return ErrWsrepNotDown
+	}
+	states := cluster.wsrepReadPositions(id)
+	first, gs, err := cluster.getWsrepBootstrapNode(states)
+	if err != nil {
+		return err
+	}
+	cluster.wsrepStep(id, "Bootstrap node %s with seqno %d", first.URL, gs.Seqno)
+	if !gs.SafeToBootstrap {
+		client, err := cluster.OnPremiseConnect(first)
+		if err != nil {
+			return err
+		}
+		_, err = client.Cmd("sed -i 's/^safe_to_bootstrap:.*/safe_to_bootstrap: 1/' '" + first.GetDatabaseDatadir() + "/grastate.dat'").SmartOutput()
+		client.Close()
+		if err != nil {
+			return fmt.Errorf("Set safe_to_bootstrap on %s: %s", first.URL, err)
+		}
+		cluster.wsrepStep(id, "Set safe_to_bootstrap on %s", first.URL)
+	}
+	// GetGComm returns an empty cluster address while all nodes are down, the first node
+	// starts a new cluster
+	if err := cluster.StartDatabaseService(first); err != nil {
+		return err
+	}
+	if err := cluster.waitWsrep(first, "primary", wsrepIsPrimary); err != nil {
+		return err
+	}
+	cluster.wsrepStep(id, "%s is primary", first.URL)
+	for _, server := range cluster.Servers {
+		if server == nil || server.URL == first.URL {
+			continue
+		}
+		cluster.wsrepStep(id, "Starting %s", server.URL)
+		if err := cluster.StartDatabaseService(server); err != nil {
+			return err
+		}
+		if err := cluster.waitWsrep(server, "synced", wsrepIsSynced); err != nil {
+			return err
+		}
+		cluster.wsrepStep(id, "%s is synced", server.URL)
+	}
+	return nil
+}
+
+// wsrepReadPositions reads the saved position of every node, recovering it from InnoDB
+// on the stopped nodes that crashed
+func (cluster *Cluster) wsrepReadPositions(id string) []WsrepGrastate {
+	cluster.wsrepStep(id, "Reading grastate.dat of %d nodes", len(cluster.Servers))
+	states := cluster.GetWsrepGrastates(true)
+	for _, gs := range states {
+		if gs.Error != "" {
+			cluster.wsrepStep(id, "%s position error %s", gs.URL, gs.Error)
+		} else {
+			cluster.wsrepStep(id, "%s uuid %s seqno %d safe_to_bootstrap %t recovered %t", gs.URL, gs.UUID, gs.Seqno, gs.SafeToBootstrap, gs.Recovered)
+		}
+	}
+	return states
+}
+
+// wsrepRecoverSeqno runs mysqld --wsrep-recover on the stopped nodes without a saved seqno
+// and records the positions in the job steps
+func (cluster *Cluster) wsrepRecoverSeqno(id string) error {
+	for _, gs := range cluster.wsrepReadPositions(id) {
+		if gs.Error != "" {
+			return fmt.Errorf("Can't read position of %s: %s", gs.URL, gs.Error)
+		}
+	}
+	return nil
+}
+
+// getWsrepRecoverNode returns the node with the highest last committed seqno. Unless forced,
+// every configured node must be reachable and non-primary: a node that can't be seen may
+// still be primary on the other side of a partition and bootstrapping would split the cluster.
+func (cluster *Cluster) getWsrepRecoverNode(force bool) (*ServerMonitor, int64, error) {
+	var best *ServerMonitor
+	var bestSeqno int64 = -1
+	for _, server := range cluster.Servers {
+		if server == nil {
+			continue
+		}
+		if server.IsDown() || server.Conn == nil {
+			if !force {
+				return nil, -1, ErrWsrepNodeDown
+			}
+			continue
+		}
+		if server.IsWsrepPrimary {
+			return nil, -1, ErrWsrepHasPrimary
+		}
+		seqno, err := strconv.ParseInt(server.Status.Get("WSREP_LAST_COMMITTED"), 10, 64)
+		if err != nil {
+			if !force {
+				return nil, -1, fmt.Errorf("Can't read last committed seqno of %s", server.URL)
+			}
+			continue
+		}
+		if seqno > bestSeqno {
+			best = server
+			bestSeqno = seqno
+		}
+	}
+	if best == nil {
+		return nil, -1, ErrWsrepNoNode
+	}
+	return best, bestSeqno, nil
+}
+
+// wsrepRecoverPrimary bootstraps a new primary component on the most advanced node
+// after a network partition left every node non-primary
+func (cluster *Cluster) wsrepRecoverPrimary(id string, force bool) error {
+	for _, server := range cluster.Servers {
+		if server != nil && !server.IsDown() && server.Status != nil {
+			cluster.wsrepStep(id, "%s last committed %s", server.URL, server.Status.Get("WSREP_LAST_COMMITTED"))
+		}
+	}
+	best, bestSeqno, err := cluster.getWsrepRecoverNode(force)
+	if err != nil {
+		return err
+	}
+	if force {
+		cluster.wsrepStep(id, "Forced recovery on %s with seqno %d, unreachable nodes are ignored", best.URL, bestSeqno)
+	}
+	logs, err := dbhelper.SetWsrepPcBootstrap(best.Conn)
+	cluster.LogSQL(logs, err, best.URL, "Wsrep", config.LvlErr, "Could not bootstrap primary component on %s: %s", best.URL, err)
+	if err != nil {
+		return err
+	}
+	cluster.wsrepStep(id, "Bootstrapped primary component on %s", best.URL)
+	if err := cluster.waitWsrep(best, "primary", wsrepIsPrimary); err != nil {
+		return err
+	}
+	cluster.wsrepStep(id, "%s is primary", best.URL)
+	return nil
+}
+
+// wsrepRollingRestart restarts one node at a time, the leader last. A node is only stopped
+// when all other nodes are synced and none is desynced for a backup.
+func (cluster *Cluster) wsrepRollingRestart(id string) error {
+	cluster.SetInRollingRestart(true)
+	defer cluster.SetInRollingRestart(false)
+
+	nodes := []*ServerMonitor{}
+	var leader *ServerMonitor
+	for _, server := range cluster.Servers {
+		if server == nil || server.IsDown() {
+			continue
+		}
+		if server.IsLeader() {
+			leader = server
+			continue
+		}
+		nodes = append(nodes, server)
+	}
+	if leader != nil {
+		nodes = append(nodes, leader)
+	}
+	if len(nodes) == 0 {
+		return ErrWsrepNoNode
+	}
+	for _, server := range nodes {
+		for _, other := range cluster.Servers {
+			if other == nil || other.URL == server.URL {
+				continue
+			}
+			err := cluster.waitWsrep(other, "synced and not desynced", func(s *ServerMonitor) bool {
+				return wsrepIsSynced(s) && s.Variables.Get("WSREP_DESYNC") != "ON"
+			})
+			if err != nil {
+				return err
+			}
+		}
+		cluster.wsrepStep(id, "Restarting %s", server.URL)
+		if !server.IsMaintenance {
+			server.SetMaintenance()
+		}
+		if err := cluster.StopDatabaseService(server); err != nil {
+			server.DelMaintenance()
+			return err
+		}
+		if err := cluster.WaitDatabaseFailed(server); err != nil {
+			server.DelMaintenance()
+			return err
+		}
+		if err := cluster.StartDatabaseService(server); err != nil {
+			return err
+		}
+		if err := cluster.waitWsrep(server, "synced", wsrepIsSynced); err != nil {
+			return err
+		}
+		server.DelMaintenance()
+		cluster.wsrepStep(id, "%s is synced", server.URL)
+	}
+	return nil
+}
+
+// CheckWsrep raises non primary nodes and flow control pauses, and recovers the primary
+// component when no node has been primary for wsrep-non-primary-timeout
+func (cluster *Cluster) CheckWsrep() {
+	if !cluster.IsWsrep() {
+		return
+	}
+	hasPrimary := false
+	hasUp := false
+	for _, server := range cluster.Servers {
+		if server == nil || server.IsDown() || !server.HaveWsrep {
+			continue
+		}
+		hasUp = true
+		if server.IsWsrepPrimary {
+			hasPrimary = true
+		} else {
+			cluster.SetState("ERR00100", state.State{ErrType: config.LvlErr, ErrDesc: fmt.Sprintf(clusterError["ERR00100"], server.URL, strings.ToLower(server.Status.Get("WSREP_CLUSTER_STATUS"))), ErrFrom: "MON", ServerUrl: server.URL})
+		}
+		server.checkWsrepFlowControl()
+	}
+	if hasPrimary || !hasUp {
+		cluster.wsrepNonPrimarySince = time.Time{}
+		return
+	}
+	if cluster.wsrepNonPrimarySince.IsZero() {
+		cluster.wsrepNonPrimarySince = time.Now()
+		return
+	}
+	if !cluster.Conf.WsrepRecoverNonPrimary || !cluster.IsActive() || time.Since(cluster.wsrepNonPrimarySince) < time.Duration(cluster.Conf.WsrepNonPrimaryTimeout)*time.Second {
+		return
+	}
+	cluster.wsrepNonPrimarySince = time.Time{}
+	if _, _, err := cluster.getWsrepRecoverNode(false); err != nil {
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModTopology, config.LvlErr, "Wsrep primary component recovery not started: %s", err)
+		return
+	}
+	if _, err := cluster.StartWsrepJob(WsrepActionRecoverPrimary); err != nil && err != ErrWsrepJobRunning {
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModTopology, config.LvlErr, "Wsrep primary component recovery failed to start: %s", err)
+	}
+}
+
+// checkWsrepFlowControl computes the percentage of time the node was paused by flow
+// control since the previous monitoring pass
+func (server *ServerMonitor) checkWsrepFlowControl() {
+	cluster := server.ClusterGroup
+	paused, err := strconv.ParseInt(server.Status.Get("WSREP_FLOW_CONTROL_PAUSED_NS"), 10, 64)
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	if !server.WsrepFlowControlCheck.IsZero() && paused >= server.WsrepFlowControlPausedNs {
+		elapsed := now.Sub(server.WsrepFlowControlCheck).Nanoseconds()
+		if elapsed > 0 {
+			server.WsrepFlowControl = int((paused - server.WsrepFlowControlPausedNs) * 100 / elapsed)
+		}
+	}
+	server.WsrepFlowControlPausedNs = paused
+	server.WsrepFlowControlCheck = now
+	if cluster.Conf.WsrepFlowControlMaxPaused > 0 && server.WsrepFlowControl > cluster.Conf.WsrepFlowControlMaxPaused {
+		cluster.SetState("WARN0149", state.State{ErrType: config.LvlWarn, ErrDesc: fmt.Sprintf(clusterError["WARN0149"], server.URL, server.WsrepFlowControl, cluster.Conf.WsrepFlowControlMaxPaused), ErrFrom: "MON", ServerUrl: server.URL})
+	}
+}
+
+// getWsrepDonor returns a synced node that is not the leader to take backups from
+func (cluster *Cluster) getWsrepDonor() *ServerMonitor {
+	for _, server := range cluster.Servers {
+		if server != nil && !server.IsDown() && server.IsWsrepSync && !server.IsLeader() {
+			return server
+		}
+	}
+	return nil
+}
+
+// setWsrepBackupDesync desyncs the backup node for the time of the backup so that
+// it does not trigger flow control on the cluster
+func (cluster *Cluster) setWsrepBackupDesync(value bool) {
+	if !cluster.IsWsrep() || !cluster.Conf.WsrepBackupDesync {
+		return
+	}
+	cluster.wsrepMutex.Lock()
+	defer cluster.wsrepMutex.Unlock()
+	server := cluster.wsrepDesyncServer
+	if value {
+		if server != nil {
+			return
+		}
+		server = cluster.GetBackupServer()
+	}
+	if server == nil || server.Conn == nil {
+		return
+	}
+	if !value && (cluster.InPhysicalBackup || cluster.InLogicalBackup) {
+		return
+	}
+	logs, err := dbhelper.SetWsrepDesync(server.Conn, value)
+	cluster.LogSQL(logs, err, server.URL, "Wsrep", config.LvlErr, "Could not set wsrep_desync on %s: %s", server.URL, err)
+	if err != nil {
+		return
+	}
+	if value {
+		cluster.wsrepDesyncServer = server
+	} else {
+		cluster.wsrepDesyncServer = nil
+	}
+}
+
+func (server *ServerMonitor) SetWsrepDesync(value bool) error {
+	cluster := server.ClusterGroup
+	if server.Conn == nil {
+		return ErrWsrepNoNode
+	}
+	logs, err := dbhelper.SetWsrepDesync(server.Conn, value)
+	cluster.LogSQL(logs, err, server.URL, "Wsrep", config.LvlErr, "Could not set wsrep_desync on %s: %s", server.URL, err)
+	return err
+}
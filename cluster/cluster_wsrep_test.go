@@ -0,0 +1,99 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/signal18/replication-manager/config"
+)
+
+func newWsrepTestCluster(seqnos ...string) *Cluster {
+	cluster := &Cluster{Name: "c1"}
+	for i, seqno := range seqnos {
+		host := "db" + string(rune('1'+i))
+		server := &ServerMonitor{URL: host + ":3306", Host: host, Port: "3306", ClusterGroup: cluster, State: stateSlave, Conn: &sqlx.DB{}, Status: config.NewStringsMap()}
+		server.Status.Set("WSREP_LAST_COMMITTED", seqno)
+		cluster.Servers = append(cluster.Servers, server)
+	}
+	return cluster
+}
+
+func TestWsrepRecoverNode(t *testing.T) {
+	cluster := newWsrepTestCluster("10", "12", "11")
+	best, seqno, err := cluster.getWsrepRecoverNode(false)
+	if err != nil || best.URL != "db2:3306" || seqno != 12 {
+		t.Fatalf("Expected db2:3306 with seqno 12, got %v %d %v", best, seqno, err)
+	}
+	cluster.Servers[2].IsWsrepPrimary = true
+	if _, _, err := cluster.getWsrepRecoverNode(true); err != ErrWsrepHasPrimary {
+		t.Errorf("Expected primary error even when forced, got %v", err)
+	}
+}
+
+func TestWsrepRecoverNodeDown(t *testing.T) {
+	cluster := newWsrepTestCluster("10", "12", "11")
+	// the most advanced node may still be primary on the other side of a partition
+	cluster.Servers[1].State = stateFailed
+	if _, _, err := cluster.getWsrepRecoverNode(false); err != ErrWsrepNodeDown {
+		t.Fatalf("Expected down node error, got %v", err)
+	}
+	best, seqno, err := cluster.getWsrepRecoverNode(true)
+	if err != nil || best.URL != "db3:3306" || seqno != 11 {
+		t.Errorf("Expected forced recovery on db3:3306, got %v %d %v", best, seqno, err)
+	}
+	cluster.Servers[1].State = stateSlave
+	cluster.Servers[1].Conn = nil
+	if _, _, err := cluster.getWsrepRecoverNode(false); err != ErrWsrepNodeDown {
+		t.Errorf("Expected unreachable node error, got %v", err)
+	}
+}
+
+func TestWsrepRecoverNodeNoSeqno(t *testing.T) {
+	cluster := newWsrepTestCluster("10", "")
+	if _, _, err := cluster.getWsrepRecoverNode(false); err == nil {
+		t.Error("Expected error on a node without last committed seqno")
+	}
+	if best, _, err := cluster.getWsrepRecoverNode(true); err != nil || best.URL != "db1:3306" {
+		t.Errorf("Expected forced recovery on db1:3306, got %v %v", best, err)
+	}
+}
+
+func TestWsrepBootstrapNode(t *testing.T) {
+	cluster := newWsrepTestCluster("", "", "")
+	states := []WsrepGrastate{
+		{URL: "db1:3306", Seqno: 20},
+		{URL: "db2:3306", Seqno: 20, SafeToBootstrap: true},
+		{URL: "db3:3306", Seqno: 5},
+	}
+	server, gs, err := cluster.getWsrepBootstrapNode(states)
+	if err != nil || server.URL != "db2:3306" || !gs.SafeToBootstrap {
+		t.Fatalf("Expected db2:3306 safe to bootstrap, got %v %v %v", server, gs, err)
+	}
+	states[2].Error = "ssh"
+	if _, _, err := cluster.getWsrepBootstrapNode(states); err == nil {
+		t.Error("Expected error when a node position is unknown")
+	}
+}
+
+func TestStartWsrepJobActions(t *testing.T) {
+	cluster := newWsrepTestCluster("1")
+	cluster.Topology = config.TopoMultiMasterWsrep
+	if _, err := cluster.StartWsrepJob("recover"); err == nil {
+		t.Error("Expected unknown action to be refused")
+	}
+	cluster.wsrepJobs = []WsrepJob{{ID: "a", Action: WsrepActionRecoverSeqno, Status: JobStatusRunning}}
+	for _, action := range []string{WsrepActionRecoverSeqno, WsrepActionForcePrimary} {
+		if _, err := cluster.StartWsrepJob(action); err != ErrWsrepJobRunning {
+			t.Errorf("Expected running job error for %s, got %v", action, err)
+		}
+	}
+}
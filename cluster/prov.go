@@ -345,9 +345,6 @@ func (cluster *Cluster) UnprovisionDatabaseService(server *ServerMonitor) error
 	return nil
 }
 
-func (cluster *Cluster) RollingUpgrade() {
-}
-
 func (cluster *Cluster) StopDatabaseService(server *ServerMonitor) error {
 	cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModOrchestrator, config.LvlInfo, "Stopping database service %s", cluster.Name+"/svc/"+server.URL)
 	var err error
@@ -237,3 +237,41 @@ func (cluster *Cluster) OnPremiseStartDatabaseService(server *ServerMonitor) err
 
 	return nil
 }
+
+// OnPremiseUpgradeDatabaseService runs the upgrade script on the host of a stopped database
+func (cluster *Cluster) OnPremiseUpgradeDatabaseService(server *ServerMonitor, version string) error {
+	if cluster.Conf.UpgradeSSHScript == "" {
+		return errors.New("No upgrade-ssh-script")
+	}
+	if version != "" && !upgradeVersionRegexp.MatchString(version) {
+		return ErrUpgradeVersion
+	}
+	client, err := cluster.OnPremiseConnect(server)
+	if err != nil {
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModOrchestrator, config.LvlErr, "OnPremise upgrade database via ssh failed : %s", err)
+		return err
+	}
+	defer client.Close()
+
+	filerc, err := os.Open(cluster.Conf.UpgradeSSHScript)
+	if err != nil {
+		return fmt.Errorf("can't open upgrade script %s: %s", cluster.Conf.UpgradeSSHScript, err)
+	}
+	defer filerc.Close()
+	buf := new(bytes.Buffer)
+	buf.ReadFrom(filerc)
+
+	env := server.GetSshEnv() + "export REPLICATION_MANAGER_UPGRADE_VERSION=\"" + version + "\"\n"
+	r := io.MultiReader(strings.NewReader(env), buf)
+
+	var (
+		stdout bytes.Buffer
+		stderr bytes.Buffer
+	)
+	err = client.Shell().SetStdio(r, &stdout, &stderr).Start()
+	cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModOrchestrator, config.LvlInfo, "OnPremise upgrade script: %s ,out: %s ,err: %s", cluster.Conf.UpgradeSSHScript, stdout.String(), stderr.String())
+	if err != nil {
+		return fmt.Errorf("upgrade script failed: %s %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -159,6 +159,10 @@ type DatabaseProxy interface {
 	DelWaitStopCookie() error
 
 	RotateProxyPasswords(password string)
+
+	GetDesiredConfigState() (ProxyConfigState, error)
+	GetRuntimeConfigState() (ProxyConfigState, error)
+	ApplyDesiredConfigState(items []ProxyDriftItem) error
 }
 
 type Backend struct {
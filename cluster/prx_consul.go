@@ -10,17 +10,40 @@
 package cluster
 
 import (
+	"encoding/json"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/micro/go-micro/registry"
 	"github.com/signal18/replication-manager/config"
+	"github.com/signal18/replication-manager/router/consul"
 	"github.com/signal18/replication-manager/utils/misc"
 	"github.com/spf13/pflag"
 )
 
 type ConsulProxy struct {
 	Proxy
+	registered   map[string]string `json:"-"`
+	kvPublished  map[string]string `json:"-"`
+	kvIsWatching bool              `json:"-"`
+	kvWatchMutex sync.Mutex        `json:"-"`
+}
+
+type ConsulTopologyServer struct {
+	Id            string `json:"id"`
+	URL           string `json:"url"`
+	State         string `json:"state"`
+	IsMaintenance bool   `json:"isMaintenance"`
+	Delay         int64  `json:"delay"`
+}
+
+type ConsulTopology struct {
+	Cluster  string                 `json:"cluster"`
+	Topology string                 `json:"topology"`
+	Master   string                 `json:"master"`
+	Servers  []ConsulTopologyServer `json:"servers"`
 }
 
 func (proxy *ConsulProxy) AddFlags(flags *pflag.FlagSet, conf *config.Config) {
@@ -31,6 +54,10 @@ func (proxy *ConsulProxy) AddFlags(flags *pflag.FlagSet, conf *config.Config) {
 	flags.StringVar(&conf.RegistryConsulToken, "registry-consul-token", "", "Consul Token")
 	flags.StringVar(&conf.RegistryConsulHosts, "registry-servers", "127.0.0.1", "Comma-separated list of registry addresses")
 	flags.StringVar(&conf.RegistryConsulJanitorWeights, "registry-consul-weights", "100", "Weight of each proxysql host inside janitor proxy")
+	flags.IntVar(&conf.RegistryConsulCheckTTL, "registry-consul-check-ttl", 30, "TTL in seconds of the consul health check of each database service")
+	flags.BoolVar(&conf.RegistryConsulKV, "registry-consul-kv", false, "Publish master and topology to consul KV")
+	flags.StringVar(&conf.RegistryConsulKVPrefix, "registry-consul-kv-prefix", "replication-manager", "Consul KV prefix for master, topology and switchover keys")
+	flags.BoolVar(&conf.RegistryConsulKVSwitchover, "registry-consul-kv-switchover", false, "Watch consul KV <prefix>/<cluster>/switchover for operator requested switchover, value can be the prefered master host:port")
 }
 
 func NewConsulProxy(placement int, cluster *Cluster, proxyHost string) *ConsulProxy {
@@ -145,11 +172,219 @@ func (proxy *ConsulProxy) Init() {
 }
 
 func (proxy *ConsulProxy) Refresh() error {
+	cluster := proxy.ClusterGroup
+	if cluster.Conf.RegistryConsul == false || cluster.IsActive() == false {
+		return nil
+	}
+	c := proxy.getConsul()
+	var rerr error
+	for _, srv := range cluster.Servers {
+		if err := proxy.registerServer(c, srv); err != nil {
+			cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModProxy, config.LvlErr, "Consul could not register server %s: %s", srv.URL, err)
+			rerr = err
+		}
+	}
+	if cluster.Conf.RegistryConsulKV {
+		if err := proxy.publishKV(c); err != nil {
+			cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModProxy, config.LvlErr, "Consul could not publish topology to KV: %s", err)
+			rerr = err
+		}
+	}
+	if cluster.Conf.RegistryConsulKVSwitchover && proxy.setKVWatching(true) {
+		go proxy.watchSwitchover()
+	}
+	return rerr
+}
+
+func (proxy *ConsulProxy) getConsul() *consul.Consul {
+	cluster := proxy.ClusterGroup
+	return consul.NewConsul(cluster.Conf.RegistryConsulHosts, cluster.Conf.GetDecryptedPassword("registry-consul-token", cluster.Conf.RegistryConsulToken), proxy.User, proxy.Pass)
+}
+
+func (proxy *ConsulProxy) getKVKey(name string) string {
+	cluster := proxy.ClusterGroup
+	return strings.Trim(cluster.Conf.RegistryConsulKVPrefix, "/") + "/" + cluster.Name + "/" + name
+}
+
+// getServerHealth maps the monitor state of a server to a consul check status
+func (proxy *ConsulProxy) getServerHealth(srv *ServerMonitor) string {
+	if srv.IsMaintenance {
+		return consul.HealthWarning
+	}
+	switch srv.State {
+	case stateFailed, stateSuspect, stateErrorAuth, stateProv:
+		return consul.HealthCritical
+	case stateSlaveErr, stateSlaveLate, stateRelayErr, stateRelayLate, stateWsrepLate, stateWsrepDonor, stateUnconn:
+		return consul.HealthWarning
+	}
+	return consul.HealthPassing
+}
+
+func (proxy *ConsulProxy) getServerTags(srv *ServerMonitor) []string {
+	var tags []string
+	if srv.IsMaster() {
+		tags = append(tags, "master")
+	} else if srv.IsSlave {
+		tags = append(tags, "slave")
+	}
+	if srv.IsMaintenance {
+		tags = append(tags, "maintenance")
+	}
+	return tags
+}
+
+// registerServer registers the database service when its tags change and feeds its TTL check
+func (proxy *ConsulProxy) registerServer(c *consul.Consul, srv *ServerMonitor) error {
+	cluster := proxy.ClusterGroup
+	if proxy.registered == nil {
+		proxy.registered = make(map[string]string)
+	}
+	id := "db_" + cluster.Name + "_" + srv.Id
+	checkid := id + "_health"
+	tags := proxy.getServerTags(srv)
+	if proxy.registered[id] != strings.Join(tags, ",") {
+		port, _ := strconv.Atoi(srv.Port)
+		service := &consul.Service{
+			ID:      id,
+			Name:    "db_" + cluster.Name,
+			Tags:    tags,
+			Address: misc.Unbracket(srv.Host),
+			Port:    port,
+			Meta:    map[string]string{"cluster": cluster.Name, "url": srv.URL},
+			Check: &consul.Check{
+				CheckID: checkid,
+				Name:    "replication-manager state of " + srv.URL,
+				TTL:     strconv.Itoa(cluster.Conf.RegistryConsulCheckTTL) + "s",
+			},
+		}
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModProxy, config.LvlInfo, "Register consul service %s for server %s with tags %s", id, srv.URL, tags)
+		if err := c.RegisterService(service); err != nil {
+			return err
+		}
+		proxy.registered[id] = strings.Join(tags, ",")
+	}
+	if err := c.UpdateTTL(checkid, proxy.getServerHealth(srv), srv.State); err != nil {
+		// Agent may have been restarted and lost its services, register again on next refresh
+		delete(proxy.registered, id)
+		return err
+	}
+	return nil
+}
+
+// putKVIfChanged writes a key when its value changed, refresh and failover publish concurrently
+// and the published values are guarded by the watcher mutex
+func (proxy *ConsulProxy) putKVIfChanged(c *consul.Consul, name string, value string) error {
+	proxy.kvWatchMutex.Lock()
+	defer proxy.kvWatchMutex.Unlock()
+	if proxy.kvPublished == nil {
+		proxy.kvPublished = make(map[string]string)
+	}
+	if proxy.kvPublished[name] == value {
+		return nil
+	}
+	if err := c.PutKV(proxy.getKVKey(name), []byte(value)); err != nil {
+		return err
+	}
+	proxy.kvPublished[name] = value
 	return nil
 }
 
+// publishKV writes the current master and the topology under <prefix>/<cluster>/
+func (proxy *ConsulProxy) publishKV(c *consul.Consul) error {
+	cluster := proxy.ClusterGroup
+	topo := ConsulTopology{Cluster: cluster.Name, Topology: cluster.GetTopology(), Servers: []ConsulTopologyServer{}}
+	if master := cluster.GetMaster(); master != nil && !master.IsDown() {
+		topo.Master = master.URL
+	}
+	for _, srv := range cluster.Servers {
+		topo.Servers = append(topo.Servers, ConsulTopologyServer{
+			Id:            srv.Id,
+			URL:           srv.URL,
+			State:         srv.State,
+			IsMaintenance: srv.IsMaintenance,
+			Delay:         srv.GetReplicationDelay(),
+		})
+	}
+	if err := proxy.putKVIfChanged(c, "master", topo.Master); err != nil {
+		return err
+	}
+	data, err := json.Marshal(topo)
+	if err != nil {
+		return err
+	}
+	return proxy.putKVIfChanged(c, "topology", string(data))
+}
+
+// setKVWatching changes the watcher flag, it returns false when the flag already had the value
+func (proxy *ConsulProxy) setKVWatching(watching bool) bool {
+	proxy.kvWatchMutex.Lock()
+	defer proxy.kvWatchMutex.Unlock()
+	if proxy.kvIsWatching == watching {
+		return false
+	}
+	proxy.kvIsWatching = watching
+	return true
+}
+
+// watchSwitchover blocks on <prefix>/<cluster>/switchover and requests a switchover each time an
+// operator writes the key, the key is removed before the switchover to make the request one shot.
+// The switchover goes through the monitor loop like any other switchover request.
+func (proxy *ConsulProxy) watchSwitchover() {
+	cluster := proxy.ClusterGroup
+	defer proxy.setKVWatching(false)
+	key := proxy.getKVKey("switchover")
+	cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModProxy, config.LvlInfo, "Consul watching KV %s for switchover requests", key)
+	var index uint64
+	for cluster.Conf.RegistryConsul && cluster.Conf.RegistryConsulKVSwitchover && !cluster.exit {
+		c := proxy.getConsul()
+		pair, newindex, err := c.WatchKV(key, index, time.Minute)
+		if err != nil && err != consul.ErrKeyNotFound {
+			cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModProxy, config.LvlErr, "Consul could not watch KV %s: %s", key, err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+		if newindex < index {
+			// Consul index reset, restart the blocking query from scratch
+			newindex = 0
+		}
+		index = newindex
+		if pair == nil || !cluster.IsActive() {
+			continue
+		}
+		if err := c.DeleteKV(key); err != nil {
+			cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModProxy, config.LvlErr, "Consul could not delete switchover request %s: %s", key, err)
+			continue
+		}
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Consul KV receive switchover request")
+		if cluster.IsMasterFailed() {
+			cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlErr, "Master failed, cannot initiate switchover")
+			continue
+		}
+		savedPrefMaster := cluster.GetPreferedMasterList()
+		newPrefMaster := strings.TrimSpace(string(pair.Value))
+		if newPrefMaster != "" {
+			if cluster.IsInHostList(newPrefMaster) {
+				cluster.SetPrefMaster(newPrefMaster)
+			} else {
+				cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Prefered master: not found in database servers %s", newPrefMaster)
+			}
+		}
+		wg := new(sync.WaitGroup)
+		wg.Add(1)
+		go cluster.WaitSwitchover(wg)
+		cluster.SwitchOver()
+		wg.Wait()
+		cluster.SetPrefMaster(savedPrefMaster)
+	}
+}
+
 func (proxy *ConsulProxy) Failover() {
 	proxy.Init()
+	if cluster := proxy.ClusterGroup; cluster.Conf.RegistryConsul && cluster.Conf.RegistryConsulKV && cluster.IsActive() {
+		if err := proxy.publishKV(proxy.getConsul()); err != nil {
+			cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModProxy, config.LvlErr, "Consul could not publish new master to KV: %s", err)
+		}
+	}
 }
 
 func (proxy *ConsulProxy) BackendsStateChange() {
@@ -0,0 +1,51 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/signal18/replication-manager/router/consul"
+)
+
+func TestConsulPutKVConcurrent(t *testing.T) {
+	var puts int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&puts, 1)
+		w.Write([]byte("true"))
+	}))
+	defer ts.Close()
+	cluster := &Cluster{Name: "c1"}
+	cluster.Conf.RegistryConsulKVPrefix = "replication-manager"
+	proxy := &ConsulProxy{}
+	proxy.ClusterGroup = cluster
+	c := consul.NewConsul(ts.URL, "", "", "")
+
+	// refresh and failover publish the same keys at the same time
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := proxy.putKVIfChanged(c, "key"+strconv.Itoa(i%4), "db1:3306"); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if puts != 4 {
+		t.Errorf("Expected 4 writes of changed keys, got %d", puts)
+	}
+}
@@ -0,0 +1,236 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/signal18/replication-manager/config"
+	"github.com/signal18/replication-manager/utils/state"
+)
+
+var (
+	ErrProxyDriftNotSupported = errors.New("Drift detection not supported by proxy")
+	ErrProxyDriftFailover     = errors.New("Failover in progress, the desired state of the proxy is not applied")
+)
+
+const (
+	driftKindBackend = "backend"
+	driftKindUser    = "user"
+	driftKindRule    = "rule"
+)
+
+// ProxyConfigState is the backend set, users and query rules of a proxy, keyed by a
+// stable identifier. A nil map is not managed by replication-manager and is not compared.
+type ProxyConfigState struct {
+	Backends map[string]string `json:"backends"`
+	Users    map[string]string `json:"users"`
+	Rules    map[string]string `json:"rules"`
+}
+
+// ProxyDriftItem is a difference between the desired and the runtime state, Desired is
+// empty for an unexpected runtime entry and Runtime is empty for a missing entry
+type ProxyDriftItem struct {
+	Kind    string `json:"kind"`
+	Key     string `json:"key"`
+	Desired string `json:"desired"`
+	Runtime string `json:"runtime"`
+}
+
+// ProxyDrift is the result of the last drift check of a proxy
+type ProxyDrift struct {
+	Proxy      string           `json:"proxy"`
+	Type       string           `json:"type"`
+	Checked    int64            `json:"checked"`
+	Remediated int64            `json:"remediated"`
+	Error      string           `json:"error"`
+	Items      []ProxyDriftItem `json:"items"`
+	Desired    ProxyConfigState `json:"desired"`
+	Runtime    ProxyConfigState `json:"runtime"`
+}
+
+func diffProxyConfigMap(kind string, desired map[string]string, runtime map[string]string, extra bool) []ProxyDriftItem {
+	var items []ProxyDriftItem
+	if desired == nil {
+		return items
+	}
+	for k, v := range desired {
+		if r, ok := runtime[k]; !ok || r != v {
+			items = append(items, ProxyDriftItem{Kind: kind, Key: k, Desired: v, Runtime: r})
+		}
+	}
+	if extra {
+		for k, r := range runtime {
+			if _, ok := desired[k]; !ok {
+				items = append(items, ProxyDriftItem{Kind: kind, Key: k, Runtime: r})
+			}
+		}
+	}
+	return items
+}
+
+// diffProxyConfigState returns the sorted differences between desired and runtime states,
+// users and query rules created out of band are legitimate and are not reported
+func diffProxyConfigState(desired ProxyConfigState, runtime ProxyConfigState) []ProxyDriftItem {
+	items := diffProxyConfigMap(driftKindBackend, desired.Backends, runtime.Backends, true)
+	items = append(items, diffProxyConfigMap(driftKindUser, desired.Users, runtime.Users, false)...)
+	items = append(items, diffProxyConfigMap(driftKindRule, desired.Rules, runtime.Rules, false)...)
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Kind != items[j].Kind {
+			return items[i].Kind < items[j].Kind
+		}
+		return items[i].Key < items[j].Key
+	})
+	return items
+}
+
+func (item ProxyDriftItem) String() string {
+	switch {
+	case item.Runtime == "" && item.Desired != "":
+		return fmt.Sprintf("missing %s %s", item.Kind, item.Key)
+	case item.Desired == "" && item.Runtime != "":
+		return fmt.Sprintf("unexpected %s %s", item.Kind, item.Key)
+	}
+	return fmt.Sprintf("%s %s is %s expected %s", item.Kind, item.Key, item.Runtime, item.Desired)
+}
+
+// CheckProxyDrift compares the runtime state of a proxy with its desired state
+func (cluster *Cluster) CheckProxyDrift(pr DatabaseProxy) (ProxyDrift, error) {
+	drift := ProxyDrift{Proxy: pr.GetName(), Type: pr.GetType(), Checked: time.Now().Unix()}
+	desired, err := pr.GetDesiredConfigState()
+	if err != nil {
+		return drift, err
+	}
+	runtime, err := pr.GetRuntimeConfigState()
+	if err != nil {
+		return drift, err
+	}
+	drift.Desired = desired
+	drift.Runtime = runtime
+	drift.Items = diffProxyConfigState(desired, runtime)
+	return drift, nil
+}
+
+// CheckProxiesDrift runs the drift check on every proxy, raises a warning per drifting
+// proxy and re-applies the desired state when proxy-drift-remediate is set
+func (cluster *Cluster) CheckProxiesDrift() {
+	master := cluster.GetMaster()
+	if !cluster.Conf.PRXDriftCheck || master == nil {
+		return
+	}
+	cluster.proxyDriftMutex.Lock()
+	if cluster.inProxyDriftCheck {
+		cluster.proxyDriftMutex.Unlock()
+		return
+	}
+	cluster.inProxyDriftCheck = true
+	cluster.proxyDriftMutex.Unlock()
+	defer func() {
+		cluster.proxyDriftMutex.Lock()
+		cluster.inProxyDriftCheck = false
+		cluster.proxyDriftMutex.Unlock()
+	}()
+	for _, pr := range cluster.Proxies {
+		if pr == nil || pr.IsDown() {
+			continue
+		}
+		drift, err := cluster.CheckProxyDrift(pr)
+		if err == ErrProxyDriftNotSupported {
+			continue
+		}
+		if err != nil {
+			drift.Error = err.Error()
+			cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModProxy, config.LvlErr, "Could not check configuration drift of proxy %s: %s", pr.GetName(), err)
+		}
+		if len(drift.Items) > 0 {
+			var msgs []string
+			for _, item := range drift.Items {
+				msgs = append(msgs, item.String())
+			}
+			cluster.SetState("WARN0134", state.State{ErrType: "WARNING", ErrDesc: fmt.Sprintf(clusterError["WARN0134"], pr.GetName(), strings.Join(msgs, ", ")), ErrFrom: "PRX", ServerUrl: pr.GetName()})
+			if cluster.Conf.PRXDriftRemediate && !cluster.isProxyDriftRemediable(master) {
+				cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModProxy, config.LvlWarn, "Skip remediation of configuration drift of proxy %s: %s", pr.GetName(), ErrProxyDriftFailover)
+			} else if cluster.Conf.PRXDriftRemediate {
+				cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModProxy, config.LvlInfo, "Remediate configuration drift of proxy %s: %s", pr.GetName(), strings.Join(msgs, ", "))
+				err = pr.ApplyDesiredConfigState(drift.Items)
+				if err != nil {
+					drift.Error = err.Error()
+					cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModProxy, config.LvlErr, "Could not remediate configuration drift of proxy %s: %s", pr.GetName(), err)
+				} else {
+					drift.Remediated = time.Now().Unix()
+				}
+			}
+		}
+		cluster.setProxyDrift(pr, drift)
+	}
+}
+
+func (cluster *Cluster) setProxyDrift(pr DatabaseProxy, drift ProxyDrift) {
+	cluster.proxyDriftMutex.Lock()
+	defer cluster.proxyDriftMutex.Unlock()
+	if cluster.proxyDrifts == nil {
+		cluster.proxyDrifts = make(map[string]ProxyDrift)
+	}
+	cluster.proxyDrifts[pr.GetId()] = drift
+}
+
+// GetProxyDrift returns the result of the last drift check of a proxy
+func (cluster *Cluster) GetProxyDrift(pr DatabaseProxy) (ProxyDrift, bool) {
+	cluster.proxyDriftMutex.Lock()
+	defer cluster.proxyDriftMutex.Unlock()
+	drift, ok := cluster.proxyDrifts[pr.GetId()]
+	return drift, ok
+}
+
+// isProxyDriftRemediable tells if the desired state computed with the master is still valid, a
+// failover started or done since would point the proxies back to the old master
+func (cluster *Cluster) isProxyDriftRemediable(master *ServerMonitor) bool {
+	return !cluster.IsInFailover() && cluster.GetMaster() == master
+}
+
+// RemediateProxyDrift checks a proxy and re-applies its desired state
+func (cluster *Cluster) RemediateProxyDrift(pr DatabaseProxy) (ProxyDrift, error) {
+	master := cluster.GetMaster()
+	drift, err := cluster.CheckProxyDrift(pr)
+	if err != nil {
+		return drift, err
+	}
+	if len(drift.Items) > 0 {
+		if !cluster.isProxyDriftRemediable(master) {
+			drift.Error = ErrProxyDriftFailover.Error()
+			return drift, ErrProxyDriftFailover
+		}
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModProxy, config.LvlInfo, "Remediate configuration drift of proxy %s on request", pr.GetName())
+		if err = pr.ApplyDesiredConfigState(drift.Items); err != nil {
+			drift.Error = err.Error()
+			return drift, err
+		}
+		drift.Remediated = time.Now().Unix()
+	}
+	cluster.setProxyDrift(pr, drift)
+	return drift, nil
+}
+
+// GetDesiredConfigState is the default for proxies without drift detection
+func (proxy *Proxy) GetDesiredConfigState() (ProxyConfigState, error) {
+	return ProxyConfigState{}, ErrProxyDriftNotSupported
+}
+
+func (proxy *Proxy) GetRuntimeConfigState() (ProxyConfigState, error) {
+	return ProxyConfigState{}, ErrProxyDriftNotSupported
+}
+
+func (proxy *Proxy) ApplyDesiredConfigState(items []ProxyDriftItem) error {
+	return ErrProxyDriftNotSupported
+}
@@ -0,0 +1,98 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import (
+	"testing"
+
+	"github.com/signal18/replication-manager/router/proxysql"
+	"github.com/signal18/replication-manager/utils/state"
+)
+
+func TestDiffProxyConfigState(t *testing.T) {
+	desired := ProxyConfigState{
+		Backends: map[string]string{"10/db1:3306": "ONLINE", "20/db2:3306": "ONLINE"},
+		Users:    map[string]string{"app": "present"},
+		Rules:    map[string]string{"1": "apply=1"},
+	}
+	runtime := ProxyConfigState{
+		Backends: map[string]string{"10/db1:3306": "ONLINE", "10/db2:3306": "ONLINE", "20/db2:3306": "OFFLINE_SOFT"},
+		Users:    map[string]string{"admin": "present"},
+		Rules:    map[string]string{"1": "apply=0", "200": "apply=1"},
+	}
+	items := diffProxyConfigState(desired, runtime)
+	expected := []string{
+		"unexpected backend 10/db2:3306",
+		"backend 20/db2:3306 is OFFLINE_SOFT expected ONLINE",
+		"rule 1 is apply=0 expected apply=1",
+		"missing user app",
+	}
+	if len(items) != len(expected) {
+		t.Fatalf("Expected %d drift items, got %v", len(expected), items)
+	}
+	for i, item := range items {
+		if item.String() != expected[i] {
+			t.Errorf("Item %d is %q, expected %q", i, item.String(), expected[i])
+		}
+	}
+	if items := diffProxyConfigState(ProxyConfigState{}, runtime); len(items) != 0 {
+		t.Errorf("Unmanaged state should not drift, got %v", items)
+	}
+}
+
+func TestProxySQLDesiredRules(t *testing.T) {
+	cluster := &Cluster{}
+	cluster.Conf.ProxysqlOn = true
+	proxy := &ProxySQLProxy{}
+	proxy.ClusterGroup = cluster
+	desired, err := proxy.GetDesiredConfigState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(desired.Rules) != 0 || desired.Backends != nil || desired.Users != nil {
+		t.Fatalf("Expected no managed state, got %+v", desired)
+	}
+	var rule proxysql.QueryRule
+	rule.Id = 42
+	rule.Active = 1
+	rule.Apply = 1
+	rule.DestinationHostgroup.Int64 = 999
+	proxy.setDriftRules([]proxysql.QueryRule{rule})
+	desired, _ = proxy.GetDesiredConfigState()
+	if len(desired.Rules) != 1 || desired.Rules["42"] != proxysqlRuleSignature(rule) {
+		t.Errorf("Expected the pushed rule as desired state, got %v", desired.Rules)
+	}
+	if _, ok := proxy.getDriftRule(42); !ok {
+		t.Error("Expected rule 42 to be managed")
+	}
+	if _, ok := proxy.getDriftRule(200); ok {
+		t.Error("Rule 200 was not pushed by replication-manager")
+	}
+}
+
+func TestProxyDriftRemediable(t *testing.T) {
+	cluster := &Cluster{Name: "c1", StateMachine: new(state.StateMachine)}
+	cluster.StateMachine.Init()
+	master := &ServerMonitor{URL: "db1:3306", ClusterGroup: cluster}
+	cluster.master = master
+	if !cluster.isProxyDriftRemediable(master) {
+		t.Error("Expected remediation with an unchanged master")
+	}
+	cluster.StateMachine.SetFailoverState()
+	if cluster.isProxyDriftRemediable(master) {
+		t.Error("Expected no remediation during failover")
+	}
+	cluster.StateMachine.RemoveFailoverState()
+	// the desired state was computed before a failover to db2
+	cluster.master = &ServerMonitor{URL: "db2:3306", ClusterGroup: cluster}
+	if cluster.isProxyDriftRemediable(master) {
+		t.Error("Expected no remediation after a master change")
+	}
+}
@@ -535,3 +535,167 @@ func (proxy *HaproxyProxy) BackendsStateChange() {
 func (proxy *HaproxyProxy) CertificatesReload() error {
 	return nil
 }
+
+// SetDrain stops routing new connections to the old leader of a switchover while keeping
+// established sessions alive, drain is only available via the runtime API
+func (proxy *HaproxyProxy) SetDrain(server *ServerMonitor, drain bool) {
+	cluster := proxy.ClusterGroup
+	if !cluster.Conf.HaproxyOn || cluster.Conf.HaproxyMode != "runtimeapi" {
+		return
+	}
+	haRuntime := haproxy.Runtime{
+		Binary:   cluster.Conf.HaproxyBinaryPath,
+		SockFile: filepath.Join(proxy.Datadir+"/var", "/haproxy.stats.sock"),
+		Port:     proxy.Port,
+		Host:     proxy.Host,
+	}
+	if drain {
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModHAProxy, config.LvlInfo, "HAProxy %s set leader/%s state drain for server %s", proxy.Host+":"+proxy.Port, cluster.Conf.HaproxyAPIWriteBackend, server.URL)
+		res, err := haRuntime.SetDrain("leader", cluster.Conf.HaproxyAPIWriteBackend)
+		if err != nil {
+			cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModHAProxy, config.LvlErr, "HAProxy can not set drain %s backend %s : %s", server.URL, cluster.Conf.HaproxyAPIWriteBackend, err)
+		} else if cluster.Conf.HaproxyDebug {
+			cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModHAProxy, config.LvlInfo, "HAProxy set drain %s backend %s result: %s", server.URL, cluster.Conf.HaproxyAPIWriteBackend, res)
+		}
+		if !cluster.Configurator.HasProxyReadLeader() {
+			return
+		}
+		res, err = haRuntime.SetDrain(server.Id, cluster.Conf.HaproxyAPIReadBackend)
+		if err != nil {
+			cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModHAProxy, config.LvlErr, "HAProxy can not set drain %s backend %s : %s", server.URL, cluster.Conf.HaproxyAPIReadBackend, err)
+		} else if cluster.Conf.HaproxyDebug {
+			cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModHAProxy, config.LvlInfo, "HAProxy set drain %s backend %s result: %s", server.URL, cluster.Conf.HaproxyAPIReadBackend, res)
+		}
+		return
+	}
+	// The read backend is fixed by the next refresh once replication is valid again
+	cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModHAProxy, config.LvlInfo, "HAProxy %s set leader/%s state ready", proxy.Host+":"+proxy.Port, cluster.Conf.HaproxyAPIWriteBackend)
+	res, err := haRuntime.SetReady("leader", cluster.Conf.HaproxyAPIWriteBackend)
+	if err != nil {
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModHAProxy, config.LvlErr, "HAProxy can not set ready leader backend %s : %s", cluster.Conf.HaproxyAPIWriteBackend, err)
+	} else if cluster.Conf.HaproxyDebug {
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModHAProxy, config.LvlInfo, "HAProxy set ready leader backend %s result: %s", cluster.Conf.HaproxyAPIWriteBackend, res)
+	}
+}
+
+func haproxyBackendKey(backend string, host string, port string) string {
+	return backend + "/" + misc.Unbracket(host) + ":" + port
+}
+
+// haproxyReadStatus returns the read backend state refresh maintains for a server, empty
+// when the server is failed or standalone and the backend health check decides
+func (proxy *HaproxyProxy) haproxyReadStatus(s *ServerMonitor) string {
+	cluster := proxy.ClusterGroup
+	if s.IsMaintenance {
+		return "MAINT"
+	}
+	switch {
+	case s.IsLeader():
+		if cluster.Configurator.HasProxyReadLeader() {
+			return "UP"
+		}
+		return "DRAIN"
+	case s.IsIgnored():
+		return "DRAIN"
+	case s.State == stateSlave || s.State == stateRelay || s.State == stateWsrep:
+		return "UP"
+	case s.State == stateSlaveErr || s.State == stateRelayErr || s.State == stateSlaveLate || s.State == stateRelayLate || s.State == stateWsrepLate || s.State == stateWsrepDonor:
+		return "DRAIN"
+	}
+	return ""
+}
+
+// GetDesiredConfigState returns the leader expected in the write backend and the state
+// of each server in the read backend, it only applies to the runtime API mode
+func (proxy *HaproxyProxy) GetDesiredConfigState() (ProxyConfigState, error) {
+	cluster := proxy.ClusterGroup
+	desired := ProxyConfigState{Backends: make(map[string]string)}
+	if !cluster.Conf.HaproxyOn || cluster.Conf.HaproxyMode != "runtimeapi" {
+		return desired, ErrProxyDriftNotSupported
+	}
+	for _, s := range cluster.Servers {
+		if s.IsLeader() {
+			status := "UP"
+			if s.IsMaintenance {
+				status = "MAINT"
+			}
+			desired.Backends[haproxyBackendKey(cluster.Conf.HaproxyAPIWriteBackend, s.Host, s.Port)] = status
+		}
+		if status := proxy.haproxyReadStatus(s); status != "" {
+			desired.Backends[haproxyBackendKey(cluster.Conf.HaproxyAPIReadBackend, s.Host, s.Port)] = status
+		}
+	}
+	return desired, nil
+}
+
+// GetRuntimeConfigState returns the backends state collected by the last refresh
+func (proxy *HaproxyProxy) GetRuntimeConfigState() (ProxyConfigState, error) {
+	cluster := proxy.ClusterGroup
+	runtime := ProxyConfigState{Backends: make(map[string]string)}
+	normalize := func(status string) string {
+		status = strings.ToUpper(strings.Fields(status + " ")[0])
+		if status == "NO" {
+			// "no check" backends are routed as UP
+			return "UP"
+		}
+		return status
+	}
+	for _, b := range proxy.BackendsWrite {
+		runtime.Backends[haproxyBackendKey(cluster.Conf.HaproxyAPIWriteBackend, b.Host, b.Port)] = normalize(b.PrxStatus)
+	}
+	for _, b := range proxy.BackendsRead {
+		if s := cluster.GetServerFromURL(b.Host + ":" + b.Port); s != nil && proxy.haproxyReadStatus(s) == "" {
+			continue
+		}
+		runtime.Backends[haproxyBackendKey(cluster.Conf.HaproxyAPIReadBackend, b.Host, b.Port)] = normalize(b.PrxStatus)
+	}
+	return runtime, nil
+}
+
+// ApplyDesiredConfigState points the leader to the master and sets read servers state
+// via the runtime API
+func (proxy *HaproxyProxy) ApplyDesiredConfigState(items []ProxyDriftItem) error {
+	cluster := proxy.ClusterGroup
+	haRuntime := haproxy.Runtime{
+		Binary:   cluster.Conf.HaproxyBinaryPath,
+		SockFile: filepath.Join(proxy.Datadir+"/var", "/haproxy.stats.sock"),
+		Port:     proxy.Port,
+		Host:     proxy.Host,
+	}
+	master := cluster.GetMaster()
+	for _, item := range items {
+		backend, hostport, _ := strings.Cut(item.Key, "/")
+		var err error
+		if backend == cluster.Conf.HaproxyAPIWriteBackend {
+			switch {
+			case item.Desired == "MAINT":
+				_, err = haRuntime.SetMaintenance("leader", cluster.Conf.HaproxyAPIWriteBackend)
+			case master != nil:
+				// a missing leader and an unexpected server both repoint the leader to the master
+				if _, err = haRuntime.SetMaster(master.Host, master.Port); err == nil {
+					_, err = haRuntime.SetReady("leader", cluster.Conf.HaproxyAPIWriteBackend)
+				}
+			case item.Desired == "":
+				// no master to route writes to
+				_, err = haRuntime.SetMaintenance("leader", cluster.Conf.HaproxyAPIWriteBackend)
+			}
+		} else {
+			srv := cluster.GetServerFromURL(hostport)
+			if srv == nil {
+				continue
+			}
+			switch item.Desired {
+			case "UP":
+				_, err = haRuntime.SetReady(srv.Id, cluster.Conf.HaproxyAPIReadBackend)
+			case "DRAIN":
+				_, err = haRuntime.SetDrain(srv.Id, cluster.Conf.HaproxyAPIReadBackend)
+			case "MAINT":
+				_, err = haRuntime.SetMaintenance(srv.Id, cluster.Conf.HaproxyAPIReadBackend)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%s %s: %s", item.Kind, item.Key, err)
+		}
+	}
+	return nil
+}
@@ -13,6 +13,7 @@ package cluster
 import (
 	"fmt"
 	"strconv"
+	"sync"
 
 	"github.com/signal18/replication-manager/config"
 	"github.com/signal18/replication-manager/router/maxscale"
@@ -22,6 +23,8 @@ import (
 
 type MaxscaleProxy struct {
 	Proxy
+	bootstrapped   bool       `json:"-"`
+	bootstrapMutex sync.Mutex `json:"-"`
 }
 
 func (cluster *Cluster) refreshMaxscale(proxy *MaxscaleProxy) error {
@@ -56,10 +59,14 @@ func (proxy *MaxscaleProxy) AddFlags(flags *pflag.FlagSet, conf *config.Config)
 	flags.BoolVar(&conf.MxsBinlogOn, "maxscale-binlog", false, "Maxscale binlog server topolgy")
 	flags.MarkDeprecated("maxscale-monitor", "Deprecate disable maxscale monitoring for 2 nodes cluster")
 	flags.BoolVar(&conf.MxsDisableMonitor, "maxscale-disable-monitor", false, "Disable maxscale monitoring and fully drive server state")
-	flags.StringVar(&conf.MxsGetInfoMethod, "maxscale-get-info-method", "maxadmin", "How to get infos from Maxscale maxinfo|maxadmin")
+	flags.StringVar(&conf.MxsGetInfoMethod, "maxscale-get-info-method", "maxadmin", "How to get infos from Maxscale maxinfo|maxadmin|restapi")
 	flags.StringVar(&conf.MxsHost, "maxscale-servers", "", "MaxScale hosts ")
 	flags.StringVar(&conf.MxsJanitorWeights, "maxscale-janitor-weights", "100", "Weight of each MariaDB maxscale inside janitor proxy")
 	flags.StringVar(&conf.MxsPort, "maxscale-port", "6603", "MaxScale admin port")
+	flags.StringVar(&conf.MxsRestPort, "maxscale-rest-port", "8989", "MaxScale REST API port used with maxscale-get-info-method restapi")
+	flags.BoolVar(&conf.MxsRestHttps, "maxscale-rest-https", false, "MaxScale REST API is served over https")
+	flags.BoolVar(&conf.MxsRestHttpsInsecure, "maxscale-rest-https-insecure", false, "Skip MaxScale REST API certificate verification")
+	flags.BoolVar(&conf.MxsBootstrap, "maxscale-bootstrap", false, "Create MaxScale servers, services and listeners from the cluster topology and stop MaxScale monitors, requires restapi")
 	flags.StringVar(&conf.MxsUser, "maxscale-user", "admin", "MaxScale admin user")
 	flags.StringVar(&conf.MxsPass, "maxscale-pass", "mariadb", "MaxScale admin password")
 	flags.IntVar(&conf.MxsWritePort, "maxscale-write-port", 3306, "MaxScale read-write port to leader")
@@ -79,6 +86,9 @@ func (proxy *MaxscaleProxy) Refresh() error {
 	if cluster.Conf.MxsOn == false {
 		return nil
 	}
+	if cluster.Conf.MxsGetInfoMethod == "restapi" {
+		return proxy.refreshRestAPI()
+	}
 	var m maxscale.MaxScale
 	if proxy.Tunnel {
 		m = maxscale.MaxScale{Host: "localhost", Port: strconv.Itoa(proxy.TunnelPort), User: proxy.User, Pass: proxy.Pass}
@@ -151,6 +161,10 @@ func (proxy *MaxscaleProxy) Init() {
 	if cluster.Conf.MxsOn == false {
 		return
 	}
+	if cluster.Conf.MxsGetInfoMethod == "restapi" {
+		proxy.initRestAPI()
+		return
+	}
 
 	var m maxscale.MaxScale
 	if proxy.Tunnel {
@@ -259,6 +273,19 @@ func (proxy *MaxscaleProxy) BackendsStateChange() {
 
 func (pr *MaxscaleProxy) SetMaintenance(server *ServerMonitor) {
 	cluster := pr.ClusterGroup
+	if cluster.Conf.MxsOn && cluster.Conf.MxsGetInfoMethod == "restapi" {
+		m := pr.getRestAPI()
+		var err error
+		if server.IsMaintenance {
+			err = m.SetServer(server.MxsServerName, maxscale.ServerStateMaintenance)
+		} else {
+			err = m.ClearServer(server.MxsServerName, maxscale.ServerStateMaintenance)
+		}
+		if err != nil {
+			cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModMaxscale, config.LvlErr, "Could not set server %s in maintenance: %s", server.URL, err)
+		}
+		return
+	}
 	if cluster.GetMaster() != nil {
 		return
 	}
@@ -290,3 +317,144 @@ func (prx *MaxscaleProxy) Failover() {
 func (proxy *MaxscaleProxy) CertificatesReload() error {
 	return nil
 }
+
+func (proxy *MaxscaleProxy) getRestAPI() *maxscale.RestAPI {
+	cluster := proxy.ClusterGroup
+	if proxy.Tunnel {
+		return maxscale.NewRestAPI("localhost", strconv.Itoa(proxy.TunnelPort), proxy.User, proxy.Pass, cluster.Conf.MxsRestHttps, cluster.Conf.MxsRestHttpsInsecure)
+	}
+	return maxscale.NewRestAPI(proxy.Host, cluster.Conf.MxsRestPort, proxy.User, proxy.Pass, cluster.Conf.MxsRestHttps, cluster.Conf.MxsRestHttpsInsecure)
+}
+
+// refreshRestAPI fetches servers state and connections via the REST API
+func (proxy *MaxscaleProxy) refreshRestAPI() error {
+	cluster := proxy.ClusterGroup
+	m := proxy.getRestAPI()
+	servers, err := m.ListServers()
+	if err != nil {
+		cluster.SetState("ERR00018", state.State{ErrType: "ERROR", ErrDesc: fmt.Sprintf(clusterError["ERR00018"], err), ErrFrom: "CONF"})
+		cluster.StateMachine.CopyOldStateFromUnknowServer(proxy.Name)
+		return err
+	}
+	proxy.BackendsWrite = nil
+	for _, server := range cluster.Servers {
+		var bke = Backend{
+			Host:    server.Host,
+			Port:    server.Port,
+			Status:  server.State,
+			PrxName: server.URL,
+		}
+		if mxs, ok := m.FindServer(servers, server.Host, server.Port, cluster.Conf.MxsServerMatchPort); ok {
+			bke.PrxName = mxs.Id
+			bke.PrxStatus = mxs.Attributes.State
+			bke.PrxConnections = strconv.Itoa(mxs.Attributes.Statistics.Connections)
+		} else {
+			bke.PrxName = ""
+			bke.PrxStatus = ""
+		}
+		server.MxsServerStatus = bke.PrxStatus
+		server.MxsServerName = bke.PrxName
+		proxy.BackendsWrite = append(proxy.BackendsWrite, bke)
+	}
+	return nil
+}
+
+// getBootstrapServers returns the topology to declare in MaxScale, servers already known
+// by MaxScale keep their name, the others are named after the server id unless known is set
+func (proxy *MaxscaleProxy) getBootstrapServers(known bool) []maxscale.BootstrapServer {
+	cluster := proxy.ClusterGroup
+	master := cluster.GetMaster()
+	var servers []maxscale.BootstrapServer
+	for _, s := range cluster.Servers {
+		port, _ := strconv.Atoi(s.Port)
+		name := s.MxsServerName
+		if name == "" {
+			if known {
+				continue
+			}
+			name = s.Id
+		}
+		servers = append(servers, maxscale.BootstrapServer{
+			Name:     name,
+			Address:  s.Host,
+			Port:     port,
+			IsMaster: s == master,
+			IsSlave:  s != master && s.State == stateSlave,
+			IsMaint:  s.IsMaintenance,
+		})
+	}
+	return servers
+}
+
+func (proxy *MaxscaleProxy) getBootstrapServices() []maxscale.BootstrapService {
+	cluster := proxy.ClusterGroup
+	credentials := func(params map[string]interface{}) map[string]interface{} {
+		params["user"] = cluster.GetDbUser()
+		params["password"] = cluster.GetDbPass()
+		return params
+	}
+	return []maxscale.BootstrapService{
+		{Name: "Write-Service", Router: "readconnroute", Parameters: credentials(map[string]interface{}{"router_options": "master"}), Port: cluster.Conf.MxsWritePort},
+		{Name: "Read-Service", Router: "readconnroute", Parameters: credentials(map[string]interface{}{"router_options": "slave"}), Port: cluster.Conf.MxsReadPort},
+		{Name: "Splitter-Service", Router: "readwritesplit", Parameters: credentials(map[string]interface{}{}), Port: cluster.Conf.MxsReadWritePort},
+	}
+}
+
+// setBootstrapped marks the bootstrap done, it returns false when it was already done
+func (proxy *MaxscaleProxy) setBootstrapped() bool {
+	proxy.bootstrapMutex.Lock()
+	defer proxy.bootstrapMutex.Unlock()
+	if proxy.bootstrapped {
+		return false
+	}
+	proxy.bootstrapped = true
+	return true
+}
+
+// initRestAPI stops MaxScale monitoring and sets servers state from the topology, with
+// maxscale-bootstrap servers, services and listeners are created once on the first init
+func (proxy *MaxscaleProxy) initRestAPI() {
+	cluster := proxy.ClusterGroup
+	if cluster.GetMaster() == nil {
+		return
+	}
+	m := proxy.getRestAPI()
+	if cluster.Conf.MxsBootstrap && proxy.setBootstrapped() {
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModMaxscale, config.LvlInfo, "Bootstrap MaxScale %s from cluster topology", proxy.Name)
+		err := m.Bootstrap(proxy.getBootstrapServers(false), proxy.getBootstrapServices())
+		if err != nil {
+			cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModMaxscale, config.LvlErr, "MaxScale bootstrap failed: %s", err)
+			proxy.bootstrapMutex.Lock()
+			proxy.bootstrapped = false
+			proxy.bootstrapMutex.Unlock()
+			return
+		}
+		proxy.refreshRestAPI()
+		return
+	}
+	if cluster.GetMaster().MxsServerName == "" {
+		return
+	}
+	monitor, err := m.GetRunningMonitor()
+	if err != nil {
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModMaxscale, config.LvlErr, "MaxScale client could not list monitors %s", err)
+	}
+	if monitor != "" && cluster.Conf.MxsDisableMonitor {
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModMaxscale, config.LvlInfo, "Maxscale stop monitor: %s", monitor)
+		err = m.StopMonitor(monitor)
+		if err != nil {
+			cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModMaxscale, config.LvlErr, "MaxScale client could not stop monitor:%s", err)
+		}
+	} else if monitor == "" && !cluster.Conf.MxsDisableMonitor {
+		cluster.SetState("ERR00017", state.State{ErrType: "ERROR", ErrDesc: clusterError["ERR00017"], ErrFrom: "TOPO", ServerUrl: proxy.Name})
+	}
+	if cluster.Conf.MxsBinlogOn {
+		return
+	}
+	for _, s := range proxy.getBootstrapServers(true) {
+		err = m.SyncServerState(s)
+		if err != nil {
+			cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModMaxscale, config.LvlErr, "MaxScale client could not send command:%s", err)
+		}
+	}
+}
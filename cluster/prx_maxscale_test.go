@@ -0,0 +1,39 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package cluster
+
+import "testing"
+
+func TestMaxscaleBootstrapServers(t *testing.T) {
+	master := &ServerMonitor{Id: "db1", Host: "10.0.0.1", Port: "3306", MxsServerName: "server1"}
+	slave := &ServerMonitor{Id: "db2", Host: "10.0.0.2", Port: "3306", State: stateSlave}
+	cluster := &Cluster{Servers: serverList{master, slave}, master: master}
+	proxy := &MaxscaleProxy{}
+	proxy.ClusterGroup = cluster
+
+	all := proxy.getBootstrapServers(false)
+	if len(all) != 2 || all[0].Name != "server1" || !all[0].IsMaster || all[1].Name != "db2" || !all[1].IsSlave {
+		t.Fatalf("Unexpected bootstrap servers %+v", all)
+	}
+	known := proxy.getBootstrapServers(true)
+	if len(known) != 1 || known[0].Name != "server1" {
+		t.Errorf("Expected only the server known by MaxScale, got %+v", known)
+	}
+}
+
+func TestMaxscaleBootstrapOnce(t *testing.T) {
+	proxy := &MaxscaleProxy{}
+	if !proxy.setBootstrapped() {
+		t.Fatal("First bootstrap should run")
+	}
+	if proxy.setBootstrapped() {
+		t.Error("Bootstrap should not run again")
+	}
+}
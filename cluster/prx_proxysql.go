@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/signal18/replication-manager/config"
 	"github.com/signal18/replication-manager/router/proxysql"
@@ -16,6 +17,9 @@ import (
 
 type ProxySQLProxy struct {
 	Proxy
+	// query rules pushed by replication-manager, the only rules checked for drift
+	driftRules      map[uint32]proxysql.QueryRule
+	driftRulesMutex sync.Mutex
 }
 
 func NewProxySQLProxy(placement int, cluster *Cluster, proxyHost string) *ProxySQLProxy {
@@ -128,9 +132,32 @@ func (proxy *ProxySQLProxy) AddQueryRulesProxysql(rules []proxysql.QueryRule) er
 	}
 	defer psql.Connection.Close()
 	err = psql.AddQueryRules(rules)
+	if err == nil {
+		proxy.setDriftRules(rules)
+	}
 	return err
 }
 
+// setDriftRules records rules pushed by replication-manager as desired state, rules
+// added by operators are left to them
+func (proxy *ProxySQLProxy) setDriftRules(rules []proxysql.QueryRule) {
+	proxy.driftRulesMutex.Lock()
+	defer proxy.driftRulesMutex.Unlock()
+	if proxy.driftRules == nil {
+		proxy.driftRules = make(map[uint32]proxysql.QueryRule)
+	}
+	for _, r := range rules {
+		proxy.driftRules[r.Id] = r
+	}
+}
+
+func (proxy *ProxySQLProxy) getDriftRule(id uint32) (proxysql.QueryRule, bool) {
+	proxy.driftRulesMutex.Lock()
+	defer proxy.driftRulesMutex.Unlock()
+	r, ok := proxy.driftRules[id]
+	return r, ok
+}
+
 func (proxy *ProxySQLProxy) Init() {
 	cluster := proxy.ClusterGroup
 	if !cluster.Conf.ProxysqlBootstrap || !cluster.Conf.ProxysqlOn {
@@ -603,6 +630,39 @@ func (proxy *ProxySQLProxy) SetMaintenance(s *ServerMonitor) {
 	}
 }
 
+// SetDrain puts the server in OFFLINE_SOFT in all hostgroups so that ProxySQL stops
+// routing new transactions to it while letting the running ones complete
+func (proxy *ProxySQLProxy) SetDrain(s *ServerMonitor, drain bool) {
+	cluster := proxy.ClusterGroup
+	if !cluster.Conf.ProxysqlOn {
+		return
+	}
+	psql, err := proxy.Connect()
+	if err != nil {
+		cluster.SetState("ERR00051", state.State{ErrType: "ERROR", ErrDesc: fmt.Sprintf(clusterError["ERR00051"], err), ErrFrom: "MON"})
+		return
+	}
+	defer psql.Connection.Close()
+
+	if drain {
+		err = psql.SetOfflineSoft(misc.Unbracket(s.Host), s.Port)
+		if err != nil {
+			cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModProxySQL, config.LvlErr, "ProxySQL could not drain %s:%s as offline_soft (%s)", s.Host, s.Port, err)
+		} else {
+			cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModProxySQL, config.LvlInfo, "ProxySQL %s drain server %s as offline_soft", proxy.Host+":"+proxy.Port, s.URL)
+		}
+	} else if !s.IsMaintenance {
+		err = psql.SetOnlineSoft(misc.Unbracket(s.Host), s.Port)
+		if err != nil {
+			cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModProxySQL, config.LvlErr, "ProxySQL could not set %s:%s as online after drain (%s)", s.Host, s.Port, err)
+		}
+	}
+	err = psql.LoadServersToRuntime()
+	if err != nil {
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModProxySQL, config.LvlErr, "ProxySQL could not load servers to runtime (%s)", err)
+	}
+}
+
 func (proxy *ProxySQLProxy) RotateMonitoringPasswords(password string) {
 	cluster := proxy.ClusterGroup
 	psql, err := proxy.Connect()
@@ -683,3 +743,202 @@ func (proxy *ProxySQLProxy) Shutdown() {
 		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModProxySQL, config.LvlErr, "ProxySQL could not shutdown (%s)", err)
 	}
 }
+
+func proxysqlBackendKey(hostgroup string, host string, port string) string {
+	return hostgroup + "/" + misc.Unbracket(host) + ":" + port
+}
+
+func proxysqlRuleSignature(r proxysql.QueryRule) string {
+	return fmt.Sprintf("active=%d user=%s schema=%s digest=%s match_digest=%s match_pattern=%s destination=%d mirror=%d multiplex=%d apply=%d",
+		r.Active, r.UserName.String, r.SchemaName.String, r.Digest.String, r.Match_Digest.String, r.Match_Pattern.String, r.DestinationHostgroup.Int64, r.MirrorHostgroup.Int64, r.Multiplex.Int64, r.Apply)
+}
+
+// isDriftManaged returns true for servers that have a definite place in the hostgroups,
+// failed or standalone servers are handled by refresh and are not compared
+func (proxy *ProxySQLProxy) isDriftManaged(s *ServerMonitor) bool {
+	return s.IsLeader() || (s.State == stateSlave && !s.IsIgnored())
+}
+
+// getDriftUsers returns the master users with a password copied by proxysql-copy-grants
+func (proxy *ProxySQLProxy) getDriftUsers() map[string]string {
+	cluster := proxy.ClusterGroup
+	users := make(map[string]string)
+	master := cluster.GetMaster()
+	if master == nil {
+		return users
+	}
+	for _, u := range master.Users.ToNewMap() {
+		if u.Password == "" || u.Password == "invalid" {
+			continue
+		}
+		if u.User == cluster.GetDbUser() && cluster.Conf.MonitorWriteHeartbeatCredential != "" {
+			continue
+		}
+		users[u.User] = u.Password
+	}
+	return users
+}
+
+// GetDesiredConfigState returns hostgroups membership expected from the topology when
+// proxysql-bootstrap is set, the copied users and the query rules pushed by replication-manager
+func (proxy *ProxySQLProxy) GetDesiredConfigState() (ProxyConfigState, error) {
+	cluster := proxy.ClusterGroup
+	var desired ProxyConfigState
+	if !cluster.Conf.ProxysqlOn {
+		return desired, ErrProxyDriftNotSupported
+	}
+	writer := strconv.Itoa(proxy.WriterHostgroup)
+	reader := strconv.Itoa(proxy.ReaderHostgroup)
+	if cluster.Conf.ProxysqlBootstrap {
+		desired.Backends = make(map[string]string)
+		for _, s := range cluster.Servers {
+			if !proxy.isDriftManaged(s) {
+				continue
+			}
+			status := "ONLINE"
+			if s.IsMaintenance {
+				status = "OFFLINE_SOFT"
+			}
+			if s.IsLeader() {
+				desired.Backends[proxysqlBackendKey(writer, s.Host, s.Port)] = "ONLINE"
+				if cluster.Configurator.HasProxyReadLeader() {
+					desired.Backends[proxysqlBackendKey(reader, s.Host, s.Port)] = status
+				}
+			} else {
+				desired.Backends[proxysqlBackendKey(reader, s.Host, s.Port)] = status
+			}
+		}
+	}
+	if cluster.Conf.ProxysqlCopyGrants {
+		desired.Users = make(map[string]string)
+		for u := range proxy.getDriftUsers() {
+			desired.Users[u] = "present"
+		}
+	}
+	desired.Rules = make(map[string]string)
+	proxy.driftRulesMutex.Lock()
+	for _, r := range proxy.driftRules {
+		desired.Rules[strconv.FormatUint(uint64(r.Id), 10)] = proxysqlRuleSignature(r)
+	}
+	proxy.driftRulesMutex.Unlock()
+	return desired, nil
+}
+
+// GetRuntimeConfigState reads runtime_mysql_servers of the cluster hostgroups, runtime
+// users and rules
+func (proxy *ProxySQLProxy) GetRuntimeConfigState() (ProxyConfigState, error) {
+	cluster := proxy.ClusterGroup
+	runtime := ProxyConfigState{
+		Backends: make(map[string]string),
+		Users:    make(map[string]string),
+		Rules:    make(map[string]string),
+	}
+	psql, err := proxy.Connect()
+	if err != nil {
+		return runtime, err
+	}
+	defer psql.Connection.Close()
+	servers, err := psql.GetServersRuntime()
+	if err != nil {
+		return runtime, err
+	}
+	writer := strconv.Itoa(proxy.WriterHostgroup)
+	reader := strconv.Itoa(proxy.ReaderHostgroup)
+	for _, b := range servers {
+		if b.Hostgroup != writer && b.Hostgroup != reader {
+			continue
+		}
+		if s := cluster.GetServerFromURL(b.Host + ":" + b.Port); s != nil && !proxy.isDriftManaged(s) {
+			continue
+		}
+		status := b.Status
+		if status == "SHUNNED" {
+			// shunning is driven by ProxySQL monitor not by configuration
+			status = "ONLINE"
+		}
+		runtime.Backends[proxysqlBackendKey(b.Hostgroup, b.Host, b.Port)] = status
+	}
+	users, err := psql.GetUsersRuntime()
+	if err != nil {
+		return runtime, err
+	}
+	for _, u := range users {
+		runtime.Users[u] = "present"
+	}
+	rules, err := psql.GetQueryRulesRuntime()
+	if err != nil {
+		return runtime, err
+	}
+	for _, r := range rules {
+		runtime.Rules[strconv.FormatUint(uint64(r.Id), 10)] = proxysqlRuleSignature(r)
+	}
+	return runtime, nil
+}
+
+// ApplyDesiredConfigState fixes hostgroups membership, adds missing users and rewrites
+// the drifting query rules pushed by replication-manager one by one
+func (proxy *ProxySQLProxy) ApplyDesiredConfigState(items []ProxyDriftItem) error {
+	cluster := proxy.ClusterGroup
+	psql, err := proxy.Connect()
+	if err != nil {
+		return err
+	}
+	defer psql.Connection.Close()
+	writer := strconv.Itoa(proxy.WriterHostgroup)
+	var changedServers, changedUsers, changedRules bool
+	users := proxy.getDriftUsers()
+	for _, item := range items {
+		switch item.Kind {
+		case driftKindBackend:
+			hg, hostport, _ := strings.Cut(item.Key, "/")
+			idx := strings.LastIndex(hostport, ":")
+			host, port := hostport[:idx], hostport[idx+1:]
+			switch {
+			case item.Desired == "" && hg == writer:
+				err = psql.DropWriter(host, port)
+			case item.Desired == "":
+				err = psql.DropReader(host, port)
+			case item.Runtime == "" && hg == writer:
+				err = psql.AddServerAsWriter(host, port, proxy.UseSSL())
+			case item.Runtime == "":
+				err = psql.AddServerAsReader(host, port, "1", strconv.Itoa(cluster.Conf.PRXServersBackendMaxReplicationLag), strconv.Itoa(cluster.Conf.PRXServersBackendMaxConnections), strconv.Itoa(misc.Bool2Int(cluster.Conf.PRXServersBackendCompression)), proxy.UseSSL())
+			case item.Desired == "OFFLINE_SOFT":
+				err = psql.SetOfflineSoft(host, port)
+			default:
+				err = psql.SetOnlineSoft(host, port)
+			}
+			changedServers = true
+		case driftKindUser:
+			if password, ok := users[item.Key]; ok {
+				err = psql.AddUser(item.Key, password)
+				changedUsers = true
+			}
+		case driftKindRule:
+			id, _ := strconv.ParseUint(item.Key, 10, 32)
+			if rule, ok := proxy.getDriftRule(uint32(id)); ok {
+				if err = psql.DeleteQueryRule(rule.Id); err == nil {
+					err = psql.AddQueryRules([]proxysql.QueryRule{rule})
+				}
+				changedRules = true
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%s %s: %s", item.Kind, item.Key, err)
+		}
+	}
+	if changedServers {
+		if err = psql.LoadServersToRuntime(); err != nil {
+			return err
+		}
+		if cluster.Conf.ProxysqlSaveToDisk {
+			psql.SaveServersToDisk()
+		}
+	}
+	if changedUsers {
+		psql.SaveMySQLUsersToDisk()
+	}
+	if changedRules && cluster.Conf.ProxysqlSaveToDisk {
+		psql.SaveQueryRulesToDisk()
+	}
+	return nil
+}
@@ -123,10 +123,19 @@ type ServerMonitor struct {
 	IsSlave                     bool                       `json:"isSlave"`
 	IsGroupReplicationSlave     bool                       `json:"isGroupReplicationSlave"`
 	IsGroupReplicationMaster    bool                       `json:"isGroupReplicationMaster"`
+	GroupReplicationMembers     []GroupReplicationMember   `json:"groupReplicationMembers"`
+	GroupReplicationMemberState string                     `json:"groupReplicationMemberState"`
+	GroupReplicationRejoinTime  time.Time                  `json:"-"`
 	IsVirtualMaster             bool                       `json:"isVirtualMaster"`
 	IsMaintenance               bool                       `json:"isMaintenance"`
 	IsCompute                   bool                       `json:"isCompute"` //Used to idenfied spider compute nide
 	IsDelayed                   bool                       `json:"isDelayed"`
+	IsDelayedPaused             bool                       `json:"isDelayedPaused"`
+	DelayedAppliedTime          time.Time                  `json:"-"`
+	WsrepFlowControl            int                        `json:"wsrepFlowControl"`
+	WsrepFlowControlPausedNs    int64                      `json:"-"`
+	WsrepFlowControlCheck       time.Time                  `json:"-"`
+	Site                        string                     `json:"site"`
 	IsFull                      bool                       `json:"isFull"`
 	IsConfigGen                 bool                       `json:"isConfigGen"`
 	Ignored                     bool                       `json:"ignored"`
@@ -336,6 +345,8 @@ func (cluster *Cluster) newServerMonitor(url string, user string, pass string, c
 	server.IsRelay = false
 	server.IsMaxscale = true
 	server.IsDelayed = server.IsInDelayedHost()
+	server.IsDelayedPaused = server.IsDelayed && server.isInDelayedPausedHosts()
+	server.Site = server.GetSite()
 	// NOTE: does this make sense to set the state to the same?
 	server.SetPrevState(stateSuspect)
 	server.SetState(stateSuspect)
@@ -386,8 +397,9 @@ func (cluster *Cluster) newServerMonitor(url string, user string, pass string, c
 
 	// Prevent child cluster as prefered
 	if server.SourceClusterName == cluster.Name {
-		server.SetIgnored(cluster.IsInIgnoredHosts(server))
-		server.SetIgnoredReadonly(cluster.IsInIgnoredReadonly(server))
+		// Staging server is never elected and stays writable when detached
+		server.SetIgnored(cluster.IsInIgnoredHosts(server) || cluster.IsStagingServer(server))
+		server.SetIgnoredReadonly(cluster.IsInIgnoredReadonly(server) || cluster.IsStagingServer(server))
 		server.SetPreferedBackup(cluster.IsInPreferedBackupHosts(server))
 		server.SetPrefered(cluster.IsInPreferedHosts(server))
 	} else {
@@ -825,19 +837,18 @@ func (server *ServerMonitor) Refresh() error {
 				} else {
 					server.DomainID = uint64(sid)
 				}
-				if cluster.Conf.MultiMasterGrouprep {
-					server.IsGroupReplicationMaster, err = dbhelper.IsGroupReplicationMaster(server.Conn, server.DBVersion, server.Host)
-					server.IsGroupReplicationSlave, err = dbhelper.IsGroupReplicationSlave(server.Conn, server.DBVersion, server.Host)
-					if server.IsGroupReplicationSlave && server.State == stateUnconn {
-						server.SetState(stateSlave)
-					}
-				}
 			} else {
 				server.GTIDBinlogPos = gtid.NewMySQLList(server.Variables.Get("GTID_EXECUTED"), server.GetCluster().GetCrcTable())
 				server.GTIDExecuted = server.Variables.Get("GTID_EXECUTED")
 				server.CurrentGtid = server.GTIDBinlogPos
 				server.SlaveGtid = gtid.NewList(server.Variables.Get("GTID_SLAVE_POS"))
 				server.HashUUID = crc64.Checksum([]byte(strings.ToUpper(server.Variables.Get("SERVER_UUID"))), server.GetCluster().GetCrcTable())
+				if cluster.Conf.MultiMasterGrouprep {
+					server.refreshGroupReplication()
+					if server.IsGroupReplicationSlave && server.State == stateUnconn {
+						server.SetState(stateSlave)
+					}
+				}
 				//		fmt.Fprintf(os.Stdout, "gniac2 "+strings.ToUpper(server.Variables.Get("SERVER_UUID"))+" "+strconv.FormatUint(server.HashUUID, 10))
 			}
 
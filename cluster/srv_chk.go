@@ -109,6 +109,9 @@ func (server *ServerMonitor) CheckReplication() string {
 				server.SetState(stateRelayErr)
 			}
 			return fmt.Sprintf("NOT OK, IO Stopped (%s)", ss.LastIOErrno.String)
+		} else if ss.SlaveSQLRunning.String == "No" && ss.SlaveIORunning.String == "Yes" && server.IsDelayedPaused && (ss.LastSQLErrno.String == "" || ss.LastSQLErrno.String == "0") {
+			server.SetState(stateSlave)
+			return "Paused, SQL Stopped on delayed replica"
 		} else if ss.SlaveSQLRunning.String == "No" && ss.SlaveIORunning.String == "Yes" {
 			if server.IsRelay == false && server.IsMaxscale == false {
 				server.SetState(stateSlaveErr)
@@ -419,6 +422,11 @@ func (server *ServerMonitor) CheckMonitoringCredentialsRotation() {
 			//cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral,config.LvlErr, "Fail Vault connection: %v", err)
 			return
 		}
+		if cluster.Conf.VaultMode == VaultDbEngine {
+			// access denied, the credentials may have been revoked before their lease end
+			cluster.expireVaultDatabaseSecret(cluster.Conf.User, vaultRereadMinAge)
+			cluster.expireVaultDatabaseSecret(cluster.Conf.MdbsProxyCredential, vaultRereadMinAge)
+		}
 		//if opensvc and shard proxy clusterhead
 		if server.IsCompute && cluster.Conf.ClusterHead == "" {
 			_, newpass, err := cluster.GetVaultShardProxyCredentials(client)
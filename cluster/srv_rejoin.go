@@ -55,6 +55,10 @@ func (server *ServerMonitor) RejoinMaster() error {
 	if cluster.StateMachine.IsInFailover() {
 		return nil
 	}
+	if cluster.IsStagingServer(server) {
+		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, "INFO", "Rejoining staging server %s ignored, use staging refresh or attach", server.URL)
+		return nil
+	}
 	// if cluster.Conf.LogLevel > 2 {
 	cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, "INFO", "Rejoining standalone server %s", server.URL)
 	// }
@@ -505,12 +509,21 @@ func (server *ServerMonitor) rejoinMasterAsSlave() error {
 	return nil
 }
 
+// getStatusChannel returns the channel of a replication status, or the
+// cluster replication channel when no status is given
+func (server *ServerMonitor) getStatusChannel(ss *dbhelper.SlaveStatus) string {
+	if ss != nil && ss.ConnectionName.Valid {
+		return ss.ConnectionName.String
+	}
+	return server.ClusterGroup.Conf.MasterConn
+}
+
 func (server *ServerMonitor) rejoinSlaveChangePassword(ss *dbhelper.SlaveStatus) error {
 	cluster := server.ClusterGroup
 	logs, err := dbhelper.ChangeReplicationPassword(server.Conn, dbhelper.ChangeMasterOpt{
 		User:     cluster.GetRplUser(),
 		Password: cluster.GetRplPass(),
-		Channel:  cluster.Conf.MasterConn,
+		Channel:  server.getStatusChannel(ss),
 	}, server.DBVersion)
 	cluster.LogSQL(logs, err, server.URL, "Rejoin", config.LvlErr, "Change master for password rotation : %s", err)
 	if err != nil {
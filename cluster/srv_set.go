@@ -434,12 +434,13 @@ func (server *ServerMonitor) SetLoadingJobList(val bool) {
 func (server *ServerMonitor) SetReplicationCredentialsRotation(ss *dbhelper.SlaveStatus) {
 	cluster := server.ClusterGroup
 	if server.GetCluster().Conf.IsVaultUsed() {
+		if cluster.Conf.VaultMode == VaultDbEngine {
+			// the replica is refused, the credentials may have been revoked before their lease end
+			cluster.expireVaultDatabaseSecret(cluster.Conf.RplUser, vaultRereadMinAge)
+		}
 		server.GetCluster().SetClusterReplicationCredentialsFromConfig()
 		cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlInfo, "Vault replication user password rotation")
-		err := server.rejoinSlaveChangePassword(ss)
-		if err != nil {
-			cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlWarn, "Rejoin slave change password error: %s", err)
-		}
+		// the master must know the password before the replica reconnects with it
 		if server.GetCluster().Conf.VaultMode == VaultConfigStoreV2 {
 			for _, u := range server.GetCluster().master.Users.ToNewMap() {
 				if u.User == server.GetCluster().GetRplUser() {
@@ -450,6 +451,10 @@ func (server *ServerMonitor) SetReplicationCredentialsRotation(ss *dbhelper.Slav
 
 			}
 		}
+		err := server.changeReplicationCredentials()
+		if err != nil {
+			cluster.LogModulePrintf(cluster.Conf.Verbose, config.ConstLogModGeneral, config.LvlWarn, "Rejoin slave change password error: %s", err)
+		}
 	}
 }
 
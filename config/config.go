@@ -25,6 +25,7 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	masker "github.com/ggwhite/go-masker"
@@ -69,6 +70,15 @@ type Config struct {
 	MonitoringSSLKey                          string                 `scope:"server" mapstructure:"monitoring-ssl-key" toml:"monitoring-ssl-key" json:"monitoringSSLKey"`
 	MonitoringKeyPath                         string                 `scope:"server" mapstructure:"monitoring-key-path" toml:"monitoring-key-path" json:"monitoringKeyPath"`
 	MonitoringKeyPathGitOverwrite             bool                   `scope:"server" mapstructure:"monitoring-key-path-git-overwrite" toml:"monitoring-key-path-git-overwrite" json:"monitoringKeyPathGitOverwrite"`
+	SecretProvider                            string                 `scope:"server" mapstructure:"monitoring-secret-provider" toml:"monitoring-secret-provider" json:"monitoringSecretProvider"`
+	SecretVaultTransitMount                   string                 `scope:"server" mapstructure:"monitoring-secret-vault-transit-mount" toml:"monitoring-secret-vault-transit-mount" json:"monitoringSecretVaultTransitMount"`
+	SecretVaultTransitKey                     string                 `scope:"server" mapstructure:"monitoring-secret-vault-transit-key" toml:"monitoring-secret-vault-transit-key" json:"monitoringSecretVaultTransitKey"`
+	SecretAgeRecipients                       string                 `scope:"server" mapstructure:"monitoring-secret-age-recipients" toml:"monitoring-secret-age-recipients" json:"monitoringSecretAgeRecipients"`
+	SecretAgeIdentity                         string                 `scope:"server" mapstructure:"monitoring-secret-age-identity" toml:"monitoring-secret-age-identity" json:"monitoringSecretAgeIdentity"`
+	SecretKMSKeyID                            string                 `scope:"server" mapstructure:"monitoring-secret-kms-key-id" toml:"monitoring-secret-kms-key-id" json:"monitoringSecretKmsKeyId"`
+	SecretKMSRegion                           string                 `scope:"server" mapstructure:"monitoring-secret-kms-region" toml:"monitoring-secret-kms-region" json:"monitoringSecretKmsRegion"`
+	SecretKMSEndpoint                         string                 `scope:"server" mapstructure:"monitoring-secret-kms-endpoint" toml:"monitoring-secret-kms-endpoint" json:"monitoringSecretKmsEndpoint"`
+	SecretKMSLocalKeyPath                     string                 `scope:"server" mapstructure:"monitoring-secret-kms-local-key-path" toml:"monitoring-secret-kms-local-key-path" json:"monitoringSecretKmsLocalKeyPath"`
 	MonitoringTicker                          int64                  `mapstructure:"monitoring-ticker" toml:"monitoring-ticker" json:"monitoringTicker"`
 	MonitorWaitRetry                          int64                  `mapstructure:"monitoring-wait-retry" toml:"monitoring-wait-retry" json:"monitoringWaitRetry"`
 	Socket                                    string                 `mapstructure:"monitoring-socket" toml:"monitoring-socket" json:"monitoringSocket"`
@@ -146,12 +156,29 @@ type Config struct {
 	DbServersChangeStateScript                string                 `mapstructure:"db-servers-state-change-script" toml:"db-servers-state-change-script" json:"dbServersStateChangeScript"`
 	HostsDelayed                              string                 `mapstructure:"replication-delayed-hosts" toml:"replication-delayed-hosts" json:"replicationDelayedHosts"`
 	HostsDelayedTime                          int                    `mapstructure:"replication-delayed-time" toml:"replication-delayed-time" json:"replicationDelayedTime"`
+	HostsDelayedElectable                     bool                   `mapstructure:"replication-delayed-electable" toml:"replication-delayed-electable" json:"replicationDelayedElectable"`
 	DBServersTLSUseGeneratedCertificate       bool                   `mapstructure:"db-servers-tls-use-generated-cert" toml:"db-servers-tls-use-generated-cert" json:"dbServersUseGeneratedCert"`
 	HostsTLSCA                                string                 `mapstructure:"db-servers-tls-ca-cert" toml:"db-servers-tls-ca-cert" json:"dbServersTlsCaCert"`
 	HostsTlsCliKey                            string                 `mapstructure:"db-servers-tls-client-key" toml:"db-servers-tls-client-key" json:"dbServersTlsClientKey"`
 	HostsTlsCliCert                           string                 `mapstructure:"db-servers-tls-client-cert" toml:"db-servers-tls-client-cert" json:"dbServersTlsClientCert"`
 	HostsTlsSrvKey                            string                 `mapstructure:"db-servers-tls-server-key" toml:"db-servers-tls-server-key" json:"dbServersTlsServerKey"`
 	HostsTlsSrvCert                           string                 `mapstructure:"db-servers-tls-server-cert" toml:"db-servers-tls-server-cert" json:"dbServersTlsServerCert"`
+	CertExpiryWarnDays                        int                    `mapstructure:"cert-expiry-warn-days" toml:"cert-expiry-warn-days" json:"certExpiryWarnDays"`
+	CertAutoRenew                             bool                   `mapstructure:"cert-auto-renew" toml:"cert-auto-renew" json:"certAutoRenew"`
+	CertAutoRenewDays                         int                    `mapstructure:"cert-auto-renew-days" toml:"cert-auto-renew-days" json:"certAutoRenewDays"`
+	CertRollingReloadWait                     int                    `mapstructure:"cert-rolling-reload-wait" toml:"cert-rolling-reload-wait" json:"certRollingReloadWait"`
+	DBUsers                                   string                 `mapstructure:"db-users" toml:"db-users" json:"dbUsers"`
+	DBUsersCredential                         string                 `mapstructure:"db-users-credential" toml:"db-users-credential" json:"dbUsersCredential"`
+	DBUsersPasswordMinLength                  int                    `mapstructure:"db-users-password-min-length" toml:"db-users-password-min-length" json:"dbUsersPasswordMinLength"`
+	DBUsersPasswordLifetime                   int                    `mapstructure:"db-users-password-lifetime" toml:"db-users-password-lifetime" json:"dbUsersPasswordLifetime"`
+	DBUsersRequireSSL                         bool                   `mapstructure:"db-users-require-ssl" toml:"db-users-require-ssl" json:"dbUsersRequireSsl"`
+	DBUsersDriftCheck                         bool                   `mapstructure:"db-users-drift-check" toml:"db-users-drift-check" json:"dbUsersDriftCheck"`
+	DBUsersDriftRemediate                     bool                   `mapstructure:"db-users-drift-remediate" toml:"db-users-drift-remediate" json:"dbUsersDriftRemediate"`
+	SecurityAuditCheck                        bool                   `mapstructure:"security-audit-check" toml:"security-audit-check" json:"securityAuditCheck"`
+	SecurityAuditAutofix                      bool                   `mapstructure:"security-audit-autofix" toml:"security-audit-autofix" json:"securityAuditAutofix"`
+	SecurityAuditAdvisoriesFile               string                 `mapstructure:"security-audit-advisories-file" toml:"security-audit-advisories-file" json:"securityAuditAdvisoriesFile"`
+	ApprovalOperations                        string                 `mapstructure:"approval-operations" toml:"approval-operations" json:"approvalOperations"`
+	ApprovalTTL                               int                    `mapstructure:"approval-ttl" toml:"approval-ttl" json:"approvalTtl"`
 	PrefMaster                                string                 `mapstructure:"db-servers-prefered-master" toml:"db-servers-prefered-master" json:"dbServersPreferedMaster"`
 	BackupServers                             string                 `mapstructure:"db-servers-backup-hosts" toml:"db-servers-backup-hosts" json:"dbServersBackupHosts"`
 	IgnoreSrv                                 string                 `mapstructure:"db-servers-ignored-hosts" toml:"db-servers-ignored-hosts" json:"dbServersIgnoredHosts"`
@@ -159,14 +186,19 @@ type Config struct {
 	Timeout                                   int                    `mapstructure:"db-servers-connect-timeout" toml:"db-servers-connect-timeout" json:"dbServersConnectTimeout"`
 	ReadTimeout                               int                    `mapstructure:"db-servers-read-timeout" toml:"db-servers-read-timeout" json:"dbServersReadTimeout"`
 	DBServersLocality                         string                 `mapstructure:"db-servers-locality" toml:"db-servers-locality" json:"dbServersLocality"`
+	DBServersSites                            string                 `mapstructure:"db-servers-sites" toml:"db-servers-sites" json:"dbServersSites"`
+	MonitoringSite                            string                 `mapstructure:"monitoring-site" toml:"monitoring-site" json:"monitoringSite"`
 	PRXServersReadOnMaster                    bool                   `mapstructure:"proxy-servers-read-on-master" toml:"proxy-servers-read-on-master" json:"proxyServersReadOnMaster"`
 	PRXServersReadOnMasterNoSlave             bool                   `mapstructure:"proxy-servers-read-on-master-no-slave" toml:"proxy-servers-read-on-master-no-slave" json:"proxyServersReadOnMasterNoSlave"`
 	PRXServersBackendCompression              bool                   `mapstructure:"proxy-servers-backend-compression" toml:"proxy-servers-backend-compression" json:"proxyServersBackendCompression"`
 	PRXServersBackendMaxReplicationLag        int                    `mapstructure:"proxy-servers-backend-max-replication-lag" toml:"proxy-servers-backend--max-replication-lag" json:"proxyServersBackendMaxReplicationLag"`
 	PRXServersBackendMaxConnections           int                    `mapstructure:"proxy-servers-backend-max-connections" toml:"proxy-servers-backend--max-connections" json:"proxyServersBackendMaxConnections"`
 	PRXServersChangeStateScript               string                 `mapstructure:"proxy-servers-change-state-script" toml:"proxy-servers-change-state-script" json:"proxyServersChangeStateScript"`
+	PRXDriftCheck                             bool                   `mapstructure:"proxy-drift-check" toml:"proxy-drift-check" json:"proxyDriftCheck"`
+	PRXDriftRemediate                         bool                   `mapstructure:"proxy-drift-remediate" toml:"proxy-drift-remediate" json:"proxyDriftRemediate"`
 	ClusterHead                               string                 `mapstructure:"cluster-head" toml:"cluster-head" json:"clusterHead"`
 	ReplicationMultisourceHeadClusters        string                 `mapstructure:"replication-multisource-head-clusters" toml:"replication-multisource-head-clusters" json:"replicationMultisourceHeadClusters"`
+	ReplicationMultisourceChannelRepoint      bool                   `mapstructure:"replication-multisource-channel-repoint" toml:"replication-multisource-channel-repoint" json:"replicationMultisourceChannelRepoint"`
 	MasterConnectRetry                        int                    `mapstructure:"replication-master-connect-retry" toml:"replication-master-connect-retry" json:"replicationMasterConnectRetry"`
 	RplUser                                   string                 `mapstructure:"replication-credential" toml:"replication-credential" json:"replicationCredential"`
 	ReplicationErrorScript                    string                 `mapstructure:"replication-error-script" toml:"replication-error-script" json:"replicationErrorScript"`
@@ -179,8 +211,16 @@ type Config struct {
 	MultiMasterWsrep                          bool                   `mapstructure:"replication-multi-master-wsrep" toml:"replication-multi-master-wsrep" json:"replicationMultiMasterWsrep"`
 	MultiMasterGrouprep                       bool                   `mapstructure:"replication-multi-master-grouprep" toml:"replication-multi-master-grouprep" json:"replicationMultiMasterGrouprep"`
 	MultiMasterGrouprepPort                   int                    `mapstructure:"replication-multi-master-grouprep-port" toml:"replication-multi-master-grouprep-port" json:"replicationMultiMasterGrouprepPort"`
+	MultiMasterGrouprepMemberWeights          string                 `mapstructure:"replication-multi-master-grouprep-member-weights" toml:"replication-multi-master-grouprep-member-weights" json:"replicationMultiMasterGrouprepMemberWeights"`
+	MultiMasterGrouprepRejoin                 bool                   `mapstructure:"replication-multi-master-grouprep-rejoin" toml:"replication-multi-master-grouprep-rejoin" json:"replicationMultiMasterGrouprepRejoin"`
+	MultiMasterGrouprepRejoinInterval         int                    `mapstructure:"replication-multi-master-grouprep-rejoin-interval" toml:"replication-multi-master-grouprep-rejoin-interval" json:"replicationMultiMasterGrouprepRejoinInterval"`
 	MultiMasterWsrepSSTMethod                 string                 `mapstructure:"replication-multi-master-wsrep-sst-method" toml:"replication-multi-master-wsrep-sst-method" json:"replicationMultiMasterWsrepSSTMethod"`
 	MultiMasterWsrepPort                      int                    `mapstructure:"replication-multi-master-wsrep-port" toml:"replication-multi-master-wsrep-port" json:"replicationMultiMasterWsrepPort"`
+	WsrepRecoverNonPrimary                    bool                   `mapstructure:"wsrep-recover-non-primary" toml:"wsrep-recover-non-primary" json:"wsrepRecoverNonPrimary"`
+	WsrepNonPrimaryTimeout                    int                    `mapstructure:"wsrep-non-primary-timeout" toml:"wsrep-non-primary-timeout" json:"wsrepNonPrimaryTimeout"`
+	WsrepFlowControlMaxPaused                 int                    `mapstructure:"wsrep-flow-control-max-paused" toml:"wsrep-flow-control-max-paused" json:"wsrepFlowControlMaxPaused"`
+	WsrepBackupDesync                         bool                   `mapstructure:"wsrep-backup-desync" toml:"wsrep-backup-desync" json:"wsrepBackupDesync"`
+	WsrepSyncTimeout                          int                    `mapstructure:"wsrep-sync-timeout" toml:"wsrep-sync-timeout" json:"wsrepSyncTimeout"`
 	MultiMaster                               bool                   `mapstructure:"replication-multi-master" toml:"replication-multi-master" json:"replicationMultiMaster"`
 	MultiMasterConcurrentWrite                bool                   `mapstructure:"replication-multi-master-concurrent-write" toml:"replication-multi-master-concurrent-write" json:"replicationMultiMasterConcurrentWrite"`
 	MultiTierSlave                            bool                   `mapstructure:"replication-multi-tier-slave" toml:"replication-multi-tier-slave" json:"replicationMultiTierSlave"`
@@ -188,6 +228,12 @@ type Config struct {
 	MasterSlavePgLogical                      bool                   `mapstructure:"replication-master-slave-pg-logical" toml:"replication-master-slave-pg-logical" json:"replicationMasterSlavePgLogical"`
 	ReplicationNoRelay                        bool                   `mapstructure:"replication-master-slave-never-relay" toml:"replication-master-slave-never-relay" json:"replicationMasterSlaveNeverRelay"`
 	ReplicationRestartOnSQLErrorMatch         string                 `mapstructure:"replication-restart-on-sqlerror-match" toml:"replication-restart-on-sqlerror-match" json:"eeplicationRestartOnSqlLErrorMatch"`
+	ReplicationPlaybook                       bool                   `mapstructure:"replication-playbook" toml:"replication-playbook" json:"replicationPlaybook"`
+	ReplicationPlaybooks                      string                 `mapstructure:"replication-playbooks" toml:"replication-playbooks" json:"replicationPlaybooks"`
+	ReplicationPlaybookMinInterval            int                    `mapstructure:"replication-playbook-min-interval" toml:"replication-playbook-min-interval" json:"replicationPlaybookMinInterval"`
+	ReplicationPlaybookWindow                 int                    `mapstructure:"replication-playbook-window" toml:"replication-playbook-window" json:"replicationPlaybookWindow"`
+	ReplicationPlaybookApprovalThreshold      int                    `mapstructure:"replication-playbook-approval-threshold" toml:"replication-playbook-approval-threshold" json:"replicationPlaybookApprovalThreshold"`
+	ReplicationPlaybookReseedMethod           string                 `mapstructure:"replication-playbook-reseed-method" toml:"replication-playbook-reseed-method" json:"replicationPlaybookReseedMethod"`
 	SwitchWaitKill                            int64                  `mapstructure:"switchover-wait-kill" toml:"switchover-wait-kill" json:"switchoverWaitKill"`
 	SwitchWaitTrx                             int64                  `mapstructure:"switchover-wait-trx" toml:"switchover-wait-trx" json:"switchoverWaitTrx"`
 	SwitchWaitWrite                           int                    `mapstructure:"switchover-wait-write-query" toml:"switchover-wait-write-query" json:"switchoverWaitWriteQuery"`
@@ -199,6 +245,9 @@ type Config struct {
 	SwitchSlaveWaitRouteChange                int                    `mapstructure:"switchover-wait-route-change" toml:"switchover-wait-route-change" json:"switchoverWaitRouteChange"`
 	SwitchDecreaseMaxConn                     bool                   `mapstructure:"switchover-decrease-max-conn" toml:"switchover-decrease-max-conn" json:"switchoverDecreaseMaxConn"`
 	SwitchDecreaseMaxConnValue                int64                  `mapstructure:"switchover-decrease-max-conn-value" toml:"switchover-decrease-max-conn-value" json:"switchoverDecreaseMaxConnValue"`
+	SwitchDrain                               bool                   `mapstructure:"switchover-drain" toml:"switchover-drain" json:"switchoverDrain"`
+	SwitchDrainTimeout                        int64                  `mapstructure:"switchover-drain-timeout" toml:"switchover-drain-timeout" json:"switchoverDrainTimeout"`
+	SwitchDrainKill                           bool                   `mapstructure:"switchover-drain-kill" toml:"switchover-drain-kill" json:"switchoverDrainKill"`
 	FailLimit                                 int                    `mapstructure:"failover-limit" toml:"failover-limit" json:"failoverLimit"`
 	PreScript                                 string                 `mapstructure:"failover-pre-script" toml:"failover-pre-script" json:"failoverPreScript"`
 	PostScript                                string                 `mapstructure:"failover-post-script" toml:"failover-post-script" json:"failoverPostScript"`
@@ -210,6 +259,8 @@ type Config struct {
 	FailEventScheduler                        bool                   `mapstructure:"failover-event-scheduler" toml:"failover-event-scheduler" json:"failoverEventScheduler"`
 	FailEventStatus                           bool                   `mapstructure:"failover-event-status" toml:"failover-event-status" json:"failoverEventStatus"`
 	FailRestartUnsafe                         bool                   `mapstructure:"failover-restart-unsafe" toml:"failover-restart-unsafe" json:"failoverRestartUnsafe"`
+	FailoverSitePolicy                        string                 `mapstructure:"failover-site-policy" toml:"failover-site-policy" json:"failoverSitePolicy"`
+	FailoverSiteQuorum                        bool                   `mapstructure:"failover-site-quorum" toml:"failover-site-quorum" json:"failoverSiteQuorum"`
 	FailResetTime                             int64                  `mapstructure:"failcount-reset-time" toml:"failover-reset-time" json:"failoverResetTime"`
 	FailMode                                  string                 `mapstructure:"failover-mode" toml:"failover-mode" json:"failoverMode"`
 	FailMaxDelay                              int64                  `mapstructure:"failover-max-slave-delay" toml:"failover-max-slave-delay" json:"failoverMaxSlaveDelay"`
@@ -250,6 +301,14 @@ type Config struct {
 	CheckGrants                               bool                   `mapstructure:"check-grants" toml:"check-grants" json:"checkGrants"`
 	RplChecks                                 bool                   `mapstructure:"check-replication-state" toml:"check-replication-state" json:"checkReplicationState"`
 	RplCheckErrantTrx                         bool                   `mapstructure:"check-replication-errant-trx" toml:"check-replication-errant-trx" json:"checkReplicationErrantTrx"`
+	RplErrantRepairRecloneMethod              string                 `mapstructure:"replication-errant-repair-reclone-method" toml:"replication-errant-repair-reclone-method" json:"replicationErrantRepairRecloneMethod"`
+	RplErrantRepairMaxTrx                     int                    `mapstructure:"replication-errant-repair-max-trx" toml:"replication-errant-repair-max-trx" json:"replicationErrantRepairMaxTrx"`
+	ConsistencyCheck                          bool                   `mapstructure:"consistency-check" toml:"consistency-check" json:"consistencyCheck"`
+	ConsistencyCheckChunkSize                 int                    `mapstructure:"consistency-check-chunk-size" toml:"consistency-check-chunk-size" json:"consistencyCheckChunkSize"`
+	ConsistencyCheckChunkRate                 int                    `mapstructure:"consistency-check-chunk-rate" toml:"consistency-check-chunk-rate" json:"consistencyCheckChunkRate"`
+	ConsistencyCheckMaxLag                    int                    `mapstructure:"consistency-check-max-lag" toml:"consistency-check-max-lag" json:"consistencyCheckMaxLag"`
+	ConsistencyCheckInterval                  int                    `mapstructure:"consistency-check-interval" toml:"consistency-check-interval" json:"consistencyCheckInterval"`
+	ConsistencyCheckResync                    bool                   `mapstructure:"consistency-check-resync" toml:"consistency-check-resync" json:"consistencyCheckResync"`
 	ForceSlaveHeartbeat                       bool                   `mapstructure:"force-slave-heartbeat" toml:"force-slave-heartbeat" json:"forceSlaveHeartbeat"`
 	ForceSlaveHeartbeatTime                   int                    `mapstructure:"force-slave-heartbeat-time" toml:"force-slave-heartbeat-time" json:"forceSlaveHeartbeatTime"`
 	ForceSlaveHeartbeatRetry                  int                    `mapstructure:"force-slave-heartbeat-retry" toml:"force-slave-heartbeat-retry" json:"forceSlaveHeartbeatRetry"`
@@ -336,6 +395,10 @@ type Config struct {
 	MxsGetInfoMethod                          string                 `mapstructure:"maxscale-get-info-method" toml:"maxscale-get-info-method" json:"maxscaleGetInfoMethod"`
 	MxsServerMatchPort                        bool                   `mapstructure:"maxscale-server-match-port" toml:"maxscale-server-match-port" json:"maxscaleServerMatchPort"`
 	MxsBinaryPath                             string                 `mapstructure:"maxscale-binary-path" toml:"maxscale-binary-path" json:"maxscalemBinaryPath"`
+	MxsRestPort                               string                 `mapstructure:"maxscale-rest-port" toml:"maxscale-rest-port" json:"maxscaleRestPort"`
+	MxsRestHttps                              bool                   `mapstructure:"maxscale-rest-https" toml:"maxscale-rest-https" json:"maxscaleRestHttps"`
+	MxsRestHttpsInsecure                      bool                   `mapstructure:"maxscale-rest-https-insecure" toml:"maxscale-rest-https-insecure" json:"maxscaleRestHttpsInsecure"`
+	MxsBootstrap                              bool                   `mapstructure:"maxscale-bootstrap" toml:"maxscale-bootstrap" json:"maxscaleBootstrap"`
 	MyproxyOn                                 bool                   `mapstructure:"myproxy" toml:"myproxy" json:"myproxy"`
 	MyproxyDebug                              bool                   `mapstructure:"myproxy-debug" toml:"myproxy-debug" json:"myproxyDebug"`
 	MyproxyLogLevel                           int                    `mapstructure:"myproxy-log-level" toml:"myproxy-log-level" json:"myproxyLogLevel"`
@@ -421,12 +484,19 @@ type Config struct {
 	RegistryConsulToken                       string                 `mapstructure:"registry-consul-token" toml:"registry-consul-token" json:"registryConsulToken"`
 	RegistryConsulHosts                       string                 `mapstructure:"registry-servers" toml:"registry-servers" json:"registryServers"`
 	RegistryConsulJanitorWeights              string                 `mapstructure:"registry-janitor-weights" toml:"registry-janitor-weights" json:"registryJanitorWeights"`
+	RegistryConsulCheckTTL                    int                    `mapstructure:"registry-consul-check-ttl" toml:"registry-consul-check-ttl" json:"registryConsulCheckTtl"`
+	RegistryConsulKV                          bool                   `mapstructure:"registry-consul-kv" toml:"registry-consul-kv" json:"registryConsulKv"`
+	RegistryConsulKVPrefix                    string                 `mapstructure:"registry-consul-kv-prefix" toml:"registry-consul-kv-prefix" json:"registryConsulKvPrefix"`
+	RegistryConsulKVSwitchover                bool                   `mapstructure:"registry-consul-kv-switchover" toml:"registry-consul-kv-switchover" json:"registryConsulKvSwitchover"`
 	KeyPath                                   string                 `mapstructure:"keypath" toml:"-" json:"-"`
 	Topology                                  string                 `mapstructure:"topology" toml:"-" json:"-"` // use by bootstrap
 	TopologyTarget                            string                 `mapstructure:"topology-target" toml:"topology-target" json:"topologyTarget"`
 	TopologyStaging                           bool                   `mapstructure:"topology-staging" toml:"topology-staging" json:"topologyStaging"`
 	TopologyStagingRefreshScript              string                 `mapstructure:"staging-refresh-script" toml:"staging-refresh-script" json:"stagingRefreshScript"`
-	TopologyStagingPostDetachScript           string                 `mapstructure:"staging-post-detach-script" toml:"staging-refresh-script" json:"stagingPostDetachScript"`
+	TopologyStagingPostDetachScript           string                 `mapstructure:"staging-post-detach-script" toml:"staging-post-detach-script" json:"stagingPostDetachScript"`
+	TopologyStagingServer                     string                 `mapstructure:"staging-server" toml:"staging-server" json:"stagingServer"`
+	TopologyStagingRefreshMethod              string                 `mapstructure:"staging-refresh-method" toml:"staging-refresh-method" json:"stagingRefreshMethod"`
+	TopologyStagingRefreshTimeout             int                    `mapstructure:"staging-refresh-timeout" toml:"staging-refresh-timeout" json:"stagingRefreshTimeout"`
 	GraphiteMetrics                           bool                   `scope:"server" mapstructure:"graphite-metrics" toml:"graphite-metrics" json:"graphiteMetrics"`
 	GraphiteEmbedded                          bool                   `scope:"server" mapstructure:"graphite-embedded" toml:"graphite-embedded" json:"graphiteEmbedded"`
 	GraphiteWhitelist                         bool                   `scope:"server" mapstructure:"graphite-whitelist" toml:"graphite-whitelist" json:"graphiteWhitelist"`
@@ -591,11 +661,44 @@ type Config struct {
 	APIUsersACLAllowExternal                  string                 `mapstructure:"api-credentials-acl-allow-external" toml:"api-credentials-acl-allow-external" json:"apiCredentialsACLAllowExternal"`
 	APIUsersACLDiscard                        string                 `mapstructure:"api-credentials-acl-discard" toml:"api-credentials-acl-discard" json:"apiCredentialsACLDiscard"`
 	APIUsersACLDiscardExternal                string                 `mapstructure:"api-credentials-acl-discard-external" toml:"api-credentials-acl-discard-external" json:"apiCredentialsACLDiscardExternal"`
+	APIRBACRoles                              string                 `mapstructure:"api-rbac-roles" toml:"api-rbac-roles" json:"apiRbacRoles"`
+	APIRBACBindings                           string                 `mapstructure:"api-rbac-bindings" toml:"api-rbac-bindings" json:"apiRbacBindings"`
+	APILDAPURL                                string                 `scope:"server" mapstructure:"api-ldap-url" toml:"api-ldap-url" json:"apiLdapUrl"`
+	APILDAPBindDN                             string                 `scope:"server" mapstructure:"api-ldap-bind-dn" toml:"api-ldap-bind-dn" json:"apiLdapBindDn"`
+	APILDAPBindPassword                       string                 `scope:"server" mapstructure:"api-ldap-bind-password" toml:"api-ldap-bind-password" json:"apiLdapBindPassword"`
+	APILDAPBaseDN                             string                 `scope:"server" mapstructure:"api-ldap-base-dn" toml:"api-ldap-base-dn" json:"apiLdapBaseDn"`
+	APILDAPUserFilter                         string                 `scope:"server" mapstructure:"api-ldap-user-filter" toml:"api-ldap-user-filter" json:"apiLdapUserFilter"`
+	APILDAPEmailAttr                          string                 `scope:"server" mapstructure:"api-ldap-email-attr" toml:"api-ldap-email-attr" json:"apiLdapEmailAttr"`
+	APILDAPGroupBaseDN                        string                 `scope:"server" mapstructure:"api-ldap-group-base-dn" toml:"api-ldap-group-base-dn" json:"apiLdapGroupBaseDn"`
+	APILDAPGroupFilter                        string                 `scope:"server" mapstructure:"api-ldap-group-filter" toml:"api-ldap-group-filter" json:"apiLdapGroupFilter"`
+	APILDAPGroupAttr                          string                 `scope:"server" mapstructure:"api-ldap-group-attr" toml:"api-ldap-group-attr" json:"apiLdapGroupAttr"`
+	APILDAPMemberOfAttr                       string                 `scope:"server" mapstructure:"api-ldap-memberof-attr" toml:"api-ldap-memberof-attr" json:"apiLdapMemberofAttr"`
+	APILDAPStartTLS                           bool                   `scope:"server" mapstructure:"api-ldap-start-tls" toml:"api-ldap-start-tls" json:"apiLdapStartTls"`
+	APILDAPInsecureSkipVerify                 bool                   `scope:"server" mapstructure:"api-ldap-tls-insecure-skip-verify" toml:"api-ldap-tls-insecure-skip-verify" json:"apiLdapTlsInsecureSkipVerify"`
+	APILDAPGroupACL                           string                 `mapstructure:"api-ldap-group-acl-allow" toml:"api-ldap-group-acl-allow" json:"apiLdapGroupAclAllow"`
+	APITokensFile                             string                 `scope:"server" mapstructure:"api-tokens-file" toml:"api-tokens-file" json:"apiTokensFile"`
 	APISecureConfig                           bool                   `mapstructure:"api-credentials-secure-config" toml:"api-credentials-secure-config" json:"apiCredentialsSecureConfig"`
 	APIPort                                   string                 `scope:"server" mapstructure:"api-port" toml:"api-port" json:"apiPort"`
 	APIBind                                   string                 `scope:"server" mapstructure:"api-bind" toml:"api-bind" json:"apiBind"`
 	APIPublicURL                              string                 `scope:"server" mapstructure:"api-public-url" toml:"api-public-url" json:"apiPublicUrl"`
 	APIHttpsBind                              bool                   `scope:"server" mapstructure:"api-https-bind" toml:"api-secure" json:"apiHttpsBind"`
+	APIHttpsACME                              bool                   `scope:"server" mapstructure:"api-https-acme" toml:"api-https-acme" json:"apiHttpsAcme"`
+	APIHttpsACMEDomains                       string                 `scope:"server" mapstructure:"api-https-acme-domains" toml:"api-https-acme-domains" json:"apiHttpsAcmeDomains"`
+	APIHttpsACMEDirectoryURL                  string                 `scope:"server" mapstructure:"api-https-acme-directory-url" toml:"api-https-acme-directory-url" json:"apiHttpsAcmeDirectoryUrl"`
+	APIHttpsACMEEmail                         string                 `scope:"server" mapstructure:"api-https-acme-email" toml:"api-https-acme-email" json:"apiHttpsAcmeEmail"`
+	APIHttpsACMECacheDir                      string                 `scope:"server" mapstructure:"api-https-acme-cache-dir" toml:"api-https-acme-cache-dir" json:"apiHttpsAcmeCacheDir"`
+	APIHttpsACMECACert                        string                 `scope:"server" mapstructure:"api-https-acme-ca-cert" toml:"api-https-acme-ca-cert" json:"apiHttpsAcmeCaCert"`
+	APIHttpsACMEHTTPBind                      string                 `scope:"server" mapstructure:"api-https-acme-http-bind" toml:"api-https-acme-http-bind" json:"apiHttpsAcmeHttpBind"`
+	DNSServer                                 bool                   `scope:"server" mapstructure:"dns-server" toml:"dns-server" json:"dnsServer"`
+	DNSServerBind                             string                 `scope:"server" mapstructure:"dns-server-bind" toml:"dns-server-bind" json:"dnsServerBind"`
+	DNSServerDomain                           string                 `scope:"server" mapstructure:"dns-server-domain" toml:"dns-server-domain" json:"dnsServerDomain"`
+	DNSServerTTL                              int                    `scope:"server" mapstructure:"dns-server-ttl" toml:"dns-server-ttl" json:"dnsServerTtl"`
+	DNSServerReadMaxDelay                     int64                  `mapstructure:"dns-server-ro-max-delay" toml:"dns-server-ro-max-delay" json:"dnsServerRoMaxDelay"`
+	AuditLog                                  bool                   `scope:"server" mapstructure:"audit-log" toml:"audit-log" json:"auditLog"`
+	AuditLogFile                              string                 `scope:"server" mapstructure:"audit-log-file" toml:"audit-log-file" json:"auditLogFile"`
+	AuditLogSyslog                            bool                   `scope:"server" mapstructure:"audit-log-syslog" toml:"audit-log-syslog" json:"auditLogSyslog"`
+	AuditLogSyslogAddr                        string                 `scope:"server" mapstructure:"audit-log-syslog-addr" toml:"audit-log-syslog-addr" json:"auditLogSyslogAddr"`
+	AuditLogKey                               string                 `scope:"server" mapstructure:"audit-log-key" toml:"audit-log-key" json:"-"`
 	AlertScript                               string                 `mapstructure:"alert-script" toml:"alert-script" json:"alertScript"`
 	ConfigFile                                string                 `mapstructure:"config" toml:"-" json:"-"`
 	MonitorScheduler                          bool                   `mapstructure:"monitoring-scheduler" toml:"monitoring-scheduler" json:"monitoringScheduler"`
@@ -626,6 +729,14 @@ type Config struct {
 	SchedulerSLARotateCron                    string                 `mapstructure:"scheduler-sla-rotate-cron" toml:"scheduler-sla-rotate-cron" json:"schedulerSlaRotateCron"`
 	SchedulerRollingRestart                   bool                   `mapstructure:"scheduler-rolling-restart" toml:"scheduler-rolling-restart" json:"schedulerRollingRestart"`
 	SchedulerRollingRestartCron               string                 `mapstructure:"scheduler-rolling-restart-cron" toml:"scheduler-rolling-restart-cron" json:"schedulerRollingRestartCron"`
+	UpgradeMethod                             string                 `mapstructure:"upgrade-method" toml:"upgrade-method" json:"upgradeMethod"`
+	UpgradeSSHScript                          string                 `mapstructure:"upgrade-ssh-script" toml:"upgrade-ssh-script" json:"upgradeSshScript"`
+	UpgradeTargetVersion                      string                 `mapstructure:"upgrade-target-version" toml:"upgrade-target-version" json:"upgradeTargetVersion"`
+	UpgradeClientPath                         string                 `mapstructure:"upgrade-client-path" toml:"upgrade-client-path" json:"upgradeClientPath"`
+	UpgradeChecksumTables                     string                 `mapstructure:"upgrade-checksum-tables" toml:"upgrade-checksum-tables" json:"upgradeChecksumTables"`
+	UpgradeChecksumSample                     int                    `mapstructure:"upgrade-checksum-sample" toml:"upgrade-checksum-sample" json:"upgradeChecksumSample"`
+	SchedulerStagingRefresh                   bool                   `mapstructure:"scheduler-staging-refresh" toml:"scheduler-staging-refresh" json:"schedulerStagingRefresh"`
+	SchedulerStagingRefreshCron               string                 `mapstructure:"scheduler-staging-refresh-cron" toml:"scheduler-staging-refresh-cron" json:"schedulerStagingRefreshCron"`
 	SchedulerRollingReprov                    bool                   `mapstructure:"scheduler-rolling-reprov" toml:"scheduler-rolling-reprov" json:"schedulerRollingReprov"`
 	SchedulerRollingReprovCron                string                 `mapstructure:"scheduler-rolling-reprov-cron" toml:"scheduler-rolling-reprov-cron" json:"schedulerRollingReprovCron"`
 	SchedulerJobsSSH                          bool                   `mapstructure:"scheduler-jobs-ssh" toml:"scheduler-jobs-ssh" json:"schedulerJobsSsh"`
@@ -680,6 +791,7 @@ type Config struct {
 	VaultMount                                string                 `mapstructure:"vault-mount" toml:"vault-mount" json:"vaultMount"`
 	VaultAuth                                 string                 `mapstructure:"vault-auth" toml:"vault-auth" json:"vaultAuth"`
 	VaultToken                                string                 `mapstructure:"vault-token" toml:"vault-token" json:"vaultToken"`
+	VaultLeaseRenewThreshold                  int                    `mapstructure:"vault-lease-renew-threshold" toml:"vault-lease-renew-threshold" json:"vaultLeaseRenewThreshold"`
 	LogVault                                  bool                   `mapstructure:"log-vault" toml:"log-vault" json:"logVault"`
 	LogVaultLevel                             int                    `mapstructure:"log-vault-level" toml:"log-vault-level" json:"logVaultLevel"`
 	GitUrl                                    string                 `scope:"server" mapstructure:"git-url" toml:"git-url" json:"gitUrl"`
@@ -1058,6 +1170,7 @@ const (
 	GrantClusterShowAgents         string = "cluster-show-agents"
 	GrantClusterShowCertificates   string = "cluster-show-certificates"
 	GrantClusterRotatePasswords    string = "cluster-rotate-passwords"
+	GrantClusterApprove            string = "cluster-approve"
 	GrantClusterResetSLA           string = "cluster-reset-sla"
 	GrantClusterDebug              string = "cluster-debug"
 
@@ -1248,7 +1361,10 @@ func (conf *Config) DecryptSecretsFromConfig() {
 		"cloud18-dba-user-credentials":          {"", ""},
 		"cloud18-sponsor-user-credentials":      {"", ""},
 		"vault-token":                           {"", ""},
-		"api-oauth-client-secret":               {"", ""}}
+		"api-oauth-client-secret":               {"", ""},
+		"api-ldap-bind-password":                {"", ""},
+		"audit-log-key":                         {"", ""},
+		"db-users-credential":                   {"", ""}}
 
 	for k := range conf.Secrets {
 
@@ -1351,6 +1467,15 @@ func (conf *Config) GetVaultConnection() (*vault.Client, error) {
 			return nil, err
 		}
 
+		if conf.VaultAuth == "token" {
+			token := conf.GetDecryptedPassword("vault-token", conf.VaultToken)
+			if token == "" {
+				return nil, errors.New("Vault token auth without vault-token")
+			}
+			client.SetToken(token)
+			return client, nil
+		}
+
 		roleID := conf.VaultRoleId
 		secretID := &auth.SecretID{FromString: conf.GetDecryptedPassword("vault-secret-id", conf.VaultSecretId)}
 		if roleID == "" || secretID == nil {
@@ -1382,26 +1507,96 @@ func (conf *Config) GetVaultConnection() (*vault.Client, error) {
 }
 
 func (conf *Config) GetDecryptedPassword(key string, value string) string {
+	name, err := crypto.ProviderOf(value)
+	if err != nil {
+		return value
+	}
+	if name == crypto.ProviderAES && conf.SecretKey == nil {
+		return value
+	}
+	if conf.IsEligibleForPrinting(ConstLogModConfigLoad, LvlDbg) {
+		log.WithFields(log.Fields{"cluster": "none", "type": "log", "module": "config"}).Debugf("GetDecryptedPassword: decrypting key `%s` with %s: %s", key, name, value)
+	}
+	p, err := conf.GetSecretProvider(name)
+	if err != nil {
+		log.WithFields(log.Fields{"cluster": "none", "type": "log", "module": "config"}).Errorf("Can't decrypt key `%s`: %s", key, err)
+		return value
+	}
+	plaintext, err := crypto.Open(p, value)
+	if err != nil {
+		log.WithFields(log.Fields{"cluster": "none", "type": "log", "module": "config"}).Errorf("Can't decrypt key `%s` with %s: %s", key, name, err)
+		return value
+	}
+	return plaintext
+}
 
-	if conf.SecretKey != nil && strings.HasPrefix(value, "hash_") {
-		value = strings.TrimPrefix(value, "hash_")
-		p := crypto.Password{Key: conf.SecretKey}
-		if conf.IsEligibleForPrinting(ConstLogModConfigLoad, LvlDbg) {
-			log.WithFields(log.Fields{"cluster": "none", "type": "log", "module": "config"}).Debugf("GetDecryptedPassword: decrypting key `%s`: %s", key, value)
-		}
+var secretProviders = make(map[string]crypto.Provider)
+var secretProvidersMutex sync.Mutex
 
-		if value != "" {
-			p.CipherText = value
-			err := p.Decrypt()
-			if err != nil {
-				return value
-			} else {
-				value = p.PlainText
-				return value
-			}
+// GetSecretProvider returns the secret encryption provider aes, vault, age or kms configured
+// by the monitoring-secret-* flags, providers are kept for the next calls
+func (conf *Config) GetSecretProvider(name string) (crypto.Provider, error) {
+	if name == "" {
+		name = crypto.ProviderAES
+	}
+	if name == crypto.ProviderAES {
+		if conf.SecretKey == nil {
+			conf.LoadEncrytionKey()
+		}
+		if conf.SecretKey == nil {
+			return nil, errors.New("No encryption key, see the keygen command")
+		}
+		return &crypto.AESProvider{Key: conf.SecretKey}, nil
+	}
+	var id string
+	switch name {
+	case crypto.ProviderVaultTransit:
+		id = strings.Join([]string{name, conf.VaultServerAddr, conf.SecretVaultTransitMount, conf.SecretVaultTransitKey}, "|")
+	case crypto.ProviderAge:
+		id = strings.Join([]string{name, conf.SecretAgeRecipients, conf.SecretAgeIdentity}, "|")
+	case crypto.ProviderKMS:
+		id = strings.Join([]string{name, conf.SecretKMSKeyID, conf.SecretKMSRegion, conf.SecretKMSEndpoint, conf.SecretKMSLocalKeyPath}, "|")
+	default:
+		return nil, fmt.Errorf("Unknown secret provider %s", name)
+	}
+	secretProvidersMutex.Lock()
+	defer secretProvidersMutex.Unlock()
+	if p, ok := secretProviders[id]; ok {
+		return p, nil
+	}
+	var p crypto.Provider
+	switch name {
+	case crypto.ProviderVaultTransit:
+		if !conf.IsVaultUsed() {
+			return nil, errors.New("Vault transit needs vault-server-addr")
+		}
+		client, err := conf.GetVaultConnection()
+		if err != nil {
+			return nil, err
+		}
+		// the AppRole token expires, the provider logs in again when Vault refuses it
+		p = &crypto.VaultTransitProvider{Client: client, Mount: conf.SecretVaultTransitMount, Key: conf.SecretVaultTransitKey, Login: conf.GetVaultConnection}
+	case crypto.ProviderAge:
+		ap, err := crypto.NewAgeProvider(conf.SecretAgeRecipients, conf.SecretAgeIdentity)
+		if err != nil {
+			return nil, err
+		}
+		p = ap
+	case crypto.ProviderKMS:
+		var kms crypto.KMS
+		var err error
+		if conf.SecretKMSLocalKeyPath != "" {
+			kms, err = crypto.NewLocalKMS(conf.SecretKMSLocalKeyPath)
+		} else {
+			kms, err = crypto.NewAWSKMS(conf.SecretKMSRegion, conf.SecretKMSEndpoint)
+		}
+		if err != nil {
+			return nil, err
 		}
+		p = &crypto.EnvelopeProvider{KMS: kms, KeyID: conf.SecretKMSKeyID}
 	}
-	return value
+	secretProviders[id] = p
+	return p, nil
 }
 
 func (conf *Config) Reveal(clusterName string, tmpDir string) {
@@ -1552,18 +1747,19 @@ func (conf *Config) WriteKeyToWorkingDir() (string, error) {
 }
 
 func (conf *Config) GetEncryptedString(str string) string {
-	p := crypto.Password{PlainText: str}
-
-	if conf.SecretKey == nil {
-		conf.LoadEncrytionKey()
+	p, err := conf.GetSecretProvider(conf.SecretProvider)
+	if err != nil {
+		if conf.SecretProvider != "" && conf.SecretProvider != crypto.ProviderAES {
+			log.WithFields(log.Fields{"cluster": "none", "type": "log", "module": "config"}).Errorf("Can't encrypt with %s: %s", conf.SecretProvider, err)
+		}
+		return str
 	}
-
-	if conf.SecretKey != nil {
-		p.Key = conf.SecretKey
-		p.Encrypt()
-		return "hash_" + p.CipherText
+	sealed, err := crypto.Seal(p, str)
+	if err != nil {
+		log.WithFields(log.Fields{"cluster": "none", "type": "log", "module": "config"}).Errorf("Can't encrypt with %s: %s", p.Name(), err)
+		return str
 	}
-	return str
+	return sealed
 }
 
 func (conf *Config) GetDecryptedValue(key string) string {
@@ -2152,6 +2348,7 @@ func GetGrantType() map[string]string {
 		GrantClusterShowCertificates:   GrantClusterShowCertificates,
 		GrantClusterResetSLA:           GrantClusterResetSLA,
 		GrantClusterRotatePasswords:    GrantClusterRotatePasswords,
+		GrantClusterApprove:            GrantClusterApprove,
 		GrantProxyConfigCreate:         GrantProxyConfigCreate,
 		GrantProxyConfigGet:            GrantProxyConfigGet,
 		GrantProxyConfigRessource:      GrantProxyConfigRessource,
@@ -2245,6 +2442,7 @@ func GetGrantCluster() []string {
 		GrantClusterShowCertificates,
 		GrantClusterResetSLA,
 		GrantClusterRotatePasswords,
+		GrantClusterApprove,
 	}
 }
 
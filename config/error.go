@@ -106,6 +106,12 @@ var ClusterError = map[string]string{
 	"ERR00094":  "Proxysql %s can not set %s as OFFLINE_SOFT: %s",
 	"ERR00095":  "ProxySQL %s could not load servers to runtime: %s",
 	"ERR00096":  "Proxysql %s can not save changes to disk: %s",
+	"ERR00097":  "Delayed replica %s is not electable, replication-delayed-electable is disabled",
+	"ERR00098":  "Skip slave %s of site %s in election, failover-site-policy is %s",
+	"ERR00099":  "Site %s is unreachable from monitoring site %s, failover canceled without arbitrator or peer confirmation",
+	"ERR00100":  "Wsrep node %s is in %s component",
+	"ERR00101":  "Group replication member %s is in state %s",
+	"ERR00102":  "Group replication member %s sees %d of %d members online, the group has lost its majority",
 	"WARN0022":  "Rejoining standalone server %s to master %s",
 	"WARN0023":  "Number of failed master ping has been reached",
 	"WARN0045":  "Provision task is in queue",
@@ -195,6 +201,24 @@ var ClusterError = map[string]string{
 	"WARN0131":  "Error while reading slow_log on %s. %s. Err: %s",
 	"WARN0132":  "Unable to pull from repository %s. Err: %s",
 	"WARN0133":  "Mydumper version %s is not compatible with MariaDB 10.7 and greater",
+	"WARN0134":  "Proxy %s configuration drift: %s",
+	"WARN0135":  "Certificate %s of %s expires in %d days",
+	"WARN0136":  "Certificate %s of %s is expired since %s",
+	"WARN0137":  "Replica %s could not switch to the rotated replication credentials: %s",
+	"WARN0138":  "Database user %s drift on %s: %s",
+	"WARN0139":  "Database user %s drift on ProxySQL %s: %s",
+	"WARN0140":  "Security audit %s on %s: anonymous users %s",
+	"WARN0141":  "Security audit %s on %s: users without password %s",
+	"WARN0142":  "Security audit %s on %s: users with SUPER from any host %s",
+	"WARN0143":  "Security audit %s on %s: %s is OFF",
+	"WARN0144":  "Security audit %s on %s: replication without TLS on channel %s",
+	"WARN0145":  "Security audit %s on %s: %s is ON",
+	"WARN0146":  "Security audit %s on %s: version affected by %s",
+	"WARN0147":  "Security audit %s on %s: datadir %s is accessible by other users",
+	"WARN0148":  "Consistency check found %d divergent chunks on %s",
+	"WARN0149":  "Wsrep node %s paused by flow control %d%% of the time, above %d%%",
+	"WARN0150":  "Group replication member %s sees %s unreachable",
+	"WARN0151":  "Replication playbook %s for %s error on %s waits for approval, %d runs in the last %d seconds",
 	"MDEV20821": "MariaDB version has replication issue https://jira.mariadb.org/browse/MDEV-20821",
 	"MDEV28310": "MariaDB version has replication issue for non row format https://jira.mariadb.org/browse/MDEV-28310",
 	"MDEV19577": "MariaDB version has replication issue for non row format https://jira.mariadb.org/browse/MDEV-19577",
@@ -0,0 +1,225 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+// consul.go
+
+package consul
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	HealthPassing  = "passing"
+	HealthWarning  = "warning"
+	HealthCritical = "critical"
+
+	consulDefaultPort    = "8500"
+	consulDefaultTimeout = (5 * time.Second)
+)
+
+var ErrKeyNotFound = errors.New("Consul key not found")
+
+// Consul is a minimal client of the consul agent HTTP API v1
+type Consul struct {
+	Addrs      []string
+	Token      string
+	User       string
+	Pass       string
+	HTTPClient *http.Client
+}
+
+type Check struct {
+	CheckID                        string `json:"CheckID,omitempty"`
+	Name                           string `json:"Name,omitempty"`
+	Notes                          string `json:"Notes,omitempty"`
+	TTL                            string `json:"TTL,omitempty"`
+	Status                         string `json:"Status,omitempty"`
+	DeregisterCriticalServiceAfter string `json:"DeregisterCriticalServiceAfter,omitempty"`
+}
+
+type Service struct {
+	ID      string            `json:"ID"`
+	Name    string            `json:"Name"`
+	Tags    []string          `json:"Tags,omitempty"`
+	Address string            `json:"Address,omitempty"`
+	Port    int               `json:"Port,omitempty"`
+	Meta    map[string]string `json:"Meta,omitempty"`
+	Check   *Check            `json:"Check,omitempty"`
+}
+
+type KVPair struct {
+	Key         string `json:"Key"`
+	Value       []byte `json:"Value"`
+	ModifyIndex uint64 `json:"ModifyIndex"`
+}
+
+// NewConsul returns a client for a comma separated list of agent addresses
+func NewConsul(hosts string, token string, user string, pass string) *Consul {
+	c := &Consul{
+		Token:      token,
+		User:       user,
+		Pass:       pass,
+		HTTPClient: &http.Client{Timeout: consulDefaultTimeout},
+	}
+	for _, h := range strings.Split(hosts, ",") {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			continue
+		}
+		if !strings.HasPrefix(h, "http://") && !strings.HasPrefix(h, "https://") {
+			if !strings.Contains(h, ":") || strings.HasSuffix(h, "]") {
+				h = h + ":" + consulDefaultPort
+			}
+			h = "http://" + h
+		}
+		c.Addrs = append(c.Addrs, strings.TrimSuffix(h, "/"))
+	}
+	return c
+}
+
+// do sends the request to the first agent answering
+func (c *Consul) do(method string, path string, query url.Values, body []byte, timeout time.Duration) (*http.Response, error) {
+	if len(c.Addrs) == 0 {
+		return nil, errors.New("No consul address")
+	}
+	client := c.HTTPClient
+	if timeout > 0 {
+		cl := *c.HTTPClient
+		cl.Timeout = timeout
+		client = &cl
+	}
+	var lasterr error
+	for _, addr := range c.Addrs {
+		u := addr + path
+		if len(query) > 0 {
+			u = u + "?" + query.Encode()
+		}
+		req, err := http.NewRequest(method, u, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		if c.Token != "" {
+			req.Header.Set("X-Consul-Token", c.Token)
+		}
+		if c.User != "" {
+			req.SetBasicAuth(c.User, c.Pass)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			lasterr = err
+			continue
+		}
+		return resp, nil
+	}
+	return nil, lasterr
+}
+
+func (c *Consul) put(path string, body []byte) error {
+	resp, err := c.do(http.MethodPut, path, nil, body, 0)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("Consul PUT %s returned %d: %s", path, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// RegisterService registers or updates a service and its check on the local agent
+func (c *Consul) RegisterService(s *Service) error {
+	body, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return c.put("/v1/agent/service/register", body)
+}
+
+// DeregisterService removes a service from the local agent
+func (c *Consul) DeregisterService(id string) error {
+	return c.put("/v1/agent/service/deregister/"+url.PathEscape(id), nil)
+}
+
+// UpdateTTL sets the status of a TTL check, status is one of passing, warning or critical
+func (c *Consul) UpdateTTL(checkID string, status string, output string) error {
+	body, err := json.Marshal(map[string]string{"Status": status, "Output": output})
+	if err != nil {
+		return err
+	}
+	return c.put("/v1/agent/check/update/"+url.PathEscape(checkID), body)
+}
+
+// PutKV stores a value under key
+func (c *Consul) PutKV(key string, value []byte) error {
+	return c.put("/v1/kv/"+strings.TrimPrefix(key, "/"), value)
+}
+
+// DeleteKV removes a key
+func (c *Consul) DeleteKV(key string) error {
+	resp, err := c.do(http.MethodDelete, "/v1/kv/"+strings.TrimPrefix(key, "/"), nil, nil, 0)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Consul DELETE %s returned %d", key, resp.StatusCode)
+	}
+	return nil
+}
+
+// GetKV reads a key, ErrKeyNotFound is returned when the key does not exist
+func (c *Consul) GetKV(key string) (*KVPair, error) {
+	pair, _, err := c.WatchKV(key, 0, 0)
+	return pair, err
+}
+
+// WatchKV does a blocking query on key, it returns when the key index is greater than
+// index or when wait expires, the returned index must be used for the next call
+func (c *Consul) WatchKV(key string, index uint64, wait time.Duration) (*KVPair, uint64, error) {
+	query := url.Values{}
+	timeout := time.Duration(0)
+	if index > 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", strconv.Itoa(int(wait.Seconds()))+"s")
+		// consul adds up to wait/16 jitter to the blocking time
+		timeout = wait + wait/16 + consulDefaultTimeout
+	}
+	resp, err := c.do(http.MethodGet, "/v1/kv/"+strings.TrimPrefix(key, "/"), query, nil, timeout)
+	if err != nil {
+		return nil, index, err
+	}
+	defer resp.Body.Close()
+	newindex, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	if newindex < 1 {
+		// Blocking queries return at once with index 0, keep the next call blocking
+		newindex = 1
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, newindex, ErrKeyNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, index, fmt.Errorf("Consul GET %s returned %d", key, resp.StatusCode)
+	}
+	var pairs []KVPair
+	if err := json.NewDecoder(resp.Body).Decode(&pairs); err != nil {
+		return nil, index, err
+	}
+	if len(pairs) == 0 {
+		return nil, newindex, ErrKeyNotFound
+	}
+	return &pairs[0], newindex, nil
+}
@@ -0,0 +1,212 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+package consul
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockAgent implements the subset of the consul agent API used by the client
+type mockAgent struct {
+	sync.Mutex
+	services map[string]Service
+	checks   map[string]string
+	kv       map[string][]byte
+	index    uint64
+	token    string
+}
+
+func newMockAgent(token string) (*mockAgent, *httptest.Server) {
+	m := &mockAgent{services: make(map[string]Service), checks: make(map[string]string), kv: make(map[string][]byte), index: 1, token: token}
+	return m, httptest.NewServer(m)
+}
+
+func (m *mockAgent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if m.token != "" && r.Header.Get("X-Consul-Token") != m.token {
+		http.Error(w, "ACL not found", http.StatusForbidden)
+		return
+	}
+	m.Lock()
+	defer m.Unlock()
+	path := r.URL.Path
+	switch {
+	case path == "/v1/agent/service/register" && r.Method == http.MethodPut:
+		var s Service
+		if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		m.services[s.ID] = s
+		if s.Check != nil {
+			m.checks[s.Check.CheckID] = HealthCritical
+		}
+	case strings.HasPrefix(path, "/v1/agent/service/deregister/") && r.Method == http.MethodPut:
+		id := strings.TrimPrefix(path, "/v1/agent/service/deregister/")
+		if _, ok := m.services[id]; !ok {
+			http.Error(w, "Unknown service", http.StatusNotFound)
+			return
+		}
+		delete(m.services, id)
+	case strings.HasPrefix(path, "/v1/agent/check/update/") && r.Method == http.MethodPut:
+		id := strings.TrimPrefix(path, "/v1/agent/check/update/")
+		if _, ok := m.checks[id]; !ok {
+			http.Error(w, "Unknown check", http.StatusNotFound)
+			return
+		}
+		var upd map[string]string
+		json.NewDecoder(r.Body).Decode(&upd)
+		m.checks[id] = upd["Status"]
+	case strings.HasPrefix(path, "/v1/kv/"):
+		key := strings.TrimPrefix(path, "/v1/kv/")
+		switch r.Method {
+		case http.MethodPut:
+			b, _ := io.ReadAll(r.Body)
+			m.kv[key] = b
+			m.index++
+		case http.MethodDelete:
+			delete(m.kv, key)
+			m.index++
+		case http.MethodGet:
+			w.Header().Set("X-Consul-Index", strconv.FormatUint(m.index, 10))
+			v, ok := m.kv[key]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode([]KVPair{{Key: key, Value: v, ModifyIndex: m.index}})
+		}
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
+}
+
+func TestNewConsulAddrs(t *testing.T) {
+	c := NewConsul("127.0.0.1, consul:8501,https://secure:443/,[::1]", "", "", "")
+	expected := []string{"http://127.0.0.1:8500", "http://consul:8501", "https://secure:443", "http://[::1]:8500"}
+	if len(c.Addrs) != len(expected) {
+		t.Fatalf("Expected %d addresses got %v", len(expected), c.Addrs)
+	}
+	for i := range expected {
+		if c.Addrs[i] != expected[i] {
+			t.Errorf("Address %d expected %s got %s", i, expected[i], c.Addrs[i])
+		}
+	}
+}
+
+func TestServiceRegistration(t *testing.T) {
+	m, ts := newMockAgent("secret")
+	defer ts.Close()
+	c := NewConsul(ts.URL, "secret", "", "")
+
+	err := c.RegisterService(&Service{ID: "db_c1_1", Name: "db_c1", Tags: []string{"master"}, Address: "10.0.0.1", Port: 3306, Check: &Check{CheckID: "db_c1_1_health", TTL: "30s"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.services["db_c1_1"].Tags[0] != "master" {
+		t.Errorf("Service not registered with tags %v", m.services["db_c1_1"])
+	}
+	if err := c.UpdateTTL("db_c1_1_health", HealthPassing, "Master"); err != nil {
+		t.Fatal(err)
+	}
+	if m.checks["db_c1_1_health"] != HealthPassing {
+		t.Errorf("Expected passing check got %s", m.checks["db_c1_1_health"])
+	}
+	if err := c.UpdateTTL("unknown", HealthPassing, ""); err == nil {
+		t.Error("Expected error updating unknown check")
+	}
+	if err := c.DeregisterService("db_c1_1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.services) != 0 {
+		t.Errorf("Service not deregistered")
+	}
+
+	bad := NewConsul(ts.URL, "wrong", "", "")
+	if err := bad.RegisterService(&Service{ID: "x", Name: "x"}); err == nil {
+		t.Error("Expected ACL error with a wrong token")
+	}
+}
+
+func TestKV(t *testing.T) {
+	_, ts := newMockAgent("")
+	defer ts.Close()
+	// first address is unreachable, client must fall back to the next one
+	c := NewConsul("127.0.0.1:1,"+ts.URL, "", "", "")
+
+	if _, err := c.GetKV("repman/c1/master"); err != ErrKeyNotFound {
+		t.Fatalf("Expected key not found got %v", err)
+	}
+	if err := c.PutKV("repman/c1/master", []byte("10.0.0.1:3306")); err != nil {
+		t.Fatal(err)
+	}
+	pair, err := c.GetKV("repman/c1/master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(pair.Value) != "10.0.0.1:3306" {
+		t.Errorf("Unexpected value %s", pair.Value)
+	}
+	if err := c.DeleteKV("repman/c1/master"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetKV("repman/c1/master"); err != ErrKeyNotFound {
+		t.Errorf("Expected key deleted got %v", err)
+	}
+}
+
+func TestWatchKV(t *testing.T) {
+	_, ts := newMockAgent("")
+	defer ts.Close()
+	c := NewConsul(ts.URL, "", "", "")
+	_, index, err := c.WatchKV("repman/c1/switchover", 0, 0)
+	if err != ErrKeyNotFound || index == 0 {
+		t.Fatalf("Expected key not found with an index got %d %v", index, err)
+	}
+	c.PutKV("repman/c1/switchover", []byte("db2:3306"))
+	pair, newindex, err := c.WatchKV("repman/c1/switchover", index, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newindex <= index {
+		t.Errorf("Expected index to move forward %d <= %d", newindex, index)
+	}
+	if string(pair.Value) != "db2:3306" {
+		t.Errorf("Unexpected value %s", pair.Value)
+	}
+}
+
+func TestWatchKVBlocksWithoutIndex(t *testing.T) {
+	var query []string
+	var mu sync.Mutex
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		query = append(query, r.URL.RawQuery)
+		mu.Unlock()
+		// agent behind a proxy stripping X-Consul-Index
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+	c := NewConsul(ts.URL, "", "", "")
+	_, index, err := c.WatchKV("repman/c1/switchover", 0, time.Second)
+	if err != ErrKeyNotFound || index != 1 {
+		t.Fatalf("Expected key not found with index 1 got %d %v", index, err)
+	}
+	c.WatchKV("repman/c1/switchover", index, time.Second)
+	mu.Lock()
+	defer mu.Unlock()
+	if len(query) != 2 || !strings.Contains(query[1], "index=1") || !strings.Contains(query[1], "wait=1s") {
+		t.Errorf("Expected the second watch to be a blocking query, got %v", query)
+	}
+}
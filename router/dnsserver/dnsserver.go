@@ -0,0 +1,185 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+// dnsserver.go
+
+package dnsserver
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Backend is a database server published behind a service name
+type Backend struct {
+	Id   string
+	Host string
+	Port int
+}
+
+// ServicesFunc returns the current backends of each service label, it is called on every
+// query so that answers always reflect the monitored topology
+type ServicesFunc func() map[string][]Backend
+
+// Server is an authoritative DNS server for a single zone
+type Server struct {
+	Domain   string
+	TTL      uint32
+	Services ServicesFunc
+	Resolve  func(host string) ([]net.IP, error)
+	udp      *dns.Server
+	tcp      *dns.Server
+}
+
+// NewServer returns a server for domain, answers are given with ttl seconds
+func NewServer(domain string, ttl uint32, services ServicesFunc) *Server {
+	return &Server{
+		Domain:   dns.Fqdn(strings.ToLower(domain)),
+		TTL:      ttl,
+		Services: services,
+		Resolve:  net.LookupIP,
+	}
+}
+
+// ListenAndServe starts the UDP and TCP listeners on addr, it blocks until one of them fails
+func (s *Server) ListenAndServe(addr string) error {
+	s.udp = &dns.Server{Addr: addr, Net: "udp", Handler: s}
+	s.tcp = &dns.Server{Addr: addr, Net: "tcp", Handler: s}
+	errc := make(chan error, 2)
+	go func() { errc <- s.udp.ListenAndServe() }()
+	go func() { errc <- s.tcp.ListenAndServe() }()
+	return <-errc
+}
+
+// Shutdown stops the listeners
+func (s *Server) Shutdown() {
+	if s.udp != nil {
+		s.udp.Shutdown()
+	}
+	if s.tcp != nil {
+		s.tcp.Shutdown()
+	}
+}
+
+func (s *Server) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	w.WriteMsg(s.Answer(r))
+}
+
+func (s *Server) soa() dns.RR {
+	return &dns.SOA{
+		Hdr:     dns.RR_Header{Name: s.Domain, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: s.TTL},
+		Ns:      "ns." + s.Domain,
+		Mbox:    "hostmaster." + s.Domain,
+		Serial:  uint32(time.Now().Unix()),
+		Refresh: 60,
+		Retry:   10,
+		Expire:  600,
+		Minttl:  s.TTL,
+	}
+}
+
+func (s *Server) resolve(host string) []net.IP {
+	if ip := net.ParseIP(strings.Trim(host, "[]")); ip != nil {
+		return []net.IP{ip}
+	}
+	ips, err := s.Resolve(host)
+	if err != nil {
+		return nil
+	}
+	return ips
+}
+
+func (s *Server) addressRecords(name string, qtype uint16, host string) []dns.RR {
+	var rrs []dns.RR
+	for _, ip := range s.resolve(host) {
+		if ip4 := ip.To4(); ip4 != nil && (qtype == dns.TypeA || qtype == dns.TypeANY) {
+			rrs = append(rrs, &dns.A{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: s.TTL}, A: ip4})
+		} else if ip.To4() == nil && (qtype == dns.TypeAAAA || qtype == dns.TypeANY) {
+			rrs = append(rrs, &dns.AAAA{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: s.TTL}, AAAA: ip})
+		}
+	}
+	return rrs
+}
+
+// Answer builds the response for a query, it is exported to be tested without network
+func (s *Server) Answer(r *dns.Msg) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	if len(r.Question) != 1 {
+		m.Rcode = dns.RcodeFormatError
+		return m
+	}
+	q := r.Question[0]
+	name := strings.ToLower(q.Name)
+	if !dns.IsSubDomain(s.Domain, name) {
+		m.Rcode = dns.RcodeRefused
+		return m
+	}
+	m.Authoritative = true
+	if name == s.Domain {
+		if q.Qtype == dns.TypeSOA || q.Qtype == dns.TypeANY {
+			m.Answer = append(m.Answer, s.soa())
+		} else {
+			m.Ns = append(m.Ns, s.soa())
+		}
+		return m
+	}
+	labels := dns.SplitDomainName(strings.TrimSuffix(name, "."+s.Domain))
+	// _mysql._tcp.<service> style SRV names
+	if len(labels) == 3 && strings.HasPrefix(labels[0], "_") && strings.HasPrefix(labels[1], "_") {
+		labels = labels[2:]
+	}
+	if len(labels) != 1 {
+		m.Rcode = dns.RcodeNameError
+		m.Ns = append(m.Ns, s.soa())
+		return m
+	}
+	label := labels[0]
+	services := s.Services()
+	for svc, backends := range services {
+		if strings.ToLower(svc) != label {
+			continue
+		}
+		for _, b := range backends {
+			switch q.Qtype {
+			case dns.TypeSRV:
+				target := strings.ToLower(b.Id) + "." + s.Domain
+				m.Answer = append(m.Answer, &dns.SRV{
+					Hdr:      dns.RR_Header{Name: q.Name, Rrtype: dns.TypeSRV, Class: dns.ClassINET, Ttl: s.TTL},
+					Priority: 0,
+					Weight:   10,
+					Port:     uint16(b.Port),
+					Target:   target,
+				})
+				m.Extra = append(m.Extra, s.addressRecords(target, dns.TypeANY, b.Host)...)
+			default:
+				m.Answer = append(m.Answer, s.addressRecords(q.Name, q.Qtype, b.Host)...)
+			}
+		}
+		if len(m.Answer) == 0 {
+			m.Ns = append(m.Ns, s.soa())
+		}
+		return m
+	}
+	// SRV targets resolve to their backend address
+	for _, backends := range services {
+		for _, b := range backends {
+			if strings.ToLower(b.Id) == label {
+				m.Answer = append(m.Answer, s.addressRecords(q.Name, q.Qtype, b.Host)...)
+				if len(m.Answer) == 0 {
+					m.Ns = append(m.Ns, s.soa())
+				}
+				return m
+			}
+		}
+	}
+	m.Rcode = dns.RcodeNameError
+	m.Ns = append(m.Ns, s.soa())
+	return m
+}
@@ -0,0 +1,111 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+package dnsserver
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func newTestServer(services map[string][]Backend) *Server {
+	s := NewServer("Repman.Local", 1, func() map[string][]Backend { return services })
+	s.Resolve = func(host string) ([]net.IP, error) {
+		switch host {
+		case "db1":
+			return []net.IP{net.ParseIP("10.0.0.1")}, nil
+		case "db2":
+			return []net.IP{net.ParseIP("10.0.0.2"), net.ParseIP("fd00::2")}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+	return s
+}
+
+func query(s *Server, name string, qtype uint16) *dns.Msg {
+	r := new(dns.Msg)
+	r.SetQuestion(name, qtype)
+	return s.Answer(r)
+}
+
+func TestAnswerA(t *testing.T) {
+	services := map[string][]Backend{
+		"c1-rw": {{Id: "db1", Host: "db1", Port: 3306}},
+		"c1-ro": {{Id: "db2", Host: "db2", Port: 3306}, {Id: "db3", Host: "10.0.0.3", Port: 3307}},
+	}
+	s := newTestServer(services)
+
+	m := query(s, "c1-rw.repman.local.", dns.TypeA)
+	if !m.Authoritative || m.Rcode != dns.RcodeSuccess || len(m.Answer) != 1 {
+		t.Fatalf("Unexpected answer %v", m)
+	}
+	if a := m.Answer[0].(*dns.A); !a.A.Equal(net.ParseIP("10.0.0.1")) || a.Hdr.Ttl != 1 {
+		t.Errorf("Unexpected A record %v", a)
+	}
+
+	m = query(s, "C1-RO.repman.local.", dns.TypeA)
+	if len(m.Answer) != 2 {
+		t.Errorf("Expected 2 A records for ro got %v", m.Answer)
+	}
+	m = query(s, "c1-ro.repman.local.", dns.TypeAAAA)
+	if len(m.Answer) != 1 {
+		t.Errorf("Expected 1 AAAA record for ro got %v", m.Answer)
+	}
+
+	// RW flips as soon as the services callback returns a new master
+	services["c1-rw"] = []Backend{{Id: "db2", Host: "db2", Port: 3306}}
+	m = query(s, "c1-rw.repman.local.", dns.TypeA)
+	if len(m.Answer) != 1 || !m.Answer[0].(*dns.A).A.Equal(net.ParseIP("10.0.0.2")) {
+		t.Errorf("RW did not flip %v", m.Answer)
+	}
+}
+
+func TestAnswerSRV(t *testing.T) {
+	s := newTestServer(map[string][]Backend{
+		"c1-ro": {{Id: "db2", Host: "db2", Port: 3306}, {Id: "db3", Host: "10.0.0.3", Port: 3307}},
+	})
+	for _, name := range []string{"c1-ro.repman.local.", "_mysql._tcp.c1-ro.repman.local."} {
+		m := query(s, name, dns.TypeSRV)
+		if len(m.Answer) != 2 {
+			t.Fatalf("Expected 2 SRV records for %s got %v", name, m.Answer)
+		}
+		srv := m.Answer[1].(*dns.SRV)
+		if srv.Port != 3307 || srv.Target != "db3.repman.local." {
+			t.Errorf("Unexpected SRV record %v", srv)
+		}
+		if len(m.Extra) != 3 {
+			t.Errorf("Expected glue records got %v", m.Extra)
+		}
+	}
+	m := query(s, "db3.repman.local.", dns.TypeA)
+	if len(m.Answer) != 1 || !m.Answer[0].(*dns.A).A.Equal(net.ParseIP("10.0.0.3")) {
+		t.Errorf("SRV target not resolved %v", m.Answer)
+	}
+}
+
+func TestAnswerErrors(t *testing.T) {
+	s := newTestServer(map[string][]Backend{"c1-rw": {}})
+	m := query(s, "www.example.com.", dns.TypeA)
+	if m.Rcode != dns.RcodeRefused {
+		t.Errorf("Expected refused outside zone got %s", dns.RcodeToString[m.Rcode])
+	}
+	m = query(s, "unknown.repman.local.", dns.TypeA)
+	if m.Rcode != dns.RcodeNameError || len(m.Ns) != 1 {
+		t.Errorf("Expected NXDOMAIN with SOA got %v", m)
+	}
+	// no master, the name exists but has no data
+	m = query(s, "c1-rw.repman.local.", dns.TypeA)
+	if m.Rcode != dns.RcodeSuccess || len(m.Answer) != 0 || len(m.Ns) != 1 {
+		t.Errorf("Expected NODATA got %v", m)
+	}
+	m = query(s, "repman.local.", dns.TypeSOA)
+	if len(m.Answer) != 1 {
+		t.Errorf("Expected SOA at apex got %v", m)
+	}
+}
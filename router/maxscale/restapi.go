@@ -0,0 +1,482 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+// restapi.go
+
+package maxscale
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	restDefaultPort = "8989"
+
+	ServerStateMaster      = "master"
+	ServerStateSlave       = "slave"
+	ServerStateRunning     = "running"
+	ServerStateMaintenance = "maintenance"
+	ServerStateDrain       = "drain"
+)
+
+// RestAPI is a client of the MaxScale REST API, available since MaxScale 2.1 and the only
+// administrative interface since maxadmin and maxinfo were removed
+type RestAPI struct {
+	URL        string
+	User       string
+	Pass       string
+	HTTPClient *http.Client
+}
+
+// RestRelationship links a resource to other resources by id and type
+type RestRelationship struct {
+	Data []RestResourceId `json:"data"`
+}
+
+type RestResourceId struct {
+	Id   string `json:"id"`
+	Type string `json:"type"`
+}
+
+type RestServer struct {
+	Id         string `json:"id"`
+	Type       string `json:"type"`
+	Attributes struct {
+		State      string                 `json:"state"`
+		Parameters map[string]interface{} `json:"parameters"`
+		Statistics RestServerStatistics   `json:"statistics"`
+	} `json:"attributes"`
+	Relationships map[string]RestRelationship `json:"relationships,omitempty"`
+}
+
+type RestServerStatistics struct {
+	Connections      int   `json:"connections"`
+	TotalConnections int   `json:"total_connections"`
+	ActiveOperations int   `json:"active_operations"`
+	RoutedPackets    int64 `json:"routed_packets"`
+}
+
+type RestMonitor struct {
+	Id         string `json:"id"`
+	Type       string `json:"type"`
+	Attributes struct {
+		Module     string                 `json:"module"`
+		State      string                 `json:"state"`
+		Parameters map[string]interface{} `json:"parameters"`
+	} `json:"attributes"`
+	Relationships map[string]RestRelationship `json:"relationships,omitempty"`
+}
+
+type RestService struct {
+	Id         string `json:"id"`
+	Type       string `json:"type"`
+	Attributes struct {
+		Router     string                 `json:"router"`
+		State      string                 `json:"state"`
+		Parameters map[string]interface{} `json:"parameters"`
+		Statistics RestServiceStatistics  `json:"statistics"`
+	} `json:"attributes"`
+	Relationships map[string]RestRelationship `json:"relationships,omitempty"`
+}
+
+type RestServiceStatistics struct {
+	Connections      int `json:"connections"`
+	TotalConnections int `json:"total_connections"`
+	ActiveOperations int `json:"active_operations"`
+}
+
+type RestListener struct {
+	Id         string `json:"id"`
+	Type       string `json:"type"`
+	Attributes struct {
+		State      string                 `json:"state"`
+		Parameters map[string]interface{} `json:"parameters"`
+	} `json:"attributes"`
+	Relationships map[string]RestRelationship `json:"relationships,omitempty"`
+}
+
+// restResource is the JSON API document used to create or alter an object
+type restResource struct {
+	Id            string                      `json:"id"`
+	Type          string                      `json:"type"`
+	Attributes    map[string]interface{}      `json:"attributes,omitempty"`
+	Relationships map[string]RestRelationship `json:"relationships,omitempty"`
+}
+
+type restError struct {
+	Errors []struct {
+		Detail string `json:"detail"`
+	} `json:"errors"`
+}
+
+// NewRestAPI returns a client for the REST API listening on host:port
+func NewRestAPI(host string, port string, user string, pass string, https bool, skipVerify bool) *RestAPI {
+	if port == "" {
+		port = restDefaultPort
+	}
+	scheme := "http"
+	client := &http.Client{Timeout: maxDefaultTimeout}
+	if https {
+		scheme = "https"
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: skipVerify}}
+	}
+	if strings.Contains(host, ":") && !strings.HasPrefix(host, "[") {
+		host = "[" + host + "]"
+	}
+	return &RestAPI{URL: scheme + "://" + host + ":" + port, User: user, Pass: pass, HTTPClient: client}
+}
+
+func (m *RestAPI) request(method string, path string, in interface{}, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(map[string]interface{}{"data": in})
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, m.URL+path, body)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(m.User, m.Pass)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := m.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		var rerr restError
+		if json.Unmarshal(data, &rerr) == nil && len(rerr.Errors) > 0 {
+			return fmt.Errorf("MaxScale %s %s returned %d: %s", method, path, resp.StatusCode, rerr.Errors[0].Detail)
+		}
+		return fmt.Errorf("MaxScale %s %s returned %d", method, path, resp.StatusCode)
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	doc := struct {
+		Data json.RawMessage `json:"data"`
+	}{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	return json.Unmarshal(doc.Data, out)
+}
+
+// GetVersion returns the MaxScale version
+func (m *RestAPI) GetVersion() (string, error) {
+	var res struct {
+		Attributes struct {
+			Version string `json:"version"`
+		} `json:"attributes"`
+	}
+	err := m.request(http.MethodGet, "/v1/maxscale", nil, &res)
+	return res.Attributes.Version, err
+}
+
+func (m *RestAPI) ListServers() ([]RestServer, error) {
+	var res []RestServer
+	err := m.request(http.MethodGet, "/v1/servers", nil, &res)
+	return res, err
+}
+
+func (m *RestAPI) GetServer(name string) (RestServer, error) {
+	var res RestServer
+	err := m.request(http.MethodGet, "/v1/servers/"+url.PathEscape(name), nil, &res)
+	return res, err
+}
+
+// GetServerStatistics returns the routing statistics of a server
+func (m *RestAPI) GetServerStatistics(name string) (RestServerStatistics, error) {
+	srv, err := m.GetServer(name)
+	return srv.Attributes.Statistics, err
+}
+
+// CreateServer declares a backend server
+func (m *RestAPI) CreateServer(name string, address string, port int) error {
+	return m.request(http.MethodPost, "/v1/servers", restResource{
+		Id:   name,
+		Type: "servers",
+		Attributes: map[string]interface{}{
+			"parameters": map[string]interface{}{"address": address, "port": port},
+		},
+	}, nil)
+}
+
+func (m *RestAPI) DestroyServer(name string) error {
+	return m.request(http.MethodDelete, "/v1/servers/"+url.PathEscape(name)+"?force=yes", nil, nil)
+}
+
+// SetServer sets a state flag on a server, state is one of master, slave, running, maintenance, drain
+func (m *RestAPI) SetServer(name string, state string) error {
+	return m.request(http.MethodPut, "/v1/servers/"+url.PathEscape(name)+"/set?state="+url.QueryEscape(state), nil, nil)
+}
+
+// ClearServer removes a state flag from a server
+func (m *RestAPI) ClearServer(name string, state string) error {
+	return m.request(http.MethodPut, "/v1/servers/"+url.PathEscape(name)+"/clear?state="+url.QueryEscape(state), nil, nil)
+}
+
+// FindServer returns the name of the server matching address and port, port is ignored
+// when matchport is false
+func (m *RestAPI) FindServer(servers []RestServer, address string, port string, matchport bool) (RestServer, bool) {
+	for _, s := range servers {
+		saddr := fmt.Sprint(s.Attributes.Parameters["address"])
+		sport := fmt.Sprint(s.Attributes.Parameters["port"])
+		if saddr == address && (sport == port || !matchport) {
+			return s, true
+		}
+	}
+	return RestServer{}, false
+}
+
+func (m *RestAPI) ListMonitors() ([]RestMonitor, error) {
+	var res []RestMonitor
+	err := m.request(http.MethodGet, "/v1/monitors", nil, &res)
+	return res, err
+}
+
+// GetRunningMonitor returns the name of the first running monitor
+func (m *RestAPI) GetRunningMonitor() (string, error) {
+	monitors, err := m.ListMonitors()
+	if err != nil {
+		return "", err
+	}
+	for _, mon := range monitors {
+		if mon.Attributes.State == "Running" {
+			return mon.Id, nil
+		}
+	}
+	return "", nil
+}
+
+func (m *RestAPI) StopMonitor(name string) error {
+	return m.request(http.MethodPut, "/v1/monitors/"+url.PathEscape(name)+"/stop", nil, nil)
+}
+
+func (m *RestAPI) StartMonitor(name string) error {
+	return m.request(http.MethodPut, "/v1/monitors/"+url.PathEscape(name)+"/start", nil, nil)
+}
+
+func (m *RestAPI) ListServices() ([]RestService, error) {
+	var res []RestService
+	err := m.request(http.MethodGet, "/v1/services", nil, &res)
+	return res, err
+}
+
+func (m *RestAPI) GetService(name string) (RestService, error) {
+	var res RestService
+	err := m.request(http.MethodGet, "/v1/services/"+url.PathEscape(name), nil, &res)
+	return res, err
+}
+
+// GetServiceStatistics returns the client statistics of a service
+func (m *RestAPI) GetServiceStatistics(name string) (RestServiceStatistics, error) {
+	srv, err := m.GetService(name)
+	return srv.Attributes.Statistics, err
+}
+
+func serverRelationship(servers []string) map[string]RestRelationship {
+	rel := RestRelationship{Data: []RestResourceId{}}
+	for _, s := range servers {
+		rel.Data = append(rel.Data, RestResourceId{Id: s, Type: "servers"})
+	}
+	return map[string]RestRelationship{"servers": rel}
+}
+
+// CreateService creates a service using router with the given parameters routing to servers
+func (m *RestAPI) CreateService(name string, router string, parameters map[string]interface{}, servers []string) error {
+	return m.request(http.MethodPost, "/v1/services", restResource{
+		Id:            name,
+		Type:          "services",
+		Attributes:    map[string]interface{}{"router": router, "parameters": parameters},
+		Relationships: serverRelationship(servers),
+	}, nil)
+}
+
+// AlterService updates the parameters of a service and the servers it routes to, nil
+// values are left untouched
+func (m *RestAPI) AlterService(name string, parameters map[string]interface{}, servers []string) error {
+	res := restResource{Id: name, Type: "services"}
+	if parameters != nil {
+		res.Attributes = map[string]interface{}{"parameters": parameters}
+	}
+	if servers != nil {
+		res.Relationships = serverRelationship(servers)
+	}
+	return m.request(http.MethodPatch, "/v1/services/"+url.PathEscape(name), res, nil)
+}
+
+func (m *RestAPI) ListListeners() ([]RestListener, error) {
+	var res []RestListener
+	err := m.request(http.MethodGet, "/v1/listeners", nil, &res)
+	return res, err
+}
+
+// CreateListener creates a listener on port for service
+func (m *RestAPI) CreateListener(name string, service string, port int) error {
+	return m.request(http.MethodPost, "/v1/listeners", restResource{
+		Id:   name,
+		Type: "listeners",
+		Attributes: map[string]interface{}{
+			"parameters": map[string]interface{}{"port": port, "protocol": "mariadbclient"},
+		},
+		Relationships: map[string]RestRelationship{"services": {Data: []RestResourceId{{Id: service, Type: "services"}}}},
+	}, nil)
+}
+
+// AlterListener updates listener parameters
+func (m *RestAPI) AlterListener(name string, parameters map[string]interface{}) error {
+	return m.request(http.MethodPatch, "/v1/listeners/"+url.PathEscape(name), restResource{
+		Id:         name,
+		Type:       "listeners",
+		Attributes: map[string]interface{}{"parameters": parameters},
+	}, nil)
+}
+
+// BootstrapServer is a database server of the topology to declare in MaxScale
+type BootstrapServer struct {
+	Name     string
+	Address  string
+	Port     int
+	IsMaster bool
+	IsSlave  bool
+	IsMaint  bool
+}
+
+// BootstrapService is a service and its listener to declare in MaxScale
+type BootstrapService struct {
+	Name       string
+	Router     string
+	Parameters map[string]interface{}
+	Port       int
+}
+
+// Bootstrap declares the servers, services and listeners of a topology and stops any running
+// monitor, server states are then set from the topology as replication-manager fully drives them
+func (m *RestAPI) Bootstrap(servers []BootstrapServer, services []BootstrapService) error {
+	existing, err := m.ListServers()
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, s := range servers {
+		names = append(names, s.Name)
+		found := false
+		for _, e := range existing {
+			if e.Id == s.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			if err := m.CreateServer(s.Name, s.Address, s.Port); err != nil {
+				return err
+			}
+		}
+	}
+	monitors, err := m.ListMonitors()
+	if err != nil {
+		return err
+	}
+	for _, mon := range monitors {
+		if mon.Attributes.State == "Running" {
+			if err := m.StopMonitor(mon.Id); err != nil {
+				return err
+			}
+		}
+	}
+	currentServices, err := m.ListServices()
+	if err != nil {
+		return err
+	}
+	listeners, err := m.ListListeners()
+	if err != nil {
+		return err
+	}
+	for _, svc := range services {
+		found := false
+		for _, e := range currentServices {
+			if e.Id == svc.Name {
+				found = true
+				break
+			}
+		}
+		if found {
+			err = m.AlterService(svc.Name, nil, names)
+		} else {
+			err = m.CreateService(svc.Name, svc.Router, svc.Parameters, names)
+		}
+		if err != nil {
+			return err
+		}
+		lname := svc.Name + "-listener"
+		found = false
+		for _, l := range listeners {
+			if l.Id == lname {
+				found = true
+				if fmt.Sprint(l.Attributes.Parameters["port"]) != strconv.Itoa(svc.Port) {
+					if err := m.AlterListener(lname, map[string]interface{}{"port": svc.Port}); err != nil {
+						return err
+					}
+				}
+				break
+			}
+		}
+		if !found {
+			if err := m.CreateListener(lname, svc.Name, svc.Port); err != nil {
+				return err
+			}
+		}
+	}
+	for _, s := range servers {
+		if err := m.SyncServerState(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SyncServerState sets and clears state flags so that MaxScale matches the topology
+func (m *RestAPI) SyncServerState(s BootstrapServer) error {
+	flags := []struct {
+		state string
+		set   bool
+	}{
+		{ServerStateMaintenance, s.IsMaint},
+		{ServerStateMaster, s.IsMaster},
+		{ServerStateSlave, s.IsSlave},
+		{ServerStateRunning, s.IsMaster || s.IsSlave},
+	}
+	for _, f := range flags {
+		var err error
+		if f.set {
+			err = m.SetServer(s.Name, f.state)
+		} else {
+			err = m.ClearServer(s.Name, f.state)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
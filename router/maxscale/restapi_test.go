@@ -0,0 +1,205 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+package maxscale
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type recordedRequest struct {
+	Method string
+	Path   string
+	Body   map[string]interface{}
+}
+
+// fixtureServer replays the JSON responses recorded from a MaxScale 6 REST API in testdata
+// and records every write request
+type fixtureServer struct {
+	sync.Mutex
+	*httptest.Server
+	t        *testing.T
+	requests []recordedRequest
+}
+
+func newFixtureServer(t *testing.T) *fixtureServer {
+	f := &fixtureServer{t: t}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	return f
+}
+
+func (f *fixtureServer) serve(w http.ResponseWriter, r *http.Request) {
+	if user, pass, ok := r.BasicAuth(); !ok || user != "admin" || pass != "mariadb" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodGet {
+		rec := recordedRequest{Method: r.Method, Path: r.URL.RequestURI()}
+		if b, _ := io.ReadAll(r.Body); len(b) > 0 {
+			if err := json.Unmarshal(b, &rec.Body); err != nil {
+				f.t.Errorf("Invalid JSON body for %s %s: %s", r.Method, r.URL, err)
+			}
+		}
+		f.Lock()
+		f.requests = append(f.requests, rec)
+		f.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	data, err := os.ReadFile("testdata/" + parts[1] + ".json")
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if len(parts) == 3 {
+		// single resource, extract it from the recorded collection
+		var doc struct {
+			Data []json.RawMessage `json:"data"`
+		}
+		json.Unmarshal(data, &doc)
+		for _, raw := range doc.Data {
+			var id struct {
+				Id string `json:"id"`
+			}
+			json.Unmarshal(raw, &id)
+			if id.Id == parts[2] {
+				data, _ = json.Marshal(map[string]json.RawMessage{"data": raw})
+				w.Write(data)
+				return
+			}
+		}
+		data, _ = os.ReadFile("testdata/error.json")
+		w.WriteHeader(http.StatusNotFound)
+	}
+	w.Write(data)
+}
+
+func (f *fixtureServer) client() *RestAPI {
+	m := NewRestAPI("127.0.0.1", "1", "admin", "mariadb", false, false)
+	m.URL = f.URL
+	return m
+}
+
+func TestRestAPIRead(t *testing.T) {
+	f := newFixtureServer(t)
+	defer f.Close()
+	m := f.client()
+
+	version, err := m.GetVersion()
+	if err != nil || version != "6.4.1" {
+		t.Errorf("Unexpected version %s %v", version, err)
+	}
+	servers, err := m.ListServers()
+	if err != nil || len(servers) != 2 {
+		t.Fatalf("Unexpected servers %v %v", servers, err)
+	}
+	srv, ok := m.FindServer(servers, "10.0.0.2", "3306", true)
+	if !ok || srv.Id != "db2" || srv.Attributes.State != "Slave, Running" {
+		t.Errorf("Unexpected server %v", srv)
+	}
+	if _, ok := m.FindServer(servers, "10.0.0.2", "3307", true); ok {
+		t.Errorf("Server found with wrong port")
+	}
+	stats, err := m.GetServerStatistics("db1")
+	if err != nil || stats.Connections != 12 || stats.RoutedPackets != 48211 {
+		t.Errorf("Unexpected server statistics %v %v", stats, err)
+	}
+	if _, err := m.GetServer("db9"); err == nil || !strings.Contains(err.Error(), "Can't find server 'db9'") {
+		t.Errorf("Expected not found error got %v", err)
+	}
+	monitor, err := m.GetRunningMonitor()
+	if err != nil || monitor != "MariaDB-Monitor" {
+		t.Errorf("Unexpected monitor %s %v", monitor, err)
+	}
+	svc, err := m.GetServiceStatistics("Write-Service")
+	if err != nil || svc.TotalConnections != 1802 {
+		t.Errorf("Unexpected service statistics %v %v", svc, err)
+	}
+
+	m.Pass = "wrong"
+	if _, err := m.ListServers(); err == nil {
+		t.Errorf("Expected authentication error")
+	}
+}
+
+func TestRestAPIBootstrap(t *testing.T) {
+	f := newFixtureServer(t)
+	defer f.Close()
+	m := f.client()
+
+	servers := []BootstrapServer{
+		{Name: "db1", Address: "10.0.0.1", Port: 3306, IsMaster: true},
+		{Name: "db3", Address: "10.0.0.3", Port: 3306, IsSlave: true},
+	}
+	services := []BootstrapService{
+		{Name: "Write-Service", Router: "readconnroute", Parameters: map[string]interface{}{"router_options": "master"}, Port: 3306},
+		{Name: "Read-Service", Router: "readconnroute", Parameters: map[string]interface{}{"router_options": "slave"}, Port: 3307},
+	}
+	if err := m.Bootstrap(servers, services); err != nil {
+		t.Fatalf("Bootstrap failed %s", err)
+	}
+	want := []struct {
+		method string
+		path   string
+	}{
+		{"POST", "/v1/servers"},
+		{"PUT", "/v1/monitors/MariaDB-Monitor/stop"},
+		{"PATCH", "/v1/services/Write-Service"},
+		{"PATCH", "/v1/listeners/Write-Service-listener"},
+		{"POST", "/v1/services"},
+		{"POST", "/v1/listeners"},
+		{"PUT", "/v1/servers/db1/clear?state=maintenance"},
+		{"PUT", "/v1/servers/db1/set?state=master"},
+		{"PUT", "/v1/servers/db1/clear?state=slave"},
+		{"PUT", "/v1/servers/db1/set?state=running"},
+		{"PUT", "/v1/servers/db3/clear?state=maintenance"},
+		{"PUT", "/v1/servers/db3/clear?state=master"},
+		{"PUT", "/v1/servers/db3/set?state=slave"},
+		{"PUT", "/v1/servers/db3/set?state=running"},
+	}
+	if len(f.requests) != len(want) {
+		t.Fatalf("Expected %d requests got %d: %v", len(want), len(f.requests), f.requests)
+	}
+	for i, w := range want {
+		if f.requests[i].Method != w.method || f.requests[i].Path != w.path {
+			t.Errorf("Request %d expected %s %s got %s %s", i, w.method, w.path, f.requests[i].Method, f.requests[i].Path)
+		}
+	}
+
+	// only the missing server is created
+	data := f.requests[0].Body["data"].(map[string]interface{})
+	if data["id"] != "db3" {
+		t.Errorf("Unexpected server created %v", data)
+	}
+	// existing service is linked to all topology servers
+	data = f.requests[2].Body["data"].(map[string]interface{})
+	rel := data["relationships"].(map[string]interface{})["servers"].(map[string]interface{})["data"].([]interface{})
+	if len(rel) != 2 || rel[1].(map[string]interface{})["id"] != "db3" {
+		t.Errorf("Unexpected service relationships %v", rel)
+	}
+	// listener port drift is corrected
+	data = f.requests[3].Body["data"].(map[string]interface{})
+	if port := data["attributes"].(map[string]interface{})["parameters"].(map[string]interface{})["port"]; port != float64(3306) {
+		t.Errorf("Unexpected listener port %v", port)
+	}
+	data = f.requests[4].Body["data"].(map[string]interface{})
+	if data["id"] != "Read-Service" || data["attributes"].(map[string]interface{})["router"] != "readconnroute" {
+		t.Errorf("Unexpected service created %v", data)
+	}
+	data = f.requests[5].Body["data"].(map[string]interface{})
+	svc := data["relationships"].(map[string]interface{})["services"].(map[string]interface{})["data"].([]interface{})
+	if data["id"] != "Read-Service-listener" || svc[0].(map[string]interface{})["id"] != "Read-Service" {
+		t.Errorf("Unexpected listener created %v", data)
+	}
+}
@@ -43,6 +43,14 @@ type StatsQueryDigest struct {
 	MaxTime     uint64 `json:"maxTime" db:"max_time"`
 }
 
+// runtime_mysql_servers
+type Server struct {
+	Hostgroup string `json:"hostgroup" db:"hostgroup_id"`
+	Host      string `json:"host" db:"hostname"`
+	Port      string `json:"port" db:"port"`
+	Status    string `json:"status" db:"status"`
+}
+
 type QueryRule struct {
 	Id                   uint32         `json:"ruleId" db:"rule_id"`
 	Active               int            `json:"active" db:"active"`
@@ -309,6 +317,18 @@ func (psql *ProxySQL) GetHostsRuntime() (string, error) {
 	return h, err
 }
 
+func (psql *ProxySQL) GetServersRuntime() ([]Server, error) {
+	servers := []Server{}
+	err := psql.Connection.Select(&servers, "SELECT hostgroup_id, hostname, port, status FROM runtime_mysql_servers")
+	return servers, err
+}
+
+func (psql *ProxySQL) GetUsersRuntime() ([]string, error) {
+	users := []string{}
+	err := psql.Connection.Select(&users, "SELECT DISTINCT username FROM runtime_mysql_users WHERE frontend=1")
+	return users, err
+}
+
 func (psql *ProxySQL) AddUser(User string, Password string) error {
 	_, err := psql.Connection.Exec("REPLACE INTO mysql_users(username,password,default_hostgroup) VALUES('" + User + "','" + Password + "','" + psql.WriterHG + "')")
 	if err != nil {
@@ -318,6 +338,15 @@ func (psql *ProxySQL) AddUser(User string, Password string) error {
 	return err
 }
 
+func (psql *ProxySQL) DeleteUser(User string) error {
+	_, err := psql.Connection.Exec("DELETE FROM mysql_users WHERE username='" + User + "'")
+	if err != nil {
+		return err
+	}
+	err = psql.LoadUsersToRuntime()
+	return err
+}
+
 func (psql *ProxySQL) GetQueryRulesRuntime() ([]QueryRule, error) {
 	rules := []QueryRule{}
 	query := "select rule_id,active,username,schemaname,digest,match_digest,match_pattern, destination_hostgroup,mirror_hostgroup,multiplex,apply from runtime_mysql_query_rules"
@@ -348,6 +377,21 @@ func (psql *ProxySQL) AddQueryRules(rules []QueryRule) error {
 	return err
 }
 
+func (psql *ProxySQL) DeleteQueryRules() error {
+	_, err := psql.Connection.Exec("DELETE FROM mysql_query_rules")
+	return err
+}
+
+func (psql *ProxySQL) DeleteQueryRule(id uint32) error {
+	_, err := psql.Connection.Exec("DELETE FROM mysql_query_rules WHERE rule_id=?", id)
+	return err
+}
+
+func (psql *ProxySQL) SaveQueryRulesToDisk() error {
+	_, err := psql.Connection.Exec("SAVE MYSQL QUERY RULES TO DISK")
+	return err
+}
+
 func (psql *ProxySQL) LoadQueryRulesToRuntime() error {
 	query := "LOAD MYSQL QUERY RULES TO RUNTIME"
 	_, err := psql.Connection.Exec(query)
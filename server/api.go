@@ -188,6 +188,7 @@ func (repman *ReplicationManager) apiserver() {
 	//PUBLIC ENDPOINTS
 	router := mux.NewRouter()
 
+	router.Use(repman.auditMiddleware)
 	router.Use(repman.RecoveryMiddleware)
 	//router.HandleFunc("/", repman.handlerApp)
 	// page to view which does not need authorization
@@ -290,6 +291,22 @@ func (repman *ReplicationManager) apiserver() {
 	repman.apiClusterUnprotectedHandler(router)
 	repman.apiClusterProtectedHandler(router)
 	repman.apiProxyProtectedHandler(router)
+	repman.apiAuditProtectedHandler(router)
+	repman.apiRBACProtectedHandler(router)
+	repman.apiDBUsersProtectedHandler(router)
+	repman.apiSecurityAuditProtectedHandler(router)
+	repman.apiTokenProtectedHandler(router)
+	repman.apiApprovalProtectedHandler(router)
+	repman.apiStagingProtectedHandler(router)
+	repman.apiUpgradeProtectedHandler(router)
+	repman.apiDelayedProtectedHandler(router)
+	repman.apiErrantProtectedHandler(router)
+	repman.apiConsistencyProtectedHandler(router)
+	repman.apiWsrepProtectedHandler(router)
+	repman.apiGroupReplicationProtectedHandler(router)
+	repman.apiChannelProtectedHandler(router)
+	repman.apiPlaybookProtectedHandler(router)
+	repman.apiRouter = router
 
 	tlsConfig := Repmanv3TLS{
 		Enabled: false,
@@ -318,12 +335,19 @@ func (repman *ReplicationManager) apiserver() {
 		}
 	}
 
-	if repman.Conf.MonitoringSSLCert != "" {
+	if repman.Conf.APIHttpsACME {
+		log.Info("Starting HTTPS & JWT API with ACME certificate on " + repman.Conf.APIBind + ":" + repman.Conf.APIPort)
+		tlsConfig, err = repman.getAPIACMETLS()
+		if err != nil {
+			log.Errorf("JWT API can't start with ACME: %s", err)
+			return
+		}
+	} else if repman.Conf.MonitoringSSLCert != "" {
 		log.Info("Starting HTTPS & JWT API on " + repman.Conf.APIBind + ":" + repman.Conf.APIPort)
-		tlsConfig = Repmanv3TLS{
-			Enabled:            true,
-			CertificatePath:    repman.Conf.MonitoringSSLCert,
-			CertificateKeyPath: repman.Conf.MonitoringSSLKey,
+		tlsConfig, err = repman.getAPIFileTLS()
+		if err != nil {
+			log.Errorf("JWT API can't load TLS certificate: %s", err)
+			return
 		}
 	} else {
 		log.Info("Starting HTTP & JWT API on " + repman.Conf.APIBind + ":" + repman.Conf.APIPort)
@@ -361,6 +385,10 @@ func (repman *ReplicationManager) handleOriginValidator(origin string) bool {
 }
 
 func (repman *ReplicationManager) isValidRequest(r *http.Request) (bool, error) {
+	if isAPITokenRequest(r) {
+		_, err := repman.getAPITokenFromRequest(r)
+		return err == nil, err
+	}
 
 	_, err := request.ParseFromRequest(r, request.AuthorizationHeaderExtractor, func(token *jwt.Token) (interface{}, error) {
 		vk, _ := jwt.ParseRSAPublicKeyFromPEM(verificationKey)
@@ -373,6 +401,17 @@ func (repman *ReplicationManager) isValidRequest(r *http.Request) (bool, error)
 }
 
 func (repman *ReplicationManager) IsValidClusterACL(r *http.Request, cluster *cluster.Cluster) (bool, string) {
+	if op, ok := repman.getApprovalReplay(r); ok {
+		return op.Cluster == cluster.Name, op.Requester
+	}
+	if isAPITokenRequest(r) {
+		tok, err := repman.getAPITokenFromRequest(r)
+		if err != nil || !tok.AllowsCluster(cluster.Name) {
+			return false, tok.User()
+		}
+		cluster.SetAPITokenUser(tok.User(), tok.Grants)
+		return cluster.IsValidACL(tok.User(), "", r.URL.Path, "token"), tok.User()
+	}
 
 	token, err := request.ParseFromRequest(r, request.AuthorizationHeaderExtractor, func(token *jwt.Token) (interface{}, error) {
 		vk, _ := jwt.ParseRSAPublicKeyFromPEM(verificationKey)
@@ -392,6 +431,9 @@ func (repman *ReplicationManager) IsValidClusterACL(r *http.Request, cluster *cl
 				return cluster.IsValidACL(meuser, mepwd, r.URL.Path, "oidc"), meuser
 			}
 		}
+		if auth, _ := mycutinfo["Auth"].(string); auth == "ldap" {
+			return cluster.IsValidACL(meuser, mepwd, r.URL.Path, "ldap"), meuser
+		}
 		return cluster.IsValidACL(meuser, mepwd, r.URL.Path, "password"), meuser
 	}
 	return false, ""
@@ -420,6 +462,17 @@ func (repman *ReplicationManager) DecryptJWTPassword(r *http.Request) (string, e
 
 func (repman *ReplicationManager) GetJWTClaims(r *http.Request) (map[string]string, error) {
 	UserInfoMap := make(map[string]string)
+	if isAPITokenRequest(r) {
+		tok, err := repman.getAPITokenFromRequest(r)
+		if err != nil {
+			return nil, err
+		}
+		UserInfoMap["User"] = tok.User()
+		UserInfoMap["Role"] = "Member"
+		UserInfoMap["Password"] = ""
+		UserInfoMap["Auth"] = "token"
+		return UserInfoMap, nil
+	}
 	token, err := request.ParseFromRequest(r, request.AuthorizationHeaderExtractor, func(token *jwt.Token) (interface{}, error) {
 		vk, _ := jwt.ParseRSAPublicKeyFromPEM(verificationKey)
 		return vk, nil
@@ -441,12 +494,24 @@ func (repman *ReplicationManager) GetJWTClaims(r *http.Request) (map[string]stri
 			return nil, fmt.Errorf("invalid oauth provider")
 		}
 		UserInfoMap["User"] = mycutinfo["Name"].(string)
+		if auth, ok := mycutinfo["Auth"].(string); ok {
+			UserInfoMap["Auth"] = auth
+		}
 		return UserInfoMap, nil
 	}
 	return nil, err
 }
 
 func (repman *ReplicationManager) GetUserFromRequest(r *http.Request) string {
+	if op, ok := repman.getApprovalReplay(r); ok {
+		return op.Requester
+	}
+	if isAPITokenRequest(r) {
+		if tok, err := repman.getAPITokenFromRequest(r); err == nil {
+			return tok.User()
+		}
+		return ""
+	}
 
 	token, err := request.ParseFromRequest(r, request.AuthorizationHeaderExtractor, func(token *jwt.Token) (interface{}, error) {
 		vk, _ := jwt.ParseRSAPublicKeyFromPEM(verificationKey)
@@ -556,6 +621,18 @@ func (repman *ReplicationManager) loginHandler(w http.ResponseWriter, r *http.Re
 			}{user.Username, "Member", repman.Conf.GetEncryptedString(user.Password)}
 		}
 
+		// Fall back on the directory only for users not defined locally, a refused local
+		// password is never rescued by a directory account of the same name
+		if !loggedIn && repman.Conf.APILDAPURL != "" && !repman.isLocalAPIUser(user.Username) && repman.loginLDAP(user.Username, user.Password) {
+			loggedIn = true
+			userInfo = struct {
+				Name     string
+				Role     string
+				Password string
+				Auth     string
+			}{user.Username, "Member", "", "ldap"}
+		}
+
 		if !loggedIn {
 			http.Error(w, "Error logging in: Invalid credentials", http.StatusUnauthorized)
 			return
@@ -1167,6 +1244,19 @@ func (repman *ReplicationManager) handlerMuxClusterSubscribe(w http.ResponseWrit
 
 func (repman *ReplicationManager) validateTokenMiddleware(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if _, ok := repman.getApprovalReplay(r); ok {
+		next(w, r)
+		return
+	}
+	if isAPITokenRequest(r) {
+		if _, err := repman.getAPITokenFromRequest(r); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, "Unauthorised access to this resource: "+err.Error())
+			return
+		}
+		next(w, r)
+		return
+	}
 	//validate token
 	token, err := request.ParseFromRequest(r, request.AuthorizationHeaderExtractor,
 		func(token *jwt.Token) (interface{}, error) {
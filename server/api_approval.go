@@ -0,0 +1,208 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/codegangsta/negroni"
+	"github.com/gorilla/mux"
+	"github.com/signal18/replication-manager/utils/approval"
+)
+
+func (repman *ReplicationManager) apiApprovalProtectedHandler(router *mux.Router) {
+	router.Handle("/api/clusters/{clusterName}/approvals", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxApprovals)),
+	))
+	router.Handle("/api/clusters/{clusterName}/approvals/{id}", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxApproval)),
+	))
+	router.Handle("/api/clusters/{clusterName}/approvals/{id}/actions/approve", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxApprovalApprove)),
+	))
+	router.Handle("/api/clusters/{clusterName}/approvals/{id}/actions/reject", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxApprovalReject)),
+	))
+}
+
+func writeApprovalJSON(w http.ResponseWriter, v interface{}) {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "\t")
+	err := e.Encode(v)
+	if err != nil {
+		http.Error(w, "Encoding error for operations", 500)
+		return
+	}
+}
+
+func approvalErrorCode(err error) int {
+	switch err {
+	case approval.ErrNotFound:
+		return 404
+	case approval.ErrSameUser:
+		return 403
+	}
+	return 409
+}
+
+// handlerMuxApprovals lists the operations of the cluster.
+// @Summary Operations waiting for approval for a specific cluster
+// @Description This endpoint returns the pending operations and the history of approved, rejected and expired ones, newest first.
+// @Tags Approvals
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Success 200 {array} approval.Operation "Operations"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 500 {string} string "No cluster"
+// @Router /api/clusters/{clusterName}/approvals [get]
+func (repman *ReplicationManager) handlerMuxApprovals(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		repman.expireApprovals()
+		writeApprovalJSON(w, repman.approvals.List(mycluster.Name))
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+// handlerMuxApproval returns an operation, the requester can follow its own operation.
+// @Summary Operation waiting for approval
+// @Description This endpoint returns an operation with its status and the result of its execution.
+// @Tags Approvals
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Param id path string true "Operation ID"
+// @Success 200 {object} approval.Operation "Operation"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 404 {string} string "Operation not found"
+// @Failure 500 {string} string "No cluster"
+// @Router /api/clusters/{clusterName}/approvals/{id} [get]
+func (repman *ReplicationManager) handlerMuxApproval(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		valid, user := repman.IsValidClusterACL(r, mycluster)
+		repman.expireApprovals()
+		op, err := repman.approvals.Get(vars["id"])
+		if err != nil || op.Cluster != mycluster.Name {
+			http.Error(w, approval.ErrNotFound.Error(), 404)
+			return
+		}
+		if !valid && (user == "" || user != op.Requester) {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		writeApprovalJSON(w, op)
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+// handlerMuxApprovalApprove approves an operation and runs it.
+// @Summary Approve an operation
+// @Description This endpoint approves a pending operation requested by another user, the approver and the requester must be different users and not use each other API tokens, the operation then runs with the authority of the server on behalf of its requester. Follow the result on the operation.
+// @Tags Approvals
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Param id path string true "Operation ID"
+// @Success 200 {object} approval.Operation "Approved operation"
+// @Failure 403 {string} string "No valid ACL or same user"
+// @Failure 404 {string} string "Operation not found"
+// @Failure 409 {string} string "Operation is not pending or expired"
+// @Failure 500 {string} string "No cluster"
+// @Router /api/clusters/{clusterName}/approvals/{id}/actions/approve [post]
+func (repman *ReplicationManager) handlerMuxApprovalApprove(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		valid, user := repman.IsValidClusterACL(r, mycluster)
+		if !valid || user == "" {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		if op, err := repman.approvals.Get(vars["id"]); err != nil || op.Cluster != mycluster.Name {
+			http.Error(w, approval.ErrNotFound.Error(), 404)
+			return
+		}
+		op, err := repman.approvals.Approve(vars["id"], user, repman.getRequestOwner(r, user), time.Now())
+		repman.writeApprovalRecord(op, "approve", user, err)
+		if err != nil {
+			http.Error(w, err.Error(), approvalErrorCode(err))
+			return
+		}
+		go repman.executeApproval(op)
+		writeApprovalJSON(w, op)
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+// handlerMuxApprovalReject rejects an operation, the requester can cancel its own operation.
+// @Summary Reject an operation
+// @Description This endpoint rejects a pending operation with an optional reason.
+// @Tags Approvals
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Param id path string true "Operation ID"
+// @Param reason query string false "Reason"
+// @Success 200 {object} approval.Operation "Rejected operation"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 404 {string} string "Operation not found"
+// @Failure 409 {string} string "Operation is not pending or expired"
+// @Failure 500 {string} string "No cluster"
+// @Router /api/clusters/{clusterName}/approvals/{id}/actions/reject [post]
+func (repman *ReplicationManager) handlerMuxApprovalReject(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		valid, user := repman.IsValidClusterACL(r, mycluster)
+		op, err := repman.approvals.Get(vars["id"])
+		if err != nil || op.Cluster != mycluster.Name {
+			http.Error(w, approval.ErrNotFound.Error(), 404)
+			return
+		}
+		if !valid && (user == "" || user != op.Requester) {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		op, err = repman.approvals.Reject(vars["id"], user, r.URL.Query().Get("reason"), time.Now())
+		repman.writeApprovalRecord(op, "reject", user, err)
+		if err != nil {
+			http.Error(w, err.Error(), approvalErrorCode(err))
+			return
+		}
+		writeApprovalJSON(w, op)
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
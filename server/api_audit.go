@@ -0,0 +1,196 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/codegangsta/negroni"
+	"github.com/gorilla/mux"
+	"github.com/signal18/replication-manager/cluster"
+	"github.com/signal18/replication-manager/utils/audit"
+)
+
+func (repman *ReplicationManager) apiAuditProtectedHandler(router *mux.Router) {
+	router.Handle("/api/audit", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxAudit)),
+	))
+	router.Handle("/api/audit/verify", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxAuditVerify)),
+	))
+	router.Handle("/api/clusters/{clusterName}/audit", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxClusterAudit)),
+	))
+}
+
+func getAuditFilter(r *http.Request) audit.Filter {
+	q := r.URL.Query()
+	filter := audit.Filter{
+		User:    q.Get("user"),
+		Cluster: q.Get("cluster"),
+		Action:  q.Get("action"),
+		Result:  q.Get("result"),
+		Limit:   100,
+	}
+	filter.Since, _ = strconv.ParseInt(q.Get("since"), 10, 64)
+	filter.Until, _ = strconv.ParseInt(q.Get("until"), 10, 64)
+	if limit, err := strconv.Atoi(q.Get("limit")); err == nil {
+		filter.Limit = limit
+	}
+	return filter
+}
+
+// getGlobalACLCluster returns the cluster used to check global grants like global settings do
+func (repman *ReplicationManager) getGlobalACLCluster() *cluster.Cluster {
+	for _, v := range repman.Clusters {
+		if v != nil {
+			return v
+		}
+	}
+	return nil
+}
+
+func (repman *ReplicationManager) writeAuditRecords(w http.ResponseWriter, filter audit.Filter) {
+	records, err := repman.auditLog.Query(filter)
+	if err != nil {
+		http.Error(w, "Could not read audit log: "+err.Error(), 500)
+		return
+	}
+	e := json.NewEncoder(w)
+	e.SetIndent("", "\t")
+	err = e.Encode(records)
+	if err != nil {
+		http.Error(w, "Encoding error for audit records", 500)
+		return
+	}
+}
+
+// handlerMuxAudit returns the audit records of all clusters.
+// @Summary Retrieve audit records
+// @Description This endpoint returns the most recent audit records matching the filters, in chronological order.
+// @Tags Audit
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param user query string false "User"
+// @Param cluster query string false "Cluster Name"
+// @Param action query string false "Action substring"
+// @Param result query string false "success or failure"
+// @Param since query int false "Unix time lower bound"
+// @Param until query int false "Unix time upper bound"
+// @Param limit query int false "Maximum number of records, default 100, 0 for all"
+// @Success 200 {array} audit.Record "Audit records"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 500 {string} string "No cluster"
+// @Failure 501 {string} string "Audit log is not enabled"
+// @Router /api/audit [get]
+func (repman *ReplicationManager) handlerMuxAudit(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	mycluster := repman.getGlobalACLCluster()
+	if mycluster == nil {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+	if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+		http.Error(w, "No valid ACL", 403)
+		return
+	}
+	if repman.auditLog == nil {
+		http.Error(w, "Audit log is not enabled", 501)
+		return
+	}
+	repman.writeAuditRecords(w, getAuditFilter(r))
+}
+
+// handlerMuxAuditVerify checks the hash chain of the audit log.
+// @Summary Verify the audit log
+// @Description This endpoint walks the audit log and reports the first record breaking the hash chain.
+// @Tags Audit
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Success 200 {object} audit.VerifyResult "Verification result"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 500 {string} string "No cluster"
+// @Failure 501 {string} string "Audit log is not enabled"
+// @Router /api/audit/verify [get]
+func (repman *ReplicationManager) handlerMuxAuditVerify(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	mycluster := repman.getGlobalACLCluster()
+	if mycluster == nil {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+	if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+		http.Error(w, "No valid ACL", 403)
+		return
+	}
+	if repman.auditLog == nil {
+		http.Error(w, "Audit log is not enabled", 501)
+		return
+	}
+	res, err := repman.auditLog.Verify()
+	if err != nil {
+		http.Error(w, "Could not read audit log: "+err.Error(), 500)
+		return
+	}
+	if !res.Valid {
+		repman.Logrus.Errorf("Audit log %s is corrupted: %s", repman.auditLog.Path(), res.Error)
+	}
+	e := json.NewEncoder(w)
+	e.SetIndent("", "\t")
+	err = e.Encode(res)
+	if err != nil {
+		http.Error(w, "Encoding error for audit verification", 500)
+		return
+	}
+}
+
+// handlerMuxClusterAudit returns the audit records of a cluster.
+// @Summary Retrieve audit records for a specific cluster
+// @Description This endpoint returns the most recent audit records of the cluster matching the filters, in chronological order.
+// @Tags Audit
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Param user query string false "User"
+// @Param action query string false "Action substring"
+// @Param result query string false "success or failure"
+// @Param since query int false "Unix time lower bound"
+// @Param until query int false "Unix time upper bound"
+// @Param limit query int false "Maximum number of records, default 100, 0 for all"
+// @Success 200 {array} audit.Record "Audit records"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 500 {string} string "No cluster"
+// @Failure 501 {string} string "Audit log is not enabled"
+// @Router /api/clusters/{clusterName}/audit [get]
+func (repman *ReplicationManager) handlerMuxClusterAudit(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster == nil {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+	if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+		http.Error(w, "No valid ACL", 403)
+		return
+	}
+	if repman.auditLog == nil {
+		http.Error(w, "Audit log is not enabled", 501)
+		return
+	}
+	filter := getAuditFilter(r)
+	filter.Cluster = mycluster.Name
+	repman.writeAuditRecords(w, filter)
+}
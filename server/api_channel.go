@@ -0,0 +1,202 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/codegangsta/negroni"
+	"github.com/gorilla/mux"
+	"github.com/signal18/replication-manager/cluster"
+)
+
+func (repman *ReplicationManager) apiChannelProtectedHandler(router *mux.Router) {
+	router.Handle("/api/clusters/{clusterName}/servers/{serverName}/channels", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxServerChannels)),
+	))
+	router.Handle("/api/clusters/{clusterName}/servers/{serverName}/channels/actions/add/{channelName}/{sourceClusterName}", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxServerChannelAdd)),
+	))
+	router.Handle("/api/clusters/{clusterName}/servers/{serverName}/channels/{channelName}/actions/{action}", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxServerChannelAction)),
+	))
+}
+
+// handlerMuxServerChannels returns the replication channels of a server.
+// @Summary Replication channels of a server
+// @Description This endpoint returns each named replication connection with its source cluster, threads, delay, GTID positions and last errors.
+// @Tags DatabaseReplication
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Param serverName path string true "Server Name"
+// @Success 200 {array} cluster.ReplicationChannel "Replication channels"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 500 {string} string "Cluster Not Found" or "Server Not Found"
+// @Router /api/clusters/{clusterName}/servers/{serverName}/channels [get]
+func (repman *ReplicationManager) handlerMuxServerChannels(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		node := mycluster.GetServerFromName(vars["serverName"])
+		if node == nil {
+			http.Error(w, "Server Not Found", 500)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err := e.Encode(node.GetReplicationChannels())
+		if err != nil {
+			http.Error(w, "Encoding error for replication channels", 500)
+			return
+		}
+	} else {
+		http.Error(w, "Cluster Not Found", 500)
+		return
+	}
+}
+
+// handlerMuxServerChannelAdd adds a replication channel from the master of another cluster.
+// @Summary Add a replication channel
+// @Description This endpoint creates a named replication connection on the server pointing to the master of the source cluster with its replication user, using GTID when available, and starts it. The user needs the replication grant on both clusters.
+// @Tags DatabaseReplication
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Param serverName path string true "Server Name"
+// @Param channelName path string true "Channel Name"
+// @Param sourceClusterName path string true "Source Cluster Name"
+// @Success 200 {array} cluster.ReplicationChannel "Replication channels"
+// @Failure 400 {string} string "Invalid replication channel name"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 409 {string} string "Replication channel already exists"
+// @Failure 500 {string} string "Cluster Not Found" or "Source Cluster Not Found" or "Server Not Found"
+// @Router /api/clusters/{clusterName}/servers/{serverName}/channels/actions/add/{channelName}/{sourceClusterName} [post]
+func (repman *ReplicationManager) handlerMuxServerChannelAdd(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		source := repman.getClusterByName(vars["sourceClusterName"])
+		if source == nil {
+			http.Error(w, "Source Cluster Not Found", 500)
+			return
+		}
+		// the channel uses the replication credentials of the source cluster, check the
+		// same route on the source cluster
+		sr := r.Clone(r.Context())
+		sr.URL.Path = strings.Replace(r.URL.Path, "/api/clusters/"+mycluster.Name+"/", "/api/clusters/"+source.Name+"/", 1)
+		if valid, _ := repman.IsValidClusterACL(sr, source); !valid {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		node := mycluster.GetServerFromName(vars["serverName"])
+		if node == nil {
+			http.Error(w, "Server Not Found", 500)
+			return
+		}
+		err := node.AddReplicationChannel(vars["channelName"], vars["sourceClusterName"])
+		if !repman.writeChannelError(w, err) {
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err = e.Encode(node.GetReplicationChannels())
+		if err != nil {
+			http.Error(w, "Encoding error for replication channels", 500)
+			return
+		}
+	} else {
+		http.Error(w, "Cluster Not Found", 500)
+		return
+	}
+}
+
+// handlerMuxServerChannelAction removes, stops, starts or skips an event on a replication channel.
+// @Summary Manage a replication channel
+// @Description remove stops and resets the channel, stop pauses it, start resumes it, skip skips the next replicated event of the channel. The default channel of the cluster topology is refused.
+// @Tags DatabaseReplication
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Param serverName path string true "Server Name"
+// @Param channelName path string true "Channel Name"
+// @Param action path string true "Action" Enums(remove, stop, start, skip)
+// @Success 200 {string} string "Done"
+// @Failure 400 {string} string "Unknown action"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 404 {string} string "Replication channel not found"
+// @Failure 500 {string} string "Cluster Not Found" or "Server Not Found"
+// @Router /api/clusters/{clusterName}/servers/{serverName}/channels/{channelName}/actions/{action} [post]
+func (repman *ReplicationManager) handlerMuxServerChannelAction(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		node := mycluster.GetServerFromName(vars["serverName"])
+		if node == nil {
+			http.Error(w, "Server Not Found", 500)
+			return
+		}
+		var err error
+		switch vars["action"] {
+		case "remove":
+			err = node.RemoveReplicationChannel(vars["channelName"])
+		case "stop":
+			err = node.StopReplicationChannel(vars["channelName"])
+		case "start":
+			err = node.StartReplicationChannel(vars["channelName"])
+		case "skip":
+			err = node.SkipReplicationChannelEvent(vars["channelName"])
+		default:
+			http.Error(w, "Unknown action", 400)
+			return
+		}
+		repman.writeChannelError(w, err)
+	} else {
+		http.Error(w, "Cluster Not Found", 500)
+		return
+	}
+}
+
+// writeChannelError maps channel errors to http status, it returns false when an error was written
+func (repman *ReplicationManager) writeChannelError(w http.ResponseWriter, err error) bool {
+	switch err {
+	case nil:
+		return true
+	case cluster.ErrChannelName, cluster.ErrChannelDefault, cluster.ErrChannelSameCluster:
+		http.Error(w, err.Error(), 400)
+	case cluster.ErrChannelNotFound:
+		http.Error(w, err.Error(), 404)
+	case cluster.ErrChannelExists:
+		http.Error(w, err.Error(), 409)
+	default:
+		http.Error(w, err.Error(), 500)
+	}
+	return false
+}
@@ -71,6 +71,14 @@ func (repman *ReplicationManager) apiClusterProtectedHandler(router *mux.Router)
 		negroni.HandlerFunc(repman.validateTokenMiddleware),
 		negroni.Wrap(http.HandlerFunc(repman.handlerMuxClusterCertificates)),
 	))
+	router.Handle("/api/clusters/{clusterName}/certificates-expiry", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxClusterCertificatesExpiry)),
+	))
+	router.Handle("/api/clusters/{clusterName}/vault-secrets", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxClusterVaultSecrets)),
+	))
 
 	router.Handle("/api/clusters/{clusterName}/queryrules", negroni.New(
 		negroni.HandlerFunc(repman.validateTokenMiddleware),
@@ -162,12 +170,17 @@ func (repman *ReplicationManager) apiClusterProtectedHandler(router *mux.Router)
 	))
 	router.Handle("/api/clusters/{clusterName}/actions/failover", negroni.New(
 		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.HandlerFunc(repman.approvalMiddleware("failover")),
 		negroni.Wrap(http.HandlerFunc(repman.handlerMuxFailover)),
 	))
 	router.Handle("/api/clusters/{clusterName}/actions/certificates-rotate", negroni.New(
 		negroni.HandlerFunc(repman.validateTokenMiddleware),
 		negroni.Wrap(http.HandlerFunc(repman.handlerMuxRotateKeys)),
 	))
+	router.Handle("/api/clusters/{clusterName}/actions/certificates-renew", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxRenewCertificates)),
+	))
 	router.Handle("/api/clusters/{clusterName}/settings/actions/certificates-reload", negroni.New(
 		negroni.HandlerFunc(repman.validateTokenMiddleware),
 		negroni.Wrap(http.HandlerFunc(repman.handlerMuxClusterReloadCertificates)),
@@ -190,6 +203,7 @@ func (repman *ReplicationManager) apiClusterProtectedHandler(router *mux.Router)
 	))
 	router.Handle("/api/clusters/{clusterName}/services/actions/unprovision", negroni.New(
 		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.HandlerFunc(repman.approvalMiddleware("unprovision")),
 		negroni.Wrap(http.HandlerFunc(repman.handlerMuxServicesUnprovision)),
 	))
 	router.Handle("/api/clusters/{clusterName}/actions/cancel-rolling-restart", negroni.New(
@@ -238,11 +252,13 @@ func (repman *ReplicationManager) apiClusterProtectedHandler(router *mux.Router)
 
 	router.Handle("/api/clusters/{clusterName}/actions/dropserver/{host}/{port}", negroni.New(
 		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.HandlerFunc(repman.approvalMiddleware("dropserver")),
 		negroni.Wrap(http.HandlerFunc(repman.handlerMuxServerDrop)),
 	))
 
 	router.Handle("/api/clusters/{clusterName}/actions/dropserver/{host}/{port}/{type}", negroni.New(
 		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.HandlerFunc(repman.approvalMiddleware("dropserver")),
 		negroni.Wrap(http.HandlerFunc(repman.handlerMuxServerDrop)),
 	))
 
@@ -252,6 +268,7 @@ func (repman *ReplicationManager) apiClusterProtectedHandler(router *mux.Router)
 	))
 	router.Handle("/api/clusters/{clusterName}/actions/rotate-passwords", negroni.New(
 		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.HandlerFunc(repman.approvalMiddleware("rotate-passwords")),
 		negroni.Wrap(http.HandlerFunc(repman.handlerRotatePasswords)),
 	))
 
@@ -376,6 +393,10 @@ func (repman *ReplicationManager) apiClusterProtectedHandler(router *mux.Router)
 		negroni.HandlerFunc(repman.validateTokenMiddleware),
 		negroni.Wrap(http.HandlerFunc(repman.handlerMuxCrashes)),
 	))
+	router.Handle("/api/clusters/{clusterName}/topology/sites", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxSites)),
+	))
 	//PROTECTED ENDPOINTS FOR TESTS
 
 	router.Handle("/api/clusters/{clusterName}/tests/actions/run/all", negroni.New(
@@ -387,6 +408,11 @@ func (repman *ReplicationManager) apiClusterProtectedHandler(router *mux.Router)
 		negroni.Wrap(http.HandlerFunc(repman.handlerMuxOneTest)),
 	))
 
+	router.Handle("/api/clusters/{clusterName}/switchover-drain", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxSwitchoverDrain)),
+	))
+
 	// endpoint to fetch Cluster.DiffVariables
 	router.Handle("/api/clusters/{clusterName}/diffvariables", negroni.New(
 		negroni.HandlerFunc(repman.validateTokenMiddleware),
@@ -985,6 +1011,102 @@ func (repman *ReplicationManager) handlerMuxRotateKeys(w http.ResponseWriter, r
 	return
 }
 
+// @Summary Renew certificates for a specific cluster
+// @Description Renew the generated certificates of the specified cluster, regenerate the database and proxy configurations and reload the certificates one server at a time, slaves first
+// @Tags ClusterCertificates
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Success 200 {string} string "Certificates renewal started"
+// @Failure 400 {string} string "Certificates are provided by configuration and can not be renewed"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 500 {string} string "No cluster"
+// @Router /api/clusters/{clusterName}/actions/certificates-renew [post]
+func (repman *ReplicationManager) handlerMuxRenewCertificates(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster == nil {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+	if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+		http.Error(w, "No valid ACL", 403)
+		return
+	}
+	if !mycluster.IsUsingGeneratedCertificates() {
+		http.Error(w, "Certificates are provided by configuration and can not be renewed", 400)
+		return
+	}
+	go mycluster.RenewCertificates()
+	fmt.Fprint(w, "Certificates renewal started")
+}
+
+// @Summary Get certificates expiry for a specific cluster
+// @Description Get the expiry of the cluster, database, proxy and API certificates as seen by the last check
+// @Tags ClusterCertificates
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Success 200 {array} cluster.CertificateExpiry "Certificates expiry"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 500 {string} string "No cluster"
+// @Router /api/clusters/{clusterName}/certificates-expiry [get]
+func (repman *ReplicationManager) handlerMuxClusterCertificatesExpiry(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster == nil {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+	if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+		http.Error(w, "No valid ACL", 403)
+		return
+	}
+	list := mycluster.GetCertificatesExpiry()
+	if len(list) == 0 {
+		list = mycluster.ListCertificatesExpiry()
+	}
+	e := json.NewEncoder(w)
+	e.SetIndent("", "\t")
+	err := e.Encode(list)
+	if err != nil {
+		http.Error(w, "Encoding error for certificates expiry", 500)
+		return
+	}
+}
+
+// @Summary Get Vault secrets for a specific cluster
+// @Description Get the Vault paths used by the cluster with the lease of the credentials read from them, secret values are not returned
+// @Tags Cluster
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Success 200 {array} cluster.VaultSecret "Vault secrets"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 500 {string} string "No cluster"
+// @Router /api/clusters/{clusterName}/vault-secrets [get]
+func (repman *ReplicationManager) handlerMuxClusterVaultSecrets(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster == nil {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+	if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+		http.Error(w, "No valid ACL", 403)
+		return
+	}
+	e := json.NewEncoder(w)
+	e.SetIndent("", "\t")
+	err := e.Encode(mycluster.GetVaultSecrets())
+	if err != nil {
+		http.Error(w, "Encoding error for vault secrets", 500)
+		return
+	}
+}
+
 // @Summary Reset SLA for a specific cluster
 // @Description Reset the SLA for the specified cluster
 // @Tags ClusterActions
@@ -1861,6 +1983,32 @@ func (repman *ReplicationManager) switchClusterSettings(mycluster *cluster.Clust
 		mycluster.SwitchForceSlaveNoGtid()
 	case "switchover-lower-release":
 		mycluster.SwitchFailoverLowerRelease()
+	case "replication-delayed-electable":
+		mycluster.SwitchReplicationDelayedElectable()
+	case "failover-site-quorum":
+		mycluster.SwitchFailoverSiteQuorum()
+	case "consistency-check":
+		mycluster.SwitchConsistencyCheck()
+	case "consistency-check-resync":
+		mycluster.SwitchConsistencyCheckResync()
+	case "wsrep-recover-non-primary":
+		mycluster.SwitchWsrepRecoverNonPrimary()
+	case "wsrep-backup-desync":
+		mycluster.SwitchWsrepBackupDesync()
+	case "replication-multi-master-grouprep-rejoin":
+		mycluster.SwitchMultiMasterGrouprepRejoin()
+	case "replication-multisource-channel-repoint":
+		mycluster.SwitchReplicationMultisourceChannelRepoint()
+	case "replication-playbook":
+		mycluster.SwitchReplicationPlaybook()
+	case "switchover-drain":
+		mycluster.SwitchSwitchoverDrain()
+	case "switchover-drain-kill":
+		mycluster.SwitchSwitchoverDrainKill()
+	case "proxy-drift-check":
+		mycluster.SwitchProxyDriftCheck()
+	case "proxy-drift-remediate":
+		mycluster.SwitchProxyDriftRemediate()
 	case "failover-event-status":
 		mycluster.SwitchFailoverEventStatus()
 	case "failover-event-scheduler":
@@ -1922,6 +2070,8 @@ func (repman *ReplicationManager) switchClusterSettings(mycluster *cluster.Clust
 		mycluster.SwitchSchedulerDatabaseAnalyze()
 	case "scheduler-alert-disable":
 		mycluster.SwitchSchedulerAlertDisable()
+	case "scheduler-staging-refresh":
+		mycluster.SwitchSchedulerStagingRefresh()
 	case "graphite-metrics":
 		mycluster.SwitchGraphiteMetrics()
 	case "graphite-embedded":
@@ -2267,6 +2417,44 @@ func (repman *ReplicationManager) setClusterSetting(mycluster *cluster.Cluster,
 		mycluster.SetRplMaxDelay(val)
 	case "switchover-wait-route-change":
 		mycluster.SetSwitchoverWaitRouteChange(value)
+	case "switchover-drain-timeout":
+		mycluster.SetSwitchoverDrainTimeout(value)
+	case "db-servers-sites":
+		mycluster.SetDBServersSites(value)
+	case "monitoring-site":
+		mycluster.SetMonitoringSite(value)
+	case "failover-site-policy":
+		if err := mycluster.SetFailoverSitePolicy(value); err != nil {
+			return err
+		}
+	case "consistency-check-chunk-size":
+		mycluster.SetConsistencyCheckChunkSize(value)
+	case "consistency-check-chunk-rate":
+		mycluster.SetConsistencyCheckChunkRate(value)
+	case "consistency-check-max-lag":
+		mycluster.SetConsistencyCheckMaxLag(value)
+	case "consistency-check-interval":
+		mycluster.SetConsistencyCheckInterval(value)
+	case "wsrep-non-primary-timeout":
+		mycluster.SetWsrepNonPrimaryTimeout(value)
+	case "wsrep-flow-control-max-paused":
+		mycluster.SetWsrepFlowControlMaxPaused(value)
+	case "wsrep-sync-timeout":
+		mycluster.SetWsrepSyncTimeout(value)
+	case "replication-multi-master-grouprep-member-weights":
+		mycluster.SetMultiMasterGrouprepMemberWeights(value)
+	case "replication-multi-master-grouprep-rejoin-interval":
+		mycluster.SetMultiMasterGrouprepRejoinInterval(value)
+	case "replication-playbooks":
+		mycluster.SetReplicationPlaybooks(value)
+	case "replication-playbook-min-interval":
+		mycluster.SetReplicationPlaybookMinInterval(value)
+	case "replication-playbook-window":
+		mycluster.SetReplicationPlaybookWindow(value)
+	case "replication-playbook-approval-threshold":
+		mycluster.SetReplicationPlaybookApprovalThreshold(value)
+	case "replication-playbook-reseed-method":
+		mycluster.SetReplicationPlaybookReseedMethod(value)
 	case "failover-limit":
 		val, _ := strconv.Atoi(value)
 		mycluster.SetFailLimit(val)
@@ -2393,6 +2581,8 @@ func (repman *ReplicationManager) setClusterSetting(mycluster *cluster.Cluster,
 		mycluster.SetSchedulerJobsSshCron(value)
 	case "scheduler-alert-disable-cron":
 		mycluster.SetSchedulerAlertDisableCron(value)
+	case "scheduler-staging-refresh-cron":
+		mycluster.SetSchedulerStagingRefreshCron(value)
 	case "backup-binlogs-keep":
 		mycluster.SetBackupBinlogsKeep(value)
 	case "delay-stat-rotate":
@@ -3216,6 +3406,35 @@ func (repman *ReplicationManager) handlerMuxCrashes(w http.ResponseWriter, r *ht
 	}
 }
 
+// handlerMuxSites handles the retrieval of the sites health for a given cluster.
+// @Summary Retrieve sites health for a specific cluster
+// @Description This endpoint returns the failover site policy and, for each site of db-servers-sites, its servers up and failed, if it is reachable from this monitor and if it has quorum.
+// @Tags Cluster
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Success 200 {object} cluster.SiteStatus "Sites health"
+// @Failure 500 {string} string "Cluster Not Found"
+// @Router /api/clusters/{clusterName}/topology/sites [get]
+func (repman *ReplicationManager) handlerMuxSites(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err := e.Encode(mycluster.GetSites())
+		if err != nil {
+			log.Println("Error encoding JSON: ", err)
+			http.Error(w, "Encoding error", 500)
+			return
+		}
+	} else {
+		http.Error(w, "Cluster Not Found", 500)
+		return
+	}
+}
+
 // handlerMuxOneTest handles the execution of a specific test for a given cluster.
 // @Summary Run a specific test for a given cluster
 // @Description This endpoint runs a specific test for the specified cluster.
@@ -4075,6 +4294,39 @@ func (repman *ReplicationManager) handlerDiffVariables(w http.ResponseWriter, r
 	return
 }
 
+// handlerMuxSwitchoverDrain returns the progress of the last switchover drain.
+// @Summary Retrieve switchover drain progress for a specific cluster
+// @Description This endpoint returns the per client progress of the connection drain done on the old master during the last switchover.
+// @Tags Cluster
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Success 200 {object} cluster.DrainStatus "Switchover drain progress"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 500 {string} string "No cluster"
+// @Router /api/clusters/{clusterName}/switchover-drain [get]
+func (repman *ReplicationManager) handlerMuxSwitchoverDrain(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err := e.Encode(mycluster.GetSwitchoverDrain())
+		if err != nil {
+			http.Error(w, "Encoding error for switchover drain", 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
 // handlerRotatePasswords rotates the passwords for a given cluster.
 // @Summary Rotate passwords for a specific cluster
 // @Description This endpoint rotates the passwords for the specified cluster.
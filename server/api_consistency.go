@@ -0,0 +1,118 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/codegangsta/negroni"
+	"github.com/gorilla/mux"
+	"github.com/signal18/replication-manager/cluster"
+)
+
+func (repman *ReplicationManager) apiConsistencyProtectedHandler(router *mux.Router) {
+	router.Handle("/api/clusters/{clusterName}/consistency", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxConsistency)),
+	))
+	router.Handle("/api/clusters/{clusterName}/consistency/actions/{action}", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxConsistencyAction)),
+	))
+}
+
+// handlerMuxConsistency returns the consistency check progress and the divergent chunks.
+// @Summary Consistency check of a specific cluster
+// @Description This endpoint returns the progress of the chunk checksum pass, the skipped tables and the chunk ranges that differ between the master and each replica.
+// @Tags ClusterSchema
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Success 200 {object} cluster.ConsistencyStatus "Consistency status"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 500 {string} string "No cluster"
+// @Router /api/clusters/{clusterName}/consistency [get]
+func (repman *ReplicationManager) handlerMuxConsistency(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err := e.Encode(mycluster.GetConsistency())
+		if err != nil {
+			http.Error(w, "Encoding error for consistency", 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+// handlerMuxConsistencyAction starts, stops or resyncs the consistency check.
+// @Summary Start, stop or resync the consistency check
+// @Description start runs a checksum pass now, stop interrupts the running pass after the current chunk, resync replays the master rows of the divergent chunks to the replicas.
+// @Tags ClusterSchema
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Param action path string true "Action" Enums(start, stop, resync)
+// @Success 200 {object} cluster.ConsistencyStatus "Consistency status"
+// @Failure 400 {string} string "Unknown action"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 409 {string} string "A consistency check is already running"
+// @Failure 500 {string} string "No cluster"
+// @Router /api/clusters/{clusterName}/consistency/actions/{action} [post]
+func (repman *ReplicationManager) handlerMuxConsistencyAction(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		var err error
+		switch vars["action"] {
+		case cluster.ConsistencyActionStart:
+			err = mycluster.StartConsistencyCheck()
+		case cluster.ConsistencyActionStop:
+			mycluster.StopConsistencyCheck()
+		case cluster.ConsistencyActionResync:
+			err = mycluster.StartConsistencyResync()
+		default:
+			http.Error(w, "Unknown action", 400)
+			return
+		}
+		if err == cluster.ErrConsistencyRunning {
+			http.Error(w, err.Error(), 409)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err = e.Encode(mycluster.GetConsistency())
+		if err != nil {
+			http.Error(w, "Encoding error for consistency", 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
@@ -225,6 +225,7 @@ func (repman *ReplicationManager) apiDatabaseProtectedHandler(router *mux.Router
 	))
 	router.Handle("/api/clusters/{clusterName}/servers/{serverName}/actions/unprovision", negroni.New(
 		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.HandlerFunc(repman.approvalMiddleware("unprovision")),
 		negroni.Wrap(http.HandlerFunc(repman.handlerMuxServerUnprovision)),
 	))
 	router.Handle("/api/clusters/{clusterName}/servers/{serverName}/actions/provision", negroni.New(
@@ -333,10 +334,12 @@ func (repman *ReplicationManager) apiDatabaseProtectedHandler(router *mux.Router
 
 	router.Handle("/api/clusters/{clusterName}/servers/{serverName}/actions/reset-master", negroni.New(
 		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.HandlerFunc(repman.approvalMiddleware("reset-master")),
 		negroni.Wrap(http.HandlerFunc(repman.handlerMuxServerResetMaster)),
 	))
 	router.Handle("/api/clusters/{clusterName}/servers/{serverName}/actions/reset-slave-all", negroni.New(
 		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.HandlerFunc(repman.approvalMiddleware("reset-slave-all")),
 		negroni.Wrap(http.HandlerFunc(repman.handlerMuxServerResetSlaveAll)),
 	))
 	router.Handle("/api/clusters/{clusterName}/servers/{serverName}/actions/flush-logs", negroni.New(
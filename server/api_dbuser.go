@@ -0,0 +1,196 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/codegangsta/negroni"
+	"github.com/gorilla/mux"
+	"github.com/signal18/replication-manager/utils/dbuser"
+)
+
+// DBUserForm is a managed database user with an optional password
+type DBUserForm struct {
+	dbuser.User
+	Password string `json:"password"`
+}
+
+func (repman *ReplicationManager) apiDBUsersProtectedHandler(router *mux.Router) {
+	router.Handle("/api/clusters/{clusterName}/db-users", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxDBUsers)),
+	))
+	router.Handle("/api/clusters/{clusterName}/db-users/diff", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxDBUsersDiff)),
+	))
+	router.Handle("/api/clusters/{clusterName}/db-users/actions/apply", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxDBUsersApply)),
+	))
+	router.Handle("/api/clusters/{clusterName}/db-users/{userName}/actions/drop", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxDBUsersDrop)),
+	))
+}
+
+// handlerMuxDBUsers returns the managed database users on GET and creates or replaces one on POST.
+// @Summary Managed database users for a specific cluster
+// @Description GET returns the managed application users of the cluster without their passwords. POST creates or replaces a user and applies it on the master and ProxySQL, a password is generated for a new user when none is given.
+// @Tags DatabaseUsers
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Param user body DBUserForm false "User"
+// @Success 200 {array} cluster.DBUser "Managed users"
+// @Failure 400 {string} string "Error in request"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 500 {string} string "No cluster"
+// @Router /api/clusters/{clusterName}/db-users [get]
+// @Router /api/clusters/{clusterName}/db-users [post]
+func (repman *ReplicationManager) handlerMuxDBUsers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		if r.Method == http.MethodPost {
+			var form DBUserForm
+			err := json.NewDecoder(r.Body).Decode(&form)
+			if err != nil {
+				http.Error(w, "Error in request: "+err.Error(), 400)
+				return
+			}
+			err = mycluster.SetDBUser(form.User, form.Password)
+			if err != nil {
+				http.Error(w, err.Error(), 400)
+				return
+			}
+			fmt.Fprintf(w, "Database user %s saved", form.Name)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err := e.Encode(mycluster.GetDBUsers())
+		if err != nil {
+			http.Error(w, "Encoding error for database users", 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+// handlerMuxDBUsersDiff compares the managed database users with the servers and ProxySQL.
+// @Summary Drift of the managed database users for a specific cluster
+// @Description This endpoint compares the managed users with the users and grants found on every database server and in ProxySQL mysql_users.
+// @Tags DatabaseUsers
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Success 200 {array} cluster.DBUserDrift "Drifts"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 500 {string} string "No cluster"
+// @Router /api/clusters/{clusterName}/db-users/diff [get]
+func (repman *ReplicationManager) handlerMuxDBUsersDiff(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err := e.Encode(mycluster.GetDBUsersDiff())
+		if err != nil {
+			http.Error(w, "Encoding error for database users diff", 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+// handlerMuxDBUsersApply applies the managed database users.
+// @Summary Apply the managed database users
+// @Description This endpoint creates the missing users on the master, grants the missing privileges, revokes the extra ones and adds the users to ProxySQL.
+// @Tags DatabaseUsers
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Success 200 {string} string "Database users applied"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 500 {string} string "No cluster"
+// @Router /api/clusters/{clusterName}/db-users/actions/apply [post]
+func (repman *ReplicationManager) handlerMuxDBUsersApply(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		err := mycluster.ApplyDBUsers()
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		fmt.Fprint(w, "Database users applied")
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+// handlerMuxDBUsersDrop removes a managed database user.
+// @Summary Drop a managed database user
+// @Description This endpoint removes a user from the managed users, with drop=true the user is also dropped from the master and ProxySQL.
+// @Tags DatabaseUsers
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Param userName path string true "User Name"
+// @Param drop query bool false "Drop the user from the servers"
+// @Success 200 {string} string "Database user dropped"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 500 {string} string "No cluster"
+// @Router /api/clusters/{clusterName}/db-users/{userName}/actions/drop [post]
+func (repman *ReplicationManager) handlerMuxDBUsersDrop(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		err := mycluster.DropDBUser(vars["userName"], r.URL.Query().Get("drop") == "true")
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		fmt.Fprintf(w, "Database user %s dropped", vars["userName"])
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
@@ -0,0 +1,189 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/codegangsta/negroni"
+	"github.com/gorilla/mux"
+	"github.com/signal18/replication-manager/cluster"
+)
+
+func (repman *ReplicationManager) apiDelayedProtectedHandler(router *mux.Router) {
+	router.Handle("/api/clusters/{clusterName}/delayed-replicas", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxDelayedReplicas)),
+	))
+	router.Handle("/api/clusters/{clusterName}/servers/{serverName}/actions/delayed-pause", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxServerDelayedPause)),
+	))
+	router.Handle("/api/clusters/{clusterName}/servers/{serverName}/actions/delayed-resume", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxServerDelayedResume)),
+	))
+	router.Handle("/api/clusters/{clusterName}/servers/{serverName}/actions/delayed-fast-forward", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxServerDelayedFastForward)),
+	))
+}
+
+// handlerMuxDelayedReplicas returns the recovery window of the delayed replicas.
+// @Summary Delayed replicas of a specific cluster
+// @Description This endpoint returns every delayed replica with its replication threads, applied and retrieved GTID and the recovery window that can be reached with a fast-forward.
+// @Tags DatabaseReplication
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Success 200 {array} cluster.DelayedReplica "Delayed replicas"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 500 {string} string "No cluster"
+// @Router /api/clusters/{clusterName}/delayed-replicas [get]
+func (repman *ReplicationManager) handlerMuxDelayedReplicas(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err := e.Encode(mycluster.GetDelayedReplicas())
+		if err != nil {
+			http.Error(w, "Encoding error for delayed replicas", 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+// handlerMuxServerDelayedPause stops the SQL thread of a delayed replica.
+// @Summary Pause a delayed replica
+// @Description Stops the SQL thread of a delayed replica during an incident. The IO thread keeps receiving events so the recovery window is preserved.
+// @Tags DatabaseReplication
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Param serverName path string true "Server Name"
+// @Success 200 {object} cluster.DelayedReplica "Delayed replica"
+// @Failure 400 {string} string "Server is not a delayed replica"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 500 {string} string "Cluster Not Found" or "Server Not Found"
+// @Router /api/clusters/{clusterName}/servers/{serverName}/actions/delayed-pause [post]
+func (repman *ReplicationManager) handlerMuxServerDelayedPause(w http.ResponseWriter, r *http.Request) {
+	repman.handlerMuxServerDelayedAction(w, r, func(node *cluster.ServerMonitor) error {
+		return node.PauseDelayedReplica()
+	})
+}
+
+// handlerMuxServerDelayedResume restores the delay of a delayed replica.
+// @Summary Resume a delayed replica
+// @Description Restores the configured replication-delayed-time and restarts the replication of a paused or fast-forwarded delayed replica.
+// @Tags DatabaseReplication
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Param serverName path string true "Server Name"
+// @Success 200 {object} cluster.DelayedReplica "Delayed replica"
+// @Failure 400 {string} string "Server is not a delayed replica"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 500 {string} string "Cluster Not Found" or "Server Not Found"
+// @Router /api/clusters/{clusterName}/servers/{serverName}/actions/delayed-resume [post]
+func (repman *ReplicationManager) handlerMuxServerDelayedResume(w http.ResponseWriter, r *http.Request) {
+	repman.handlerMuxServerDelayedAction(w, r, func(node *cluster.ServerMonitor) error {
+		return node.ResumeDelayedReplica()
+	})
+}
+
+// handlerMuxServerDelayedFastForward applies a delayed replica up to a GTID or a point in time.
+// @Summary Fast-forward a delayed replica
+// @Description Removes the delay and starts the replication until the given GTID position is applied or until the last master event before the given timestamp. The SQL thread stays stopped once reached, resume the delayed replica to restore the delay.
+// @Tags DatabaseReplication
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Param serverName path string true "Server Name"
+// @Param gtid query string false "GTID position to apply up to"
+// @Param timestamp query string false "Point in time as RFC3339 or unix timestamp"
+// @Success 200 {object} cluster.DelayedReplica "Delayed replica"
+// @Failure 400 {string} string "Server is not a delayed replica" or "Missing gtid or timestamp" or "Invalid GTID position"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 500 {string} string "Cluster Not Found" or "Server Not Found"
+// @Router /api/clusters/{clusterName}/servers/{serverName}/actions/delayed-fast-forward [post]
+func (repman *ReplicationManager) handlerMuxServerDelayedFastForward(w http.ResponseWriter, r *http.Request) {
+	gtid := r.URL.Query().Get("gtid")
+	timestamp := r.URL.Query().Get("timestamp")
+	if gtid == "" && timestamp == "" {
+		http.Error(w, "Missing gtid or timestamp", 400)
+		return
+	}
+	var ts time.Time
+	if gtid == "" {
+		var err error
+		ts, err = time.Parse(time.RFC3339, timestamp)
+		if err != nil {
+			unix, errunix := strconv.ParseInt(timestamp, 10, 64)
+			if errunix != nil {
+				http.Error(w, "Invalid timestamp: "+err.Error(), 400)
+				return
+			}
+			ts = time.Unix(unix, 0)
+		}
+	}
+	repman.handlerMuxServerDelayedAction(w, r, func(node *cluster.ServerMonitor) error {
+		if gtid != "" {
+			return node.FastForwardDelayedReplicaToGtid(gtid)
+		}
+		return node.FastForwardDelayedReplicaToTimestamp(ts)
+	})
+}
+
+func (repman *ReplicationManager) handlerMuxServerDelayedAction(w http.ResponseWriter, r *http.Request, action func(node *cluster.ServerMonitor) error) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		node := mycluster.GetServerFromName(vars["serverName"])
+		if node == nil {
+			http.Error(w, "Server Not Found", 500)
+			return
+		}
+		err := action(node)
+		if err == cluster.ErrNotDelayedReplica || err == cluster.ErrDelayedTimestampReach || err == cluster.ErrDelayedInvalidGtid {
+			http.Error(w, err.Error(), 400)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err = e.Encode(node.GetDelayedReplica())
+		if err != nil {
+			http.Error(w, "Encoding error for delayed replica", 500)
+			return
+		}
+	} else {
+		http.Error(w, "Cluster Not Found", 500)
+		return
+	}
+}
@@ -0,0 +1,169 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/codegangsta/negroni"
+	"github.com/gorilla/mux"
+	"github.com/signal18/replication-manager/cluster"
+)
+
+func (repman *ReplicationManager) apiErrantProtectedHandler(router *mux.Router) {
+	router.Handle("/api/clusters/{clusterName}/errant-transactions", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxErrantTransactions)),
+	))
+	router.Handle("/api/clusters/{clusterName}/servers/{serverName}/errant-transactions/events", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxServerErrantEvents)),
+	))
+	router.Handle("/api/clusters/{clusterName}/servers/{serverName}/actions/errant-repair/{method}", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.HandlerFunc(repman.approvalMiddleware("errant-repair")),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxServerErrantRepair)),
+	))
+}
+
+// handlerMuxErrantTransactions returns the errant GTID sets of the replicas.
+// @Summary Errant transactions of a specific cluster
+// @Description This endpoint returns the GTIDs executed on each replica but not on the master and the last repair jobs, newest first.
+// @Tags DatabaseReplication
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Success 200 {object} cluster.ErrantStatus "Errant transactions"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 500 {string} string "No cluster"
+// @Router /api/clusters/{clusterName}/errant-transactions [get]
+func (repman *ReplicationManager) handlerMuxErrantTransactions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err := e.Encode(mycluster.GetErrantTransactions())
+		if err != nil {
+			http.Error(w, "Encoding error for errant transactions", 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+// handlerMuxServerErrantEvents returns the events of the errant transactions of a replica.
+// @Summary Errant transaction events of a replica
+// @Description This endpoint reads the errant transactions from the binary logs of the replica and returns their events with binlog coordinates, table and number of rows.
+// @Tags DatabaseReplication
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Param serverName path string true "Server Name"
+// @Success 200 {array} cluster.ErrantEvent "Errant events"
+// @Failure 400 {string} string "Server has no errant transaction"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 500 {string} string "Cluster Not Found" or "Server Not Found"
+// @Router /api/clusters/{clusterName}/servers/{serverName}/errant-transactions/events [get]
+func (repman *ReplicationManager) handlerMuxServerErrantEvents(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		node := mycluster.GetServerFromName(vars["serverName"])
+		if node == nil {
+			http.Error(w, "Server Not Found", 500)
+			return
+		}
+		events, err := node.GetErrantEvents()
+		if err == cluster.ErrErrantNone || err == cluster.ErrErrantNoGtid {
+			http.Error(w, err.Error(), 400)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err = e.Encode(events)
+		if err != nil {
+			http.Error(w, "Encoding error for errant events", 500)
+			return
+		}
+	} else {
+		http.Error(w, "Cluster Not Found", 500)
+		return
+	}
+}
+
+// handlerMuxServerErrantRepair starts an errant transaction repair job on a replica.
+// @Summary Repair the errant transactions of a replica
+// @Description This endpoint starts a repair job. inject-empty commits an empty transaction on the master for each errant GTID and keeps the replica changes. reclone restores the replica from the master with replication-errant-repair-reclone-method. flashback reverts the row events on the replica without binary logging and removes the errant GTIDs from its GTID executed. Follow the job on the errant transactions status.
+// @Tags DatabaseReplication
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Param serverName path string true "Server Name"
+// @Param method path string true "Method" Enums(inject-empty, reclone, flashback)
+// @Success 200 {object} cluster.ErrantRepairJob "Started job"
+// @Failure 400 {string} string "Server has no errant transaction"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 409 {string} string "An errant transaction repair job is already running"
+// @Failure 500 {string} string "Cluster Not Found" or "Server Not Found"
+// @Router /api/clusters/{clusterName}/servers/{serverName}/actions/errant-repair/{method} [post]
+func (repman *ReplicationManager) handlerMuxServerErrantRepair(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		node := mycluster.GetServerFromName(vars["serverName"])
+		if node == nil {
+			http.Error(w, "Server Not Found", 500)
+			return
+		}
+		job, err := mycluster.StartErrantRepairJob(node, vars["method"])
+		if err == cluster.ErrErrantJobRunning {
+			http.Error(w, err.Error(), 409)
+			return
+		} else if err == cluster.ErrErrantNone || err == cluster.ErrErrantNoGtid {
+			http.Error(w, err.Error(), 400)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err = e.Encode(job)
+		if err != nil {
+			http.Error(w, "Encoding error for errant repair job", 500)
+			return
+		}
+	} else {
+		http.Error(w, "Cluster Not Found", 500)
+		return
+	}
+}
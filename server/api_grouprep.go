@@ -0,0 +1,201 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/codegangsta/negroni"
+	"github.com/gorilla/mux"
+	"github.com/signal18/replication-manager/cluster"
+)
+
+func (repman *ReplicationManager) apiGroupReplicationProtectedHandler(router *mux.Router) {
+	router.Handle("/api/clusters/{clusterName}/group-replication", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxGroupReplication)),
+	))
+	router.Handle("/api/clusters/{clusterName}/group-replication/actions/{mode}", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxGroupReplicationMode)),
+	))
+	router.Handle("/api/clusters/{clusterName}/servers/{serverName}/actions/group-replication-primary", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxServerGroupReplicationPrimary)),
+	))
+	router.Handle("/api/clusters/{clusterName}/servers/{serverName}/actions/group-replication-rejoin", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxServerGroupReplicationRejoin)),
+	))
+}
+
+// handlerMuxGroupReplication returns the members of the group.
+// @Summary Group replication state of a specific cluster
+// @Description This endpoint returns the mode, the primary, the majority and the members of the group with their state, role, version and election weight, as seen by an online member.
+// @Tags DatabaseReplication
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Success 200 {object} cluster.GroupReplicationStatus "Group replication status"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 500 {string} string "No cluster"
+// @Router /api/clusters/{clusterName}/group-replication [get]
+func (repman *ReplicationManager) handlerMuxGroupReplication(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err := e.Encode(mycluster.GetGroupReplication())
+		if err != nil {
+			http.Error(w, "Encoding error for group replication", 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+// handlerMuxGroupReplicationMode switches the group between single-primary and multi-primary.
+// @Summary Switch the group replication mode
+// @Description multi-primary makes all members writable. single-primary keeps the current master as the only writable member, when primary is set the server is then elected with a switchover that reconfigures the proxies. Requires the switchover grant.
+// @Tags DatabaseReplication
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Param mode path string true "Mode" Enums(single-primary, multi-primary)
+// @Param primary query string false "Server Name of the single-primary"
+// @Success 200 {object} cluster.GroupReplicationStatus "Group replication status"
+// @Failure 400 {string} string "Unknown group replication mode"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 500 {string} string "No cluster"
+// @Router /api/clusters/{clusterName}/group-replication/actions/{mode} [post]
+func (repman *ReplicationManager) handlerMuxGroupReplicationMode(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		r.ParseForm()
+		var primary *cluster.ServerMonitor
+		if name := r.Form.Get("primary"); name != "" {
+			primary = mycluster.GetServerFromName(name)
+			if primary == nil {
+				http.Error(w, "Server Not Found", 500)
+				return
+			}
+		}
+		err := mycluster.SetGroupReplicationMode(vars["mode"], primary)
+		if err == cluster.ErrGroupReplicationMode || err == cluster.ErrGroupReplicationTopology || err == cluster.ErrGroupReplicationNotSlave {
+			http.Error(w, err.Error(), 400)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err = e.Encode(mycluster.GetGroupReplication())
+		if err != nil {
+			http.Error(w, "Encoding error for group replication", 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+// handlerMuxServerGroupReplicationPrimary elects a member as primary of the group.
+// @Summary Elect a group replication primary
+// @Description This endpoint elects an online secondary as the primary of a single-primary group with a switchover, the proxies and the cluster master follow the new primary. Requires the switchover grant.
+// @Tags DatabaseReplication
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Param serverName path string true "Server Name"
+// @Success 200 {string} string "Done"
+// @Failure 400 {string} string "Cluster topology is not multi-master-grouprep" or "Server is not an online secondary of a single-primary group"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 500 {string} string "Cluster Not Found" or "Server Not Found" or "Group replication switchover failed"
+// @Router /api/clusters/{clusterName}/servers/{serverName}/actions/group-replication-primary [post]
+func (repman *ReplicationManager) handlerMuxServerGroupReplicationPrimary(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		node := mycluster.GetServerFromName(vars["serverName"])
+		if node == nil {
+			http.Error(w, "Server Not Found", 500)
+			return
+		}
+		err := mycluster.SetGroupReplicationPrimary(node)
+		if err == cluster.ErrGroupReplicationTopology || err == cluster.ErrGroupReplicationNotSlave {
+			http.Error(w, err.Error(), 400)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+	} else {
+		http.Error(w, "Cluster Not Found", 500)
+		return
+	}
+}
+
+// handlerMuxServerGroupReplicationRejoin restarts group replication on a member.
+// @Summary Rejoin a group replication member
+// @Description This endpoint stops and starts group replication on a member expelled from the group.
+// @Tags DatabaseReplication
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Param serverName path string true "Server Name"
+// @Success 200 {string} string "Done"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 500 {string} string "Cluster Not Found" or "Server Not Found"
+// @Router /api/clusters/{clusterName}/servers/{serverName}/actions/group-replication-rejoin [post]
+func (repman *ReplicationManager) handlerMuxServerGroupReplicationRejoin(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		node := mycluster.GetServerFromName(vars["serverName"])
+		if node == nil {
+			http.Error(w, "Server Not Found", 500)
+			return
+		}
+		if err := node.RejoinGroupReplication(); err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+	} else {
+		http.Error(w, "Cluster Not Found", 500)
+		return
+	}
+}
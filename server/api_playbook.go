@@ -0,0 +1,164 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/codegangsta/negroni"
+	"github.com/gorilla/mux"
+	"github.com/signal18/replication-manager/cluster"
+)
+
+func (repman *ReplicationManager) apiPlaybookProtectedHandler(router *mux.Router) {
+	router.Handle("/api/clusters/{clusterName}/replication-playbooks", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxReplicationPlaybooks)),
+	))
+	router.Handle("/api/clusters/{clusterName}/servers/{serverName}/replication-error", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxServerReplicationError)),
+	))
+	router.Handle("/api/clusters/{clusterName}/servers/{serverName}/actions/replication-playbook", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.HandlerFunc(repman.approvalMiddleware("replication-playbook")),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxServerReplicationPlaybook)),
+	))
+}
+
+// handlerMuxReplicationPlaybooks returns the playbooks, the replicas in error and the last runs.
+// @Summary Replication playbooks of a specific cluster
+// @Description This endpoint returns the playbook of each replication error class, the classified errors of the replicas and the last playbook runs, newest first.
+// @Tags DatabaseReplication
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Success 200 {object} cluster.PlaybookStatus "Replication playbooks"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 500 {string} string "No cluster"
+// @Router /api/clusters/{clusterName}/replication-playbooks [get]
+func (repman *ReplicationManager) handlerMuxReplicationPlaybooks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err := e.Encode(mycluster.GetReplicationPlaybooks())
+		if err != nil {
+			http.Error(w, "Encoding error for replication playbooks", 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+// handlerMuxServerReplicationError returns the classified replication error of a server.
+// @Summary Replication error of a server
+// @Description This endpoint returns the last errors of the replication threads with their class, the table of the error, the executed position and the playbook action.
+// @Tags DatabaseReplication
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Param serverName path string true "Server Name"
+// @Success 200 {object} cluster.ReplicationError "Replication error"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 500 {string} string "Cluster Not Found" or "Server Not Found"
+// @Router /api/clusters/{clusterName}/servers/{serverName}/replication-error [get]
+func (repman *ReplicationManager) handlerMuxServerReplicationError(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		node := mycluster.GetServerFromName(vars["serverName"])
+		if node == nil {
+			http.Error(w, "Server Not Found", 500)
+			return
+		}
+		re, err := node.GetReplicationError()
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err = e.Encode(re)
+		if err != nil {
+			http.Error(w, "Encoding error for replication error", 500)
+			return
+		}
+	} else {
+		http.Error(w, "Cluster Not Found", 500)
+		return
+	}
+}
+
+// handlerMuxServerReplicationPlaybook runs the playbook of the replication error of a server.
+// @Summary Run the replication playbook of a server
+// @Description This endpoint runs the playbook mapped to the class of the replication error. skip-verified skips the failing transaction when it only writes the table of the error and the replica already holds its rows. fetch-row inserts the rows a failing update or delete expects, read from the master binary logs. fix-relay drops the relay logs and fetches again from the executed position. reseed restores the replica with replication-playbook-reseed-method. A manual run resets the count of automatic runs. Follow the run on the replication playbooks status.
+// @Tags DatabaseReplication
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Param serverName path string true "Server Name"
+// @Success 200 {object} cluster.PlaybookRun "Started run"
+// @Failure 400 {string} string "Replication of the server has no error"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 409 {string} string "A replication playbook is already running on the server"
+// @Failure 500 {string} string "Cluster Not Found" or "Server Not Found"
+// @Router /api/clusters/{clusterName}/servers/{serverName}/actions/replication-playbook [post]
+func (repman *ReplicationManager) handlerMuxServerReplicationPlaybook(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		node := mycluster.GetServerFromName(vars["serverName"])
+		if node == nil {
+			http.Error(w, "Server Not Found", 500)
+			return
+		}
+		run, err := mycluster.StartReplicationPlaybook(node, false)
+		if err == cluster.ErrPlaybookRunning {
+			http.Error(w, err.Error(), 409)
+			return
+		} else if err == cluster.ErrPlaybookNoError || err == cluster.ErrPlaybookNoAction {
+			http.Error(w, err.Error(), 400)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err = e.Encode(run)
+		if err != nil {
+			http.Error(w, "Encoding error for replication playbook run", 500)
+			return
+		}
+	} else {
+		http.Error(w, "Cluster Not Found", 500)
+		return
+	}
+}
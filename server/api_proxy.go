@@ -25,6 +25,7 @@ func (repman *ReplicationManager) apiProxyProtectedHandler(router *mux.Router) {
 	))
 	router.Handle("/api/clusters/{clusterName}/proxies/{proxyName}/actions/unprovision", negroni.New(
 		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.HandlerFunc(repman.approvalMiddleware("unprovision")),
 		negroni.Wrap(http.HandlerFunc(repman.handlerMuxProxyUnprovision)),
 	))
 	router.Handle("/api/clusters/{clusterName}/proxies/{proxyName}/actions/provision", negroni.New(
@@ -47,6 +48,14 @@ func (repman *ReplicationManager) apiProxyProtectedHandler(router *mux.Router) {
 		negroni.HandlerFunc(repman.validateTokenMiddleware),
 		negroni.Wrap(http.HandlerFunc(repman.handlerMuxProxyNeedReprov)),
 	))
+	router.Handle("/api/clusters/{clusterName}/proxies/{proxyName}/drift", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxProxyDrift)),
+	))
+	router.Handle("/api/clusters/{clusterName}/proxies/{proxyName}/actions/remediate-drift", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxProxyRemediateDrift)),
+	))
 }
 
 // @Summary Shows the proxies for that specific named cluster
@@ -348,3 +357,106 @@ func (repman *ReplicationManager) handlerMuxProxyNeedReprov(w http.ResponseWrite
 		return
 	}
 }
+
+// @Summary Shows the configuration drift of a proxy
+// @Description Compares the proxy runtime backends, users and query rules with the state expected by replication-manager
+// @Tags Proxies
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Param proxyName path string true "Proxy Name"
+// @Success 200 {object} cluster.ProxyDrift "Proxy drift"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 500 {string} string "No cluster" "Server Not Found"
+// @Failure 501 {string} string "Drift detection not supported by proxy"
+// @Router /api/clusters/{clusterName}/proxies/{proxyName}/drift [get]
+func (repman *ReplicationManager) handlerMuxProxyDrift(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		node := mycluster.GetProxyFromName(vars["proxyName"])
+		if node == nil {
+			http.Error(w, "Server Not Found", 500)
+			return
+		}
+		drift, err := mycluster.CheckProxyDrift(node)
+		if err == cluster.ErrProxyDriftNotSupported {
+			http.Error(w, err.Error(), 501)
+			return
+		}
+		if err != nil {
+			drift.Error = err.Error()
+		}
+		if last, ok := mycluster.GetProxyDrift(node); ok {
+			drift.Remediated = last.Remediated
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err = e.Encode(drift)
+		if err != nil {
+			http.Error(w, "Encoding error", 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+// @Summary Remediate the configuration drift of a proxy
+// @Description Re-applies the backends, users and query rules expected by replication-manager on the proxy
+// @Tags Proxies
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Param proxyName path string true "Proxy Name"
+// @Success 200 {object} cluster.ProxyDrift "Proxy drift before remediation"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 500 {string} string "No cluster" "Server Not Found"
+// @Failure 409 {string} string "Failover in progress, the desired state of the proxy is not applied"
+// @Failure 501 {string} string "Drift detection not supported by proxy"
+// @Router /api/clusters/{clusterName}/proxies/{proxyName}/actions/remediate-drift [post]
+func (repman *ReplicationManager) handlerMuxProxyRemediateDrift(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		node := mycluster.GetProxyFromName(vars["proxyName"])
+		if node == nil {
+			http.Error(w, "Server Not Found", 500)
+			return
+		}
+		drift, err := mycluster.RemediateProxyDrift(node)
+		if err == cluster.ErrProxyDriftNotSupported {
+			http.Error(w, err.Error(), 501)
+			return
+		}
+		if err == cluster.ErrProxyDriftFailover {
+			http.Error(w, err.Error(), 409)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err = e.Encode(drift)
+		if err != nil {
+			http.Error(w, "Encoding error", 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
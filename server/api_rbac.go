@@ -0,0 +1,283 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/codegangsta/negroni"
+	"github.com/gorilla/mux"
+	"github.com/signal18/replication-manager/cluster"
+	"github.com/signal18/replication-manager/utils/rbac"
+)
+
+func (repman *ReplicationManager) apiRBACProtectedHandler(router *mux.Router) {
+	router.Handle("/api/clusters/{clusterName}/rbac", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxRBAC)),
+	))
+	router.Handle("/api/clusters/{clusterName}/rbac/roles", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxRBACSetRole)),
+	))
+	router.Handle("/api/clusters/{clusterName}/rbac/roles/{roleName}/actions/drop", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxRBACDropRole)),
+	))
+	router.Handle("/api/clusters/{clusterName}/rbac/users/{userName}/actions/bind/{roleName}", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxRBACBindRole)),
+	))
+	router.Handle("/api/clusters/{clusterName}/rbac/users/{userName}/actions/unbind/{roleName}", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxRBACUnbindRole)),
+	))
+	router.Handle("/api/clusters/{clusterName}/rbac/evaluate", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxRBACEvaluate)),
+	))
+}
+
+// handlerMuxRBAC returns the custom roles of a cluster and the users bound to them.
+// @Summary Retrieve custom roles for a specific cluster
+// @Description This endpoint returns the custom roles of the cluster and the users bound to them.
+// @Tags RBAC
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Success 200 {object} cluster.RBACConfig "Custom roles and bindings"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 500 {string} string "No cluster"
+// @Router /api/clusters/{clusterName}/rbac [get]
+func (repman *ReplicationManager) handlerMuxRBAC(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err := e.Encode(mycluster.GetRBAC())
+		if err != nil {
+			http.Error(w, "Encoding error for rbac", 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+// handlerMuxRBACSetRole creates or replaces a custom role.
+// @Summary Create or replace a custom role
+// @Description This endpoint creates or replaces a custom role made of allow and deny rules, each rule optionally scoped to servers, proxies, tags or replication roles. A role can only allow grants the caller holds on the whole cluster. The caller can not replace a role bound to themselves nor remove or narrow a deny rule on a grant they do not hold.
+// @Tags RBAC
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Param role body rbac.Role true "Role"
+// @Success 200 {string} string "Role saved"
+// @Failure 400 {string} string "Error in request"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 500 {string} string "No cluster"
+// @Router /api/clusters/{clusterName}/rbac/roles [post]
+func (repman *ReplicationManager) handlerMuxRBACSetRole(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		var role rbac.Role
+		err := json.NewDecoder(r.Body).Decode(&role)
+		if err != nil {
+			http.Error(w, "Error in request: "+err.Error(), 400)
+			return
+		}
+		err = mycluster.SetRBACRole(repman.GetUserFromRequest(r), role)
+		if errors.Is(err, cluster.ErrRBACRefused) {
+			http.Error(w, err.Error(), 403)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		fmt.Fprintf(w, "Role %s saved", role.Name)
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+// handlerMuxRBACDropRole drops a custom role and its bindings.
+// @Summary Drop a custom role
+// @Description This endpoint drops a custom role and unbinds it from every user. The caller can not drop a role bound to themselves nor a role denying a grant they do not hold.
+// @Tags RBAC
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Param roleName path string true "Role Name"
+// @Success 200 {string} string "Role dropped"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 500 {string} string "No cluster"
+// @Router /api/clusters/{clusterName}/rbac/roles/{roleName}/actions/drop [post]
+func (repman *ReplicationManager) handlerMuxRBACDropRole(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		err := mycluster.DropRBACRole(repman.GetUserFromRequest(r), vars["roleName"])
+		if errors.Is(err, cluster.ErrRBACRefused) {
+			http.Error(w, err.Error(), 403)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		fmt.Fprintf(w, "Role %s dropped", vars["roleName"])
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+// handlerMuxRBACBindRole binds a custom role to a user.
+// @Summary Bind a custom role to a user
+// @Description This endpoint binds a custom role to a user of the cluster. The caller must hold on the whole cluster every grant the role allows.
+// @Tags RBAC
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Param userName path string true "User Name"
+// @Param roleName path string true "Role Name"
+// @Success 200 {string} string "Role bound"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 500 {string} string "No cluster"
+// @Router /api/clusters/{clusterName}/rbac/users/{userName}/actions/bind/{roleName} [post]
+func (repman *ReplicationManager) handlerMuxRBACBindRole(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		err := mycluster.BindRBACRole(repman.GetUserFromRequest(r), vars["userName"], vars["roleName"])
+		if errors.Is(err, cluster.ErrRBACRefused) {
+			http.Error(w, err.Error(), 403)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		fmt.Fprintf(w, "Role %s bound to %s", vars["roleName"], vars["userName"])
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+// handlerMuxRBACUnbindRole removes a custom role from a user.
+// @Summary Unbind a custom role from a user
+// @Description This endpoint removes a custom role from a user of the cluster. The caller can not unbind their own roles nor a role denying a grant they do not hold.
+// @Tags RBAC
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Param userName path string true "User Name"
+// @Param roleName path string true "Role Name"
+// @Success 200 {string} string "Role unbound"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 500 {string} string "No cluster"
+// @Router /api/clusters/{clusterName}/rbac/users/{userName}/actions/unbind/{roleName} [post]
+func (repman *ReplicationManager) handlerMuxRBACUnbindRole(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		err := mycluster.UnbindRBACRole(repman.GetUserFromRequest(r), vars["userName"], vars["roleName"])
+		if errors.Is(err, cluster.ErrRBACRefused) {
+			http.Error(w, err.Error(), 403)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		fmt.Fprintf(w, "Role %s unbound from %s", vars["roleName"], vars["userName"])
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+// handlerMuxRBACEvaluate tells whether a user can use a grant on a resource.
+// @Summary Evaluate a permission
+// @Description This endpoint answers whether a user can use a grant on the cluster, a server or a proxy and which rule decided it.
+// @Tags RBAC
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Param user query string true "User Name"
+// @Param grant query string true "Grant, like db-backup"
+// @Param resource query string false "cluster, server:<name> or proxy:<name>, default cluster"
+// @Success 200 {object} rbac.Decision "Decision"
+// @Failure 400 {string} string "Invalid evaluation"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 500 {string} string "No cluster"
+// @Router /api/clusters/{clusterName}/rbac/evaluate [get]
+func (repman *ReplicationManager) handlerMuxRBACEvaluate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		q := r.URL.Query()
+		d, err := mycluster.EvaluateRBAC(q.Get("user"), q.Get("grant"), q.Get("resource"))
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err = e.Encode(d)
+		if err != nil {
+			http.Error(w, "Encoding error for rbac decision", 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
@@ -0,0 +1,102 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/codegangsta/negroni"
+	"github.com/gorilla/mux"
+	"github.com/signal18/replication-manager/utils/secaudit"
+)
+
+func (repman *ReplicationManager) apiSecurityAuditProtectedHandler(router *mux.Router) {
+	router.Handle("/api/clusters/{clusterName}/security-audit", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxSecurityAudit)),
+	))
+	router.Handle("/api/clusters/{clusterName}/security-audit/actions/fix", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxSecurityAuditFix)),
+	))
+}
+
+func (repman *ReplicationManager) writeSecurityAudit(w http.ResponseWriter, findings []secaudit.Finding) {
+	if findings == nil {
+		findings = []secaudit.Finding{}
+	}
+	e := json.NewEncoder(w)
+	e.SetIndent("", "\t")
+	err := e.Encode(findings)
+	if err != nil {
+		http.Error(w, "Encoding error for security audit", 500)
+		return
+	}
+}
+
+// handlerMuxSecurityAudit returns the security audit report of the cluster.
+// @Summary Security audit of the database servers for a specific cluster
+// @Description This endpoint returns the findings of the last security audit sorted by severity, with refresh=true the servers are audited again.
+// @Tags SecurityAudit
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Param refresh query bool false "Audit the servers now"
+// @Success 200 {array} secaudit.Finding "Findings"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 500 {string} string "No cluster"
+// @Router /api/clusters/{clusterName}/security-audit [get]
+func (repman *ReplicationManager) handlerMuxSecurityAudit(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		findings := mycluster.GetSecurityAudit()
+		if r.URL.Query().Get("refresh") == "true" {
+			findings = mycluster.AuditSecurity()
+		}
+		repman.writeSecurityAudit(w, findings)
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+// handlerMuxSecurityAuditFix fixes the security findings that have a fix.
+// @Summary Fix the security audit findings
+// @Description This endpoint audits the servers, drops the anonymous users and disables local_infile, then returns the findings with their fix status. Other findings need an operator.
+// @Tags SecurityAudit
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Success 200 {array} secaudit.Finding "Findings"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 500 {string} string "No cluster"
+// @Router /api/clusters/{clusterName}/security-audit/actions/fix [post]
+func (repman *ReplicationManager) handlerMuxSecurityAuditFix(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		repman.writeSecurityAudit(w, mycluster.FixSecurityAudit())
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
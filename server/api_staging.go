@@ -0,0 +1,106 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/codegangsta/negroni"
+	"github.com/gorilla/mux"
+	"github.com/signal18/replication-manager/cluster"
+)
+
+func (repman *ReplicationManager) apiStagingProtectedHandler(router *mux.Router) {
+	router.Handle("/api/clusters/{clusterName}/staging", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxStaging)),
+	))
+	router.Handle("/api/clusters/{clusterName}/staging/actions/{action}", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxStagingAction)),
+	))
+}
+
+// handlerMuxStaging returns the staging server and its last jobs.
+// @Summary Staging server of a specific cluster
+// @Description This endpoint returns the staging server, its replication state and the last detach, refresh and attach jobs, newest first.
+// @Tags Staging
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Success 200 {object} cluster.StagingStatus "Staging status"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 500 {string} string "No cluster"
+// @Router /api/clusters/{clusterName}/staging [get]
+func (repman *ReplicationManager) handlerMuxStaging(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err := e.Encode(mycluster.GetStaging())
+		if err != nil {
+			http.Error(w, "Encoding error for staging", 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+// handlerMuxStagingAction starts a staging job.
+// @Summary Detach, refresh or attach the staging server
+// @Description This endpoint starts a job on the staging server. detach breaks the replication, sets the server writable and calls the post detach script. refresh restores the server with the staging refresh method and waits for it to catch up. attach points the server back to the master keeping its local changes. cycle refreshes then detaches. Follow the job on the staging status.
+// @Tags Staging
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Param action path string true "Action" Enums(detach, refresh, attach, cycle)
+// @Success 200 {object} cluster.StagingJob "Started job"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 409 {string} string "A staging job is already running"
+// @Failure 500 {string} string "No cluster"
+// @Router /api/clusters/{clusterName}/staging/actions/{action} [post]
+func (repman *ReplicationManager) handlerMuxStagingAction(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		job, err := mycluster.StartStagingJob(vars["action"])
+		if err == cluster.ErrStagingJobRunning {
+			http.Error(w, err.Error(), 409)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err = e.Encode(job)
+		if err != nil {
+			http.Error(w, "Encoding error for staging", 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
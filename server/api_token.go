@@ -0,0 +1,164 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/codegangsta/negroni"
+	"github.com/gorilla/mux"
+	"github.com/signal18/replication-manager/cluster"
+	"github.com/signal18/replication-manager/utils/apitoken"
+)
+
+type apiTokenCreated struct {
+	Secret string `json:"token"`
+	apitoken.Token
+}
+
+func (repman *ReplicationManager) apiTokenProtectedHandler(router *mux.Router) {
+	router.Handle("/api/tokens", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxAPITokens)),
+	))
+	router.Handle("/api/tokens/{tokenId}/actions/revoke", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxAPITokenRevoke)),
+	))
+}
+
+// checkAPITokenACL checks that the caller can manage tokens, tokens themselves can not
+// so that a leaked token can not mint new ones
+func (repman *ReplicationManager) checkAPITokenACL(w http.ResponseWriter, r *http.Request) (*cluster.Cluster, string, bool) {
+	mycluster := repman.getGlobalACLCluster()
+	if mycluster == nil {
+		http.Error(w, "No cluster", 500)
+		return nil, "", false
+	}
+	if isAPITokenRequest(r) {
+		http.Error(w, "API tokens can not manage API tokens", 403)
+		return nil, "", false
+	}
+	valid, user := repman.IsValidClusterACL(r, mycluster)
+	if !valid {
+		http.Error(w, "No valid ACL", 403)
+		return nil, "", false
+	}
+	if repman.apiTokens == nil {
+		http.Error(w, "API tokens are not available", 501)
+		return nil, "", false
+	}
+	return mycluster, user, true
+}
+
+// handlerMuxAPITokens lists the service account tokens or creates one.
+// @Summary List or create service account API tokens
+// @Description GET lists the tokens without their secret. POST creates a token with a subset of the caller grants on each targeted cluster, every cluster when none is given, optional clusters, CIDR allowlist and ttl, the clear token is only returned by this call.
+// @Tags Tokens
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param token body apitoken.Request false "Token to create"
+// @Success 200 {array} apitoken.Token "Tokens"
+// @Failure 400 {string} string "Error in request"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 500 {string} string "No cluster"
+// @Failure 501 {string} string "API tokens are not available"
+// @Router /api/tokens [get]
+// @Router /api/tokens [post]
+func (repman *ReplicationManager) handlerMuxAPITokens(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	_, user, ok := repman.checkAPITokenACL(w, r)
+	if !ok {
+		return
+	}
+	e := json.NewEncoder(w)
+	e.SetIndent("", "\t")
+	if r.Method != http.MethodPost {
+		err := e.Encode(repman.apiTokens.List())
+		if err != nil {
+			http.Error(w, "Encoding error for tokens", 500)
+		}
+		return
+	}
+
+	var req apitoken.Request
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "Error in request: "+err.Error(), 400)
+		return
+	}
+	// the creator must hold the grants on every cluster the token can reach
+	var targets []*cluster.Cluster
+	for _, name := range req.Clusters {
+		cl := repman.getClusterByName(name)
+		if cl == nil {
+			http.Error(w, "Cluster not found: "+name, 400)
+			return
+		}
+		targets = append(targets, cl)
+	}
+	if len(targets) == 0 {
+		for _, cl := range repman.Clusters {
+			if cl != nil {
+				targets = append(targets, cl)
+			}
+		}
+	}
+	for _, cl := range targets {
+		if err = cl.CheckTokenGrants(user, req.Grants); err != nil {
+			http.Error(w, cl.Name+": "+err.Error(), 400)
+			return
+		}
+	}
+	clear, tok, err := repman.apiTokens.Create(req, user)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	repman.Logrus.Infof("API token %s of %s created by %s", tok.ID, tok.Account, user)
+	err = e.Encode(apiTokenCreated{Secret: clear, Token: tok})
+	if err != nil {
+		http.Error(w, "Encoding error for token", 500)
+		return
+	}
+}
+
+// handlerMuxAPITokenRevoke revokes a service account token.
+// @Summary Revoke an API token
+// @Description This endpoint revokes a token, it stays listed for audit.
+// @Tags Tokens
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param tokenId path string true "Token ID"
+// @Success 200 {string} string "Token revoked"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 404 {string} string "API token not found"
+// @Failure 500 {string} string "No cluster"
+// @Router /api/tokens/{tokenId}/actions/revoke [post]
+func (repman *ReplicationManager) handlerMuxAPITokenRevoke(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if _, _, ok := repman.checkAPITokenACL(w, r); !ok {
+		return
+	}
+	vars := mux.Vars(r)
+	err := repman.revokeAPIToken(vars["tokenId"])
+	if err == apitoken.ErrTokenNotFound {
+		http.Error(w, err.Error(), 404)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	fmt.Fprintf(w, "Token %s revoked", vars["tokenId"])
+}
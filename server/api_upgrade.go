@@ -0,0 +1,155 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/codegangsta/negroni"
+	"github.com/gorilla/mux"
+	"github.com/signal18/replication-manager/cluster"
+)
+
+func (repman *ReplicationManager) apiUpgradeProtectedHandler(router *mux.Router) {
+	router.Handle("/api/clusters/{clusterName}/upgrade", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxUpgrade)),
+	))
+	router.Handle("/api/clusters/{clusterName}/upgrade/actions/start", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.HandlerFunc(repman.approvalMiddleware("rolling-upgrade")),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxUpgradeStart)),
+	))
+	router.Handle("/api/clusters/{clusterName}/upgrade/actions/{action:pause|resume|abort}", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxUpgradeAction)),
+	))
+}
+
+func writeUpgradeJSON(w http.ResponseWriter, upg cluster.UpgradeStatus) {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "\t")
+	err := e.Encode(upg)
+	if err != nil {
+		http.Error(w, "Encoding error for upgrade", 500)
+		return
+	}
+}
+
+// handlerMuxUpgrade returns the last rolling upgrade of the cluster.
+// @Summary Rolling upgrade status of a specific cluster
+// @Description This endpoint returns the state of the last rolling upgrade with the status of every step, upgrade, db-upgrade, replication and checksum per server and the switchover.
+// @Tags Upgrade
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Success 200 {object} cluster.UpgradeStatus "Upgrade status"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 500 {string} string "No cluster"
+// @Router /api/clusters/{clusterName}/upgrade [get]
+func (repman *ReplicationManager) handlerMuxUpgrade(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		writeUpgradeJSON(w, mycluster.GetUpgrade())
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+// handlerMuxUpgradeStart starts a rolling upgrade.
+// @Summary Start a rolling upgrade
+// @Description This endpoint upgrades the replicas one at a time with upgrade-method, runs mariadb-upgrade or mysql_upgrade, checks the replication and the checksum of sample tables, switches over to an upgraded replica and upgrades the old master. Follow the steps on the upgrade status.
+// @Tags Upgrade
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Param version query string false "Target version, default upgrade-target-version"
+// @Success 200 {object} cluster.UpgradeStatus "Planned upgrade"
+// @Failure 400 {string} string "Invalid upgrade version"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 409 {string} string "A rolling upgrade is already running"
+// @Failure 500 {string} string "No cluster"
+// @Router /api/clusters/{clusterName}/upgrade/actions/start [post]
+func (repman *ReplicationManager) handlerMuxUpgradeStart(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		upg, err := mycluster.StartRollingUpgrade(r.URL.Query().Get("version"))
+		if err == cluster.ErrUpgradeRunning {
+			http.Error(w, err.Error(), 409)
+			return
+		} else if err == cluster.ErrUpgradeVersion {
+			http.Error(w, err.Error(), 400)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		writeUpgradeJSON(w, upg)
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+// handlerMuxUpgradeAction pauses, resumes or aborts the rolling upgrade.
+// @Summary Pause, resume or abort the rolling upgrade
+// @Description This endpoint controls the running rolling upgrade, pause and abort take effect once the current step is finished.
+// @Tags Upgrade
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Param action path string true "Action" Enums(pause, resume, abort)
+// @Success 200 {object} cluster.UpgradeStatus "Upgrade status"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 409 {string} string "No rolling upgrade is running"
+// @Failure 500 {string} string "No cluster"
+// @Router /api/clusters/{clusterName}/upgrade/actions/{action} [post]
+func (repman *ReplicationManager) handlerMuxUpgradeAction(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		var err error
+		switch vars["action"] {
+		case "pause":
+			err = mycluster.PauseRollingUpgrade()
+		case "resume":
+			err = mycluster.ResumeRollingUpgrade()
+		case "abort":
+			err = mycluster.AbortRollingUpgrade()
+		}
+		if err != nil {
+			http.Error(w, err.Error(), 409)
+			return
+		}
+		writeUpgradeJSON(w, mycluster.GetUpgrade())
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
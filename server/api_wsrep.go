@@ -0,0 +1,213 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/codegangsta/negroni"
+	"github.com/gorilla/mux"
+	"github.com/signal18/replication-manager/cluster"
+)
+
+func (repman *ReplicationManager) apiWsrepProtectedHandler(router *mux.Router) {
+	router.Handle("/api/clusters/{clusterName}/wsrep", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxWsrep)),
+	))
+	router.Handle("/api/clusters/{clusterName}/wsrep/grastate", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxWsrepGrastate)),
+	))
+	router.Handle("/api/clusters/{clusterName}/wsrep/actions/{action}", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxWsrepAction)),
+	))
+	router.Handle("/api/clusters/{clusterName}/servers/{serverName}/actions/wsrep-desync", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxServerWsrepDesync)),
+	))
+	router.Handle("/api/clusters/{clusterName}/servers/{serverName}/actions/wsrep-sync", negroni.New(
+		negroni.HandlerFunc(repman.validateTokenMiddleware),
+		negroni.Wrap(http.HandlerFunc(repman.handlerMuxServerWsrepSync)),
+	))
+}
+
+// handlerMuxWsrep returns the wsrep state of each node and the last wsrep jobs.
+// @Summary Wsrep state of a specific cluster
+// @Description This endpoint returns the cluster status, local state, last committed seqno, desync and flow control pause of each node, the node desynced for backup and the last bootstrap, recovery and rolling restart jobs, newest first.
+// @Tags DatabaseReplication
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Success 200 {object} cluster.WsrepStatus "Wsrep status"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 500 {string} string "No cluster"
+// @Router /api/clusters/{clusterName}/wsrep [get]
+func (repman *ReplicationManager) handlerMuxWsrep(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err := e.Encode(mycluster.GetWsrep())
+		if err != nil {
+			http.Error(w, "Encoding error for wsrep", 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+// handlerMuxWsrepGrastate returns the saved wsrep position of each node.
+// @Summary Wsrep saved position of each node
+// @Description This endpoint reads grastate.dat over ssh on each node. A stopped node that crashed reports seqno -1, run the recover-position action to recover its position with mysqld --wsrep-recover.
+// @Tags DatabaseReplication
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Success 200 {array} cluster.WsrepGrastate "Saved positions"
+// @Failure 400 {string} string "Cluster topology is not multi-master-wsrep"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 500 {string} string "No cluster"
+// @Router /api/clusters/{clusterName}/wsrep/grastate [get]
+func (repman *ReplicationManager) handlerMuxWsrepGrastate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		if !mycluster.IsWsrep() {
+			http.Error(w, cluster.ErrWsrepTopology.Error(), 400)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err := e.Encode(mycluster.GetWsrepGrastates(false))
+		if err != nil {
+			http.Error(w, "Encoding error for wsrep grastate", 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+// handlerMuxWsrepAction starts a wsrep bootstrap, position or primary component recovery or rolling restart.
+// @Summary Start a wsrep lifecycle job
+// @Description bootstrap starts a stopped cluster from the node with the most advanced seqno, then joins the other nodes one by one. recover-position runs mysqld --wsrep-recover on the stopped nodes without a saved seqno and records their positions in the job steps. recover-primary bootstraps a new primary component on the node with the highest last committed seqno, it is refused unless every node is reachable and non-primary. recover-primary-force ignores the unreachable nodes, a node still primary on the other side of a partition splits the cluster. rolling-restart restarts the nodes one by one, the leader last, waiting for all nodes to be synced and not desynced. Follow the job on the wsrep status.
+// @Tags DatabaseReplication
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Param action path string true "Action" Enums(bootstrap, recover-position, recover-primary, recover-primary-force, rolling-restart)
+// @Success 200 {object} cluster.WsrepJob "Started job"
+// @Failure 400 {string} string "Cluster topology is not multi-master-wsrep"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 409 {string} string "A wsrep job is already running"
+// @Failure 500 {string} string "No cluster"
+// @Router /api/clusters/{clusterName}/wsrep/actions/{action} [post]
+func (repman *ReplicationManager) handlerMuxWsrepAction(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		job, err := mycluster.StartWsrepJob(vars["action"])
+		if err == cluster.ErrWsrepJobRunning {
+			http.Error(w, err.Error(), 409)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		err = e.Encode(job)
+		if err != nil {
+			http.Error(w, "Encoding error for wsrep job", 500)
+			return
+		}
+	} else {
+		http.Error(w, "No cluster", 500)
+		return
+	}
+}
+
+// handlerMuxServerWsrepDesync desyncs a wsrep node.
+// @Summary Desync a wsrep node
+// @Description This endpoint sets wsrep_desync=ON, the node stops sending flow control messages and can lag behind the cluster.
+// @Tags DatabaseReplication
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Param serverName path string true "Server Name"
+// @Success 200 {string} string "Done"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 500 {string} string "Cluster Not Found" or "Server Not Found"
+// @Router /api/clusters/{clusterName}/servers/{serverName}/actions/wsrep-desync [post]
+func (repman *ReplicationManager) handlerMuxServerWsrepDesync(w http.ResponseWriter, r *http.Request) {
+	repman.setServerWsrepDesync(w, r, true)
+}
+
+// handlerMuxServerWsrepSync resyncs a wsrep node.
+// @Summary Resync a wsrep node
+// @Description This endpoint sets wsrep_desync=OFF, the node catches up and takes part in flow control again.
+// @Tags DatabaseReplication
+// @Produce json
+// @Param Authorization header string true "Insert your access token" default(Bearer <Add access token here>)
+// @Param clusterName path string true "Cluster Name"
+// @Param serverName path string true "Server Name"
+// @Success 200 {string} string "Done"
+// @Failure 403 {string} string "No valid ACL"
+// @Failure 500 {string} string "Cluster Not Found" or "Server Not Found"
+// @Router /api/clusters/{clusterName}/servers/{serverName}/actions/wsrep-sync [post]
+func (repman *ReplicationManager) handlerMuxServerWsrepSync(w http.ResponseWriter, r *http.Request) {
+	repman.setServerWsrepDesync(w, r, false)
+}
+
+func (repman *ReplicationManager) setServerWsrepDesync(w http.ResponseWriter, r *http.Request, value bool) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	vars := mux.Vars(r)
+	mycluster := repman.getClusterByName(vars["clusterName"])
+	if mycluster != nil {
+		if valid, _ := repman.IsValidClusterACL(r, mycluster); !valid {
+			http.Error(w, "No valid ACL", 403)
+			return
+		}
+		node := mycluster.GetServerFromName(vars["serverName"])
+		if node == nil {
+			http.Error(w, "Server Not Found", 500)
+			return
+		}
+		if err := node.SetWsrepDesync(value); err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+	} else {
+		http.Error(w, "Cluster Not Found", 500)
+		return
+	}
+}
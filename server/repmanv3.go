@@ -16,9 +16,12 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	"github.com/improbable-eng/grpc-web/go/grpcweb"
+	"github.com/signal18/replication-manager/cert"
 	"github.com/signal18/replication-manager/cluster"
 	"github.com/signal18/replication-manager/config"
 	v3 "github.com/signal18/replication-manager/repmanv3"
+	"github.com/signal18/replication-manager/utils/apitoken"
+	"golang.org/x/crypto/acme"
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/h2c"
 	"google.golang.org/grpc"
@@ -58,6 +61,11 @@ type Repmanv3TLS struct {
 	CertificatePath    string
 	CertificateKeyPath string
 	SelfSigned         bool
+	// GetCertificate serves renewed certificates without restart, from ACME or from reloaded files
+	GetCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+	// ACME adds the tls-alpn-01 protocol and dials the gateway with ServerName
+	ACME       bool
+	ServerName string
 }
 
 func (s *ReplicationManager) SetV3Config(config Repmanv3Config) {
@@ -178,7 +186,7 @@ func (s *ReplicationManager) streamInterceptor(srv interface{}, stream grpc.Serv
 
 	// handle ACL
 	log.Infof("grpc stream srv: %v", srv)
-	return handler(srv, stream)
+	return s.auditGrpcStream(srv, stream, info, handler)
 }
 
 func (s *ReplicationManager) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
@@ -200,7 +208,7 @@ func (s *ReplicationManager) unaryInterceptor(ctx context.Context, req interface
 		// }
 
 		// log.Infof("new ctx: %v", ctx)
-		return handler(ctx, cMsg)
+		return s.auditGrpc(ctx, cMsg, info, handler)
 	}
 	return nil, v3.NewError(codes.InvalidArgument, fmt.Errorf("no message sent with a cluster property")).Err()
 
@@ -247,6 +255,17 @@ func (s *ReplicationManager) getClusterAndUser(ctx context.Context, req v3.Conta
 	}
 
 	if len(auth[0]) > 6 && strings.ToUpper(auth[0][0:7]) == "BEARER " {
+		if apitoken.IsToken(auth[0][7:]) {
+			tok, err := s.getAPITokenFromContext(ctx, auth[0][7:])
+			if err != nil {
+				return cluster.APIUser{}, nil, err
+			}
+			if !tok.AllowsCluster(mycluster.Name) {
+				return cluster.APIUser{}, nil, fmt.Errorf("token not allowed on cluster %s", mycluster.Name)
+			}
+			mycluster.SetAPITokenUser(tok.User(), tok.Grants)
+			return mycluster.APIUsers[tok.User()], mycluster, nil
+		}
 		token, err := jwt.Parse(auth[0][7:], func(token *jwt.Token) (interface{}, error) {
 			vk, _ := jwt.ParseRSAPublicKeyFromPEM(verificationKey)
 			return vk, nil
@@ -259,6 +278,13 @@ func (s *ReplicationManager) getClusterAndUser(ctx context.Context, req v3.Conta
 		userinfo := claims["CustomUserInfo"]
 		mycutinfo := userinfo.(map[string]interface{})
 
+		if auth, _ := mycutinfo["Auth"].(string); auth == "ldap" {
+			if user, ok := mycluster.APIUsers[mycutinfo["Name"].(string)]; ok && user.IsLDAP {
+				return user, mycluster, nil
+			}
+			return cluster.APIUser{}, nil, fmt.Errorf("user not found")
+		}
+
 		user, err := mycluster.GetAPIUser(mycutinfo["Name"].(string), mycutinfo["Password"].(string))
 		if err != nil {
 			return cluster.APIUser{}, nil, err
@@ -271,22 +297,39 @@ func (s *ReplicationManager) getClusterAndUser(ctx context.Context, req v3.Conta
 }
 
 func (s *ReplicationManager) getCredentials() (opts []grpc.ServerOption, dopts []grpc.DialOption, tlsConfig *tls.Config, err error) {
+	if s.v3Config.TLS.Enabled && s.v3Config.TLS.ACME {
+		tlsConfig = &tls.Config{
+			GetCertificate: s.v3Config.TLS.GetCertificate,
+			NextProtos:     []string{"h2", "http/1.1", acme.ALPNProto},
+			MinVersion:     tls.VersionTLS12,
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+		// the gateway dials this process on the loopback, the certificate only matches the public domain
+		dopts = []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+			ServerName:         s.v3Config.TLS.ServerName,
+			InsecureSkipVerify: true,
+		}))}
+		return opts, dopts, tlsConfig, nil
+	}
 	if s.v3Config.TLS.Enabled {
-		// TLS for the gRPC server
-		grpcCreds, err := credentials.NewServerTLSFromFile(s.v3Config.TLS.CertificatePath, s.v3Config.TLS.CertificateKeyPath)
-		if err != nil {
-			return nil, nil, nil, fmt.Errorf("error configuring credentials for TLS: %w", err)
+		// HTTPS and gRPC serve the certificate of the same reloader, so that a renewed
+		// file is picked up by every client with or without SNI
+		getCertificate := s.v3Config.TLS.GetCertificate
+		if getCertificate == nil {
+			reloader, err := cert.NewKeyPairReloader(s.v3Config.TLS.CertificatePath, s.v3Config.TLS.CertificateKeyPath)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("error loading certificates for TLS: %w", err)
+			}
+			getCertificate = reloader.GetCertificate
 		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(&tls.Config{
+			GetCertificate: getCertificate,
+			MinVersion:     tls.VersionTLS12,
+		})))
 
-		opts = append(opts, grpc.Creds(grpcCreds))
-
-		cer, err := tls.LoadX509KeyPair(s.v3Config.TLS.CertificatePath, s.v3Config.TLS.CertificateKeyPath)
-		if err != nil {
-			return nil, nil, nil, fmt.Errorf("error loading certificates for TLS: %w", err)
-		}
 		//	log.Warning("Ici :" + s.v3Config.Listen.Address)
 		tlsConfig = &tls.Config{
-			Certificates: []tls.Certificate{cer},
+			GetCertificate: getCertificate,
 			// declare that the listener supports http/2.0
 			NextProtos:               []string{"h2"},
 			ServerName:               s.v3Config.Listen.Address, // this is critical
@@ -600,6 +643,10 @@ func (s *ReplicationManager) PerformClusterAction(ctx context.Context, in *v3.Cl
 	case v3.ClusterAction_CHECKSUM_ALL_TABLES:
 		go mycluster.CheckAllTableChecksum()
 	case v3.ClusterAction_FAILOVER:
+		// the approval workflow is only available on the REST API
+		if mycluster.IsApprovalRequired("failover") {
+			return nil, status.Error(codes.FailedPrecondition, "Failover needs an approval, request it on the REST API")
+		}
 		mycluster.MasterFailover(true)
 	case v3.ClusterAction_MASTER_PHYSICAL_BACKUP:
 		m := mycluster.GetMaster()
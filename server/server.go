@@ -57,6 +57,9 @@ import (
 	"github.com/signal18/replication-manager/opensvc"
 	"github.com/signal18/replication-manager/regtest"
 	"github.com/signal18/replication-manager/repmanv3"
+	"github.com/signal18/replication-manager/utils/apitoken"
+	"github.com/signal18/replication-manager/utils/approval"
+	"github.com/signal18/replication-manager/utils/audit"
 	"github.com/signal18/replication-manager/utils/cron"
 	"github.com/signal18/replication-manager/utils/githelper"
 	"github.com/signal18/replication-manager/utils/mailer"
@@ -151,6 +154,12 @@ type ReplicationManager struct {
 	TermsDT                                          time.Time                         `json:"termsDT"`
 	ModTimes                                         map[string]time.Time              `json:"termsDT"`
 	fileHook                                         log.Hook
+	auditLog                                         *audit.Log                        `json:"-"`
+	apiTokens                                        *apitoken.Store                   `json:"-"`
+	approvals                                        *approval.Store                   `json:"-"`
+	apiRouter                                        http.Handler                      `json:"-"`
+	apiCertificate                                   certificateGetter                 `json:"-"`
+	apiCertificateServerName                         string                            `json:"-"`
 	repmanv3.UnimplementedClusterPublicServiceServer `json:"-"`
 	repmanv3.UnimplementedClusterServiceServer       `json:"-"`
 	sync.Mutex
@@ -327,6 +336,15 @@ func (repman *ReplicationManager) AddFlags(flags *pflag.FlagSet, conf *config.Co
 	flags.StringVar(&conf.MonitoringSSLKey, "monitoring-ssl-key", "", "HTTPS & API TLS key")
 	flags.StringVar(&conf.MonitoringKeyPath, "monitoring-key-path", "/etc/replication-manager/.replication-manager.key", "Encryption key file path")
 	flags.BoolVar(&conf.MonitoringKeyPathGitOverwrite, "monitoring-key-path-git-overwrite", false, "Force overwrite old secret key in git repo")
+	flags.StringVar(&conf.SecretProvider, "monitoring-secret-provider", "aes", "Provider encrypting the secrets saved in config aes|vault|age|kms, aes uses the monitoring-key-path key")
+	flags.StringVar(&conf.SecretVaultTransitMount, "monitoring-secret-vault-transit-mount", "transit", "Vault transit engine mount path")
+	flags.StringVar(&conf.SecretVaultTransitKey, "monitoring-secret-vault-transit-key", "replication-manager", "Vault transit key name")
+	flags.StringVar(&conf.SecretAgeRecipients, "monitoring-secret-age-recipients", "", "age X25519 recipients separated by commas, default to the recipients of the identity file")
+	flags.StringVar(&conf.SecretAgeIdentity, "monitoring-secret-age-identity", "", "age identity file path needed to decrypt")
+	flags.StringVar(&conf.SecretKMSKeyID, "monitoring-secret-kms-key-id", "", "KMS key id wrapping the data keys")
+	flags.StringVar(&conf.SecretKMSRegion, "monitoring-secret-kms-region", "", "KMS region")
+	flags.StringVar(&conf.SecretKMSEndpoint, "monitoring-secret-kms-endpoint", "", "KMS compatible endpoint url")
+	flags.StringVar(&conf.SecretKMSLocalKeyPath, "monitoring-secret-kms-local-key-path", "", "Wrap the data keys with a local master key file instead of a KMS")
 	flags.BoolVar(&conf.MonitorQueries, "monitoring-queries", true, "Monitor long queries")
 	flags.BoolVar(&conf.MonitorPlugins, "monitoring-plugins", true, "Monitor installed plugins")
 	flags.IntVar(&conf.MonitorLongQueryTime, "monitoring-long-query-time", 10000, "Long query time in ms")
@@ -395,11 +413,29 @@ func (repman *ReplicationManager) AddFlags(flags *pflag.FlagSet, conf *config.Co
 	flags.StringVar(&conf.HostsTlsCliCert, "db-servers-tls-client-cert", "", "Database TLS client certificate")
 	flags.StringVar(&conf.HostsTlsSrvKey, "db-servers-tls-server-key", "", "Database TLS server key to push in config")
 	flags.StringVar(&conf.HostsTlsSrvCert, "db-servers-tls-server-cert", "", "Database TLS server certificate to push in config")
+	flags.IntVar(&conf.CertExpiryWarnDays, "cert-expiry-warn-days", 30, "Warn when a database, proxy, cluster or API certificate expires within this many days")
+	flags.BoolVar(&conf.CertAutoRenew, "cert-auto-renew", false, "Renew the generated cluster certificates before expiry and reload them on servers and proxies one by one")
+	flags.IntVar(&conf.CertAutoRenewDays, "cert-auto-renew-days", 15, "Renew the generated cluster certificates when they expire within this many days")
+	flags.IntVar(&conf.CertRollingReloadWait, "cert-rolling-reload-wait", 5, "Seconds to wait between two servers or proxies during a rolling certificates reload")
+	flags.StringVar(&conf.DBUsers, "db-users", "", "Application users managed on the cluster, name@host|host=privilege+privilege on db.*;privilege on db.table separated by commas")
+	flags.StringVar(&conf.DBUsersCredential, "db-users-credential", "", "Passwords of the managed application users, specified in the [user]:[password] format separated by commas")
+	flags.IntVar(&conf.DBUsersPasswordMinLength, "db-users-password-min-length", 12, "Minimum length of the managed application users passwords")
+	flags.IntVar(&conf.DBUsersPasswordLifetime, "db-users-password-lifetime", 0, "Days before the managed application users passwords expire, 0 never expire")
+	flags.BoolVar(&conf.DBUsersRequireSSL, "db-users-require-ssl", false, "Managed application users must connect with TLS")
+	flags.BoolVar(&conf.DBUsersDriftCheck, "db-users-drift-check", true, "Compare the managed application users with the grants found on database servers and ProxySQL")
+	flags.BoolVar(&conf.DBUsersDriftRemediate, "db-users-drift-remediate", false, "Re-apply the managed application users on the master and ProxySQL when a drift is detected")
+	flags.BoolVar(&conf.SecurityAuditCheck, "security-audit-check", true, "Audit the accounts, TLS settings, local_infile, known vulnerabilities of the version and datadir permissions of database servers")
+	flags.BoolVar(&conf.SecurityAuditAutofix, "security-audit-autofix", false, "Drop anonymous users and disable local_infile when the security audit finds them")
+	flags.StringVar(&conf.SecurityAuditAdvisoriesFile, "security-audit-advisories-file", "", "JSON file of advisories added to the bundled list, id, flavor, severity, summary and fixed releases per branch")
+	flags.StringVar(&conf.ApprovalOperations, "approval-operations", "", "Operations that wait for a second user with the cluster-approve grant, any of failover,dropserver,unprovision,reset-master,reset-slave-all,rotate-passwords,rolling-upgrade,errant-repair,replication-playbook separated by commas")
+	flags.IntVar(&conf.ApprovalTTL, "approval-ttl", 900, "Seconds a pending operation waits for approval before it expires")
 	flags.IntVar(&conf.Timeout, "db-servers-connect-timeout", 5, "Database connection timeout in seconds")
 	flags.IntVar(&conf.ReadTimeout, "db-servers-read-timeout", 3600, "Database read timeout in seconds")
 	flags.StringVar(&conf.PrefMaster, "db-servers-prefered-master", "", "Database preferred candidate in election,  host:[port] format")
 	flags.StringVar(&conf.IgnoreSrv, "db-servers-ignored-hosts", "", "Database list of hosts to ignore in election")
 	flags.StringVar(&conf.IgnoreSrvRO, "db-servers-ignored-readonly", "", "Database list of hosts not changing read only status")
+	flags.StringVar(&conf.DBServersSites, "db-servers-sites", "", "Database servers grouped by site, site=host:[port]|host:[port] separated by commas")
+	flags.StringVar(&conf.MonitoringSite, "monitoring-site", "", "Site where this replication-manager runs, remote sites must stay reachable to failover")
 	flags.StringVar(&conf.BackupServers, "db-servers-backup-hosts", "", "Database list of hosts to backup when set can backup a slave")
 	flags.StringVar(&conf.DbServersChangeStateScript, "db-servers-state-change-script", "", "Database state change script")
 	flags.Int64Var(&conf.SwitchWaitKill, "switchover-wait-kill", 5000, "Switchover wait this many milliseconds before killing threads on demoted master")
@@ -413,11 +449,16 @@ func (repman *ReplicationManager) AddFlags(flags *pflag.FlagSet, conf *config.Co
 	flags.Int64Var(&conf.SwitchDecreaseMaxConnValue, "switchover-decrease-max-conn-value", 10, "Switchover decrease max connection to this value different according to flavor")
 	flags.IntVar(&conf.SwitchSlaveWaitRouteChange, "switchover-wait-route-change", 2, "Switchover wait for unmanged proxy monitor to dicoverd new state")
 	flags.BoolVar(&conf.SwitchLowerRelease, "switchover-lower-release", false, "Allow switchover to lower release")
+	flags.BoolVar(&conf.SwitchDrain, "switchover-drain", false, "Switchover soft offline old master in proxies and wait for in-flight transactions before freezing writes")
+	flags.Int64Var(&conf.SwitchDrainTimeout, "switchover-drain-timeout", 30, "Switchover drain deadline in seconds for client transactions on old master")
+	flags.BoolVar(&conf.SwitchDrainKill, "switchover-drain-kill", true, "Switchover kill remaining client connections on old master when drain deadline is reached")
 
 	flags.StringVar(&conf.MasterConn, "replication-source-name", "", "Replication channel name to use for multisource")
 	flags.StringVar(&conf.ReplicationMultisourceHeadClusters, "replication-multisource-head-clusters", "", "Multi source link to parent cluster, autodiscoverd but can be materialized for bootstraping replication")
+	flags.BoolVar(&conf.ReplicationMultisourceChannelRepoint, "replication-multisource-channel-repoint", false, "After a failover, re-point the named replication channels of other clusters from the old master to the new master")
 	flags.StringVar(&conf.HostsDelayed, "replication-delayed-hosts", "", "Database hosts list that need delayed replication separated by commas")
 	flags.IntVar(&conf.HostsDelayedTime, "replication-delayed-time", 3600, "Delayed replication time")
+	flags.BoolVar(&conf.HostsDelayedElectable, "replication-delayed-electable", false, "Allow delayed replicas to be elected as new master on failover or switchover")
 	flags.IntVar(&conf.MasterConnectRetry, "replication-master-connect-retry", 10, "Replication is define using this connection retry timeout")
 	flags.StringVar(&conf.RplUser, "replication-credential", "root:mariadb", "Replication user in the [user]:[password] format")
 	flags.BoolVar(&conf.ReplicationSSL, "replication-use-ssl", false, "Replication use SSL encryption to replicate from master")
@@ -426,10 +467,24 @@ func (repman *ReplicationManager) AddFlags(flags *pflag.FlagSet, conf *config.Co
 	flags.BoolVar(&conf.MultiMasterConcurrentWrite, "replication-multi-master-concurrent-write", false, "Enable concurrent write on multi-master topology")
 	flags.BoolVar(&conf.MultiMasterGrouprep, "replication-multi-master-grouprep", false, "Enable mysql group replication multi-master")
 	flags.IntVar(&conf.MultiMasterGrouprepPort, "replication-multi-master-grouprep-port", 33061, "Group replication network port")
+	flags.StringVar(&conf.MultiMasterGrouprepMemberWeights, "replication-multi-master-grouprep-member-weights", "", "Group replication election weights host:port=weight,host:port=weight, from 0 to 100")
+	flags.BoolVar(&conf.MultiMasterGrouprepRejoin, "replication-multi-master-grouprep-rejoin", false, "Restart group replication on members expelled from the group")
+	flags.IntVar(&conf.MultiMasterGrouprepRejoinInterval, "replication-multi-master-grouprep-rejoin-interval", 60, "Time in seconds between two rejoin attempts of an expelled member")
 	flags.BoolVar(&conf.MultiMasterWsrep, "replication-multi-master-wsrep", false, "Enable Galera wsrep multi-master")
 	flags.StringVar(&conf.MultiMasterWsrepSSTMethod, "replication-multi-master-wsrep-sst-method", "mariabackup", "mariabackup|xtrabackup-v2|rsync|mysqldump")
 	flags.IntVar(&conf.MultiMasterWsrepPort, "replication-multi-master-wsrep-port", 4567, "wsrep network port")
+	flags.BoolVar(&conf.WsrepRecoverNonPrimary, "wsrep-recover-non-primary", false, "Bootstrap a new primary component on the most advanced node when all wsrep nodes are reachable and none is primary")
+	flags.IntVar(&conf.WsrepNonPrimaryTimeout, "wsrep-non-primary-timeout", 30, "Time in seconds without primary component before recovering it")
+	flags.IntVar(&conf.WsrepFlowControlMaxPaused, "wsrep-flow-control-max-paused", 10, "Alert when a wsrep node is paused by flow control more than this percentage of time")
+	flags.BoolVar(&conf.WsrepBackupDesync, "wsrep-backup-desync", false, "Backup from a synced non leader wsrep node and desync it during the backup")
+	flags.IntVar(&conf.WsrepSyncTimeout, "wsrep-sync-timeout", 1800, "Time in seconds to wait for a wsrep node to be synced during bootstrap and rolling restart")
 	flags.StringVar(&conf.TopologyTarget, "topology-target", "", "Target topology for current cluster. Default 'master-slave'")
+	flags.BoolVar(&conf.TopologyStaging, "topology-staging", false, "Keep a replica of the cluster as staging server that can be detached for tests and refreshed from production")
+	flags.StringVar(&conf.TopologyStagingServer, "staging-server", "", "Staging server host:port, it is never elected and stays writable once detached")
+	flags.StringVar(&conf.TopologyStagingRefreshMethod, "staging-refresh-method", "logicalbackup", "Refresh the staging server from logicalbackup|physicalbackup|clone|script")
+	flags.IntVar(&conf.TopologyStagingRefreshTimeout, "staging-refresh-timeout", 7200, "Time in seconds to wait for the staging server to be restored and catch up with the master")
+	flags.StringVar(&conf.TopologyStagingRefreshScript, "staging-refresh-script", "", "Script to refresh the staging server with the refresh method script, called with host, port, master host, master port")
+	flags.StringVar(&conf.TopologyStagingPostDetachScript, "staging-post-detach-script", "", "Script called after the staging server is detached to mask the data, called with host, port")
 	flags.BoolVar(&conf.DynamicTopology, "replication-dynamic-topology", true, "Auto discover topology when changed") //Set to true to keep same behavior
 	flags.BoolVar(&conf.MultiMasterRing, "replication-multi-master-ring", false, "Multi-master ring topology")
 	flags.BoolVar(&conf.MultiMasterRingUnsafe, "replication-multi-master-ring-unsafe", true, "Allow multi-master ring topology without log slave updates") //Set to true to keep same behavior
@@ -439,6 +494,12 @@ func (repman *ReplicationManager) AddFlags(flags *pflag.FlagSet, conf *config.Co
 	flags.BoolVar(&conf.ReplicationNoRelay, "replication-master-slave-never-relay", true, "Do not allow relay server MSS MXS XXM RSM")
 	flags.StringVar(&conf.ReplicationErrorScript, "replication-error-script", "", "Replication error script")
 	flags.StringVar(&conf.ReplicationRestartOnSQLErrorMatch, "replication-restart-on-sqlerror-match", "", "Auto restart replication on SQL Error regexep")
+	flags.BoolVar(&conf.ReplicationPlaybook, "replication-playbook", false, "Classify the replication errors of the replicas and run the playbook of the error class")
+	flags.StringVar(&conf.ReplicationPlaybooks, "replication-playbooks", "duplicate-key=skip-verified,row-not-found=fetch-row,missing-table=reseed,relay-log=fix-relay,missing-binlog=none", "Playbook of each replication error class duplicate-key|row-not-found|missing-table|relay-log|missing-binlog|unknown as class=skip-verified|fetch-row|fix-relay|reseed|none separated by commas")
+	flags.IntVar(&conf.ReplicationPlaybookMinInterval, "replication-playbook-min-interval", 60, "Minimum time in seconds between two playbook runs on the same replica")
+	flags.IntVar(&conf.ReplicationPlaybookWindow, "replication-playbook-window", 3600, "Time in seconds over which the playbook runs of a replica are counted")
+	flags.IntVar(&conf.ReplicationPlaybookApprovalThreshold, "replication-playbook-approval-threshold", 5, "Number of automatic playbook runs on a replica within the window after which a run waits for approval in the approval queue, 0 for no limit")
+	flags.StringVar(&conf.ReplicationPlaybookReseedMethod, "replication-playbook-reseed-method", "physicalbackup", "Reseed a replica from logicalbackup|physicalbackup|clone in the reseed playbook")
 
 	flags.StringVar(&conf.PreScript, "failover-pre-script", "", "Path of pre-failover script")
 	flags.StringVar(&conf.PostScript, "failover-post-script", "", "Path of post-failover script")
@@ -450,6 +511,8 @@ func (repman *ReplicationManager) AddFlags(flags *pflag.FlagSet, conf *config.Co
 	flags.StringVar(&conf.FailoverMdevLevel, "failover-mdev-level", "blocker", "Failover is prevented if cluster has MDEV issues with severity level. Bug level will also include higher severity i.e. critical will also have blocker. Valid values are (blocker|critical|major). Default 'blocker'")
 	flags.Int64Var(&conf.FailMaxDelay, "failover-max-slave-delay", 30, "Election ignore slave with replication delay over this time in sec")
 	flags.BoolVar(&conf.FailRestartUnsafe, "failover-restart-unsafe", false, "Failover when cluster down if a slave is start first ")
+	flags.StringVar(&conf.FailoverSitePolicy, "failover-site-policy", "any", "Failover site policy any|prefer-local|local-only|manual-cross-site, local is the site of the failed master, local-only and manual-cross-site keep automatic failover local, manual-cross-site only promotes a prefered master of another site on a manual switchover or failover")
+	flags.BoolVar(&conf.FailoverSiteQuorum, "failover-site-quorum", true, "Cancel failover when a remote site is unreachable unless the arbitrator or a peer replication-manager confirms")
 	flags.IntVar(&conf.FailLimit, "failover-limit", 5, "Failover is canceld if already failover this number of time (0: unlimited)")
 	flags.Int64Var(&conf.FailTime, "failover-time-limit", 0, "Failover is canceled if timer in sec is not passed with previous failover (0: do not wait)")
 	flags.BoolVar(&conf.FailSync, "failover-at-sync", false, "Failover only when state semisync is sync for last status")
@@ -503,6 +566,14 @@ func (repman *ReplicationManager) AddFlags(flags *pflag.FlagSet, conf *config.Co
 	flags.BoolVar(&conf.CheckGrants, "check-grants", true, "Check that possible master have equal grants")
 	flags.BoolVar(&conf.RplChecks, "check-replication-state", true, "Check replication status when electing master server")
 	flags.BoolVar(&conf.RplCheckErrantTrx, "check-replication-errant-trx", true, "Check replication have no errant transaction in MySQL GTID")
+	flags.StringVar(&conf.RplErrantRepairRecloneMethod, "replication-errant-repair-reclone-method", "physicalbackup", "Re-clone a replica with errant transactions from logicalbackup|physicalbackup|clone")
+	flags.IntVar(&conf.RplErrantRepairMaxTrx, "replication-errant-repair-max-trx", 1000, "Maximum number of errant transactions to extract, inject or flashback in a repair job")
+	flags.BoolVar(&conf.ConsistencyCheck, "consistency-check", false, "Continuously checksum every table in chunks on the master and compare the replicated checksums on each replica")
+	flags.IntVar(&conf.ConsistencyCheckChunkSize, "consistency-check-chunk-size", 1000, "Number of rows per checksum chunk")
+	flags.IntVar(&conf.ConsistencyCheckChunkRate, "consistency-check-chunk-rate", 10, "Maximum number of chunks checksummed per second")
+	flags.IntVar(&conf.ConsistencyCheckMaxLag, "consistency-check-max-lag", 10, "Pause the consistency check while a replica delay in seconds is above this value")
+	flags.IntVar(&conf.ConsistencyCheckInterval, "consistency-check-interval", 86400, "Time in seconds between the end of a consistency check pass and the start of the next one")
+	flags.BoolVar(&conf.ConsistencyCheckResync, "consistency-check-resync", false, "Resync divergent chunks at the end of each pass, master rows are replayed to the replicas with binlog format STATEMENT")
 	flags.IntVar(&conf.CheckBinServerId, "check-binlog-server-id", 10000, "Server ID for checking binlogs timestamps")
 
 	flags.StringVar(&conf.APIPort, "api-port", "10005", "Rest API listen port")
@@ -512,14 +583,49 @@ func (repman *ReplicationManager) AddFlags(flags *pflag.FlagSet, conf *config.Co
 	flags.StringVar(&conf.APIUsersACLAllowExternal, "api-credentials-acl-allow-external", "", "User dynamic acl allow")
 	flags.StringVar(&conf.APIUsersACLDiscard, "api-credentials-acl-discard", "", "User acl discard")
 	flags.StringVar(&conf.APIUsersACLDiscardExternal, "api-credentials-acl-discard-external", "", "User dynamic acl discard")
+	flags.StringVar(&conf.APIRBACRoles, "api-rbac-roles", "", "Custom roles name=rule;rule separated by comma, a rule is allow|deny grant... [on server:<name>|proxy:<name>|tag:<tag>|role:<master|slave>]")
+	flags.StringVar(&conf.APIRBACBindings, "api-rbac-bindings", "", "Custom roles of users user:role role separated by comma")
+	flags.StringVar(&conf.APILDAPURL, "api-ldap-url", "", "LDAP or Active Directory URL for API login as ldap://host:389 or ldaps://host:636, empty to disable")
+	flags.StringVar(&conf.APILDAPBindDN, "api-ldap-bind-dn", "", "LDAP service account DN used to search users and groups, empty for anonymous search")
+	flags.StringVar(&conf.APILDAPBindPassword, "api-ldap-bind-password", "", "LDAP service account password")
+	flags.StringVar(&conf.APILDAPBaseDN, "api-ldap-base-dn", "", "LDAP base DN of user search")
+	flags.StringVar(&conf.APILDAPUserFilter, "api-ldap-user-filter", "(uid=%s)", "LDAP user search filter %s is the login, (sAMAccountName=%s) for Active Directory")
+	flags.StringVar(&conf.APILDAPEmailAttr, "api-ldap-email-attr", "mail", "LDAP user email attribute")
+	flags.StringVar(&conf.APILDAPGroupBaseDN, "api-ldap-group-base-dn", "", "LDAP base DN of group search, default to api-ldap-base-dn")
+	flags.StringVar(&conf.APILDAPGroupFilter, "api-ldap-group-filter", "", "LDAP group search filter %s is the login and %d the user DN, default (|(member=%d)(uniqueMember=%d)(memberUid=%s)) when api-ldap-memberof-attr is empty")
+	flags.StringVar(&conf.APILDAPGroupAttr, "api-ldap-group-attr", "cn", "LDAP group name attribute")
+	flags.StringVar(&conf.APILDAPMemberOfAttr, "api-ldap-memberof-attr", "", "LDAP user attribute listing group DNs, memberOf for Active Directory")
+	flags.BoolVar(&conf.APILDAPStartTLS, "api-ldap-start-tls", false, "LDAP upgrade connection with StartTLS")
+	flags.BoolVar(&conf.APILDAPInsecureSkipVerify, "api-ldap-tls-insecure-skip-verify", false, "LDAP skip TLS certificate verification")
+	flags.StringVar(&conf.APILDAPGroupACL, "api-ldap-group-acl-allow", "", "LDAP group acl allow group:grants:clusters:roles separated by comma, users get the union of their groups")
+	flags.StringVar(&conf.APITokensFile, "api-tokens-file", "", "Service account API tokens file, default <monitoring-datadir>/api-tokens.json")
 	flags.StringVar(&conf.APIBind, "api-bind", "0.0.0.0", "Rest API bind ip")
 	flags.BoolVar(&conf.APIHttpsBind, "api-https-bind", false, "Bind API call to https Web UI will error with http")
+	flags.BoolVar(&conf.APIHttpsACME, "api-https-acme", false, "Get and renew the API HTTPS certificate from an ACME server like Let's Encrypt")
+	flags.StringVar(&conf.APIHttpsACMEDomains, "api-https-acme-domains", "", "API HTTPS certificate domains separated by comma")
+	flags.StringVar(&conf.APIHttpsACMEDirectoryURL, "api-https-acme-directory-url", "https://acme-v02.api.letsencrypt.org/directory", "ACME server directory URL")
+	flags.StringVar(&conf.APIHttpsACMEEmail, "api-https-acme-email", "", "ACME account contact email")
+	flags.StringVar(&conf.APIHttpsACMECacheDir, "api-https-acme-cache-dir", "", "ACME account and certificates cache, default <monitoring-datadir>/acme")
+	flags.StringVar(&conf.APIHttpsACMECACert, "api-https-acme-ca-cert", "", "CA certificate trusted for the ACME server, for a private or test ACME server")
+	flags.StringVar(&conf.APIHttpsACMEHTTPBind, "api-https-acme-http-bind", "", "Listen address answering ACME http-01 challenges like :80, empty to only use tls-alpn-01 on the API port")
 	flags.BoolVar(&conf.APISecureConfig, "api-credentials-secure-config", false, "Need JWT token to download config tar.gz")
 	flags.StringVar(&conf.APIPublicURL, "api-public-url", "https://127.0.0.1:10005", "Public address of monitoring API Used for cloud18 OAuth callback")
 	flags.StringVar(&conf.OAuthProvider, "api-oauth-provider-url", "https://gitlab.signal18.io", "API OAuth Provider URL")
 	flags.StringVar(&conf.OAuthClientID, "api-oauth-client-id", "", "API OAuth Client ID")
 	flags.StringVar(&conf.OAuthClientSecret, "api-oauth-client-secret", "", "API OAuth Client Secret")
 
+	flags.BoolVar(&conf.DNSServer, "dns-server", false, "Enable embedded authoritative DNS server answering <cluster>-rw and <cluster>-ro A and SRV records")
+	flags.StringVar(&conf.DNSServerBind, "dns-server-bind", "0.0.0.0:8053", "Embedded DNS server UDP and TCP listen address")
+	flags.StringVar(&conf.DNSServerDomain, "dns-server-domain", "repman.local", "Embedded DNS server authoritative zone")
+	flags.IntVar(&conf.DNSServerTTL, "dns-server-ttl", 1, "Embedded DNS server records TTL in seconds")
+	flags.Int64Var(&conf.DNSServerReadMaxDelay, "dns-server-ro-max-delay", 30, "Embedded DNS server exclude replicas from <cluster>-ro when delay exceed this many seconds, 0 to disable")
+
+	flags.BoolVar(&conf.AuditLog, "audit-log", false, "Record every mutating API and gRPC call in a hash chained audit log, the server does not start when the log can not be opened")
+	flags.StringVar(&conf.AuditLogFile, "audit-log-file", "", "Audit log file, default <monitoring-datadir>/audit.log")
+	flags.BoolVar(&conf.AuditLogSyslog, "audit-log-syslog", false, "Ship audit records to syslog")
+	flags.StringVar(&conf.AuditLogSyslogAddr, "audit-log-syslog-addr", "localhost:514", "Syslog UDP address for audit records")
+	flags.StringVar(&conf.AuditLogKey, "audit-log-key", "", "Secret key of the HMAC chaining audit records, without key anyone able to write the file can rewrite the chain")
+
 	//vault
 	flags.StringVar(&conf.VaultServerAddr, "vault-server-addr", "", "Vault server address")
 	flags.StringVar(&conf.VaultRoleId, "vault-role-id", "", "Vault role id")
@@ -528,6 +634,7 @@ func (repman *ReplicationManager) AddFlags(flags *pflag.FlagSet, conf *config.Co
 	flags.StringVar(&conf.VaultMount, "vault-mount", "kv", "Vault mount for the secret")
 	flags.StringVar(&conf.VaultAuth, "vault-auth", "approle", "Vault auth method : approle|userpass|ldap|token|github|alicloud|aws|azure|gcp|kerberos|kubernetes|radius")
 	flags.StringVar(&conf.VaultToken, "vault-token", "", "Vault Token")
+	flags.IntVar(&conf.VaultLeaseRenewThreshold, "vault-lease-renew-threshold", 33, "Renew Vault database credentials leases when less than this percentage of the lease is left")
 	flags.BoolVar(&conf.LogVault, "log-vault", true, "Log vault debug")
 	flags.IntVar(&conf.LogVaultLevel, "log-vault-level", 1, "Log level for vault")
 
@@ -603,6 +710,8 @@ func (repman *ReplicationManager) AddFlags(flags *pflag.FlagSet, conf *config.Co
 	flags.IntVar(&conf.PRXServersBackendMaxReplicationLag, "proxy-servers-backend-max-replication-lag", 30, "Max lag to send query to read  backends ")
 	flags.IntVar(&conf.PRXServersBackendMaxConnections, "proxy-servers-backend-max-connections", 1000, "Max connections on backends ")
 	flags.StringVar(&conf.PRXServersChangeStateScript, "proxy-servers-state-change-script", "", "Proxy state change script")
+	flags.BoolVar(&conf.PRXDriftCheck, "proxy-drift-check", false, "Compare proxies runtime backends, users and rules with the state expected from the topology")
+	flags.BoolVar(&conf.PRXDriftRemediate, "proxy-drift-remediate", false, "Re-apply the expected state on proxies when a drift is detected")
 
 	externalprx := new(cluster.ExternalProxy)
 	externalprx.AddFlags(flags, conf)
@@ -704,6 +813,14 @@ func (repman *ReplicationManager) AddFlags(flags *pflag.FlagSet, conf *config.Co
 	flags.StringVar(&conf.SchedulerSLARotateCron, "scheduler-sla-rotate-cron", "0 0 0 1 * *", "SLA rotate cron expression represents a set of times, using 6 space-separated fields.")
 	flags.BoolVar(&conf.SchedulerRollingRestart, "scheduler-rolling-restart", false, "Schedule rolling restart")
 	flags.StringVar(&conf.SchedulerRollingRestartCron, "scheduler-rolling-restart-cron", "0 30 11 * * *", "Rolling restart cron expression represents a set of times, using 6 space-separated fields.")
+	flags.StringVar(&conf.UpgradeMethod, "upgrade-method", "ssh", "Rolling upgrade of database servers via ssh|provision, ssh runs upgrade-ssh-script on the host, provision reprovisions the service with the orchestrator")
+	flags.StringVar(&conf.UpgradeSSHScript, "upgrade-ssh-script", "", "Script run over onpremise ssh to upgrade the database packages of a stopped server, REPLICATION_MANAGER_UPGRADE_VERSION is exported")
+	flags.StringVar(&conf.UpgradeTargetVersion, "upgrade-target-version", "", "Version expected after the upgrade of a server, servers already at this version are not upgraded")
+	flags.StringVar(&conf.UpgradeClientPath, "upgrade-client-path", "", "Path to mariadb-upgrade or mysql_upgrade, default search the path of the repman host")
+	flags.StringVar(&conf.UpgradeChecksumTables, "upgrade-checksum-tables", "", "List of schema.table checksumed after each server upgrade, default a sample of the master tables")
+	flags.IntVar(&conf.UpgradeChecksumSample, "upgrade-checksum-sample", 3, "Number of master tables checksumed after each server upgrade when upgrade-checksum-tables is empty, 0 to disable")
+	flags.BoolVar(&conf.SchedulerStagingRefresh, "scheduler-staging-refresh", false, "Schedule refresh and detach of the staging server")
+	flags.StringVar(&conf.SchedulerStagingRefreshCron, "scheduler-staging-refresh-cron", "0 0 6 * * *", "Staging refresh cron expression represents a set of times, using 6 space-separated fields.")
 	flags.BoolVar(&conf.SchedulerRollingReprov, "scheduler-rolling-reprov", false, "Schedule rolling reprov")
 	flags.StringVar(&conf.SchedulerRollingReprovCron, "scheduler-rolling-reprov-cron", "0 30 10 * * 5", "Rolling reprov cron expression represents a set of times, using 6 space-separated fields.")
 	flags.BoolVar(&conf.SchedulerJobsSSH, "scheduler-jobs-ssh", false, "Schedule remote execution of dbjobs via ssh ")
@@ -1970,12 +2087,21 @@ func (repman *ReplicationManager) Run() error {
 	repman.initKeys()
 
 	//	repman.currentCluster.SetCfgGroupDisplay(strClusters)
+	// The audit log is opened before the API listens, no mutating call goes unrecorded
+	if repman.Conf.AuditLog {
+		repman.initAuditLog()
+	}
 	if repman.Conf.ApiServ {
+		repman.initAPITokens()
+		repman.approvals = approval.NewStore()
 		go repman.apiserver()
 	} else {
 		// No need to wait for API listener to limit privilege
 		repman.IsApiListenerReady = true
 	}
+	if repman.Conf.DNSServer {
+		go repman.dnsserver()
+	}
 	// HTTP server should start after Cluster Init or may lead to various nil pointer if clients still requesting
 	if repman.Conf.HttpServ {
 		go repman.httpserver()
@@ -2072,9 +2198,11 @@ func (repman *ReplicationManager) Run() error {
 			//			agents = svc.GetNodes()
 		}
 		time.Sleep(time.Second * time.Duration(repman.Conf.MonitoringTicker))
+		repman.requestPlaybookApprovals()
 
 		if counter%60 == 0 {
 			repman.Save()
+			go repman.checkAPICertificate()
 
 			if repman.Conf.GitUrl != "" {
 				repman.PushAllConfigsToGit()
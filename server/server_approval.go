@@ -0,0 +1,248 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/codegangsta/negroni"
+	"github.com/gorilla/mux"
+	"github.com/signal18/replication-manager/utils/approval"
+	"github.com/signal18/replication-manager/utils/audit"
+)
+
+// approvalContextKey marks the replay of an approved operation, it can not be set by a client
+type approvalContextKey struct{}
+
+// approvalHeaders are the request headers kept to replay an operation, the credentials of
+// the requester may have expired when the operation is approved and are not kept
+var approvalHeaders = []string{"Content-Type"}
+
+// getApprovalReplay returns the approved operation replayed by a request, the replay runs
+// with the authority of the server on behalf of the requester
+func (repman *ReplicationManager) getApprovalReplay(r *http.Request) (approval.Operation, bool) {
+	id, ok := r.Context().Value(approvalContextKey{}).(string)
+	if !ok || repman.approvals == nil {
+		return approval.Operation{}, false
+	}
+	op, err := repman.approvals.Get(id)
+	if err != nil || op.Status != approval.StatusApproved || op.Path != r.URL.Path || op.Method != r.Method {
+		return approval.Operation{}, false
+	}
+	return op, true
+}
+
+// getRequestOwner returns the user behind a request, the creator of an API token or the
+// user itself, following tokens created with another token
+func (repman *ReplicationManager) getRequestOwner(r *http.Request, user string) string {
+	if !isAPITokenRequest(r) || repman.apiTokens == nil {
+		return user
+	}
+	tok, err := repman.getAPITokenFromRequest(r)
+	if err != nil {
+		return user
+	}
+	owner := tok.CreatedBy
+	tokens := repman.apiTokens.List()
+	for i := 0; i < len(tokens); i++ {
+		found := false
+		for _, t := range tokens {
+			if t.User() == owner && t.CreatedBy != "" {
+				owner = t.CreatedBy
+				found = true
+				break
+			}
+		}
+		if !found {
+			break
+		}
+	}
+	if owner == "" {
+		return user
+	}
+	return owner
+}
+
+func (repman *ReplicationManager) writeApprovalRecord(op approval.Operation, step string, user string, err error) {
+	repman.Logrus.Infof("Operation %s %s on cluster %s %s by %s", op.ID, op.Action, op.Cluster, step, user)
+	if repman.auditLog == nil {
+		return
+	}
+	rec := audit.Record{
+		User:       user,
+		SourceIP:   op.SourceIP,
+		AuthMethod: audit.AuthNone,
+		Origin:     "approval",
+		Cluster:    op.Cluster,
+		Action:     "approval/" + step,
+		Method:     op.Method,
+		Path:       op.Path,
+		Params:     map[string]string{"id": op.ID, "operation": op.Action, "requester": op.Requester, "status": op.Status},
+		Result:     audit.ResultSuccess,
+		Status:     op.Code,
+	}
+	if op.Owner != "" && op.Owner != op.Requester {
+		rec.Params["owner"] = op.Owner
+	}
+	if op.Decider != "" {
+		rec.Params["decider"] = op.Decider
+	}
+	if op.DecidedBy != "" {
+		rec.Params["decidedBy"] = op.DecidedBy
+	}
+	if op.Reason != "" {
+		rec.Params["reason"] = op.Reason
+	}
+	if err != nil {
+		rec.Result = audit.ResultFailure
+		rec.Error = err.Error()
+	} else if op.Status == approval.StatusFailed {
+		rec.Result = audit.ResultFailure
+		rec.Error = op.Result
+	}
+	repman.writeAuditRecord(rec)
+}
+
+// expireApprovals records the pending operations that were not approved in time
+func (repman *ReplicationManager) expireApprovals() {
+	for _, op := range repman.approvals.Expire(time.Now()) {
+		repman.writeApprovalRecord(op, "expire", "", nil)
+	}
+}
+
+// playbookApprovalRequester is the requester of the playbook runs held by the monitoring, any user
+// with the grants of the approvals may approve them
+const playbookApprovalRequester = "replication-manager"
+
+// requestPlaybookApprovals registers the automatic playbook runs held above
+// replication-playbook-approval-threshold, an approved run is replayed as a manual run
+func (repman *ReplicationManager) requestPlaybookApprovals() {
+	if repman.approvals == nil {
+		return
+	}
+	for _, cl := range repman.Clusters {
+		for _, server := range cl.PopPlaybookApprovals() {
+			op := repman.approvals.Request(approval.Operation{
+				Cluster:   cl.Name,
+				Action:    "replication-playbook",
+				Method:    http.MethodPost,
+				Path:      "/api/clusters/" + cl.Name + "/servers/" + server.Id + "/actions/replication-playbook",
+				Requester: playbookApprovalRequester,
+			}, time.Duration(cl.Conf.ApprovalTTL)*time.Second, time.Now())
+			repman.writeApprovalRecord(op, "request", playbookApprovalRequester, nil)
+		}
+	}
+}
+
+// approvalMiddleware holds an operation listed in approval-operations of the cluster until
+// another user approves it, the caller gets the pending operation with status 202
+func (repman *ReplicationManager) approvalMiddleware(operation string) negroni.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+		mycluster := repman.getClusterByName(mux.Vars(r)["clusterName"])
+		if mycluster == nil || repman.approvals == nil || !mycluster.IsApprovalRequired(operation) {
+			next(w, r)
+			return
+		}
+		if _, ok := r.Context().Value(approvalContextKey{}).(string); ok {
+			if _, ok := repman.getApprovalReplay(r); !ok {
+				http.Error(w, "Operation is not approved", 403)
+				return
+			}
+			next(w, r)
+			return
+		}
+		valid, user := repman.IsValidClusterACL(r, mycluster)
+		if !valid {
+			// the handler answers with its own error
+			next(w, r)
+			return
+		}
+		repman.expireApprovals()
+		var body []byte
+		if r.Body != nil {
+			body, _ = io.ReadAll(r.Body)
+			r.Body.Close()
+		}
+		header := make(map[string][]string)
+		for _, h := range approvalHeaders {
+			if v := r.Header.Values(h); len(v) > 0 {
+				header[h] = v
+			}
+		}
+		op := repman.approvals.Request(approval.Operation{
+			Cluster:   mycluster.Name,
+			Action:    operation,
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			Query:     r.URL.RawQuery,
+			Requester: user,
+			Owner:     repman.getRequestOwner(r, user),
+			SourceIP:  remoteIP(r.RemoteAddr),
+			Body:      body,
+			Header:    header,
+		}, time.Duration(mycluster.Conf.ApprovalTTL)*time.Second, time.Now())
+		repman.writeApprovalRecord(op, "request", user, nil)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		e := json.NewEncoder(w)
+		e.SetIndent("", "\t")
+		e.Encode(op)
+	}
+}
+
+type approvalResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *approvalResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *approvalResponseWriter) WriteHeader(code int) {
+	w.status = code
+}
+
+func (w *approvalResponseWriter) Write(b []byte) (int, error) {
+	if w.body.Len() < 1024 {
+		w.body.Write(b)
+	}
+	return len(b), nil
+}
+
+// executeApproval replays an approved operation through the API router with the authority
+// of the server on behalf of its requester, the result records both the requester and the
+// approver
+func (repman *ReplicationManager) executeApproval(op approval.Operation) {
+	ctx := context.WithValue(context.Background(), approvalContextKey{}, op.ID)
+	req, err := http.NewRequestWithContext(ctx, op.Method, op.Path, bytes.NewReader(op.Body))
+	if err != nil {
+		op, _ = repman.approvals.Finish(op.ID, http.StatusInternalServerError, err.Error())
+		repman.writeApprovalRecord(op, "execute", op.Requester, err)
+		return
+	}
+	req.URL.RawQuery = op.Query
+	for k, v := range op.Header {
+		req.Header[k] = v
+	}
+	req.RemoteAddr = net.JoinHostPort(op.SourceIP, "0")
+	rw := &approvalResponseWriter{header: make(http.Header), status: http.StatusOK}
+	repman.apiRouter.ServeHTTP(rw, req)
+	op, _ = repman.approvals.Finish(op.ID, rw.status, strings.TrimSpace(rw.body.String()))
+	repman.writeApprovalRecord(op, "execute", op.Requester, nil)
+}
@@ -0,0 +1,323 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/syslog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	jwt "github.com/golang-jwt/jwt"
+	"github.com/gorilla/mux"
+	v3 "github.com/signal18/replication-manager/repmanv3"
+	"github.com/signal18/replication-manager/utils/apitoken"
+	"github.com/signal18/replication-manager/utils/audit"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// auditMaxBody is the largest request body parsed for parameters
+const auditMaxBody = 1 << 20
+
+// initAuditLog opens the audit log and stops the server when it can not be opened
+func (repman *ReplicationManager) initAuditLog() {
+	path := repman.Conf.AuditLogFile
+	if path == "" {
+		path = repman.Conf.WorkingDir + "/audit.log"
+	}
+	key := repman.Conf.GetDecryptedValue("audit-log-key")
+	if key == "" {
+		repman.Logrus.Warnf("No audit-log-key, audit records are chained without key and can be rewritten by anyone able to write %s", path)
+	}
+	l, err := audit.Open(path, []byte(key))
+	if err != nil {
+		// a broken chain or an unwritable file must not leave the server running unaudited
+		repman.Logrus.Fatalf("Could not open audit log %s, fix or move the file before starting with audit-log: %s", path, err)
+	}
+	if repman.Conf.AuditLogSyslog {
+		w, err := syslog.Dial("udp", repman.Conf.AuditLogSyslogAddr, syslog.LOG_INFO|syslog.LOG_AUTH, "replication-manager-audit")
+		if err != nil {
+			repman.Logrus.Errorf("Could not connect audit log to syslog %s: %s", repman.Conf.AuditLogSyslogAddr, err)
+		} else {
+			l.SetSyslog(w)
+		}
+	}
+	repman.Logrus.Infof("Audit log to file: %s", path)
+	repman.auditLog = l
+}
+
+func (repman *ReplicationManager) writeAuditRecord(rec audit.Record) {
+	if _, err := repman.auditLog.Append(rec); err != nil {
+		repman.Logrus.Errorf("Could not write audit record for %s: %s", rec.Action, err)
+	}
+}
+
+// isAuditedRequest selects the mutating calls, the client triggers actions with GET
+func isAuditedRequest(r *http.Request) bool {
+	if r.URL.Path == "/api/login" || r.URL.Path == "/api/auth/callback" {
+		return true
+	}
+	if !strings.HasPrefix(r.URL.Path, "/api/") {
+		return false
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return strings.Contains(r.URL.Path, "/actions/")
+	}
+	return true
+}
+
+type auditResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *auditResponseWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *auditResponseWriter) Write(b []byte) (int, error) {
+	// keep the start of error messages for the record
+	if w.status >= http.StatusBadRequest && w.body.Len() < 256 {
+		w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// readAuditParams collects path variables, query string and body fields of a request,
+// the body is restored for the handler
+func readAuditParams(r *http.Request) map[string]string {
+	params := make(map[string]string)
+	for k, v := range r.URL.Query() {
+		params[k] = strings.Join(v, ",")
+	}
+	for k, v := range mux.Vars(r) {
+		params[k] = v
+	}
+	if r.Body == nil || strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+		return params
+	}
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil || len(body) == 0 || len(body) > auditMaxBody {
+		return params
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		if values, err := url.ParseQuery(string(body)); err == nil {
+			for k, v := range values {
+				params[k] = strings.Join(v, ",")
+			}
+		}
+		return params
+	}
+	var doc interface{}
+	if json.Unmarshal(body, &doc) == nil {
+		audit.Flatten("", doc, params)
+	}
+	return params
+}
+
+func remoteIP(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// auditMiddleware records every mutating API call with its user, source, parameters
+// and result in the audit log
+func (repman *ReplicationManager) auditMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if repman.auditLog == nil || !isAuditedRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		params := readAuditParams(r)
+		rec := audit.Record{
+			SourceIP:   remoteIP(r.RemoteAddr),
+			AuthMethod: audit.AuthNone,
+			Origin:     "api",
+			Cluster:    params["clusterName"],
+			Method:     r.Method,
+			Path:       audit.RedactString(r.URL.Path, params),
+			Params:     audit.Redact(params),
+		}
+		switch r.URL.Path {
+		case "/api/login":
+			rec.User = params["username"]
+			rec.AuthMethod = audit.AuthPassword
+		case "/api/auth/callback":
+			rec.AuthMethod = audit.AuthOAuth
+		default:
+			if claims, err := repman.GetJWTClaims(r); err == nil {
+				rec.User = claims["User"]
+				rec.AuthMethod = audit.AuthJWT
+				if claims["profile"] != "" {
+					rec.AuthMethod = audit.AuthOAuth
+				} else if claims["Auth"] == "ldap" {
+					rec.AuthMethod = audit.AuthLDAP
+				} else if claims["Auth"] == "token" {
+					rec.AuthMethod = audit.AuthToken
+				}
+			}
+		}
+		rec.Action = strings.TrimPrefix(r.URL.Path, "/api/")
+		if route := mux.CurrentRoute(r); route != nil {
+			if tpl, err := route.GetPathTemplate(); err == nil {
+				rec.Action = strings.TrimPrefix(strings.TrimPrefix(tpl, "/api/"), "clusters/{clusterName}/")
+			}
+		}
+
+		aw := &auditResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(aw, r)
+
+		rec.Status = aw.status
+		rec.Result = audit.ResultSuccess
+		if aw.status >= http.StatusBadRequest {
+			rec.Result = audit.ResultFailure
+			rec.Error = strings.TrimSpace(aw.body.String())
+		}
+		repman.writeAuditRecord(rec)
+	})
+}
+
+// grpcAuditUser returns the user and auth method of the bearer token of a gRPC call
+func (repman *ReplicationManager) grpcAuditUser(ctx context.Context) (string, string) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", audit.AuthNone
+	}
+	auth := md.Get("authorization")
+	if len(auth) == 0 || len(auth[0]) < 7 || strings.ToUpper(auth[0][0:7]) != "BEARER " {
+		return "", audit.AuthNone
+	}
+	if apitoken.IsToken(auth[0][7:]) {
+		if tok, err := repman.getAPITokenFromContext(ctx, auth[0][7:]); err == nil {
+			return tok.User(), audit.AuthToken
+		}
+		return "", audit.AuthToken
+	}
+	token, err := jwt.Parse(auth[0][7:], func(token *jwt.Token) (interface{}, error) {
+		vk, _ := jwt.ParseRSAPublicKeyFromPEM(verificationKey)
+		return vk, nil
+	})
+	if err != nil {
+		return "", audit.AuthNone
+	}
+	userinfo, ok := token.Claims.(jwt.MapClaims)["CustomUserInfo"].(map[string]interface{})
+	if !ok {
+		return "", audit.AuthNone
+	}
+	if profile, ok := userinfo["profile"].(string); ok && strings.Contains(profile, repman.Conf.OAuthProvider) {
+		email, _ := userinfo["email"].(string)
+		return email, audit.AuthOAuth
+	}
+	name, _ := userinfo["Name"].(string)
+	if auth, _ := userinfo["Auth"].(string); auth == "ldap" {
+		return name, audit.AuthLDAP
+	}
+	return name, audit.AuthJWT
+}
+
+// isAuditedGrpcMethod selects the gRPC calls that change something
+func isAuditedGrpcMethod(fullMethod string) bool {
+	name := fullMethod[strings.LastIndex(fullMethod, "/")+1:]
+	return !strings.HasPrefix(name, "Get") && !strings.HasPrefix(name, "Retrieve") && name != "ClusterStatus"
+}
+
+// auditServerStream keeps the first message received on a stream for the audit record
+type auditServerStream struct {
+	grpc.ServerStream
+	first interface{}
+}
+
+func (s *auditServerStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil && s.first == nil {
+		s.first = m
+	}
+	return err
+}
+
+// grpcAuditRecord returns the record of a gRPC call with the parameters and cluster of msg
+func (repman *ReplicationManager) grpcAuditRecord(ctx context.Context, fullMethod string, msg interface{}) audit.Record {
+	params := make(map[string]string)
+	if m, ok := msg.(proto.Message); ok {
+		if b, err := protojson.Marshal(m); err == nil {
+			var doc interface{}
+			if json.Unmarshal(b, &doc) == nil {
+				audit.Flatten("", doc, params)
+			}
+		}
+	}
+	rec := audit.Record{
+		Origin: "grpc",
+		Action: fullMethod[strings.LastIndex(fullMethod, "/")+1:],
+		Method: "grpc",
+		Path:   fullMethod,
+		Params: audit.Redact(params),
+	}
+	rec.User, rec.AuthMethod = repman.grpcAuditUser(ctx)
+	if p, ok := peer.FromContext(ctx); ok {
+		rec.SourceIP = remoteIP(p.Addr.String())
+	}
+	if cMsg, ok := msg.(v3.ContainsClusterMessage); ok {
+		if c, err := cMsg.GetClusterMessage(); err == nil && c != nil {
+			rec.Cluster = c.Name
+		}
+	}
+	return rec
+}
+
+func (repman *ReplicationManager) writeGrpcAuditRecord(rec audit.Record, err error) {
+	rec.Result = audit.ResultSuccess
+	if err != nil {
+		rec.Result = audit.ResultFailure
+		rec.Status = int(status.Code(err))
+		rec.Error = err.Error()
+	}
+	repman.writeAuditRecord(rec)
+}
+
+// auditGrpcStream runs a stream gRPC handler and records the call in the audit log with
+// the parameters of the first received message
+func (repman *ReplicationManager) auditGrpcStream(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if repman.auditLog == nil || !isAuditedGrpcMethod(info.FullMethod) {
+		return handler(srv, stream)
+	}
+	as := &auditServerStream{ServerStream: stream}
+	err := handler(srv, as)
+	repman.writeGrpcAuditRecord(repman.grpcAuditRecord(stream.Context(), info.FullMethod, as.first), err)
+	return err
+}
+
+// auditGrpc runs a unary gRPC handler and records the call in the audit log
+func (repman *ReplicationManager) auditGrpc(ctx context.Context, req v3.ContainsClusterMessage, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if repman.auditLog == nil || !isAuditedGrpcMethod(info.FullMethod) {
+		return handler(ctx, req)
+	}
+	rec := repman.grpcAuditRecord(ctx, info.FullMethod, req)
+	res, err := handler(ctx, req)
+	repman.writeGrpcAuditRecord(rec, err)
+	return res, err
+}
@@ -0,0 +1,92 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+
+	"github.com/signal18/replication-manager/cert"
+)
+
+// certificateGetter is the tls.Config GetCertificate callback serving the API certificate
+type certificateGetter func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+
+// getAPIFileTLS serves the configured API certificate, reloaded when the file is renewed
+func (repman *ReplicationManager) getAPIFileTLS() (Repmanv3TLS, error) {
+	reloader, err := cert.NewKeyPairReloader(repman.Conf.MonitoringSSLCert, repman.Conf.MonitoringSSLKey)
+	if err != nil {
+		return Repmanv3TLS{}, err
+	}
+	repman.apiCertificate = reloader.GetCertificate
+	return Repmanv3TLS{
+		Enabled:            true,
+		CertificatePath:    repman.Conf.MonitoringSSLCert,
+		CertificateKeyPath: repman.Conf.MonitoringSSLKey,
+		GetCertificate:     reloader.GetCertificate,
+	}, nil
+}
+
+// getAPIACMETLS gets and renews the API certificate from the ACME server, challenges are answered
+// with tls-alpn-01 on the API port and with http-01 when api-https-acme-http-bind is set
+func (repman *ReplicationManager) getAPIACMETLS() (Repmanv3TLS, error) {
+	domains := cert.SplitDomains(repman.Conf.APIHttpsACMEDomains)
+	if len(domains) == 0 {
+		return Repmanv3TLS{}, errors.New("api-https-acme-domains is empty")
+	}
+	cacheDir := repman.Conf.APIHttpsACMECacheDir
+	if cacheDir == "" {
+		cacheDir = repman.Conf.WorkingDir + "/acme"
+	}
+	manager, err := cert.NewACMEManager(cert.ACMEConfig{
+		DirectoryURL: repman.Conf.APIHttpsACMEDirectoryURL,
+		Email:        repman.Conf.APIHttpsACMEEmail,
+		Domains:      domains,
+		CacheDir:     cacheDir,
+		CACert:       repman.Conf.APIHttpsACMECACert,
+	})
+	if err != nil {
+		return Repmanv3TLS{}, err
+	}
+	if repman.Conf.APIHttpsACMEHTTPBind != "" {
+		go func() {
+			repman.Logrus.Infof("Starting ACME http-01 challenge listener on %s", repman.Conf.APIHttpsACMEHTTPBind)
+			err := http.ListenAndServe(repman.Conf.APIHttpsACMEHTTPBind, manager.HTTPHandler(nil))
+			if err != nil {
+				repman.Logrus.Errorf("ACME http-01 challenge listener stopped: %s", err)
+			}
+		}()
+	}
+	repman.apiCertificate = manager.GetCertificate
+	repman.apiCertificateServerName = domains[0]
+	return Repmanv3TLS{
+		Enabled:        true,
+		GetCertificate: manager.GetCertificate,
+		ACME:           true,
+		ServerName:     domains[0],
+	}, nil
+}
+
+// checkAPICertificate pushes the expiry of the API certificate to the clusters, with ACME it
+// also triggers the renewal of a certificate close to expiry
+func (repman *ReplicationManager) checkAPICertificate() {
+	if repman.apiCertificate == nil {
+		return
+	}
+	notAfter, err := cert.CertificateNotAfter(repman.apiCertificate, repman.apiCertificateServerName)
+	if err != nil {
+		repman.Logrus.Errorf("Could not get API certificate: %s", err)
+		return
+	}
+	for _, cl := range repman.Clusters {
+		cl.SetAPICertificateExpiry(notAfter)
+	}
+}
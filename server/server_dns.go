@@ -0,0 +1,40 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package server
+
+import (
+	"github.com/signal18/replication-manager/cluster"
+	"github.com/signal18/replication-manager/router/dnsserver"
+)
+
+func (repman *ReplicationManager) getDNSServices() map[string][]dnsserver.Backend {
+	services := make(map[string][]dnsserver.Backend)
+	// Snapshot the clusters, backends are computed without holding the lock
+	repman.Lock()
+	clusters := make([]*cluster.Cluster, 0, len(repman.Clusters))
+	for _, cl := range repman.Clusters {
+		clusters = append(clusters, cl)
+	}
+	repman.Unlock()
+	for _, cl := range clusters {
+		services[cl.Name+"-rw"] = cl.GetDNSReadWriteBackends()
+		services[cl.Name+"-ro"] = cl.GetDNSReadBackends()
+	}
+	return services
+}
+
+// dnsserver runs the embedded authoritative DNS server for <cluster>-rw and <cluster>-ro names
+func (repman *ReplicationManager) dnsserver() {
+	srv := dnsserver.NewServer(repman.Conf.DNSServerDomain, uint32(repman.Conf.DNSServerTTL), repman.getDNSServices)
+	repman.Logrus.Infof("Starting DNS server for zone %s on %s", repman.Conf.DNSServerDomain, repman.Conf.DNSServerBind)
+	if err := srv.ListenAndServe(repman.Conf.DNSServerBind); err != nil {
+		repman.Logrus.Errorf("DNS server stopped on %s: %s", repman.Conf.DNSServerBind, err)
+	}
+}
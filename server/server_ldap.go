@@ -0,0 +1,62 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package server
+
+import (
+	"github.com/signal18/replication-manager/utils/ldaphelper"
+)
+
+func (repman *ReplicationManager) getLDAPConfig() ldaphelper.Config {
+	return ldaphelper.Config{
+		URL:                repman.Conf.APILDAPURL,
+		BindDN:             repman.Conf.APILDAPBindDN,
+		BindPassword:       repman.Conf.GetDecryptedValue("api-ldap-bind-password"),
+		BaseDN:             repman.Conf.APILDAPBaseDN,
+		UserFilter:         repman.Conf.APILDAPUserFilter,
+		EmailAttr:          repman.Conf.APILDAPEmailAttr,
+		GroupBaseDN:        repman.Conf.APILDAPGroupBaseDN,
+		GroupFilter:        repman.Conf.APILDAPGroupFilter,
+		GroupAttr:          repman.Conf.APILDAPGroupAttr,
+		MemberOfAttr:       repman.Conf.APILDAPMemberOfAttr,
+		StartTLS:           repman.Conf.APILDAPStartTLS,
+		InsecureSkipVerify: repman.Conf.APILDAPInsecureSkipVerify,
+	}
+}
+
+// isLocalAPIUser returns true when a cluster defines user in its api credentials
+func (repman *ReplicationManager) isLocalAPIUser(user string) bool {
+	for _, cl := range repman.Clusters {
+		if u, ok := cl.APIUsers[user]; ok && !u.IsLDAP && !u.IsToken {
+			return true
+		}
+	}
+	return false
+}
+
+// loginLDAP checks the credentials against the directory and maps the user groups to
+// grants and roles on every cluster, the login fails when no cluster accepts the groups
+func (repman *ReplicationManager) loginLDAP(user string, password string) bool {
+	id, err := ldaphelper.Authenticate(repman.getLDAPConfig(), user, password)
+	if err != nil {
+		if err == ldaphelper.ErrInvalidCredentials || err == ldaphelper.ErrUserNotFound {
+			repman.Logrus.Warnf("LDAP login refused for %s: %s", user, err)
+		} else {
+			repman.Logrus.Errorf("LDAP login error for %s: %s", user, err)
+		}
+		return false
+	}
+	loggedIn := false
+	for _, cl := range repman.Clusters {
+		if cl.SetLDAPUser(user, id.Groups) {
+			loggedIn = true
+		}
+	}
+	return loggedIn
+}
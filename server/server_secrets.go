@@ -0,0 +1,98 @@
+//go:build !clients
+// +build !clients
+
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+package server
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/signal18/replication-manager/utils/crypto"
+	"github.com/spf13/cobra"
+)
+
+var (
+	reencryptFrom   string
+	reencryptTo     string
+	reencryptDirs   []string
+	reencryptDryRun bool
+)
+
+func init() {
+	rootCmd.AddCommand(secretsReencryptCmd)
+	secretsReencryptCmd.Flags().StringVar(&reencryptFrom, "from", "aes", "Provider that encrypted the secrets aes|vault|age|kms")
+	secretsReencryptCmd.Flags().StringVar(&reencryptTo, "to", "", "Provider to encrypt the secrets with aes|vault|age|kms")
+	secretsReencryptCmd.Flags().StringSliceVar(&reencryptDirs, "dir", nil, "Directories of the config files, default to the config and data directories")
+	secretsReencryptCmd.Flags().BoolVar(&reencryptDryRun, "dry-run", false, "Only count the secrets to re-encrypt")
+}
+
+var secretsReencryptCmd = &cobra.Command{
+	Use:   "secrets-reencrypt",
+	Short: "Re-encrypt the secrets of the config files with another provider",
+	Long: `Decrypts every secret of the toml files of the config and data directories encrypted by
+the provider given with --from and encrypts it again with the provider given with --to. Providers are
+configured with the monitoring-secret-* flags of the config file. Set monitoring-secret-provider to the
+new provider before restarting so that secrets saved later use it too.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		RepMan.CommandLineFlag = GetCommandLineFlag(cmd)
+		RepMan.DefaultFlagMap = defaultFlagMap
+		RepMan.InitConfig(conf, false)
+		if reencryptTo == "" || reencryptTo == reencryptFrom {
+			log.Fatalln("Provide a --to provider different from --from")
+		}
+		from, err := RepMan.Conf.GetSecretProvider(reencryptFrom)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		to, err := RepMan.Conf.GetSecretProvider(reencryptTo)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		dirs := reencryptDirs
+		if len(dirs) == 0 {
+			dirs = []string{RepMan.Conf.ConfDir, RepMan.Conf.WorkingDir}
+		}
+		total := 0
+		for _, dir := range dirs {
+			err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+				if err != nil || d.IsDir() || filepath.Ext(path) != ".toml" {
+					return err
+				}
+				content, err := os.ReadFile(path)
+				if err != nil {
+					return err
+				}
+				res, n, err := crypto.Reencrypt(string(content), from, to)
+				if err != nil {
+					return fmt.Errorf("%s: %s", path, err)
+				}
+				if n == 0 {
+					return nil
+				}
+				total += n
+				fmt.Printf("%s: %d secrets\n", path, n)
+				if reencryptDryRun {
+					return nil
+				}
+				info, err := d.Info()
+				if err != nil {
+					return err
+				}
+				return os.WriteFile(path, []byte(res), info.Mode().Perm())
+			})
+			if err != nil {
+				log.Fatalln(err)
+			}
+		}
+		fmt.Printf("Re-encrypted %d secrets from %s to %s\n", total, from.Name(), to.Name())
+	},
+}
@@ -0,0 +1,88 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/signal18/replication-manager/utils/apitoken"
+	"google.golang.org/grpc/peer"
+)
+
+func (repman *ReplicationManager) initAPITokens() {
+	path := repman.Conf.APITokensFile
+	if path == "" {
+		path = repman.Conf.WorkingDir + "/api-tokens.json"
+	}
+	s, err := apitoken.Open(path)
+	if err != nil {
+		repman.Logrus.Errorf("Could not load API tokens: %s", err)
+		return
+	}
+	repman.apiTokens = s
+}
+
+// getBearer returns the bearer value of the Authorization header
+func getBearer(header string) string {
+	if len(header) > 6 && strings.ToUpper(header[0:7]) == "BEARER " {
+		return header[7:]
+	}
+	return ""
+}
+
+// isAPITokenRequest tells whether the request carries a service account token instead of a JWT
+func isAPITokenRequest(r *http.Request) bool {
+	return apitoken.IsToken(getBearer(r.Header.Get("Authorization")))
+}
+
+func (repman *ReplicationManager) authenticateAPIToken(bearer string, ip net.IP) (apitoken.Token, error) {
+	if repman.apiTokens == nil {
+		return apitoken.Token{}, errors.New("API tokens are not available")
+	}
+	tok, err := repman.apiTokens.Authenticate(bearer, ip)
+	if err != nil {
+		repman.Logrus.Warnf("API token refused from %s: %s", ip, err)
+	}
+	return tok, err
+}
+
+// getAPITokenFromRequest authenticates the service account token of a REST call
+func (repman *ReplicationManager) getAPITokenFromRequest(r *http.Request) (apitoken.Token, error) {
+	return repman.authenticateAPIToken(getBearer(r.Header.Get("Authorization")), net.ParseIP(remoteIP(r.RemoteAddr)))
+}
+
+// getAPITokenFromContext authenticates the service account token of a gRPC call
+func (repman *ReplicationManager) getAPITokenFromContext(ctx context.Context, bearer string) (apitoken.Token, error) {
+	var ip net.IP
+	if p, ok := peer.FromContext(ctx); ok {
+		ip = net.ParseIP(remoteIP(p.Addr.String()))
+	}
+	return repman.authenticateAPIToken(bearer, ip)
+}
+
+// revokeAPIToken disables a token and removes its user from every cluster
+func (repman *ReplicationManager) revokeAPIToken(id string) error {
+	tok, ok := repman.apiTokens.Get(id)
+	if !ok {
+		return apitoken.ErrTokenNotFound
+	}
+	if err := repman.apiTokens.Revoke(id); err != nil {
+		return err
+	}
+	for _, cl := range repman.Clusters {
+		cl.DropAPITokenUser(tok.User())
+	}
+	repman.Logrus.Infof("API token %s of %s revoked", tok.ID, tok.Account)
+	return nil
+}
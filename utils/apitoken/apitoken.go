@@ -0,0 +1,320 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+// Package apitoken manages long lived API tokens of service accounts. Only a SHA-256
+// hash of the token secret is stored, the clear token is returned once at creation.
+package apitoken
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prefix starts every token so that it can be told apart from a JWT
+const Prefix = "rmt_"
+
+var (
+	ErrInvalidToken      = errors.New("Invalid API token")
+	ErrExpiredToken      = errors.New("API token expired")
+	ErrRevokedToken      = errors.New("API token revoked")
+	ErrSourceNotAllowed  = errors.New("Source address not allowed for API token")
+	ErrTokenNotFound     = errors.New("API token not found")
+	validAccountName     = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+	lastUsedSaveInterval = time.Minute
+)
+
+type Token struct {
+	ID        string    `json:"id"`
+	Account   string    `json:"account"`
+	Hash      string    `json:"hash,omitempty"`
+	Grants    []string  `json:"grants"`
+	Clusters  []string  `json:"clusters"`
+	CIDRs     []string  `json:"cidrs"`
+	Expires   time.Time `json:"expires"`
+	Created   time.Time `json:"created"`
+	CreatedBy string    `json:"createdBy"`
+	LastUsed  time.Time `json:"lastUsed"`
+	LastIP    string    `json:"lastIp"`
+	Revoked   bool      `json:"revoked"`
+}
+
+// Request describes a token to create, a zero TTL never expires
+type Request struct {
+	Account  string   `json:"account"`
+	Grants   []string `json:"grants"`
+	Clusters []string `json:"clusters"`
+	CIDRs    []string `json:"cidrs"`
+	TTL      string   `json:"ttl"`
+}
+
+// User is the API user name of the token, the account and the token id
+func (t *Token) User() string {
+	return t.Account + "." + t.ID
+}
+
+// IsExpired tells whether the token is past its expiry
+func (t *Token) IsExpired(now time.Time) bool {
+	return !t.Expires.IsZero() && now.After(t.Expires)
+}
+
+// AllowsCluster tells whether the token can be used on a cluster, no cluster means all
+func (t *Token) AllowsCluster(name string) bool {
+	if len(t.Clusters) == 0 {
+		return true
+	}
+	for _, c := range t.Clusters {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsSource tells whether ip is in the CIDR allowlist, no CIDR means any source
+func (t *Token) AllowsSource(ip net.IP) bool {
+	if len(t.CIDRs) == 0 {
+		return true
+	}
+	if ip == nil {
+		return false
+	}
+	for _, cidr := range t.CIDRs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err == nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Public returns a copy of the token without its hash
+func (t Token) Public() Token {
+	t.Hash = ""
+	return t
+}
+
+type Store struct {
+	path     string
+	mu       sync.Mutex
+	tokens   map[string]*Token
+	lastSave time.Time
+}
+
+// Open loads the tokens of path, a missing file is an empty store
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, tokens: make(map[string]*Token)}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list []*Token
+	if err = json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("Could not parse %s: %s", path, err)
+	}
+	for _, t := range list {
+		s.tokens[t.ID] = t
+	}
+	return s, nil
+}
+
+func (s *Store) Path() string {
+	return s.path
+}
+
+// save writes the tokens, the caller holds mu
+func (s *Store) save() error {
+	list := make([]*Token, 0, len(s.tokens))
+	for _, t := range s.tokens {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.Before(list[j].Created) })
+	data, err := json.MarshalIndent(list, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	s.lastSave = time.Now()
+	return os.Rename(tmp, s.path)
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Validate checks the account name, the CIDRs and the TTL of a request
+func (req Request) Validate() (time.Duration, error) {
+	if !validAccountName.MatchString(req.Account) {
+		return 0, fmt.Errorf("Invalid account name %q, expecting letters, digits, - or _", req.Account)
+	}
+	if len(req.Grants) == 0 {
+		return 0, errors.New("A token needs at least one grant")
+	}
+	for _, cidr := range req.CIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return 0, fmt.Errorf("Invalid CIDR %s", cidr)
+		}
+	}
+	if req.TTL == "" || req.TTL == "0" {
+		return 0, nil
+	}
+	ttl, err := time.ParseDuration(req.TTL)
+	if err != nil || ttl < 0 {
+		return 0, fmt.Errorf("Invalid ttl %s", req.TTL)
+	}
+	return ttl, nil
+}
+
+// Create stores a new token and returns it with its clear value
+func (s *Store) Create(req Request, createdBy string) (string, Token, error) {
+	ttl, err := req.Validate()
+	if err != nil {
+		return "", Token{}, err
+	}
+	id, err := randomHex(6)
+	if err != nil {
+		return "", Token{}, err
+	}
+	secret, err := randomHex(24)
+	if err != nil {
+		return "", Token{}, err
+	}
+	now := time.Now()
+	t := &Token{
+		ID:        id,
+		Account:   req.Account,
+		Hash:      hashSecret(secret),
+		Grants:    req.Grants,
+		Clusters:  req.Clusters,
+		CIDRs:     req.CIDRs,
+		Created:   now,
+		CreatedBy: createdBy,
+	}
+	if ttl > 0 {
+		t.Expires = now.Add(ttl)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[id] = t
+	if err = s.save(); err != nil {
+		delete(s.tokens, id)
+		return "", Token{}, err
+	}
+	return Prefix + id + "_" + secret, t.Public(), nil
+}
+
+// Revoke disables a token, it stays listed for audit
+func (s *Store) Revoke(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tokens[id]
+	if !ok {
+		return ErrTokenNotFound
+	}
+	t.Revoked = true
+	return s.save()
+}
+
+// List returns the tokens without their hash, oldest first
+func (s *Store) List() []Token {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]Token, 0, len(s.tokens))
+	for _, t := range s.tokens {
+		list = append(list, t.Public())
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.Before(list[j].Created) })
+	return list
+}
+
+// Get returns a token by id
+func (s *Store) Get(id string) (Token, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tokens[id]
+	if !ok {
+		return Token{}, false
+	}
+	return t.Public(), true
+}
+
+// IsToken tells whether a bearer value looks like an API token rather than a JWT
+func IsToken(bearer string) bool {
+	return strings.HasPrefix(bearer, Prefix)
+}
+
+// Authenticate checks a clear token coming from ip and records its use
+func (s *Store) Authenticate(token string, ip net.IP) (Token, error) {
+	id, secret, ok := strings.Cut(strings.TrimPrefix(token, Prefix), "_")
+	if !IsToken(token) || !ok {
+		return Token{}, ErrInvalidToken
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tokens[id]
+	if !ok || subtle.ConstantTimeCompare([]byte(t.Hash), []byte(hashSecret(secret))) != 1 {
+		return Token{}, ErrInvalidToken
+	}
+	now := time.Now()
+	if t.Revoked {
+		return Token{}, ErrRevokedToken
+	}
+	if t.IsExpired(now) {
+		return Token{}, ErrExpiredToken
+	}
+	if !t.AllowsSource(ip) {
+		return Token{}, ErrSourceNotAllowed
+	}
+	t.LastUsed = now
+	if ip != nil {
+		t.LastIP = ip.String()
+	}
+	// last use is informative, do not write the file on every call
+	if now.Sub(s.lastSave) > lastUsedSaveInterval {
+		s.save()
+	}
+	return t.Public(), nil
+}
+
+// Active returns the tokens that are neither revoked nor expired
+func (s *Store) Active() []Token {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	var list []Token
+	for _, t := range s.tokens {
+		if !t.Revoked && !t.IsExpired(now) {
+			list = append(list, t.Public())
+		}
+	}
+	return list
+}
@@ -0,0 +1,96 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+package apitoken
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateAuthenticate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clear, tok, err := s.Create(Request{Account: "backup-bot", Grants: []string{"db-backup"}, Clusters: []string{"c1"}, CIDRs: []string{"10.0.0.0/8"}, TTL: "24h"}, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsToken(clear) || tok.Hash != "" || tok.User() != "backup-bot."+tok.ID || !tok.AllowsCluster("c1") || tok.AllowsCluster("c2") {
+		t.Errorf("Unexpected token %s %v", clear, tok)
+	}
+	data, _ := os.ReadFile(path)
+	secret := clear[strings.LastIndex(clear, "_")+1:]
+	if strings.Contains(string(data), secret) || !strings.Contains(string(data), hashSecret(secret)) {
+		t.Errorf("Token secret must be stored hashed")
+	}
+
+	if _, err = s.Authenticate(clear, net.ParseIP("10.1.2.3")); err != nil {
+		t.Errorf("Expected valid token got %s", err)
+	}
+	if _, err = s.Authenticate(clear, net.ParseIP("192.168.1.1")); err != ErrSourceNotAllowed {
+		t.Errorf("Expected source not allowed got %v", err)
+	}
+	if _, err = s.Authenticate(clear+"x", net.ParseIP("10.1.2.3")); err != ErrInvalidToken {
+		t.Errorf("Expected invalid token got %v", err)
+	}
+	if _, err = s.Authenticate("eyJhbGciOi", nil); err != ErrInvalidToken {
+		t.Errorf("Expected invalid token for jwt got %v", err)
+	}
+
+	// reload from file then revoke
+	s, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Authenticate(clear, net.ParseIP("10.1.2.3")); err != nil {
+		t.Errorf("Expected valid token after reload got %s", err)
+	}
+	if err = s.Revoke(tok.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Authenticate(clear, net.ParseIP("10.1.2.3")); err != ErrRevokedToken {
+		t.Errorf("Expected revoked token got %v", err)
+	}
+	if len(s.List()) != 1 || len(s.Active()) != 0 {
+		t.Errorf("Unexpected token list %v", s.List())
+	}
+	if s.Revoke("missing") != ErrTokenNotFound {
+		t.Errorf("Expected token not found")
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	s, _ := Open(filepath.Join(t.TempDir(), "tokens.json"))
+	clear, tok, err := s.Create(Request{Account: "ci", Grants: []string{"cluster-show"}}, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tok.Expires.IsZero() {
+		t.Errorf("Expected token without expiry")
+	}
+	s.tokens[tok.ID].Expires = time.Now().Add(-time.Minute)
+	if _, err = s.Authenticate(clear, nil); err != ErrExpiredToken {
+		t.Errorf("Expected expired token got %v", err)
+	}
+
+	for _, req := range []Request{
+		{Account: "bad name", Grants: []string{"db"}},
+		{Account: "ci"},
+		{Account: "ci", Grants: []string{"db"}, CIDRs: []string{"10.0.0.1"}},
+		{Account: "ci", Grants: []string{"db"}, TTL: "tomorrow"},
+	} {
+		if _, _, err = s.Create(req, "admin"); err == nil {
+			t.Errorf("Expected error for %v", req)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+// Package approval keeps the dangerous operations waiting for a second user to confirm them.
+//
+// An operation is pending when requested, then approved or rejected by another user before
+// it expires. An approved operation is executed once and ends executed or failed.
+//
+// The requester and the decider are compared on their owner too, the user who created the
+// API token they used, so that nobody approves an operation with a token of their own.
+package approval
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	StatusPending  = "pending"
+	StatusApproved = "approved"
+	StatusRejected = "rejected"
+	StatusExpired  = "expired"
+	StatusExecuted = "executed"
+	StatusFailed   = "failed"
+)
+
+var (
+	ErrNotFound    = errors.New("Operation not found")
+	ErrNotPending  = errors.New("Operation is not pending")
+	ErrExpired     = errors.New("Operation is expired")
+	ErrSameUser    = errors.New("Operation must be approved by another user")
+	ErrNotApproved = errors.New("Operation is not approved")
+)
+
+// Operation is a request waiting for approval, the request itself is kept to be replayed
+type Operation struct {
+	ID        string              `json:"id"`
+	Cluster   string              `json:"cluster"`
+	Action    string              `json:"action"`
+	Method    string              `json:"method"`
+	Path      string              `json:"path"`
+	Query     string              `json:"query,omitempty"`
+	Requester string              `json:"requester"`
+	Owner     string              `json:"owner,omitempty"`
+	SourceIP  string              `json:"sourceIp"`
+	Status    string              `json:"status"`
+	Created   time.Time           `json:"created"`
+	Expires   time.Time           `json:"expires"`
+	Decider   string              `json:"decider,omitempty"`
+	DecidedBy string              `json:"decidedBy,omitempty"`
+	Decided   time.Time           `json:"decided,omitempty"`
+	Reason    string              `json:"reason,omitempty"`
+	Code      int                 `json:"code,omitempty"`
+	Result    string              `json:"result,omitempty"`
+	Body      []byte              `json:"-"`
+	Header    map[string][]string `json:"-"`
+}
+
+// Store holds the operations in memory, finished ones are kept for the history
+type Store struct {
+	sync.Mutex
+	ops     map[string]*Operation
+	History int
+}
+
+func NewStore() *Store {
+	return &Store{ops: make(map[string]*Operation), History: 200}
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Request registers a pending operation that expires after ttl
+func (s *Store) Request(op Operation, ttl time.Duration, now time.Time) Operation {
+	s.Lock()
+	defer s.Unlock()
+	op.ID = newID()
+	op.Status = StatusPending
+	op.Created = now
+	op.Expires = now.Add(ttl)
+	s.ops[op.ID] = &op
+	s.purge()
+	return op
+}
+
+// Get returns a copy of the operation
+func (s *Store) Get(id string) (Operation, error) {
+	s.Lock()
+	defer s.Unlock()
+	op, ok := s.ops[id]
+	if !ok {
+		return Operation{}, ErrNotFound
+	}
+	return *op, nil
+}
+
+// sameUser tells if a user or its owner is the requester of the operation or its owner
+func (op *Operation) sameUser(user string, owner string) bool {
+	requester := op.Owner
+	if requester == "" {
+		requester = op.Requester
+	}
+	if owner == "" {
+		owner = user
+	}
+	return user == op.Requester || owner == op.Requester || user == requester || owner == requester
+}
+
+func (s *Store) decide(id string, user string, owner string, status string, reason string, now time.Time) (Operation, error) {
+	s.Lock()
+	defer s.Unlock()
+	op, ok := s.ops[id]
+	if !ok {
+		return Operation{}, ErrNotFound
+	}
+	if op.Status != StatusPending {
+		return *op, ErrNotPending
+	}
+	if now.After(op.Expires) {
+		op.Status = StatusExpired
+		return *op, ErrExpired
+	}
+	if status == StatusApproved && op.sameUser(user, owner) {
+		return *op, ErrSameUser
+	}
+	op.Status = status
+	op.Decider = user
+	if owner != user {
+		op.DecidedBy = owner
+	}
+	op.Decided = now
+	op.Reason = reason
+	return *op, nil
+}
+
+// Approve confirms a pending operation, the approver and its owner must not be the
+// requester or its owner
+func (s *Store) Approve(id string, user string, owner string, now time.Time) (Operation, error) {
+	return s.decide(id, user, owner, StatusApproved, "", now)
+}
+
+// Reject cancels a pending operation, the requester can reject its own operation
+func (s *Store) Reject(id string, user string, reason string, now time.Time) (Operation, error) {
+	return s.decide(id, user, user, StatusRejected, reason, now)
+}
+
+// Finish records the result of an approved operation
+func (s *Store) Finish(id string, code int, result string) (Operation, error) {
+	s.Lock()
+	defer s.Unlock()
+	op, ok := s.ops[id]
+	if !ok {
+		return Operation{}, ErrNotFound
+	}
+	if op.Status != StatusApproved {
+		return *op, ErrNotApproved
+	}
+	op.Status = StatusExecuted
+	if code >= 400 {
+		op.Status = StatusFailed
+	}
+	op.Code = code
+	op.Result = result
+	return *op, nil
+}
+
+// Expire marks the pending operations older than their ttl and returns them
+func (s *Store) Expire(now time.Time) []Operation {
+	s.Lock()
+	defer s.Unlock()
+	var res []Operation
+	for _, op := range s.ops {
+		if op.Status == StatusPending && now.After(op.Expires) {
+			op.Status = StatusExpired
+			res = append(res, *op)
+		}
+	}
+	return res
+}
+
+// List returns the operations of a cluster, or all when cluster is empty, newest first
+func (s *Store) List(cluster string) []Operation {
+	s.Lock()
+	defer s.Unlock()
+	res := []Operation{}
+	for _, op := range s.ops {
+		if cluster == "" || op.Cluster == cluster {
+			res = append(res, *op)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Created.After(res[j].Created)
+	})
+	return res
+}
+
+// purge drops the oldest finished operations above the history size
+func (s *Store) purge() {
+	var done []*Operation
+	for _, op := range s.ops {
+		if op.Status != StatusPending && op.Status != StatusApproved {
+			done = append(done, op)
+		}
+	}
+	if len(done) <= s.History {
+		return
+	}
+	sort.Slice(done, func(i, j int) bool {
+		return done[i].Created.Before(done[j].Created)
+	})
+	for _, op := range done[:len(done)-s.History] {
+		delete(s.ops, op.ID)
+	}
+}
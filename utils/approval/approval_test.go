@@ -0,0 +1,108 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+package approval
+
+import (
+	"testing"
+	"time"
+)
+
+func TestApprove(t *testing.T) {
+	s := NewStore()
+	now := time.Now()
+	op := s.Request(Operation{Cluster: "c1", Action: "failover", Requester: "alice"}, 10*time.Minute, now)
+	if op.Status != StatusPending || op.ID == "" {
+		t.Fatalf("Unexpected operation %v", op)
+	}
+	if _, err := s.Approve(op.ID, "alice", "alice", now); err != ErrSameUser {
+		t.Errorf("Expected same user error got %v", err)
+	}
+	if _, err := s.Finish(op.ID, 200, ""); err != ErrNotApproved {
+		t.Errorf("Expected not approved error got %v", err)
+	}
+	op, err := s.Approve(op.ID, "bob", "bob", now.Add(time.Minute))
+	if err != nil || op.Status != StatusApproved || op.Decider != "bob" {
+		t.Fatalf("Unexpected approval %v %v", op, err)
+	}
+	if _, err := s.Reject(op.ID, "bob", "", now); err != ErrNotPending {
+		t.Errorf("Expected not pending error got %v", err)
+	}
+	op, err = s.Finish(op.ID, 500, "failover failed")
+	if err != nil || op.Status != StatusFailed {
+		t.Errorf("Unexpected result %v %v", op, err)
+	}
+	// executed only once
+	if _, err := s.Finish(op.ID, 200, ""); err != ErrNotApproved {
+		t.Errorf("Expected not approved error got %v", err)
+	}
+}
+
+func TestApproveOwnToken(t *testing.T) {
+	s := NewStore()
+	now := time.Now()
+	op := s.Request(Operation{Cluster: "c1", Action: "failover", Requester: "alice", Owner: "alice"}, 10*time.Minute, now)
+	// a token created by the requester
+	if _, err := s.Approve(op.ID, "ci.4f2a", "alice", now); err != ErrSameUser {
+		t.Errorf("Expected same user error with a token of the requester got %v", err)
+	}
+	tok := s.Request(Operation{Cluster: "c1", Action: "failover", Requester: "ci.4f2a", Owner: "alice"}, 10*time.Minute, now)
+	if _, err := s.Approve(tok.ID, "alice", "alice", now); err != ErrSameUser {
+		t.Errorf("Expected same user error for the owner of the requesting token got %v", err)
+	}
+	op, err := s.Approve(tok.ID, "ops.9c1b", "bob", now)
+	if err != nil || op.Decider != "ops.9c1b" || op.DecidedBy != "bob" {
+		t.Errorf("Unexpected approval %v %v", op, err)
+	}
+}
+
+func TestExpireAndReject(t *testing.T) {
+	s := NewStore()
+	now := time.Now()
+	a := s.Request(Operation{Cluster: "c1", Requester: "alice"}, time.Minute, now)
+	b := s.Request(Operation{Cluster: "c2", Requester: "alice"}, time.Hour, now.Add(time.Second))
+	if _, err := s.Approve(a.ID, "bob", "bob", now.Add(2*time.Minute)); err != ErrExpired {
+		t.Errorf("Expected expired error got %v", err)
+	}
+	if ops := s.Expire(now.Add(2 * time.Minute)); len(ops) != 0 {
+		t.Errorf("Expected operation already expired got %v", ops)
+	}
+	if op, err := s.Reject(b.ID, "alice", "wrong cluster", now); err != nil || op.Status != StatusRejected || op.Reason != "wrong cluster" {
+		t.Errorf("Unexpected reject %v %v", op, err)
+	}
+	if ops := s.List("c2"); len(ops) != 1 || ops[0].ID != b.ID {
+		t.Errorf("Unexpected list %v", ops)
+	}
+	if ops := s.List(""); len(ops) != 2 || ops[0].ID != b.ID {
+		t.Errorf("Expected newest first got %v", ops)
+	}
+	c := s.Request(Operation{Requester: "alice"}, time.Minute, now)
+	if ops := s.Expire(now.Add(time.Hour)); len(ops) != 1 || ops[0].ID != c.ID {
+		t.Errorf("Unexpected expired %v", ops)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	s := NewStore()
+	s.History = 2
+	now := time.Now()
+	var ids []string
+	for i := 0; i < 4; i++ {
+		op := s.Request(Operation{Requester: "alice"}, time.Minute, now.Add(time.Duration(i)*time.Second))
+		s.Reject(op.ID, "alice", "", now)
+		ids = append(ids, op.ID)
+	}
+	pending := s.Request(Operation{Requester: "alice"}, time.Minute, now)
+	if _, err := s.Get(ids[0]); err != ErrNotFound {
+		t.Errorf("Expected oldest operation purged")
+	}
+	if _, err := s.Get(ids[3]); err != nil {
+		t.Errorf("Expected newest operation kept")
+	}
+	if _, err := s.Get(pending.ID); err != nil {
+		t.Errorf("Expected pending operation kept")
+	}
+}
@@ -0,0 +1,413 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+// Package audit keeps an append only, hash chained journal of user actions. Every
+// record carries the keyed hash of the previous one and the head of the chain is
+// persisted beside the journal, so any edit, removal or reordering of the file is
+// detected by Verify unless the key is known.
+package audit
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	AuthPassword = "password"
+	AuthJWT      = "jwt"
+	AuthOAuth    = "oauth"
+	AuthLDAP     = "ldap"
+	AuthToken    = "token"
+	AuthNone     = "none"
+
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+
+	Redacted = "******"
+)
+
+// genesis is the previous hash of the first record
+var genesis = strings.Repeat("0", sha256.Size*2)
+
+var secretPatterns = []string{"pass", "secret", "token", "credential", "key", "authorization"}
+
+type Record struct {
+	Seq        uint64            `json:"seq"`
+	Time       int64             `json:"time"`
+	User       string            `json:"user"`
+	SourceIP   string            `json:"sourceIp"`
+	AuthMethod string            `json:"authMethod"`
+	Origin     string            `json:"origin"`
+	Cluster    string            `json:"cluster"`
+	Action     string            `json:"action"`
+	Method     string            `json:"method"`
+	Path       string            `json:"path"`
+	Params     map[string]string `json:"params"`
+	Result     string            `json:"result"`
+	Status     int               `json:"status"`
+	Error      string            `json:"error"`
+	PrevHash   string            `json:"prevHash"`
+	Hash       string            `json:"hash"`
+}
+
+// Filter selects records in Query, empty fields match everything and Limit keeps
+// the most recent records
+type Filter struct {
+	User    string
+	Cluster string
+	Action  string
+	Result  string
+	Since   int64
+	Until   int64
+	Limit   int
+}
+
+type VerifyResult struct {
+	Records   uint64 `json:"records"`
+	Valid     bool   `json:"valid"`
+	BrokenSeq uint64 `json:"brokenSeq"`
+	Error     string `json:"error"`
+}
+
+// Head is the last record of the chain, persisted beside the journal with its own mac
+type Head struct {
+	Seq  uint64 `json:"seq"`
+	Hash string `json:"hash"`
+	Mac  string `json:"mac"`
+}
+
+type Log struct {
+	sync.Mutex
+	path   string
+	key    []byte
+	seq    uint64
+	last   string
+	syslog io.Writer
+}
+
+// Open opens or creates the journal at path and resumes the chain from the persisted
+// head, or from the last record of a journal without head. Records are hashed with
+// an HMAC of key, an empty key falls back to a plain sha256.
+func Open(path string, key []byte) (*Log, error) {
+	l := &Log{path: path, key: key, last: genesis}
+	f, err := os.OpenFile(path, os.O_RDONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	err = scan(f, func(rec Record) bool {
+		l.seq = rec.Seq
+		l.last = rec.Hash
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Could not read audit log %s: %s", path, err)
+	}
+	head, err := l.readHead()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("Could not read audit log head %s: %s", l.headPath(), err)
+	}
+	if err == nil {
+		// a truncated journal keeps chaining from the persisted head so Verify still reports it
+		l.seq = head.Seq
+		l.last = head.Hash
+	}
+	return l, nil
+}
+
+func (l *Log) headPath() string {
+	return l.path + ".head"
+}
+
+func (l *Log) headMac(seq uint64, hash string) string {
+	return l.sum([]byte(fmt.Sprintf("%d:%s", seq, hash)))
+}
+
+func (l *Log) sum(b []byte) string {
+	if len(l.key) == 0 {
+		sum := sha256.Sum256(b)
+		return hex.EncodeToString(sum[:])
+	}
+	mac := hmac.New(sha256.New, l.key)
+	mac.Write(b)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// readHead returns the persisted head after checking its mac
+func (l *Log) readHead() (Head, error) {
+	var head Head
+	b, err := os.ReadFile(l.headPath())
+	if err != nil {
+		return head, err
+	}
+	if err = json.Unmarshal(b, &head); err != nil {
+		return head, err
+	}
+	if !hmac.Equal([]byte(head.Mac), []byte(l.headMac(head.Seq, head.Hash))) {
+		return head, fmt.Errorf("Invalid mac of head at sequence %d", head.Seq)
+	}
+	return head, nil
+}
+
+func (l *Log) writeHead(seq uint64, hash string) error {
+	b, err := json.Marshal(Head{Seq: seq, Hash: hash, Mac: l.headMac(seq, hash)})
+	if err != nil {
+		return err
+	}
+	tmp := l.headPath() + ".tmp"
+	if err = os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.headPath())
+}
+
+// SetSyslog ships every new record as a JSON line to w, usually a syslog writer
+func (l *Log) SetSyslog(w io.Writer) {
+	l.Lock()
+	l.syslog = w
+	l.Unlock()
+}
+
+func (l *Log) Path() string {
+	return l.path
+}
+
+// Append chains rec to the journal and returns it with its sequence and hashes set
+func (l *Log) Append(rec Record) (Record, error) {
+	l.Lock()
+	defer l.Unlock()
+	if rec.Time == 0 {
+		rec.Time = time.Now().Unix()
+	}
+	rec.Seq = l.seq + 1
+	rec.PrevHash = l.last
+	rec.Hash = l.ComputeHash(rec)
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return rec, err
+	}
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return rec, err
+	}
+	defer f.Close()
+	if _, err = f.Write(append(line, '\n')); err != nil {
+		return rec, err
+	}
+	if err = l.writeHead(rec.Seq, rec.Hash); err != nil {
+		return rec, err
+	}
+	l.seq = rec.Seq
+	l.last = rec.Hash
+	if l.syslog != nil {
+		l.syslog.Write(line)
+	}
+	return rec, nil
+}
+
+// ComputeHash returns the keyed hash of the record content without its own hash
+func (l *Log) ComputeHash(rec Record) string {
+	rec.Hash = ""
+	b, _ := json.Marshal(rec)
+	return l.sum(b)
+}
+
+// Verify walks the whole journal and reports the first record that breaks the chain,
+// the end of the journal is checked against the persisted head
+func (l *Log) Verify() (VerifyResult, error) {
+	l.Lock()
+	defer l.Unlock()
+	res := VerifyResult{Valid: true}
+	f, err := os.Open(l.path)
+	if err != nil {
+		return res, err
+	}
+	defer f.Close()
+	prev := genesis
+	var seq uint64
+	err = scan(f, func(rec Record) bool {
+		seq++
+		switch {
+		case rec.Seq != seq:
+			res.Error = fmt.Sprintf("Expected sequence %d got %d", seq, rec.Seq)
+		case rec.PrevHash != prev:
+			res.Error = fmt.Sprintf("Previous hash mismatch at sequence %d", rec.Seq)
+		case !hmac.Equal([]byte(l.ComputeHash(rec)), []byte(rec.Hash)):
+			res.Error = fmt.Sprintf("Hash mismatch at sequence %d", rec.Seq)
+		}
+		if res.Error != "" {
+			res.Valid = false
+			res.BrokenSeq = seq
+			return false
+		}
+		res.Records = seq
+		prev = rec.Hash
+		return true
+	})
+	if err != nil {
+		res.Valid = false
+		res.BrokenSeq = seq
+		res.Error = err.Error()
+	}
+	if !res.Valid {
+		return res, nil
+	}
+	// records removed from the end keep a valid chain, compare with the persisted head
+	head, err := l.readHead()
+	if os.IsNotExist(err) && res.Records == 0 {
+		return res, nil
+	}
+	switch {
+	case err != nil:
+		res.Valid = false
+		res.BrokenSeq = res.Records + 1
+		res.Error = fmt.Sprintf("Could not read head: %s", err)
+	case res.Records != head.Seq || prev != head.Hash:
+		res.Valid = false
+		res.BrokenSeq = res.Records + 1
+		res.Error = fmt.Sprintf("Journal ends at sequence %d expected %d", res.Records, head.Seq)
+	}
+	return res, nil
+}
+
+// Query returns the records matching the filter in chronological order
+func (l *Log) Query(filter Filter) ([]Record, error) {
+	l.Lock()
+	defer l.Unlock()
+	records := []Record{}
+	f, err := os.Open(l.path)
+	if err != nil {
+		return records, err
+	}
+	defer f.Close()
+	err = scan(f, func(rec Record) bool {
+		if filter.Match(rec) {
+			records = append(records, rec)
+			if filter.Limit > 0 && len(records) > filter.Limit {
+				records = records[1:]
+			}
+		}
+		return true
+	})
+	return records, err
+}
+
+func (filter Filter) Match(rec Record) bool {
+	switch {
+	case filter.User != "" && filter.User != rec.User,
+		filter.Cluster != "" && filter.Cluster != rec.Cluster,
+		filter.Action != "" && !strings.Contains(rec.Action, filter.Action),
+		filter.Result != "" && filter.Result != rec.Result,
+		filter.Since > 0 && rec.Time < filter.Since,
+		filter.Until > 0 && rec.Time > filter.Until:
+		return false
+	}
+	return true
+}
+
+func scan(r io.Reader, fn func(Record) bool) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return fmt.Errorf("Invalid record at line %d: %s", line, err)
+		}
+		if !fn(rec) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// IsSecret reports whether a parameter name looks like it holds a secret
+func IsSecret(name string) bool {
+	name = strings.ToLower(name)
+	for _, p := range secretPatterns {
+		if strings.Contains(name, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Redact returns a copy of params with secret values masked. A parameter named
+// xxxName holding a secret name, like settingName=db-servers-credential, also
+// masks its xxxValue companion.
+func Redact(params map[string]string) map[string]string {
+	res := make(map[string]string, len(params))
+	for k, v := range params {
+		res[k] = v
+	}
+	for k, v := range params {
+		if v == "" {
+			continue
+		}
+		if IsSecret(k) {
+			res[k] = Redacted
+		}
+		if strings.HasSuffix(k, "Name") && IsSecret(v) {
+			if _, ok := params[strings.TrimSuffix(k, "Name")+"Value"]; ok {
+				res[strings.TrimSuffix(k, "Name")+"Value"] = Redacted
+			}
+		}
+	}
+	return res
+}
+
+// RedactString masks in s every secret value of params, it is used on URL paths
+// carrying parameters
+func RedactString(s string, params map[string]string) string {
+	redacted := Redact(params)
+	var secrets []string
+	for k, v := range redacted {
+		if v == Redacted && params[k] != "" {
+			secrets = append(secrets, params[k])
+		}
+	}
+	// longest first so a secret containing another one is fully masked
+	sort.Slice(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, Redacted)
+	}
+	return s
+}
+
+// Flatten turns a decoded JSON document into dotted parameter names
+func Flatten(prefix string, value interface{}, params map[string]string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, sub := range v {
+			if prefix != "" {
+				k = prefix + "." + k
+			}
+			Flatten(k, sub, params)
+		}
+	case []interface{}:
+		for i, sub := range v {
+			Flatten(fmt.Sprintf("%s.%d", prefix, i), sub, params)
+		}
+	case nil:
+		params[prefix] = ""
+	default:
+		params[prefix] = fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,177 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+package audit
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testKey = []byte("audit-test-key")
+
+func appendRecords(t *testing.T, l *Log) {
+	recs := []Record{
+		{User: "admin", Cluster: "c1", Action: "switchover", Result: ResultSuccess, Time: 100},
+		{User: "dba", Cluster: "c2", Action: "settings/actions/switch/failover-mode", Result: ResultFailure, Time: 200},
+		{User: "admin", Cluster: "c1", Action: "servers/db1/actions/stop", Result: ResultSuccess, Time: 300},
+	}
+	for _, rec := range recs {
+		if _, err := l.Append(rec); err != nil {
+			t.Fatalf("Append failed %s", err)
+		}
+	}
+}
+
+func TestChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(path, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var shipped bytes.Buffer
+	l.SetSyslog(&shipped)
+	appendRecords(t, l)
+	if strings.Count(shipped.String(), "\"hash\"") != 3 {
+		t.Errorf("Expected 3 records shipped got %s", shipped.String())
+	}
+	if res, _ := l.Verify(); !res.Valid || res.Records != 3 {
+		t.Fatalf("Expected valid chain got %v", res)
+	}
+
+	// reopening resumes the chain
+	l, err = Open(path, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, _ := l.Append(Record{User: "admin", Action: "login"})
+	if rec.Seq != 4 {
+		t.Errorf("Expected sequence 4 got %d", rec.Seq)
+	}
+	if res, _ := l.Verify(); !res.Valid || res.Records != 4 {
+		t.Errorf("Expected valid chain after reopen got %v", res)
+	}
+
+	data, _ := os.ReadFile(path)
+	tampered := strings.Replace(string(data), "\"user\":\"dba\"", "\"user\":\"admin\"", 1)
+	os.WriteFile(path, []byte(tampered), 0600)
+	if res, _ := l.Verify(); res.Valid || res.BrokenSeq != 2 {
+		t.Errorf("Expected tampering detected at 2 got %v", res)
+	}
+
+	lines := strings.SplitAfter(string(data), "\n")
+	os.WriteFile(path, []byte(lines[0]+lines[2]+lines[3]), 0600)
+	if res, _ := l.Verify(); res.Valid || res.BrokenSeq != 2 {
+		t.Errorf("Expected removal detected at 2 got %v", res)
+	}
+
+	os.WriteFile(path, []byte(lines[0]+lines[1]+lines[2]), 0600)
+	if res, _ := l.Verify(); res.Valid || res.BrokenSeq != 4 {
+		t.Errorf("Expected truncation detected at 4 got %v", res)
+	}
+}
+
+func TestKeyAndHead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(path, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendRecords(t, l)
+	data, _ := os.ReadFile(path)
+
+	// a chain rewritten without the key does not verify
+	forged, _ := Open(filepath.Join(t.TempDir(), "forged.log"), []byte("other-key"))
+	appendRecords(t, forged)
+	forgedData, _ := os.ReadFile(forged.Path())
+	os.WriteFile(path, forgedData, 0600)
+	if res, _ := l.Verify(); res.Valid || res.BrokenSeq != 1 {
+		t.Errorf("Expected forged chain detected at 1 got %v", res)
+	}
+
+	// a truncated journal is detected from the persisted head, also after a restart
+	lines := strings.SplitAfter(string(data), "\n")
+	os.WriteFile(path, []byte(lines[0]+lines[1]), 0600)
+	l, err = Open(path, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, _ := l.Verify(); res.Valid || res.BrokenSeq != 3 {
+		t.Errorf("Expected truncation detected at 3 after reopen got %v", res)
+	}
+	if rec, _ := l.Append(Record{User: "admin", Action: "login"}); rec.Seq != 4 {
+		t.Errorf("Expected the chain to resume from the head got sequence %d", rec.Seq)
+	}
+
+	// a head rewritten without the key is refused
+	os.WriteFile(path+".head", []byte(`{"seq":2,"hash":"x","mac":"y"}`), 0600)
+	if res, _ := l.Verify(); res.Valid {
+		t.Errorf("Expected forged head detected got %v", res)
+	}
+	if _, err = Open(path, testKey); err == nil {
+		t.Error("Expected open to refuse a forged head")
+	}
+}
+
+func TestQuery(t *testing.T) {
+	l, err := Open(filepath.Join(t.TempDir(), "audit.log"), testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendRecords(t, l)
+	recs, _ := l.Query(Filter{User: "admin"})
+	if len(recs) != 2 || recs[1].Seq != 3 {
+		t.Errorf("Unexpected user query %v", recs)
+	}
+	recs, _ = l.Query(Filter{Cluster: "c1", Action: "stop"})
+	if len(recs) != 1 || recs[0].Action != "servers/db1/actions/stop" {
+		t.Errorf("Unexpected action query %v", recs)
+	}
+	recs, _ = l.Query(Filter{Since: 150, Limit: 1})
+	if len(recs) != 1 || recs[0].Seq != 3 {
+		t.Errorf("Unexpected limited query %v", recs)
+	}
+	recs, _ = l.Query(Filter{Result: ResultFailure})
+	if len(recs) != 1 || recs[0].User != "dba" {
+		t.Errorf("Unexpected result query %v", recs)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	params := map[string]string{
+		"clusterName":  "c1",
+		"settingName":  "db-servers-credential",
+		"settingValue": "root:s3cr3t",
+		"password":     "pwd",
+		"user.apiKey":  "abc",
+		"serverName":   "db1",
+	}
+	res := Redact(params)
+	for _, k := range []string{"settingValue", "password", "user.apiKey"} {
+		if res[k] != Redacted {
+			t.Errorf("Expected %s redacted got %s", k, res[k])
+		}
+	}
+	if res["clusterName"] != "c1" || res["serverName"] != "db1" || res["settingName"] != "db-servers-credential" {
+		t.Errorf("Unexpected redaction %v", res)
+	}
+	if params["password"] != "pwd" {
+		t.Errorf("Redact modified its input")
+	}
+	path := RedactString("/api/clusters/c1/settings/actions/set/db-servers-credential/root:s3cr3t", params)
+	if path != "/api/clusters/c1/settings/actions/set/db-servers-credential/"+Redacted {
+		t.Errorf("Unexpected redacted path %s", path)
+	}
+
+	flat := make(map[string]string)
+	Flatten("", map[string]interface{}{"username": "u", "grants": []interface{}{"a", "b"}, "opts": map[string]interface{}{"n": 1.5}}, flat)
+	if flat["username"] != "u" || flat["grants.1"] != "b" || flat["opts.n"] != "1.5" {
+		t.Errorf("Unexpected flatten %v", flat)
+	}
+}
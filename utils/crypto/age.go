@@ -0,0 +1,103 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+package crypto
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+)
+
+// AgeProvider encrypts to X25519 recipients, decryption needs one of their identities so
+// that a host can write secrets it can not read
+type AgeProvider struct {
+	Recipients []age.Recipient
+	Identities []age.Identity
+}
+
+// NewAgeProvider parses recipients separated by commas and the identity file written by age-keygen,
+// any of them can be empty
+func NewAgeProvider(recipients string, identityPath string) (*AgeProvider, error) {
+	p := new(AgeProvider)
+	for _, r := range strings.Split(recipients, ",") {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+		rcpt, err := age.ParseX25519Recipient(r)
+		if err != nil {
+			return nil, err
+		}
+		p.Recipients = append(p.Recipients, rcpt)
+	}
+	if identityPath != "" {
+		file, err := os.Open(identityPath)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		p.Identities, err = age.ParseIdentities(file)
+		if err != nil {
+			return nil, err
+		}
+		// an identity can always decrypt what it encrypts
+		if len(p.Recipients) == 0 {
+			for _, id := range p.Identities {
+				if x, ok := id.(*age.X25519Identity); ok {
+					p.Recipients = append(p.Recipients, x.Recipient())
+				}
+			}
+		}
+	}
+	if len(p.Recipients) == 0 && len(p.Identities) == 0 {
+		return nil, errors.New("No age recipient nor identity")
+	}
+	return p, nil
+}
+
+func (p *AgeProvider) Name() string {
+	return ProviderAge
+}
+
+func (p *AgeProvider) Encrypt(plaintext string) (string, error) {
+	if len(p.Recipients) == 0 {
+		return "", errors.New("No age recipient")
+	}
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, p.Recipients...)
+	if err != nil {
+		return "", err
+	}
+	if _, err = io.WriteString(w, plaintext); err != nil {
+		return "", err
+	}
+	if err = w.Close(); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+func (p *AgeProvider) Decrypt(ciphertext string) (string, error) {
+	if len(p.Identities) == 0 {
+		return "", errors.New("No age identity")
+	}
+	raw, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	r, err := age.Decrypt(bytes.NewReader(raw), p.Identities...)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := io.ReadAll(r)
+	return string(plaintext), err
+}
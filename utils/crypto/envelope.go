@@ -0,0 +1,147 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+)
+
+// KMS generates data keys wrapped by a master key it keeps and unwraps them
+type KMS interface {
+	GenerateDataKey(keyID string) (plain []byte, wrapped []byte, err error)
+	Decrypt(wrapped []byte) ([]byte, error)
+}
+
+// EnvelopeProvider encrypts every secret with a fresh AES-256-GCM data key and stores the
+// data key wrapped by the KMS next to the ciphertext
+type EnvelopeProvider struct {
+	KMS   KMS
+	KeyID string
+}
+
+func (p *EnvelopeProvider) Name() string {
+	return ProviderKMS
+}
+
+func sealGCM(key []byte, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func openGCM(key []byte, sealed []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("Ciphertext too short")
+	}
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+}
+
+// Encrypt returns base64 of the wrapped key length, the wrapped key and the sealed secret
+func (p *EnvelopeProvider) Encrypt(plaintext string) (string, error) {
+	key, wrapped, err := p.KMS.GenerateDataKey(p.KeyID)
+	if err != nil {
+		return "", err
+	}
+	if len(wrapped) > 0xffff {
+		return "", errors.New("Wrapped data key too long")
+	}
+	sealed, err := sealGCM(key, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	buf := make([]byte, 2, 2+len(wrapped)+len(sealed))
+	binary.BigEndian.PutUint16(buf, uint16(len(wrapped)))
+	buf = append(buf, wrapped...)
+	buf = append(buf, sealed...)
+	return base64.StdEncoding.EncodeToString(buf), nil
+}
+
+func (p *EnvelopeProvider) Decrypt(ciphertext string) (string, error) {
+	buf, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	if len(buf) < 2 {
+		return "", errors.New("Envelope too short")
+	}
+	n := int(binary.BigEndian.Uint16(buf))
+	if len(buf) < 2+n {
+		return "", errors.New("Envelope too short")
+	}
+	key, err := p.KMS.Decrypt(buf[2 : 2+n])
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := openGCM(key, buf[2+n:])
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// LocalKMS wraps data keys with a local 256 bits master key, it stands for a KMS in tests
+// and on hosts without one
+type LocalKMS struct {
+	MasterKey []byte
+}
+
+// NewLocalKMS reads the master key file, the file is created when missing
+func NewLocalKMS(keyPath string) (*LocalKMS, error) {
+	key, err := os.ReadFile(keyPath)
+	if os.IsNotExist(err) {
+		key = make([]byte, 32)
+		if _, err = rand.Read(key); err != nil {
+			return nil, err
+		}
+		err = os.WriteFile(keyPath, key, 0600)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != 32 {
+		return nil, errors.New("KMS master key must be 32 bytes")
+	}
+	return &LocalKMS{MasterKey: key}, nil
+}
+
+func (k *LocalKMS) GenerateDataKey(keyID string) ([]byte, []byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, nil, err
+	}
+	wrapped, err := sealGCM(k.MasterKey, key)
+	return key, wrapped, err
+}
+
+func (k *LocalKMS) Decrypt(wrapped []byte) ([]byte, error) {
+	return openGCM(k.MasterKey, wrapped)
+}
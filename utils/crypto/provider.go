@@ -0,0 +1,154 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+package crypto
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// SecretPrefix marks an encrypted value in the configuration, the AES keyfile ciphertext
+// follows directly while other providers add their name and a colon:
+//
+//	hash_<hex>            AES keyfile
+//	hash_age:<base64>     age recipients
+//	hash_vault:v1:<...>   Vault transit
+//	hash_kms:<base64>     KMS envelope
+const SecretPrefix = "hash_"
+
+const (
+	ProviderAES          = "aes"
+	ProviderVaultTransit = "vault"
+	ProviderAge          = "age"
+	ProviderKMS          = "kms"
+)
+
+// Provider encrypts and decrypts the secrets stored in the configuration
+type Provider interface {
+	Name() string
+	Encrypt(plaintext string) (string, error)
+	Decrypt(ciphertext string) (string, error)
+}
+
+var ErrNotEncrypted = errors.New("Value is not encrypted")
+
+// SecretPattern matches the encrypted values of a configuration file, including the ones
+// of a user:password list
+var SecretPattern = regexp.MustCompile(SecretPrefix + `[^",\s]+`)
+
+// ProviderOf returns the name of the provider that encrypted a value
+func ProviderOf(value string) (string, error) {
+	if !strings.HasPrefix(value, SecretPrefix) {
+		return "", ErrNotEncrypted
+	}
+	value = strings.TrimPrefix(value, SecretPrefix)
+	if name, _, ok := strings.Cut(value, ":"); ok {
+		return name, nil
+	}
+	if _, err := hex.DecodeString(value); err != nil {
+		return "", fmt.Errorf("Invalid encrypted value: %s", err)
+	}
+	return ProviderAES, nil
+}
+
+// Seal encrypts a value and adds the prefix of the provider
+func Seal(p Provider, plaintext string) (string, error) {
+	ciphertext, err := p.Encrypt(plaintext)
+	if err != nil {
+		return "", err
+	}
+	if p.Name() == ProviderAES {
+		return SecretPrefix + ciphertext, nil
+	}
+	return SecretPrefix + p.Name() + ":" + ciphertext, nil
+}
+
+// Open decrypts a value sealed by the provider
+func Open(p Provider, value string) (string, error) {
+	name, err := ProviderOf(value)
+	if err != nil {
+		return "", err
+	}
+	if name != p.Name() {
+		return "", fmt.Errorf("Value encrypted by %s not %s", name, p.Name())
+	}
+	value = strings.TrimPrefix(value, SecretPrefix)
+	if name != ProviderAES {
+		value = strings.TrimPrefix(value, name+":")
+	}
+	return p.Decrypt(value)
+}
+
+// Reencrypt replaces in a text every value sealed by from with the same value sealed by to,
+// it returns the new text and the number of values replaced
+func Reencrypt(text string, from Provider, to Provider) (string, int, error) {
+	var count int
+	var failure error
+	res := SecretPattern.ReplaceAllStringFunc(text, func(value string) string {
+		if failure != nil {
+			return value
+		}
+		if name, err := ProviderOf(value); err != nil || name != from.Name() {
+			return value
+		}
+		plaintext, err := Open(from, value)
+		if err != nil {
+			failure = err
+			return value
+		}
+		sealed, err := Seal(to, plaintext)
+		if err != nil {
+			failure = err
+			return value
+		}
+		count++
+		return sealed
+	})
+	if failure != nil {
+		return text, 0, failure
+	}
+	return res, count, nil
+}
+
+// AESProvider is the historical provider using the key of monitoring-key-path
+type AESProvider struct {
+	Key []byte
+}
+
+func (p *AESProvider) Name() string {
+	return ProviderAES
+}
+
+func (p *AESProvider) Encrypt(plaintext string) (string, error) {
+	if p.Key == nil {
+		return "", errors.New("No AES encryption key")
+	}
+	pw := Password{Key: p.Key, PlainText: plaintext}
+	pw.Encrypt()
+	if pw.CipherText == "" {
+		return "", errors.New("AES encryption failed")
+	}
+	return pw.CipherText, nil
+}
+
+func (p *AESProvider) Decrypt(ciphertext string) (string, error) {
+	if p.Key == nil {
+		return "", errors.New("No AES encryption key")
+	}
+	raw, err := hex.DecodeString(ciphertext)
+	if err != nil || len(raw) < 16 {
+		return "", errors.New("Invalid AES ciphertext")
+	}
+	pw := Password{Key: p.Key, CipherText: ciphertext}
+	if err := pw.Decrypt(); err != nil {
+		return "", err
+	}
+	return pw.PlainText, nil
+}
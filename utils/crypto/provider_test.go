@@ -0,0 +1,192 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+package crypto
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	vault "github.com/hashicorp/vault/api"
+)
+
+func testProviderRoundTrip(t *testing.T, p Provider) string {
+	sealed, err := Seal(p, "repl:s3cr3t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name, err := ProviderOf(sealed); err != nil || name != p.Name() {
+		t.Errorf("Expected provider %s of %s got %s %v", p.Name(), sealed, name, err)
+	}
+	if SecretPattern.FindString("user:"+sealed+",other") != sealed {
+		t.Errorf("Secret pattern does not match %s", sealed)
+	}
+	plaintext, err := Open(p, sealed)
+	if err != nil || plaintext != "repl:s3cr3t" {
+		t.Errorf("Unexpected plaintext %q %v", plaintext, err)
+	}
+	return sealed
+}
+
+func newTestAgeProvider(t *testing.T) *AgeProvider {
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "age.key")
+	if err = os.WriteFile(path, []byte("# test\n"+id.String()+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewAgeProvider("", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestAESProvider(t *testing.T) {
+	key, _ := Keygen()
+	p := &AESProvider{Key: key}
+	sealed := testProviderRoundTrip(t, p)
+	// values written by the password command stay readable
+	legacy := Password{Key: key, PlainText: "mypass"}
+	legacy.Encrypt()
+	if v, err := Open(p, SecretPrefix+legacy.CipherText); err != nil || v != "mypass" {
+		t.Errorf("Could not open legacy value: %q %v", v, err)
+	}
+	if !strings.HasPrefix(sealed, SecretPrefix) || strings.Contains(sealed, ":") {
+		t.Errorf("Unexpected AES value %s", sealed)
+	}
+}
+
+func TestAgeProvider(t *testing.T) {
+	p := newTestAgeProvider(t)
+	testProviderRoundTrip(t, p)
+	writeOnly, err := NewAgeProvider(p.Recipients[0].(*age.X25519Recipient).String(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, _ := Seal(writeOnly, "secret")
+	if _, err = Open(writeOnly, sealed); err == nil {
+		t.Errorf("Expected error decrypting without identity")
+	}
+	if v, err := Open(p, sealed); err != nil || v != "secret" {
+		t.Errorf("Unexpected plaintext %q %v", v, err)
+	}
+}
+
+func TestEnvelopeProvider(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "kms.key")
+	k, err := NewLocalKMS(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &EnvelopeProvider{KMS: k, KeyID: "test"}
+	sealed := testProviderRoundTrip(t, p)
+	// the master key is kept in its file
+	k2, err := NewLocalKMS(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := Open(&EnvelopeProvider{KMS: k2}, sealed); err != nil || v != "repl:s3cr3t" {
+		t.Errorf("Unexpected plaintext %q %v", v, err)
+	}
+	other, _ := NewLocalKMS(filepath.Join(t.TempDir(), "other.key"))
+	if _, err := Open(&EnvelopeProvider{KMS: other}, sealed); err == nil {
+		t.Errorf("Expected error with another master key")
+	}
+}
+
+func TestReencrypt(t *testing.T) {
+	key, _ := Keygen()
+	from := &AESProvider{Key: key}
+	to := newTestAgeProvider(t)
+	a, _ := Seal(from, "pass1")
+	b, _ := Seal(from, "pass2")
+	text := "[cluster1]\ndb-servers-credential = \"root:" + a + "\"\napi-credentials = \"admin:" + b + ",dba:clear\"\n"
+	res, n, err := Reencrypt(text, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || strings.Contains(res, a) || !strings.Contains(res, ",dba:clear\"") {
+		t.Fatalf("Unexpected reencrypted text %d %s", n, res)
+	}
+	values := SecretPattern.FindAllString(res, -1)
+	if len(values) != 2 {
+		t.Fatalf("Unexpected values %v", values)
+	}
+	if v, err := Open(to, values[1]); err != nil || v != "pass2" {
+		t.Errorf("Unexpected plaintext %q %v", v, err)
+	}
+	// nothing left to move
+	if _, n, _ = Reencrypt(res, from, to); n != 0 {
+		t.Errorf("Expected no value encrypted by %s got %d", from.Name(), n)
+	}
+}
+
+// TestVaultTransitProvider runs against a dev server with the transit engine and a key, for example:
+// vault secrets enable transit && vault write -f transit/keys/replication-manager
+// VAULT_ADDR=http://127.0.0.1:8200 VAULT_TOKEN=root go test ./utils/crypto -run Transit
+func TestVaultTransitProvider(t *testing.T) {
+	if os.Getenv("VAULT_ADDR") == "" || os.Getenv("VAULT_TOKEN") == "" {
+		t.Skip("VAULT_ADDR and VAULT_TOKEN are not set")
+	}
+	client, err := vault.NewClient(vault.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testProviderRoundTrip(t, &VaultTransitProvider{Client: client, Key: "replication-manager"})
+}
+
+// TestVaultTransitLogin fakes a transit engine refusing an expired token
+func TestVaultTransitLogin(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "renewed" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+		data := map[string]string{}
+		if strings.HasSuffix(r.URL.Path, "/encrypt/key") {
+			data["ciphertext"] = "vault:v1:" + req["plaintext"]
+		} else {
+			data["plaintext"] = strings.TrimPrefix(req["ciphertext"], "vault:v1:")
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}))
+	defer srv.Close()
+	newClient := func(token string) *vault.Client {
+		conf := vault.DefaultConfig()
+		conf.Address = srv.URL
+		client, err := vault.NewClient(conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client.SetToken(token)
+		return client
+	}
+	p := &VaultTransitProvider{Client: newClient("expired"), Key: "key"}
+	if _, err := p.Encrypt("s3cr3t"); err == nil {
+		t.Fatal("Expected expired token to be refused without login")
+	}
+	logins := 0
+	p.Login = func() (*vault.Client, error) {
+		logins++
+		return newClient("renewed"), nil
+	}
+	testProviderRoundTrip(t, p)
+	if logins != 1 {
+		t.Errorf("Expected one login got %d", logins)
+	}
+}
@@ -0,0 +1,101 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+package crypto
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"sync"
+
+	vault "github.com/hashicorp/vault/api"
+)
+
+// VaultTransitProvider asks the Vault transit engine to encrypt and decrypt, the key never
+// leaves Vault, with Login the client is replaced when Vault refuses its expired token
+type VaultTransitProvider struct {
+	Client *vault.Client
+	Mount  string
+	Key    string
+	Login  func() (*vault.Client, error)
+	mu     sync.Mutex
+}
+
+func (p *VaultTransitProvider) Name() string {
+	return ProviderVaultTransit
+}
+
+func (p *VaultTransitProvider) path(op string) string {
+	mount := p.Mount
+	if mount == "" {
+		mount = "transit"
+	}
+	return mount + "/" + op + "/" + p.Key
+}
+
+func (p *VaultTransitProvider) getClient() *vault.Client {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.Client
+}
+
+// write sends a transit request and logs in again once when the token was refused
+func (p *VaultTransitProvider) write(path string, data map[string]interface{}) (*vault.Secret, error) {
+	s, err := p.getClient().Logical().Write(path, data)
+	if !isVaultForbidden(err) || p.Login == nil {
+		return s, err
+	}
+	client, lerr := p.Login()
+	if lerr != nil {
+		return nil, lerr
+	}
+	p.mu.Lock()
+	p.Client = client
+	p.mu.Unlock()
+	return client.Logical().Write(path, data)
+}
+
+func isVaultForbidden(err error) bool {
+	var rerr *vault.ResponseError
+	return errors.As(err, &rerr) && rerr.StatusCode == http.StatusForbidden
+}
+
+// Encrypt returns the Vault ciphertext without its vault: prefix
+func (p *VaultTransitProvider) Encrypt(plaintext string) (string, error) {
+	s, err := p.write(p.path("encrypt"), map[string]interface{}{
+		"plaintext": base64.StdEncoding.EncodeToString([]byte(plaintext)),
+	})
+	if err != nil {
+		return "", err
+	}
+	if s == nil {
+		return "", errors.New("No answer from Vault transit encrypt")
+	}
+	ciphertext, _ := s.Data["ciphertext"].(string)
+	if len(ciphertext) < 7 || ciphertext[:6] != "vault:" {
+		return "", errors.New("Invalid Vault transit ciphertext")
+	}
+	return ciphertext[6:], nil
+}
+
+func (p *VaultTransitProvider) Decrypt(ciphertext string) (string, error) {
+	s, err := p.write(p.path("decrypt"), map[string]interface{}{
+		"ciphertext": "vault:" + ciphertext,
+	})
+	if err != nil {
+		return "", err
+	}
+	if s == nil {
+		return "", errors.New("No answer from Vault transit decrypt")
+	}
+	encoded, _ := s.Data["plaintext"].(string)
+	plaintext, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
@@ -30,6 +30,7 @@ import (
 	"github.com/jmoiron/sqlx"
 	"github.com/percona/go-mysql/query"
 	v3 "github.com/signal18/replication-manager/repmanv3"
+	gtidhelper "github.com/signal18/replication-manager/utils/gtid"
 	"github.com/signal18/replication-manager/utils/misc"
 	"github.com/signal18/replication-manager/utils/version"
 )
@@ -217,7 +218,9 @@ type SlaveStatus struct {
 	SlaveHeartbeatPeriod     float64        `db:"Slave_Heartbeat_Period" json:"slaveHeartbeatPeriod"`
 	ExecutedGtidSet          sql.NullString `db:"Executed_Gtid_Set" json:"executedGtidSet"`
 	RetrievedGtidSet         sql.NullString `db:"Retrieved_Gtid_Set" json:"retrievedGtidSet"`
+	AutoPosition             sql.NullString `db:"Auto_Position" json:"autoPosition"`
 	SlaveSQLRunningState     sql.NullString `db:"Slave_SQL_Running_State" json:"slaveSQLRunningState"`
+	MasterSSLAllowed         sql.NullString `db:"Master_SSL_Allowed" json:"masterSslAllowed"`
 	PGExternalID             sql.NullString `db:"external_id" json:"postgresExternalId"`
 	DoDomainIds              sql.NullString `db:"Replicate_Do_Domain_Ids" json:"eeplicateDoDomainIds"`
 	IgnoreDomainIds          sql.NullString `db:"Replicate_Ignore_Domain_Ids" json:"replicateIgnoreDomainIds"`
@@ -1733,6 +1736,14 @@ func GetTableChecksumResult(db *sqlx.DB) (map[uint64]chunk, string, error) {
 	return vars, query, nil
 }
 
+// GetTablePKColumns returns the primary key columns in index order
+func GetTablePKColumns(db *sqlx.DB, schema string, table string) ([]string, string, error) {
+	columns := make([]string, 0)
+	query := "SELECT COLUMN_NAME FROM information_schema.KEY_COLUMN_USAGE WHERE CONSTRAINT_NAME='PRIMARY' AND TABLE_SCHEMA=? AND TABLE_NAME=? ORDER BY ORDINAL_POSITION"
+	err := db.Select(&columns, query, schema, table)
+	return columns, query, err
+}
+
 func GetPlugins(db *sqlx.DB, myver *version.Version) (map[string]*Plugin, string, error) {
 
 	vars := make(map[string]*Plugin)
@@ -1944,6 +1955,40 @@ func GetUsers(db *sqlx.DB, myver *version.Version) (map[string]*Grant, string, e
 	return vars, query, nil
 }
 
+// UserAccount is a user of the server with the authentication details needed to audit it
+type UserAccount struct {
+	User        string
+	Host        string
+	Plugin      string
+	HasPassword bool
+	Super       bool
+}
+
+func GetUserAccounts(db *sqlx.DB, myver *version.Version) ([]UserAccount, string, error) {
+	var accounts []UserAccount
+	// password column was removed from the user table in mysql 5.7
+	query := "SELECT user, host, plugin, IFNULL(password<>'' OR authentication_string<>'', 0), Super_priv='Y' FROM mysql.user"
+	if myver.IsPostgreSQL() {
+		return accounts, "", errors.New("User accounts audit is not supported on PostgreSQL")
+	} else if (myver.IsMySQL() || myver.IsPercona()) && (myver.Major > 7 || (myver.Major == 5 && myver.Minor >= 7)) {
+		query = "SELECT user, host, plugin, IFNULL(authentication_string<>'', 0), Super_priv='Y' FROM mysql.user"
+	}
+	rows, err := db.Queryx(query)
+	if err != nil {
+		return nil, query, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a UserAccount
+		err = rows.Scan(&a.User, &a.Host, &a.Plugin, &a.HasPassword, &a.Super)
+		if err != nil {
+			return accounts, query, err
+		}
+		accounts = append(accounts, a)
+	}
+	return accounts, query, rows.Err()
+}
+
 func GetProxySQLUsers(db *sqlx.DB) (map[string]Grant, string, error) {
 	vars := make(map[string]Grant)
 	query := "SELECT username, password  FROM mysql_users"
@@ -2304,6 +2349,84 @@ func StartSlave(db *sqlx.DB, Channel string, myver *version.Version) (string, er
 	return cmd, err
 }
 
+// ChangeMasterDelay only changes MASTER_DELAY, replication threads must be stopped
+func ChangeMasterDelay(db *sqlx.DB, delay int, Channel string, myver *version.Version) (string, error) {
+	cmd := "CHANGE MASTER"
+	option := "MASTER_DELAY"
+	if myver.IsMariaDB() && Channel != "" {
+		cmd += " '" + Channel + "'"
+	}
+	if myver.IsMySQLOrPercona() && ((myver.Major >= 8 && myver.Minor > 0) || (myver.Major >= 8 && myver.Minor == 0 && myver.Release >= 23)) {
+		cmd = "CHANGE REPLICATION SOURCE"
+		option = "SOURCE_DELAY"
+	}
+	cmd += " TO " + option + "=" + strconv.Itoa(delay)
+	if myver.IsMySQLOrPercona() && Channel != "" {
+		cmd += " FOR CHANNEL '" + Channel + "'"
+	}
+	_, err := db.Exec(cmd)
+	return cmd, err
+}
+
+// IsValidGtidSet checks the syntax of a MariaDB GTID position or a MySQL GTID set
+func IsValidGtidSet(gtid string, myver *version.Version) bool {
+	if myver.IsMariaDB() {
+		return gtidhelper.IsMariaDBGtidSet(gtid)
+	}
+	return gtidhelper.IsMySQLGtidSet(gtid)
+}
+
+// StartSlaveUntilGtid applies events up to and including the given GTID position
+func StartSlaveUntilGtid(db *sqlx.DB, gtid string, Channel string, myver *version.Version) (string, error) {
+	if !IsValidGtidSet(gtid, myver) {
+		return "", fmt.Errorf("Invalid GTID position %q", gtid)
+	}
+	cmd := "START SLAVE"
+	if myver.IsMariaDB() {
+		if Channel != "" {
+			cmd += " '" + Channel + "'"
+		}
+		cmd += " UNTIL master_gtid_pos='" + gtid + "'"
+	} else {
+		cmd += " UNTIL SQL_AFTER_GTIDS='" + gtid + "'"
+		if Channel != "" {
+			cmd += " FOR CHANNEL '" + Channel + "'"
+		}
+	}
+	_, err := db.Exec(cmd)
+	return cmd, err
+}
+
+// StartSlaveUntilPos applies events up to the given master binary log coordinates
+func StartSlaveUntilPos(db *sqlx.DB, file string, pos string, Channel string, myver *version.Version) (string, error) {
+	cmd := "START SLAVE"
+	if myver.IsMariaDB() && Channel != "" {
+		cmd += " '" + Channel + "'"
+	}
+	cmd += " UNTIL MASTER_LOG_FILE='" + file + "', MASTER_LOG_POS=" + pos
+	if myver.IsMySQLOrPercona() && Channel != "" {
+		cmd += " FOR CHANNEL '" + Channel + "'"
+	}
+	_, err := db.Exec(cmd)
+	return cmd, err
+}
+
+func SetWsrepDesync(db *sqlx.DB, desync bool) (string, error) {
+	query := "SET GLOBAL wsrep_desync=OFF"
+	if desync {
+		query = "SET GLOBAL wsrep_desync=ON"
+	}
+	_, err := db.Exec(query)
+	return query, err
+}
+
+// SetWsrepPcBootstrap makes the node of a non-primary component the new primary component
+func SetWsrepPcBootstrap(db *sqlx.DB) (string, error) {
+	query := "SET GLOBAL wsrep_provider_options='pc.bootstrap=YES'"
+	_, err := db.Exec(query)
+	return query, err
+}
+
 func StartGroupReplication(db *sqlx.DB, myver *version.Version) (string, error) {
 	cmd := "START GROUP_REPLICATION"
 	_, err := db.Exec(cmd)
@@ -2556,6 +2679,14 @@ func CheckLongRunningWrites(db *sqlx.DB, thresh int) (int, string, error) {
 	return count, query + "(" + strconv.Itoa(thresh) + ")", err
 }
 
+// GetOpenTrxThreads returns the processlist ids of sessions holding an open InnoDB transaction
+func GetOpenTrxThreads(db *sqlx.DB) ([]uint64, string, error) {
+	var ids []uint64
+	query := "SELECT trx_mysql_thread_id FROM information_schema.INNODB_TRX"
+	err := db.Select(&ids, query)
+	return ids, query, err
+}
+
 func KillThreads(db *sqlx.DB, myver *version.Version) (string, error) {
 	//SELECT pg_terminate_backend(11929);
 	var ids []int
@@ -2917,6 +3048,25 @@ func CreateUser(db *sqlx.DB, myver *version.Version, user_host string, user_name
 	return query, nil
 }
 
+func DropUser(db *sqlx.DB, myver *version.Version, user_host string, user_name string) (string, error) {
+	query := "DROP USER '" + user_name + "'@'" + user_host + "'"
+	_, err := db.Exec(query)
+	return query, err
+}
+
+func SetUserOptions(db *sqlx.DB, myver *version.Version, user_host string, user_name string, options string) (string, error) {
+	query := "ALTER USER '" + user_name + "'@'" + user_host + "' " + options
+	_, err := db.Exec(query)
+	return query, err
+}
+
+func GetUserGrants(db *sqlx.DB, myver *version.Version, user_host string, user_name string) ([]string, string, error) {
+	grants := []string{}
+	query := "SHOW GRANTS FOR '" + user_name + "'@'" + user_host + "'"
+	err := db.Select(&grants, query)
+	return grants, query, err
+}
+
 func SetUserPassword(db *sqlx.DB, myver *version.Version, user_host string, user_name string, new_password string) (string, error) {
 	query := "ALTER USER '" + user_name + "'@'" + user_host + "' IDENTIFIED BY '" + new_password + "'"
 	_, err := db.Exec(query)
@@ -2956,6 +3106,12 @@ func RevokeUserGrants(db *sqlx.DB, myver *version.Version, user_host string, use
 	return query, err
 }
 
+func RevokeUserGrant(db *sqlx.DB, myver *version.Version, user_host string, user_name string, grant string) (string, error) {
+	query := "REVOKE " + grant + " FROM '" + user_name + "'@'" + user_host + "'"
+	_, err := db.Exec(query)
+	return query, err
+}
+
 func SetUserGrantsWithGrantOption(db *sqlx.DB, myver *version.Version, user_host string, user_name string, grants ...string) (string, error) {
 	var query string
 
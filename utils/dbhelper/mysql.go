@@ -3,7 +3,12 @@
 package dbhelper
 
 import (
+	"context"
+	"strconv"
+	"strings"
+
 	"github.com/jmoiron/sqlx"
+	"github.com/signal18/replication-manager/utils/version"
 )
 
 func HaveErrantTransactions(db *sqlx.DB, gtidMaster string, gtidSlave string) (bool, string, error) {
@@ -21,3 +26,121 @@ func HaveErrantTransactions(db *sqlx.DB, gtidMaster string, gtidSlave string) (b
 	}
 	return false, query, nil
 }
+
+// GtidSubtract returns the GTIDs of gtidSet that are not in gtidSubset,
+// the errant transactions of a slave are GtidSubtract(slave, master)
+func GtidSubtract(db *sqlx.DB, gtidSet string, gtidSubset string) (string, string, error) {
+	res := ""
+	query := "SELECT GTID_SUBTRACT('" + gtidSet + "','" + gtidSubset + "') as gtid"
+	err := db.QueryRowx(query).Scan(&res)
+	return res, query, err
+}
+
+func GetGtidExecuted(db *sqlx.DB) (string, string, error) {
+	gtid := ""
+	query := "SELECT @@GLOBAL.gtid_executed"
+	err := db.QueryRowx(query).Scan(&gtid)
+	return gtid, query, err
+}
+
+// InjectEmptyTransactions commits an empty transaction for each GTID, GTID_NEXT is a session variable
+// so a single connection is used
+func InjectEmptyTransactions(db *sqlx.DB, gtids []string) (string, error) {
+	logs := ""
+	conn, err := db.Connx(context.Background())
+	if err != nil {
+		return logs, err
+	}
+	defer conn.Close()
+	for _, gtid := range gtids {
+		for _, query := range []string{"SET GTID_NEXT='" + gtid + "'", "BEGIN", "COMMIT"} {
+			logs += query + ";"
+			if _, err = conn.ExecContext(context.Background(), query); err != nil {
+				conn.ExecContext(context.Background(), "SET GTID_NEXT='AUTOMATIC'")
+				return logs, err
+			}
+		}
+	}
+	query := "SET GTID_NEXT='AUTOMATIC'"
+	logs += query
+	_, err = conn.ExecContext(context.Background(), query)
+	return logs, err
+}
+
+func SetGtidPurged(db *sqlx.DB, gtid string) (string, error) {
+	query := "SET GLOBAL gtid_purged='" + gtid + "'"
+	_, err := db.Exec(query)
+	return query, err
+}
+
+func GetTableColumnNames(db *sqlx.DB, schema string, table string) ([]string, string, error) {
+	columns := make([]string, 0)
+	query := "SELECT COLUMN_NAME FROM information_schema.COLUMNS WHERE TABLE_SCHEMA=? AND TABLE_NAME=? ORDER BY ORDINAL_POSITION"
+	err := db.Select(&columns, query, schema, table)
+	return columns, query, err
+}
+
+// GroupReplicationMember is a row of performance_schema.replication_group_members,
+// role and version are only reported from MySQL 8.0
+type GroupReplicationMember struct {
+	ChannelName   string `db:"CHANNEL_NAME" json:"channelName"`
+	MemberId      string `db:"MEMBER_ID" json:"memberId"`
+	MemberHost    string `db:"MEMBER_HOST" json:"memberHost"`
+	MemberPort    int    `db:"MEMBER_PORT" json:"memberPort"`
+	MemberState   string `db:"MEMBER_STATE" json:"memberState"`
+	MemberRole    string `db:"MEMBER_ROLE" json:"memberRole"`
+	MemberVersion string `db:"MEMBER_VERSION" json:"memberVersion"`
+}
+
+func GetGroupReplicationMembers(db *sqlx.DB, myver *version.Version) ([]GroupReplicationMember, string, error) {
+	members := []GroupReplicationMember{}
+	query := "SELECT CHANNEL_NAME, MEMBER_ID, MEMBER_HOST, COALESCE(MEMBER_PORT, 0) AS MEMBER_PORT, MEMBER_STATE, MEMBER_ROLE, MEMBER_VERSION FROM performance_schema.replication_group_members"
+	if myver.Lower("8.0") {
+		query = "SELECT CHANNEL_NAME, MEMBER_ID, MEMBER_HOST, COALESCE(MEMBER_PORT, 0) AS MEMBER_PORT, MEMBER_STATE, '' AS MEMBER_ROLE, '' AS MEMBER_VERSION FROM performance_schema.replication_group_members"
+	}
+	err := db.Select(&members, query)
+	return members, query, err
+}
+
+func StopGroupReplication(db *sqlx.DB) (string, error) {
+	query := "STOP GROUP_REPLICATION"
+	_, err := db.Exec(query)
+	return query, err
+}
+
+func SetGroupReplicationMemberWeight(db *sqlx.DB, weight int) (string, error) {
+	query := "SET GLOBAL group_replication_member_weight = " + strconv.Itoa(weight)
+	_, err := db.Exec(query)
+	return query, err
+}
+
+// SetGroupReplicationPrimaryMember elects the member with the given server_uuid as primary,
+// it can be run from any member of a single-primary group
+func SetGroupReplicationPrimaryMember(db *sqlx.DB, uuid string) (string, error) {
+	var value string
+	query := "SELECT group_replication_set_as_primary(?)"
+	err := db.QueryRowx(query, uuid).Scan(&value)
+	return strings.Replace(query, "?", "'"+uuid+"'", 1), err
+}
+
+// SwitchGroupReplicationSinglePrimary switches the group to single-primary mode,
+// the new primary is elected from member weights when uuid is empty
+func SwitchGroupReplicationSinglePrimary(db *sqlx.DB, uuid string) (string, error) {
+	var value string
+	var err error
+	query := "SELECT group_replication_switch_to_single_primary_mode()"
+	if uuid != "" {
+		err = db.QueryRowx("SELECT group_replication_switch_to_single_primary_mode(?)", uuid).Scan(&value)
+		query = "SELECT group_replication_switch_to_single_primary_mode('" + uuid + "')"
+	} else {
+		err = db.QueryRowx(query).Scan(&value)
+	}
+	return query, err
+}
+
+func SwitchGroupReplicationMultiPrimary(db *sqlx.DB) (string, error) {
+	var value string
+	query := "SELECT group_replication_switch_to_multi_primary_mode()"
+	err := db.QueryRowx(query).Scan(&value)
+	return query, err
+}
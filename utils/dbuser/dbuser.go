@@ -0,0 +1,377 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+// Package dbuser models the application users of a cluster, their hosts and grants,
+// and compares them with the grants found on a database server.
+//
+// A user is written name@host|host=grant;grant and a grant is
+//
+//	privilege[+privilege...] on scope
+//
+// where scope is *.*, db.* or db.table. Users are separated by commas:
+//
+//	app@10.0.%|localhost=select+insert+update+delete on app.*;select on audit.*
+package dbuser
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+type Grant struct {
+	Privileges []string `json:"privileges"`
+	On         string   `json:"on"`
+}
+
+type User struct {
+	Name   string   `json:"name"`
+	Hosts  []string `json:"hosts"`
+	Grants []Grant  `json:"grants"`
+}
+
+// Policy is the password policy of the application users
+type Policy struct {
+	MinLength  int  `json:"minLength"`
+	Lifetime   int  `json:"lifetime"`
+	RequireSSL bool `json:"requireSsl"`
+}
+
+// Difference is a scope where a server does not hold the declared privileges
+type Difference struct {
+	On      string   `json:"on"`
+	Missing []string `json:"missing,omitempty"`
+	Extra   []string `json:"extra,omitempty"`
+}
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9_.$-]+$`)
+var validHost = regexp.MustCompile(`^[A-Za-z0-9_.%:/-]+$`)
+var validScope = regexp.MustCompile("^(\\*|[A-Za-z0-9_$-]+)\\.(\\*|[A-Za-z0-9_$-]+)$")
+var validPrivilege = regexp.MustCompile(`^[A-Z][A-Z ]*[A-Z]$`)
+
+// NormalizePrivilege uppercases a privilege and names ALL as MySQL shows it
+func NormalizePrivilege(p string) string {
+	p = strings.ToUpper(strings.Join(strings.Fields(p), " "))
+	if p == "ALL" {
+		return "ALL PRIVILEGES"
+	}
+	return p
+}
+
+// NormalizeScope removes the quotes of a scope as found in SHOW GRANTS
+func NormalizeScope(s string) string {
+	return strings.NewReplacer("`", "", "'", "", "\"", "").Replace(strings.TrimSpace(s))
+}
+
+// QuoteScope returns a scope usable in a GRANT statement
+func QuoteScope(s string) string {
+	db, tbl, _ := strings.Cut(s, ".")
+	if db != "*" {
+		db = "`" + db + "`"
+	}
+	if tbl != "*" {
+		tbl = "`" + tbl + "`"
+	}
+	return db + "." + tbl
+}
+
+func ParseGrant(s string) (Grant, error) {
+	var g Grant
+	idx := strings.LastIndex(strings.ToLower(s), " on ")
+	if idx < 0 {
+		return g, fmt.Errorf("Invalid grant %q expecting privilege+privilege on scope", s)
+	}
+	g.On = NormalizeScope(s[idx+4:])
+	if !validScope.MatchString(g.On) {
+		return g, fmt.Errorf("Invalid grant scope %q", g.On)
+	}
+	for _, p := range strings.Split(s[:idx], "+") {
+		p = NormalizePrivilege(p)
+		if !validPrivilege.MatchString(p) {
+			return g, fmt.Errorf("Invalid privilege %q in grant %q", p, s)
+		}
+		g.Privileges = append(g.Privileges, p)
+	}
+	sort.Strings(g.Privileges)
+	return g, nil
+}
+
+func (g Grant) String() string {
+	return strings.ToLower(strings.Join(g.Privileges, "+")) + " on " + g.On
+}
+
+// SQL returns the grant as in a GRANT statement without the grantee
+func (g Grant) SQL() string {
+	return strings.Join(g.Privileges, ", ") + " ON " + QuoteScope(g.On)
+}
+
+func ParseUser(s string) (User, error) {
+	var u User
+	def, grants, ok := strings.Cut(strings.TrimSpace(s), "=")
+	if !ok {
+		return u, fmt.Errorf("Invalid user %q expecting name@host=grant;grant", s)
+	}
+	name, hosts, ok := strings.Cut(def, "@")
+	if !ok {
+		hosts = "%"
+	}
+	u.Name = name
+	u.Hosts = strings.Split(hosts, "|")
+	for _, g := range strings.Split(grants, ";") {
+		if strings.TrimSpace(g) == "" {
+			continue
+		}
+		grant, err := ParseGrant(g)
+		if err != nil {
+			return u, err
+		}
+		u.Grants = append(u.Grants, grant)
+	}
+	return u, u.Validate()
+}
+
+func (u User) Validate() error {
+	if !validName.MatchString(u.Name) {
+		return fmt.Errorf("Invalid user name %q", u.Name)
+	}
+	if len(u.Hosts) == 0 {
+		return fmt.Errorf("User %s has no host", u.Name)
+	}
+	for _, h := range u.Hosts {
+		if !validHost.MatchString(h) {
+			return fmt.Errorf("Invalid host %q for user %s", h, u.Name)
+		}
+	}
+	for _, g := range u.Grants {
+		if !validScope.MatchString(g.On) || len(g.Privileges) == 0 {
+			return fmt.Errorf("Invalid grant %q for user %s", g.String(), u.Name)
+		}
+		for _, p := range g.Privileges {
+			if !validPrivilege.MatchString(p) {
+				return fmt.Errorf("Invalid privilege %q for user %s", p, u.Name)
+			}
+		}
+	}
+	return nil
+}
+
+func (u User) String() string {
+	grants := make([]string, 0, len(u.Grants))
+	for _, g := range u.Grants {
+		grants = append(grants, g.String())
+	}
+	return u.Name + "@" + strings.Join(u.Hosts, "|") + "=" + strings.Join(grants, ";")
+}
+
+// ParseUsers parses the users of db-users, the first error is returned with the valid users
+func ParseUsers(s string) (map[string]User, error) {
+	users := make(map[string]User)
+	var first error
+	for _, def := range strings.Split(s, ",") {
+		if strings.TrimSpace(def) == "" {
+			continue
+		}
+		u, err := ParseUser(def)
+		if err != nil {
+			if first == nil {
+				first = err
+			}
+			continue
+		}
+		users[u.Name] = u
+	}
+	return users, first
+}
+
+func FormatUsers(users map[string]User) string {
+	names := make([]string, 0, len(users))
+	for name := range users {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	list := make([]string, 0, len(names))
+	for _, name := range names {
+		list = append(list, users[name].String())
+	}
+	return strings.Join(list, ",")
+}
+
+// splitPrivileges splits a privilege list on the commas outside of column lists
+func splitPrivileges(s string) []string {
+	var res []string
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				res = append(res, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(res, s[start:])
+}
+
+// ParseShowGrant parses a line of SHOW GRANTS, role grants and proxy grants are ignored
+func ParseShowGrant(line string) (Grant, bool) {
+	var g Grant
+	upper := strings.ToUpper(line)
+	if !strings.HasPrefix(upper, "GRANT ") {
+		return g, false
+	}
+	on := strings.Index(upper, " ON ")
+	to := strings.LastIndex(upper, " TO ")
+	if on < 0 || to < on {
+		return g, false
+	}
+	g.On = NormalizeScope(line[on+4 : to])
+	if !validScope.MatchString(g.On) {
+		return g, false
+	}
+	for _, p := range splitPrivileges(line[6:on]) {
+		p = NormalizePrivilege(p)
+		if p == "USAGE" || p == "" {
+			continue
+		}
+		g.Privileges = append(g.Privileges, p)
+	}
+	if strings.Contains(upper[to:], " WITH GRANT OPTION") {
+		g.Privileges = append(g.Privileges, "GRANT OPTION")
+	}
+	sort.Strings(g.Privileges)
+	return g, true
+}
+
+// ParseShowGrants returns the privileges of every scope of a SHOW GRANTS result
+func ParseShowGrants(lines []string) []Grant {
+	var grants []Grant
+	for _, line := range lines {
+		if g, ok := ParseShowGrant(line); ok {
+			grants = append(grants, g)
+		}
+	}
+	return grants
+}
+
+func byScope(grants []Grant) map[string]map[string]bool {
+	res := make(map[string]map[string]bool)
+	for _, g := range grants {
+		if res[g.On] == nil {
+			res[g.On] = make(map[string]bool)
+		}
+		for _, p := range g.Privileges {
+			res[g.On][p] = true
+		}
+	}
+	return res
+}
+
+// Diff compares the declared grants with the grants of a server
+func Diff(declared []Grant, actual []Grant) []Difference {
+	want := byScope(declared)
+	have := byScope(actual)
+	scopes := make(map[string]bool)
+	for s := range want {
+		scopes[s] = true
+	}
+	for s := range have {
+		scopes[s] = true
+	}
+	var res []Difference
+	for s := range scopes {
+		d := Difference{On: s}
+		for p := range want[s] {
+			if !have[s][p] {
+				d.Missing = append(d.Missing, p)
+			}
+		}
+		for p := range have[s] {
+			if !want[s][p] {
+				d.Extra = append(d.Extra, p)
+			}
+		}
+		if len(d.Missing) == 0 && len(d.Extra) == 0 {
+			continue
+		}
+		sort.Strings(d.Missing)
+		sort.Strings(d.Extra)
+		res = append(res, d)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].On < res[j].On })
+	return res
+}
+
+func (d Difference) String() string {
+	var parts []string
+	if len(d.Missing) > 0 {
+		parts = append(parts, "missing "+strings.Join(d.Missing, ", "))
+	}
+	if len(d.Extra) > 0 {
+		parts = append(parts, "extra "+strings.Join(d.Extra, ", "))
+	}
+	return strings.Join(parts, " and ") + " on " + d.On
+}
+
+// Check verifies a password against the policy
+func (p Policy) Check(password string) error {
+	if len(password) < p.MinLength {
+		return fmt.Errorf("Password shorter than %d characters", p.MinLength)
+	}
+	if err := CheckPasswordChars(password); err != nil {
+		return err
+	}
+	var letter, digit bool
+	for _, c := range password {
+		letter = letter || unicode.IsLetter(c)
+		digit = digit || unicode.IsDigit(c)
+	}
+	if !letter || !digit {
+		return errors.New("Password needs letters and digits")
+	}
+	return nil
+}
+
+// CheckPasswordChars refuses the characters that can not be quoted in the CREATE USER,
+// ALTER USER and ProxySQL statements or stored in the user:password credential list
+func CheckPasswordChars(password string) error {
+	if strings.ContainsAny(password, "'\\\x00,:") {
+		return errors.New("Password contains a quote, a backslash, a NUL, a comma or a colon")
+	}
+	return nil
+}
+
+// Options returns the CREATE or ALTER USER options of the policy
+func (p Policy) Options() string {
+	var opts []string
+	if p.RequireSSL {
+		opts = append(opts, "REQUIRE SSL")
+	}
+	if p.Lifetime > 0 {
+		opts = append(opts, fmt.Sprintf("PASSWORD EXPIRE INTERVAL %d DAY", p.Lifetime))
+	}
+	return strings.Join(opts, " ")
+}
+
+// NativePassword returns the mysql_native_password hash of a password as stored by
+// ProxySQL and mysql.user
+func NativePassword(password string) string {
+	first := sha1.Sum([]byte(password))
+	second := sha1.Sum(first[:])
+	return fmt.Sprintf("*%X", second)
+}
+
+// SamePassword tells if a stored password, clear or hashed, is the password
+func SamePassword(stored string, password string) bool {
+	return stored == password || strings.EqualFold(stored, NativePassword(password))
+}
@@ -0,0 +1,82 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+package dbuser
+
+import (
+	"testing"
+)
+
+func TestParseUsers(t *testing.T) {
+	users, err := ParseUsers("app@10.0.%|localhost=select+insert+lock tables on app.*;select on audit.log, report=all on report.*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := users["app"]
+	if len(app.Hosts) != 2 || len(app.Grants) != 2 {
+		t.Fatalf("Unexpected user %v", app)
+	}
+	if app.Grants[0].SQL() != "INSERT, LOCK TABLES, SELECT ON `app`.*" {
+		t.Errorf("Unexpected grant %s", app.Grants[0].SQL())
+	}
+	if users["report"].Hosts[0] != "%" || users["report"].Grants[0].Privileges[0] != "ALL PRIVILEGES" {
+		t.Errorf("Unexpected user %v", users["report"])
+	}
+	again, err := ParseUsers(FormatUsers(users))
+	if err != nil || FormatUsers(again) != FormatUsers(users) {
+		t.Errorf("Format does not parse back %q %v", FormatUsers(users), err)
+	}
+	for _, bad := range []string{"app", "app@%=select", "app'@%=select on app.*", "app@%=select on app", "app@%=drop;x on app.*"} {
+		if _, err := ParseUser(bad); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	u, _ := ParseUser("app@%=select+insert on app.*")
+	actual := ParseShowGrants([]string{
+		"GRANT USAGE ON *.* TO `app`@`%` IDENTIFIED BY PASSWORD '*ABC'",
+		"GRANT SELECT, UPDATE, INSERT (a, b) ON `app`.* TO `app`@`%` WITH GRANT OPTION",
+		"GRANT `reader` TO `app`@`%`",
+	})
+	d := Diff(u.Grants, actual)
+	if len(d) != 1 || d[0].On != "app.*" {
+		t.Fatalf("Unexpected diff %v", d)
+	}
+	if len(d[0].Missing) != 1 || d[0].Missing[0] != "INSERT" {
+		t.Errorf("Unexpected missing %v", d[0].Missing)
+	}
+	if len(d[0].Extra) != 3 || d[0].Extra[0] != "GRANT OPTION" || d[0].Extra[1] != "INSERT (A, B)" {
+		t.Errorf("Unexpected extra %v", d[0].Extra)
+	}
+	if d := Diff(u.Grants, ParseShowGrants([]string{"GRANT SELECT, INSERT ON `app`.* TO 'app'@'%'"})); len(d) != 0 {
+		t.Errorf("Expected no diff got %v", d)
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	p := Policy{MinLength: 12, Lifetime: 90, RequireSSL: true}
+	for pass, ok := range map[string]bool{"short1": false, "longenoughpassword": false, "longenough1234": true, "long'enough1234": false, "long\\enough1234": false, "long\x00enough1234": false, "longenough1234'; DROP USER root; --": false} {
+		if err := p.Check(pass); (err == nil) != ok {
+			t.Errorf("Unexpected check of %q: %v", pass, err)
+		}
+	}
+	for _, pass := range []string{"a'b", "a\\b", "a\x00b", "a,b", "a:b"} {
+		if CheckPasswordChars(pass) == nil {
+			t.Errorf("Expected %q to be refused", pass)
+		}
+	}
+	if err := CheckPasswordChars("Abc-123_$%"); err != nil {
+		t.Errorf("Unexpected refusal: %s", err)
+	}
+	if p.Options() != "REQUIRE SSL PASSWORD EXPIRE INTERVAL 90 DAY" {
+		t.Errorf("Unexpected options %q", p.Options())
+	}
+	if NativePassword("secret") != "*14E65567ABDB5135D0CFD9A70B3032C179A49EE7" || !SamePassword("*14e65567abdb5135d0cfd9a70b3032c179a49ee7", "secret") {
+		t.Errorf("Unexpected native password %s", NativePassword("secret"))
+	}
+}
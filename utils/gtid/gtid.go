@@ -229,3 +229,65 @@ func (gl List) Equal(glcomp *List) bool {
 	}
 	return false
 }
+
+const (
+	mysqlGtidUUID      = `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`
+	mysqlGtidIntervals = `(:\d+(-\d+)?)+`
+	mysqlGtidTag       = `:[A-Za-z_][A-Za-z0-9_]{0,31}`
+	mysqlGtidSet       = mysqlGtidUUID + `(` + mysqlGtidTag + `)?` + mysqlGtidIntervals + `(` + mysqlGtidTag + mysqlGtidIntervals + `)*`
+)
+
+var (
+	mariadbGtidSetRegexp = regexp.MustCompile(`^\d+-\d+-\d+(,\s*\d+-\d+-\d+)*$`)
+	mysqlGtidSetRegexp   = regexp.MustCompile(`^` + mysqlGtidSet + `(,\s*` + mysqlGtidSet + `)*$`)
+)
+
+// IsMariaDBGtidSet checks a MariaDB GTID position like 0-1-100,1-2-5
+func IsMariaDBGtidSet(s string) bool {
+	return mariadbGtidSetRegexp.MatchString(s)
+}
+
+// IsMySQLGtidSet checks a MySQL GTID set like uuid:1-3:5,uuid:tag:7
+func IsMySQLGtidSet(s string) bool {
+	return mysqlGtidSetRegexp.MatchString(s)
+}
+
+// ExpandMySQLGtidSet returns every GTID of a MySQL GTID set like uuid:1-3:5,uuid:tag:7
+// It fails when the set holds more than max GTIDs
+func ExpandMySQLGtidSet(s string, max int) ([]string, error) {
+	res := make([]string, 0)
+	s = strings.NewReplacer("\n", "", "\r", "", " ", "").Replace(s)
+	if s == "" {
+		return res, nil
+	}
+	for _, set := range strings.Split(s, ",") {
+		parts := strings.Split(set, ":")
+		if len(parts) < 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid GTID set %s", set)
+		}
+		prefix := parts[0]
+		for _, interval := range parts[1:] {
+			bounds := strings.SplitN(interval, "-", 2)
+			start, err := strconv.ParseUint(bounds[0], 10, 64)
+			if err != nil {
+				// MySQL 8.4 tagged GTID, next intervals belong to the tag
+				prefix = parts[0] + ":" + interval
+				continue
+			}
+			end := start
+			if len(bounds) == 2 {
+				end, err = strconv.ParseUint(bounds[1], 10, 64)
+				if err != nil || end < start {
+					return nil, fmt.Errorf("invalid GTID interval %s", interval)
+				}
+			}
+			if uint64(len(res))+end-start+1 > uint64(max) {
+				return nil, fmt.Errorf("GTID set has more than %d transactions", max)
+			}
+			for seq := start; seq <= end; seq++ {
+				res = append(res, prefix+":"+strconv.FormatUint(seq, 10))
+			}
+		}
+	}
+	return res, nil
+}
@@ -44,3 +44,60 @@ func TestEqualGtid(t *testing.T) {
 	re := list1.Equal(list2)
 	t.Log("Comparison returned ", re)
 }
+
+func TestExpandMySQLGtidSet(t *testing.T) {
+	set := "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-3:5,\n8a94f357-aab4-11df-86ab-c80aa9429562:tag:7"
+	gtids, err := ExpandMySQLGtidSet(set, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"3e11fa47-71ca-11e1-9e33-c80aa9429562:1",
+		"3e11fa47-71ca-11e1-9e33-c80aa9429562:2",
+		"3e11fa47-71ca-11e1-9e33-c80aa9429562:3",
+		"3e11fa47-71ca-11e1-9e33-c80aa9429562:5",
+		"8a94f357-aab4-11df-86ab-c80aa9429562:tag:7",
+	}
+	if len(gtids) != len(expected) {
+		t.Fatalf("Expected %d GTIDs, got %v", len(expected), gtids)
+	}
+	for i := range expected {
+		if gtids[i] != expected[i] {
+			t.Errorf("Expected %s, got %s", expected[i], gtids[i])
+		}
+	}
+	if _, err := ExpandMySQLGtidSet(set, 4); err == nil {
+		t.Error("Expected an error above the max number of GTIDs")
+	}
+	if _, err := ExpandMySQLGtidSet("3e11fa47-71ca-11e1-9e33-c80aa9429562:5-3", 10); err == nil {
+		t.Error("Expected an error on a reversed interval")
+	}
+}
+
+func TestGtidSetSyntax(t *testing.T) {
+	for _, s := range []string{"0-1-100", "0-1-100,1-2-5", "0-1-100, 1-2-5"} {
+		if !IsMariaDBGtidSet(s) {
+			t.Errorf("Expected MariaDB GTID %q to be valid", s)
+		}
+	}
+	for _, s := range []string{"", "0-1", "0-1-a", "0-1-100'", "0-1-100' UNTIL x='", "0-1-100;DROP TABLE t"} {
+		if IsMariaDBGtidSet(s) {
+			t.Errorf("Expected MariaDB GTID %q to be refused", s)
+		}
+	}
+	for _, s := range []string{
+		"3e11fa47-71ca-11e1-9e33-c80aa9429562:23",
+		"3e11fa47-71ca-11e1-9e33-c80aa9429562:1-3:5",
+		"3e11fa47-71ca-11e1-9e33-c80aa9429562:1-3,8a94f357-aab4-11df-86ab-c80aa9429562:tag:7",
+		"3E11FA47-71CA-11E1-9E33-C80AA9429562:1-3:other_tag:1-2",
+	} {
+		if !IsMySQLGtidSet(s) {
+			t.Errorf("Expected MySQL GTID set %q to be valid", s)
+		}
+	}
+	for _, s := range []string{"", "3e11fa47-71ca-11e1-9e33-c80aa9429562", "3e11fa47:1", "3e11fa47-71ca-11e1-9e33-c80aa9429562:1'", "3e11fa47-71ca-11e1-9e33-c80aa9429562:1' FOR CHANNEL 'x", "0-1-100"} {
+		if IsMySQLGtidSet(s) {
+			t.Errorf("Expected MySQL GTID set %q to be refused", s)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+// Package ldaphelper authenticates users against an LDAP directory or Active Directory
+// with the search then bind method and returns their groups.
+package ldaphelper
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+const (
+	DefaultUserFilter  = "(uid=%s)"
+	DefaultGroupFilter = "(|(member=%d)(uniqueMember=%d)(memberUid=%s))"
+	DefaultGroupAttr   = "cn"
+	DefaultEmailAttr   = "mail"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("Invalid credentials")
+	ErrUserNotFound       = errors.New("User not found in directory")
+)
+
+// Config describes the directory. In filters %s is replaced by the escaped login and
+// %d by the escaped user DN. With MemberOfAttr set, like memberOf on Active Directory,
+// groups are read from the user entry instead of being searched.
+type Config struct {
+	URL                string
+	BindDN             string
+	BindPassword       string
+	BaseDN             string
+	UserFilter         string
+	EmailAttr          string
+	GroupBaseDN        string
+	GroupFilter        string
+	GroupAttr          string
+	MemberOfAttr       string
+	StartTLS           bool
+	InsecureSkipVerify bool
+	Timeout            time.Duration
+}
+
+type Identity struct {
+	User   string   `json:"user"`
+	DN     string   `json:"dn"`
+	Email  string   `json:"email"`
+	Groups []string `json:"groups"`
+}
+
+func (conf Config) withDefaults() Config {
+	if conf.UserFilter == "" {
+		conf.UserFilter = DefaultUserFilter
+	}
+	if conf.GroupAttr == "" {
+		conf.GroupAttr = DefaultGroupAttr
+	}
+	if conf.EmailAttr == "" {
+		conf.EmailAttr = DefaultEmailAttr
+	}
+	if conf.GroupBaseDN == "" {
+		conf.GroupBaseDN = conf.BaseDN
+	}
+	if conf.GroupFilter == "" && conf.MemberOfAttr == "" {
+		conf.GroupFilter = DefaultGroupFilter
+	}
+	if conf.Timeout == 0 {
+		conf.Timeout = 5 * time.Second
+	}
+	return conf
+}
+
+func expandFilter(filter string, user string, dn string) string {
+	return strings.NewReplacer("%s", ldap.EscapeFilter(user), "%d", ldap.EscapeFilter(dn)).Replace(filter)
+}
+
+func (conf Config) dial() (*ldap.Conn, error) {
+	tlsConf := &tls.Config{InsecureSkipVerify: conf.InsecureSkipVerify}
+	if host, _, err := net.SplitHostPort(strings.TrimPrefix(strings.TrimPrefix(conf.URL, "ldaps://"), "ldap://")); err == nil {
+		tlsConf.ServerName = host
+	}
+	l, err := ldap.DialURL(conf.URL, ldap.DialWithDialer(&net.Dialer{Timeout: conf.Timeout}), ldap.DialWithTLSConfig(tlsConf))
+	if err != nil {
+		return nil, err
+	}
+	l.SetTimeout(conf.Timeout)
+	if conf.StartTLS {
+		if err = l.StartTLS(tlsConf); err != nil {
+			l.Close()
+			return nil, fmt.Errorf("StartTLS failed: %s", err)
+		}
+	}
+	return l, nil
+}
+
+// serviceBind binds with the search account, or stays anonymous without one
+func (conf Config) serviceBind(l *ldap.Conn) error {
+	if conf.BindDN == "" {
+		return nil
+	}
+	if err := l.Bind(conf.BindDN, conf.BindPassword); err != nil {
+		return fmt.Errorf("Bind as %s failed: %s", conf.BindDN, err)
+	}
+	return nil
+}
+
+// Authenticate finds the user entry, checks the password with a bind as the user and
+// collects the user groups
+func Authenticate(conf Config, user string, password string) (Identity, error) {
+	conf = conf.withDefaults()
+	id := Identity{User: user}
+	// an empty password is an unauthenticated bind that most servers accept
+	if user == "" || password == "" {
+		return id, ErrInvalidCredentials
+	}
+	l, err := conf.dial()
+	if err != nil {
+		return id, err
+	}
+	defer l.Close()
+
+	if err = conf.serviceBind(l); err != nil {
+		return id, err
+	}
+	attrs := []string{conf.EmailAttr}
+	if conf.MemberOfAttr != "" {
+		attrs = append(attrs, conf.MemberOfAttr)
+	}
+	res, err := l.Search(ldap.NewSearchRequest(conf.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(conf.Timeout.Seconds()), false,
+		expandFilter(conf.UserFilter, user, ""), attrs, nil))
+	if err != nil {
+		return id, fmt.Errorf("User search failed: %s", err)
+	}
+	if len(res.Entries) == 0 {
+		return id, ErrUserNotFound
+	}
+	if len(res.Entries) > 1 {
+		return id, fmt.Errorf("User filter matches %d entries", len(res.Entries))
+	}
+	entry := res.Entries[0]
+	id.DN = entry.DN
+	id.Email = entry.GetAttributeValue(conf.EmailAttr)
+
+	if err = l.Bind(id.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return id, ErrInvalidCredentials
+		}
+		return id, err
+	}
+
+	if conf.MemberOfAttr != "" {
+		for _, dn := range entry.GetAttributeValues(conf.MemberOfAttr) {
+			id.Groups = append(id.Groups, groupName(dn))
+		}
+	}
+	if conf.GroupFilter != "" {
+		// the user may not be allowed to read groups
+		if err = conf.serviceBind(l); err != nil {
+			return id, err
+		}
+		res, err = l.Search(ldap.NewSearchRequest(conf.GroupBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, int(conf.Timeout.Seconds()), false,
+			expandFilter(conf.GroupFilter, user, id.DN), []string{conf.GroupAttr}, nil))
+		if err != nil {
+			return id, fmt.Errorf("Group search failed: %s", err)
+		}
+		for _, g := range res.Entries {
+			if name := g.GetAttributeValue(conf.GroupAttr); name != "" && !contains(id.Groups, name) {
+				id.Groups = append(id.Groups, name)
+			}
+		}
+	}
+	return id, nil
+}
+
+// groupName returns the first RDN value of a group DN, cn=dba,ou=groups gives dba
+func groupName(dn string) string {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil || len(parsed.RDNs) == 0 || len(parsed.RDNs[0].Attributes) == 0 {
+		return dn
+	}
+	return parsed.RDNs[0].Attributes[0].Value
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,231 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+package ldaphelper
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+type testEntry struct {
+	dn       string
+	password string
+	attrs    map[string][]string
+}
+
+// testServer is an in-process LDAP server answering simple binds and searches with
+// and, or, equality and presence filters
+type testServer struct {
+	listener net.Listener
+	entries  []testEntry
+}
+
+func newTestServer(t *testing.T, entries []testEntry) *testServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testServer{listener: l, entries: entries}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *testServer) URL() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+func (s *testServer) Close() {
+	s.listener.Close()
+}
+
+func response(id int64, tag ber.Tag, code int64) *ber.Packet {
+	p := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "MessageID"))
+	r := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Response")
+	r.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "resultCode"))
+	r.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	r.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "diagnosticMessage"))
+	p.AppendChild(r)
+	return p
+}
+
+func entryPacket(id int64, e testEntry, attrs []string) *ber.Packet {
+	p := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "MessageID"))
+	r := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Entry")
+	r.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.dn, "objectName"))
+	list := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attributes")
+	for _, name := range attrs {
+		values, ok := e.attrs[name]
+		if !ok {
+			continue
+		}
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "values")
+		for _, v := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "value"))
+		}
+		attr.AppendChild(set)
+		list.AppendChild(attr)
+	}
+	r.AppendChild(list)
+	p.AppendChild(r)
+	return p
+}
+
+func (e testEntry) match(f *ber.Packet) bool {
+	switch f.Tag {
+	case ldap.FilterAnd:
+		for _, c := range f.Children {
+			if !e.match(c) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, c := range f.Children {
+			if e.match(c) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterEqualityMatch:
+		for _, v := range e.attrs[f.Children[0].Data.String()] {
+			if strings.EqualFold(v, f.Children[1].Data.String()) {
+				return true
+			}
+		}
+	case ldap.FilterPresent:
+		_, ok := e.attrs[f.Data.String()]
+		return ok
+	}
+	return false
+}
+
+func (s *testServer) serve(conn net.Conn) {
+	defer conn.Close()
+	bound := ""
+	for {
+		p, err := ber.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		id := p.Children[0].Value.(int64)
+		op := p.Children[1]
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			dn, password := op.Children[1].Data.String(), op.Children[2].Data.String()
+			code := int64(ldap.LDAPResultInvalidCredentials)
+			for _, e := range s.entries {
+				if strings.EqualFold(e.dn, dn) && e.password != "" && e.password == password {
+					code = ldap.LDAPResultSuccess
+					bound = e.dn
+				}
+			}
+			conn.Write(response(id, ldap.ApplicationBindResponse, code).Bytes())
+		case ldap.ApplicationSearchRequest:
+			if bound == "" {
+				conn.Write(response(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultInsufficientAccessRights).Bytes())
+				continue
+			}
+			base := strings.ToLower(op.Children[0].Data.String())
+			var attrs []string
+			for _, a := range op.Children[7].Children {
+				attrs = append(attrs, a.Data.String())
+			}
+			for _, e := range s.entries {
+				if strings.HasSuffix(strings.ToLower(e.dn), base) && e.match(op.Children[6]) {
+					conn.Write(entryPacket(id, e, append(attrs, "cn")).Bytes())
+				}
+			}
+			conn.Write(response(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess).Bytes())
+		case ldap.ApplicationUnbindRequest:
+			return
+		}
+	}
+}
+
+var directory = []testEntry{
+	{dn: "cn=repman,ou=services,dc=example,dc=org", password: "svc"},
+	{dn: "uid=alice,ou=users,dc=example,dc=org", password: "alicepwd", attrs: map[string][]string{
+		"uid": {"alice"}, "mail": {"alice@example.org"}, "memberOf": {"cn=dba,ou=groups,dc=example,dc=org"}}},
+	{dn: "uid=bob,ou=users,dc=example,dc=org", password: "bobpwd", attrs: map[string][]string{"uid": {"bob"}}},
+	{dn: "uid=dup,ou=users,dc=example,dc=org", password: "x", attrs: map[string][]string{"uid": {"dup"}}},
+	{dn: "uid=dup,ou=other,dc=example,dc=org", password: "x", attrs: map[string][]string{"uid": {"dup"}}},
+	{dn: "cn=dba,ou=groups,dc=example,dc=org", attrs: map[string][]string{
+		"cn": {"dba"}, "member": {"uid=alice,ou=users,dc=example,dc=org"}}},
+	{dn: "cn=ops,ou=groups,dc=example,dc=org", attrs: map[string][]string{
+		"cn": {"ops"}, "memberUid": {"alice", "bob"}}},
+}
+
+func TestAuthenticate(t *testing.T) {
+	s := newTestServer(t, directory)
+	defer s.Close()
+	conf := Config{URL: s.URL(), BindDN: "cn=repman,ou=services,dc=example,dc=org", BindPassword: "svc", BaseDN: "dc=example,dc=org"}
+
+	id, err := Authenticate(conf, "alice", "alicepwd")
+	if err != nil {
+		t.Fatalf("Authentication failed %s", err)
+	}
+	sort.Strings(id.Groups)
+	if id.DN != "uid=alice,ou=users,dc=example,dc=org" || id.Email != "alice@example.org" || strings.Join(id.Groups, " ") != "dba ops" {
+		t.Errorf("Unexpected identity %v", id)
+	}
+
+	id, err = Authenticate(conf, "bob", "bobpwd")
+	if err != nil || len(id.Groups) != 1 || id.Groups[0] != "ops" {
+		t.Errorf("Unexpected identity %v %v", id, err)
+	}
+
+	if _, err = Authenticate(conf, "alice", "wrong"); err != ErrInvalidCredentials {
+		t.Errorf("Expected invalid credentials got %v", err)
+	}
+	if _, err = Authenticate(conf, "alice", ""); err != ErrInvalidCredentials {
+		t.Errorf("Expected invalid credentials for empty password got %v", err)
+	}
+	if _, err = Authenticate(conf, "carol", "x"); err != ErrUserNotFound {
+		t.Errorf("Expected user not found got %v", err)
+	}
+	if _, err = Authenticate(conf, "dup", "x"); err == nil {
+		t.Errorf("Expected error for ambiguous user")
+	}
+	// filter injection is escaped
+	if _, err = Authenticate(conf, "*", "alicepwd"); err != ErrUserNotFound {
+		t.Errorf("Expected escaped filter got %v", err)
+	}
+
+	bad := conf
+	bad.BindPassword = "wrong"
+	if _, err = Authenticate(bad, "alice", "alicepwd"); err == nil || !strings.Contains(err.Error(), "Bind as") {
+		t.Errorf("Expected service bind error got %v", err)
+	}
+}
+
+func TestAuthenticateMemberOf(t *testing.T) {
+	s := newTestServer(t, directory)
+	defer s.Close()
+	// Active Directory style, groups come from the user entry
+	conf := Config{URL: s.URL(), BindDN: "cn=repman,ou=services,dc=example,dc=org", BindPassword: "svc", BaseDN: "ou=users,dc=example,dc=org", MemberOfAttr: "memberOf"}
+	id, err := Authenticate(conf, "alice", "alicepwd")
+	if err != nil || len(id.Groups) != 1 || id.Groups[0] != "dba" {
+		t.Errorf("Unexpected identity %v %v", id, err)
+	}
+}
@@ -0,0 +1,373 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+// Package rbac evaluates custom roles made of allow and deny rules on grants, each
+// rule optionally scoped to servers, proxies, tags or replication roles.
+//
+// A role is written name=rule;rule and a rule is
+//
+//	allow|deny grant [grant...] [on scope|scope...]
+//
+// where a grant is a grant name or a prefix of it as in the api acl, * is every grant,
+// and a scope is server:<name>, proxy:<name>, tag:<tag> or role:<master|slave>, names
+// accepting shell patterns. Tags are the tags of the targeted server or proxy. Roles
+// are separated by commas:
+//
+//	backup-team=allow db-backup db-restore on role:slave;deny cluster-failover cluster-switchover
+package rbac
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+
+	ScopeServer = "server"
+	ScopeProxy  = "proxy"
+	ScopeTag    = "tag"
+	ScopeRole   = "role"
+
+	KindCluster = "cluster"
+	KindServer  = "server"
+	KindProxy   = "proxy"
+)
+
+type Scope struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+type Rule struct {
+	Effect string   `json:"effect"`
+	Grants []string `json:"grants"`
+	Scopes []Scope  `json:"scopes"`
+}
+
+type Role struct {
+	Name  string `json:"name"`
+	Rules []Rule `json:"rules"`
+}
+
+// Resource is the target of an action, Aliases are the other names it answers to
+// like host:port and Role its current replication role
+type Resource struct {
+	Kind    string   `json:"kind"`
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases"`
+	Role    string   `json:"role"`
+	Tags    []string `json:"tags"`
+}
+
+// Decision explains the result of an evaluation
+type Decision struct {
+	User     string   `json:"user"`
+	Grant    string   `json:"grant"`
+	Resource Resource `json:"resource"`
+	Allowed  bool     `json:"allowed"`
+	Role     string   `json:"role"`
+	Rule     string   `json:"rule"`
+	Reason   string   `json:"reason"`
+}
+
+func ParseScope(s string) (Scope, error) {
+	kind, value, ok := strings.Cut(s, ":")
+	if !ok || value == "" {
+		return Scope{}, fmt.Errorf("Invalid scope %q expecting kind:value", s)
+	}
+	switch kind {
+	case ScopeServer, ScopeProxy, ScopeTag, ScopeRole:
+	default:
+		return Scope{}, fmt.Errorf("Unknown scope kind %q", kind)
+	}
+	if _, err := path.Match(value, ""); err != nil {
+		return Scope{}, fmt.Errorf("Invalid scope pattern %q: %s", value, err)
+	}
+	return Scope{Kind: kind, Value: value}, nil
+}
+
+func ParseRule(s string) (Rule, error) {
+	var rule Rule
+	fields := strings.Fields(s)
+	if len(fields) < 2 {
+		return rule, fmt.Errorf("Invalid rule %q expecting allow|deny grant...", s)
+	}
+	rule.Effect = fields[0]
+	if rule.Effect != EffectAllow && rule.Effect != EffectDeny {
+		return rule, fmt.Errorf("Invalid rule effect %q", rule.Effect)
+	}
+	for i := 1; i < len(fields); i++ {
+		if fields[i] == "on" {
+			if i != len(fields)-2 {
+				return rule, fmt.Errorf("Invalid rule %q expecting one scope list after on", s)
+			}
+			for _, sc := range strings.Split(fields[i+1], "|") {
+				scope, err := ParseScope(sc)
+				if err != nil {
+					return rule, err
+				}
+				rule.Scopes = append(rule.Scopes, scope)
+			}
+			break
+		}
+		rule.Grants = append(rule.Grants, fields[i])
+	}
+	if len(rule.Grants) == 0 {
+		return rule, fmt.Errorf("Invalid rule %q without grant", s)
+	}
+	return rule, nil
+}
+
+func ParseRole(s string) (Role, error) {
+	var role Role
+	name, def, ok := strings.Cut(s, "=")
+	role.Name = strings.TrimSpace(name)
+	if !ok || role.Name == "" {
+		return role, fmt.Errorf("Invalid role %q expecting name=rules", s)
+	}
+	for _, r := range strings.Split(def, ";") {
+		if strings.TrimSpace(r) == "" {
+			continue
+		}
+		rule, err := ParseRule(r)
+		if err != nil {
+			return role, fmt.Errorf("Role %s: %s", role.Name, err)
+		}
+		role.Rules = append(role.Rules, rule)
+	}
+	return role, role.Validate()
+}
+
+// ParseRoles reads a comma separated list of roles, the first error is returned along
+// with the valid roles
+func ParseRoles(s string) (map[string]Role, error) {
+	roles := make(map[string]Role)
+	var firstErr error
+	for _, def := range strings.Split(s, ",") {
+		if strings.TrimSpace(def) == "" {
+			continue
+		}
+		role, err := ParseRole(def)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		roles[role.Name] = role
+	}
+	return roles, firstErr
+}
+
+// Validate checks a role built from the API
+func (role Role) Validate() error {
+	if role.Name == "" || strings.ContainsAny(role.Name, "=;,: ") {
+		return fmt.Errorf("Invalid role name %q", role.Name)
+	}
+	for _, rule := range role.Rules {
+		if rule.Effect != EffectAllow && rule.Effect != EffectDeny {
+			return fmt.Errorf("Role %s: invalid rule effect %q", role.Name, rule.Effect)
+		}
+		if len(rule.Grants) == 0 {
+			return fmt.Errorf("Role %s: rule without grant", role.Name)
+		}
+		for _, g := range rule.Grants {
+			if g == "" || g == "on" || strings.ContainsAny(g, "=;,: |") {
+				return fmt.Errorf("Role %s: invalid grant %q", role.Name, g)
+			}
+		}
+		for _, sc := range rule.Scopes {
+			if _, err := ParseScope(sc.Kind + ":" + sc.Value); err != nil || strings.ContainsAny(sc.Value, "=;, |") {
+				return fmt.Errorf("Role %s: invalid scope %s:%s", role.Name, sc.Kind, sc.Value)
+			}
+		}
+	}
+	return nil
+}
+
+func (sc Scope) String() string {
+	return sc.Kind + ":" + sc.Value
+}
+
+func (rule Rule) String() string {
+	s := rule.Effect + " " + strings.Join(rule.Grants, " ")
+	if len(rule.Scopes) > 0 {
+		var scopes []string
+		for _, sc := range rule.Scopes {
+			scopes = append(scopes, sc.String())
+		}
+		s += " on " + strings.Join(scopes, "|")
+	}
+	return s
+}
+
+func (role Role) String() string {
+	var rules []string
+	for _, rule := range role.Rules {
+		rules = append(rules, rule.String())
+	}
+	return role.Name + "=" + strings.Join(rules, ";")
+}
+
+// FormatRoles is the configuration form of roles, sorted by name
+func FormatRoles(roles map[string]Role) string {
+	var defs []string
+	for _, role := range roles {
+		defs = append(defs, role.String())
+	}
+	sort.Strings(defs)
+	return strings.Join(defs, ",")
+}
+
+// ParseBindings reads user:role role,user:role
+func ParseBindings(s string) map[string][]string {
+	bindings := make(map[string][]string)
+	for _, b := range strings.Split(s, ",") {
+		user, roles, ok := strings.Cut(b, ":")
+		user = strings.TrimSpace(user)
+		if !ok || user == "" {
+			continue
+		}
+		for _, role := range strings.Fields(roles) {
+			if !contains(bindings[user], role) {
+				bindings[user] = append(bindings[user], role)
+			}
+		}
+	}
+	return bindings
+}
+
+func FormatBindings(bindings map[string][]string) string {
+	var list []string
+	for user, roles := range bindings {
+		if len(roles) > 0 {
+			list = append(list, user+":"+strings.Join(roles, " "))
+		}
+	}
+	sort.Strings(list)
+	return strings.Join(list, ",")
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func matchName(pattern string, names ...string) bool {
+	for _, name := range names {
+		if ok, _ := path.Match(pattern, name); ok && name != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches reports whether the scope includes the resource, server, proxy and role
+// scopes never include the cluster itself
+func (sc Scope) Matches(res Resource) bool {
+	switch sc.Kind {
+	case ScopeServer:
+		return res.Kind == KindServer && matchName(sc.Value, append([]string{res.Name}, res.Aliases...)...)
+	case ScopeProxy:
+		return res.Kind == KindProxy && matchName(sc.Value, append([]string{res.Name}, res.Aliases...)...)
+	case ScopeRole:
+		return res.Kind == KindServer && matchName(sc.Value, res.Role)
+	case ScopeTag:
+		return matchName(sc.Value, res.Tags...)
+	}
+	return false
+}
+
+// MatchGrant uses the prefix semantic of the api acl, db- covers every db grant
+func (rule Rule) MatchGrant(grant string) bool {
+	for _, g := range rule.Grants {
+		if g == "*" || strings.HasPrefix(grant, g) {
+			return true
+		}
+	}
+	return false
+}
+
+func (rule Rule) Matches(grant string, res Resource) bool {
+	if !rule.MatchGrant(grant) {
+		return false
+	}
+	if len(rule.Scopes) == 0 {
+		return true
+	}
+	for _, sc := range rule.Scopes {
+		if sc.Matches(res) {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate decides if grant is given on res. A matching deny rule wins, then the
+// unscoped grants of the user acl, then a matching allow rule.
+func Evaluate(base map[string]bool, roles []Role, grant string, res Resource) Decision {
+	d := Decision{Grant: grant, Resource: res}
+	for _, role := range roles {
+		for _, rule := range role.Rules {
+			if rule.Effect == EffectDeny && rule.Matches(grant, res) {
+				d.Role = role.Name
+				d.Rule = rule.String()
+				d.Reason = "denied by role " + role.Name
+				return d
+			}
+		}
+	}
+	if base[grant] {
+		d.Allowed = true
+		d.Reason = "granted by user acl"
+		return d
+	}
+	for _, role := range roles {
+		for _, rule := range role.Rules {
+			if rule.Effect == EffectAllow && rule.Matches(grant, res) {
+				d.Allowed = true
+				d.Role = role.Name
+				d.Rule = rule.String()
+				d.Reason = "allowed by role " + role.Name
+				return d
+			}
+		}
+	}
+	d.Reason = "not granted"
+	return d
+}
+
+// AllowedGrants returns the grants of the list that an allow rule of the role gives
+// on at least one resource
+func (role Role) AllowedGrants(grants []string) []string {
+	var res []string
+	for _, g := range grants {
+		for _, rule := range role.Rules {
+			if rule.Effect == EffectAllow && rule.MatchGrant(g) {
+				res = append(res, g)
+				break
+			}
+		}
+	}
+	return res
+}
+
+// EffectiveGrants returns the grants of a user on a resource, grants lists every known grant
+func EffectiveGrants(base map[string]bool, roles []Role, grants []string, res Resource) map[string]bool {
+	effective := make(map[string]bool, len(grants))
+	for _, g := range grants {
+		effective[g] = Evaluate(base, roles, g, res).Allowed
+	}
+	return effective
+}
@@ -0,0 +1,105 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+package rbac
+
+import (
+	"strings"
+	"testing"
+)
+
+const backupTeam = "backup-team=allow db-backup db-restore on role:slave|server:db9;deny cluster-failover cluster-switchover"
+
+func TestParseRoles(t *testing.T) {
+	roles, err := ParseRoles(backupTeam + ",readers=allow db-show on tag:ssd, broken=grant all")
+	if err == nil {
+		t.Errorf("Expected error for broken role")
+	}
+	if len(roles) != 2 {
+		t.Fatalf("Expected 2 valid roles got %v", roles)
+	}
+	role := roles["backup-team"]
+	if len(role.Rules) != 2 || len(role.Rules[0].Scopes) != 2 || role.Rules[0].Scopes[1] != (Scope{Kind: ScopeServer, Value: "db9"}) {
+		t.Errorf("Unexpected role %v", role)
+	}
+	if role.String() != backupTeam {
+		t.Errorf("Role does not round trip %s", role.String())
+	}
+	if FormatRoles(roles) != backupTeam+",readers=allow db-show on tag:ssd" {
+		t.Errorf("Unexpected roles format %s", FormatRoles(roles))
+	}
+	for _, def := range []string{"x=allow", "x=permit db-show", "x=allow db-show on", "x=allow db-show on host:db1", "=allow db-show", "x=allow db-show on role:[", "x y=allow db-show"} {
+		if _, err := ParseRole(def); err == nil {
+			t.Errorf("Expected error for %s", def)
+		}
+	}
+
+	bindings := ParseBindings("alice:backup-team readers backup-team, bob:readers,:x")
+	if len(bindings) != 2 || len(bindings["alice"]) != 2 || bindings["bob"][0] != "readers" {
+		t.Errorf("Unexpected bindings %v", bindings)
+	}
+	if FormatBindings(bindings) != "alice:backup-team readers,bob:readers" {
+		t.Errorf("Unexpected bindings format %s", FormatBindings(bindings))
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	roles, _ := ParseRoles(backupTeam)
+	bound := []Role{roles["backup-team"]}
+	base := map[string]bool{"db-show-logs": true, "cluster-failover": true}
+
+	master := Resource{Kind: KindServer, Name: "db1", Aliases: []string{"10.0.0.1:3306"}, Role: "master"}
+	replica := Resource{Kind: KindServer, Name: "db2", Role: "slave"}
+	other := Resource{Kind: KindServer, Name: "db9"}
+	cluster := Resource{Kind: KindCluster, Name: "c1"}
+
+	tests := []struct {
+		grant   string
+		res     Resource
+		allowed bool
+		reason  string
+	}{
+		{"db-backup", replica, true, "allowed by role backup-team"},
+		{"db-restore", other, true, "allowed by role backup-team"},
+		{"db-backup", master, false, "not granted"},
+		{"db-backup", cluster, false, "not granted"},
+		{"db-show-logs", master, true, "granted by user acl"},
+		{"cluster-failover", cluster, false, "denied by role backup-team"},
+		{"cluster-switchover", replica, false, "denied by role backup-team"},
+	}
+	for _, tt := range tests {
+		d := Evaluate(base, bound, tt.grant, tt.res)
+		if d.Allowed != tt.allowed || d.Reason != tt.reason {
+			t.Errorf("%s on %s: expected %v %q got %v %q", tt.grant, tt.res.Name, tt.allowed, tt.reason, d.Allowed, d.Reason)
+		}
+	}
+
+	// prefix grants, patterns, tags and aliases
+	role, err := ParseRole("ops=allow db- on server:10.0.0.*;allow proxy-start on tag:edge;deny db-kill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := EffectiveGrants(nil, []Role{role}, []string{"db-stop", "db-kill", "proxy-start"}, master)
+	if !g["db-stop"] || g["db-kill"] || g["proxy-start"] {
+		t.Errorf("Unexpected effective grants on master %v", g)
+	}
+	g = EffectiveGrants(nil, []Role{role}, []string{"db-stop", "proxy-start"}, Resource{Kind: KindProxy, Name: "px1", Tags: []string{"edge"}})
+	if g["db-stop"] || !g["proxy-start"] {
+		t.Errorf("Unexpected effective grants on proxy %v", g)
+	}
+}
+
+func TestAllowedGrants(t *testing.T) {
+	role, _ := ParseRole("ops=allow db-backup on role:slave;allow proxy-;deny cluster-")
+	grants := role.AllowedGrants([]string{"db-backup", "db-stop", "proxy-start", "proxy-stop", "cluster-failover"})
+	if strings.Join(grants, " ") != "db-backup proxy-start proxy-stop" {
+		t.Errorf("Unexpected allowed grants %v", grants)
+	}
+	all, _ := ParseRole("all=allow *")
+	if len(all.AllowedGrants([]string{"db-stop", "grant-modify"})) != 2 {
+		t.Error("Expected * to allow every grant")
+	}
+}
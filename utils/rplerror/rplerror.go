@@ -0,0 +1,113 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+// Package rplerror classifies the errors of the replication threads and maps each class to a playbook action
+package rplerror
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	ClassNone          = ""
+	ClassDuplicateKey  = "duplicate-key"
+	ClassRowNotFound   = "row-not-found"
+	ClassMissingTable  = "missing-table"
+	ClassRelayLog      = "relay-log"
+	ClassMissingBinlog = "missing-binlog"
+	ClassUnknown       = "unknown"
+
+	ActionNone         = "none"
+	ActionSkipVerified = "skip-verified"
+	ActionFetchRow     = "fetch-row"
+	ActionFixRelay     = "fix-relay"
+	ActionReseed       = "reseed"
+)
+
+// sqlErrors are the SQL thread error numbers of MariaDB and MySQL
+var sqlErrors = map[string]string{
+	"1022":  ClassDuplicateKey,
+	"1062":  ClassDuplicateKey,
+	"1586":  ClassDuplicateKey,
+	"1032":  ClassRowNotFound,
+	"1146":  ClassMissingTable,
+	"1049":  ClassMissingTable,
+	"1594":  ClassRelayLog,
+	"13121": ClassRelayLog,
+}
+
+// ioErrors are the IO thread error numbers, 13114 wraps the 1236 of the source since MySQL 8.0
+var ioErrors = map[string]string{
+	"1595":  ClassRelayLog,
+	"1743":  ClassRelayLog,
+	"13122": ClassRelayLog,
+	"1236":  ClassMissingBinlog,
+	"13114": ClassMissingBinlog,
+}
+
+var (
+	reTable        = regexp.MustCompile("on table ([^.\\s;]+)\\.([^\\s;]+)")
+	reMissingTable = regexp.MustCompile("Table '([^.']+)\\.([^']+)' doesn't exist")
+)
+
+// Classify returns the class of the replication error, the SQL thread error wins over the IO thread error
+func Classify(sqlErrno string, ioErrno string) string {
+	if class, ok := sqlErrors[sqlErrno]; ok {
+		return class
+	}
+	if sqlErrno != "" && sqlErrno != "0" {
+		return ClassUnknown
+	}
+	if class, ok := ioErrors[ioErrno]; ok {
+		return class
+	}
+	if ioErrno != "" && ioErrno != "0" {
+		return ClassUnknown
+	}
+	return ClassNone
+}
+
+// ParseTable returns the schema and table named in a replication error message
+func ParseTable(msg string) (string, string, bool) {
+	if m := reTable.FindStringSubmatch(msg); m != nil {
+		return strings.Trim(m[1], "`"), strings.Trim(m[2], "`"), true
+	}
+	if m := reMissingTable.FindStringSubmatch(msg); m != nil {
+		return m[1], m[2], true
+	}
+	return "", "", false
+}
+
+// IsAction returns true for a known playbook action
+func IsAction(action string) bool {
+	switch action {
+	case ActionNone, ActionSkipVerified, ActionFetchRow, ActionFixRelay, ActionReseed:
+		return true
+	}
+	return false
+}
+
+// ParsePlaybooks reads a list of class=action separated by commas, unknown actions are ignored
+func ParsePlaybooks(list string) map[string]string {
+	playbooks := make(map[string]string)
+	for _, item := range strings.Split(list, ",") {
+		kv := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		class := strings.TrimSpace(kv[0])
+		action := strings.TrimSpace(kv[1])
+		if class == "" || !IsAction(action) {
+			continue
+		}
+		playbooks[class] = action
+	}
+	return playbooks
+}
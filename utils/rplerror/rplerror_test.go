@@ -0,0 +1,65 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+// Redistribution/Reuse of this code is permitted under the GNU v3 license, as
+// an additional term, ALL code must carry the original Author(s) credit in comment form.
+// See LICENSE in this directory for the integral text.
+
+package rplerror
+
+import "testing"
+
+func TestClassify(t *testing.T) {
+	cases := []struct {
+		sql, io, class string
+	}{
+		{"1062", "0", ClassDuplicateKey},
+		{"1032", "", ClassRowNotFound},
+		{"1146", "0", ClassMissingTable},
+		{"1594", "0", ClassRelayLog},
+		{"0", "1236", ClassMissingBinlog},
+		{"0", "13114", ClassMissingBinlog},
+		{"1062", "1236", ClassDuplicateKey},
+		{"1105", "0", ClassUnknown},
+		{"0", "2003", ClassUnknown},
+		{"0", "0", ClassNone},
+		{"", "", ClassNone},
+	}
+	for _, c := range cases {
+		if class := Classify(c.sql, c.io); class != c.class {
+			t.Errorf("Classify(%q, %q) = %q, expected %q", c.sql, c.io, class, c.class)
+		}
+	}
+}
+
+func TestParseTable(t *testing.T) {
+	msgs := map[string][2]string{
+		"Could not execute Update_rows_v1 event on table test.t1; Can't find record in 't1', Error_code: 1032; handler error HA_ERR_KEY_NOT_FOUND; the event's master log mysql-bin.000003, end_log_pos 1234": {"test", "t1"},
+		"Could not execute Write_rows event on table shop.orders; Duplicate entry '12' for key 'PRIMARY', Error_code: 1062":                                                                                   {"shop", "orders"},
+		"Error executing row event: 'Table 'app.users' doesn't exist'":                                                                                                                                        {"app", "users"},
+	}
+	for msg, expected := range msgs {
+		schema, table, ok := ParseTable(msg)
+		if !ok || schema != expected[0] || table != expected[1] {
+			t.Errorf("ParseTable(%q) = %s.%s %v, expected %s.%s", msg, schema, table, ok, expected[0], expected[1])
+		}
+	}
+	if _, _, ok := ParseTable("Relay log read failure"); ok {
+		t.Error("Expected no table in a relay log error")
+	}
+}
+
+func TestParsePlaybooks(t *testing.T) {
+	playbooks := ParsePlaybooks(" duplicate-key=skip-verified, row-not-found=fetch-row,missing-table=drop,relay-log=fix-relay,bad")
+	if len(playbooks) != 3 {
+		t.Fatalf("Expected 3 playbooks, got %v", playbooks)
+	}
+	if playbooks[ClassDuplicateKey] != ActionSkipVerified || playbooks[ClassRowNotFound] != ActionFetchRow || playbooks[ClassRelayLog] != ActionFixRelay {
+		t.Errorf("Unexpected playbooks %v", playbooks)
+	}
+	if _, ok := playbooks[ClassMissingTable]; ok {
+		t.Error("Unknown action should be ignored")
+	}
+}
@@ -0,0 +1,89 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+package secaudit
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/signal18/replication-manager/utils/version"
+)
+
+//go:embed advisories.json
+var bundledAdvisories []byte
+
+// Advisory is a vulnerability of a flavor, Fixed holds the first fixed release of every
+// affected major.minor branch
+type Advisory struct {
+	ID       string   `json:"id"`
+	Flavor   string   `json:"flavor"`
+	Severity Severity `json:"severity"`
+	Summary  string   `json:"summary"`
+	Fixed    []string `json:"fixed"`
+}
+
+// LoadAdvisories returns the bundled advisories followed by the ones of the file when a
+// path is given
+func LoadAdvisories(path string) ([]Advisory, error) {
+	var advs []Advisory
+	if err := json.Unmarshal(bundledAdvisories, &advs); err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return advs, nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return advs, err
+	}
+	var extra []Advisory
+	if err := json.Unmarshal(content, &extra); err != nil {
+		return advs, fmt.Errorf("Invalid advisories file %s: %s", path, err)
+	}
+	return append(advs, extra...), nil
+}
+
+// Affects is true when the version is in a branch of the advisory and older than its fix,
+// Percona Server follows the MySQL releases
+func (a Advisory) Affects(v *version.Version) bool {
+	if v == nil {
+		return false
+	}
+	flavor := v.Flavor
+	if flavor == "Percona" {
+		flavor = "MySQL"
+	}
+	if flavor != a.Flavor {
+		return false
+	}
+	for _, fixed := range a.Fixed {
+		if v.LowerRelease(fixed) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckAdvisories reports the advisories affecting the server version
+func CheckAdvisories(server string, v *version.Version, advs []Advisory) []Finding {
+	var findings []Finding
+	for _, a := range advs {
+		if !a.Affects(v) {
+			continue
+		}
+		findings = append(findings, Finding{
+			Check:    CheckAdvisory,
+			Severity: a.Severity,
+			Server:   server,
+			Object:   a.ID,
+			Detail:   fmt.Sprintf("%s %d.%d.%d: %s", v.Flavor, v.Major, v.Minor, v.Release, a.Summary),
+		})
+	}
+	return findings
+}
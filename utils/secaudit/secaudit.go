@@ -0,0 +1,204 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+// Package secaudit evaluates the security posture of a database server from its accounts,
+// its variables, its version and the permissions of its datadir.
+package secaudit
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+type Severity string
+
+const (
+	SeverityCritical Severity = "critical"
+	SeverityHigh     Severity = "high"
+	SeverityMedium   Severity = "medium"
+	SeverityLow      Severity = "low"
+)
+
+// Rank orders severities, critical first
+func (s Severity) Rank() int {
+	switch s {
+	case SeverityCritical:
+		return 0
+	case SeverityHigh:
+		return 1
+	case SeverityMedium:
+		return 2
+	}
+	return 3
+}
+
+const (
+	CheckAnonymousUser   = "anonymous-user"
+	CheckEmptyPassword   = "empty-password"
+	CheckRemoteSuper     = "remote-super"
+	CheckSecureTransport = "require-secure-transport"
+	CheckReplicationTLS  = "replication-tls"
+	CheckLocalInfile     = "local-infile"
+	CheckAdvisory        = "advisory"
+	CheckDatadirReadable = "datadir-permissions"
+)
+
+// Finding is a security issue found on a server, Fix is the statement that solves it when
+// it can be solved without side effect on the applications
+type Finding struct {
+	Check    string   `json:"check"`
+	Severity Severity `json:"severity"`
+	Server   string   `json:"server"`
+	Object   string   `json:"object"`
+	Detail   string   `json:"detail"`
+	Fix      string   `json:"fix,omitempty"`
+	Fixed    bool     `json:"fixed"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// Account is a row of the server user table
+type Account struct {
+	User        string
+	Host        string
+	Plugin      string
+	HasPassword bool
+	Super       bool
+}
+
+func (a Account) String() string {
+	return "'" + a.User + "'@'" + a.Host + "'"
+}
+
+// passwordlessPlugins authenticate with the operating system or a certificate, an empty
+// authentication string is expected for them
+var passwordlessPlugins = map[string]bool{
+	"unix_socket":                true,
+	"auth_socket":                true,
+	"gssapi":                     true,
+	"pam":                        true,
+	"auth_pam":                   true,
+	"authentication_ldap_sasl":   true,
+	"authentication_ldap_simple": true,
+}
+
+// CheckAccounts reports anonymous users, users without password and users that can connect
+// from any host with the SUPER privilege
+func CheckAccounts(server string, accounts []Account) []Finding {
+	var findings []Finding
+	for _, a := range accounts {
+		if a.User == "" {
+			findings = append(findings, Finding{
+				Check:    CheckAnonymousUser,
+				Severity: SeverityHigh,
+				Server:   server,
+				Object:   a.String(),
+				Detail:   "anonymous user can connect from " + a.Host,
+				Fix:      "DROP USER " + a.String(),
+			})
+			continue
+		}
+		if !a.HasPassword && !passwordlessPlugins[strings.ToLower(a.Plugin)] {
+			findings = append(findings, Finding{
+				Check:    CheckEmptyPassword,
+				Severity: SeverityCritical,
+				Server:   server,
+				Object:   a.String(),
+				Detail:   "user has no password",
+			})
+		}
+		if a.Host == "%" && a.Super {
+			findings = append(findings, Finding{
+				Check:    CheckRemoteSuper,
+				Severity: SeverityHigh,
+				Server:   server,
+				Object:   a.String(),
+				Detail:   "user with SUPER privilege can connect from any host",
+			})
+		}
+	}
+	return findings
+}
+
+// CheckVariables reports local_infile and require_secure_transport from the global variables
+// with upper case names, a variable that does not exist in the server version is skipped
+func CheckVariables(server string, variables map[string]string) []Finding {
+	var findings []Finding
+	if v, ok := variables["LOCAL_INFILE"]; ok && isOn(v) {
+		findings = append(findings, Finding{
+			Check:    CheckLocalInfile,
+			Severity: SeverityMedium,
+			Server:   server,
+			Object:   "local_infile",
+			Detail:   "clients can load files from the server host with LOAD DATA LOCAL",
+			Fix:      "SET GLOBAL local_infile=OFF",
+		})
+	}
+	if v, ok := variables["REQUIRE_SECURE_TRANSPORT"]; ok && !isOn(v) {
+		findings = append(findings, Finding{
+			Check:    CheckSecureTransport,
+			Severity: SeverityMedium,
+			Server:   server,
+			Object:   "require_secure_transport",
+			Detail:   "clients can connect without TLS",
+		})
+	}
+	return findings
+}
+
+// CheckReplicationChannel reports a replication channel that does not use TLS
+func CheckReplicationChannel(server string, channel string, sslAllowed string) []Finding {
+	if strings.EqualFold(sslAllowed, "Yes") {
+		return nil
+	}
+	if channel == "" {
+		channel = "default"
+	}
+	return []Finding{{
+		Check:    CheckReplicationTLS,
+		Severity: SeverityMedium,
+		Server:   server,
+		Object:   channel,
+		Detail:   "replication channel " + channel + " does not use TLS",
+	}}
+}
+
+// CheckDatadirMode reports a datadir that other users of the host can read or write
+func CheckDatadirMode(server string, datadir string, mode os.FileMode) []Finding {
+	perm := mode.Perm()
+	if perm&0006 == 0 {
+		return nil
+	}
+	return []Finding{{
+		Check:    CheckDatadirReadable,
+		Severity: SeverityHigh,
+		Server:   server,
+		Object:   datadir,
+		Detail:   fmt.Sprintf("datadir mode %04o gives access to other users of the host", perm),
+	}}
+}
+
+// Sort orders findings by severity, server and check
+func Sort(findings []Finding) {
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].Severity.Rank() != findings[j].Severity.Rank() {
+			return findings[i].Severity.Rank() < findings[j].Severity.Rank()
+		}
+		if findings[i].Server != findings[j].Server {
+			return findings[i].Server < findings[j].Server
+		}
+		return findings[i].Check < findings[j].Check
+	})
+}
+
+func isOn(v string) bool {
+	switch strings.ToUpper(v) {
+	case "ON", "1", "YES", "TRUE":
+		return true
+	}
+	return false
+}
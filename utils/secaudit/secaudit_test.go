@@ -0,0 +1,99 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+package secaudit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/signal18/replication-manager/utils/version"
+)
+
+func TestCheckAccounts(t *testing.T) {
+	findings := CheckAccounts("db1:3306", []Account{
+		{User: "", Host: "localhost"},
+		{User: "root", Host: "localhost", Plugin: "unix_socket"},
+		{User: "app", Host: "10.0.%", Plugin: "mysql_native_password"},
+		{User: "admin", Host: "%", HasPassword: true, Super: true},
+		{User: "repl", Host: "%", HasPassword: true},
+	})
+	if len(findings) != 3 {
+		t.Fatalf("Unexpected findings %v", findings)
+	}
+	if findings[0].Check != CheckAnonymousUser || findings[0].Fix != "DROP USER ''@'localhost'" {
+		t.Errorf("Unexpected anonymous finding %v", findings[0])
+	}
+	if findings[1].Check != CheckEmptyPassword || findings[1].Object != "'app'@'10.0.%'" || findings[1].Severity != SeverityCritical {
+		t.Errorf("Unexpected password finding %v", findings[1])
+	}
+	if findings[2].Check != CheckRemoteSuper || findings[2].Fix != "" {
+		t.Errorf("Unexpected super finding %v", findings[2])
+	}
+	Sort(findings)
+	if findings[0].Check != CheckEmptyPassword {
+		t.Errorf("Expected critical finding first got %v", findings[0])
+	}
+}
+
+func TestCheckVariables(t *testing.T) {
+	findings := CheckVariables("db1:3306", map[string]string{"LOCAL_INFILE": "ON", "REQUIRE_SECURE_TRANSPORT": "OFF"})
+	if len(findings) != 2 || findings[0].Fix != "SET GLOBAL local_infile=OFF" || findings[1].Check != CheckSecureTransport {
+		t.Errorf("Unexpected findings %v", findings)
+	}
+	// versions without require_secure_transport
+	if findings := CheckVariables("db1:3306", map[string]string{"LOCAL_INFILE": "OFF"}); len(findings) != 0 {
+		t.Errorf("Expected no finding got %v", findings)
+	}
+	if findings := CheckReplicationChannel("db2:3306", "", "No"); len(findings) != 1 || findings[0].Object != "default" {
+		t.Errorf("Unexpected replication findings %v", findings)
+	}
+	if findings := CheckReplicationChannel("db2:3306", "", "Yes"); len(findings) != 0 {
+		t.Errorf("Expected no replication finding got %v", findings)
+	}
+}
+
+func TestCheckDatadirMode(t *testing.T) {
+	if findings := CheckDatadirMode("db1:3306", "/var/lib/mysql", os.ModeDir|0755); len(findings) != 1 {
+		t.Errorf("Expected world readable finding got %v", findings)
+	}
+	if findings := CheckDatadirMode("db1:3306", "/var/lib/mysql", os.ModeDir|0750); len(findings) != 0 {
+		t.Errorf("Expected no finding got %v", findings)
+	}
+}
+
+func TestAdvisories(t *testing.T) {
+	advs, err := LoadAdvisories("")
+	if err != nil || len(advs) == 0 {
+		t.Fatalf("Could not load bundled advisories %v", err)
+	}
+	old, _ := version.NewVersionFromString("MariaDB", "10.5.8")
+	patched, _ := version.NewVersionFromString("MariaDB", "10.5.9")
+	recent, _ := version.NewVersionFromString("MariaDB", "10.11.6")
+	if findings := CheckAdvisories("db1:3306", old, advs); len(findings) != 1 || findings[0].Object != "CVE-2021-27928" {
+		t.Errorf("Unexpected findings %v", findings)
+	}
+	if findings := CheckAdvisories("db1:3306", patched, advs); len(findings) != 0 {
+		t.Errorf("Expected no finding for patched release got %v", findings)
+	}
+	if findings := CheckAdvisories("db1:3306", recent, advs); len(findings) != 0 {
+		t.Errorf("Expected no finding for other branch got %v", findings)
+	}
+	percona, _ := version.NewVersionFromString("Percona", "5.7.14")
+	if findings := CheckAdvisories("db1:3306", percona, advs); len(findings) != 1 || findings[0].Object != "CVE-2016-6662" {
+		t.Errorf("Unexpected Percona findings %v", findings)
+	}
+	path := filepath.Join(t.TempDir(), "advisories.json")
+	os.WriteFile(path, []byte(`[{"id":"TEST-1","flavor":"MariaDB","severity":"low","fixed":["10.11.7"]}]`), 0600)
+	advs, err = LoadAdvisories(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if findings := CheckAdvisories("db1:3306", recent, advs); len(findings) != 1 || findings[0].Severity != SeverityLow {
+		t.Errorf("Unexpected findings with extra advisories %v", findings)
+	}
+}
@@ -0,0 +1,151 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+// Package vaultlease tracks the lease of Vault secrets so that dynamic credentials are
+// renewed before they expire and read again once they can not be renewed anymore.
+package vaultlease
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	vault "github.com/hashicorp/vault/api"
+)
+
+// Action is what to do with a lease at a given time
+type Action int
+
+const (
+	// Valid means the secret can still be used as is
+	Valid Action = iota
+	// Renew means the lease should be extended
+	Renew
+	// Reread means the secret must be read again to get new credentials
+	Reread
+)
+
+func (a Action) String() string {
+	switch a {
+	case Renew:
+		return "renew"
+	case Reread:
+		return "reread"
+	}
+	return "valid"
+}
+
+var ErrSecretNotFound = errors.New("Vault secret not found")
+
+// Lease is the lifetime of a secret, static database roles have no lease id but a ttl
+// in their data telling when Vault rotates the password
+type Lease struct {
+	ID        string        `json:"id"`
+	Renewable bool          `json:"renewable"`
+	Duration  time.Duration `json:"duration"`
+	Obtained  time.Time     `json:"obtained"`
+	Expires   time.Time     `json:"expires"`
+	Renewed   time.Time     `json:"renewed"`
+}
+
+// FromSecret returns the lease of a secret read at now, a secret without lease nor ttl never expires
+func FromSecret(s *vault.Secret, now time.Time) Lease {
+	l := Lease{Obtained: now}
+	if s == nil {
+		return l
+	}
+	l.ID = s.LeaseID
+	l.Renewable = s.Renewable
+	seconds := s.LeaseDuration
+	if seconds == 0 && s.Data != nil {
+		seconds = dataTTL(s.Data["ttl"])
+	}
+	if seconds > 0 {
+		l.Duration = time.Duration(seconds) * time.Second
+		l.Expires = now.Add(l.Duration)
+	}
+	return l
+}
+
+func dataTTL(v interface{}) int {
+	switch t := v.(type) {
+	case json.Number:
+		i, _ := t.Int64()
+		return int(i)
+	case float64:
+		return int(t)
+	case int:
+		return t
+	case int64:
+		return int(t)
+	}
+	return 0
+}
+
+// Next tells what to do with the lease at now, threshold is the fraction of the lease
+// duration left below which a dynamic lease is renewed
+func (l Lease) Next(now time.Time, threshold float64) Action {
+	if l.Expires.IsZero() {
+		return Valid
+	}
+	left := l.Expires.Sub(now)
+	if left <= 0 {
+		return Reread
+	}
+	if l.ID == "" {
+		// static credentials are rotated by Vault at expiry
+		return Valid
+	}
+	if left > time.Duration(float64(l.Duration)*threshold) {
+		return Valid
+	}
+	if l.Renewable {
+		return Renew
+	}
+	return Reread
+}
+
+// Remaining returns the lease time left at now
+func (l Lease) Remaining(now time.Time) time.Duration {
+	if l.Expires.IsZero() {
+		return 0
+	}
+	return l.Expires.Sub(now)
+}
+
+// Read reads a secret and its lease
+func Read(client *vault.Client, path string) (*vault.Secret, Lease, error) {
+	s, err := client.Logical().Read(path)
+	if err != nil {
+		return nil, Lease{}, err
+	}
+	if s == nil {
+		return nil, Lease{}, fmt.Errorf("%w: %s", ErrSecretNotFound, path)
+	}
+	return s, FromSecret(s, time.Now()), nil
+}
+
+// RenewLease extends a lease by its original duration, Vault may grant less when the
+// max ttl of the role is reached, the returned lease then asks for a reread once short
+func RenewLease(client *vault.Client, l Lease) (Lease, error) {
+	if l.ID == "" || !l.Renewable {
+		return l, errors.New("Vault lease is not renewable")
+	}
+	s, err := client.Sys().Renew(l.ID, int(l.Duration.Seconds()))
+	if err != nil {
+		return l, err
+	}
+	now := time.Now()
+	l.Renewed = now
+	if s != nil && s.LeaseDuration > 0 {
+		granted := time.Duration(s.LeaseDuration) * time.Second
+		l.Expires = now.Add(granted)
+		// a shorter grant means the max ttl is reached, next time read new credentials
+		l.Renewable = s.Renewable && granted >= l.Duration
+	}
+	return l, nil
+}
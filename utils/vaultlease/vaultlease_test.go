@@ -0,0 +1,90 @@
+// replication-manager - Replication Manager Monitoring and CLI for MariaDB and MySQL
+// Copyright 2017-2021 SIGNAL18 CLOUD SAS
+// Authors: Guillaume Lefranc <guillaume@signal18.io>
+//          Stephane Varoqui  <svaroqui@gmail.com>
+// This source code is licensed under the GNU General Public License, version 3.
+
+package vaultlease
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	vault "github.com/hashicorp/vault/api"
+)
+
+func TestDynamicLease(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := FromSecret(&vault.Secret{LeaseID: "database/creds/repl/abc", LeaseDuration: 3600, Renewable: true}, now)
+	if l.Duration != time.Hour || !l.Expires.Equal(now.Add(time.Hour)) {
+		t.Fatalf("Unexpected lease %v", l)
+	}
+	for _, c := range []struct {
+		at   time.Duration
+		want Action
+	}{
+		{0, Valid},
+		{30 * time.Minute, Valid},
+		{50 * time.Minute, Renew},
+		{time.Hour, Reread},
+	} {
+		if got := l.Next(now.Add(c.at), 0.33); got != c.want {
+			t.Errorf("At %s expected %s got %s", c.at, c.want, got)
+		}
+	}
+	l.Renewable = false
+	if got := l.Next(now.Add(50*time.Minute), 0.33); got != Reread {
+		t.Errorf("Expected reread of a non renewable lease got %s", got)
+	}
+}
+
+func TestStaticLease(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := FromSecret(&vault.Secret{Data: map[string]interface{}{"username": "repl", "password": "x", "ttl": json.Number("600")}}, now)
+	if l.ID != "" || l.Duration != 10*time.Minute {
+		t.Fatalf("Unexpected lease %v", l)
+	}
+	if got := l.Next(now.Add(9*time.Minute), 0.33); got != Valid {
+		t.Errorf("Expected static credentials valid until rotation got %s", got)
+	}
+	if got := l.Next(now.Add(10*time.Minute), 0.33); got != Reread {
+		t.Errorf("Expected reread after rotation got %s", got)
+	}
+	kv := FromSecret(&vault.Secret{Data: map[string]interface{}{"db-servers-credential": "a:b"}}, now)
+	if got := kv.Next(now.Add(24*time.Hour), 0.33); got != Valid {
+		t.Errorf("Expected secret without lease to stay valid got %s", got)
+	}
+}
+
+// TestVaultDevServer runs against a dev server started with vault server -dev, for example:
+// VAULT_ADDR=http://127.0.0.1:8200 VAULT_TOKEN=root go test ./utils/vaultlease
+func TestVaultDevServer(t *testing.T) {
+	if os.Getenv("VAULT_ADDR") == "" || os.Getenv("VAULT_TOKEN") == "" {
+		t.Skip("VAULT_ADDR and VAULT_TOKEN are not set")
+	}
+	client, err := vault.NewClient(vault.DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.KVv2("secret").Put(context.Background(), "repman-test", map[string]interface{}{"replication-credential": "repl:secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, l, err := Read(client, "secret/data/repman-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Data["data"] == nil || l.Next(time.Now(), 0.33) != Valid {
+		t.Errorf("Unexpected secret %v lease %v", s.Data, l)
+	}
+	if _, _, err = Read(client, "secret/data/repman-missing"); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("Expected secret not found got %v", err)
+	}
+	if _, err = RenewLease(client, l); err == nil {
+		t.Errorf("Expected error renewing a secret without lease")
+	}
+}